@@ -0,0 +1,1024 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: filecache/v1/filecache.proto
+
+package filecachev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// CacheStatus is how a file was served
+type CacheStatus int32
+
+const (
+	CacheStatus_CACHE_STATUS_UNSPECIFIED CacheStatus = 0
+	// Served from the cache
+	CacheStatus_CACHE_STATUS_HIT CacheStatus = 1
+	// Fetched from storage after a cache lookup
+	CacheStatus_CACHE_STATUS_MISS CacheStatus = 2
+	// Caching was skipped for this request
+	CacheStatus_CACHE_STATUS_BYPASS CacheStatus = 3
+	// Fetched from storage on request, overwriting the cache
+	CacheStatus_CACHE_STATUS_REFRESH CacheStatus = 4
+)
+
+// Enum value maps for CacheStatus.
+var (
+	CacheStatus_name = map[int32]string{
+		0: "CACHE_STATUS_UNSPECIFIED",
+		1: "CACHE_STATUS_HIT",
+		2: "CACHE_STATUS_MISS",
+		3: "CACHE_STATUS_BYPASS",
+		4: "CACHE_STATUS_REFRESH",
+	}
+	CacheStatus_value = map[string]int32{
+		"CACHE_STATUS_UNSPECIFIED": 0,
+		"CACHE_STATUS_HIT":         1,
+		"CACHE_STATUS_MISS":        2,
+		"CACHE_STATUS_BYPASS":      3,
+		"CACHE_STATUS_REFRESH":     4,
+	}
+)
+
+func (x CacheStatus) Enum() *CacheStatus {
+	p := new(CacheStatus)
+	*p = x
+	return p
+}
+
+func (x CacheStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CacheStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_filecache_v1_filecache_proto_enumTypes[0].Descriptor()
+}
+
+func (CacheStatus) Type() protoreflect.EnumType {
+	return &file_filecache_v1_filecache_proto_enumTypes[0]
+}
+
+func (x CacheStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CacheStatus.Descriptor instead.
+func (CacheStatus) EnumDescriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{0}
+}
+
+// FileInfo describes a file
+type FileInfo struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Name         string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size         int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	ContentType  string                 `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Etag         string                 `protobuf:"bytes,4,opt,name=etag,proto3" json:"etag,omitempty"`
+	LastModified *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=last_modified,json=lastModified,proto3" json:"last_modified,omitempty"`
+	// Headers are the object headers passed through to HTTP responses
+	Headers       map[string]string `protobuf:"bytes,6,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FileInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *FileInfo) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *FileInfo) GetLastModified() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastModified
+	}
+	return nil
+}
+
+func (x *FileInfo) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+type GetFileRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Refresh skips the cache and overwrites the cached entry. It may require
+	// the cache:purge scope.
+	Refresh       bool `protobuf:"varint,2,opt,name=refresh,proto3" json:"refresh,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFileRequest) Reset() {
+	*x = GetFileRequest{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFileRequest) ProtoMessage() {}
+
+func (x *GetFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFileRequest.ProtoReflect.Descriptor instead.
+func (*GetFileRequest) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetFileRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *GetFileRequest) GetRefresh() bool {
+	if x != nil {
+		return x.Refresh
+	}
+	return false
+}
+
+type GetFileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*GetFileResponse_Header
+	//	*GetFileResponse_Chunk
+	Part          isGetFileResponse_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFileResponse) Reset() {
+	*x = GetFileResponse{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFileResponse) ProtoMessage() {}
+
+func (x *GetFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFileResponse.ProtoReflect.Descriptor instead.
+func (*GetFileResponse) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetFileResponse) GetPart() isGetFileResponse_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *GetFileResponse) GetHeader() *GetFileHeader {
+	if x != nil {
+		if x, ok := x.Part.(*GetFileResponse_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *GetFileResponse) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*GetFileResponse_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isGetFileResponse_Part interface {
+	isGetFileResponse_Part()
+}
+
+type GetFileResponse_Header struct {
+	Header *GetFileHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type GetFileResponse_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*GetFileResponse_Header) isGetFileResponse_Part() {}
+
+func (*GetFileResponse_Chunk) isGetFileResponse_Part() {}
+
+type GetFileHeader struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Info        *FileInfo              `protobuf:"bytes,1,opt,name=info,proto3" json:"info,omitempty"`
+	CacheStatus CacheStatus            `protobuf:"varint,2,opt,name=cache_status,json=cacheStatus,proto3,enum=filecache.v1.CacheStatus" json:"cache_status,omitempty"`
+	// Age is how long ago the file was cached, in seconds, on cache hits
+	AgeSeconds    int64 `protobuf:"varint,3,opt,name=age_seconds,json=ageSeconds,proto3" json:"age_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFileHeader) Reset() {
+	*x = GetFileHeader{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFileHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFileHeader) ProtoMessage() {}
+
+func (x *GetFileHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFileHeader.ProtoReflect.Descriptor instead.
+func (*GetFileHeader) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetFileHeader) GetInfo() *FileInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *GetFileHeader) GetCacheStatus() CacheStatus {
+	if x != nil {
+		return x.CacheStatus
+	}
+	return CacheStatus_CACHE_STATUS_UNSPECIFIED
+}
+
+func (x *GetFileHeader) GetAgeSeconds() int64 {
+	if x != nil {
+		return x.AgeSeconds
+	}
+	return 0
+}
+
+type PutFileRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*PutFileRequest_Header
+	//	*PutFileRequest_Chunk
+	Part          isPutFileRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutFileRequest) Reset() {
+	*x = PutFileRequest{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutFileRequest) ProtoMessage() {}
+
+func (x *PutFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutFileRequest.ProtoReflect.Descriptor instead.
+func (*PutFileRequest) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PutFileRequest) GetPart() isPutFileRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *PutFileRequest) GetHeader() *PutFileHeader {
+	if x != nil {
+		if x, ok := x.Part.(*PutFileRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *PutFileRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*PutFileRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isPutFileRequest_Part interface {
+	isPutFileRequest_Part()
+}
+
+type PutFileRequest_Header struct {
+	Header *PutFileHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type PutFileRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*PutFileRequest_Header) isPutFileRequest_Part() {}
+
+func (*PutFileRequest_Chunk) isPutFileRequest_Part() {}
+
+type PutFileHeader struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Content type stored with the file; defaults to the type implied by the
+	// file extension
+	ContentType   string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutFileHeader) Reset() {
+	*x = PutFileHeader{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutFileHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutFileHeader) ProtoMessage() {}
+
+func (x *PutFileHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutFileHeader.ProtoReflect.Descriptor instead.
+func (*PutFileHeader) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PutFileHeader) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PutFileHeader) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+type PutFileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size  int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	// Purged is the number of cache entries evicted for the file
+	Purged        int64 `protobuf:"varint,3,opt,name=purged,proto3" json:"purged,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutFileResponse) Reset() {
+	*x = PutFileResponse{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutFileResponse) ProtoMessage() {}
+
+func (x *PutFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutFileResponse.ProtoReflect.Descriptor instead.
+func (*PutFileResponse) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PutFileResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PutFileResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *PutFileResponse) GetPurged() int64 {
+	if x != nil {
+		return x.Purged
+	}
+	return 0
+}
+
+type DeleteFileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFileRequest) Reset() {
+	*x = DeleteFileRequest{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFileRequest) ProtoMessage() {}
+
+func (x *DeleteFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFileRequest.ProtoReflect.Descriptor instead.
+func (*DeleteFileRequest) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteFileRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type DeleteFileResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Purged        int64                  `protobuf:"varint,1,opt,name=purged,proto3" json:"purged,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFileResponse) Reset() {
+	*x = DeleteFileResponse{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFileResponse) ProtoMessage() {}
+
+func (x *DeleteFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFileResponse.ProtoReflect.Descriptor instead.
+func (*DeleteFileResponse) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteFileResponse) GetPurged() int64 {
+	if x != nil {
+		return x.Purged
+	}
+	return 0
+}
+
+type StatFileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatFileRequest) Reset() {
+	*x = StatFileRequest{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatFileRequest) ProtoMessage() {}
+
+func (x *StatFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatFileRequest.ProtoReflect.Descriptor instead.
+func (*StatFileRequest) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StatFileRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type StatFileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Info  *FileInfo              `protobuf:"bytes,1,opt,name=info,proto3" json:"info,omitempty"`
+	// Cached reports whether the file is in the cache
+	Cached        bool `protobuf:"varint,2,opt,name=cached,proto3" json:"cached,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatFileResponse) Reset() {
+	*x = StatFileResponse{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatFileResponse) ProtoMessage() {}
+
+func (x *StatFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatFileResponse.ProtoReflect.Descriptor instead.
+func (*StatFileResponse) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StatFileResponse) GetInfo() *FileInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *StatFileResponse) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+type ListFilesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only names starting with prefix are listed
+	Prefix string `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// Page size, 1-1000; defaults to 100
+	Limit int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Page token from the previous response
+	PageToken     string `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFilesRequest) Reset() {
+	*x = ListFilesRequest{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFilesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFilesRequest) ProtoMessage() {}
+
+func (x *ListFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFilesRequest.ProtoReflect.Descriptor instead.
+func (*ListFilesRequest) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListFilesRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListFilesRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListFilesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Files []*FileInfo            `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	// Token for the next page; empty on the last page
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFilesResponse) Reset() {
+	*x = ListFilesResponse{}
+	mi := &file_filecache_v1_filecache_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFilesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFilesResponse) ProtoMessage() {}
+
+func (x *ListFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filecache_v1_filecache_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFilesResponse.ProtoReflect.Descriptor instead.
+func (*ListFilesResponse) Descriptor() ([]byte, []int) {
+	return file_filecache_v1_filecache_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListFilesResponse) GetFiles() []*FileInfo {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *ListFilesResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+var File_filecache_v1_filecache_proto protoreflect.FileDescriptor
+
+const file_filecache_v1_filecache_proto_rawDesc = "" +
+	"\n" +
+	"\x1cfilecache/v1/filecache.proto\x12\ffilecache.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa5\x02\n" +
+	"\bFileInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04etag\x18\x04 \x01(\tR\x04etag\x12?\n" +
+	"\rlast_modified\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\flastModified\x12=\n" +
+	"\aheaders\x18\x06 \x03(\v2#.filecache.v1.FileInfo.HeadersEntryR\aheaders\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\">\n" +
+	"\x0eGetFileRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\arefresh\x18\x02 \x01(\bR\arefresh\"h\n" +
+	"\x0fGetFileResponse\x125\n" +
+	"\x06header\x18\x01 \x01(\v2\x1b.filecache.v1.GetFileHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\"\x9a\x01\n" +
+	"\rGetFileHeader\x12*\n" +
+	"\x04info\x18\x01 \x01(\v2\x16.filecache.v1.FileInfoR\x04info\x12<\n" +
+	"\fcache_status\x18\x02 \x01(\x0e2\x19.filecache.v1.CacheStatusR\vcacheStatus\x12\x1f\n" +
+	"\vage_seconds\x18\x03 \x01(\x03R\n" +
+	"ageSeconds\"g\n" +
+	"\x0ePutFileRequest\x125\n" +
+	"\x06header\x18\x01 \x01(\v2\x1b.filecache.v1.PutFileHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\"F\n" +
+	"\rPutFileHeader\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\"Q\n" +
+	"\x0fPutFileResponse\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06purged\x18\x03 \x01(\x03R\x06purged\"'\n" +
+	"\x11DeleteFileRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\",\n" +
+	"\x12DeleteFileResponse\x12\x16\n" +
+	"\x06purged\x18\x01 \x01(\x03R\x06purged\"%\n" +
+	"\x0fStatFileRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"V\n" +
+	"\x10StatFileResponse\x12*\n" +
+	"\x04info\x18\x01 \x01(\v2\x16.filecache.v1.FileInfoR\x04info\x12\x16\n" +
+	"\x06cached\x18\x02 \x01(\bR\x06cached\"_\n" +
+	"\x10ListFilesRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\"i\n" +
+	"\x11ListFilesResponse\x12,\n" +
+	"\x05files\x18\x01 \x03(\v2\x16.filecache.v1.FileInfoR\x05files\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken*\x8b\x01\n" +
+	"\vCacheStatus\x12\x1c\n" +
+	"\x18CACHE_STATUS_UNSPECIFIED\x10\x00\x12\x14\n" +
+	"\x10CACHE_STATUS_HIT\x10\x01\x12\x15\n" +
+	"\x11CACHE_STATUS_MISS\x10\x02\x12\x17\n" +
+	"\x13CACHE_STATUS_BYPASS\x10\x03\x12\x18\n" +
+	"\x14CACHE_STATUS_REFRESH\x10\x042\x8b\x03\n" +
+	"\vFileService\x12H\n" +
+	"\aGetFile\x12\x1c.filecache.v1.GetFileRequest\x1a\x1d.filecache.v1.GetFileResponse0\x01\x12H\n" +
+	"\aPutFile\x12\x1c.filecache.v1.PutFileRequest\x1a\x1d.filecache.v1.PutFileResponse(\x01\x12O\n" +
+	"\n" +
+	"DeleteFile\x12\x1f.filecache.v1.DeleteFileRequest\x1a .filecache.v1.DeleteFileResponse\x12I\n" +
+	"\bStatFile\x12\x1d.filecache.v1.StatFileRequest\x1a\x1e.filecache.v1.StatFileResponse\x12L\n" +
+	"\tListFiles\x12\x1e.filecache.v1.ListFilesRequest\x1a\x1f.filecache.v1.ListFilesResponseB@Z>github.com/ch374n/file-downloader/api/filecache/v1;filecachev1b\x06proto3"
+
+var (
+	file_filecache_v1_filecache_proto_rawDescOnce sync.Once
+	file_filecache_v1_filecache_proto_rawDescData []byte
+)
+
+func file_filecache_v1_filecache_proto_rawDescGZIP() []byte {
+	file_filecache_v1_filecache_proto_rawDescOnce.Do(func() {
+		file_filecache_v1_filecache_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_filecache_v1_filecache_proto_rawDesc), len(file_filecache_v1_filecache_proto_rawDesc)))
+	})
+	return file_filecache_v1_filecache_proto_rawDescData
+}
+
+var file_filecache_v1_filecache_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_filecache_v1_filecache_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_filecache_v1_filecache_proto_goTypes = []any{
+	(CacheStatus)(0),              // 0: filecache.v1.CacheStatus
+	(*FileInfo)(nil),              // 1: filecache.v1.FileInfo
+	(*GetFileRequest)(nil),        // 2: filecache.v1.GetFileRequest
+	(*GetFileResponse)(nil),       // 3: filecache.v1.GetFileResponse
+	(*GetFileHeader)(nil),         // 4: filecache.v1.GetFileHeader
+	(*PutFileRequest)(nil),        // 5: filecache.v1.PutFileRequest
+	(*PutFileHeader)(nil),         // 6: filecache.v1.PutFileHeader
+	(*PutFileResponse)(nil),       // 7: filecache.v1.PutFileResponse
+	(*DeleteFileRequest)(nil),     // 8: filecache.v1.DeleteFileRequest
+	(*DeleteFileResponse)(nil),    // 9: filecache.v1.DeleteFileResponse
+	(*StatFileRequest)(nil),       // 10: filecache.v1.StatFileRequest
+	(*StatFileResponse)(nil),      // 11: filecache.v1.StatFileResponse
+	(*ListFilesRequest)(nil),      // 12: filecache.v1.ListFilesRequest
+	(*ListFilesResponse)(nil),     // 13: filecache.v1.ListFilesResponse
+	nil,                           // 14: filecache.v1.FileInfo.HeadersEntry
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_filecache_v1_filecache_proto_depIdxs = []int32{
+	15, // 0: filecache.v1.FileInfo.last_modified:type_name -> google.protobuf.Timestamp
+	14, // 1: filecache.v1.FileInfo.headers:type_name -> filecache.v1.FileInfo.HeadersEntry
+	4,  // 2: filecache.v1.GetFileResponse.header:type_name -> filecache.v1.GetFileHeader
+	1,  // 3: filecache.v1.GetFileHeader.info:type_name -> filecache.v1.FileInfo
+	0,  // 4: filecache.v1.GetFileHeader.cache_status:type_name -> filecache.v1.CacheStatus
+	6,  // 5: filecache.v1.PutFileRequest.header:type_name -> filecache.v1.PutFileHeader
+	1,  // 6: filecache.v1.StatFileResponse.info:type_name -> filecache.v1.FileInfo
+	1,  // 7: filecache.v1.ListFilesResponse.files:type_name -> filecache.v1.FileInfo
+	2,  // 8: filecache.v1.FileService.GetFile:input_type -> filecache.v1.GetFileRequest
+	5,  // 9: filecache.v1.FileService.PutFile:input_type -> filecache.v1.PutFileRequest
+	8,  // 10: filecache.v1.FileService.DeleteFile:input_type -> filecache.v1.DeleteFileRequest
+	10, // 11: filecache.v1.FileService.StatFile:input_type -> filecache.v1.StatFileRequest
+	12, // 12: filecache.v1.FileService.ListFiles:input_type -> filecache.v1.ListFilesRequest
+	3,  // 13: filecache.v1.FileService.GetFile:output_type -> filecache.v1.GetFileResponse
+	7,  // 14: filecache.v1.FileService.PutFile:output_type -> filecache.v1.PutFileResponse
+	9,  // 15: filecache.v1.FileService.DeleteFile:output_type -> filecache.v1.DeleteFileResponse
+	11, // 16: filecache.v1.FileService.StatFile:output_type -> filecache.v1.StatFileResponse
+	13, // 17: filecache.v1.FileService.ListFiles:output_type -> filecache.v1.ListFilesResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_filecache_v1_filecache_proto_init() }
+func file_filecache_v1_filecache_proto_init() {
+	if File_filecache_v1_filecache_proto != nil {
+		return
+	}
+	file_filecache_v1_filecache_proto_msgTypes[2].OneofWrappers = []any{
+		(*GetFileResponse_Header)(nil),
+		(*GetFileResponse_Chunk)(nil),
+	}
+	file_filecache_v1_filecache_proto_msgTypes[4].OneofWrappers = []any{
+		(*PutFileRequest_Header)(nil),
+		(*PutFileRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_filecache_v1_filecache_proto_rawDesc), len(file_filecache_v1_filecache_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_filecache_v1_filecache_proto_goTypes,
+		DependencyIndexes: file_filecache_v1_filecache_proto_depIdxs,
+		EnumInfos:         file_filecache_v1_filecache_proto_enumTypes,
+		MessageInfos:      file_filecache_v1_filecache_proto_msgTypes,
+	}.Build()
+	File_filecache_v1_filecache_proto = out.File
+	file_filecache_v1_filecache_proto_goTypes = nil
+	file_filecache_v1_filecache_proto_depIdxs = nil
+}
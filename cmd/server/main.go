@@ -2,308 +2,1740 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
-	"mime"
+	"net"
 	"net/http"
-	"path/filepath"
-	"strconv"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
 
+	filecachev1 "github.com/ch374n/file-downloader/api/filecache/v1"
+	"github.com/ch374n/file-downloader/internal/auth"
 	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/cas"
+	"github.com/ch374n/file-downloader/internal/chunked"
 	"github.com/ch374n/file-downloader/internal/config"
+	"github.com/ch374n/file-downloader/internal/efficiency"
+	"github.com/ch374n/file-downloader/internal/encryption"
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/existence"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/healthcheck"
+	"github.com/ch374n/file-downloader/internal/hotkeys"
+	"github.com/ch374n/file-downloader/internal/imaging"
+	"github.com/ch374n/file-downloader/internal/inflight"
+	"github.com/ch374n/file-downloader/internal/keyindex"
+	"github.com/ch374n/file-downloader/internal/legacy"
+	"github.com/ch374n/file-downloader/internal/lifecycle"
+	"github.com/ch374n/file-downloader/internal/listen"
 	"github.com/ch374n/file-downloader/internal/logger"
 	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/mirror"
+	"github.com/ch374n/file-downloader/internal/pipeline"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/prefetch"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/reload"
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+	"github.com/ch374n/file-downloader/internal/scheduler"
+	"github.com/ch374n/file-downloader/internal/scrub"
+	"github.com/ch374n/file-downloader/internal/signing"
 	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+	"github.com/ch374n/file-downloader/internal/warmer"
 )
 
-var (
-	fileCache   *cache.RedisCache
-	fileStorage *storage.R2Client
-)
-
-type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-	Data    any    `json:"data,omitempty"`
-}
-
 func main() {
-	cfg := config.Load()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file; environment variables override its settings")
+	validateOnly := flag.Bool("validate-config", false, "check the configuration and exit")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		if *validateOnly {
+			os.Exit(1)
+		}
+		panic(err)
+	}
+	if *validateOnly {
+		slog.Info("Configuration is valid")
+		return
+	}
 
 	// Initialize structured logger
 	logger.Init(cfg.LogLevel)
 
-	// Initialize Redis cache based on mode
-	var err error
-	switch cfg.Redis.Mode {
-	case config.RedisModeDisabled:
+	// Components register the settings they can change at runtime; the
+	// rest are reported as needing a restart when they change on reload
+	reloader := reload.New(cfg, func() (*config.Config, error) {
+		return config.Load(*configPath)
+	})
+	reloader.Register(func(c *config.Config) error {
+		logger.SetLevel(c.LogLevel)
+		return nil
+	}, "LogLevel")
+
+	// Collectors live on a dedicated registry rather than the global one.
+	// The Go runtime's GC, heap and scheduler metrics sit next to the
+	// service's own, so latency can be matched against saturation.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+			collectors.MetricsGC,
+			collectors.MetricsMemory,
+			collectors.MetricsScheduler,
+		)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	appMetrics := metrics.New(registry)
+
+	// Components register start and stop hooks as they are created; they
+	// are stopped in reverse order on shutdown
+	components := lifecycle.New()
+
+	// Initialize R2 storage
+	fileStorage, err := storage.NewR2Client(
+		cfg.R2.AccountID,
+		cfg.R2.AccessKeyID,
+		cfg.R2.SecretAccessKey,
+		cfg.R2.BucketName,
+		appMetrics,
+		storage.WithTransport(r2Transport(cfg.R2)),
+	)
+	if err != nil {
+		slog.Error("Failed to initialize R2 client", "error", err)
+		panic(err)
+	}
+	fileStorage.SetTimeout(cfg.Timeouts.Storage)
+	fileStorage.SetParallelDownload(r2Parallel(cfg.R2))
+	slog.Info("Connected to R2 bucket", "bucket", cfg.R2.BucketName)
+
+	// Objects under the encrypted prefixes are encrypted before they reach a
+	// bucket; bucket is the default bucket as the rest of the service sees it
+	var enc *encryption.Encryptor
+	if cfg.Encryption.Enabled {
+		enc = newEncryptor(cfg.Encryption)
+	}
+	bucket := encryptBucket(cfg.Encryption, enc, cfg.R2.BucketName, fileStorage, appMetrics)
+
+	// Reads of keys missing from the bucket listing are answered as not
+	// found without reaching it, so scrapers probing for files cost nothing
+	var existenceFilter *existence.Filter
+	if len(cfg.Keys.ExistencePrefixes) > 0 {
+		existenceFilter = existence.New(bucket, existence.Config{
+			Prefixes:          cfg.Keys.ExistencePrefixes,
+			FalsePositiveRate: cfg.Keys.ExistenceFalsePositiveRate,
+		}, appMetrics)
+		bucket = existence.NewStorage(bucket, existenceFilter, appMetrics)
+	}
+	bucket = cacheMetadata(cfg.Keys, bucket, appMetrics)
+
+	// Tenants, when declared, get their own bucket or key prefix and cache
+	// namespace; files is the storage routing requests to them, storing
+	// content by hash and enforcing storage quotas. sharedFiles serves the
+	// components reading the default bucket directly.
+	var (
+		tenants     *tenant.Registry
+		files       = bucket
+		sharedFiles = bucket
+		blobs       *cas.Storage
+	)
+	if cfg.TenantsFile != "" {
+		tenants, files = newTenants(cfg, bucket, enc, appMetrics)
+	}
+	if cfg.CAS.Enabled {
+		blobs = cas.NewStorage(files, cfg.CAS.Grace, appMetrics)
+		files = blobs
+		sharedFiles = cas.NewStorage(bucket, cfg.CAS.Grace, appMetrics)
+		slog.Info("Content-addressable storage enabled", "gc_schedule", cfg.CAS.Collect, "gc_grace", cfg.CAS.Grace)
+	}
+	quotas := newQuotaTracker(cfg, tenants, appMetrics)
+	if quotas != nil {
+		files = quota.NewStorage(files, quotas)
+	}
+
+	// Initialize the shared cache based on backend and mode. fileCache stays
+	// a nil interface when caching is unavailable so handlers can detect it.
+	var (
+		fileCache  cache.Cache
+		tiers      []cache.Tier
+		redisCache *cache.RedisCache
+	)
+	switch {
+	case cfg.CacheBackend == config.CacheBackendGroupcache:
+		groupCache := newGroupCache(cfg, files, tenants, components)
+		tiers = append(tiers, cache.Tier{Name: "groupcache", Cache: groupCache})
+	case cfg.Redis.Mode == config.RedisModeDisabled:
 		slog.Info("Redis caching disabled")
-		fileCache = nil
-	case config.RedisModeEnabled:
-		fileCache, err = cache.NewRedisCache(cache.RedisConfig{
+	case cfg.Redis.Mode == config.RedisModeEnabled, cfg.Redis.Mode == config.RedisModeSentinel:
+		redisCfg := cache.RedisConfig{
 			Addr:         cfg.Redis.Addr,
 			Password:     cfg.Redis.Password,
 			DB:           cfg.Redis.DB,
 			TTL:          cfg.Redis.CacheTTL,
+			TTLJitter:    cfg.Redis.TTLJitter,
 			DialTimeout:  cfg.Redis.DialTimeout,
 			ReadTimeout:  cfg.Redis.ReadTimeout,
 			WriteTimeout: cfg.Redis.WriteTimeout,
-		})
+
+			TLSEnabled:            cfg.Redis.TLSEnabled,
+			TLSCAFile:             cfg.Redis.TLSCAFile,
+			TLSCertFile:           cfg.Redis.TLSCertFile,
+			TLSKeyFile:            cfg.Redis.TLSKeyFile,
+			TLSInsecureSkipVerify: cfg.Redis.TLSInsecureSkipVerify,
+
+			NamespaceDepth:    cfg.Redis.NamespaceDepth,
+			GenerationRefresh: cfg.Redis.GenerationRefresh,
+
+			Breaker: cache.BreakerConfig{
+				Threshold: cfg.Redis.BreakerThreshold,
+				Cooldown:  cfg.Redis.BreakerCooldown,
+			},
+
+			Compression: cache.CompressionConfig{
+				Codec:    cache.Codec(cfg.Redis.Compression),
+				MinBytes: cfg.Redis.CompressionMinBytes,
+				MaxRatio: cfg.Redis.CompressionMaxRatio,
+			},
+
+			Metrics: appMetrics,
+		}
+		if cfg.Redis.TLSEnabled && cfg.Redis.TLSInsecureSkipVerify {
+			slog.Warn("Redis TLS certificate verification is disabled")
+		}
+		target := cfg.Redis.Addr
+		if cfg.Redis.Mode == config.RedisModeSentinel {
+			redisCfg.MasterName = cfg.Redis.SentinelMaster
+			redisCfg.SentinelAddrs = cfg.Redis.SentinelAddrs
+			redisCfg.SentinelPassword = cfg.Redis.SentinelPassword
+			target = cfg.Redis.SentinelMaster + "@" + strings.Join(cfg.Redis.SentinelAddrs, ",")
+		}
+
+		var err error
+		redisCache, err = cache.NewRedisCache(redisCfg)
 		if err != nil {
 			slog.Warn("Redis unavailable, running without cache",
-				"addr", cfg.Redis.Addr,
+				"addr", target,
 				"error", err,
 			)
-			fileCache = nil
 		} else {
-			defer func() {
-				if err := fileCache.Close(); err != nil {
-					slog.Error("Failed to close Redis cache", "error", err)
-				}
-			}()
-			slog.Info("Connected to Redis", "addr", cfg.Redis.Addr)
+			tiers = append(tiers, cache.Tier{Name: "redis", Cache: redisCache, MaxEntryBytes: cfg.Redis.MaxEntryBytes})
+			reloader.Register(func(c *config.Config) error {
+				redisCache.SetTTL(c.Redis.CacheTTL)
+				return nil
+			}, "Redis.CacheTTL")
+			slog.Info("Connected to Redis", "addr", target)
+			if cfg.Redis.NamespaceDepth > 0 {
+				slog.Info("Cache namespaces enabled", "depth", cfg.Redis.NamespaceDepth, "generation_refresh", cfg.Redis.GenerationRefresh)
+			}
+			go checkCacheFormat(redisCache, cfg.Redis)
 		}
 	}
 
-	// Initialize R2 storage
-	fileStorage, err = storage.NewR2Client(
-		cfg.R2.AccountID,
-		cfg.R2.AccessKeyID,
-		cfg.R2.SecretAccessKey,
-		cfg.R2.BucketName,
-	)
+	// The disk cache sits below Redis, or serves alone when Redis is off. The
+	// group cache loads every file itself, so nothing would reach the disk.
+	if cfg.DiskCache.Dir != "" && cfg.CacheBackend == config.CacheBackendGroupcache {
+		slog.Warn("Disk cache is not used with the group cache", "dir", cfg.DiskCache.Dir)
+	} else if cfg.DiskCache.Dir != "" {
+		diskCache, err := cache.NewDiskCache(cache.DiskConfig{
+			Dir:       cfg.DiskCache.Dir,
+			MaxBytes:  cfg.DiskCache.MaxBytes,
+			TTL:       cfg.Redis.CacheTTL,
+			TTLJitter: cfg.Redis.TTLJitter,
+		})
+		if err != nil {
+			slog.Error("Failed to open disk cache", "dir", cfg.DiskCache.Dir, "error", err)
+			panic(err)
+		}
+		tiers = append(tiers, cache.Tier{Name: "disk", Cache: diskCache, Local: true})
+		reloader.Register(func(c *config.Config) error {
+			diskCache.SetTTL(c.Redis.CacheTTL)
+			return nil
+		}, "Redis.CacheTTL")
+		slog.Info("Disk cache enabled",
+			"dir", cfg.DiskCache.Dir,
+			"max_bytes", cfg.DiskCache.MaxBytes,
+			"used_bytes", diskCache.Size(),
+		)
+	}
+	// Hot files are pinned in memory above the other tiers, so a burst of
+	// requests for one file doesn't reach Redis or R2
+	var hot *hotkeys.Tracker
+	if cfg.HotKeys.Window > 0 {
+		hot = hotkeys.New(hotkeys.Config{Window: cfg.HotKeys.Window, Threshold: cfg.HotKeys.Threshold}, appMetrics)
+	}
+	if hot != nil && cfg.HotKeys.PinBytes > 0 && len(tiers) > 0 && cfg.CacheBackend != config.CacheBackendGroupcache {
+		memoryCache, err := cache.NewMemoryCache(cache.MemoryConfig{
+			MaxBytes: cfg.HotKeys.PinBytes,
+			TTL:      cfg.HotKeys.PinTTL,
+		})
+		if err != nil {
+			slog.Error("Failed to create memory cache", "error", err)
+			panic(err)
+		}
+		// Variants and chunks of hot files are pinned along with them
+		admit := func(key string) bool { return hot.Hot(cache.BaseKey(key)) }
+		tiers = append([]cache.Tier{{Name: "memory", Cache: memoryCache, Local: true, Admit: admit}}, tiers...)
+		slog.Info("Hot key pinning enabled", "threshold", cfg.HotKeys.Threshold, "window", cfg.HotKeys.Window, "max_bytes", cfg.HotKeys.PinBytes)
+	}
+	switch {
+	case len(tiers) == 1 && tiers[0].MaxEntryBytes <= 0:
+		fileCache = tiers[0].Cache
+	case len(tiers) > 0:
+		fileCache = cache.NewTiered(tiers...)
+	}
+	if fileCache != nil {
+		components.Append(lifecycle.Hook{
+			Name:   "cache",
+			OnStop: func(context.Context) error { return fileCache.Close() },
+		})
+	}
+	// Other replicas' disk and memory caches would keep serving files
+	// changed here until their TTL, so removals are announced over Redis
+	hasLocal := slices.ContainsFunc(tiers, func(t cache.Tier) bool { return t.Local })
+	if tiered, ok := fileCache.(*cache.Tiered); ok && redisCache != nil && hasLocal && cfg.Redis.InvalidationChannel != "" {
+		tiered.SetInvalidator(redisCache.Invalidator(cfg.Redis.InvalidationChannel))
+		listenCtx, stopListening := context.WithCancel(context.Background())
+		components.Append(lifecycle.Hook{
+			Name: "cache invalidation",
+			OnStart: func(context.Context) error {
+				go tiered.Listen(listenCtx)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopListening()
+				return nil
+			},
+		})
+		slog.Info("Cache invalidation enabled", "channel", cfg.Redis.InvalidationChannel)
+	}
+	if reporter, ok := fileCache.(cache.UsageReporter); ok {
+		registry.MustRegister(cache.NewUsageCollector(reporter, 5*time.Second))
+	}
+	// Payloads are encrypted before they reach Redis or the disk. The group
+	// cache loads files itself and only keeps them in process memory.
+	if enc != nil && cfg.Encryption.Cache && fileCache != nil && cfg.CacheBackend != config.CacheBackendGroupcache {
+		fileCache = encryption.NewCache(fileCache, enc, appMetrics)
+	}
+	// Chunks are encrypted one by one, so a range can be decrypted without
+	// reading the rest of the file
+	if cfg.Chunks.Threshold > 0 && fileCache != nil && cfg.CacheBackend != config.CacheBackendGroupcache {
+		fileCache = chunked.NewCache(fileCache, chunked.Config{Threshold: cfg.Chunks.Threshold, ChunkSize: cfg.Chunks.Size})
+	}
+	// The group cache loads each key itself, so its entries can't share blobs
+	if cfg.CAS.Enabled && fileCache != nil && cfg.CacheBackend != config.CacheBackendGroupcache {
+		fileCache = cas.NewCache(fileCache)
+	}
+	// The scrubber samples raw keys, so it reads the cache from below the
+	// tenant namespaces
+	scrubCache := fileCache
+	if tenants != nil && fileCache != nil {
+		fileCache = tenant.NewCache(fileCache, appMetrics)
+	}
+
+	policies, err := policy.CompileSet(cfg.Policy.Cache, cfg.Policy.Deny)
 	if err != nil {
-		slog.Error("Failed to initialize R2 client", "error", err)
+		slog.Error("Invalid request policy", "error", err)
 		panic(err)
 	}
-	slog.Info("Connected to R2 bucket", "bucket", cfg.R2.BucketName)
+
+	signingKeys, err := signing.ParseKeys(cfg.Signing.Keys)
+	if err != nil {
+		slog.Error("Invalid SIGNING_KEYS", "error", err)
+		panic(err)
+	}
+	keyring, err := signing.NewKeyring(signingKeys...)
+	if err != nil {
+		slog.Error("Failed to initialize signing keyring", "error", err)
+		panic(err)
+	}
+
+	adminCreds, err := adminCredentials(cfg)
+	if err != nil {
+		slog.Error("Invalid ADMIN_TOKENS", "error", err)
+		panic(err)
+	}
+	authn := auth.NewAuthenticator(adminCreds...)
+	certCreds, err := auth.ParseCertificateCredentials(cfg.AdminClientCerts)
+	if err != nil {
+		slog.Error("Invalid ADMIN_CLIENT_CERTS", "error", err)
+		panic(err)
+	}
+	authn.SetCertificateCredentials(certCreds...)
+	if !authn.Enabled() {
+		slog.Warn("ADMIN_TOKEN and ADMIN_TOKENS not set, admin endpoints are disabled")
+	}
+	reloader.Register(func(c *config.Config) error {
+		creds, err := adminCredentials(c)
+		if err != nil {
+			return fmt.Errorf("invalid ADMIN_TOKENS: %w", err)
+		}
+		authn.SetCredentials(creds...)
+		return nil
+	}, "AdminToken", "AdminTokens")
+	reloader.Register(func(c *config.Config) error {
+		creds, err := auth.ParseCertificateCredentials(c.AdminClientCerts)
+		if err != nil {
+			return fmt.Errorf("invalid ADMIN_CLIENT_CERTS: %w", err)
+		}
+		authn.SetCertificateCredentials(creds...)
+		return nil
+	}, "AdminClientCerts")
+
+	cacheEfficiency := efficiency.NewTracker(efficiency.Config{
+		PrefixDepth:        cfg.Reports.PrefixDepth,
+		EgressCostPerGB:    cfg.Reports.EgressCostPerGB,
+		ReadCostPerMillion: cfg.Reports.ReadCostPerMillion,
+		TopMisses:          cfg.Reports.TopMisses,
+	})
+
+	fileOpts := []handlers.Option{
+		handlers.WithMetrics(appMetrics),
+		handlers.WithEfficiencyTracker(cacheEfficiency),
+		handlers.WithTimeouts(handlers.Timeouts{
+			Request: cfg.Timeouts.Request,
+			Health:  cfg.HealthCheck.Timeout,
+			Cache:   cfg.Timeouts.Cache,
+		}),
+		handlers.WithDisconnectGrace(cfg.Timeouts.DisconnectGrace),
+		handlers.WithPolicies(policies),
+		handlers.WithStreamConfig(handlers.StreamConfig{
+			MinChunkSize:        cfg.Stream.MinChunkSize,
+			MaxChunkSize:        cfg.Stream.MaxChunkSize,
+			TargetWriteDuration: cfg.Stream.TargetWriteDuration,
+		}),
+		handlers.WithSignedURLs(keyring, handlers.PresignConfig{
+			DefaultTTL: cfg.Signing.URLDefaultTTL,
+			MaxTTL:     cfg.Signing.URLMaxTTL,
+			BaseURL:    cfg.Signing.PublicBaseURL,
+		}),
+		handlers.WithMultipartPartSize(cfg.Upload.PartSize),
+		handlers.WithMaxResponseBytes(cfg.MaxResponseBytes),
+		handlers.WithArchiveLimits(handlers.ArchiveConfig{
+			MaxFiles: cfg.Archive.MaxFiles,
+			MaxBytes: cfg.Archive.MaxBytes,
+		}),
+		handlers.WithTombstoneTTL(cfg.Redis.TombstoneTTL),
+		handlers.WithHotKeys(hot),
+		handlers.WithReadinessRequiresCache(cfg.ReadyRequiresCache),
+	}
+	if len(cfg.HeaderPassthrough) > 0 {
+		fileOpts = append(fileOpts, handlers.WithHeaderPassthrough(cfg.HeaderPassthrough))
+	}
+	if cfg.Redis.FillLock && redisCache != nil {
+		fileOpts = append(fileOpts, handlers.WithFillLock(redisCache, cfg.Redis.FillLockTTL, cfg.Redis.FillLockWait))
+		slog.Info("Cache fill lock enabled", "ttl", cfg.Redis.FillLockTTL, "wait", cfg.Redis.FillLockWait)
+	}
+	if cfg.Redis.TTLPolicy == "frequency" {
+		fileOpts = append(fileOpts, handlers.WithTTLPolicy(cache.FrequencyTTL{
+			Min:      cfg.Redis.TTLMin,
+			Max:      cfg.Redis.TTLMax,
+			FullRate: cfg.HotKeys.Threshold,
+			Rates:    hot,
+		}))
+		slog.Info("Frequency-based cache TTLs enabled", "min", cfg.Redis.TTLMin, "max", cfg.Redis.TTLMax)
+	}
+	filenameRules := handlers.FilenameRules{MaxLength: cfg.FilenameMaxLength}
+	if cfg.FilenamePattern != "" {
+		// The pattern has to match the whole name, not just part of it
+		filenameRules.Pattern, err = regexp.Compile(`^(?:` + cfg.FilenamePattern + `)$`)
+		if err != nil {
+			slog.Error("Invalid FILENAME_PATTERN", "error", err)
+			panic(err)
+		}
+	}
+	fileOpts = append(fileOpts, handlers.WithFilenameRules(filenameRules))
+	cacheControlRules, err := handlers.ParseCacheControlRules(cfg.CacheControlRules)
+	if err != nil {
+		slog.Error("Invalid RESPONSE_CACHE_CONTROL_RULES", "error", err)
+		panic(err)
+	}
+	fileOpts = append(fileOpts, handlers.WithCacheControl(handlers.CacheControlRules{
+		Default:     cfg.CacheControl,
+		ByExtension: cacheControlRules,
+	}))
+	compression := handlers.DefaultCompressionConfig()
+	compression.MinSize = cfg.Compression.MinBytes
+	if len(cfg.Compression.Encodings) > 0 {
+		compression.Encodings = cfg.Compression.Encodings
+	}
+	if len(cfg.Compression.ContentTypes) > 0 {
+		compression.ContentTypes = cfg.Compression.ContentTypes
+	}
+	if err := compression.Validate(); err != nil {
+		slog.Error("Invalid COMPRESSION_ENCODINGS", "error", err)
+		panic(err)
+	}
+	if cfg.Compression.Enabled && cfg.Compression.CacheVariants {
+		fileOpts = append(fileOpts, handlers.WithCompressedVariants(compression))
+	}
+	if cfg.Images.Enabled {
+		fileOpts = append(fileOpts, handlers.WithImageTransforms(imaging.Config{
+			MaxDimension: cfg.Images.MaxDimension,
+			Sizes:        cfg.Images.Sizes,
+			MaxPixels:    cfg.Images.MaxPixels,
+		}))
+		slog.Info("Image transforms enabled", "max_dimension", cfg.Images.MaxDimension, "sizes", cfg.Images.Sizes)
+	}
+	// The group cache loads every key from storage by name, so it can't
+	// hold blocks
+	if cfg.Chunks.RangeBlockSize > 0 && cfg.CacheBackend != config.CacheBackendGroupcache {
+		fileOpts = append(fileOpts, handlers.WithRangeBlocks(cfg.Chunks.RangeBlockSize))
+		slog.Info("Caching ranges as blocks", "block_size", cfg.Chunks.RangeBlockSize)
+	}
+	if cfg.Archive.MembersEnabled {
+		fileOpts = append(fileOpts, handlers.WithArchiveMembers(cfg.Archive.MaxMemberBytes))
+		slog.Info("Serving files from inside archives", "max_bytes", cfg.Archive.MaxMemberBytes)
+	}
+	if cfg.Compression.Precompressed {
+		fileOpts = append(fileOpts, handlers.WithPrecompressed(compression, cfg.Compression.PrecompressedCheckTTL))
+		slog.Info("Serving pre-compressed files", "encodings", compression.Encodings, "check_ttl", cfg.Compression.PrecompressedCheckTTL.String())
+	}
+	if cfg.Compression.Enabled || cfg.Compression.Precompressed {
+		fileOpts = append(fileOpts, handlers.WithResponseCompression(compression.Encodings))
+	}
+	fileOpts = append(fileOpts, handlers.WithProtocols(advertisedProtocols(cfg)...))
+	if cfg.Prefetch.Depth > 0 && fileCache == nil {
+		slog.Warn("Cache disabled, sequential prefetch is off")
+	} else if cfg.Prefetch.Depth > 0 {
+		prefetcher, err := prefetch.New(prefetch.Config{
+			Depth:        cfg.Prefetch.Depth,
+			Window:       cfg.Prefetch.Window,
+			MaxInFlight:  cfg.Prefetch.MaxInFlight,
+			MaxPerSecond: cfg.Prefetch.MaxPerSecond,
+			Timeout:      cfg.Prefetch.Timeout,
+			Metrics:      appMetrics,
+		})
+		if err != nil {
+			slog.Error("Invalid prefetch configuration", "error", err)
+			panic(err)
+		}
+		fileOpts = append(fileOpts, handlers.WithPrefetcher(prefetcher))
+		reloader.Register(func(c *config.Config) error {
+			prefetcher.SetMaxPerSecond(c.Prefetch.MaxPerSecond)
+			return nil
+		}, "Prefetch.MaxPerSecond")
+		components.Append(lifecycle.Hook{
+			Name: "prefetch",
+			OnStop: func(context.Context) error {
+				prefetcher.Wait()
+				return nil
+			},
+		})
+		slog.Info("Sequential prefetch enabled", "depth", cfg.Prefetch.Depth, "max_rps", cfg.Prefetch.MaxPerSecond)
+	}
+	if len(cfg.Keys.CaseInsensitivePrefixes) > 0 {
+		caseIndex := keyindex.NewCaseIndex(bucket, cfg.Keys.CaseInsensitivePrefixes)
+		indexCtx, stopIndex := context.WithCancel(context.Background())
+		components.Append(lifecycle.Hook{
+			Name: "key index",
+			OnStart: func(context.Context) error {
+				go caseIndex.Run(indexCtx, cfg.Keys.IndexRefresh)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopIndex()
+				return nil
+			},
+		})
+		fileOpts = append(fileOpts, handlers.WithCaseInsensitiveKeys(caseIndex, cfg.Keys.CanonicalRedirect))
+		slog.Info("Case-insensitive key lookup enabled",
+			"prefixes", cfg.Keys.CaseInsensitivePrefixes,
+			"redirect", cfg.Keys.CanonicalRedirect,
+		)
+	}
+	if existenceFilter != nil {
+		// Keys written through other replicas are announced over Redis, so
+		// they are found before the next refresh
+		filterCtx, stopFilter := context.WithCancel(context.Background())
+		shared := redisCache != nil && cfg.Keys.ExistenceChannel != ""
+		if shared {
+			existenceFilter.SetInvalidator(redisCache.Invalidator(cfg.Keys.ExistenceChannel))
+		}
+		components.Append(lifecycle.Hook{
+			Name: "existence filter",
+			OnStart: func(context.Context) error {
+				go existenceFilter.Run(filterCtx, cfg.Keys.IndexRefresh)
+				if shared {
+					go existenceFilter.Listen(filterCtx)
+				}
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopFilter()
+				return nil
+			},
+		})
+		slog.Info("Existence filter enabled",
+			"prefixes", cfg.Keys.ExistencePrefixes,
+			"false_positive_rate", cfg.Keys.ExistenceFalsePositiveRate,
+			"shared", shared,
+		)
+	}
+	var legacyOrigin *legacy.Origin
+	if cfg.Legacy.URL != "" {
+		origin, err := legacy.New(legacy.Config{
+			BaseURL:  cfg.Legacy.URL,
+			Prefixes: cfg.Legacy.Prefixes,
+			Backfill: cfg.Legacy.Backfill,
+			Timeout:  cfg.Legacy.Timeout,
+		})
+		if err != nil {
+			slog.Error("Invalid legacy origin configuration", "error", err)
+			panic(err)
+		}
+		fileOpts = append(fileOpts, handlers.WithLegacyOrigin(origin))
+		legacyOrigin = origin
+		slog.Info("Falling back to legacy origin for files missing from storage",
+			"prefixes", cfg.Legacy.Prefixes,
+			"backfill", cfg.Legacy.Backfill,
+		)
+	}
+	if cfg.RefreshRequiresAdmin {
+		fileOpts = append(fileOpts, handlers.WithRefreshAuth(authn))
+	}
+	var uploadPipeline *pipeline.Pipeline
+	if len(cfg.Pipeline.Steps) > 0 {
+		uploadPipeline = newUploadPipeline(cfg, bucket, appMetrics)
+		fileOpts = append(fileOpts, handlers.WithUploadPipeline(uploadPipeline))
+		components.Append(lifecycle.Hook{
+			Name:    "upload pipeline",
+			OnStop:  uploadPipeline.Close,
+			Timeout: cfg.ShutdownTimeout,
+		})
+		slog.Info("Upload pipeline enabled", "steps", cfg.Pipeline.Steps, "workers", cfg.Pipeline.Workers)
+	}
+	var eventBus *events.Bus
+	if len(cfg.Events.WebhookURLs) > 0 || cfg.Events.Stream != "" {
+		bus, stream := newEventBus(cfg.Events, appMetrics)
+		eventBus = bus
+		fileOpts = append(fileOpts, handlers.WithEvents(eventBus))
+		components.Append(lifecycle.Hook{
+			Name: "event notifications",
+			OnStop: func(ctx context.Context) error {
+				err := eventBus.Close(ctx)
+				if stream != nil {
+					stream.Close()
+				}
+				return err
+			},
+			Timeout: cfg.ShutdownTimeout,
+		})
+		slog.Info("Event notifications enabled", "webhooks", len(cfg.Events.WebhookURLs), "types", cfg.Events.Types,
+			"stream", cfg.Events.Stream, "topic", cfg.Events.StreamTopic, "format", cfg.Events.StreamFormat)
+	}
+	if cfg.HealthCheck.Interval > 0 {
+		checks := map[string]healthcheck.Check{handlers.HealthCheckStorage: files.HealthCheck}
+		if fileCache != nil {
+			checks[handlers.HealthCheckCache] = fileCache.Ping
+		}
+		prober := healthcheck.NewProber(cfg.HealthCheck.Timeout, checks)
+		probeCtx, stopProbes := context.WithCancel(context.Background())
+		components.Append(lifecycle.Hook{
+			Name: "health prober",
+			OnStart: func(ctx context.Context) error {
+				prober.Check(ctx)
+				go prober.Run(probeCtx, cfg.HealthCheck.Interval)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopProbes()
+				return nil
+			},
+		})
+		fileOpts = append(fileOpts, handlers.WithHealthProber(prober))
+	}
+	fileHandler := handlers.NewFileHandler(fileCache, files, fileOpts...)
+	reloader.Register(func(c *config.Config) error {
+		fileHandler.SetMaxResponseBytes(c.MaxResponseBytes)
+		return nil
+	}, "MaxResponseBytes")
+
+	warmerMetrics := warmer.WithMetrics(appMetrics)
+	jobs := scheduler.New(scheduler.WithMetrics(appMetrics))
+	if cfg.WarmersFile != "" {
+		registerWarmers(jobs, cfg.WarmersFile, sharedFiles, fileCache, warmerMetrics)
+	}
+	if cfg.Reports.Schedule != "" {
+		scheduleReports(jobs, cfg.Reports, cacheEfficiency, bucket)
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	components.Append(lifecycle.Hook{
+		Name: "scheduler",
+		OnStart: func(context.Context) error {
+			jobs.Start(jobsCtx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			stopJobs()
+			jobs.Wait()
+			return nil
+		},
+		Timeout: cfg.ShutdownTimeout,
+	})
+	if quotas != nil {
+		scheduleQuotaReconcile(jobs, cfg.Quota.Reconcile, quotas, files)
+		// Usage starts at zero, so it is counted once as soon as jobs run
+		components.Append(lifecycle.Hook{
+			Name:    "storage quota usage",
+			OnStart: func(context.Context) error { return jobs.Trigger(quotaReconcileJob) },
+		})
+	}
+	if blobs != nil && cfg.CAS.Collect != "" {
+		scheduleBlobCollection(jobs, cfg.CAS.Collect, blobs, tenants)
+	}
+	if cfg.Scrub.Schedule != "" {
+		scheduleCacheScrub(jobs, cfg.Scrub, scrubCache, files, tenants, legacyOrigin, appMetrics)
+	}
+	if cfg.Warm.PreloadManifest != "" {
+		go preloadCache(cfg.Warm, sharedFiles, fileCache, warmerMetrics)
+	}
+
+	// Mirroring wraps read endpoints; it is a pass-through when disabled
+	mirrored := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	var shadow *mirror.Mirror
+	if cfg.Mirror.URL != "" {
+		shadow, err = mirror.New(mirror.Config{
+			Target:       cfg.Mirror.URL,
+			SampleRate:   cfg.Mirror.SampleRate,
+			MaxInFlight:  cfg.Mirror.MaxInFlight,
+			MaxPerSecond: cfg.Mirror.MaxPerSecond,
+			Timeout:      cfg.Mirror.Timeout,
+			Metrics:      appMetrics,
+		})
+		if err != nil {
+			slog.Error("Invalid mirror configuration", "error", err)
+			panic(err)
+		}
+		mirrored = shadow.Middleware
+		reloader.Register(func(c *config.Config) error {
+			shadow.SetMaxPerSecond(c.Mirror.MaxPerSecond)
+			return nil
+		}, "Mirror.MaxPerSecond")
+		components.Append(lifecycle.Hook{
+			Name: "mirror",
+			OnStop: func(context.Context) error {
+				shadow.Wait()
+				return nil
+			},
+		})
+		slog.Info("Mirroring read traffic to shadow deployment",
+			"target", cfg.Mirror.URL,
+			"sample_rate", cfg.Mirror.SampleRate,
+		)
+	}
+
+	adminOpts := []handlers.AdminOption{
+		handlers.WithKeyring(keyring, cfg.Signing.RetireOverlap),
+		handlers.WithScheduler(jobs),
+		handlers.WithAdminMetrics(appMetrics),
+		handlers.WithAdminTimeouts(handlers.Timeouts{
+			Request: cfg.Timeouts.Request,
+			Health:  cfg.HealthCheck.Timeout,
+		}),
+		handlers.WithEfficiencyReports(cacheEfficiency),
+		handlers.WithAdminEvents(eventBus),
+		handlers.WithAdminHotKeys(hot),
+		handlers.WithDiagnostics(handlers.DiagnosticsConfig{
+			Config:   cfg.Redacted(),
+			Storage:  fileStorage,
+			Mirror:   shadow,
+			Pipeline: uploadPipeline,
+		}),
+	}
+	if fileCache != nil {
+		warmJobs := warmer.NewJobs(sharedFiles, fileCache, warmer.JobsConfig{
+			MaxJobs:        cfg.Warm.MaxJobs,
+			MaxConcurrency: cfg.Warm.MaxConcurrency,
+			Timeout:        cfg.Warm.Timeout,
+		}, warmerMetrics)
+		adminOpts = append(adminOpts, handlers.WithWarmJobs(warmJobs))
+		components.Append(lifecycle.Hook{Name: "warm jobs", OnStop: warmJobs.Close})
+	}
+	adminHandler := handlers.NewAdminHandler(fileCache, adminOpts...)
+
+	// Full file requests are capped across the HTTP and S3 servers, since
+	// each may hold a whole file in memory
+	limiter := inflight.New(inflight.Config{
+		MaxInFlight:  cfg.Server.MaxInFlight,
+		MaxQueue:     cfg.Server.MaxQueue,
+		QueueTimeout: cfg.Server.QueueTimeout,
+	}, appMetrics)
 
 	mux := http.NewServeMux()
+	metricsPaths := handlers.WithMetricsPaths(cfg.MetricsPaths...)
+	// The operational endpoints share the public listeners unless they have
+	// their own
+	adminMux := mux
+	if cfg.AdminAddr != "" {
+		adminMux = http.NewServeMux()
+	}
 
 	// Endpoints
-	mux.HandleFunc("GET /health", healthHandler)
-	mux.HandleFunc("GET /", rootHandler)
-	mux.HandleFunc("GET /files/{name}", metricsMiddleware(getFileHandler))
+	adminMux.HandleFunc("GET /health", fileHandler.Health)
+	adminMux.HandleFunc("GET /livez", fileHandler.Livez)
+	adminMux.HandleFunc("GET /readyz", fileHandler.Readyz)
+	mux.HandleFunc("GET /", fileHandler.Root)
+	mux.HandleFunc("GET /capabilities", fileHandler.Capabilities)
+	mux.HandleFunc("GET /files", handlers.MetricsMiddleware(appMetrics, mirrored(fileHandler.ListFiles), metricsPaths))
+	// Routes moving file bodies get the transfer timeout instead of the
+	// server's read and write timeouts
+	transfer := cfg.Server.TransferTimeout
+	mux.HandleFunc("GET /archive", handlers.MetricsMiddleware(appMetrics, handlers.TransferMiddleware(transfer, fileHandler.Archive), metricsPaths))
+	mux.HandleFunc("GET /files/{name...}", handlers.MetricsMiddleware(appMetrics, handlers.TransferMiddleware(transfer,
+		handlers.LimitMiddleware(limiter, mirrored(fileHandler.VerifySignedURL(handlers.FeatureOverrides(authn, fileHandler.GetFile))))), metricsPaths))
+	mux.HandleFunc("DELETE /files/{name...}", handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.DeleteFile))
+	// Outside /files/, so the checksum of a/b can't be mistaken for the file a/b/checksum
+	mux.HandleFunc("GET /checksums/{name...}", handlers.MetricsMiddleware(appMetrics, fileHandler.Checksum, metricsPaths))
+	// The name comes last so nested keys keep their slashes; the prefix
+	// keeps these routes apart from the files themselves
+	mux.HandleFunc("POST /presign/{name...}", handlers.RequireScope(authn, auth.ScopeFilesPresign, fileHandler.Presign))
+	mux.HandleFunc("POST /upload-url/{name...}", handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.UploadURL))
+	mux.HandleFunc("POST /uploaded/{name...}",
+		fileHandler.VerifySignedURL(handlers.RequireScopeOrSigned(authn, auth.ScopeFilesWrite, fileHandler.Uploaded)))
+	mux.HandleFunc("POST /uploads/{name...}", handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.CreateUpload))
+	mux.HandleFunc("GET /uploads/{id}/{name...}", handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.GetUpload))
+	mux.HandleFunc("PUT /uploads/{id}/{name...}", handlers.TransferMiddleware(transfer, handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.UploadPart)))
+	mux.HandleFunc("DELETE /uploads/{id}/{name...}", handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.AbortUpload))
+	mux.HandleFunc("POST /complete/{id}/{name...}", handlers.RequireScope(authn, auth.ScopeFilesWrite, fileHandler.CompleteUpload))
+	if cfg.WebDAV.Enabled {
+		// Registered per method so the WebDAV methods don't clash with GET /
+		davHandler := handlers.MetricsMiddleware(appMetrics,
+			handlers.TransferMiddleware(transfer, handlers.NewWebDAVHandler(fileHandler, authn, cfg.WebDAV.MaxFileSize).ServeHTTP), metricsPaths)
+		mux.HandleFunc("GET /dav/", davHandler)
+		mux.HandleFunc("PUT /dav/", davHandler)
+		mux.HandleFunc("DELETE /dav/", davHandler)
+		mux.HandleFunc("OPTIONS /dav/", davHandler)
+		mux.HandleFunc("PROPFIND /dav/", davHandler)
+		mux.HandleFunc("PROPPATCH /dav/", davHandler)
+		mux.HandleFunc("MKCOL /dav/", davHandler)
+		mux.HandleFunc("COPY /dav/", davHandler)
+		mux.HandleFunc("MOVE /dav/", davHandler)
+		mux.HandleFunc("LOCK /dav/", davHandler)
+		mux.HandleFunc("UNLOCK /dav/", davHandler)
+	}
+
+	// Admin endpoints
+	adminMux.HandleFunc("POST /admin/cache/purge", handlers.RequireScope(authn, auth.ScopeCachePurge, adminHandler.PurgeCache))
+	adminMux.HandleFunc("POST /admin/cache/warm", handlers.RequireScope(authn, auth.ScopeCacheWarm, adminHandler.WarmCache))
+	adminMux.HandleFunc("GET /admin/cache/warm/{id}", handlers.RequireScope(authn, auth.ScopeCacheWarm, adminHandler.WarmStatus))
+	adminMux.HandleFunc("GET /admin/keys", handlers.RequireScope(authn, auth.ScopeKeysManage, adminHandler.ListKeys))
+	adminMux.HandleFunc("POST /admin/keys", handlers.RequireScope(authn, auth.ScopeKeysManage, adminHandler.AddKey))
+	adminMux.HandleFunc("DELETE /admin/keys/{id}", handlers.RequireScope(authn, auth.ScopeKeysManage, adminHandler.RetireKey))
+	adminMux.HandleFunc("GET /admin/jobs", handlers.RequireScope(authn, auth.ScopeJobsManage, adminHandler.ListJobs))
+	adminMux.HandleFunc("POST /admin/jobs/{name}/run", handlers.RequireScope(authn, auth.ScopeJobsManage, adminHandler.RunJob))
+	adminMux.HandleFunc("GET /admin/diagnostics", handlers.RequireScope(authn, auth.ScopeDiagnosticsRead, adminHandler.Diagnostics))
+	adminMux.HandleFunc("GET /admin/loglevel", handlers.RequireScope(authn, auth.ScopeDiagnosticsRead, adminHandler.GetLogLevel))
+	adminMux.HandleFunc("PUT /admin/loglevel", handlers.RequireScope(authn, auth.ScopeConfigReload, adminHandler.SetLogLevel))
+	adminMux.HandleFunc("GET /admin/reports/cache-efficiency", handlers.RequireScope(authn, auth.ScopeReportsRead, adminHandler.CacheEfficiencyReport))
+	adminMux.HandleFunc("GET /admin/hotkeys", handlers.RequireScope(authn, auth.ScopeReportsRead, adminHandler.HotKeys))
+
+	// Admin dashboard; each panel also needs the scope of the API it calls
+	adminUI := handlers.BrowserAuth(handlers.RequireScope(authn, auth.ScopeDiagnosticsRead, handlers.AdminUI))
+	adminMux.HandleFunc("GET /admin/ui", adminUI)
+	adminMux.HandleFunc("GET /admin/ui/{asset}", adminUI)
+
+	// API description
+	mux.HandleFunc("GET /openapi.json", handlers.OpenAPI)
+	if cfg.APIDocs {
+		mux.HandleFunc("GET /docs", handlers.APIDocs)
+	}
 
 	// Prometheus metrics endpoint
-	mux.Handle("GET /metrics", promhttp.Handler())
+	adminMux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 
-	server := &http.Server{
-		Addr:              ":" + cfg.Port,
-		Handler:           mux,
-		ReadHeaderTimeout: 10 * time.Second,
+	// Runtime debugging, on the admin listeners only since it has no place
+	// next to the public routes
+	if adminMux != mux {
+		debug := handlers.RequireScope(authn, auth.ScopeDebugProfile, handlers.NewDebugHandler(cfg.Debug.DumpDir).ServeHTTP)
+		adminMux.HandleFunc("GET /debug/", debug)
+		adminMux.HandleFunc("POST /debug/", debug)
 	}
 
-	slog.Info("Starting server", "port", cfg.Port)
+	retryBudget := retrybudget.Config{
+		Retries: cfg.RetryBudget.Retries,
+		Window:  cfg.RetryBudget.Window,
+		Metrics: appMetrics,
+	}
+
+	var routes http.Handler = mux
+	if cfg.Compression.Enabled {
+		routes = handlers.CompressionMiddleware(compression, mux)
+		slog.Info("Response compression enabled", "encodings", compression.Encodings, "cache_variants", cfg.Compression.CacheVariants)
+	}
 
-	if err = server.ListenAndServe(); err != nil {
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		routes = handlers.CORSMiddleware(corsConfig(cfg.CORS), routes)
+		slog.Info("CORS enabled", "origins", cfg.CORS.AllowedOrigins, "credentials", cfg.CORS.AllowCredentials)
+	}
+	var adminRoutes http.Handler = adminMux
+	if tenants != nil {
+		routes = handlers.TenantMiddleware(tenants, authn, appMetrics, routes)
+		adminRoutes = handlers.TenantMiddleware(tenants, authn, appMetrics, adminMux)
+	}
+
+	accessLog := newAccessLog(cfg.AccessLog, components)
+	server := newHTTPServer(cfg.Server, handlers.RequestIDMiddleware(accessLog(handlers.RetryBudgetMiddleware(retryBudget, routes))))
+	listenAddrs := cfg.Listen
+	if listenAddrs == "" {
+		listenAddrs = ":" + cfg.Port
+	}
+
+	// The servers are registered last so they stop first, letting in-flight
+	// requests finish while the components they use are still running
+	serveErr := make(chan error, 1)
+	if cfg.GRPC.Addr != "" {
+		components.Append(grpcServerHook(cfg, parseListeners("GRPC_ADDR", cfg.GRPC.Addr), fileHandler, authn, appMetrics, retryBudget, serveErr))
+	}
+	if cfg.S3.Addr != "" {
+		s3Handler := handlers.NewS3Handler(fileHandler, authn, cfg.S3.Bucket, cfg.S3.MaxObjectSize)
+		s3Server := newHTTPServer(cfg.Server, handlers.RequestIDMiddleware(accessLog(handlers.RetryBudgetMiddleware(retryBudget,
+			handlers.MetricsMiddleware(appMetrics, handlers.TransferMiddleware(cfg.Server.TransferTimeout, handlers.LimitMiddleware(limiter, s3Handler.ServeHTTP)),
+				metricsPaths, handlers.WithMetricsRoute("/{bucket}/{key...}"))))))
+		components.Append(httpServerHook("s3 server", s3Server, parseListeners("S3_ADDR", cfg.S3.Addr), cfg.ShutdownTimeout, serveErr))
+		slog.Info("S3 API enabled", "bucket", cfg.S3.Bucket)
+	}
+	if cfg.Debug.Addr != "" {
+		components.Append(debugServerHook(cfg, authn, serveErr))
+	}
+	if adminMux != mux {
+		adminServer := newHTTPServer(cfg.Server, handlers.RequestIDMiddleware(accessLog(handlers.RetryBudgetMiddleware(retryBudget, adminRoutes))))
+		components.Append(httpServerHook("admin server", adminServer, parseListeners("ADMIN_ADDR", cfg.AdminAddr), cfg.ShutdownTimeout, serveErr))
+	}
+	listenSpecs := parseListeners("LISTEN", listenAddrs)
+	acmeManager := terminateTLS(cfg.TLS, listenSpecs)
+	if cfg.TLS.RedirectAddr != "" {
+		components.Append(redirectServerHook(cfg, listenSpecs, acmeManager, serveErr))
+	}
+	components.Append(httpServerHook("http server", server, listenSpecs, cfg.ShutdownTimeout, serveErr))
+
+	// SIGHUP, or a change to the config file, reloads the configuration
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	components.Append(lifecycle.Hook{
+		Name: "config reloader",
+		OnStart: func(context.Context) error {
+			go reloader.Watch(watchCtx, hangups, *configPath, cfg.ConfigWatchInterval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			signal.Stop(hangups)
+			stopWatch()
+			return nil
+		},
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := components.Start(ctx); err != nil {
 		slog.Error("Server failed to start", "error", err)
 		panic(err)
 	}
+
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+		// Fail readiness while still serving, so load balancers stop routing
+		// here before the listeners close; a second signal exits at once
+		stop()
+		fileHandler.Drain()
+		if cfg.DrainDelay > 0 {
+			slog.Info("Draining", "delay", cfg.DrainDelay)
+			time.Sleep(cfg.DrainDelay)
+		}
+	case err := <-serveErr:
+		slog.Error("Server failed", "error", err)
+	}
+	stop()
+
+	if err := components.Stop(context.Background()); err != nil {
+		slog.Error("Shutdown incomplete", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Shutdown complete")
 }
 
-// metricsMiddleware wraps a handler to record HTTP metrics
-func metricsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+// newAccessLog returns the middleware logging every request, which passes
+// requests straight through when access logs are off. A log file is closed
+// on shutdown, after the servers writing to it.
+func newAccessLog(cfg config.AccessLogConfig, components *lifecycle.Manager) func(http.Handler) http.Handler {
+	if cfg.Format == "off" {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	proxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		panic(err)
+	}
 
-		// Wrap response writer to capture status code
-		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	var out io.Writer
+	switch cfg.Output {
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		file, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			slog.Error("Failed to open access log", "path", cfg.Output, "error", err)
+			panic(err)
+		}
+		components.Append(lifecycle.Hook{
+			Name: "access log",
+			OnStop: func(context.Context) error {
+				return file.Close()
+			},
+		})
+		out = file
+	}
+	slog.Info("Access log enabled", "format", cfg.Format, "output", cfg.Output)
+	return handlers.NewAccessLog(out, handlers.AccessLogFormat(cfg.Format), proxies).Middleware
+}
 
-		next(wrapped, r)
+// adminCredentials returns the ADMIN_TOKENS credentials, and ADMIN_TOKEN as
+// a credential with every scope
+func adminCredentials(cfg *config.Config) ([]auth.Credential, error) {
+	creds, err := auth.ParseCredentials(cfg.AdminTokens)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AdminToken != "" {
+		creds = append(creds, auth.Credential{Name: "admin", Token: cfg.AdminToken, Scopes: []auth.Scope{auth.ScopeAll}})
+	}
+	return creds, nil
+}
 
-		duration := time.Since(start).Seconds()
-		path := r.URL.Path
-		method := r.Method
-		status := strconv.Itoa(wrapped.statusCode)
+// parseListeners parses the listener addresses configured in env
+func parseListeners(env, addrs string) []listen.Spec {
+	specs, err := listen.Parse(addrs)
+	if err != nil {
+		slog.Error("Invalid "+env, "error", err)
+		panic(err)
+	}
+	return specs
+}
 
-		metrics.HTTPRequestsTotal.WithLabelValues(method, path, status).Inc()
-		metrics.HTTPRequestDuration.WithLabelValues(method, path).Observe(duration)
+// reportServeErr passes the first error of a server that stopped serving
+// to main, dropping later ones
+func reportServeErr(serveErr chan<- error, err error) {
+	select {
+	case serveErr <- err:
+	default:
+	}
+}
 
-		slog.Info("Request completed",
-			"method", method,
-			"path", path,
-			"status", wrapped.statusCode,
-			"duration_ms", duration*1000,
-		)
+// newHTTPServer creates a server for handler whose connections are bounded
+// as cfg says
+func newHTTPServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
 	}
 }
 
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
+// httpServerHook serves server on the listeners of specs. Stopping lets
+// in-flight requests finish until timeout.
+func httpServerHook(name string, server *http.Server, specs []listen.Spec, timeout time.Duration, serveErr chan<- error) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			listeners, err := listen.Listen(specs, "h2", "http/1.1")
+			if err != nil {
+				return err
+			}
+			for _, listener := range listeners {
+				slog.Info("Starting server", "server", name, "addr", listener.Addr().String())
+				go func() {
+					if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+						reportServeErr(serveErr, err)
+					}
+				}()
+			}
+			return nil
+		},
+		OnStop:  server.Shutdown,
+		Timeout: timeout,
+	}
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+// corsConfig applies the CORS settings over the defaults
+func corsConfig(cfg config.CORSConfig) handlers.CORSConfig {
+	cors := handlers.DefaultCORSConfig()
+	cors.AllowedOrigins = cfg.AllowedOrigins
+	cors.MaxAge = cfg.MaxAge
+	cors.AllowCredentials = cfg.AllowCredentials
+	if len(cfg.AllowedMethods) > 0 {
+		cors.AllowedMethods = cfg.AllowedMethods
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		cors.AllowedHeaders = cfg.AllowedHeaders
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		cors.ExposedHeaders = cfg.ExposedHeaders
+	}
+	return cors
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+// terminateTLS serves TLS on the LISTEN listeners without a certificate of
+// their own, from TLS_CERT_FILE and TLS_KEY_FILE or from ACME, checking
+// client certificates against TLS_CLIENT_CA_FILE when set. It returns the
+// ACME manager, or nil when ACME is off.
+func terminateTLS(cfg config.TLSConfig, specs []listen.Spec) *autocert.Manager {
+	var tlsOpts listen.TLS
+	var manager *autocert.Manager
+	switch {
+	case len(cfg.AutocertDomains) > 0:
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		if cfg.AutocertDirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.AutocertDirectoryURL}
+		}
+		// Offering acme-tls/1 lets the CA validate over the TLS listener itself
+		tlsOpts = listen.TLS{GetCertificate: manager.GetCertificate, NextProtos: []string{acme.ALPNProto}}
+		slog.Info("TLS certificates from ACME", "domains", cfg.AutocertDomains, "cache_dir", cfg.AutocertCacheDir)
+	case cfg.CertFile != "":
+		tlsOpts = listen.TLS{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile}
+		slog.Info("TLS enabled", "cert_file", cfg.CertFile)
+	default:
+		return nil
+	}
+	tlsOpts.MinVersion = tls.VersionTLS12
+	if cfg.ClientCAFile != "" {
+		tlsOpts.ClientCAFile = cfg.ClientCAFile
+		tlsOpts.ClientOptional = cfg.ClientAuth == "optional"
+		tlsOpts.ClientNames = cfg.ClientAllowedNames
+		slog.Info("Client certificates enabled", "client_auth", cfg.ClientAuth, "allowed_names", len(cfg.ClientAllowedNames))
+	}
 
-	health := map[string]string{
-		"status": "healthy",
+	for i := range specs {
+		if specs[i].TLS == nil {
+			specTLS := tlsOpts
+			specs[i].TLS = &specTLS
+		}
 	}
+	return manager
+}
 
-	// Check Redis (optional - doesn't affect overall health)
-	if fileCache != nil {
-		if err := fileCache.Ping(ctx); err != nil {
-			health["redis"] = "unhealthy: " + err.Error()
-		} else {
-			health["redis"] = "healthy"
+// redirectServerHook redirects plain HTTP on HTTP_REDIRECT_ADDR to the port
+// of the first TLS listener of specs, answering ACME HTTP challenges first
+// when manager is set
+func redirectServerHook(cfg *config.Config, specs []listen.Spec, manager *autocert.Manager, serveErr chan<- error) lifecycle.Hook {
+	port := ""
+	for _, spec := range specs {
+		if spec.TLS != nil {
+			_, port, _ = net.SplitHostPort(spec.Addr)
+			break
 		}
-	} else {
-		health["redis"] = "disabled"
+	}
+	if port == "" {
+		slog.Error("HTTP_REDIRECT_ADDR requires a TLS listener in LISTEN, or TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+		panic("no TLS listener to redirect to")
 	}
 
-	// Check R2 (required - affects overall health)
-	if err := fileStorage.HealthCheck(ctx); err != nil {
-		health["status"] = "unhealthy"
-		health["r2"] = "unhealthy: " + err.Error()
-		writeJSON(w, http.StatusServiceUnavailable, Response{
-			Success: false,
-			Message: "Service is unhealthy",
-			Data:    health,
-		})
-		return
+	var handler http.Handler = handlers.RedirectHTTPS(port)
+	if manager != nil {
+		handler = manager.HTTPHandler(handler)
 	}
-	health["r2"] = "healthy"
+	server := newHTTPServer(cfg.Server, handler)
+	return httpServerHook("redirect server", server, parseListeners("HTTP_REDIRECT_ADDR", cfg.TLS.RedirectAddr), cfg.ShutdownTimeout, serveErr)
+}
 
-	writeJSON(w, http.StatusOK, Response{
-		Success: true,
-		Message: "Service is healthy",
-		Data:    health,
-	})
+// debugServerHook serves pprof, expvar and dumps on the debug listeners,
+// requiring the debug:profile scope unless they are all loopback
+func debugServerHook(cfg *config.Config, authn *auth.Authenticator, serveErr chan<- error) lifecycle.Hook {
+	specs := parseListeners("DEBUG_ADDR", cfg.Debug.Addr)
+	handler := handlers.NewDebugHandler(cfg.Debug.DumpDir)
+	loopback := true
+	for _, spec := range specs {
+		loopback = loopback && spec.Loopback()
+	}
+	if !loopback {
+		handler = handlers.RequireScope(authn, auth.ScopeDebugProfile, handler.ServeHTTP)
+	}
+	slog.Info("Debug server enabled", "authenticated", !loopback, "dump_dir", cfg.Debug.DumpDir)
+
+	server := newHTTPServer(cfg.Server, handlers.RequestIDMiddleware(handler))
+	return httpServerHook("debug server", server, specs, cfg.ShutdownTimeout, serveErr)
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, Response{
-		Success: true,
-		Message: "File Caching Service",
-		Data: map[string]string{
-			"version": "1.0.0",
+// grpcServerHook serves the gRPC API on the listeners of specs. Stopping
+// lets in-flight calls finish until the shutdown timeout, then cancels them.
+func grpcServerHook(cfg *config.Config, specs []listen.Spec, files *handlers.FileHandler, authn *auth.Authenticator, m *metrics.Metrics, budget retrybudget.Config, serveErr chan<- error) lifecycle.Hook {
+	server := grpc.NewServer(handlers.GRPCServerOptions(m, budget)...)
+	filecachev1.RegisterFileServiceServer(server, handlers.NewFileService(files, authn, cfg.GRPC.ChunkSize))
+
+	return lifecycle.Hook{
+		Name: "grpc server",
+		OnStart: func(context.Context) error {
+			listeners, err := listen.Listen(specs, "h2")
+			if err != nil {
+				return err
+			}
+			for _, listener := range listeners {
+				slog.Info("Starting gRPC server", "addr", listener.Addr().String())
+				go func() {
+					if err := server.Serve(listener); err != nil {
+						reportServeErr(serveErr, err)
+					}
+				}()
+			}
+			return nil
 		},
+		OnStop: func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				server.Stop()
+				return ctx.Err()
+			}
+		},
+		Timeout: cfg.ShutdownTimeout,
+	}
+}
+
+// newUploadPipeline creates the post-upload pipeline with the steps named
+// in cfg.Pipeline.Steps
+func newUploadPipeline(cfg *config.Config, s storage.Storage, m *metrics.Metrics) *pipeline.Pipeline {
+	registry := pipeline.NewRegistry()
+	registry.Register("checksum", func() (pipeline.Step, error) {
+		return pipeline.Checksum{}, nil
+	})
+	registry.Register("metadata", func() (pipeline.Step, error) {
+		return pipeline.Metadata{}, nil
+	})
+	registry.Register("thumbnail", func() (pipeline.Step, error) {
+		return pipeline.NewThumbnail(s, cfg.Pipeline.ThumbnailPrefix, cfg.Pipeline.ThumbnailSize)
 	})
+	registry.Register("webhook", func() (pipeline.Step, error) {
+		return pipeline.NewWebhook(cfg.Pipeline.WebhookURL, cfg.Pipeline.WebhookSecret)
+	})
+
+	steps, err := registry.Build(cfg.Pipeline.Steps)
+	if err != nil {
+		slog.Error("Invalid UPLOAD_PIPELINE_STEPS", "error", err)
+		panic(err)
+	}
+	p, err := pipeline.New(pipeline.Config{
+		Steps:       steps,
+		Load:        s.GetObject,
+		Workers:     cfg.Pipeline.Workers,
+		QueueSize:   cfg.Pipeline.QueueSize,
+		MaxAttempts: cfg.Pipeline.MaxAttempts,
+		Backoff:     cfg.Pipeline.Backoff,
+		StepTimeout: cfg.Pipeline.StepTimeout,
+		MaxBytes:    cfg.Pipeline.MaxBytes,
+		Metrics:     m,
+	})
+	if err != nil {
+		slog.Error("Invalid upload pipeline configuration", "error", err)
+		panic(err)
+	}
+	return p
 }
 
-func getFileHandler(w http.ResponseWriter, r *http.Request) {
-	filename := r.PathValue("name")
+// newEventBus creates the bus posting file events to the configured
+// webhooks and streaming them to Kafka or NATS. The stream sink, if any, is
+// returned to be closed once the bus is.
+func newEventBus(cfg config.EventsConfig, m *metrics.Metrics) (*events.Bus, io.Closer) {
+	types, err := events.ParseTypes(cfg.Types)
+	if err != nil {
+		slog.Error("Invalid EVENT_TYPES", "error", err)
+		panic(err)
+	}
+	if len(types) == 0 {
+		types = events.NotificationTypes
+	}
+	var sinks []events.Sink
+	for _, target := range cfg.WebhookURLs {
+		hook, err := events.NewWebhook(target, cfg.WebhookSecret)
+		if err != nil {
+			slog.Error("Invalid EVENT_WEBHOOK_URLS", "error", err)
+			panic(err)
+		}
+		sinks = append(sinks, events.Filter(hook, types))
+	}
+	var stream io.Closer
+	if cfg.Stream != "" {
+		format, err := events.ParseFormat(cfg.StreamFormat)
+		if err != nil {
+			slog.Error("Invalid EVENT_STREAM_FORMAT", "error", err)
+			panic(err)
+		}
+		streamTypes, err := events.ParseTypes(cfg.StreamTypes)
+		if err != nil {
+			slog.Error("Invalid EVENT_STREAM_TYPES", "error", err)
+			panic(err)
+		}
+		streamCfg := events.StreamConfig{
+			Brokers:  cfg.StreamBrokers,
+			Topic:    cfg.StreamTopic,
+			Format:   format,
+			Username: cfg.StreamUsername,
+			Password: cfg.StreamPassword,
+		}
+		if cfg.StreamTLS {
+			streamCfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		var sink interface {
+			events.Sink
+			io.Closer
+		}
+		switch cfg.Stream {
+		case "kafka":
+			sink, err = events.NewKafka(streamCfg)
+		case "nats":
+			sink, err = events.NewNATS(streamCfg)
+		default:
+			err = fmt.Errorf("unknown event stream %q", cfg.Stream)
+		}
+		if err != nil {
+			slog.Error("Invalid event stream configuration", "error", err)
+			panic(err)
+		}
+		stream = sink
+		sinks = append(sinks, events.Filter(sink, streamTypes))
+	}
+	bus, err := events.New(events.Config{
+		QueueSize:   cfg.QueueSize,
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     cfg.Backoff,
+		Timeout:     cfg.Timeout,
+		Metrics:     m,
+	}, sinks...)
+	if err != nil {
+		slog.Error("Invalid event configuration", "error", err)
+		panic(err)
+	}
+	return bus, stream
+}
 
-	if filename == "" {
-		writeJSON(w, http.StatusBadRequest, Response{
-			Success: false,
-			Message: "filename is required",
-		})
-		return
+// newEncryptor creates the Encryptor wrapping data keys with the configured
+// master keys or KMS
+func newEncryptor(cfg config.EncryptionConfig) *encryption.Encryptor {
+	var wrapper encryption.KeyWrapper
+	if cfg.MasterKeys != "" {
+		keys, err := encryption.ParseMasterKeys(cfg.MasterKeys)
+		if err != nil {
+			slog.Error("Invalid ENCRYPTION_MASTER_KEYS", "error", err)
+			panic(err)
+		}
+		wrapper = keys
+	} else {
+		wrapper = encryption.NewTransit(cfg.KMSURL, cfg.KMSKey, cfg.KMSToken, nil)
 	}
+	slog.Info("Encryption enabled", "key", wrapper.KeyID(), "kms", cfg.KMSURL != "", "prefixes", cfg.Prefixes, "cache", cfg.Cache)
+	return encryption.New(wrapper)
+}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
+// r2Transport returns the connection pool settings of the R2 clients
+func r2Transport(cfg config.R2Config) storage.TransportConfig {
+	return storage.TransportConfig{
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSHandshakeTimeout: cfg.TLSHandshakeTimeout,
+	}
+}
 
-	// Check cache only if Redis is available
-	if fileCache != nil {
-		start := time.Now()
-		data, found, err := fileCache.Get(ctx, filename)
-		metrics.CacheOperationDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+// r2Parallel returns how the R2 clients split reads of large objects
+func r2Parallel(cfg config.R2Config) storage.ParallelConfig {
+	return storage.ParallelConfig{
+		Threshold:   cfg.ParallelThreshold,
+		PartSize:    cfg.ParallelPartSize,
+		Concurrency: cfg.ParallelConcurrency,
+	}
+}
+
+// encryptBucket encrypts the objects of the named bucket under the
+// configured prefixes; the client is used as it is when enc is nil
+func encryptBucket(cfg config.EncryptionConfig, enc *encryption.Encryptor, name string, client *storage.R2Client, m *metrics.Metrics) tenant.Backend {
+	if enc == nil {
+		return client
+	}
+	return encryption.NewStorage(client, enc, encryption.BucketPrefixes(cfg.Prefixes, name), m)
+}
+
+// cacheMetadata remembers the metadata of the objects of a bucket for
+// METADATA_CACHE_TTL, when set
+func cacheMetadata(cfg config.KeysConfig, backend tenant.Backend, m *metrics.Metrics) tenant.Backend {
+	if cfg.MetadataTTL <= 0 {
+		return backend
+	}
+	return existence.NewStatCache(backend, existence.StatConfig{TTL: cfg.MetadataTTL, MaxEntries: cfg.MetadataMaxEntries}, m)
+}
 
+// newTenants loads the tenants file and connects to the tenant buckets,
+// returning storage that routes requests to them
+func newTenants(cfg *config.Config, fallback tenant.Backend, enc *encryption.Encryptor, m *metrics.Metrics) (*tenant.Registry, *tenant.Storage) {
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		slog.Error("Invalid tenants file", "path", cfg.TenantsFile, "error", err)
+		panic(err)
+	}
+	buckets := make(map[string]tenant.Backend)
+	for _, t := range tenants.Tenants() {
+		if t.Bucket == "" || buckets[t.Bucket] != nil {
+			continue
+		}
+		client, err := storage.NewR2Client(cfg.R2.AccountID, cfg.R2.AccessKeyID, cfg.R2.SecretAccessKey, t.Bucket, m,
+			storage.WithTransport(r2Transport(cfg.R2)))
 		if err != nil {
-			slog.Error("Cache error", "filename", filename, "error", err)
+			slog.Error("Failed to initialize R2 client", "tenant", t.ID, "bucket", t.Bucket, "error", err)
+			panic(err)
 		}
+		client.SetTimeout(cfg.Timeouts.Storage)
+		client.SetParallelDownload(r2Parallel(cfg.R2))
+		buckets[t.Bucket] = cacheMetadata(cfg.Keys, encryptBucket(cfg.Encryption, enc, t.Bucket, client, m), m)
+	}
+	files, err := tenant.NewStorage(tenants, fallback, buckets)
+	if err != nil {
+		slog.Error("Invalid tenants file", "path", cfg.TenantsFile, "error", err)
+		panic(err)
+	}
+	for _, t := range tenants.Tenants() {
+		slog.Info("Serving tenant", "tenant", t.ID, "hosts", t.Hosts, "path_prefix", t.PathPrefix, "bucket", t.Bucket, "key_prefix", t.KeyPrefix)
+	}
+	return tenants, files
+}
+
+// newGroupCache creates the peer-to-peer cache, loading files from s. Keys
+// in a tenant's cache namespace are loaded from the tenant's storage. Peers
+// are served on their own listener, which is started and kept up to date
+// with peer discovery by a lifecycle hook.
+func newGroupCache(cfg *config.Config, s storage.HeaderGetter, tenants *tenant.Registry, components *lifecycle.Manager) *cache.GroupCache {
+	groupCache, err := cache.NewGroupCache(cache.GroupConfig{
+		Self:       cfg.Groupcache.Self,
+		CacheBytes: cfg.Groupcache.CacheBytes,
+		TTL:        cfg.Redis.CacheTTL,
+		Load: func(ctx context.Context, key string) ([]byte, cache.EntryMeta, bool, error) {
+			if tenants != nil {
+				if t, name, ok := tenants.SplitCacheKey(key); ok {
+					ctx, key = tenant.NewContext(ctx, t), name
+				}
+			}
+			data, headers, err := s.GetObjectWithHeaders(ctx, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, cache.EntryMeta{}, false, nil
+			}
+			if err != nil {
+				return nil, cache.EntryMeta{}, false, err
+			}
+			return data, cache.MetaFromHeaders(headers), true, nil
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create group cache", "error", err)
+		panic(err)
+	}
+
+	peerServer := newHTTPServer(cfg.Server, groupCache)
+	peerServer.Addr = cfg.Groupcache.Addr
+	discovery := cache.PeerDiscovery{
+		Static:   cfg.Groupcache.Peers,
+		DNSName:  cfg.Groupcache.PeersDNS,
+		Interval: cfg.Groupcache.PeersRefresh,
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	components.Append(lifecycle.Hook{
+		Name: "group cache peers",
+		OnStart: func(context.Context) error {
+			listener, err := net.Listen("tcp", peerServer.Addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := peerServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+					slog.Error("Group cache peer server failed", "error", err)
+				}
+			}()
+			go groupCache.WatchPeers(watchCtx, discovery)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopWatch()
+			return peerServer.Shutdown(ctx)
+		},
+	})
+	slog.Info("Group cache enabled",
+		"self", cfg.Groupcache.Self,
+		"peer_addr", cfg.Groupcache.Addr,
+		"cache_bytes", cfg.Groupcache.CacheBytes,
+	)
+	return groupCache
+}
 
-		if found {
-			metrics.CacheHitsTotal.Inc()
-			slog.Info("Cache HIT", "filename", filename)
-			writeFileResponse(w, filename, data)
-			return
+// checkCacheFormat samples cache entries to report how many still use the
+// legacy raw format and optionally migrates them to envelopes
+func checkCacheFormat(c *cache.RedisCache, cfg config.RedisConfig) {
+	if cfg.FormatSampleSize > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		report, err := c.SampleFormats(ctx, cfg.FormatSampleSize)
+		cancel()
+		if err != nil {
+			slog.Warn("Cache format self-check failed", "error", err)
+		} else {
+			slog.Info("Cache format self-check",
+				"sampled", report.Sampled,
+				"legacy", report.Legacy,
+				"envelope", report.Envelope,
+				"skipped", report.Skipped,
+			)
 		}
+	}
 
-		metrics.CacheMissesTotal.Inc()
-		slog.Info("Cache MISS", "filename", filename)
-	} else {
-		slog.Info("Cache disabled, fetching from R2", "filename", filename)
+	if !cfg.MigrateLegacyEntries {
+		return
 	}
 
-	// Fetch from R2
 	start := time.Now()
-	data, err := fileStorage.GetObject(ctx, filename)
-	duration := time.Since(start).Seconds()
-	metrics.R2RequestDuration.WithLabelValues("get").Observe(duration)
+	migrated, err := c.MigrateLegacyEntries(context.Background())
+	if err != nil {
+		slog.Error("Cache entry migration failed", "migrated", migrated, "error", err)
+		return
+	}
+	slog.Info("Cache entry migration completed",
+		"migrated", migrated,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
 
+// preloadCache warms the keys listed in the preload manifest. It runs in
+// the background so a slow or missing manifest never blocks startup.
+func preloadCache(cfg config.WarmConfig, s storage.Storage, c cache.Cache, opts ...warmer.Option) {
+	if c == nil {
+		slog.Warn("Cache disabled, skipping preload manifest", "manifest", cfg.PreloadManifest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	keys, err := warmer.LoadManifest(ctx, cfg.PreloadManifest, s)
 	if err != nil {
-		metrics.R2RequestsTotal.WithLabelValues("get", "error").Inc()
-		slog.Error("R2 error", "filename", filename, "error", err)
+		slog.Error("Cache preload failed", "error", err)
+		return
+	}
+	if len(keys) == 0 {
+		slog.Warn("Preload manifest is empty", "manifest", cfg.PreloadManifest)
+		return
+	}
 
-		if ctx.Err() == context.DeadlineExceeded {
-			writeJSON(w, http.StatusGatewayTimeout, Response{
-				Success: false,
-				Message: "Request timeout",
-			})
-			return
-		}
+	slog.Info("Preloading cache", "manifest", cfg.PreloadManifest, "keys", len(keys))
+	spec := warmer.Spec{Name: "preload", Keys: keys, Concurrency: cfg.PreloadConcurrency}
+	if _, err := warmer.New(spec, s, c, opts...).Run(ctx); err != nil {
+		slog.Error("Cache preload failed", "error", err)
+	}
+}
 
-		if isNotFoundError(err) {
-			writeJSON(w, http.StatusNotFound, Response{
-				Success: false,
-				Message: "File not found",
-			})
-			return
+// advertisedProtocols lists the enabled APIs besides the HTTP API, for
+// GET /capabilities
+func advertisedProtocols(cfg *config.Config) []handlers.Protocol {
+	var protocols []handlers.Protocol
+	addrs := func(env, list string) []string {
+		var addrs []string
+		for _, spec := range parseListeners(env, list) {
+			addrs = append(addrs, spec.String())
 		}
+		return addrs
+	}
+	if cfg.GRPC.Addr != "" {
+		protocols = append(protocols, handlers.Protocol{Name: "grpc", Addrs: addrs("GRPC_ADDR", cfg.GRPC.Addr)})
+	}
+	if cfg.S3.Addr != "" {
+		protocols = append(protocols, handlers.Protocol{Name: "s3", Addrs: addrs("S3_ADDR", cfg.S3.Addr), Ranges: true})
+	}
+	if cfg.WebDAV.Enabled {
+		protocols = append(protocols, handlers.Protocol{Name: "webdav", Path: handlers.WebDAVPrefix + "/", Ranges: true})
+	}
+	return protocols
+}
 
-		writeJSON(w, http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "Failed to retrieve file",
+// scheduleReports publishes cache efficiency reports to storage on cfg's
+// schedule
+func scheduleReports(jobs *scheduler.Scheduler, cfg config.ReportsConfig, tracker *efficiency.Tracker, s storage.Storage) {
+	schedule, err := scheduler.ParseSchedule(cfg.Schedule)
+	if err == nil {
+		err = jobs.Add(scheduler.Job{
+			Name:     "cache-efficiency-report",
+			Schedule: schedule,
+			Run: func(ctx context.Context) error {
+				return tracker.Publish(ctx, s, cfg.StoragePrefix)
+			},
 		})
-		return
 	}
+	if err != nil {
+		slog.Error("Failed to schedule cache efficiency report", "error", err)
+		panic(err)
+	}
+	slog.Info("Scheduled cache efficiency report", "schedule", cfg.Schedule, "prefix", cfg.StoragePrefix)
+}
 
-	metrics.R2RequestsTotal.WithLabelValues("get", "success").Inc()
+// quotaReconcileJob is the name of the storage quota reconciliation job
+const quotaReconcileJob = "storage-quota-reconcile"
 
-	// Cache the file only if Redis is available
-	if fileCache != nil {
-		go func() {
-			bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-
-			start := time.Now()
-			if err := fileCache.Set(bgCtx, filename, data); err != nil {
-				slog.Error("Failed to cache file", "filename", filename, "error", err)
-			} else {
-				slog.Info("Cached file", "filename", filename)
-			}
-			metrics.CacheOperationDuration.WithLabelValues("set").Observe(time.Since(start).Seconds())
-		}()
+// newQuotaTracker returns a tracker for STORAGE_QUOTAS and the quotas of
+// tenants, or nil when there are none
+func newQuotaTracker(cfg *config.Config, tenants *tenant.Registry, m *metrics.Metrics) *quota.Tracker {
+	rules, err := quota.ParseRules(cfg.Quota.Rules)
+	if err != nil {
+		slog.Error("Invalid STORAGE_QUOTAS", "error", err)
+		panic(err)
 	}
-
-	writeFileResponse(w, filename, data)
+	if tenants != nil {
+		rules = append(rules, quota.TenantRules(tenants.Tenants())...)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	tracker, err := quota.NewTracker(m, rules...)
+	if err != nil {
+		slog.Error("Invalid storage quotas", "error", err)
+		panic(err)
+	}
+	slog.Info("Storage quotas enabled", "quotas", len(rules), "reconcile", cfg.Quota.Reconcile)
+	return tracker
 }
 
-func writeFileResponse(w http.ResponseWriter, filename string, data []byte) {
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
-	if contentType == "" {
-		contentType = "application/octet-stream"
+// scheduleQuotaReconcile recounts storage quota usage from s on schedule
+func scheduleQuotaReconcile(jobs *scheduler.Scheduler, schedule string, tracker *quota.Tracker, s storage.Storage) {
+	parsed, err := scheduler.ParseSchedule(schedule)
+	if err == nil {
+		err = jobs.Add(scheduler.Job{
+			Name:     quotaReconcileJob,
+			Schedule: parsed,
+			Run: func(ctx context.Context) error {
+				return tracker.Reconcile(ctx, s)
+			},
+		})
 	}
+	if err != nil {
+		slog.Error("Failed to schedule storage quota reconciliation", "error", err)
+		panic(err)
+	}
+}
 
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Disposition", "inline; filename=\""+filename+"\"")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+// scheduleBlobCollection deletes unreferenced blobs on schedule, from the
+// shared namespace and then each tenant's
+func scheduleBlobCollection(jobs *scheduler.Scheduler, schedule string, blobs *cas.Storage, tenants *tenant.Registry) {
+	parsed, err := scheduler.ParseSchedule(schedule)
+	if err == nil {
+		err = jobs.Add(scheduler.Job{
+			Name:     "cas-gc",
+			Schedule: parsed,
+			Run: func(ctx context.Context) error {
+				_, err := blobs.Collect(ctx)
+				if tenants == nil {
+					return err
+				}
+				errs := []error{err}
+				for _, t := range tenants.Tenants() {
+					if _, err := blobs.Collect(tenant.NewContext(ctx, t)); err != nil {
+						errs = append(errs, fmt.Errorf("tenant %s: %w", t.ID, err))
+					}
+				}
+				return errors.Join(errs...)
+			},
+		})
+	}
+	if err != nil {
+		slog.Error("Failed to schedule blob collection", "error", err)
+		panic(err)
+	}
 }
 
-func isNotFoundError(err error) bool {
-	return strings.Contains(err.Error(), "NoSuchKey") ||
-		strings.Contains(err.Error(), "not found")
+// scheduleCacheScrub checks a sample of cached files against storage on
+// schedule. Caches that can't be sampled, and files that may still be
+// served from the legacy origin, are skipped.
+func scheduleCacheScrub(jobs *scheduler.Scheduler, cfg config.ScrubConfig, c cache.Cache, files storage.HeaderStater, tenants *tenant.Registry, origin *legacy.Origin, m *metrics.Metrics) {
+	if c == nil {
+		slog.Warn("Cache disabled, skipping the cache scrubber")
+		return
+	}
+	scrubCfg := scrub.Config{Sample: cfg.Sample, Tenants: tenants, Metrics: m}
+	if origin != nil {
+		scrubCfg.Skip = origin.Covers
+	}
+	scrubber, err := scrub.New(c, files, scrubCfg)
+	if errors.Is(err, errors.ErrUnsupported) {
+		slog.Warn("Skipping the cache scrubber", "error", err)
+		return
+	}
+	var parsed scheduler.Schedule
+	if err == nil {
+		parsed, err = scheduler.ParseSchedule(cfg.Schedule)
+	}
+	if err == nil {
+		err = jobs.Add(scheduler.Job{
+			Name:     "cache-scrub",
+			Schedule: parsed,
+			Run: func(ctx context.Context) error {
+				result, err := scrubber.Run(ctx)
+				slog.InfoContext(ctx, "Cache scrub finished", "checked", result.Checked, "evicted", result.Evicted)
+				return err
+			},
+		})
+	}
+	if err != nil {
+		slog.Error("Failed to schedule the cache scrubber", "error", err)
+		panic(err)
+	}
 }
 
-func writeJSON(w http.ResponseWriter, status int, data any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		slog.Error("Error encoding JSON response", "error", err)
+// registerWarmers loads warmer specs and schedules them. Invalid specs are
+// fatal; warmers are skipped when there is no cache to fill.
+func registerWarmers(jobs *scheduler.Scheduler, path string, s storage.Storage, c cache.Cache, opts ...warmer.Option) {
+	specs, err := warmer.LoadSpecs(path)
+	if err != nil {
+		slog.Error("Invalid warmers file", "path", path, "error", err)
+		panic(err)
+	}
+	if c == nil {
+		slog.Warn("Cache disabled, skipping configured warmers", "count", len(specs))
+		return
+	}
+
+	for _, spec := range specs {
+		job, err := warmer.New(spec, s, c, opts...).Job()
+		if err == nil {
+			err = jobs.Add(job)
+		}
+		if err != nil {
+			slog.Error("Failed to schedule warmer", "warmer", spec.Name, "error", err)
+			panic(err)
+		}
+		slog.Info("Scheduled warmer", "warmer", spec.Name, "schedule", spec.Schedule, "tier", spec.Tier)
 	}
 }
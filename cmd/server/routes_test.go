@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+// undocumented lists routes left out of the OpenAPI document on purpose
+var undocumented = []string{
+	"GET /docs",
+	// The admin dashboard is a page for browsers
+	"GET /admin/ui", "GET /admin/ui/{asset}",
+	// pprof and expvar, served on the admin listeners
+	"GET /debug/", "POST /debug/",
+	// WebDAV is described by its RFC
+	"GET /dav/", "PUT /dav/", "DELETE /dav/", "OPTIONS /dav/", "PROPFIND /dav/", "PROPPATCH /dav/",
+	"MKCOL /dav/", "COPY /dav/", "MOVE /dav/", "LOCK /dav/", "UNLOCK /dav/",
+}
+
+// registeredRoutes returns the patterns passed to Handle and HandleFunc on
+// mux and adminMux in main.go
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse main.go: %v", err)
+	}
+
+	var routes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if recv, ok := sel.X.(*ast.Ident); !ok || (recv.Name != "mux" && recv.Name != "adminMux") {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			t.Errorf("Route pattern is not a string literal: %#v", call.Args[0])
+			return true
+		}
+		pattern, _ := strconv.Unquote(lit.Value)
+		if !slices.Contains(undocumented, pattern) {
+			// OpenAPI has no multi-segment parameters; {name...} is
+			// documented as {name}
+			routes = append(routes, strings.ReplaceAll(pattern, "...}", "}"))
+		}
+		return true
+	})
+	return routes
+}
+
+// documentedRoutes returns the operations in the OpenAPI document as
+// "METHOD /path" patterns
+func documentedRoutes(t *testing.T) []string {
+	t.Helper()
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(handlers.OpenAPISpec(), &spec); err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", spec.OpenAPI)
+	}
+
+	var routes []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				routes = append(routes, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	return routes
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	registered := registeredRoutes(t)
+	documented := documentedRoutes(t)
+	if len(registered) == 0 {
+		t.Fatal("Expected routes in main.go")
+	}
+
+	for _, route := range registered {
+		if !slices.Contains(documented, route) {
+			t.Errorf("Route %q is missing from openapi.json", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(registered, route) {
+			t.Errorf("openapi.json documents %q, which isn't registered", route)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package auth holds admin credentials and the scopes they grant
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Scope is a permission granted to an admin credential
+type Scope string
+
+// Admin scopes. ScopeAll grants every scope.
+const (
+	ScopeAll              Scope = "*"
+	ScopeCachePurge       Scope = "cache:purge"
+	ScopeCacheWarm        Scope = "cache:warm"
+	ScopeConfigReload     Scope = "config:reload"
+	ScopeTenantsManage    Scope = "tenants:manage"
+	ScopeQuarantineReview Scope = "quarantine:review"
+	ScopeKeysManage       Scope = "keys:manage"
+	ScopeJobsManage       Scope = "jobs:manage"
+	ScopeFilesWrite       Scope = "files:write"
+	ScopeFilesPresign     Scope = "files:presign"
+	ScopeDiagnosticsRead  Scope = "diagnostics:read"
+	ScopeFeaturesOverride Scope = "features:override"
+	ScopeReportsRead      Scope = "reports:read"
+	ScopeDebugProfile     Scope = "debug:profile"
+)
+
+// Scopes lists every scope a credential can be granted
+var Scopes = []Scope{
+	ScopeCachePurge,
+	ScopeCacheWarm,
+	ScopeConfigReload,
+	ScopeTenantsManage,
+	ScopeQuarantineReview,
+	ScopeKeysManage,
+	ScopeJobsManage,
+	ScopeFilesWrite,
+	ScopeFilesPresign,
+	ScopeDiagnosticsRead,
+	ScopeFeaturesOverride,
+	ScopeReportsRead,
+	ScopeDebugProfile,
+}
+
+// Credential is a named admin token and the scopes it grants
+type Credential struct {
+	Name   string
+	Token  string
+	Scopes []Scope
+}
+
+// Allows reports whether the credential grants scope
+func (c *Credential) Allows(scope Scope) bool {
+	return slices.Contains(c.Scopes, ScopeAll) || slices.Contains(c.Scopes, scope)
+}
+
+// ParseCredentials parses a comma-separated list of name:token:scopes
+// entries, where scopes are separated by "|", e.g.
+// "ops:s3cret:cache:purge|cache:warm"
+func ParseCredentials(spec string) ([]Credential, error) {
+	var creds []Credential
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, _ := strings.Cut(entry, ":")
+		token, scopeList, _ := strings.Cut(rest, ":")
+		if name == "" || token == "" || scopeList == "" {
+			return nil, fmt.Errorf("invalid admin credential %q: expected name:token:scope|scope", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("admin credential %q is defined more than once", name)
+		}
+		seen[name] = true
+
+		scopes, err := parseScopes(name, scopeList)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, Credential{Name: name, Token: token, Scopes: scopes})
+	}
+	return creds, nil
+}
+
+// ParseCertificateCredentials parses a comma-separated list of name:scopes
+// entries for client certificates, where name is a certificate's common
+// name or SAN, e.g. "spiffe://prod/deployer:cache:purge|cache:warm". The
+// name runs up to the last colon before the scopes.
+func ParseCertificateCredentials(spec string) ([]Credential, error) {
+	var creds []Credential
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, scopeList, ok := cutScopes(entry)
+		if !ok {
+			return nil, fmt.Errorf("invalid client certificate credential %q: expected name:scope|scope", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("client certificate credential %q is defined more than once", name)
+		}
+		seen[name] = true
+
+		scopes, err := parseScopes(name, scopeList)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, Credential{Name: name, Scopes: scopes})
+	}
+	return creds, nil
+}
+
+// cutScopes splits entry at the colon that starts its scope list. Scopes
+// themselves contain a colon, so it is the last colon not followed by a
+// scope's own.
+func cutScopes(entry string) (name, scopeList string, ok bool) {
+	for i := strings.LastIndex(entry, ":"); i > 0; i = strings.LastIndex(entry[:i], ":") {
+		name, scopeList = entry[:i], entry[i+1:]
+		if _, err := parseScopes(name, scopeList); err == nil {
+			return name, scopeList, true
+		}
+	}
+	return "", "", false
+}
+
+// parseScopes parses the "|"-separated scopes of the credential name
+func parseScopes(name, list string) ([]Scope, error) {
+	var scopes []Scope
+	for _, s := range strings.Split(list, "|") {
+		scope := Scope(strings.TrimSpace(s))
+		if scope != ScopeAll && !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("admin credential %q: unknown scope %q", name, scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// Authenticator matches tokens to credentials
+type Authenticator struct {
+	mu    sync.RWMutex
+	creds []Credential
+	certs []Credential
+}
+
+// NewAuthenticator creates an Authenticator for creds. Credentials with an
+// empty token are ignored.
+func NewAuthenticator(creds ...Credential) *Authenticator {
+	a := &Authenticator{}
+	a.SetCredentials(creds...)
+	return a
+}
+
+// SetCredentials replaces the credentials, so rotated tokens take effect
+// without a restart. Credentials already matched stay valid for the
+// requests that hold them.
+func (a *Authenticator) SetCredentials(creds ...Credential) {
+	var valid []Credential
+	for _, c := range creds {
+		if c.Token != "" {
+			valid = append(valid, c)
+		}
+	}
+	a.mu.Lock()
+	a.creds = valid
+	a.mu.Unlock()
+}
+
+// SetCertificateCredentials replaces the credentials granted to client
+// certificates, matched by name rather than token
+func (a *Authenticator) SetCertificateCredentials(creds ...Credential) {
+	a.mu.Lock()
+	a.certs = creds
+	a.mu.Unlock()
+}
+
+func (a *Authenticator) credentials() []Credential {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.creds
+}
+
+// Enabled reports whether any credentials are configured
+func (a *Authenticator) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.creds) > 0 || len(a.certs) > 0
+}
+
+// Authenticate returns the credential matching token. Every credential is
+// compared so timing doesn't reveal which one matched.
+func (a *Authenticator) Authenticate(token string) (*Credential, bool) {
+	var match *Credential
+	creds := a.credentials()
+	for i := range creds {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(creds[i].Token)) == 1 {
+			match = &creds[i]
+		}
+	}
+	return match, match != nil
+}
+
+// Lookup returns the credential named name. S3 clients identify themselves
+// by name, as the access key ID, and prove they hold the token by signing
+// with it.
+func (a *Authenticator) Lookup(name string) (*Credential, bool) {
+	creds := a.credentials()
+	for i := range creds {
+		if creds[i].Name == name {
+			return &creds[i], true
+		}
+	}
+	return nil, false
+}
+
+// AuthenticateCertificate returns the certificate credential matching one
+// of names, the verified names of a client certificate
+func (a *Authenticator) AuthenticateCertificate(names []string) (*Credential, bool) {
+	a.mu.RLock()
+	certs := a.certs
+	a.mu.RUnlock()
+	for i := range certs {
+		if slices.Contains(names, certs[i].Name) {
+			return &certs[i], true
+		}
+	}
+	return nil, false
+}
+
+type contextKey struct{}
+
+// WithCredential returns a context carrying the authenticated credential
+func WithCredential(ctx context.Context, c *Credential) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// CredentialFrom returns the credential stored in ctx, if any
+func CredentialFrom(ctx context.Context) (*Credential, bool) {
+	c, ok := ctx.Value(contextKey{}).(*Credential)
+	return c, ok
+}
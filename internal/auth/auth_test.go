@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+)
+
+func TestParseCredentials(t *testing.T) {
+	creds, err := auth.ParseCredentials("ops:t1:cache:purge|cache:warm, root:t2:*")
+	if err != nil {
+		t.Fatalf("ParseCredentials failed: %v", err)
+	}
+	if len(creds) != 2 {
+		t.Fatalf("Expected 2 credentials, got %d", len(creds))
+	}
+
+	ops := creds[0]
+	if ops.Name != "ops" || ops.Token != "t1" {
+		t.Errorf("Unexpected credential: %+v", ops)
+	}
+	if !ops.Allows(auth.ScopeCachePurge) || !ops.Allows(auth.ScopeCacheWarm) {
+		t.Error("Expected ops to allow cache scopes")
+	}
+	if ops.Allows(auth.ScopeTenantsManage) {
+		t.Error("Expected ops not to allow tenants:manage")
+	}
+	if !creds[1].Allows(auth.ScopeTenantsManage) {
+		t.Error("Expected * to allow every scope")
+	}
+}
+
+func TestParseCredentials_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing scopes": "ops:t1",
+		"missing token":  "ops::cache:purge",
+		"unknown scope":  "ops:t1:cache:nuke",
+		"duplicate name": "ops:t1:cache:purge,ops:t2:cache:warm",
+	}
+	for name, spec := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := auth.ParseCredentials(spec); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestParseCertificateCredentials(t *testing.T) {
+	creds, err := auth.ParseCertificateCredentials("deployer:cache:purge|cache:warm, spiffe://prod/ops:*")
+	if err != nil {
+		t.Fatalf("ParseCertificateCredentials failed: %v", err)
+	}
+	if len(creds) != 2 {
+		t.Fatalf("Expected 2 credentials, got %d", len(creds))
+	}
+	if creds[0].Name != "deployer" || !creds[0].Allows(auth.ScopeCacheWarm) || creds[0].Allows(auth.ScopeKeysManage) {
+		t.Errorf("Unexpected credential: %+v", creds[0])
+	}
+	if creds[1].Name != "spiffe://prod/ops" || !creds[1].Allows(auth.ScopeKeysManage) {
+		t.Errorf("Unexpected credential: %+v", creds[1])
+	}
+
+	for _, spec := range []string{"deployer", "deployer:cache:nuke", "a:cache:purge,a:cache:warm"} {
+		if _, err := auth.ParseCertificateCredentials(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestAuthenticator_AuthenticateCertificate(t *testing.T) {
+	authn := auth.NewAuthenticator()
+	authn.SetCertificateCredentials(auth.Credential{Name: "deployer", Scopes: []auth.Scope{auth.ScopeCachePurge}})
+	if !authn.Enabled() {
+		t.Fatal("Expected certificate credentials to enable the authenticator")
+	}
+
+	cred, ok := authn.AuthenticateCertificate([]string{"host.internal", "deployer"})
+	if !ok || cred.Name != "deployer" {
+		t.Errorf("Expected credential deployer, got %v", cred)
+	}
+	if _, ok := authn.AuthenticateCertificate([]string{"other"}); ok {
+		t.Error("Expected no credential for an unknown certificate")
+	}
+	if _, ok := authn.Authenticate(""); ok {
+		t.Error("Expected certificate credentials not to match an empty token")
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "a", Token: "t1", Scopes: []auth.Scope{auth.ScopeCachePurge}},
+		auth.Credential{Name: "disabled"},
+	)
+	if !authn.Enabled() {
+		t.Fatal("Expected authenticator to be enabled")
+	}
+
+	cred, ok := authn.Authenticate("t1")
+	if !ok || cred.Name != "a" {
+		t.Errorf("Expected credential a, got %v", cred)
+	}
+	for _, token := range []string{"", "t2"} {
+		if _, ok := authn.Authenticate(token); ok {
+			t.Errorf("Expected token %q to be rejected", token)
+		}
+	}
+
+	if cred, ok := authn.Lookup("a"); !ok || cred.Token != "t1" {
+		t.Errorf("Expected credential a to be found by name, got %v", cred)
+	}
+	if _, ok := authn.Lookup("disabled"); ok {
+		t.Error("Expected credentials without tokens not to be found")
+	}
+
+	if auth.NewAuthenticator(auth.Credential{Name: "empty"}).Enabled() {
+		t.Error("Expected credentials without tokens to be ignored")
+	}
+}
+
+func TestAuthenticator_SetCredentials(t *testing.T) {
+	authn := auth.NewAuthenticator(auth.Credential{Name: "a", Token: "old", Scopes: []auth.Scope{auth.ScopeAll}})
+	authn.SetCredentials(auth.Credential{Name: "a", Token: "new", Scopes: []auth.Scope{auth.ScopeAll}})
+
+	if _, ok := authn.Authenticate("old"); ok {
+		t.Error("Expected the rotated token to be rejected")
+	}
+	if cred, ok := authn.Authenticate("new"); !ok || cred.Name != "a" {
+		t.Errorf("Expected the new token to be accepted, got %v", cred)
+	}
+
+	authn.SetCredentials()
+	if authn.Enabled() {
+		t.Error("Expected no credentials after clearing them")
+	}
+}
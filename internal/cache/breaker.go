@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// ErrCircuitOpen is returned for writes skipped while Redis is being
+// bypassed after repeated failures
+var ErrCircuitOpen = errors.New("cache circuit open")
+
+// BreakerConfig controls when Redis is bypassed after failures
+type BreakerConfig struct {
+	// Threshold is the number of consecutive failed commands that opens
+	// the circuit; 0 disables the breaker
+	Threshold int
+	// Cooldown is how long the circuit stays open before a single command
+	// is let through to test whether Redis has recovered
+	Cooldown time.Duration
+}
+
+// breaker stops commands from reaching Redis while it is failing, so
+// requests fall through to storage at once instead of paying a timeout.
+// A nil breaker lets every command through.
+type breaker struct {
+	cfg     BreakerConfig
+	metrics *metrics.Metrics
+	now     func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(cfg BreakerConfig, m *metrics.Metrics) *breaker {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	return &breaker{cfg: cfg, metrics: m, now: time.Now}
+}
+
+// allow reports whether a command may be sent: always while the circuit is
+// closed, and once it has cooled down, for a single probe at a time
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of a command let through by allow. A success
+// closes the circuit; a failed probe, or Threshold failures in a row,
+// opens it for another cooldown.
+func (b *breaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.probing
+	b.probing = false
+	if probe && errors.Is(err, context.Canceled) {
+		// The probe proved nothing; the next command tries again
+		return
+	}
+
+	if !breakerFailure(err) {
+		b.failures = 0
+		if b.open {
+			b.open = false
+			b.metrics.CacheCircuitOpen.Set(0)
+			b.metrics.CacheCircuitTransitionsTotal.WithLabelValues("closed").Inc()
+			slog.Info("Cache circuit closed, Redis recovered")
+		}
+		return
+	}
+
+	b.failures++
+	if probe || (!b.open && b.failures >= b.cfg.Threshold) {
+		if !b.open {
+			b.metrics.CacheCircuitOpen.Set(1)
+			b.metrics.CacheCircuitTransitionsTotal.WithLabelValues("open").Inc()
+			slog.Warn("Cache circuit opened, bypassing Redis",
+				"failures", b.failures,
+				"cooldown", b.cfg.Cooldown,
+				"error", err,
+			)
+		}
+		b.open = true
+		b.openUntil = b.now().Add(b.cfg.Cooldown)
+	}
+}
+
+// bypassed turns reads skipped by the open circuit into misses
+func bypassed(err error) error {
+	if errors.Is(err, ErrCircuitOpen) {
+		return nil
+	}
+	return err
+}
+
+// breakerFailure reports whether err means Redis is unhealthy: transient
+// failures and timeouts, but not misses, canceled requests or replies to
+// bad commands
+func breakerFailure(err error) bool {
+	return retryable(err) || errors.Is(err, context.DeadlineExceeded)
+}
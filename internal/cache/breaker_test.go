@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// replyError is an error reply from the server
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+func (replyError) RedisError()     {}
+
+func TestBreaker(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	b := newBreaker(BreakerConfig{Threshold: 2, Cooldown: time.Minute}, m)
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	errDown := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	// Misses and replies to bad commands don't count
+	b.record(redis.Nil)
+	b.record(replyError("WRONGTYPE Operation against a key holding the wrong kind of value"))
+	b.record(errDown)
+	if !b.allow() {
+		t.Fatal("Expected the circuit to stay closed below the threshold")
+	}
+	b.record(fmt.Errorf("redis get error: %w", context.DeadlineExceeded))
+	if b.allow() {
+		t.Fatal("Expected the circuit to open after 2 failures in a row")
+	}
+	if got := testutil.ToFloat64(m.CacheCircuitOpen); got != 1 {
+		t.Errorf("Expected cache_circuit_open 1, got %v", got)
+	}
+
+	// After the cooldown a single probe goes through, and its failure
+	// reopens the circuit
+	now = now.Add(time.Minute)
+	if !b.allow() || b.allow() {
+		t.Fatal("Expected exactly one probe after the cooldown")
+	}
+	b.record(errDown)
+	if b.allow() {
+		t.Fatal("Expected a failed probe to reopen the circuit")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("Expected a probe after the second cooldown")
+	}
+	b.record(nil)
+	if !b.allow() || !b.allow() {
+		t.Error("Expected a successful probe to close the circuit")
+	}
+	if got := testutil.ToFloat64(m.CacheCircuitOpen); got != 0 {
+		t.Errorf("Expected cache_circuit_open 0, got %v", got)
+	}
+	if opened := testutil.ToFloat64(m.CacheCircuitTransitionsTotal.WithLabelValues("open")); opened != 1 {
+		t.Errorf("Expected the circuit to be counted as opened once, got %v", opened)
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	if b := newBreaker(BreakerConfig{}, metrics.Noop()); b != nil || !b.allow() {
+		t.Error("Expected a nil breaker that allows every command")
+	}
+}
+
+func TestRedisCache_BypassedWhileOpen(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	c := &RedisCache{
+		client:  client,
+		metrics: metrics.Noop(),
+		breaker: newBreaker(BreakerConfig{Threshold: 1, Cooldown: time.Minute}, metrics.Noop()),
+	}
+	c.breaker.open = true
+	c.breaker.openUntil = time.Now().Add(time.Minute)
+
+	ctx := context.Background()
+	if data, found, err := c.Get(ctx, "a"); err != nil || found || data != nil {
+		t.Errorf("Expected reads to miss while the circuit is open, got %v, %v", found, err)
+	}
+	if _, found, err := c.GetEntry(ctx, "a"); err != nil || found {
+		t.Errorf("Expected entry reads to miss while the circuit is open, got %v, %v", found, err)
+	}
+	if err := c.Set(ctx, "a", []byte("data")); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected writes to fail fast with ErrCircuitOpen, got %v", err)
+	}
+}
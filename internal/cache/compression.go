@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is an algorithm compressing cached payloads
+type Codec string
+
+const (
+	CodecNone   Codec = "none"
+	CodecSnappy Codec = "snappy"
+	CodecZstd   Codec = "zstd"
+)
+
+// codecFlags are the envelope flags marking a payload compressed with each
+// codec
+var codecFlags = map[Codec]byte{
+	CodecSnappy: 1,
+	CodecZstd:   2,
+}
+
+// CompressionConfig controls compressing payloads before they are stored
+type CompressionConfig struct {
+	Codec Codec
+	// MinBytes is the size of the smallest payload compressed
+	MinBytes int
+	// MaxRatio is the largest compressed to original size ratio worth
+	// keeping; payloads compressing worse are stored as they are
+	MaxRatio float64
+}
+
+// zstd encoders and decoders are safe for concurrent use through their
+// EncodeAll and DecodeAll methods
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress returns payload compressed with cfg's codec, or ok false when
+// it is too small or doesn't compress well enough to be worth it
+func (cfg CompressionConfig) compress(payload []byte) (compressed []byte, flag byte, ok bool) {
+	flag, found := codecFlags[cfg.Codec]
+	if !found || len(payload) < cfg.MinBytes || len(payload) == 0 {
+		return nil, 0, false
+	}
+	switch cfg.Codec {
+	case CodecSnappy:
+		compressed = s2.EncodeSnappy(nil, payload)
+	case CodecZstd:
+		compressed = zstdEncoder.EncodeAll(payload, nil)
+	}
+	if float64(len(compressed)) > cfg.MaxRatio*float64(len(payload)) {
+		return nil, 0, false
+	}
+	return compressed, flag, true
+}
+
+// decompress reverses compress for a payload stored with flag
+func decompress(flag byte, payload []byte) ([]byte, error) {
+	switch flag {
+	case codecFlags[CodecSnappy]:
+		return s2.Decode(nil, payload)
+	case codecFlags[CodecZstd]:
+		return zstdDecoder.DecodeAll(payload, nil)
+	}
+	return nil, fmt.Errorf("unknown compression flag %d", flag)
+}
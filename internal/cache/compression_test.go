@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+func TestCompression_RoundTrip(t *testing.T) {
+	csv := []byte(strings.Repeat("id,name,price\n42,widget,9.99\n", 200))
+	meta := EntryMeta{ContentType: "text/csv", Size: int64(len(csv))}
+
+	for _, codec := range []Codec{CodecSnappy, CodecZstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			cfg := CompressionConfig{Codec: codec, MinBytes: 1024, MaxRatio: 0.9}
+			compressed, flag, ok := cfg.compress(csv)
+			if !ok || len(compressed) >= len(csv)/2 {
+				t.Fatalf("Expected repetitive CSV to compress well, got %d of %d bytes", len(compressed), len(csv))
+			}
+			data, err := encodeFlaggedEnvelope(meta, compressed, flag)
+			if err != nil {
+				t.Fatalf("encodeFlaggedEnvelope failed: %v", err)
+			}
+			if DetectFormat(data) != FormatEnvelope {
+				t.Error("Expected envelope format")
+			}
+			got, payload, ok, err := decodeEnvelope(data)
+			if !ok || err != nil {
+				t.Fatalf("Expected envelope to decode, got ok=%v err=%v", ok, err)
+			}
+			if !bytes.Equal(payload, csv) || got.ContentType != "text/csv" {
+				t.Errorf("Expected the original payload and metadata, got %d bytes and %+v", len(payload), got)
+			}
+
+			// A corrupt payload is reported rather than served
+			data[len(data)-1] ^= 0xff
+			data[len(data)-2] ^= 0xff
+			if _, _, _, err := decodeEnvelope(data); err == nil {
+				t.Error("Expected a corrupt payload to fail to decompress")
+			}
+		})
+	}
+}
+
+func TestCompression_Skips(t *testing.T) {
+	cfg := CompressionConfig{Codec: CodecZstd, MinBytes: 1024, MaxRatio: 0.9}
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	tests := []struct {
+		name    string
+		cfg     CompressionConfig
+		payload []byte
+	}{
+		{"disabled", CompressionConfig{Codec: CodecNone, MinBytes: 0, MaxRatio: 1}, bytes.Repeat([]byte("a"), 4096)},
+		{"too small", cfg, bytes.Repeat([]byte("a"), 1000)},
+		{"incompressible", cfg, random},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := tt.cfg.compress(tt.payload); ok {
+				t.Error("Expected the payload to be stored uncompressed")
+			}
+		})
+	}
+}
+
+func TestRedisCache_Encode(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	c := &RedisCache{compression: CompressionConfig{Codec: CodecSnappy, MinBytes: 100, MaxRatio: 0.9}, metrics: m}
+	json := []byte(strings.Repeat(`{"id":1,"tags":["a","b"]},`, 50))
+
+	value, compressed, err := c.encode(EntryMeta{ETag: `"v1"`, Size: int64(len(json))}, json)
+	if err != nil || !compressed || len(value) >= len(json) {
+		t.Fatalf("Expected a compressed envelope smaller than the payload, got %d bytes (%v)", len(value), err)
+	}
+	meta, payload, _, err := decodeEnvelope(value)
+	if err != nil || !bytes.Equal(payload, json) || meta.Size != int64(len(json)) {
+		t.Errorf("Expected the payload back with its uncompressed size, got %d bytes, %+v (%v)", len(payload), meta, err)
+	}
+	if got := testutil.ToFloat64(m.CacheCompressionBytesTotal.WithLabelValues("original")); got != float64(len(json)) {
+		t.Errorf("Expected %d original bytes counted, got %v", len(json), got)
+	}
+
+	// Payloads left uncompressed keep the envelope older replicas read
+	value, compressed, _ = c.encode(EntryMeta{}, []byte("short"))
+	if compressed || value[4] != envelopeVersion {
+		t.Errorf("Expected a small payload in a version 1 envelope, got version %d", value[4])
+	}
+}
@@ -0,0 +1,467 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiskConfig holds the local disk cache settings
+type DiskConfig struct {
+	// Dir holds the cached files; it is created if missing
+	Dir string
+	// MaxBytes caps the total size of cached files; least recently used
+	// entries are evicted to stay under it
+	MaxBytes int64
+	// TTL is how long entries are served; zero keeps them until evicted.
+	// Entries with their own TTL use that instead.
+	TTL time.Duration
+	// TTLJitter shortens each entry's TTL by a random share of up to this
+	// fraction of it
+	TTLJitter float64
+}
+
+// diskTmpDir holds partially written files so readers never see them
+const diskTmpDir = "tmp"
+
+// diskEntry is the index record of a cached file
+type diskEntry struct {
+	key      string
+	path     string
+	size     int64
+	storedAt time.Time
+}
+
+// DiskCache stores entries as files under a directory, with an in-memory
+// index ordered by use. Each file holds its key followed by an entry
+// envelope, so the index is rebuilt from the directory on startup; recency
+// is lost across restarts and entries are then ordered by write time.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+	// ttl expires entries stored without one, in nanoseconds
+	ttl       atomic.Int64
+	ttlJitter float64
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // of *diskEntry, most recently used first
+	size       int64
+	tombstones map[string]time.Time
+	// evictions counts entries dropped to stay under maxBytes
+	evictions int64
+}
+
+// Ensure DiskCache implements the cache interfaces
+var (
+	_ Cache      = (*DiskCache)(nil)
+	_ EntryCache = (*DiskCache)(nil)
+	_ Tombstoner = (*DiskCache)(nil)
+)
+
+// NewDiskCache opens the disk cache in cfg.Dir, indexing the entries
+// already there
+func NewDiskCache(cfg DiskConfig) (*DiskCache, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("disk cache directory is required")
+	}
+	if cfg.MaxBytes <= 0 {
+		return nil, fmt.Errorf("disk cache size must be positive, got %d", cfg.MaxBytes)
+	}
+	// Leftovers from interrupted writes are never valid entries
+	if err := os.RemoveAll(filepath.Join(cfg.Dir, diskTmpDir)); err != nil {
+		return nil, fmt.Errorf("failed to clean disk cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, diskTmpDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create disk cache directory: %w", err)
+	}
+
+	c := &DiskCache{
+		dir:        cfg.Dir,
+		maxBytes:   cfg.MaxBytes,
+		ttlJitter:  cfg.TTLJitter,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		tombstones: make(map[string]time.Time),
+	}
+	c.SetTTL(cfg.TTL)
+	if err := c.loadIndex(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// SetTTL changes the TTL of entries stored without one, including those
+// already stored
+func (c *DiskCache) SetTTL(ttl time.Duration) {
+	c.ttl.Store(int64(ttl))
+}
+
+// loadIndex indexes the files in the cache directory, oldest first so the
+// newest end up most recently used. Unreadable files are removed.
+func (c *DiskCache) loadIndex() error {
+	var found []*diskEntry
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == diskTmpDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key, err := readDiskKey(path)
+		if err != nil || c.path(key) != path {
+			slog.Warn("Removing unreadable disk cache file", "path", path, "error", err)
+			return os.Remove(path)
+		}
+		found = append(found, &diskEntry{key: key, path: path, size: info.Size(), storedAt: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index disk cache: %w", err)
+	}
+
+	slices.SortFunc(found, func(a, b *diskEntry) int { return a.storedAt.Compare(b.storedAt) })
+	for _, e := range found {
+		c.entries[e.key] = c.lru.PushFront(e)
+		c.size += e.size
+	}
+	return nil
+}
+
+// path returns where key is stored. Files are spread over 256 directories
+// by the first byte of the key's hash.
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+func (c *DiskCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return entry.Data, true, nil
+}
+
+// GetWithAge fetches the value and how long ago it was stored
+func (c *DiskCache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// GetEntry reads the entry for key and marks it most recently used
+func (c *DiskCache) GetEntry(ctx context.Context, key string) (*Entry, bool, error) {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false, nil
+	}
+	e := elem.Value.(*diskEntry)
+	c.lru.MoveToFront(elem)
+	path, storedAt := e.path, e.storedAt
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Evicted or deleted since the index lookup
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("disk cache read error: %w", err)
+	}
+	stored, payload, err := splitDiskFile(data)
+	if err != nil || stored != key {
+		return nil, false, fmt.Errorf("disk cache entry %s is corrupt", key)
+	}
+
+	meta, payload, _, err := decodeEnvelope(payload)
+	if err != nil {
+		return nil, false, fmt.Errorf("disk cache entry %s is corrupt: %w", key, err)
+	}
+	if !meta.StoredAt.IsZero() {
+		storedAt = meta.StoredAt
+	}
+	entry := &Entry{Data: payload, Meta: meta, Age: time.Since(storedAt)}
+	ttl := time.Duration(c.ttl.Load())
+	if meta.TTL > 0 {
+		ttl = meta.TTL
+	}
+	if ttl > 0 && entry.Age >= jitterTTL(ttl, c.ttlJitter, key, storedAt) {
+		c.expire(e)
+		return nil, false, nil
+	}
+	return entry, true, nil
+}
+
+// expire removes e unless its key has been rewritten since it was read
+func (c *DiskCache) expire(e *diskEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[e.key]; ok && elem.Value == e {
+		c.removeLocked(elem)
+	}
+}
+
+// SetEntry stores data wrapped in an envelope carrying meta
+func (c *DiskCache) SetEntry(ctx context.Context, key string, data []byte, meta EntryMeta) error {
+	if meta.Size == 0 {
+		meta.Size = int64(len(data))
+	}
+	if meta.StoredAt.IsZero() {
+		meta.StoredAt = time.Now().UTC()
+	}
+
+	envelope, err := encodeEnvelope(meta, data)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	return c.Set(ctx, key, envelope)
+}
+
+// Set writes data for key, evicting least recently used entries to make
+// room. It returns ErrTombstoned, storing nothing, while key is tombstoned.
+func (c *DiskCache) Set(ctx context.Context, key string, data []byte) error {
+	if len(key) > math.MaxUint16 {
+		return fmt.Errorf("key of %d bytes is too long for the disk cache", len(key))
+	}
+	size := int64(2 + len(key) + len(data))
+	if size > c.maxBytes {
+		return fmt.Errorf("entry of %d bytes exceeds the disk cache size of %d bytes", size, c.maxBytes)
+	}
+	if c.tombstoned(key) {
+		return ErrTombstoned
+	}
+
+	tmp, err := c.writeTemp(key, data)
+	if err != nil {
+		return fmt.Errorf("disk cache write error: %w", err)
+	}
+
+	path := c.path(key)
+	c.mu.Lock()
+	// Re-check under the lock so a racing Tombstone wins
+	if c.tombstonedLocked(key) {
+		c.mu.Unlock()
+		removeFiles([]string{tmp})
+		return ErrTombstoned
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		c.mu.Unlock()
+		removeFiles([]string{tmp})
+		return fmt.Errorf("disk cache write error: %w", err)
+	}
+	if elem, ok := c.entries[key]; ok {
+		// The file was replaced by the rename, so only the index changes
+		c.size -= elem.Value.(*diskEntry).size
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&diskEntry{key: key, path: path, size: size, storedAt: time.Now()})
+	c.size += size
+	c.evictLocked()
+	c.mu.Unlock()
+	return nil
+}
+
+// writeTemp writes the file contents for key to a temporary file
+func (c *DiskCache) writeTemp(key string, data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Join(c.dir, diskTmpDir), "entry-*")
+	if err != nil {
+		return "", err
+	}
+	header := binary.BigEndian.AppendUint16(nil, uint16(len(key)))
+	_, err = f.Write(append(header, key...))
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeFiles([]string{f.Name()})
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// evictLocked drops least recently used entries until the cache fits
+func (c *DiskCache) evictLocked() {
+	for c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// removeLocked drops an entry and its file. Files are removed under the lock
+// so a concurrent Set of the same key can't have its new file deleted.
+func (c *DiskCache) removeLocked(elem *list.Element) {
+	e := elem.Value.(*diskEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	removeFiles([]string{e.path})
+}
+
+// Delete removes keys and their tombstones
+func (c *DiskCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deleted int64
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.removeLocked(elem)
+			deleted++
+		}
+		delete(c.tombstones, key)
+	}
+	return deleted, nil
+}
+
+// DeletePrefix removes every key starting with prefix, and their tombstones
+func (c *DiskCache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deleted int64
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.removeLocked(elem)
+			deleted++
+		}
+	}
+	for key := range c.tombstones {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.tombstones, key)
+		}
+	}
+	return deleted, nil
+}
+
+// Tombstone removes key and blocks writes to it until ttl passes
+func (c *DiskCache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("tombstone TTL must be positive, got %s", ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, expires := range c.tombstones {
+		if now.After(expires) {
+			delete(c.tombstones, k)
+		}
+	}
+	c.tombstones[key] = now.Add(ttl)
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+	return nil
+}
+
+func (c *DiskCache) tombstoned(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tombstonedLocked(key)
+}
+
+func (c *DiskCache) tombstonedLocked(key string) bool {
+	expires, ok := c.tombstones[key]
+	if ok && time.Now().After(expires) {
+		delete(c.tombstones, key)
+		return false
+	}
+	return ok
+}
+
+// Size returns the total size of the cached files
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Ping checks the cache directory is still usable
+func (c *DiskCache) Ping(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(c.dir, diskTmpDir)); err != nil {
+		return fmt.Errorf("disk cache unavailable: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op; entries stay on disk for the next start
+func (c *DiskCache) Close() error {
+	return nil
+}
+
+// readDiskKey reads the key at the start of a cache file
+func readDiskKey(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var n uint16
+	if err := binary.Read(f, binary.BigEndian, &n); err != nil {
+		return "", err
+	}
+	key := make([]byte, n)
+	if _, err := io.ReadFull(f, key); err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// splitDiskFile separates the key from the stored value
+func splitDiskFile(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(data[2 : 2+n]), data[2+n:], nil
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to remove disk cache file", "path", path, "error", err)
+		}
+	}
+}
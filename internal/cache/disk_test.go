@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestDiskCache(t *testing.T, dir string, maxBytes int64) *DiskCache {
+	t.Helper()
+	c, err := NewDiskCache(DiskConfig{Dir: dir, MaxBytes: maxBytes})
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+	return c
+}
+
+func TestDiskCache_SetGet(t *testing.T) {
+	ctx := context.Background()
+	c := newTestDiskCache(t, t.TempDir(), 1024)
+
+	meta := EntryMeta{ContentType: "text/plain", Headers: map[string]string{"Content-Language": "de"}}
+	if err := c.SetEntry(ctx, "a.txt", []byte("hello"), meta); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+
+	entry, found, err := c.GetEntry(ctx, "a.txt")
+	if err != nil || !found {
+		t.Fatalf("Expected a hit, got found=%v err=%v", found, err)
+	}
+	if string(entry.Data) != "hello" || entry.Meta.ContentType != "text/plain" || entry.Meta.Headers["Content-Language"] != "de" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	if _, found, _ := c.Get(ctx, "missing.txt"); found {
+		t.Error("Expected a miss for an unknown key")
+	}
+}
+
+func TestDiskCache_ObjectTTL(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewDiskCache(DiskConfig{Dir: t.TempDir(), MaxBytes: 1024, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+
+	// An object's own TTL outlasts the configured one
+	stored := time.Now().Add(-time.Hour).UTC()
+	if err := c.SetEntry(ctx, "long.txt", []byte("a"), EntryMeta{StoredAt: stored, TTL: 2 * time.Hour}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+	if _, found, _ := c.GetEntry(ctx, "long.txt"); !found {
+		t.Error("Expected an entry within its own TTL to be served")
+	}
+
+	// And can be shorter
+	if err := c.SetEntry(ctx, "short.txt", []byte("b"), EntryMeta{StoredAt: stored, TTL: time.Second}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+	if _, found, _ := c.GetEntry(ctx, "short.txt"); found {
+		t.Error("Expected an entry past its own TTL to be a miss")
+	}
+	c.mu.Lock()
+	_, indexed := c.entries["short.txt"]
+	c.mu.Unlock()
+	if indexed {
+		t.Error("Expected the expired entry to be removed")
+	}
+}
+
+func TestDiskCache_TTLJitter(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewDiskCache(DiskConfig{Dir: t.TempDir(), MaxBytes: 4096, TTL: time.Hour, TTLJitter: 0.5})
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+
+	// Entries warmed together expire anywhere in the last half of the TTL
+	stored := time.Now().Add(-45 * time.Minute).UTC()
+	expired := 0
+	for i := range 20 {
+		key := fmt.Sprintf("warm/%d.txt", i)
+		if err := c.SetEntry(ctx, key, []byte("x"), EntryMeta{StoredAt: stored}); err != nil {
+			t.Fatalf("SetEntry failed: %v", err)
+		}
+		_, found, _ := c.GetEntry(ctx, key)
+		if want := jitterTTL(time.Hour, 0.5, key, stored) > 45*time.Minute; found != want {
+			t.Errorf("Expected %s found to be %v", key, want)
+		}
+		if !found {
+			expired++
+		}
+	}
+	if expired == 0 || expired == 20 {
+		t.Errorf("Expected some but not all entries to have expired, %d did", expired)
+	}
+}
+
+func TestDiskCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	// Each entry takes 2 + 5 + 100 bytes
+	c := newTestDiskCache(t, t.TempDir(), 250)
+	data := bytes.Repeat([]byte("x"), 100)
+
+	for _, key := range []string{"a.bin", "b.bin"} {
+		if err := c.Set(ctx, key, data); err != nil {
+			t.Fatalf("Set %s failed: %v", key, err)
+		}
+	}
+	// Touch a.bin so b.bin is the least recently used
+	if _, found, _ := c.Get(ctx, "a.bin"); !found {
+		t.Fatal("Expected a.bin to be cached")
+	}
+	if err := c.Set(ctx, "c.bin", data); err != nil {
+		t.Fatalf("Set c.bin failed: %v", err)
+	}
+
+	if _, found, _ := c.Get(ctx, "b.bin"); found {
+		t.Error("Expected b.bin to be evicted")
+	}
+	for _, key := range []string{"a.bin", "c.bin"} {
+		if _, found, _ := c.Get(ctx, key); !found {
+			t.Errorf("Expected %s to remain cached", key)
+		}
+	}
+	if c.Size() > 250 {
+		t.Errorf("Expected size within the cap, got %d", c.Size())
+	}
+
+	if err := c.Set(ctx, "huge.bin", bytes.Repeat([]byte("x"), 300)); err == nil {
+		t.Error("Expected an error for an entry larger than the cache")
+	}
+}
+
+func TestDiskCache_ReloadsIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := newTestDiskCache(t, dir, 1024)
+	if err := c.Set(ctx, "reports/a.pdf", []byte("pdf")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	reopened := newTestDiskCache(t, dir, 1024)
+	data, found, err := reopened.Get(ctx, "reports/a.pdf")
+	if err != nil || !found || string(data) != "pdf" {
+		t.Fatalf("Expected the entry to survive a restart, got %q found=%v err=%v", data, found, err)
+	}
+	if reopened.Size() != c.Size() {
+		t.Errorf("Expected size %d after reload, got %d", c.Size(), reopened.Size())
+	}
+
+	if n, err := reopened.DeletePrefix(ctx, "reports/"); err != nil || n != 1 {
+		t.Errorf("Expected 1 key deleted, got %d (%v)", n, err)
+	}
+	if _, found, _ := newTestDiskCache(t, dir, 1024).Get(ctx, "reports/a.pdf"); found {
+		t.Error("Expected the deleted entry to stay gone after a restart")
+	}
+}
+
+func TestDiskCache_Tombstone(t *testing.T) {
+	ctx := context.Background()
+	c := newTestDiskCache(t, t.TempDir(), 1024)
+	if err := c.Set(ctx, "a.txt", []byte("a")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if err := c.Tombstone(ctx, "a.txt", time.Minute); err != nil {
+		t.Fatalf("Tombstone failed: %v", err)
+	}
+	if _, found, _ := c.Get(ctx, "a.txt"); found {
+		t.Error("Expected a miss for a tombstoned key")
+	}
+	if err := c.Set(ctx, "a.txt", []byte("a")); !errors.Is(err, ErrTombstoned) {
+		t.Errorf("Expected ErrTombstoned, got %v", err)
+	}
+
+	if _, err := c.Delete(ctx, "a.txt"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := c.Set(ctx, "a.txt", []byte("a")); err != nil {
+		t.Errorf("Expected Set to succeed after Delete, got %v", err)
+	}
+}
+
+func TestDiskCache_SampleKeys(t *testing.T) {
+	ctx := context.Background()
+	c := newTestDiskCache(t, t.TempDir(), 1024)
+	for _, key := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := c.Set(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	keys, err := c.SampleKeys(ctx, 2)
+	if err != nil {
+		t.Fatalf("SampleKeys failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0] == keys[1] {
+		t.Errorf("Expected two distinct keys, got %v", keys)
+	}
+	if keys, _ := c.SampleKeys(ctx, 10); len(keys) != 3 {
+		t.Errorf("Expected every key when sampling more than the cache holds, got %v", keys)
+	}
+}
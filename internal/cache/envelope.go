@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntryFormat identifies how a cache value is laid out
+type EntryFormat string
+
+const (
+	FormatLegacy   EntryFormat = "legacy"   // Raw file bytes
+	FormatEnvelope EntryFormat = "envelope" // Metadata header followed by the payload
+)
+
+// Envelope layout: magic | version (1 byte) | header length (uint32 BE) | JSON header | payload.
+// Version 2 adds a flags byte after the version naming the codec the payload
+// is compressed with; uncompressed payloads keep version 1, which replicas
+// predating compression can read.
+var envelopeMagic = []byte{0x00, 'F', 'C', 'E'}
+
+const (
+	envelopeVersion        byte = 1
+	envelopeVersionFlagged byte = 2
+	envelopePrefixSize          = 4 + 1 + 4
+)
+
+// EntryMeta is the metadata stored alongside a cached payload
+type EntryMeta struct {
+	ContentType string    `json:"content_type,omitempty"`
+	ETag        string    `json:"etag,omitempty"`
+	Size        int64     `json:"size"`
+	StoredAt    time.Time `json:"stored_at"`
+	// LastModified is the object's Last-Modified date in HTTP format
+	LastModified string `json:"last_modified,omitempty"`
+	// Headers are object headers replayed on responses served from the entry
+	Headers map[string]string `json:"headers,omitempty"`
+	// Tombstone marks a deleted key; see Tombstoner
+	Tombstone bool `json:"tombstone,omitempty"`
+	// TTL is how long the entry is served, set by the object's cache-ttl
+	// metadata; zero uses the cache's configured TTL
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Blob is the key of the entry holding the payload when it is stored
+	// once by content hash; the entry itself then has no payload
+	Blob string `json:"blob,omitempty"`
+	// Chunks lists the entries holding the payload when it is split into
+	// chunks; the entry itself then has no payload
+	Chunks *ChunkManifest `json:"chunks,omitempty"`
+}
+
+// ChunkManifest describes a payload stored as chunks under the keys
+// ChunkKey returns
+type ChunkManifest struct {
+	// ID tells the chunks of one write from those of another
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+	// Size is the size of every chunk but the last
+	Size int64 `json:"size"`
+}
+
+// ChunkKey returns the cache key of chunk i of the payload of key
+func (m *ChunkManifest) ChunkKey(key string, i int) string {
+	return VariantKey(key, "part:"+m.ID+":"+strconv.Itoa(i))
+}
+
+// ObjectTTLMetadata is the user metadata key an object's producer sets to
+// control how long it is cached, e.g. x-amz-meta-cache-ttl: 1h
+const ObjectTTLMetadata = "cache-ttl"
+
+// ParseObjectTTL parses a cache-ttl metadata value: a duration such as "90s"
+// or "1h", or a whole number of seconds
+func ParseObjectTTL(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseInt(value, 10, 64)
+		if convErr != nil || seconds > int64(math.MaxInt64/time.Second) {
+			return 0, fmt.Errorf("invalid cache TTL %q: expected a duration or a number of seconds", value)
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("invalid cache TTL %q: must be positive", value)
+	}
+	return ttl, nil
+}
+
+// MetaFromHeaders builds entry metadata from the headers stored with an
+// object. Multi-valued headers keep their first value.
+func MetaFromHeaders(h http.Header) EntryMeta {
+	meta := EntryMeta{
+		ContentType:  h.Get("Content-Type"),
+		ETag:         h.Get("ETag"),
+		LastModified: h.Get("Last-Modified"),
+	}
+	// An invalid TTL is ignored so the object is still cached with the default
+	if ttl, err := ParseObjectTTL(h.Get("X-Amz-Meta-" + ObjectTTLMetadata)); err == nil {
+		meta.TTL = ttl
+	}
+	if len(h) > 0 {
+		meta.Headers = make(map[string]string, len(h))
+		for name := range h {
+			meta.Headers[name] = h.Get(name)
+		}
+	}
+	return meta
+}
+
+// encodeEnvelope wraps payload with its metadata
+func encodeEnvelope(meta EntryMeta, payload []byte) ([]byte, error) {
+	return encodeFlaggedEnvelope(meta, payload, 0)
+}
+
+// encodeFlaggedEnvelope wraps payload with its metadata and flags, the
+// codec payload is compressed with or 0
+func encodeFlaggedEnvelope(meta EntryMeta, payload []byte, flags byte) ([]byte, error) {
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, envelopePrefixSize+1+len(header)+len(payload))
+	buf = append(buf, envelopeMagic...)
+	if flags == 0 {
+		buf = append(buf, envelopeVersion)
+	} else {
+		buf = append(buf, envelopeVersionFlagged, flags)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(header)))
+	buf = append(buf, header...)
+	buf = append(buf, payload...)
+	return buf, nil
+}
+
+// decodeEnvelope splits an envelope into metadata and payload, decompressing
+// the payload. ok is false for legacy raw values, which callers should treat
+// as the payload itself; err reports an envelope whose payload is corrupt.
+func decodeEnvelope(data []byte) (meta EntryMeta, payload []byte, ok bool, err error) {
+	if len(data) < envelopePrefixSize || !bytes.Equal(data[:4], envelopeMagic) {
+		return EntryMeta{}, data, false, nil
+	}
+	var flags byte
+	prefix := data[4:]
+	switch data[4] {
+	case envelopeVersion:
+	case envelopeVersionFlagged:
+		flags, prefix = data[5], data[5:]
+	default:
+		return EntryMeta{}, data, false, nil
+	}
+	if len(prefix) < envelopePrefixSize-4 {
+		return EntryMeta{}, data, false, nil
+	}
+
+	headerLen := int(binary.BigEndian.Uint32(prefix[1:5]))
+	if headerLen > len(prefix)-5 {
+		return EntryMeta{}, data, false, nil
+	}
+
+	if err := json.Unmarshal(prefix[5:5+headerLen], &meta); err != nil {
+		return EntryMeta{}, data, false, nil
+	}
+	payload = prefix[5+headerLen:]
+	if flags != 0 {
+		if payload, err = decompress(flags, payload); err != nil {
+			return meta, nil, true, fmt.Errorf("failed to decompress cache entry: %w", err)
+		}
+	}
+	return meta, payload, true, nil
+}
+
+// DetectFormat reports whether a raw cache value is a legacy or envelope entry
+func DetectFormat(data []byte) EntryFormat {
+	if _, _, ok, _ := decodeEnvelope(data); ok {
+		return FormatEnvelope
+	}
+	return FormatLegacy
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	meta := EntryMeta{
+		ContentType: "application/pdf",
+		ETag:        `"abc"`,
+		Size:        7,
+		StoredAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Headers:     map[string]string{"Content-Language": "de"},
+	}
+
+	data, err := encodeEnvelope(meta, []byte("payload"))
+	if err != nil {
+		t.Fatalf("encodeEnvelope failed: %v", err)
+	}
+	if DetectFormat(data) != FormatEnvelope {
+		t.Error("Expected envelope format")
+	}
+
+	got, payload, ok, err := decodeEnvelope(data)
+	if !ok || err != nil {
+		t.Fatal("Expected envelope to decode")
+	}
+	if !bytes.Equal(payload, []byte("payload")) {
+		t.Errorf("Expected payload 'payload', got '%s'", payload)
+	}
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("Expected meta %+v, got %+v", meta, got)
+	}
+}
+
+func TestEnvelope_LegacyPassthrough(t *testing.T) {
+	for _, raw := range [][]byte{
+		[]byte("plain file content"),
+		{},
+		// Magic without a valid header must not be mistaken for an envelope
+		append(append([]byte{}, envelopeMagic...), envelopeVersion, 0xff, 0xff, 0xff, 0xff),
+		append(append([]byte{}, envelopeMagic...), envelopeVersionFlagged, 1, 0, 0, 0),
+	} {
+		if DetectFormat(raw) != FormatLegacy {
+			t.Errorf("Expected legacy format for %q", raw)
+		}
+		_, payload, ok, err := decodeEnvelope(raw)
+		if ok || err != nil || !bytes.Equal(payload, raw) {
+			t.Errorf("Expected raw passthrough for %q", raw)
+		}
+	}
+}
+
+func TestMetaFromHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "text/html")
+	h.Set("ETag", `"v1"`)
+	h.Set("Content-Language", "fr")
+
+	meta := MetaFromHeaders(h)
+	if meta.ContentType != "text/html" || meta.ETag != `"v1"` {
+		t.Errorf("Unexpected meta: %+v", meta)
+	}
+	if meta.Headers["Content-Language"] != "fr" {
+		t.Errorf("Expected Content-Language in headers, got %v", meta.Headers)
+	}
+	if MetaFromHeaders(nil).Headers != nil {
+		t.Error("Expected no headers for an empty header set")
+	}
+}
+
+func TestParseObjectTTL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"90s", 90 * time.Second},
+		{"1h", time.Hour},
+		{" 3600 ", time.Hour},
+		{"", 0},
+		{"0", 0},
+		{"-5m", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseObjectTTL(tt.value)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("ParseObjectTTL(%q) = %s, expected an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseObjectTTL(%q) = %s, %v; want %s", tt.value, got, err, tt.want)
+		}
+	}
+
+	h := http.Header{}
+	h.Set("X-Amz-Meta-Cache-Ttl", "10m")
+	if meta := MetaFromHeaders(h); meta.TTL != 10*time.Minute {
+		t.Errorf("Expected TTL from cache-ttl metadata, got %s", meta.TTL)
+	}
+	h.Set("X-Amz-Meta-Cache-Ttl", "never")
+	if meta := MetaFromHeaders(h); meta.TTL != 0 {
+		t.Errorf("Expected an invalid TTL to be ignored, got %s", meta.TTL)
+	}
+}
+
+func TestTombstone_Encoding(t *testing.T) {
+	meta, payload, ok, _ := decodeEnvelope(tombstone)
+	if !ok || !meta.Tombstone || len(payload) != 0 {
+		t.Errorf("Expected an empty tombstone envelope, got meta %+v payload %q ok %v", meta, payload, ok)
+	}
+
+	// Set compares stored values to the tombstone byte for byte
+	again, err := encodeEnvelope(EntryMeta{Tombstone: true}, nil)
+	if err != nil || !bytes.Equal(again, tombstone) {
+		t.Error("Expected the tombstone encoding to be stable")
+	}
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fillLockKeyPrefix prefixes the Redis keys holding fill locks. File names
+// can't start with '#', so these can't collide with entries.
+const fillLockKeyPrefix = variantSeparator + "filllock:"
+
+// releaseFillLock deletes the lock in KEYS[1] if it still holds this
+// holder's token (ARGV[1]), so a lock that expired and was taken by another
+// replica isn't released by the first
+var releaseFillLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// FillLock keeps the replicas of a deployment from fetching the same key
+// from the origin at once after a cache miss
+type FillLock interface {
+	// TryLock takes the lock on key until unlock is called or ttl passes.
+	// ok is false when another replica holds it. unlock may be called more
+	// than once.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+// Ensure RedisCache implements FillLock
+var _ FillLock = (*RedisCache)(nil)
+
+// TryLock takes the lock with SET NX. Nothing is locked while the circuit
+// breaker is open, so callers fall back to fetching themselves.
+func (c *RedisCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	rand.Read(token)
+	value := hex.EncodeToString(token)
+	lockKey := fillLockKeyPrefix + key
+
+	var ok bool
+	err := c.withRetry(ctx, func() (err error) {
+		ok, err = c.client.SetNX(ctx, lockKey, value, ttl).Result()
+		return err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("redis fill lock error: %w", err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			// The lock is released after the request that took it is done
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := releaseFillLock.Run(releaseCtx, c.client, []string{lockKey}, value).Err(); err != nil {
+				slog.WarnContext(ctx, "Failed to release fill lock", "key", key, "error", err)
+			}
+		})
+	}
+	return unlock, true, nil
+}
+
+// isInternalKey reports whether a key found by scanning holds a namespace
+// generation or a fill lock rather than an entry
+func isInternalKey(key string) bool {
+	return isGenerationKey(key) || strings.HasPrefix(key, fillLockKeyPrefix)
+}
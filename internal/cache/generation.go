@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// generationKeyPrefix prefixes the Redis keys holding namespace generations.
+// File names can't start with '#', so these can't collide with entries.
+const generationKeyPrefix = variantSeparator + "generation:"
+
+// maxGenerations caps the namespace generations remembered locally
+const maxGenerations = 10000
+
+// bumpGeneration moves the generation in KEYS[1] to the current time in ms
+// (ARGV[1]), or one past its value if that is later. Using the clock rather
+// than a counter means a generation key lost to eviction can't be bumped
+// back to a generation whose entries are still stored.
+var bumpGeneration = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local next = tonumber(ARGV[1])
+if next <= current then
+	next = current + 1
+end
+redis.call("SET", KEYS[1], next)
+return next
+`)
+
+// cachedGeneration is a namespace generation as last read from Redis
+type cachedGeneration struct {
+	value   int64
+	fetched time.Time
+}
+
+// namespaceOf returns the first depth path segments of key, including the
+// trailing slash. ok is false for keys with fewer segments, which aren't in
+// any namespace.
+func namespaceOf(key string, depth int) (ns string, ok bool) {
+	end := 0
+	for range depth {
+		i := strings.IndexByte(key[end:], '/')
+		if i < 0 {
+			return "", false
+		}
+		end += i + 1
+	}
+	return key[:end], depth > 0
+}
+
+// generationalKey inserts the generation of namespace ns into key. Keys at
+// generation zero are left as they are, so entries written before the first
+// flush stay readable.
+func generationalKey(key, ns string, gen int64) string {
+	if gen == 0 {
+		return key
+	}
+	return ns + variantSeparator + strconv.FormatInt(gen, 36) + "/" + key[len(ns):]
+}
+
+// storedKey returns the Redis key holding key's entry
+func (c *RedisCache) storedKey(ctx context.Context, key string) (string, error) {
+	ns, ok := namespaceOf(key, c.namespaceDepth)
+	if !ok {
+		return key, nil
+	}
+	gen, err := c.generation(ctx, ns, false)
+	if err != nil {
+		return "", err
+	}
+	return generationalKey(key, ns, gen), nil
+}
+
+// storedKeys maps keys to the Redis keys holding their entries
+func (c *RedisCache) storedKeys(ctx context.Context, keys []string) ([]string, error) {
+	if c.namespaceDepth == 0 {
+		return keys, nil
+	}
+	stored := make([]string, len(keys))
+	for i, key := range keys {
+		var err error
+		if stored[i], err = c.storedKey(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// generation returns the current generation of namespace ns. Generations
+// read within the refresh interval are reused unless fresh is set.
+func (c *RedisCache) generation(ctx context.Context, ns string, fresh bool) (int64, error) {
+	now := time.Now()
+	if !fresh && c.generationRefresh > 0 {
+		c.genMu.Lock()
+		cached, ok := c.generations[ns]
+		c.genMu.Unlock()
+		if ok && now.Sub(cached.fetched) < c.generationRefresh {
+			return cached.value, nil
+		}
+	}
+
+	var gen int64
+	err := c.withRetry(ctx, func() (err error) {
+		gen, err = c.client.Get(ctx, generationKeyPrefix+ns).Int64()
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("redis generation error: %w", err)
+	}
+	c.rememberGeneration(ns, gen, now)
+	return gen, nil
+}
+
+// rememberGeneration caches gen for ns until the refresh interval passes
+func (c *RedisCache) rememberGeneration(ns string, gen int64, now time.Time) {
+	if c.generationRefresh <= 0 {
+		return
+	}
+	c.genMu.Lock()
+	defer c.genMu.Unlock()
+	if _, ok := c.generations[ns]; !ok && len(c.generations) >= maxGenerations {
+		for other, cached := range c.generations {
+			if now.Sub(cached.fetched) >= c.generationRefresh {
+				delete(c.generations, other)
+			}
+		}
+		if len(c.generations) >= maxGenerations {
+			return
+		}
+	}
+	c.generations[ns] = cachedGeneration{value: gen, fetched: now}
+}
+
+// flushNamespace invalidates every entry in namespace ns by moving it to a
+// new generation. Old entries are no longer read and expire with their TTL.
+// Other replicas notice within the generation refresh interval.
+func (c *RedisCache) flushNamespace(ctx context.Context, ns string) error {
+	var gen int64
+	err := c.withRetry(ctx, func() (err error) {
+		gen, err = bumpGeneration.Run(ctx, c.client, []string{generationKeyPrefix + ns}, time.Now().UnixMilli()).Int64()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("redis generation error: %w", err)
+	}
+	c.rememberGeneration(ns, gen, time.Now())
+	c.metrics.CacheNamespaceFlushesTotal.Inc()
+	slog.InfoContext(ctx, "Cache namespace flushed", "namespace", ns, "generation", gen)
+	return nil
+}
+
+// isGenerationKey reports whether a key found by scanning holds a namespace
+// generation rather than an entry
+func isGenerationKey(key string) bool {
+	return strings.HasPrefix(key, generationKeyPrefix)
+}
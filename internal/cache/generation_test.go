@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNamespaceOf(t *testing.T) {
+	tests := []struct {
+		key    string
+		depth  int
+		wantNS string
+		wantOK bool
+	}{
+		{"images/2024/cat.png", 1, "images/", true},
+		{"images/2024/cat.png", 2, "images/2024/", true},
+		{"images/2024/cat.png", 3, "", false},
+		{"images/", 1, "images/", true},
+		{"images", 1, "", false},
+		{"readme.txt", 1, "", false},
+		{"images/cat.png", 0, "", false},
+	}
+	for _, tt := range tests {
+		ns, ok := namespaceOf(tt.key, tt.depth)
+		if ns != tt.wantNS || ok != tt.wantOK {
+			t.Errorf("namespaceOf(%q, %d) = %q, %v; want %q, %v", tt.key, tt.depth, ns, ok, tt.wantNS, tt.wantOK)
+		}
+	}
+}
+
+func TestGenerationalKey(t *testing.T) {
+	if got := generationalKey("images/cat.png", "images/", 0); got != "images/cat.png" {
+		t.Errorf("Expected generation zero to keep the key, got %q", got)
+	}
+
+	gen := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	key := generationalKey("images/cat.png", "images/", gen)
+	if key == "images/cat.png" || key[:len("images/")] != "images/" {
+		t.Errorf("Expected the generation after the namespace, got %q", key)
+	}
+	if other := generationalKey("images/cat.png", "images/", gen+1); other == key {
+		t.Error("Expected generations to give different keys")
+	}
+
+	// Prefixes within a namespace map like keys, so scans still find them
+	prefix := generationalKey("images/ca", "images/", gen)
+	if key[:len(prefix)] != prefix {
+		t.Errorf("Expected %q to start with %q", key, prefix)
+	}
+	if !isGenerationKey(generationKeyPrefix + "images/") {
+		t.Error("Expected the generation key to be recognized")
+	}
+
+	// Sampled keys map back to the key they were stored for
+	c := &RedisCache{namespaceDepth: 1}
+	for _, stored := range []string{key, "images/cat.png"} {
+		if got := c.logicalKey(stored); got != "images/cat.png" {
+			t.Errorf("logicalKey(%q) = %q, want images/cat.png", stored, got)
+		}
+	}
+	if got := c.logicalKey("top.png"); got != "top.png" {
+		t.Errorf("Expected keys outside namespaces to be kept, got %q", got)
+	}
+}
+
+func TestRememberGeneration(t *testing.T) {
+	c := &RedisCache{generationRefresh: time.Minute, generations: make(map[string]cachedGeneration)}
+	now := time.Now()
+	for i := range maxGenerations {
+		c.rememberGeneration(strconv.Itoa(i)+"/", 1, now.Add(-2*time.Minute))
+	}
+
+	// Stale generations make room for new ones
+	c.rememberGeneration("images/", 7, now)
+	if got := c.generations["images/"]; got.value != 7 {
+		t.Errorf("Expected generation 7 to be remembered, got %+v", got)
+	}
+	if len(c.generations) != 1 {
+		t.Errorf("Expected stale generations to be dropped, %d left", len(c.generations))
+	}
+}
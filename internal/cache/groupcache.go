@@ -0,0 +1,306 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache"
+)
+
+// groupName is the groupcache group holding files
+const groupName = "files"
+
+// LoadFunc fetches key from the origin for the group cache. found is false
+// when the key doesn't exist there.
+type LoadFunc func(ctx context.Context, key string) (data []byte, meta EntryMeta, found bool, err error)
+
+// GroupConfig holds the peer-to-peer cache settings
+type GroupConfig struct {
+	// Self is this replica's base URL as its peers reach it,
+	// e.g. http://10.0.0.5:8081
+	Self string
+	// CacheBytes caps the memory used for entries on this replica
+	CacheBytes int64
+	// TTL is how long entries are served; zero keeps them until evicted.
+	// Groupcache can't expire or delete entries, so keys are rotated every
+	// TTL instead, which needs the replicas' clocks to roughly agree.
+	TTL time.Duration
+	// Load fetches missing keys; it runs on the replica that owns the key
+	Load LoadFunc
+}
+
+// errGroupMiss is returned by the group's getter for keys the origin
+// doesn't have, so nothing is cached for them
+var errGroupMiss = errors.New("not found in origin")
+
+var (
+	groupMu      sync.Mutex
+	groupCreated bool
+)
+
+// GroupCache is a read-through cache shared by the replicas of a
+// deployment. Each key is owned by one replica, picked by consistent
+// hashing, which loads it from the origin once however many replicas ask.
+//
+// Entries are loaded rather than written, so Set is a no-op, and they are
+// immutable: Delete and DeletePrefix can't remove them, and a changed file
+// is only picked up when its key rotates after TTL.
+type GroupCache struct {
+	group *groupcache.Group
+	pool  *groupcache.HTTPPool
+	self  string
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	peers []string
+}
+
+// Ensure GroupCache implements the cache interfaces
+var (
+	_ Cache        = (*GroupCache)(nil)
+	_ EntryCache   = (*GroupCache)(nil)
+	_ http.Handler = (*GroupCache)(nil)
+)
+
+// NewGroupCache creates the group cache. Groupcache keeps its state in
+// package globals, so only one can be created per process.
+func NewGroupCache(cfg GroupConfig) (*GroupCache, error) {
+	if cfg.Load == nil {
+		return nil, errors.New("group cache loader is required")
+	}
+	if cfg.CacheBytes <= 0 {
+		return nil, fmt.Errorf("group cache size must be positive, got %d", cfg.CacheBytes)
+	}
+	if _, err := peerURL(cfg.Self); err != nil {
+		return nil, fmt.Errorf("invalid group cache self URL: %w", err)
+	}
+
+	groupMu.Lock()
+	defer groupMu.Unlock()
+	if groupCreated {
+		return nil, errors.New("group cache already created")
+	}
+	groupCreated = true
+
+	c := &GroupCache{
+		pool:  groupcache.NewHTTPPoolOpts(cfg.Self, nil),
+		self:  cfg.Self,
+		ttl:   cfg.TTL,
+		peers: []string{cfg.Self},
+	}
+	c.pool.Set(c.peers...)
+	c.group = groupcache.NewGroup(groupName, cfg.CacheBytes, groupcache.GetterFunc(
+		func(ctx context.Context, key string, dest groupcache.Sink) error {
+			_, name, _ := strings.Cut(key, "/")
+			data, meta, found, err := cfg.Load(ctx, name)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return errGroupMiss
+			}
+			if meta.Size == 0 {
+				meta.Size = int64(len(data))
+			}
+			if meta.StoredAt.IsZero() {
+				meta.StoredAt = time.Now()
+			}
+			value, err := encodeEnvelope(meta, data)
+			if err != nil {
+				return fmt.Errorf("failed to encode cache entry: %w", err)
+			}
+			return dest.SetBytes(value)
+		},
+	))
+	return c, nil
+}
+
+// groupKey is the key's name in the group for the current TTL period
+func (c *GroupCache) groupKey(key string) string {
+	var period int64
+	if c.ttl > 0 {
+		period = time.Now().UnixNano() / int64(c.ttl)
+	}
+	return strconv.FormatInt(period, 10) + "/" + key
+}
+
+// GetEntry returns the entry for key, loading it through its owner. A key
+// missing from the origin is reported as a miss.
+func (c *GroupCache) GetEntry(ctx context.Context, key string) (*Entry, bool, error) {
+	var value []byte
+	if err := c.group.Get(ctx, c.groupKey(key), groupcache.AllocatingByteSliceSink(&value)); err != nil {
+		if errors.Is(err, errGroupMiss) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("group cache get error: %w", err)
+	}
+
+	meta, payload, _, err := decodeEnvelope(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Entry{Data: payload, Meta: meta, Age: time.Since(meta.StoredAt)}, true, nil
+}
+
+// Get retrieves data for key
+func (c *GroupCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found {
+		return nil, false, err
+	}
+	return entry.Data, true, nil
+}
+
+// GetWithAge retrieves data for key along with its age
+func (c *GroupCache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found {
+		return nil, 0, false, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// Set does nothing; entries are loaded by the replica that owns them
+func (c *GroupCache) Set(ctx context.Context, key string, data []byte) error {
+	return nil
+}
+
+// SetEntry does nothing; entries are loaded by the replica that owns them
+func (c *GroupCache) SetEntry(ctx context.Context, key string, data []byte, meta EntryMeta) error {
+	return nil
+}
+
+// Delete removes nothing, as group cache entries are immutable
+func (c *GroupCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return 0, nil
+}
+
+// DeletePrefix removes nothing, as group cache entries are immutable
+func (c *GroupCache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	return 0, nil
+}
+
+// Ping always succeeds; unreachable peers are bypassed by loading locally
+func (c *GroupCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing; the group lives as long as the process
+func (c *GroupCache) Close() error {
+	return nil
+}
+
+// ServeHTTP answers peers' requests for keys this replica owns. It should
+// be served on a listener only peers can reach, as it bypasses
+// authentication and request policies.
+func (c *GroupCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.pool.ServeHTTP(w, r)
+}
+
+// SetPeers replaces the replicas sharing the cache. This replica is always
+// included.
+func (c *GroupCache) SetPeers(peers ...string) {
+	peers = append([]string{c.self}, peers...)
+	slices.Sort(peers)
+	peers = slices.Compact(peers)
+
+	c.mu.Lock()
+	changed := !slices.Equal(peers, c.peers)
+	c.peers = peers
+	c.mu.Unlock()
+
+	if changed {
+		c.pool.Set(peers...)
+		slog.Info("Group cache peers changed", "peers", peers)
+	}
+}
+
+// Peers returns the replicas sharing the cache, including this one
+func (c *GroupCache) Peers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.peers)
+}
+
+// PeerDiscovery finds the replicas sharing a group cache
+type PeerDiscovery struct {
+	// Static lists peer base URLs
+	Static []string
+	// DNSName is resolved to peer addresses, e.g. a Kubernetes headless
+	// service; peers are reached with this replica's scheme and port
+	DNSName string
+	// Interval is how often DNSName is resolved again
+	Interval time.Duration
+	// Resolver defaults to net.DefaultResolver
+	Resolver interface {
+		LookupHost(ctx context.Context, host string) ([]string, error)
+	}
+}
+
+// WatchPeers keeps the peers up to date with d until ctx is done. Failed
+// lookups keep the previous peers.
+func (c *GroupCache) WatchPeers(ctx context.Context, d PeerDiscovery) {
+	c.discoverPeers(ctx, d)
+	if d.DNSName == "" || d.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.discoverPeers(ctx, d)
+		}
+	}
+}
+
+// discoverPeers sets the peers found by d
+func (c *GroupCache) discoverPeers(ctx context.Context, d PeerDiscovery) {
+	peers := slices.Clone(d.Static)
+	if d.DNSName != "" {
+		resolver := d.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		addrs, err := resolver.LookupHost(ctx, d.DNSName)
+		if err != nil {
+			slog.Warn("Group cache peer lookup failed", "name", d.DNSName, "error", err)
+			return
+		}
+		self, _ := peerURL(c.self)
+		for _, addr := range addrs {
+			peer := *self
+			peer.Host = net.JoinHostPort(addr, self.Port())
+			peers = append(peers, peer.String())
+		}
+	}
+	c.SetPeers(peers...)
+}
+
+// peerURL parses a peer base URL such as http://10.0.0.5:8081
+func peerURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Port() == "" {
+		return nil, fmt.Errorf("%q must be an http(s) URL with a port", raw)
+	}
+	if u.Path != "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("%q must not have a path", raw)
+	}
+	return u, nil
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+// Groupcache allows one group cache per process, so it is tested in one go
+func TestGroupCache(t *testing.T) {
+	ctx := context.Background()
+	load := func(context.Context, string) ([]byte, EntryMeta, bool, error) {
+		return nil, EntryMeta{}, false, nil
+	}
+
+	for _, cfg := range []GroupConfig{
+		{Self: "http://10.0.0.1:8081", CacheBytes: 1 << 20},
+		{Self: "http://10.0.0.1:8081", Load: load},
+		{Self: "10.0.0.1:8081", CacheBytes: 1 << 20, Load: load},
+		{Self: "http://10.0.0.1", CacheBytes: 1 << 20, Load: load},
+		{Self: "http://10.0.0.1:8081/cache", CacheBytes: 1 << 20, Load: load},
+	} {
+		if _, err := NewGroupCache(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	c, err := NewGroupCache(GroupConfig{
+		Self:       "http://10.0.0.1:8081",
+		CacheBytes: 1 << 20,
+		TTL:        time.Hour,
+		Load: func(ctx context.Context, key string) ([]byte, EntryMeta, bool, error) {
+			loads.Add(1)
+			switch key {
+			case "report.pdf":
+				<-release
+				return []byte("%PDF"), EntryMeta{ContentType: "application/pdf", ETag: `"v1"`}, true, nil
+			case "broken":
+				return nil, EntryMeta{}, false, errors.New("origin down")
+			}
+			return nil, EntryMeta{}, false, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewGroupCache failed: %v", err)
+	}
+	if _, err := NewGroupCache(GroupConfig{Self: "http://10.0.0.1:8081", CacheBytes: 1 << 20, Load: load}); err == nil {
+		t.Error("Expected a second group cache to be refused")
+	}
+
+	// Concurrent requests for a key share one load
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, found, err := c.GetEntry(ctx, "report.pdf")
+			if err != nil || !found {
+				t.Errorf("Expected a hit, got found=%v err=%v", found, err)
+				return
+			}
+			if string(entry.Data) != "%PDF" || entry.Meta.ContentType != "application/pdf" || entry.Meta.Size != 4 {
+				t.Errorf("Unexpected entry %q %+v", entry.Data, entry.Meta)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if _, _, found, _ := c.GetWithAge(ctx, "report.pdf"); !found {
+		t.Error("Expected a hit for a loaded key")
+	}
+	if got := loads.Load(); got != 1 {
+		t.Errorf("Expected 1 load, got %d", got)
+	}
+
+	// Keys missing from the origin are misses, and failed loads are errors
+	if _, found, err := c.Get(ctx, "missing"); found || err != nil {
+		t.Errorf("Expected a miss, got found=%v err=%v", found, err)
+	}
+	if _, _, err := c.Get(ctx, "broken"); err == nil {
+		t.Error("Expected the load error")
+	}
+
+	// Entries are immutable
+	if err := c.Set(ctx, "report.pdf", []byte("new")); err != nil {
+		t.Errorf("Set failed: %v", err)
+	}
+	if n, err := c.Delete(ctx, "report.pdf"); n != 0 || err != nil {
+		t.Errorf("Expected nothing deleted, got %d, %v", n, err)
+	}
+	if data, _, _ := c.Get(ctx, "report.pdf"); string(data) != "%PDF" {
+		t.Errorf("Expected the loaded entry, got %q", data)
+	}
+
+	// Peers come from the static list and DNS, and always include this replica
+	d := PeerDiscovery{
+		Static:   []string{"http://static:8081"},
+		DNSName:  "file-cache-peers",
+		Resolver: fakeResolver{"file-cache-peers": {"10.0.0.1", "10.0.0.2", "fd00::3"}},
+	}
+	c.WatchPeers(ctx, d)
+	want := []string{"http://10.0.0.1:8081", "http://10.0.0.2:8081", "http://[fd00::3]:8081", "http://static:8081"}
+	if got := c.Peers(); !slices.Equal(got, want) {
+		t.Errorf("Expected peers %v, got %v", want, got)
+	}
+
+	// A failed lookup keeps the known peers
+	d.Resolver = fakeResolver{}
+	c.WatchPeers(ctx, d)
+	if got := c.Peers(); !slices.Equal(got, want) {
+		t.Errorf("Expected peers to be kept, got %v", got)
+	}
+}
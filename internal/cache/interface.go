@@ -1,15 +1,74 @@
 package cache
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Cache defines the interface for caching operations
 // This allows for easy mocking in tests
 type Cache interface {
 	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// GetWithAge is like Get but also reports how long ago the entry was stored
+	GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error)
 	Set(ctx context.Context, key string, data []byte) error
+	// Delete removes the given keys and returns how many existed
+	Delete(ctx context.Context, keys ...string) (int64, error)
+	// DeletePrefix removes every key starting with prefix and returns how many were removed
+	DeletePrefix(ctx context.Context, prefix string) (int64, error)
 	Ping(ctx context.Context) error
 	Close() error
 }
 
+// Entry is a cached payload with the metadata stored alongside it
+type Entry struct {
+	Data []byte
+	Meta EntryMeta
+	// Age is how long ago the entry was stored
+	Age time.Duration
+}
+
+// Expired reports whether the entry has outlived its own TTL. Entries
+// without one are expired by the cache that holds them.
+func (e *Entry) Expired() bool {
+	return e.Meta.TTL > 0 && e.Age >= e.Meta.TTL
+}
+
+// EntryCache is implemented by caches that store metadata with payloads
+type EntryCache interface {
+	// GetEntry returns the entry for key; legacy entries have empty metadata
+	GetEntry(ctx context.Context, key string) (*Entry, bool, error)
+	// SetEntry stores data with meta. Size and StoredAt are filled in when zero.
+	SetEntry(ctx context.Context, key string, data []byte, meta EntryMeta) error
+}
+
+// RangeCache is implemented by caches that can read part of an entry
+// without loading all of it. Caches wrapping another return
+// errors.ErrUnsupported when the one they wrap can't.
+type RangeCache interface {
+	// GetRange returns the entry for key with Data holding up to length
+	// bytes from offset, and Meta.Size the size of the whole payload. A
+	// negative offset counts back from the end, and a negative length reads
+	// to the end; see ResolveRange.
+	GetRange(ctx context.Context, key string, offset, length int64) (*Entry, bool, error)
+}
+
+// ResolveRange returns the bytes [start, end) of a payload of size bytes
+// that offset and length select, as described by RangeCache. start is size
+// when the range is past the end.
+func ResolveRange(offset, length, size int64) (start, end int64) {
+	start = offset
+	if offset < 0 {
+		start = max(size+offset, 0)
+	}
+	start = min(start, size)
+	end = size
+	if length >= 0 && length < size-start {
+		end = start + length
+	}
+	return start, end
+}
+
 // Ensure RedisCache implements Cache interface
 var _ Cache = (*RedisCache)(nil)
+var _ EntryCache = (*RedisCache)(nil)
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Invalidation tells the other replicas of a deployment to drop entries
+// from the tiers local to them
+type Invalidation struct {
+	// Origin is the replica that sent the invalidation
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	// All drops every entry, sent when invalidations may have been missed
+	All bool `json:"all,omitempty"`
+}
+
+// Invalidator carries invalidations between replicas
+type Invalidator interface {
+	// Publish sends inv to the other replicas
+	Publish(ctx context.Context, inv Invalidation) error
+	// Subscribe calls handle with the invalidations other replicas publish
+	// until ctx is done
+	Subscribe(ctx context.Context, handle func(Invalidation)) error
+}
+
+// resubscribeBackoff is the pause after a failed receive before the
+// subscription is reestablished
+const resubscribeBackoff = time.Second
+
+// RedisInvalidator carries invalidations over a Redis pub/sub channel.
+// Messages published while a replica is disconnected are lost, so when its
+// subscription is reestablished the replica is told to drop everything.
+type RedisInvalidator struct {
+	client  *redis.Client
+	channel string
+	origin  string
+}
+
+// Ensure RedisInvalidator implements Invalidator
+var _ Invalidator = (*RedisInvalidator)(nil)
+
+// Invalidator creates an invalidator publishing on channel through c's
+// connection
+func (c *RedisCache) Invalidator(channel string) *RedisInvalidator {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &RedisInvalidator{client: c.client, channel: channel, origin: hex.EncodeToString(id)}
+}
+
+func (r *RedisInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	inv.Origin = r.origin
+	msg, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Publish(ctx, r.channel, msg).Err(); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+// Subscribe receives invalidations, skipping the ones this replica sent
+func (r *RedisInvalidator) Subscribe(ctx context.Context, handle func(Invalidation)) error {
+	ps := r.client.Subscribe(ctx, r.channel)
+	defer ps.Close()
+
+	subscribed := false
+	for {
+		msg, err := ps.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.WarnContext(ctx, "Cache invalidation subscription failed", "channel", r.channel, "error", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(resubscribeBackoff):
+			}
+			continue
+		}
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind != "subscribe" {
+				continue
+			}
+			if subscribed {
+				slog.InfoContext(ctx, "Cache invalidation subscription reestablished, dropping local entries", "channel", r.channel)
+				handle(Invalidation{All: true})
+			}
+			subscribed = true
+		case *redis.Message:
+			var inv Invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				slog.WarnContext(ctx, "Malformed cache invalidation", "channel", r.channel, "error", err)
+				continue
+			}
+			if inv.Origin != r.origin {
+				handle(inv)
+			}
+		}
+	}
+}
+
+// SetInvalidator makes t publish the keys it removes through inv, so other
+// replicas drop them from their local tiers. It must be called before t is
+// used.
+func (t *Tiered) SetInvalidator(inv Invalidator) {
+	t.invalidator = inv
+}
+
+// Listen drops the entries other replicas invalidate from the local tiers
+// until ctx is done
+func (t *Tiered) Listen(ctx context.Context) error {
+	if t.invalidator == nil {
+		return errors.New("tiered cache has no invalidator")
+	}
+	return t.invalidator.Subscribe(ctx, func(inv Invalidation) {
+		for _, tier := range t.tiers {
+			if !tier.Local {
+				continue
+			}
+			var err error
+			switch {
+			case inv.All:
+				_, err = tier.Cache.DeletePrefix(ctx, "")
+			case inv.Prefix != "":
+				_, err = tier.Cache.DeletePrefix(ctx, inv.Prefix)
+			case len(inv.Keys) > 0:
+				_, err = tier.Cache.Delete(ctx, inv.Keys...)
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to apply cache invalidation", "tier", tier.Name, "origin", inv.Origin, "error", err)
+			}
+		}
+	})
+}
+
+// broadcast publishes inv after a local removal, joining any failure to err
+func (t *Tiered) broadcast(ctx context.Context, inv Invalidation, err error) error {
+	if t.invalidator == nil {
+		return err
+	}
+	return errors.Join(err, t.invalidator.Publish(ctx, inv))
+}
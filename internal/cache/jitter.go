@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"time"
+)
+
+// jitterTTL shortens ttl by up to fraction of it, so entries stored
+// together, such as by a warm job, don't all expire in the same second. The
+// amount is picked from key and when the entry was stored, so an entry gets
+// the same TTL each time it is checked.
+func jitterTTL(ttl time.Duration, fraction float64, key string, storedAt time.Time) time.Duration {
+	if ttl <= 0 || fraction <= 0 {
+		return ttl
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write(binary.LittleEndian.AppendUint64(nil, uint64(storedAt.UnixNano())))
+	// The top 53 bits give a float spread evenly over [0, 1)
+	share := float64(h.Sum64()>>11) / (1 << 53)
+	return ttl - time.Duration(share*fraction*float64(ttl))
+}
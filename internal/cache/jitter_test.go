@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestJitterTTL(t *testing.T) {
+	storedAt := time.Date(2024, 1, 8, 12, 30, 0, 0, time.UTC)
+	if got := jitterTTL(time.Hour, 0, "a.txt", storedAt); got != time.Hour {
+		t.Errorf("Expected no jitter to keep the TTL, got %s", got)
+	}
+	if got := jitterTTL(0, 0.1, "a.txt", storedAt); got != 0 {
+		t.Errorf("Expected entries without a TTL to keep none, got %s", got)
+	}
+
+	// Entries stored together are spread over the last 10% of the TTL
+	seconds := make(map[int]bool)
+	for i := range 100 {
+		key := fmt.Sprintf("warm/%d.txt", i)
+		ttl := jitterTTL(time.Hour, 0.1, key, storedAt)
+		if ttl <= 54*time.Minute || ttl > time.Hour {
+			t.Fatalf("TTL %s for %s is outside the jitter range", ttl, key)
+		}
+		if again := jitterTTL(time.Hour, 0.1, key, storedAt); again != ttl {
+			t.Fatalf("Expected the same TTL for %s each time, got %s and %s", key, ttl, again)
+		}
+		seconds[int(ttl.Seconds())] = true
+	}
+	if len(seconds) < 90 {
+		t.Errorf("Expected entries to expire in different seconds, got %d distinct", len(seconds))
+	}
+}
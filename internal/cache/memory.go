@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryConfig holds the in-process cache settings
+type MemoryConfig struct {
+	// MaxBytes caps the total size of entries; least recently used entries
+	// are evicted to stay under it
+	MaxBytes int64
+	// TTL is how long an entry is kept after it was stored here, whatever
+	// its age in the tiers it was copied from
+	TTL time.Duration
+}
+
+// memoryEntry is an entry and when it was stored
+type memoryEntry struct {
+	key      string
+	data     []byte
+	meta     EntryMeta
+	pinnedAt time.Time
+}
+
+// MemoryCache keeps entries in process memory. It is meant as the top tier
+// of a Tiered cache admitting only the hottest keys, so a burst of requests
+// for one file is served without reaching Redis or storage.
+type MemoryCache struct {
+	maxBytes int64
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *memoryEntry, most recently used first
+	size    int64
+	// evictions counts entries dropped to stay under maxBytes
+	evictions int64
+	now       func() time.Time
+}
+
+// Ensure MemoryCache implements the cache interfaces
+var (
+	_ Cache         = (*MemoryCache)(nil)
+	_ EntryCache    = (*MemoryCache)(nil)
+	_ UsageReporter = (*MemoryCache)(nil)
+)
+
+// NewMemoryCache creates an empty memory cache
+func NewMemoryCache(cfg MemoryConfig) (*MemoryCache, error) {
+	if cfg.MaxBytes <= 0 {
+		return nil, fmt.Errorf("memory cache size must be positive, got %d", cfg.MaxBytes)
+	}
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("memory cache TTL must be positive, got %s", cfg.TTL)
+	}
+	return &MemoryCache{
+		maxBytes: cfg.MaxBytes,
+		ttl:      cfg.TTL,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}, nil
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return entry.Data, true, nil
+}
+
+// GetWithAge fetches the value and how long ago it was first stored in
+// any tier
+func (c *MemoryCache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// GetEntry returns the entry for key and marks it most recently used
+func (c *MemoryCache) GetEntry(ctx context.Context, key string) (*Entry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := elem.Value.(*memoryEntry)
+	now := c.now()
+	if now.Sub(e.pinnedAt) >= c.ttl {
+		c.removeLocked(elem)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+	return &Entry{Data: e.data, Meta: e.meta, Age: now.Sub(e.meta.StoredAt)}, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, data []byte) error {
+	return c.SetEntry(ctx, key, data, EntryMeta{})
+}
+
+// SetEntry stores data with meta, keeping the StoredAt of entries copied
+// from another tier. Entries larger than the whole cache are skipped.
+func (c *MemoryCache) SetEntry(ctx context.Context, key string, data []byte, meta EntryMeta) error {
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return nil
+	}
+	now := c.now()
+	if meta.StoredAt.IsZero() {
+		meta.StoredAt = now
+	}
+	if meta.Size == 0 {
+		meta.Size = size
+	}
+	// The payload is held whole, so there is no blob to resolve
+	meta.Blob = ""
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key: key, data: data, meta: meta, pinnedAt: now})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back())
+		c.evictions++
+	}
+	return nil
+}
+
+// Delete removes keys and returns how many were stored
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var deleted int64
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.removeLocked(elem)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeletePrefix removes every key starting with prefix
+func (c *MemoryCache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var deleted int64
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.removeLocked(elem)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (c *MemoryCache) removeLocked(elem *list.Element) {
+	e := elem.Value.(*memoryEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.data))
+}
+
+// Size returns the total size of the stored entries
+func (c *MemoryCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Usage reports the entries held and those evicted to make room
+func (c *MemoryCache) Usage(context.Context) (Usage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Usage{Keys: int64(len(c.entries)), Bytes: c.size, Evictions: c.evictions}, nil
+}
+
+func (c *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close drops every entry
+func (c *MemoryCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return nil
+}
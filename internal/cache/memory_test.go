@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestMemoryCache(t *testing.T, maxBytes int64, ttl time.Duration) (*MemoryCache, *time.Time) {
+	t.Helper()
+	c, err := NewMemoryCache(MemoryConfig{MaxBytes: maxBytes, TTL: ttl})
+	if err != nil {
+		t.Fatalf("NewMemoryCache failed: %v", err)
+	}
+	now := time.Date(2024, 1, 8, 12, 30, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	c, now := newTestMemoryCache(t, 10, time.Minute)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, key, []byte("xxxx")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if key == "a" {
+			*now = now.Add(time.Second)
+		}
+	}
+	if _, found, _ := c.Get(ctx, "a"); found {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if _, found, _ := c.Get(ctx, "b"); !found {
+		t.Error("Expected b to be kept")
+	}
+	usage, _ := c.Usage(ctx)
+	if usage.Keys != 2 || usage.Bytes != 8 || usage.Evictions != 1 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// Reading b made c the least recently used
+	if err := c.Set(ctx, "d", []byte("xx")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := c.Set(ctx, "e", []byte("xx")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, found, _ := c.Get(ctx, "c"); found {
+		t.Error("Expected c to be evicted before the recently read b")
+	}
+
+	if err := c.Set(ctx, "huge", bytes.Repeat([]byte("x"), 11)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, found, _ := c.Get(ctx, "huge"); found {
+		t.Error("Expected an entry larger than the cache to be skipped")
+	}
+
+	*now = now.Add(30 * time.Second)
+	_, age, found, _ := c.GetWithAge(ctx, "b")
+	if !found || age != 30*time.Second {
+		t.Errorf("Expected b to be 30s old, got %s (found %v)", age, found)
+	}
+	*now = now.Add(30 * time.Second)
+	if _, found, _ := c.Get(ctx, "b"); found {
+		t.Error("Expected entries to expire after the TTL")
+	}
+	if c.Size() != 4 {
+		t.Errorf("Expected expired entries to be dropped, size is %d", c.Size())
+	}
+}
+
+func TestTieredAdmit(t *testing.T) {
+	ctx := context.Background()
+	memory, _ := newTestMemoryCache(t, 1024, time.Minute)
+	disk := newTestDiskCache(t, t.TempDir(), 4096)
+	hot := map[string]bool{}
+	c := NewTiered(
+		Tier{Name: "memory", Cache: memory, Local: true, Admit: func(key string) bool { return hot[key] }},
+		Tier{Name: "disk", Cache: disk},
+	)
+
+	if err := c.Set(ctx, "a.txt", []byte("hello")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, found, _ := memory.Get(ctx, "a.txt"); found {
+		t.Fatal("Expected a key that isn't admitted to skip the memory tier")
+	}
+
+	hot["a.txt"] = true
+	if data, found, _ := c.Get(ctx, "a.txt"); !found || string(data) != "hello" {
+		t.Fatal("Expected the entry to be served from disk")
+	}
+	if data, found, _ := memory.Get(ctx, "a.txt"); !found || string(data) != "hello" {
+		t.Fatal("Expected the admitted key to be promoted into memory")
+	}
+}
@@ -2,31 +2,136 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
 )
 
 // RedisConfig holds all Redis connection settings
 type RedisConfig struct {
-	Addr         string
-	Password     string
-	DB           int
-	TTL          time.Duration
+	Addr     string
+	Password string
+	DB       int
+	TTL      time.Duration
+	// TTLJitter shortens each entry's TTL by a random share of up to this
+	// fraction of it
+	TTLJitter float64
+	// Compression compresses payloads before they are stored
+	Compression  CompressionConfig
 	DialTimeout  time.Duration
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// When SentinelAddrs is set, the primary named MasterName is discovered
+	// through Sentinel, which also redirects the client on failover; Addr is
+	// ignored
+	MasterName       string
+	SentinelAddrs    []string
+	SentinelPassword string
+
+	// TLS settings. Cert and key files enable client certificate auth; a CA
+	// file replaces the system roots for verifying the server.
+	TLSEnabled            bool
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+
+	// NamespaceDepth is how many leading path segments of a key form its
+	// namespace. Purging a whole namespace bumps its generation, which is
+	// part of every key in it, instead of scanning for the keys. 0 disables
+	// namespaces.
+	NamespaceDepth int
+	// GenerationRefresh is how long a namespace generation read from Redis
+	// is reused; 0 reads it for every operation
+	GenerationRefresh time.Duration
+
+	// Breaker bypasses Redis for a while after repeated failures
+	Breaker BreakerConfig
+
+	// Metrics records cache maintenance; nil records nowhere
+	Metrics *metrics.Metrics
 }
 
+// scanBatchSize is the COUNT hint used when scanning keys
+const scanBatchSize = 500
+
 type RedisCache struct {
 	client *redis.Client
-	ttl    time.Duration
+	// ttl is the default entry TTL in nanoseconds, changed by SetTTL
+	ttl         atomic.Int64
+	ttlJitter   float64
+	compression CompressionConfig
+	metrics     *metrics.Metrics
+	breaker     *breaker
+
+	namespaceDepth    int
+	generationRefresh time.Duration
+	genMu             sync.Mutex
+	generations       map[string]cachedGeneration
 }
 
 // NewRedisCache creates a new Redis cache with the given configuration
 func NewRedisCache(cfg RedisConfig) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use dial timeout for ping
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout+5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Noop()
+	}
+	c := &RedisCache{
+		client:            client,
+		ttlJitter:         cfg.TTLJitter,
+		compression:       cfg.Compression,
+		metrics:           cfg.Metrics,
+		breaker:           newBreaker(cfg.Breaker, cfg.Metrics),
+		namespaceDepth:    cfg.NamespaceDepth,
+		generationRefresh: cfg.GenerationRefresh,
+		generations:       make(map[string]cachedGeneration),
+	}
+	c.SetTTL(cfg.TTL)
+	return c, nil
+}
+
+// SetTTL changes the TTL of entries stored from now on
+func (c *RedisCache) SetTTL(ttl time.Duration) {
+	c.ttl.Store(int64(ttl))
+}
+
+func (c *RedisCache) defaultTTL() time.Duration {
+	return time.Duration(c.ttl.Load())
+}
+
+// newRedisClient creates a standalone client, or a Sentinel-backed failover
+// client when sentinels are configured
+func newRedisClient(cfg RedisConfig) (*redis.Client, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.Options{
 		Addr:     cfg.Addr,
 		Password: cfg.Password,
 		DB:       cfg.DB,
@@ -41,51 +146,321 @@ func NewRedisCache(cfg RedisConfig) (*RedisCache, error) {
 		MinIdleConns: 2,
 		PoolTimeout:  cfg.ReadTimeout,
 
-		// Retry settings
-		MaxRetries:      3,
-		MinRetryBackoff: 100 * time.Millisecond,
-		MaxRetryBackoff: 500 * time.Millisecond,
-	})
+		// Retries are done by withRetry so they draw on the request's retry budget
+		MaxRetries: -1,
 
-	// Use dial timeout for ping
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout+5*time.Second)
-	defer cancel()
+		TLSConfig: tlsConfig,
+	}
+	if len(cfg.SentinelAddrs) == 0 {
+		return redis.NewClient(opts), nil
+	}
 
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	if cfg.MasterName == "" {
+		return nil, fmt.Errorf("redis sentinel requires a master name")
 	}
+	return redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:       cfg.MasterName,
+		SentinelAddrs:    cfg.SentinelAddrs,
+		SentinelPassword: cfg.SentinelPassword,
 
-	return &RedisCache{
-		client: client,
-		ttl:    cfg.TTL,
-	}, nil
+		Password:     opts.Password,
+		DB:           opts.DB,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: opts.MinIdleConns,
+		PoolTimeout:  opts.PoolTimeout,
+		MaxRetries:   opts.MaxRetries,
+		TLSConfig:    opts.TLSConfig,
+	}), nil
+}
+
+// newTLSConfig builds the client TLS settings, or returns nil when TLS is off
+func newTLSConfig(cfg RedisConfig) (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA file %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
 }
 
 func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
-	data, err := c.client.Get(ctx, key).Bytes()
+	key, err := c.storedKey(ctx, key)
+	if err != nil {
+		return nil, false, bypassed(err)
+	}
+	var data []byte
+	err = c.withRetry(ctx, func() (err error) {
+		data, err = c.client.Get(ctx, key).Bytes()
+		return err
+	})
 	if err == redis.Nil {
 		// Key doesn't exist - cache miss
 		return nil, false, nil
 	}
+	if err != nil {
+		return nil, false, bypassed(fmt.Errorf("redis get error: %w", err))
+	}
+	// Cache hit; entries may be raw bytes or wrapped in an envelope
+	meta, payload, ok, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("redis entry %s: %w", key, err)
+	}
+	if ok && meta.Tombstone {
+		return nil, false, nil
+	}
+	return payload, true, nil
+}
+
+// GetWithAge fetches the value and how long ago it was stored
+func (c *RedisCache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// GetEntry fetches the value and its remaining TTL in a single round trip.
+// Envelope entries carry their stored-at time; for legacy entries the age is
+// derived from the configured TTL, so it is only accurate for entries written
+// with that TTL.
+func (c *RedisCache) GetEntry(ctx context.Context, key string) (*Entry, bool, error) {
+	key, err := c.storedKey(ctx, key)
+	if err != nil {
+		return nil, false, bypassed(err)
+	}
+	var getCmd *redis.StringCmd
+	var ttlCmd *redis.DurationCmd
+	err = c.withRetry(ctx, func() error {
+		pipe := c.client.Pipeline()
+		getCmd = pipe.Get(ctx, key)
+		ttlCmd = pipe.PTTL(ctx, key)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		return nil, false, bypassed(fmt.Errorf("redis get error: %w", err))
+	}
+
+	data, err := getCmd.Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
 	if err != nil {
 		return nil, false, fmt.Errorf("redis get error: %w", err)
 	}
-	// Cache hit
-	return data, true, nil
+
+	meta, payload, ok, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("redis entry %s: %w", key, err)
+	}
+	if ok && meta.Tombstone {
+		return nil, false, nil
+	}
+	entry := &Entry{Data: payload, Meta: meta}
+	if ok && !meta.StoredAt.IsZero() {
+		entry.Age = time.Since(meta.StoredAt)
+		return entry, true, nil
+	}
+
+	if ttl, remaining := c.defaultTTL(), ttlCmd.Val(); remaining > 0 && ttl > remaining {
+		entry.Age = ttl - remaining
+	}
+	return entry, true, nil
+}
+
+// SetEntry stores data wrapped in an envelope carrying meta. An entry with
+// its own TTL expires that long after it was stored, overriding the
+// configured TTL; one that has already expired is not stored.
+func (c *RedisCache) SetEntry(ctx context.Context, key string, data []byte, meta EntryMeta) error {
+	if meta.Size == 0 {
+		meta.Size = int64(len(data))
+	}
+	if meta.StoredAt.IsZero() {
+		meta.StoredAt = time.Now().UTC()
+	}
+	ttl := jitterTTL(c.defaultTTL(), c.ttlJitter, key, meta.StoredAt)
+	if meta.TTL > 0 {
+		ttl = jitterTTL(meta.TTL, c.ttlJitter, key, meta.StoredAt) - time.Since(meta.StoredAt)
+		if ttl < time.Millisecond {
+			return nil
+		}
+	}
+
+	envelope, _, err := c.encode(meta, data)
+	if err != nil {
+		return err
+	}
+	return c.set(ctx, key, envelope, ttl)
 }
 
+// Set stores data under key. It returns ErrTombstoned, storing nothing, while
+// key holds a tombstone. Data worth compressing is stored in an envelope
+// flagging its codec, and the rest as it is.
 func (c *RedisCache) Set(ctx context.Context, key string, data []byte) error {
-	err := c.client.Set(ctx, key, data, c.ttl).Err()
+	ttl := jitterTTL(c.defaultTTL(), c.ttlJitter, key, time.Now())
+	envelope, compressed, err := c.encode(EntryMeta{}, data)
+	if err != nil {
+		return err
+	}
+	if !compressed {
+		return c.set(ctx, key, data, ttl)
+	}
+	return c.set(ctx, key, envelope, ttl)
+}
+
+// encode wraps data in an envelope with meta, compressing it when that is
+// worth it, and reports whether it was compressed
+func (c *RedisCache) encode(meta EntryMeta, data []byte) ([]byte, bool, error) {
+	payload, flags := data, byte(0)
+	compressed, flag, ok := c.compression.compress(data)
+	if ok {
+		payload, flags = compressed, flag
+		c.metrics.CacheCompressionBytesTotal.WithLabelValues("original").Add(float64(len(data)))
+		c.metrics.CacheCompressionBytesTotal.WithLabelValues("compressed").Add(float64(len(compressed)))
+	}
+	envelope, err := encodeFlaggedEnvelope(meta, payload, flags)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	return envelope, ok, nil
+}
+
+func (c *RedisCache) set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	key, err := c.storedKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	var stored int64
+	err = c.withRetry(ctx, func() (err error) {
+		stored, err = setUnlessTombstoned.Run(ctx, c.client, []string{key}, tombstone, data, ttl.Milliseconds()).Int64()
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("redis set error: %w", err)
 	}
+	if stored == 0 {
+		return ErrTombstoned
+	}
 	return nil
 }
 
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	keys, err := c.storedKeys(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	return c.del(ctx, keys)
+}
+
+// del removes the given Redis keys
+func (c *RedisCache) del(ctx context.Context, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	var n int64
+	err := c.withRetry(ctx, func() (err error) {
+		n, err = c.client.Del(ctx, keys...).Result()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("redis del error: %w", err)
+	}
+	return n, nil
+}
+
+// DeletePrefix scans for keys under prefix and deletes them in batches.
+// SCAN is non-blocking but still walks the whole keyspace, so this is meant
+// for operator-driven purges rather than the request path.
+//
+// A prefix that is exactly a namespace is flushed in constant time by
+// bumping its generation instead; the entries are left to expire, so none
+// are reported as removed.
+func (c *RedisCache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	if ns, ok := namespaceOf(prefix, c.namespaceDepth); ok {
+		if prefix == ns {
+			return 0, c.flushNamespace(ctx, ns)
+		}
+		gen, err := c.generation(ctx, ns, true)
+		if err != nil {
+			return 0, err
+		}
+		prefix = generationalKey(prefix, ns, gen)
+	}
+
+	var (
+		cursor  uint64
+		deleted int64
+	)
+	pattern := escapeGlob(prefix) + "*"
+
+	for {
+		var (
+			keys []string
+			next uint64
+		)
+		err := c.withRetry(ctx, func() (err error) {
+			keys, next, err = c.client.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+			return err
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("redis scan error: %w", err)
+		}
+		keys = slices.DeleteFunc(keys, isInternalKey)
+		n, err := c.del(ctx, keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
 
+// escapeGlob escapes Redis glob metacharacters so a literal prefix can be
+// used in a MATCH pattern
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // Ping checks if Redis connection is alive
 func (c *RedisCache) Ping(ctx context.Context) error {
 	return c.client.Ping(ctx).Err()
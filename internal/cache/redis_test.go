@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewRedisClient_Sentinel(t *testing.T) {
+	if _, err := newRedisClient(RedisConfig{SentinelAddrs: []string{"localhost:26379"}}); err == nil {
+		t.Error("Expected an error without a master name")
+	}
+
+	client, err := newRedisClient(RedisConfig{
+		Addr:          "ignored:6379",
+		MasterName:    "cache",
+		SentinelAddrs: []string{"localhost:26379"},
+		DialTimeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatalf("newRedisClient failed: %v", err)
+	}
+	defer client.Close()
+
+	if got := client.Options().Addr; got != "FailoverClient" {
+		t.Errorf("Expected a failover client, got addr %q", got)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	if cfg, err := newTLSConfig(RedisConfig{}); err != nil || cfg != nil {
+		t.Errorf("Expected no TLS config when disabled, got %v, %v", cfg, err)
+	}
+
+	cfg, err := newTLSConfig(RedisConfig{TLSEnabled: true, TLSInsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("newTLSConfig failed: %v", err)
+	}
+	if !cfg.InsecureSkipVerify || cfg.RootCAs != nil || len(cfg.Certificates) != 0 {
+		t.Errorf("Unexpected TLS config: %+v", cfg)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		cfg  RedisConfig
+	}{
+		{"missing CA file", RedisConfig{TLSEnabled: true, TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", RedisConfig{TLSEnabled: true, TLSCAFile: notPEM}},
+		{"certificate without key", RedisConfig{TLSEnabled: true, TLSCertFile: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTLSConfig(tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
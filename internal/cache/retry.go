@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+)
+
+// Retry settings for Redis commands
+const (
+	maxRetries      = 3
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 500 * time.Millisecond
+)
+
+// withRetry runs op, retrying transient failures with backoff for as long as
+// the request's retry budget allows. Nothing is sent while the circuit
+// breaker is open.
+func (c *RedisCache) withRetry(ctx context.Context, op func() error) error {
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.retry(ctx, op)
+	c.breaker.record(err)
+	return err
+}
+
+func (c *RedisCache) retry(ctx context.Context, op func() error) error {
+	err := op()
+	for attempt := 1; attempt <= maxRetries && retryable(err); attempt++ {
+		if !retrybudget.Allow(ctx, retrybudget.KindCache) {
+			return errors.Join(err, retrybudget.ErrExhausted)
+		}
+
+		timer := time.NewTimer(retryBackoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = op()
+	}
+	return err
+}
+
+// retryBackoff doubles from minRetryBackoff up to maxRetryBackoff
+func retryBackoff(attempt int) time.Duration {
+	return min(minRetryBackoff<<(attempt-1), maxRetryBackoff)
+}
+
+// retryable reports whether err is a transient failure. Misses, context
+// errors and server replies are final, except for the replies Redis sends
+// while it is loading or failing over.
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		msg := reply.Error()
+		return strings.HasPrefix(msg, "LOADING ") || strings.HasPrefix(msg, "READONLY ") ||
+			strings.HasPrefix(msg, "MASTERDOWN ") || strings.HasPrefix(msg, "TRYAGAIN ")
+	}
+	return true
+}
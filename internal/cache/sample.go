@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sampler is implemented by caches that can pick keys at random, so
+// background jobs can check a slice of the cache without walking all of it
+type Sampler interface {
+	// SampleKeys returns up to n distinct keys, possibly including derived
+	// keys and keys whose entries have since expired
+	SampleKeys(ctx context.Context, n int) ([]string, error)
+}
+
+// Ensure the caches implement Sampler
+var (
+	_ Sampler = (*RedisCache)(nil)
+	_ Sampler = (*DiskCache)(nil)
+	_ Sampler = (*Tiered)(nil)
+)
+
+// SampleKeys draws n random keys with RANDOMKEY. Generation counters are
+// skipped and keys of flushed generations are mapped back to the key they
+// were stored for.
+func (c *RedisCache) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	var cmds []*redis.StringCmd
+	err := c.withRetry(ctx, func() error {
+		pipe := c.client.Pipeline()
+		cmds = make([]*redis.StringCmd, n)
+		for i := range cmds {
+			cmds[i] = pipe.RandomKey(ctx)
+		}
+		_, err := pipe.Exec(ctx)
+		if errors.Is(err, redis.Nil) {
+			// The database is empty
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample keys: %w", err)
+	}
+
+	seen := make(map[string]bool, n)
+	keys := make([]string, 0, n)
+	for _, cmd := range cmds {
+		stored, err := cmd.Result()
+		if err != nil || isInternalKey(stored) {
+			continue
+		}
+		key := c.logicalKey(stored)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// logicalKey reverses generationalKey
+func (c *RedisCache) logicalKey(stored string) string {
+	ns, ok := namespaceOf(stored, c.namespaceDepth)
+	if !ok {
+		return stored
+	}
+	rest, ok := strings.CutPrefix(stored[len(ns):], variantSeparator)
+	if !ok {
+		return stored
+	}
+	_, key, ok := strings.Cut(rest, "/")
+	if !ok {
+		return stored
+	}
+	return ns + key
+}
+
+// SampleKeys returns up to n indexed keys in the order of Go's map
+// iteration, which is random enough to spread checks over the cache
+func (c *DiskCache) SampleKeys(_ context.Context, n int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, min(n, len(c.entries)))
+	for key := range c.entries {
+		if len(keys) == n {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// SampleKeys samples n keys from each tier that supports it, so every tier
+// is checked through the Tiered cache
+func (t *Tiered) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	seen := make(map[string]bool)
+	var keys []string
+	var errs []error
+	for _, tier := range t.tiers {
+		sampler, ok := tier.Cache.(Sampler)
+		if !ok {
+			continue
+		}
+		sampled, err := sampler.SampleKeys(ctx, n)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+			continue
+		}
+		for _, key := range sampled {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, errors.Join(errs...)
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FormatReport summarizes the entry formats found in a sample of the cache
+type FormatReport struct {
+	Sampled  int
+	Legacy   int
+	Envelope int
+	// Skipped counts keys that aren't file entries (variant index sets,
+	// namespace generations, expired keys)
+	Skipped int
+}
+
+// SampleFormats inspects up to n random keys and reports which entry format
+// they use, so operators can see how much of the cache predates envelopes
+func (c *RedisCache) SampleFormats(ctx context.Context, n int) (FormatReport, error) {
+	var report FormatReport
+	for i := 0; i < n; i++ {
+		key, err := c.client.RandomKey(ctx).Result()
+		if err == redis.Nil {
+			// Empty database
+			return report, nil
+		}
+		if err != nil {
+			return report, fmt.Errorf("redis randomkey error: %w", err)
+		}
+
+		if isInternalKey(key) {
+			report.Skipped++
+			continue
+		}
+		data, err := c.client.Get(ctx, key).Bytes()
+		if err != nil {
+			if err == redis.Nil || isWrongType(err) {
+				report.Skipped++
+				continue
+			}
+			return report, fmt.Errorf("redis get error: %w", err)
+		}
+
+		report.Sampled++
+		switch DetectFormat(data) {
+		case FormatEnvelope:
+			report.Envelope++
+		default:
+			report.Legacy++
+		}
+	}
+	return report, nil
+}
+
+// MigrateLegacyEntries rewrites every legacy raw entry as an envelope,
+// preserving its remaining TTL. Entries changed concurrently are left alone.
+// It returns the number of migrated entries.
+func (c *RedisCache) MigrateLegacyEntries(ctx context.Context) (int, error) {
+	var (
+		cursor   uint64
+		migrated int
+	)
+
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, "*", scanBatchSize).Result()
+		if err != nil {
+			return migrated, fmt.Errorf("redis scan error: %w", err)
+		}
+
+		for _, key := range slices.DeleteFunc(keys, isInternalKey) {
+			ok, err := c.migrateEntry(ctx, key)
+			if err != nil {
+				return migrated, err
+			}
+			if ok {
+				migrated++
+				c.metrics.CacheEntriesMigratedTotal.Inc()
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return migrated, nil
+		}
+	}
+}
+
+func (c *RedisCache) migrateEntry(ctx context.Context, key string) (bool, error) {
+	migrated := false
+	err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil || isWrongType(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if DetectFormat(data) == FormatEnvelope {
+			return nil
+		}
+
+		// The original write time is unknown; approximate it from the TTL
+		storedAt := time.Now()
+		ttl := c.defaultTTL()
+		if remaining, err := tx.PTTL(ctx, key).Result(); err == nil && remaining > 0 && ttl > remaining {
+			storedAt = storedAt.Add(-(ttl - remaining))
+		}
+
+		envelope, err := encodeEnvelope(EntryMeta{
+			Size:     int64(len(data)),
+			StoredAt: storedAt,
+		}, data)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, envelope, redis.SetArgs{KeepTTL: true, Mode: "XX"})
+			return nil
+		})
+		if err == nil {
+			migrated = true
+		}
+		return err
+	}, key)
+
+	if errors.Is(err, redis.TxFailedErr) {
+		// Key changed underneath us; whoever wrote it wins
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to migrate cache entry %s: %w", key, err)
+	}
+	return migrated, nil
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Tier is one level of a Tiered cache
+type Tier struct {
+	Name  string
+	Cache Cache
+	// MaxEntryBytes skips this tier for larger entries; zero means no limit
+	MaxEntryBytes int64
+	// Local marks a tier private to this replica, which drops the entries
+	// other replicas invalidate
+	Local bool
+	// Admit, when set, picks the keys written to this tier
+	Admit func(key string) bool
+}
+
+// Tiered layers caches, fastest first. Reads try each tier in turn and copy
+// hits into the tiers above; writes go to every tier the entry fits in, so
+// entries too large for Redis can still be served from disk. With an
+// invalidator, removals are also published so other replicas drop the
+// entries from their local tiers.
+type Tiered struct {
+	tiers       []Tier
+	invalidator Invalidator
+}
+
+// Ensure Tiered implements the cache interfaces
+var (
+	_ Cache        = (*Tiered)(nil)
+	_ EntryCache   = (*Tiered)(nil)
+	_ Tombstoner   = (*Tiered)(nil)
+	_ VariantIndex = (*Tiered)(nil)
+)
+
+// NewTiered creates a cache over tiers, ordered fastest first
+func NewTiered(tiers ...Tier) *Tiered {
+	return &Tiered{tiers: tiers}
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := t.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return entry.Data, true, nil
+}
+
+// GetWithAge fetches the value from the first tier holding it and how long
+// ago it was stored there
+func (t *Tiered) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := t.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// GetEntry returns the entry from the first tier holding it. A failing tier
+// is treated as a miss so the tiers below can still serve the key; the error
+// is returned only if no tier has it.
+func (t *Tiered) GetEntry(ctx context.Context, key string) (*Entry, bool, error) {
+	var errs []error
+	for i, tier := range t.tiers {
+		entry, found, err := getEntry(ctx, tier.Cache, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+			continue
+		}
+		if !found {
+			continue
+		}
+		t.promote(ctx, key, entry, t.tiers[:i])
+		return entry, true, nil
+	}
+	return nil, false, errors.Join(errs...)
+}
+
+// promote copies a hit into the faster tiers that missed it
+func (t *Tiered) promote(ctx context.Context, key string, entry *Entry, tiers []Tier) {
+	for _, tier := range tiers {
+		if !tier.accepts(key, int64(len(entry.Data))) {
+			continue
+		}
+		if err := setEntry(ctx, tier.Cache, key, entry.Data, entry.Meta); err != nil && !errors.Is(err, ErrTombstoned) {
+			slog.DebugContext(ctx, "Failed to promote cache entry", "key", key, "tier", tier.Name, "error", err)
+		}
+	}
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, data []byte) error {
+	return t.set(ctx, key, int64(len(data)), func(c Cache) error {
+		return c.Set(ctx, key, data)
+	})
+}
+
+// SetEntry stores data with meta in every tier it fits in
+func (t *Tiered) SetEntry(ctx context.Context, key string, data []byte, meta EntryMeta) error {
+	return t.set(ctx, key, int64(len(data)), func(c Cache) error {
+		return setEntry(ctx, c, key, data, meta)
+	})
+}
+
+// set writes to every tier the entry fits in. It succeeds if any tier stored
+// the entry, and returns ErrTombstoned, removing the entry from the other
+// tiers, if any tier holds a tombstone for key.
+func (t *Tiered) set(ctx context.Context, key string, size int64, write func(Cache) error) error {
+	var (
+		errs   []error
+		stored bool
+	)
+	for _, tier := range t.tiers {
+		if !tier.accepts(key, size) {
+			continue
+		}
+		err := write(tier.Cache)
+		if errors.Is(err, ErrTombstoned) {
+			if _, err := t.Delete(ctx, key); err != nil {
+				slog.WarnContext(ctx, "Failed to remove tombstoned entry", "key", key, "error", err)
+			}
+			return ErrTombstoned
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+			continue
+		}
+		stored = true
+	}
+	if stored {
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("entry of %d bytes fits in no cache tier", size)
+	}
+	return errors.Join(errs...)
+}
+
+// Delete removes keys from every tier and returns the most removed from any
+// one tier, since a key held in several tiers is still one entry
+func (t *Tiered) Delete(ctx context.Context, keys ...string) (int64, error) {
+	n, err := t.each(func(c Cache) (int64, error) { return c.Delete(ctx, keys...) })
+	return n, t.broadcast(ctx, Invalidation{Keys: keys}, err)
+}
+
+// DeletePrefix removes every key starting with prefix from every tier
+func (t *Tiered) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	n, err := t.each(func(c Cache) (int64, error) { return c.DeletePrefix(ctx, prefix) })
+	return n, t.broadcast(ctx, Invalidation{Prefix: prefix, All: prefix == ""}, err)
+}
+
+func (t *Tiered) each(op func(Cache) (int64, error)) (int64, error) {
+	var (
+		most int64
+		errs []error
+	)
+	for _, tier := range t.tiers {
+		n, err := op(tier.Cache)
+		most = max(most, n)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+		}
+	}
+	return most, errors.Join(errs...)
+}
+
+// Tombstone tombstones key in the tiers that support it and deletes it from
+// the rest
+func (t *Tiered) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	var errs []error
+	for _, tier := range t.tiers {
+		var err error
+		if ts, ok := tier.Cache.(Tombstoner); ok {
+			err = ts.Tombstone(ctx, key, ttl)
+		} else {
+			_, err = tier.Cache.Delete(ctx, key)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+		}
+	}
+	return t.broadcast(ctx, Invalidation{Keys: []string{key}}, errors.Join(errs...))
+}
+
+// AddVariant records key as derived from base in every tier that keeps a
+// variant index
+func (t *Tiered) AddVariant(ctx context.Context, base, key string) error {
+	var errs []error
+	for _, tier := range t.tiers {
+		if idx, ok := tier.Cache.(VariantIndex); ok {
+			if err := idx.AddVariant(ctx, base, key); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Variants returns the derived keys recorded for base in any tier
+func (t *Tiered) Variants(ctx context.Context, base string) ([]string, error) {
+	var (
+		keys []string
+		seen = make(map[string]bool)
+	)
+	for _, tier := range t.tiers {
+		idx, ok := tier.Cache.(VariantIndex)
+		if !ok {
+			continue
+		}
+		variants, err := idx.Variants(ctx, base)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tier.Name, err)
+		}
+		for _, key := range variants {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Ping checks every tier
+func (t *Tiered) Ping(ctx context.Context) error {
+	var errs []error
+	for _, tier := range t.tiers {
+		if err := tier.Cache.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every tier
+func (t *Tiered) Close() error {
+	var errs []error
+	for _, tier := range t.tiers {
+		if err := tier.Cache.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// accepts reports whether the entry for key, of size bytes, is written to
+// the tier
+func (tier Tier) accepts(key string, size int64) bool {
+	return (tier.MaxEntryBytes <= 0 || size <= tier.MaxEntryBytes) && (tier.Admit == nil || tier.Admit(key))
+}
+
+// getEntry reads key from c, with metadata when c keeps it
+func getEntry(ctx context.Context, c Cache, key string) (*Entry, bool, error) {
+	if ec, ok := c.(EntryCache); ok {
+		return ec.GetEntry(ctx, key)
+	}
+	data, age, found, err := c.GetWithAge(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return &Entry{Data: data, Age: age}, true, nil
+}
+
+// setEntry writes key to c, with metadata when c keeps it
+func setEntry(ctx context.Context, c Cache, key string, data []byte, meta EntryMeta) error {
+	if ec, ok := c.(EntryCache); ok {
+		return ec.SetEntry(ctx, key, data, meta)
+	}
+	return c.Set(ctx, key, data)
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	upper := newTestDiskCache(t, t.TempDir(), 1024)
+	lower := newTestDiskCache(t, t.TempDir(), 4096)
+	c := NewTiered(
+		Tier{Name: "upper", Cache: upper, MaxEntryBytes: 100},
+		Tier{Name: "lower", Cache: lower},
+	)
+
+	large := bytes.Repeat([]byte("x"), 500)
+	if err := c.Set(ctx, "large.bin", large); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, found, _ := upper.Get(ctx, "large.bin"); found {
+		t.Error("Expected the large entry to skip the upper tier")
+	}
+	if data, found, _ := c.Get(ctx, "large.bin"); !found || !bytes.Equal(data, large) {
+		t.Error("Expected the large entry to be served from the lower tier")
+	}
+
+	if err := lower.SetEntry(ctx, "small.txt", []byte("small"), EntryMeta{ContentType: "text/plain"}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+	entry, found, err := c.GetEntry(ctx, "small.txt")
+	if err != nil || !found || entry.Meta.ContentType != "text/plain" {
+		t.Fatalf("Expected a hit with metadata, got %+v found=%v err=%v", entry, found, err)
+	}
+	if _, found, _ := upper.Get(ctx, "small.txt"); !found {
+		t.Error("Expected the hit to be promoted to the upper tier")
+	}
+
+	if n, err := c.Delete(ctx, "small.txt"); err != nil || n != 1 {
+		t.Errorf("Expected 1 entry deleted, got %d (%v)", n, err)
+	}
+	if _, found, _ := c.Get(ctx, "small.txt"); found {
+		t.Error("Expected small.txt to be deleted from every tier")
+	}
+
+	if err := c.Tombstone(ctx, "large.bin", time.Minute); err != nil {
+		t.Fatalf("Tombstone failed: %v", err)
+	}
+	if err := c.Set(ctx, "large.bin", large); !errors.Is(err, ErrTombstoned) {
+		t.Errorf("Expected ErrTombstoned, got %v", err)
+	}
+}
+
+// invalidationHub connects invalidators as replicas sharing a channel
+type invalidationHub struct {
+	mu   sync.Mutex
+	subs map[string]chan Invalidation
+}
+
+type hubInvalidator struct {
+	hub    *invalidationHub
+	origin string
+}
+
+func (h *invalidationHub) join(origin string) *hubInvalidator {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[string]chan Invalidation)
+	}
+	h.subs[origin] = make(chan Invalidation, 16)
+	return &hubInvalidator{hub: h, origin: origin}
+}
+
+func (i *hubInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	inv.Origin = i.origin
+	i.hub.mu.Lock()
+	defer i.hub.mu.Unlock()
+	for origin, ch := range i.hub.subs {
+		if origin != i.origin {
+			ch <- inv
+		}
+	}
+	return nil
+}
+
+func (i *hubInvalidator) Subscribe(ctx context.Context, handle func(Invalidation)) error {
+	i.hub.mu.Lock()
+	ch := i.hub.subs[i.origin]
+	i.hub.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case inv := <-ch:
+			handle(inv)
+		}
+	}
+}
+
+func TestTieredInvalidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := &invalidationHub{}
+	shared := newTestDiskCache(t, t.TempDir(), 4096)
+	newReplica := func(name string) (*Tiered, *DiskCache) {
+		local := newTestDiskCache(t, t.TempDir(), 4096)
+		c := NewTiered(Tier{Name: "shared", Cache: shared}, Tier{Name: "local", Cache: local, Local: true})
+		c.SetInvalidator(hub.join(name))
+		go c.Listen(ctx)
+		return c, local
+	}
+	a, localA := newReplica("a")
+	_, localB := newReplica("b")
+
+	for _, key := range []string{"one.txt", "two.txt", "docs/three.txt"} {
+		localB.Set(ctx, key, []byte("stale"))
+		localA.Set(ctx, key, []byte("stale"))
+	}
+	if _, err := a.Delete(ctx, "one.txt"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := a.Tombstone(ctx, "two.txt", time.Minute); err != nil {
+		t.Fatalf("Tombstone failed: %v", err)
+	}
+	if _, err := a.DeletePrefix(ctx, "docs/"); err != nil {
+		t.Fatalf("DeletePrefix failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for localB.Size() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected replica b to drop the invalidated entries, %d bytes left", localB.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if localA.Size() != 0 {
+		t.Errorf("Expected replica a to remove its own entries, %d bytes left", localA.Size())
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTombstoned is returned by Set when the key was recently deleted
+var ErrTombstoned = errors.New("cache key is tombstoned")
+
+// Tombstoner is implemented by caches that can mark deleted keys. While a
+// key's tombstone lives, reads of it miss and writes to it fail with
+// ErrTombstoned, so a fill racing with the delete can't bring the entry
+// back. Delete and purges remove the tombstone.
+type Tombstoner interface {
+	Tombstone(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// Ensure RedisCache implements Tombstoner interface
+var _ Tombstoner = (*RedisCache)(nil)
+
+// tombstone is the value stored in place of a deleted entry. Its encoding is
+// fixed so the Set script can match it byte for byte.
+var tombstone = func() []byte {
+	data, err := encodeEnvelope(EntryMeta{Tombstone: true}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}()
+
+// setUnlessTombstoned writes ARGV[2] with a TTL of ARGV[3] ms (none when 0)
+// unless the key holds the tombstone in ARGV[1]. STRLEN is compared first so
+// large entries aren't copied into the script.
+var setUnlessTombstoned = redis.NewScript(`
+if redis.call("STRLEN", KEYS[1]) == string.len(ARGV[1]) and redis.call("GET", KEYS[1]) == ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// Tombstone replaces key with a tombstone that expires after ttl
+func (c *RedisCache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("tombstone TTL must be positive, got %s", ttl)
+	}
+	key, err := c.storedKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = c.withRetry(ctx, func() error {
+		return c.client.Set(ctx, key, tombstone, ttl).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("redis tombstone error: %w", err)
+	}
+	return nil
+}
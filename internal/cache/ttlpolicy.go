@@ -0,0 +1,36 @@
+package cache
+
+import "time"
+
+// TTLPolicy picks how long an entry is cached when its object doesn't set
+// a TTL of its own. A zero TTL keeps the cache's configured TTL.
+type TTLPolicy interface {
+	TTL(key string) time.Duration
+}
+
+// RateSource reports how often a key is requested, in requests per second
+type RateSource interface {
+	Rate(key string) float64
+}
+
+// FrequencyTTL gives frequently requested keys longer TTLs. The TTL grows
+// linearly with the key's request rate from Min, for a key that is hardly
+// requested, to Max for one requested at FullRate or more. Variants are
+// rated by the requests for the key they derive from.
+type FrequencyTTL struct {
+	Min      time.Duration
+	Max      time.Duration
+	FullRate float64
+	Rates    RateSource
+}
+
+// Ensure FrequencyTTL implements TTLPolicy
+var _ TTLPolicy = FrequencyTTL{}
+
+func (p FrequencyTTL) TTL(key string) time.Duration {
+	if p.FullRate <= 0 {
+		return p.Max
+	}
+	share := min(p.Rates.Rate(BaseKey(key))/p.FullRate, 1)
+	return p.Min + time.Duration(share*float64(p.Max-p.Min))
+}
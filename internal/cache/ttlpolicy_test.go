@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+type fixedRates map[string]float64
+
+func (r fixedRates) Rate(key string) float64 {
+	return r[key]
+}
+
+func TestFrequencyTTL(t *testing.T) {
+	p := FrequencyTTL{
+		Min:      time.Minute,
+		Max:      time.Hour,
+		FullRate: 10,
+		Rates:    fixedRates{"cold.txt": 0, "warm.txt": 5, "hot.txt": 50},
+	}
+	tests := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"cold.txt", time.Minute},
+		{"warm.txt", time.Minute + 59*time.Minute/2},
+		{"hot.txt", time.Hour},
+		{VariantKey("warm.txt", "gzip"), time.Minute + 59*time.Minute/2},
+	}
+	for _, tt := range tests {
+		if got := p.TTL(tt.key); got != tt.want {
+			t.Errorf("TTL(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
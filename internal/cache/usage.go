@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/groupcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Usage describes how much a cache holds
+type Usage struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+	// Evictions counts the entries dropped to make room since the cache
+	// started
+	Evictions int64 `json:"evictions"`
+	// Tiers breaks down the usage of a Tiered cache by tier name
+	Tiers map[string]Usage `json:"tiers,omitempty"`
+}
+
+// UsageReporter is implemented by caches that can report their size
+type UsageReporter interface {
+	Usage(ctx context.Context) (Usage, error)
+}
+
+// Ensure the caches implement UsageReporter
+var (
+	_ UsageReporter = (*RedisCache)(nil)
+	_ UsageReporter = (*DiskCache)(nil)
+	_ UsageReporter = (*GroupCache)(nil)
+	_ UsageReporter = (*Tiered)(nil)
+)
+
+// Usage reports the keys in the Redis database, and the memory and
+// evictions of the whole server, which also cover other databases
+func (c *RedisCache) Usage(ctx context.Context) (Usage, error) {
+	keys, err := c.client.DBSize(ctx).Result()
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to count keys: %w", err)
+	}
+	info, err := c.client.Info(ctx).Result()
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to read server info: %w", err)
+	}
+	bytes, err := infoInt(info, "used_memory")
+	if err != nil {
+		return Usage{}, err
+	}
+	evictions, err := infoInt(info, "evicted_keys")
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Keys: keys, Bytes: bytes, Evictions: evictions}, nil
+}
+
+// infoInt reads an integer field from the output of INFO
+func infoInt(info, field string) (int64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), field+":"); ok {
+			return strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s missing from INFO", field)
+}
+
+// Usage reports the entries and total size of the cached files
+func (c *DiskCache) Usage(context.Context) (Usage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Usage{Keys: int64(len(c.entries)), Bytes: c.size, Evictions: c.evictions}, nil
+}
+
+// Usage reports the entries this process owns; hot entries copied from
+// peers aren't counted
+func (c *GroupCache) Usage(context.Context) (Usage, error) {
+	stats := c.group.CacheStats(groupcache.MainCache)
+	return Usage{Keys: stats.Items, Bytes: stats.Bytes, Evictions: stats.Evictions}, nil
+}
+
+// Usage sums the usage of the tiers that report it, so entries held by
+// several tiers are counted once per tier
+func (t *Tiered) Usage(ctx context.Context) (Usage, error) {
+	total := Usage{Tiers: make(map[string]Usage)}
+	var errs []error
+	for _, tier := range t.tiers {
+		reporter, ok := tier.Cache.(UsageReporter)
+		if !ok {
+			continue
+		}
+		usage, err := reporter.Usage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tier.Name, err))
+			continue
+		}
+		total.Keys += usage.Keys
+		total.Bytes += usage.Bytes
+		total.Evictions += usage.Evictions
+		total.Tiers[tier.Name] = usage
+	}
+	return total, errors.Join(errs...)
+}
+
+// usageCollector exports a cache's usage as gauges, read on each scrape
+type usageCollector struct {
+	cache         UsageReporter
+	timeout       time.Duration
+	bytes         *prometheus.Desc
+	keys          *prometheus.Desc
+	evictions     *prometheus.Desc
+	tierBytes     *prometheus.Desc
+	tierKeys      *prometheus.Desc
+	tierEvictions *prometheus.Desc
+}
+
+// NewUsageCollector exports the usage of c as cache_size_bytes,
+// cache_keys and cache_evictions_total, with per-tier cache_tier_*
+// equivalents for tiered caches. Usage is read on each scrape, giving up
+// after timeout.
+func NewUsageCollector(c UsageReporter, timeout time.Duration) prometheus.Collector {
+	return &usageCollector{
+		cache:         c,
+		timeout:       timeout,
+		bytes:         prometheus.NewDesc("cache_size_bytes", "Estimated bytes held by the cache", nil, nil),
+		keys:          prometheus.NewDesc("cache_keys", "Number of keys held by the cache", nil, nil),
+		evictions:     prometheus.NewDesc("cache_evictions_total", "Total number of cache entries evicted to make room", nil, nil),
+		tierBytes:     prometheus.NewDesc("cache_tier_size_bytes", "Estimated bytes held by each cache tier", []string{"tier"}, nil),
+		tierKeys:      prometheus.NewDesc("cache_tier_keys", "Number of keys held by each cache tier", []string{"tier"}, nil),
+		tierEvictions: prometheus.NewDesc("cache_tier_evictions_total", "Total number of entries evicted from each cache tier to make room", []string{"tier"}, nil),
+	}
+}
+
+func (c *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.keys
+	ch <- c.evictions
+	ch <- c.tierBytes
+	ch <- c.tierKeys
+	ch <- c.tierEvictions
+}
+
+// Collect reports what could be read; failed tiers are left out, and
+// nothing is reported when usage can't be read at all
+func (c *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	usage, err := c.cache.Usage(ctx)
+	if err != nil {
+		slog.Warn("Failed to read cache usage", "error", err)
+		if len(usage.Tiers) == 0 {
+			return
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(usage.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(usage.Keys))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(usage.Evictions))
+	for tier, tierUsage := range usage.Tiers {
+		ch <- prometheus.MustNewConstMetric(c.tierBytes, prometheus.GaugeValue, float64(tierUsage.Bytes), tier)
+		ch <- prometheus.MustNewConstMetric(c.tierKeys, prometheus.GaugeValue, float64(tierUsage.Keys), tier)
+		ch <- prometheus.MustNewConstMetric(c.tierEvictions, prometheus.CounterValue, float64(tierUsage.Evictions), tier)
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTiered_Usage(t *testing.T) {
+	ctx := context.Background()
+	upper := newTestDiskCache(t, t.TempDir(), 1024)
+	lower := newTestDiskCache(t, t.TempDir(), 4096)
+	c := NewTiered(
+		Tier{Name: "upper", Cache: upper},
+		Tier{Name: "lower", Cache: lower},
+	)
+	if err := c.Set(ctx, "a.txt", []byte("hello")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := lower.Set(ctx, "b.txt", []byte("world")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	usage, err := c.Usage(ctx)
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.Tiers["upper"].Keys != 1 || usage.Tiers["lower"].Keys != 2 || usage.Keys != 3 {
+		t.Errorf("Unexpected key counts %+v", usage)
+	}
+	if usage.Bytes != upper.Size()+lower.Size() || usage.Bytes == 0 {
+		t.Errorf("Expected the tier sizes to be summed, got %+v", usage)
+	}
+}
+
+func TestInfoInt(t *testing.T) {
+	info := "# Memory\r\nused_memory:1048576\r\nused_memory_human:1.00M\r\n# Stats\r\nevicted_keys:7\r\n"
+	if got, err := infoInt(info, "used_memory"); err != nil || got != 1048576 {
+		t.Errorf("Expected 1048576, got %d (%v)", got, err)
+	}
+	if got, err := infoInt(info, "evicted_keys"); err != nil || got != 7 {
+		t.Errorf("Expected 7, got %d (%v)", got, err)
+	}
+	if _, err := infoInt("# Memory\r\n", "used_memory"); err == nil {
+		t.Error("Expected an error without used_memory")
+	}
+}
+
+func TestDiskCache_UsageCountsEvictions(t *testing.T) {
+	ctx := context.Background()
+	c := newTestDiskCache(t, t.TempDir(), 1024)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, key, make([]byte, 400)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if _, err := c.Delete(ctx, "c"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	usage, err := c.Usage(ctx)
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	// Deletes aren't evictions
+	if usage.Evictions != 1 || usage.Keys != 1 {
+		t.Errorf("Expected 1 eviction leaving 1 key, got %+v", usage)
+	}
+}
+
+func TestUsageCollector(t *testing.T) {
+	ctx := context.Background()
+	disk := newTestDiskCache(t, t.TempDir(), 4096)
+	c := NewTiered(Tier{Name: "disk", Cache: disk})
+	if err := c.Set(ctx, "a.txt", []byte("hello")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	collector := NewUsageCollector(c, time.Second)
+	want := fmt.Sprintf(`
+# HELP cache_keys Number of keys held by the cache
+# TYPE cache_keys gauge
+cache_keys 1
+# HELP cache_tier_size_bytes Estimated bytes held by each cache tier
+# TYPE cache_tier_size_bytes gauge
+cache_tier_size_bytes{tier="disk"} %d
+`, disk.Size())
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "cache_keys", "cache_tier_size_bytes"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// variantSeparator joins a base key and a variant name. '#' can never appear
+// in a file name taken from a request path, so derived keys can't collide
+// with real objects.
+const variantSeparator = "#"
+
+// VariantKey returns the cache key for a derived variant of base (a thumbnail,
+// compressed encoding, extracted archive entry and so on)
+func VariantKey(base, variant string) string {
+	return base + variantSeparator + variant
+}
+
+// BaseKey returns the key a variant key was derived from, or key itself
+// when it isn't a variant
+func BaseKey(key string) string {
+	base, _, _ := strings.Cut(key, variantSeparator)
+	return base
+}
+
+// variantIndexKey is where the set of derived keys for base is recorded. It
+// shares the base key's prefix so prefix purges sweep it up as well.
+func variantIndexKey(base string) string {
+	return base + variantSeparator + "variants"
+}
+
+// VariantIndex tracks which derived keys were produced from a base key so
+// they can be purged together with it
+type VariantIndex interface {
+	AddVariant(ctx context.Context, base, key string) error
+	Variants(ctx context.Context, base string) ([]string, error)
+}
+
+// PurgeKeys deletes keys from c and, when c keeps a variant index, every
+// derived key registered for them. It returns the number of entries removed.
+func PurgeKeys(ctx context.Context, c Cache, keys ...string) (int64, error) {
+	if idx, ok := c.(VariantIndex); ok {
+		expanded := make([]string, 0, len(keys))
+		for _, key := range keys {
+			variants, err := idx.Variants(ctx, key)
+			if err != nil {
+				return 0, fmt.Errorf("failed to list variants of %s: %w", key, err)
+			}
+			expanded = append(expanded, key, variantIndexKey(key))
+			expanded = append(expanded, variants...)
+		}
+		keys = expanded
+	}
+	return c.Delete(ctx, keys...)
+}
+
+// Ensure RedisCache implements VariantIndex interface
+var _ VariantIndex = (*RedisCache)(nil)
+
+// AddVariant records key as derived from base. The index expires with the
+// cache TTL so it never outlives the entries it points to.
+func (c *RedisCache) AddVariant(ctx context.Context, base, key string) error {
+	indexKey, err := c.storedKey(ctx, variantIndexKey(base))
+	if err != nil {
+		return err
+	}
+	err = c.withRetry(ctx, func() error {
+		pipe := c.client.TxPipeline()
+		pipe.SAdd(ctx, indexKey, key)
+		if ttl := c.defaultTTL(); ttl > 0 {
+			pipe.Expire(ctx, indexKey, ttl)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("redis variant index error: %w", err)
+	}
+	return nil
+}
+
+// Variants returns the derived keys recorded for base
+func (c *RedisCache) Variants(ctx context.Context, base string) ([]string, error) {
+	indexKey, err := c.storedKey(ctx, variantIndexKey(base))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	err = c.withRetry(ctx, func() (err error) {
+		keys, err = c.client.SMembers(ctx, indexKey).Result()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis variant index error: %w", err)
+	}
+	return keys, nil
+}
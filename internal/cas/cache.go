@@ -0,0 +1,182 @@
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// blobCachePrefix starts the cache keys of blobs. Like variant keys it uses
+// '#', which can't appear in a file name taken from a request path.
+const blobCachePrefix = "cas#sha256/"
+
+// minCachedBlobSize is the smallest payload stored as a blob in the cache;
+// smaller ones cost less than the reference would
+const minCachedBlobSize = 1024
+
+// Cache stores each distinct payload once under its hash. The entry for a
+// key keeps the metadata and points at the blob, so purges, tombstones and
+// variants keep working on keys while identical files share one copy.
+// Entries for a key expire like any other; blobs expire on their own.
+type Cache struct {
+	inner cache.Cache
+	ec    cache.EntryCache
+}
+
+// Ensure Cache implements the cache interfaces
+var (
+	_ cache.Cache         = (*Cache)(nil)
+	_ cache.EntryCache    = (*Cache)(nil)
+	_ cache.RangeCache    = (*Cache)(nil)
+	_ cache.Tombstoner    = (*Cache)(nil)
+	_ cache.VariantIndex  = (*Cache)(nil)
+	_ cache.UsageReporter = (*Cache)(nil)
+	_ cache.Sampler       = (*Cache)(nil)
+)
+
+// NewCache deduplicates the payloads stored in inner. Caches that can't
+// store metadata with entries are used as they are.
+func NewCache(inner cache.Cache) cache.Cache {
+	ec, ok := inner.(cache.EntryCache)
+	if !ok {
+		return inner
+	}
+	return &Cache{inner: inner, ec: ec}
+}
+
+func (c *Cache) GetEntry(ctx context.Context, key string) (*cache.Entry, bool, error) {
+	entry, found, err := c.ec.GetEntry(ctx, key)
+	if !found || err != nil || entry.Meta.Blob == "" {
+		return entry, found, err
+	}
+	// An evicted blob leaves a dangling entry, which is a miss until the
+	// file is cached again
+	data, found, err := c.inner.Get(ctx, entry.Meta.Blob)
+	if !found || err != nil {
+		return nil, false, err
+	}
+	entry.Data = data
+	entry.Meta.Blob = ""
+	return entry, true, nil
+}
+
+// GetRange reads the range from the blob the entry points at
+func (c *Cache) GetRange(ctx context.Context, key string, offset, length int64) (*cache.Entry, bool, error) {
+	rc, ok := c.inner.(cache.RangeCache)
+	if !ok {
+		return nil, false, errors.ErrUnsupported
+	}
+	entry, found, err := rc.GetRange(ctx, key, offset, length)
+	if !found || err != nil || entry.Meta.Blob == "" {
+		return entry, found, err
+	}
+	blob, found, err := rc.GetRange(ctx, entry.Meta.Blob, offset, length)
+	if !found || err != nil {
+		return nil, false, err
+	}
+	entry.Data = blob.Data
+	entry.Meta.Blob = ""
+	return entry, true, nil
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return entry.Data, true, nil
+}
+
+func (c *Cache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// SetEntry stores data under its hash, unless it is small, and meta under
+// key. The blob is written first so the entry never points at nothing.
+func (c *Cache) SetEntry(ctx context.Context, key string, data []byte, meta cache.EntryMeta) error {
+	if len(data) < minCachedBlobSize {
+		return c.ec.SetEntry(ctx, key, data, meta)
+	}
+	sum := sha256.Sum256(data)
+	blob := blobCachePrefix + hex.EncodeToString(sum[:])
+	if err := c.inner.Set(ctx, blob, data); err != nil {
+		return err
+	}
+	meta.Blob = blob
+	if meta.Size == 0 {
+		meta.Size = int64(len(data))
+	}
+	return c.ec.SetEntry(ctx, key, nil, meta)
+}
+
+func (c *Cache) Set(ctx context.Context, key string, data []byte) error {
+	return c.SetEntry(ctx, key, data, cache.EntryMeta{})
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return c.inner.Delete(ctx, keys...)
+}
+
+// DeletePrefix removes the entries under prefix. Their blobs may be shared
+// and are left to expire.
+func (c *Cache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	return c.inner.DeletePrefix(ctx, prefix)
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.inner.Ping(ctx)
+}
+
+func (c *Cache) Close() error {
+	return c.inner.Close()
+}
+
+// Tombstone tombstones key, or deletes it when the inner cache can't keep
+// tombstones
+func (c *Cache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	if ts, ok := c.inner.(cache.Tombstoner); ok {
+		return ts.Tombstone(ctx, key, ttl)
+	}
+	_, err := c.inner.Delete(ctx, key)
+	return err
+}
+
+// AddVariant records key as derived from base when the inner cache keeps a
+// variant index
+func (c *Cache) AddVariant(ctx context.Context, base, key string) error {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.AddVariant(ctx, base, key)
+	}
+	return nil
+}
+
+func (c *Cache) Variants(ctx context.Context, base string) ([]string, error) {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.Variants(ctx, base)
+	}
+	return nil, nil
+}
+
+// Usage reports the usage of the inner cache, blobs included
+func (c *Cache) Usage(ctx context.Context) (cache.Usage, error) {
+	if reporter, ok := c.inner.(cache.UsageReporter); ok {
+		return reporter.Usage(ctx)
+	}
+	return cache.Usage{}, errors.ErrUnsupported
+}
+
+// SampleKeys samples the inner cache, blob keys included
+func (c *Cache) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	if sampler, ok := c.inner.(cache.Sampler); ok {
+		return sampler.SampleKeys(ctx, n)
+	}
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,82 @@
+package cas_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/cas"
+	"github.com/ch374n/file-downloader/internal/chunked"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestCache_SharesPayloads(t *testing.T) {
+	inner := mocks.NewMockCache()
+	c := cas.NewCache(inner).(cache.EntryCache)
+	ctx := context.Background()
+
+	payload := bytes.Repeat([]byte("x"), 4096)
+	for _, key := range []string{"v1/app.tar", "v2/app.tar"} {
+		if err := c.SetEntry(ctx, key, payload, cache.EntryMeta{ContentType: "application/x-tar"}); err != nil {
+			t.Fatalf("SetEntry %s failed: %v", key, err)
+		}
+	}
+
+	entry, found, err := c.GetEntry(ctx, "v2/app.tar")
+	if err != nil || !found {
+		t.Fatalf("Expected a hit, got found=%v err=%v", found, err)
+	}
+	if !bytes.Equal(entry.Data, payload) || entry.Meta.ContentType != "application/x-tar" || entry.Meta.Blob != "" {
+		t.Errorf("Expected the payload with the key's metadata, got %d bytes and %+v", len(entry.Data), entry.Meta)
+	}
+
+	// Both keys point at the same blob, stored once
+	first, _, _ := inner.GetEntry(ctx, "v1/app.tar")
+	second, _, _ := inner.GetEntry(ctx, "v2/app.tar")
+	if first.Meta.Blob == "" || first.Meta.Blob != second.Meta.Blob || len(first.Data) != 0 {
+		t.Errorf("Expected both entries to reference one blob, got %+v and %+v", first.Meta, second.Meta)
+	}
+
+	if _, err := inner.Delete(ctx, first.Meta.Blob); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, found, _ := c.GetEntry(ctx, "v1/app.tar"); found {
+		t.Error("Expected an evicted blob to miss")
+	}
+}
+
+func TestCache_SmallPayloads(t *testing.T) {
+	inner := mocks.NewMockCache()
+	c := cas.NewCache(inner)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "small.txt", []byte("tiny")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if data, found, _ := inner.Get(ctx, "small.txt"); !found || string(data) != "tiny" {
+		t.Errorf("Expected small payloads to be stored under their key, got %q", data)
+	}
+}
+
+func TestCache_GetRange(t *testing.T) {
+	inner := mocks.NewMockCache()
+	ctx := context.Background()
+	if _, _, err := cas.NewCache(inner).(cache.RangeCache).GetRange(ctx, "a.bin", 0, 1); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected ranges to be unsupported without a range cache, got %v", err)
+	}
+
+	c := cas.NewCache(chunked.NewCache(inner, chunked.Config{Threshold: 2048, ChunkSize: 1024})).(*cas.Cache)
+	payload := bytes.Repeat([]byte("0123456789"), 500)
+	if err := c.Set(ctx, "a.bin", payload); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	entry, found, err := c.GetRange(ctx, "a.bin", 1000, 100)
+	if err != nil || !found {
+		t.Fatalf("Expected a hit, got found=%v err=%v", found, err)
+	}
+	if !bytes.Equal(entry.Data, payload[1000:1100]) || entry.Meta.Blob != "" || entry.Meta.Size != int64(len(payload)) {
+		t.Errorf("Expected the range from the blob, got %d bytes and %+v", len(entry.Data), entry.Meta)
+	}
+}
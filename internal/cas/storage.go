@@ -0,0 +1,402 @@
+// Package cas stores file content once per distinct SHA-256 hash. Objects
+// written through it are kept as blobs named by their hash, and the file
+// name holds a small reference to its blob, so identical files share both
+// storage and cache entries.
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// BlobPrefix is where blobs are stored, relative to the tenant's keys. Keys
+// under it are hidden from listings and can't be written by name.
+const BlobPrefix = ".cas/sha256/"
+
+// refContentType is stored with references so they are recognizable in the
+// bucket
+const refContentType = "application/vnd.file-cache.cas-ref+json"
+
+// maxRefSize bounds the size of a reference object. Larger objects are
+// never read to check whether they are references.
+const maxRefSize = 512
+
+// listPageSize is the page size used when scanning storage
+const listPageSize = 1000
+
+// ref is the content of the object at a file name stored by hash
+type ref struct {
+	Version     int    `json:"cas_ref"`
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// parseRef decodes data when it is a reference
+func parseRef(data []byte) (ref, bool) {
+	var r ref
+	if len(data) > maxRefSize || !bytes.HasPrefix(data, []byte(`{"cas_ref":`)) {
+		return r, false
+	}
+	if err := json.Unmarshal(data, &r); err != nil || r.Version != 1 || !validHash(r.SHA256) {
+		return r, false
+	}
+	return r, true
+}
+
+func validHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// blobKey returns the key of the blob holding content with hash sum
+func blobKey(sum string) string {
+	return BlobPrefix + sum
+}
+
+// Storage stores objects written through PutObject by content hash and
+// resolves references on reads. Objects written around it, by presigned or
+// multipart uploads, stay plain objects and are served as they are.
+type Storage struct {
+	tenant.Backend
+	grace   time.Duration
+	metrics *metrics.Metrics
+}
+
+// Ensure Storage implements the storage interfaces
+var _ tenant.Backend = (*Storage)(nil)
+
+// NewStorage stores the objects of backend by content hash. Unreferenced
+// blobs younger than grace are kept by Collect; m may be nil.
+func NewStorage(backend tenant.Backend, grace time.Duration, m *metrics.Metrics) *Storage {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return &Storage{Backend: backend, grace: grace, metrics: m}
+}
+
+// reserved fails for keys under BlobPrefix, so blobs can't be overwritten
+// with content that doesn't match their hash
+func reserved(key string) error {
+	if strings.HasPrefix(key, BlobPrefix) {
+		return fmt.Errorf("%w: %s is reserved for content-addressed blobs", storage.ErrAccessDenied, key)
+	}
+	return nil
+}
+
+func (s *Storage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.Backend.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := parseRef(data); ok {
+		return s.blob(ctx, key, r)
+	}
+	return data, nil
+}
+
+// blob reads the blob r points to. A missing blob reports key as not found.
+func (s *Storage) blob(ctx context.Context, key string, r ref) ([]byte, error) {
+	data, err := s.Backend.GetObject(ctx, blobKey(r.SHA256))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: blob %s of %s is missing", storage.ErrNotFound, r.SHA256, key)
+	}
+	return data, err
+}
+
+// GetObjectWithHeaders returns the reference's headers with the content
+// type, length and ETag of the file it points to
+func (s *Storage) GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error) {
+	data, headers, err := s.Backend.GetObjectWithHeaders(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, ok := parseRef(data)
+	if !ok {
+		return data, headers, nil
+	}
+	data, err = s.blob(ctx, key, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, refHeaders(headers, r), nil
+}
+
+// StatObject reads objects small enough to be references, to report the
+// size of the file they point to
+func (s *Storage) StatObject(ctx context.Context, key string) (http.Header, error) {
+	headers, err := s.Backend.StatObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if size, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64); err != nil || size > maxRefSize {
+		return headers, nil
+	}
+	data, err := s.Backend.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := parseRef(data); ok {
+		return refHeaders(headers, r), nil
+	}
+	return headers, nil
+}
+
+// GetObjectRange reads part of the file a reference points to. Objects
+// small enough to be references are read whole to find out.
+func (s *Storage) GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error) {
+	data, headers, err := s.Backend.GetObjectRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64); err != nil || size > maxRefSize {
+		return data, headers, nil
+	}
+	whole, headers, err := s.Backend.GetObjectWithHeaders(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, ok := parseRef(whole)
+	if !ok {
+		return data, headers, nil
+	}
+	data, _, err = s.Backend.GetObjectRange(ctx, blobKey(r.SHA256), offset, length)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w: blob %s of %s is missing", storage.ErrNotFound, r.SHA256, key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, refHeaders(headers, r), nil
+}
+
+// refHeaders describes the file r points to. The ETag is derived from the
+// content hash, so identical files share it.
+func refHeaders(headers http.Header, r ref) http.Header {
+	headers = headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("Content-Length", strconv.FormatInt(r.Size, 10))
+	headers.Set("ETag", `"`+r.SHA256+`"`)
+	headers.Del("Content-Type")
+	if r.ContentType != "" {
+		headers.Set("Content-Type", r.ContentType)
+	}
+	return headers
+}
+
+// PutObject stores data as a blob unless an identical one exists, then
+// points key at it
+func (s *Storage) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	if err := reserved(key); err != nil {
+		return err
+	}
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	sum := sha256.Sum256(content)
+	r := ref{Version: 1, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content)), ContentType: contentType}
+
+	stored, err := s.storeBlob(ctx, r.SHA256, content, contentType)
+	if err != nil {
+		return err
+	}
+	result := "deduplicated"
+	if stored {
+		result = "stored"
+	}
+	s.metrics.ContentStoreWritesTotal.WithLabelValues(result).Inc()
+
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.Backend.PutObject(ctx, key, bytes.NewReader(encoded), refContentType)
+}
+
+// storeBlob writes content unless its blob exists, reporting whether it
+// wrote it. Blobs older than half the grace period are written again, so
+// Collect can't remove one a new reference is about to point at.
+func (s *Storage) storeBlob(ctx context.Context, sum string, content []byte, contentType string) (bool, error) {
+	key := blobKey(sum)
+	headers, err := s.Backend.StatObject(ctx, key)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		return false, err
+	case s.fresh(headers):
+		return false, nil
+	}
+	if err := s.Backend.PutObject(ctx, key, bytes.NewReader(content), contentType); err != nil {
+		return false, fmt.Errorf("failed to store blob %s: %w", sum, err)
+	}
+	return true, nil
+}
+
+// fresh reports whether a blob is safe from Collect for a while yet. Blobs
+// without a known age are assumed to be.
+func (s *Storage) fresh(headers http.Header) bool {
+	modified, err := http.ParseTime(headers.Get("Last-Modified"))
+	return err != nil || time.Since(modified) < s.grace/2
+}
+
+func (s *Storage) DeleteObject(ctx context.Context, key string) error {
+	if err := reserved(key); err != nil {
+		return err
+	}
+	return s.Backend.DeleteObject(ctx, key)
+}
+
+// ListObjects hides blobs and reports the size of the files references
+// point to, reading every object small enough to be one
+func (s *Storage) ListObjects(ctx context.Context, prefix, continuationToken string, limit int) (*storage.ListResult, error) {
+	result, err := s.Backend.ListObjects(ctx, prefix, continuationToken, limit)
+	if err != nil {
+		return nil, err
+	}
+	objects := result.Objects[:0]
+	for _, obj := range result.Objects {
+		if strings.HasPrefix(obj.Key, BlobPrefix) {
+			continue
+		}
+		if obj.Size <= maxRefSize {
+			r, ok, err := s.readRef(ctx, obj.Key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				obj.Size = r.Size
+			}
+		}
+		objects = append(objects, obj)
+	}
+	result.Objects = objects
+	return result, nil
+}
+
+// readRef returns the reference stored at key, if it is one. Objects
+// deleted since they were listed aren't references.
+func (s *Storage) readRef(ctx context.Context, key string) (ref, bool, error) {
+	data, err := s.Backend.GetObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ref{}, false, nil
+	}
+	if err != nil {
+		return ref{}, false, err
+	}
+	r, ok := parseRef(data)
+	return r, ok, nil
+}
+
+func (s *Storage) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	if err := reserved(key); err != nil {
+		return nil, err
+	}
+	return s.Backend.PresignPut(ctx, key, contentType, metadata, ttl)
+}
+
+func (s *Storage) CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	if err := reserved(key); err != nil {
+		return "", err
+	}
+	return s.Backend.CreateMultipartUpload(ctx, key, contentType, metadata)
+}
+
+// Collect deletes the blobs in ctx's tenant that no reference points to
+// and that are older than the grace period, returning how many it deleted
+func (s *Storage) Collect(ctx context.Context) (int, error) {
+	// Blobs are listed before references, and each is checked again before
+	// it is deleted, so one written again for a reference made during the
+	// scan is kept
+	var candidates []string
+	err := s.scan(ctx, BlobPrefix, func(obj storage.ObjectInfo) error {
+		if time.Since(obj.LastModified) >= s.grace {
+			candidates = append(candidates, obj.Key)
+		}
+		return nil
+	})
+	if err != nil || len(candidates) == 0 {
+		return 0, err
+	}
+
+	referenced := make(map[string]bool)
+	err = s.scan(ctx, "", func(obj storage.ObjectInfo) error {
+		if obj.Size > maxRefSize || strings.HasPrefix(obj.Key, BlobPrefix) {
+			return nil
+		}
+		r, ok, err := s.readRef(ctx, obj.Key)
+		if ok {
+			referenced[blobKey(r.SHA256)] = true
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, key := range candidates {
+		if referenced[key] {
+			continue
+		}
+		headers, err := s.Backend.StatObject(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if modified, err := http.ParseTime(headers.Get("Last-Modified")); err == nil && time.Since(modified) < s.grace {
+			continue
+		}
+		if err := s.Backend.DeleteObject(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return deleted, fmt.Errorf("failed to delete blob %s: %w", key, err)
+		}
+		deleted++
+	}
+	s.metrics.ContentStoreBlobsCollectedTotal.Add(float64(deleted))
+	if deleted > 0 {
+		slog.InfoContext(ctx, "Collected unreferenced blobs", "deleted", deleted)
+	}
+	return deleted, nil
+}
+
+// scan calls fn for every object of the backend under prefix
+func (s *Storage) scan(ctx context.Context, prefix string, fn func(storage.ObjectInfo) error) error {
+	token := ""
+	for {
+		page, err := s.Backend.ListObjects(ctx, prefix, token, listPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to list %q: %w", prefix, err)
+		}
+		for _, obj := range page.Objects {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if page.NextToken == "" {
+			return nil
+		}
+		token = page.NextToken
+	}
+}
@@ -0,0 +1,111 @@
+package cas_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cas"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func TestStorage_Deduplicates(t *testing.T) {
+	backend := mocks.NewMockStorage()
+	s := cas.NewStorage(backend, time.Hour, nil)
+	ctx := context.Background()
+
+	content := strings.Repeat("build artifact ", 100)
+	for _, name := range []string{"v1/app.tar", "v2/app.tar"} {
+		if err := s.PutObject(ctx, name, strings.NewReader(content), "application/x-tar"); err != nil {
+			t.Fatalf("PutObject %s failed: %v", name, err)
+		}
+	}
+
+	blobs, err := backend.ListObjects(ctx, cas.BlobPrefix, "", 0)
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(blobs.Objects) != 1 {
+		t.Fatalf("Expected identical files to share one blob, got %d", len(blobs.Objects))
+	}
+
+	data, headers, err := s.GetObjectWithHeaders(ctx, "v2/app.tar")
+	if err != nil {
+		t.Fatalf("GetObjectWithHeaders failed: %v", err)
+	}
+	if string(data) != content {
+		t.Error("Expected the file content to be resolved through the blob")
+	}
+	if got := headers.Get("Content-Type"); got != "application/x-tar" {
+		t.Errorf("Expected the uploaded content type, got %q", got)
+	}
+	stat, err := s.StatObject(ctx, "v1/app.tar")
+	if err != nil {
+		t.Fatalf("StatObject failed: %v", err)
+	}
+	if stat.Get("Content-Length") != "1500" || stat.Get("ETag") != headers.Get("ETag") {
+		t.Errorf("Expected the file's size and a content ETag, got %v", stat)
+	}
+
+	part, partHeaders, err := s.GetObjectRange(ctx, "v1/app.tar", 15, 30)
+	if err != nil {
+		t.Fatalf("GetObjectRange failed: %v", err)
+	}
+	if string(part) != content[15:45] || partHeaders.Get("Content-Length") != "1500" {
+		t.Errorf("Expected the range of the file and its size, got %q and %v", part, partHeaders)
+	}
+
+	page, err := s.ListObjects(ctx, "", "", 0)
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(page.Objects) != 2 || page.Objects[0].Size != 1500 {
+		t.Errorf("Expected both files at their own size without blobs, got %+v", page.Objects)
+	}
+}
+
+func TestStorage_PlainObjects(t *testing.T) {
+	backend := mocks.NewMockStorage()
+	backend.SetObject("legacy.txt", []byte("stored before content addressing"))
+	s := cas.NewStorage(backend, time.Hour, nil)
+	ctx := context.Background()
+
+	data, err := s.GetObject(ctx, "legacy.txt")
+	if err != nil || string(data) != "stored before content addressing" {
+		t.Errorf("Expected plain objects to be served as they are, got %q, %v", data, err)
+	}
+	err = s.PutObject(ctx, cas.BlobPrefix+"0000", strings.NewReader("forged"), "text/plain")
+	if !errors.Is(err, storage.ErrAccessDenied) {
+		t.Errorf("Expected writes under the blob prefix to be denied, got %v", err)
+	}
+}
+
+func TestStorage_Collect(t *testing.T) {
+	backend := mocks.NewMockStorage()
+	s := cas.NewStorage(backend, time.Millisecond, nil)
+	ctx := context.Background()
+
+	for name, content := range map[string]string{"kept.txt": "kept", "deleted.txt": "deleted"} {
+		if err := s.PutObject(ctx, name, strings.NewReader(content), "text/plain"); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+	if err := s.DeleteObject(ctx, "deleted.txt"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	deleted, err := s.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected the unreferenced blob to be deleted, got %d", deleted)
+	}
+	if data, err := s.GetObject(ctx, "kept.txt"); err != nil || string(data) != "kept" {
+		t.Errorf("Expected referenced blobs to survive, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package chunked splits large cache entries into fixed-size chunks stored
+// under their own keys, so files larger than a cache's value size limit can
+// be cached and ranges of them read without loading the rest
+package chunked
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// fetchConcurrency caps the chunks of one entry read at the same time
+const fetchConcurrency = 8
+
+// Config controls which entries are split
+type Config struct {
+	// Threshold is the size above which a payload is split
+	Threshold int64
+	// ChunkSize is the size of every chunk but the last
+	ChunkSize int64
+}
+
+// Cache stores payloads larger than the threshold as chunks. The entry for
+// a key keeps the metadata and a manifest of its chunks, so purges,
+// tombstones and variants keep working on keys. Chunks carry the entry's
+// TTL; an evicted chunk leaves the entry a miss until it is cached again.
+type Cache struct {
+	inner cache.Cache
+	ec    cache.EntryCache
+	cfg   Config
+}
+
+// Ensure Cache implements the cache interfaces
+var (
+	_ cache.Cache         = (*Cache)(nil)
+	_ cache.EntryCache    = (*Cache)(nil)
+	_ cache.RangeCache    = (*Cache)(nil)
+	_ cache.Tombstoner    = (*Cache)(nil)
+	_ cache.VariantIndex  = (*Cache)(nil)
+	_ cache.UsageReporter = (*Cache)(nil)
+	_ cache.Sampler       = (*Cache)(nil)
+)
+
+// NewCache splits the large payloads stored in inner. Caches that can't
+// store metadata with entries are used as they are.
+func NewCache(inner cache.Cache, cfg Config) cache.Cache {
+	ec, ok := inner.(cache.EntryCache)
+	if !ok {
+		return inner
+	}
+	return &Cache{inner: inner, ec: ec, cfg: cfg}
+}
+
+func (c *Cache) GetEntry(ctx context.Context, key string) (*cache.Entry, bool, error) {
+	return c.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange reads only the chunks holding the range
+func (c *Cache) GetRange(ctx context.Context, key string, offset, length int64) (*cache.Entry, bool, error) {
+	entry, found, err := c.ec.GetEntry(ctx, key)
+	if !found || err != nil {
+		return entry, found, err
+	}
+	manifest := entry.Meta.Chunks
+	if manifest == nil {
+		if entry.Meta.Size == 0 {
+			entry.Meta.Size = int64(len(entry.Data))
+		}
+		start, end := cache.ResolveRange(offset, length, int64(len(entry.Data)))
+		entry.Data = entry.Data[start:end]
+		return entry, true, nil
+	}
+
+	start, end := cache.ResolveRange(offset, length, entry.Meta.Size)
+	entry.Meta.Chunks = nil
+	if start == end {
+		entry.Data = []byte{}
+		return entry, true, nil
+	}
+	first, last := int(start/manifest.Size), int((end-1)/manifest.Size)
+	data, found, err := c.fetchChunks(ctx, key, manifest, first, last)
+	if !found || err != nil {
+		return nil, false, err
+	}
+	skip := start - int64(first)*manifest.Size
+	if int64(len(data)) < skip+end-start {
+		return nil, false, fmt.Errorf("chunks of %s are shorter than its manifest", key)
+	}
+	entry.Data = data[skip : skip+end-start]
+	return entry, true, nil
+}
+
+// fetchChunks reads chunks first to last of key and joins them. A missing
+// chunk makes the whole entry a miss.
+func (c *Cache) fetchChunks(ctx context.Context, key string, manifest *cache.ChunkManifest, first, last int) ([]byte, bool, error) {
+	chunks := make([][]byte, last-first+1)
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, fetchConcurrency)
+		mu      sync.Mutex
+		missing bool
+		errs    []error
+	)
+	for i := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			data, found, err := c.inner.Get(ctx, manifest.ChunkKey(key, first+i))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				errs = append(errs, err)
+			case !found:
+				missing = true
+			default:
+				chunks[i] = data
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil || missing {
+		return nil, false, err
+	}
+	data := make([]byte, 0, int64(len(chunks))*manifest.Size)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data, true, nil
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return entry.Data, true, nil
+}
+
+func (c *Cache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	entry, found, err := c.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	return entry.Data, entry.Age, true, nil
+}
+
+// SetEntry stores data as chunks when it is larger than the threshold, and
+// meta under key. The chunks are written first so the entry never points at
+// missing ones, and those of the entry it replaces are removed after.
+func (c *Cache) SetEntry(ctx context.Context, key string, data []byte, meta cache.EntryMeta) error {
+	if int64(len(data)) <= c.cfg.Threshold {
+		return c.ec.SetEntry(ctx, key, data, meta)
+	}
+	previous := c.manifest(ctx, key)
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	manifest := &cache.ChunkManifest{
+		ID:    hex.EncodeToString(id),
+		Count: int((int64(len(data)) + c.cfg.ChunkSize - 1) / c.cfg.ChunkSize),
+		Size:  c.cfg.ChunkSize,
+	}
+	if meta.Size == 0 {
+		meta.Size = int64(len(data))
+	}
+	if meta.StoredAt.IsZero() {
+		meta.StoredAt = time.Now().UTC()
+	}
+	// Chunks expire with the entry rather than on the cache's own TTL
+	chunkMeta := cache.EntryMeta{StoredAt: meta.StoredAt, TTL: meta.TTL}
+	for i := range manifest.Count {
+		chunk := data[int64(i)*manifest.Size : min(int64(i+1)*manifest.Size, int64(len(data)))]
+		if err := c.ec.SetEntry(ctx, manifest.ChunkKey(key, i), chunk, chunkMeta); err != nil {
+			return err
+		}
+	}
+	meta.Chunks = manifest
+	if err := c.ec.SetEntry(ctx, key, nil, meta); err != nil {
+		return err
+	}
+	if previous != nil {
+		if _, err := c.inner.Delete(ctx, chunkKeys(key, previous)...); err != nil {
+			slog.WarnContext(ctx, "Failed to remove replaced chunks", "key", key, "error", err)
+		}
+	}
+	return nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, data []byte) error {
+	return c.SetEntry(ctx, key, data, cache.EntryMeta{})
+}
+
+// manifest returns the chunk manifest of the entry stored for key, if any
+func (c *Cache) manifest(ctx context.Context, key string) *cache.ChunkManifest {
+	entry, found, err := c.ec.GetEntry(ctx, key)
+	if !found || err != nil {
+		return nil
+	}
+	return entry.Meta.Chunks
+}
+
+// chunkKeys lists the keys of the chunks in manifest
+func chunkKeys(key string, manifest *cache.ChunkManifest) []string {
+	keys := make([]string, manifest.Count)
+	for i := range keys {
+		keys[i] = manifest.ChunkKey(key, i)
+	}
+	return keys
+}
+
+// Delete removes keys along with their chunks. Only the entries are
+// counted.
+func (c *Cache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	var chunks []string
+	for _, key := range keys {
+		if manifest := c.manifest(ctx, key); manifest != nil {
+			chunks = append(chunks, chunkKeys(key, manifest)...)
+		}
+	}
+	deleted, err := c.inner.Delete(ctx, keys...)
+	if err != nil || len(chunks) == 0 {
+		return deleted, err
+	}
+	_, err = c.inner.Delete(ctx, chunks...)
+	return deleted, err
+}
+
+// DeletePrefix removes the entries under prefix, whose chunks share it
+func (c *Cache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	return c.inner.DeletePrefix(ctx, prefix)
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.inner.Ping(ctx)
+}
+
+func (c *Cache) Close() error {
+	return c.inner.Close()
+}
+
+// Tombstone tombstones key and removes its chunks, or deletes it when the
+// inner cache can't keep tombstones
+func (c *Cache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	ts, ok := c.inner.(cache.Tombstoner)
+	if !ok {
+		_, err := c.Delete(ctx, key)
+		return err
+	}
+	manifest := c.manifest(ctx, key)
+	if err := ts.Tombstone(ctx, key, ttl); err != nil || manifest == nil {
+		return err
+	}
+	_, err := c.inner.Delete(ctx, chunkKeys(key, manifest)...)
+	return err
+}
+
+// AddVariant records key as derived from base when the inner cache keeps a
+// variant index
+func (c *Cache) AddVariant(ctx context.Context, base, key string) error {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.AddVariant(ctx, base, key)
+	}
+	return nil
+}
+
+func (c *Cache) Variants(ctx context.Context, base string) ([]string, error) {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.Variants(ctx, base)
+	}
+	return nil, nil
+}
+
+// Usage reports the usage of the inner cache, chunks included
+func (c *Cache) Usage(ctx context.Context) (cache.Usage, error) {
+	if reporter, ok := c.inner.(cache.UsageReporter); ok {
+		return reporter.Usage(ctx)
+	}
+	return cache.Usage{}, errors.ErrUnsupported
+}
+
+// SampleKeys samples the inner cache, chunk keys included
+func (c *Cache) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	if sampler, ok := c.inner.(cache.Sampler); ok {
+		return sampler.SampleKeys(ctx, n)
+	}
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,155 @@
+package chunked_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/chunked"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// payload returns n bytes that differ from chunk to chunk
+func payload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestCache_SplitsLargePayloads(t *testing.T) {
+	inner := mocks.NewMockCache()
+	c := chunked.NewCache(inner, chunked.Config{Threshold: 100, ChunkSize: 40}).(*chunked.Cache)
+	ctx := context.Background()
+
+	data := payload(250)
+	if err := c.SetEntry(ctx, "video.mp4", data, cache.EntryMeta{ContentType: "video/mp4"}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+
+	stored, _, _ := inner.GetEntry(ctx, "video.mp4")
+	manifest := stored.Meta.Chunks
+	if manifest == nil || manifest.Count != 7 || manifest.Size != 40 || len(stored.Data) != 0 {
+		t.Fatalf("Expected a manifest of 7 chunks in place of the payload, got %+v", stored.Meta)
+	}
+	if chunk, found, _ := inner.Get(ctx, manifest.ChunkKey("video.mp4", 6)); !found || !bytes.Equal(chunk, data[240:]) {
+		t.Errorf("Expected the last chunk to hold the last 10 bytes, got %d", len(chunk))
+	}
+
+	entry, found, err := c.GetEntry(ctx, "video.mp4")
+	if err != nil || !found {
+		t.Fatalf("Expected a hit, got found=%v err=%v", found, err)
+	}
+	if !bytes.Equal(entry.Data, data) || entry.Meta.ContentType != "video/mp4" || entry.Meta.Chunks != nil {
+		t.Errorf("Expected the whole payload with its metadata, got %d bytes and %+v", len(entry.Data), entry.Meta)
+	}
+
+	// A missing chunk makes the entry a miss
+	if _, err := inner.Delete(ctx, manifest.ChunkKey("video.mp4", 3)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, found, _ := c.GetEntry(ctx, "video.mp4"); found {
+		t.Error("Expected an evicted chunk to miss")
+	}
+}
+
+func TestCache_GetRange(t *testing.T) {
+	inner := mocks.NewMockCache()
+	c := chunked.NewCache(inner, chunked.Config{Threshold: 100, ChunkSize: 40}).(*chunked.Cache)
+	ctx := context.Background()
+
+	data := payload(250)
+	if err := c.Set(ctx, "large.bin", data); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := c.Set(ctx, "small.bin", data[:50]); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		key            string
+		offset, length int64
+		want           []byte
+	}{
+		{"within a chunk", "large.bin", 45, 10, data[45:55]},
+		{"across chunks", "large.bin", 30, 100, data[30:130]},
+		{"to the end", "large.bin", 200, -1, data[200:]},
+		{"suffix", "large.bin", -15, -1, data[235:]},
+		{"past the end", "large.bin", 240, 100, data[240:]},
+		{"unsatisfiable", "large.bin", 300, 10, []byte{}},
+		{"small entry", "small.bin", 10, 5, data[10:15]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, found, err := c.GetRange(ctx, tt.key, tt.offset, tt.length)
+			if err != nil || !found {
+				t.Fatalf("Expected a hit, got found=%v err=%v", found, err)
+			}
+			if !bytes.Equal(entry.Data, tt.want) {
+				t.Errorf("Expected %d bytes, got %d", len(tt.want), len(entry.Data))
+			}
+			if entry.Meta.Size != int64(len(data)) && tt.key == "large.bin" {
+				t.Errorf("Expected the size of the whole payload, got %d", entry.Meta.Size)
+			}
+		})
+	}
+
+	// Only the chunks holding the range are read
+	stored, _, _ := inner.GetEntry(ctx, "large.bin")
+	if _, err := inner.Delete(ctx, stored.Meta.Chunks.ChunkKey("large.bin", 0)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, found, _ := c.GetRange(ctx, "large.bin", 100, 20); !found {
+		t.Error("Expected a range clear of the evicted chunk to hit")
+	}
+}
+
+func TestCache_RemovesChunks(t *testing.T) {
+	inner := mocks.NewMockCache()
+	c := chunked.NewCache(inner, chunked.Config{Threshold: 100, ChunkSize: 40}).(*chunked.Cache)
+	ctx := context.Background()
+
+	chunkKeys := func(key string) []string {
+		stored, _, _ := inner.GetEntry(ctx, key)
+		var keys []string
+		for i := range stored.Meta.Chunks.Count {
+			keys = append(keys, stored.Meta.Chunks.ChunkKey(key, i))
+		}
+		return keys
+	}
+	assertGone := func(keys []string, why string) {
+		t.Helper()
+		for _, key := range keys {
+			if _, found, _ := inner.Get(ctx, key); found {
+				t.Errorf("Expected chunk %s to be removed %s", key, why)
+			}
+		}
+	}
+
+	if err := c.Set(ctx, "a.bin", payload(200)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	replaced := chunkKeys("a.bin")
+	if err := c.Set(ctx, "a.bin", payload(300)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	assertGone(replaced, "once replaced")
+
+	current := chunkKeys("a.bin")
+	if deleted, err := c.Delete(ctx, "a.bin"); err != nil || deleted != 1 {
+		t.Fatalf("Expected 1 entry deleted, got %d (%v)", deleted, err)
+	}
+	assertGone(current, "with their entry")
+
+	if err := c.Set(ctx, "b.bin", payload(200)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	tombstoned := chunkKeys("b.bin")
+	if err := c.Tombstone(ctx, "b.bin", 0); err != nil {
+		t.Fatalf("Tombstone failed: %v", err)
+	}
+	assertGone(tombstoned, "when tombstoned")
+}
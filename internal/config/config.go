@@ -1,7 +1,11 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -13,13 +17,107 @@ type RedisMode string
 const (
 	RedisModeDisabled RedisMode = "disabled" // No caching
 	RedisModeEnabled  RedisMode = "enabled"  // Redis caching enabled
+	RedisModeSentinel RedisMode = "sentinel" // Redis caching through Sentinel-managed failover
+)
+
+// CacheBackend selects the shared cache
+type CacheBackend string
+
+const (
+	CacheBackendRedis      CacheBackend = "redis"      // Redis, configured by REDIS_MODE
+	CacheBackendGroupcache CacheBackend = "groupcache" // Peer-to-peer cache embedded in the replicas
 )
 
 type Config struct {
-	Port     string
-	LogLevel string
-	Redis    RedisConfig
-	R2       R2Config
+	Port string
+	// Listen lists the HTTP listener addresses, as parsed by the listen
+	// package; empty listens on Port on every interface
+	Listen string
+	// AdminAddr lists the listener addresses of the health, metrics, debug
+	// and admin endpoints; empty serves them on the public listeners
+	AdminAddr  string
+	LogLevel   string
+	AdminToken string
+	// AdminTokens lists scoped admin credentials as name:token:scope|scope
+	AdminTokens string
+	// AdminClientCerts lists scopes granted to client certificates as
+	// name:scope|scope, matched against their common name and SANs
+	AdminClientCerts string
+	// MaxResponseBytes caps the size of JSON list responses
+	MaxResponseBytes int64
+	// ShutdownTimeout bounds draining requests and background jobs
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long /readyz fails on shutdown before the listeners
+	// close, giving load balancers time to stop routing to the replica
+	DrainDelay time.Duration
+	// ConfigWatchInterval is how often the config file is checked for
+	// changes to reload; 0 reloads on SIGHUP only
+	ConfigWatchInterval time.Duration
+	// ReadyRequiresCache fails /readyz while the cache is unreachable
+	ReadyRequiresCache bool
+	HealthCheck        HealthCheckConfig
+	Timeouts           TimeoutConfig
+	Server             ServerConfig
+	// HeaderPassthrough lists object headers copied onto file responses
+	HeaderPassthrough []string
+	// CacheControl is the Cache-Control header sent with files, and
+	// CacheControlRules overrides it per extension (see
+	// handlers.ParseCacheControlRules)
+	CacheControl      string
+	CacheControlRules string
+	// FilenameMaxLength and FilenamePattern restrict the names of files
+	// requests may use, on top of the built-in checks
+	FilenameMaxLength int
+	FilenamePattern   string
+	// RefreshRequiresAdmin limits ?refresh=true to admin credentials
+	RefreshRequiresAdmin bool
+	// APIDocs serves Swagger UI for /openapi.json at /docs
+	APIDocs bool
+	// MetricsPaths lists request paths that get their own label in HTTP
+	// metrics; other requests are labeled by route
+	MetricsPaths []string
+	// WarmersFile is a JSON file declaring scheduled cache warmers
+	WarmersFile string
+	Warm        WarmConfig
+	// TenantsFile is a JSON file declaring the tenants sharing the
+	// deployment; without it there is a single tenant
+	TenantsFile string
+
+	// CacheBackend selects the shared cache: Redis or Groupcache
+	CacheBackend CacheBackend
+
+	Redis       RedisConfig
+	Groupcache  GroupcacheConfig
+	DiskCache   DiskCacheConfig
+	R2          R2Config
+	Stream      StreamConfig
+	Compression CompressionConfig
+	Signing     SigningConfig
+	Policy      PolicyConfig
+	Keys        KeysConfig
+	Upload      UploadConfig
+	Mirror      MirrorConfig
+	Prefetch    PrefetchConfig
+	Legacy      LegacyConfig
+	RetryBudget RetryBudgetConfig
+	Quota       QuotaConfig
+	CAS         CASConfig
+	Chunks      ChunkConfig
+	Scrub       ScrubConfig
+	Images      ImagesConfig
+	Archive     ArchiveConfig
+	Encryption  EncryptionConfig
+	Reports     ReportsConfig
+	GRPC        GRPCConfig
+	S3          S3Config
+	WebDAV      WebDAVConfig
+	Pipeline    PipelineConfig
+	Events      EventsConfig
+	HotKeys     HotKeysConfig
+	Debug       DebugConfig
+	AccessLog   AccessLogConfig
+	TLS         TLSConfig
+	CORS        CORSConfig
 }
 
 type RedisConfig struct {
@@ -28,11 +126,515 @@ type RedisConfig struct {
 	Password string
 	DB       int
 	CacheTTL time.Duration
+	// TTLJitter shortens each entry's TTL by a random share of up to this
+	// fraction of it, so entries stored together expire spread out
+	TTLJitter float64
+
+	// Sentinel settings, used in sentinel mode
+	SentinelMaster   string
+	SentinelAddrs    []string
+	SentinelPassword string
+
+	// TLS settings
+	TLSEnabled            bool
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
 
 	// Timeout settings (optimized for in-cluster Redis)
 	DialTimeout  time.Duration
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// Entry format self-check run at startup
+	FormatSampleSize     int
+	MigrateLegacyEntries bool
+
+	// TombstoneTTL is how long deleted files are kept out of the cache
+	TombstoneTTL time.Duration
+
+	// MaxEntryBytes keeps larger files out of Redis; 0 means no limit
+	MaxEntryBytes int64
+
+	// NamespaceDepth is how many leading path segments form a namespace that
+	// can be flushed in constant time; 0 disables namespaces.
+	// GenerationRefresh is how long replicas reuse a namespace's generation.
+	NamespaceDepth    int
+	GenerationRefresh time.Duration
+
+	// BreakerThreshold consecutive failures bypass Redis for
+	// BreakerCooldown; 0 disables the breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// FillLock makes replicas take a Redis lock before fetching a missed
+	// file, held for up to FillLockTTL; the others wait up to FillLockWait
+	// for it to be cached
+	FillLock     bool
+	FillLockTTL  time.Duration
+	FillLockWait time.Duration
+
+	// TTLPolicy is "fixed" to cache every file for CacheTTL, or "frequency"
+	// to scale each file's TTL between TTLMin and TTLMax by its request rate
+	TTLPolicy string
+	TTLMin    time.Duration
+	TTLMax    time.Duration
+
+	// Compression is the codec payloads are compressed with before they are
+	// stored in Redis: "none", "snappy" or "zstd". Payloads under
+	// CompressionMinBytes, or shrinking to more than CompressionMaxRatio of
+	// their size, are stored as they are.
+	Compression         string
+	CompressionMinBytes int
+	CompressionMaxRatio float64
+
+	// InvalidationChannel is the pub/sub channel replicas announce removed
+	// keys on, so they drop them from their disk caches; empty disables it
+	InvalidationChannel string
+}
+
+// GroupcacheConfig controls the peer-to-peer cache used when CacheBackend
+// is groupcache
+type GroupcacheConfig struct {
+	// Addr is the listen address for peer requests
+	Addr string
+	// Self is this replica's base URL as peers reach it
+	Self string
+	// Peers lists peer base URLs, and PeersDNS is a name resolved to peer
+	// addresses every PeersRefresh
+	Peers        []string
+	PeersDNS     string
+	PeersRefresh time.Duration
+	// CacheBytes caps the memory used for cached files on each replica
+	CacheBytes int64
+}
+
+// DiskCacheConfig controls the local disk cache tier
+type DiskCacheConfig struct {
+	// Dir holds the cached files; the disk cache is off when empty
+	Dir string
+	// MaxBytes caps the total size of the cached files
+	MaxBytes int64
+}
+
+// StreamConfig controls adaptive chunking of response bodies
+type StreamConfig struct {
+	MinChunkSize        int
+	MaxChunkSize        int
+	TargetWriteDuration time.Duration
+}
+
+// CompressionConfig controls compression of responses
+type CompressionConfig struct {
+	Enabled bool
+	// Encodings are offered in order of preference; empty uses the defaults
+	Encodings []string
+	MinBytes  int
+	// ContentTypes lists compressible media types; empty uses the defaults
+	ContentTypes []string
+	// CacheVariants keeps compressed copies of cached files in the cache
+	CacheVariants bool
+	// Precompressed serves .br/.gz copies stored next to files; whether a
+	// copy exists is remembered for PrecompressedCheckTTL
+	Precompressed         bool
+	PrecompressedCheckTTL time.Duration
+}
+
+// SigningConfig holds the HMAC keys used for signed links
+type SigningConfig struct {
+	// Keys is a comma-separated list of id:secret pairs; the last one signs
+	Keys string
+	// RetireOverlap is how long a retired key keeps verifying by default
+	RetireOverlap time.Duration
+	// URLDefaultTTL and URLMaxTTL bound the lifetime of presigned URLs
+	URLDefaultTTL time.Duration
+	URLMaxTTL     time.Duration
+	// PublicBaseURL prefixes presigned URLs; derived from the request when empty
+	PublicBaseURL string
+}
+
+// WarmConfig bounds on-demand cache warming
+type WarmConfig struct {
+	MaxJobs        int
+	MaxConcurrency int
+	Timeout        time.Duration
+	// PreloadManifest lists keys to warm at startup: a file path, or a
+	// storage key prefixed with "storage:"
+	PreloadManifest    string
+	PreloadConcurrency int
+}
+
+// MirrorConfig controls mirroring of read traffic to a shadow deployment
+type MirrorConfig struct {
+	// URL is the shadow deployment base URL; mirroring is off when empty
+	URL          string
+	SampleRate   float64
+	MaxInFlight  int
+	MaxPerSecond float64
+	Timeout      time.Duration
+}
+
+// PrefetchConfig controls loading the files that follow sequential reads
+type PrefetchConfig struct {
+	// Depth is how many files are loaded ahead; prefetching is off when 0
+	Depth        int
+	Window       time.Duration
+	MaxInFlight  int
+	MaxPerSecond float64
+	Timeout      time.Duration
+}
+
+// LegacyConfig controls the fallback to a legacy HTTP origin during a data
+// migration
+type LegacyConfig struct {
+	// URL is the legacy server's base URL; the fallback is off when empty
+	URL string
+	// Prefixes lists the keys looked up on the legacy server when missing
+	// from storage; "*" covers every key
+	Prefixes []string
+	// Backfill copies legacy files into storage and the cache
+	Backfill bool
+	Timeout  time.Duration
+}
+
+// QuotaConfig caps the bytes stored. Tenant quotas are declared in the
+// tenants file.
+type QuotaConfig struct {
+	// Rules are prefix=bytes pairs for requests without a tenant; a prefix
+	// of * covers every key
+	Rules []string
+	// Reconcile recounts usage from the bucket listing on a schedule
+	Reconcile string
+}
+
+// CASConfig controls content-addressable storage
+type CASConfig struct {
+	// Enabled stores files written through the service, and cache entries,
+	// once per distinct content hash
+	Enabled bool
+	// Collect deletes unreferenced blobs on a schedule; off when empty
+	Collect string
+	// Grace is how old an unreferenced blob must be to be collected
+	Grace time.Duration
+}
+
+// ChunkConfig controls splitting large files into chunks in the cache
+type ChunkConfig struct {
+	// Threshold is the size above which files are split; 0 disables it
+	Threshold int64
+	// Size is the size of each chunk
+	Size int64
+	// RangeBlockSize is the size of the blocks ranges of files not cached
+	// whole are cached in; 0 disables it
+	RangeBlockSize int64
+}
+
+// ScrubConfig controls the cache integrity scrubber
+type ScrubConfig struct {
+	// Schedule checks a sample of cached files against storage; off when
+	// empty
+	Schedule string
+	// Sample is the number of cache keys checked per run
+	Sample int
+}
+
+// ImagesConfig controls image resizing and conversion on GET /files
+type ImagesConfig struct {
+	Enabled bool
+	// MaxDimension caps the requested width and height in pixels
+	MaxDimension int
+	// Sizes lists the only widths and heights allowed; any up to
+	// MaxDimension when empty
+	Sizes []int
+	// MaxPixels caps the pixels of the source images transformed
+	MaxPixels int
+}
+
+// ArchiveConfig limits the archives served by GET /archive and the files
+// served from inside stored archives
+type ArchiveConfig struct {
+	MaxFiles int
+	MaxBytes int64
+	// MembersEnabled serves files inside archives at
+	// GET /files/{archive}!/{path}
+	MembersEnabled bool
+	// MaxMemberBytes caps the size of a file extracted from an archive
+	MaxMemberBytes int64
+}
+
+// EncryptionConfig controls encryption of objects and cached payloads
+type EncryptionConfig struct {
+	Enabled bool
+	// MasterKeys is a comma-separated list of id:base64-key pairs; the last
+	// one wraps new data keys
+	MasterKeys string
+	// KMSURL is the Vault transit engine wrapping data keys instead of the
+	// master keys, with KMSKey naming the key and KMSToken authenticating
+	KMSURL   string
+	KMSKey   string
+	KMSToken string
+	// Prefixes lists the key prefixes encrypted, each optionally preceded
+	// by bucket:; every key when empty
+	Prefixes []string
+	// Cache encrypts cached payloads too
+	Cache bool
+}
+
+// ReportsConfig controls the cache efficiency report
+type ReportsConfig struct {
+	// Schedule publishes reports to storage; publishing is off when empty
+	Schedule string
+	// StoragePrefix is where published reports are written
+	StoragePrefix string
+	// PrefixDepth is how many path segments group keys in the report
+	PrefixDepth int
+	// EgressCostPerGB and ReadCostPerMillion price storage reads
+	EgressCostPerGB    float64
+	ReadCostPerMillion float64
+	TopMisses          int
+}
+
+// RetryBudgetConfig bounds the backend retries a single request can trigger
+type RetryBudgetConfig struct {
+	// Retries is shared by every storage and cache call of a request
+	Retries int
+	// Window is how long after the request starts retries may begin
+	Window time.Duration
+}
+
+// PipelineConfig controls the post-upload pipeline
+type PipelineConfig struct {
+	// Steps names the steps uploads go through, in order; the pipeline is
+	// off when empty
+	Steps       []string
+	Workers     int
+	QueueSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+	StepTimeout time.Duration
+	// MaxBytes caps the files whose content is loaded for processing
+	MaxBytes        int64
+	ThumbnailPrefix string
+	ThumbnailSize   int
+	WebhookURL      string
+	WebhookSecret   string
+}
+
+// HotKeysConfig controls hot key detection and pinning
+type HotKeysConfig struct {
+	// Window is how far back request rates are measured; zero disables
+	// hot key tracking
+	Window time.Duration
+	// Threshold is the rate in requests per second at which a key is hot
+	Threshold float64
+	// PinBytes caps the memory holding hot files; zero disables pinning
+	PinBytes int64
+	// PinTTL is how long a hot file stays pinned once copied to memory
+	PinTTL time.Duration
+}
+
+// EventsConfig controls the notifications sent for file events
+type EventsConfig struct {
+	// WebhookURLs lists the URLs every event is posted to; events are off
+	// when empty
+	WebhookURLs []string
+	// WebhookSecret signs webhook bodies when set
+	WebhookSecret string
+	// Types selects the events posted to webhooks; every type but
+	// file.accessed when empty
+	Types []string
+	// Stream is the broker events are streamed to: kafka, nats, or empty
+	// for none
+	Stream        string
+	StreamBrokers []string
+	// StreamTopic is the Kafka topic or the NATS subject
+	StreamTopic  string
+	StreamFormat string
+	// StreamTypes selects the events streamed; every type when empty
+	StreamTypes    []string
+	StreamTLS      bool
+	StreamUsername string
+	StreamPassword string
+	QueueSize      int
+	MaxAttempts    int
+	Backoff        time.Duration
+	Timeout        time.Duration
+}
+
+// S3Config controls the S3-compatible API
+type S3Config struct {
+	// Addr lists the S3 API listener addresses; the S3 API is off when empty
+	Addr string
+	// Bucket is the name storage is exposed under
+	Bucket string
+	// MaxObjectSize caps the size of uploaded objects
+	MaxObjectSize int64
+}
+
+// WebDAVConfig controls the WebDAV API under /dav/
+type WebDAVConfig struct {
+	Enabled bool
+	// MaxFileSize caps the size of files written
+	MaxFileSize int64
+}
+
+// GRPCConfig controls the gRPC API
+type GRPCConfig struct {
+	// Addr lists the gRPC listener addresses; the gRPC API is off when empty
+	Addr string
+	// ChunkSize is the size of the chunks files are streamed in
+	ChunkSize int
+}
+
+// HealthCheckConfig controls the background checks of the cache and
+// storage reported by the health endpoints
+type HealthCheckConfig struct {
+	// Interval between checks; 0 checks on every health request instead
+	Interval time.Duration
+	// Timeout bounds each check
+	Timeout time.Duration
+}
+
+// TimeoutConfig bounds the work done for requests and by the dependencies
+// serving them
+type TimeoutConfig struct {
+	// Request bounds serving a file request, storage and cache calls
+	// included
+	Request time.Duration
+	// Storage bounds each storage request, retries included. It is shorter
+	// than Request so a slow bucket is told apart from a slow request.
+	Storage time.Duration
+	// Cache bounds each cache read and write; zero leaves them to Request
+	Cache time.Duration
+	// DisconnectGrace is how long a storage fetch goes on after its client
+	// disconnects, so a nearly complete fetch still fills the cache; zero
+	// cancels fetches with their client
+	DisconnectGrace time.Duration
+}
+
+// ServerConfig bounds the connections of the HTTP servers, so slow or
+// idle clients can't hold them open indefinitely
+type ServerConfig struct {
+	// ReadTimeout bounds reading a whole request, body included
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout bounds reading request headers
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout bounds writing a response, from the end of the request
+	// headers
+	WriteTimeout time.Duration
+	// IdleTimeout is how long keep-alive connections wait for the next
+	// request
+	IdleTimeout time.Duration
+	// TransferTimeout replaces ReadTimeout and WriteTimeout on the routes
+	// moving file bodies, which can take far longer than other requests;
+	// zero lifts both there
+	TransferTimeout time.Duration
+	// MaxHeaderBytes caps the size of request headers
+	MaxHeaderBytes int
+	// MaxInFlight caps the file requests served at once; 0 means no limit
+	MaxInFlight int
+	// MaxQueue caps the file requests waiting for one of those slots
+	MaxQueue int
+	// QueueTimeout bounds how long a file request waits for a slot
+	QueueTimeout time.Duration
+}
+
+// DebugConfig controls the debug server serving pprof and expvar
+type DebugConfig struct {
+	// Addr lists the debug listener addresses; the debug server is off when
+	// empty, and requires admin credentials unless every address is loopback
+	Addr string
+	// DumpDir is where POST /debug/dump writes goroutine and heap dumps
+	DumpDir string
+}
+
+// TLSConfig controls TLS termination on the LISTEN listeners that don't
+// set their own certificate
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertDomains enables certificates from ACME (Let's Encrypt by
+	// default) for these host names
+	AutocertDomains      []string
+	AutocertEmail        string
+	AutocertCacheDir     string
+	AutocertDirectoryURL string
+	// ClientCAFile enables client certificate checks against these CAs
+	ClientCAFile string
+	// ClientAuth is require or optional
+	ClientAuth string
+	// ClientAllowedNames, when set, limits client certificates to those
+	// with one of these common names or SANs
+	ClientAllowedNames []string
+	// RedirectAddr lists plain-HTTP listeners that redirect to HTTPS and
+	// answer ACME HTTP challenges
+	RedirectAddr string
+}
+
+// CORSConfig controls cross-origin requests from browsers; empty
+// AllowedOrigins disables CORS and empty lists use the defaults
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+// AccessLogConfig controls the line logged for every HTTP request
+type AccessLogConfig struct {
+	// Format is json, combined (Apache) or off
+	Format string
+	// Output is stdout, stderr or a file path to append to
+	Output string
+	// TrustedProxies lists the proxy addresses and CIDR ranges whose
+	// X-Forwarded-For entries identify the client
+	TrustedProxies []string
+}
+
+// UploadConfig controls resumable multipart uploads
+type UploadConfig struct {
+	// PartSize is the size of every part except the last
+	PartSize int64
+}
+
+// PolicyConfig holds request policy expressions (see internal/policy)
+type PolicyConfig struct {
+	// Cache selects which fetched files may be cached; empty caches everything
+	Cache string
+	// Deny selects requests to reject; empty denies nothing
+	Deny string
+}
+
+// KeysConfig controls how requested file names map to storage keys
+type KeysConfig struct {
+	// CaseInsensitivePrefixes lists key prefixes looked up regardless of case;
+	// "*" covers every key
+	CaseInsensitivePrefixes []string
+	// CanonicalRedirect answers mismatched casing with a redirect to the
+	// stored name instead of serving it directly
+	CanonicalRedirect bool
+	// IndexRefresh is how often the case-insensitive key index and the
+	// existence filter are rebuilt
+	IndexRefresh time.Duration
+	// ExistencePrefixes lists key prefixes whose missing keys are answered
+	// from an existence filter without reaching storage; "*" covers every
+	// key, and none disables the filter
+	ExistencePrefixes []string
+	// ExistenceFalsePositiveRate is the share of missing keys the filter
+	// still looks up in storage
+	ExistenceFalsePositiveRate float64
+	// ExistenceChannel is the Redis channel replicas announce the keys
+	// they write on; empty keeps writes local to each replica until the
+	// next refresh
+	ExistenceChannel string
+	// MetadataTTL is how long the metadata and existence of objects looked
+	// up in storage are remembered; zero disables the metadata cache
+	MetadataTTL time.Duration
+	// MetadataMaxEntries bounds the objects whose metadata is remembered
+	MetadataMaxEntries int
 }
 
 type R2Config struct {
@@ -40,63 +642,535 @@ type R2Config struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	BucketName      string
+	// MaxIdleConns caps the idle connections kept open to each bucket
+	MaxIdleConns int
+	// MaxConnsPerHost caps the connections open to each bucket at once
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake of new connections
+	TLSHandshakeTimeout time.Duration
+	// ParallelThreshold is the size above which objects are read as
+	// several ranges at once; 0 reads every object with one request
+	ParallelThreshold int64
+	// ParallelPartSize is the size of each of those ranges
+	ParallelPartSize int64
+	// ParallelConcurrency caps the ranges of one object read at once
+	ParallelConcurrency int
 }
 
-func Load() *Config {
-	redisMode := parseRedisMode(getEnv("REDIS_MODE", "enabled"))
+// Load reads the configuration from the environment, falling back to the
+// YAML file at path for unset variables when path isn't empty. It reports
+// every invalid value, unknown file key and inconsistent setting at once.
+func Load(path string) (*Config, error) {
+	l := &loader{used: make(map[string]bool)}
+	if path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		l.file = file
+	}
+
+	cfg := l.load()
+	errs := append(l.errs, l.unknownKeys()...)
+	if err := errors.Join(append(errs, cfg.Validate())...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+func (l *loader) load() *Config {
+	redisMode := parseRedisMode(l.getEnv("REDIS_MODE", "enabled"))
 
 	return &Config{
-		Port:     getEnv("PORT", "8080"),
-		LogLevel: getEnv("LOG_LEVEL", "info"),
+		Port:              l.getEnv("PORT", "8080"),
+		Listen:            l.getEnv("LISTEN", ""),
+		AdminAddr:         l.getEnv("ADMIN_ADDR", ""),
+		LogLevel:          l.getEnv("LOG_LEVEL", "info"),
+		AdminToken:        l.getEnv("ADMIN_TOKEN", ""),
+		AdminTokens:       l.getEnv("ADMIN_TOKENS", ""),
+		AdminClientCerts:  l.getEnv("ADMIN_CLIENT_CERTS", ""),
+		MaxResponseBytes:  int64(l.getEnvAsInt("JSON_MAX_RESPONSE_BYTES", 8*1024*1024)),
+		ShutdownTimeout:   l.getEnvAsDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		DrainDelay:        l.getEnvAsDuration("SHUTDOWN_DRAIN_DELAY", 0),
+		WarmersFile:       l.getEnv("WARMERS_FILE", ""),
+		TenantsFile:       l.getEnv("TENANTS_FILE", ""),
+		HeaderPassthrough: l.getEnvAsList("RESPONSE_HEADER_PASSTHROUGH"),
+
+		CacheControl:         l.getEnv("RESPONSE_CACHE_CONTROL", ""),
+		CacheControlRules:    l.getEnv("RESPONSE_CACHE_CONTROL_RULES", ""),
+		FilenameMaxLength:    l.getEnvAsInt("FILENAME_MAX_LENGTH", 1024),
+		FilenamePattern:      l.getEnv("FILENAME_PATTERN", ""),
+		RefreshRequiresAdmin: l.getEnvAsBool("REFRESH_REQUIRES_ADMIN", false),
+		ReadyRequiresCache:   l.getEnvAsBool("READY_REQUIRES_CACHE", false),
+		ConfigWatchInterval:  l.getEnvAsDuration("CONFIG_WATCH_INTERVAL", 10*time.Second),
+		APIDocs:              l.getEnvAsBool("API_DOCS_ENABLED", false),
+		MetricsPaths:         l.getEnvAsList("METRICS_PATH_ALLOWLIST"),
+		CacheBackend:         parseCacheBackend(l.getEnv("CACHE_BACKEND", "redis")),
 		Redis: RedisConfig{
-			Mode:         redisMode,
-			Addr:         getEnv("REDIS_ADDR", "localhost:6379"),
-			Password:     getEnv("REDIS_PASSWORD", ""),
-			DB:           getEnvAsInt("REDIS_DB", 0),
-			CacheTTL:     getEnvAsDuration("CACHE_TTL", 5*time.Minute),
-			DialTimeout:  getEnvAsDuration("REDIS_DIAL_TIMEOUT", 2*time.Second),
-			ReadTimeout:  getEnvAsDuration("REDIS_READ_TIMEOUT", 5*time.Second),
-			WriteTimeout: getEnvAsDuration("REDIS_WRITE_TIMEOUT", 5*time.Second),
+			Mode:      redisMode,
+			Addr:      l.getEnv("REDIS_ADDR", "localhost:6379"),
+			Password:  l.getEnv("REDIS_PASSWORD", ""),
+			DB:        l.getEnvAsInt("REDIS_DB", 0),
+			CacheTTL:  l.getEnvAsDuration("CACHE_TTL", 5*time.Minute),
+			TTLJitter: l.getEnvAsPercent("CACHE_TTL_JITTER", 0),
+
+			SentinelMaster:   l.getEnv("REDIS_SENTINEL_MASTER", "mymaster"),
+			SentinelAddrs:    l.getEnvAsList("REDIS_SENTINEL_ADDRS"),
+			SentinelPassword: l.getEnv("REDIS_SENTINEL_PASSWORD", ""),
+
+			TLSEnabled:            l.getEnvAsBool("REDIS_TLS_ENABLED", false),
+			TLSCAFile:             l.getEnv("REDIS_TLS_CA_FILE", ""),
+			TLSCertFile:           l.getEnv("REDIS_TLS_CERT_FILE", ""),
+			TLSKeyFile:            l.getEnv("REDIS_TLS_KEY_FILE", ""),
+			TLSInsecureSkipVerify: l.getEnvAsBool("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+
+			DialTimeout:  l.getEnvAsDuration("REDIS_DIAL_TIMEOUT", 2*time.Second),
+			ReadTimeout:  l.getEnvAsDuration("REDIS_READ_TIMEOUT", 5*time.Second),
+			WriteTimeout: l.getEnvAsDuration("REDIS_WRITE_TIMEOUT", 5*time.Second),
+
+			FormatSampleSize:     l.getEnvAsInt("CACHE_FORMAT_SAMPLE_SIZE", 100),
+			MigrateLegacyEntries: l.getEnvAsBool("CACHE_MIGRATE_LEGACY", false),
+
+			TombstoneTTL: l.getEnvAsDuration("CACHE_TOMBSTONE_TTL", time.Minute),
+
+			MaxEntryBytes: int64(l.getEnvAsInt("REDIS_MAX_ENTRY_BYTES", 0)),
+
+			NamespaceDepth:    l.getEnvAsInt("CACHE_NAMESPACE_DEPTH", 0),
+			GenerationRefresh: l.getEnvAsDuration("CACHE_GENERATION_REFRESH", time.Second),
+
+			BreakerThreshold: l.getEnvAsInt("REDIS_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  l.getEnvAsDuration("REDIS_BREAKER_COOLDOWN", 30*time.Second),
+
+			FillLock:     l.getEnvAsBool("CACHE_FILL_LOCK", false),
+			FillLockTTL:  l.getEnvAsDuration("CACHE_FILL_LOCK_TTL", 10*time.Second),
+			FillLockWait: l.getEnvAsDuration("CACHE_FILL_LOCK_WAIT", 2*time.Second),
+
+			TTLPolicy: strings.ToLower(l.getEnv("CACHE_TTL_POLICY", "fixed")),
+			TTLMin:    l.getEnvAsDuration("CACHE_TTL_MIN", time.Minute),
+			TTLMax:    l.getEnvAsDuration("CACHE_TTL_MAX", time.Hour),
+
+			Compression:         strings.ToLower(l.getEnv("REDIS_COMPRESSION", "none")),
+			CompressionMinBytes: l.getEnvAsInt("REDIS_COMPRESSION_MIN_BYTES", 1024),
+			CompressionMaxRatio: l.getEnvAsFloat("REDIS_COMPRESSION_MAX_RATIO", 0.9),
+
+			InvalidationChannel: l.getEnv("REDIS_INVALIDATION_CHANNEL", "file-cache:invalidations"),
+		},
+		Groupcache: GroupcacheConfig{
+			Addr:         l.getEnv("GROUPCACHE_ADDR", ":8081"),
+			Self:         l.getEnv("GROUPCACHE_SELF", ""),
+			Peers:        l.getEnvAsList("GROUPCACHE_PEERS"),
+			PeersDNS:     l.getEnv("GROUPCACHE_PEERS_DNS", ""),
+			PeersRefresh: l.getEnvAsDuration("GROUPCACHE_PEERS_REFRESH", 30*time.Second),
+			CacheBytes:   int64(l.getEnvAsInt("GROUPCACHE_CACHE_BYTES", 256*1024*1024)),
+		},
+		DiskCache: DiskCacheConfig{
+			Dir:      l.getEnv("DISK_CACHE_DIR", ""),
+			MaxBytes: int64(l.getEnvAsInt("DISK_CACHE_MAX_BYTES", 10*1024*1024*1024)),
 		},
 		R2: R2Config{
-			AccountID:       getEnv("R2_ACCOUNT_ID", ""),
-			AccessKeyID:     getEnv("R2_ACCESS_KEY_ID", ""),
-			SecretAccessKey: getEnv("R2_SECRET_ACCESS_KEY", ""),
-			BucketName:      getEnv("R2_BUCKET_NAME", ""),
+			AccountID:       l.getEnv("R2_ACCOUNT_ID", ""),
+			AccessKeyID:     l.getEnv("R2_ACCESS_KEY_ID", ""),
+			SecretAccessKey: l.getEnv("R2_SECRET_ACCESS_KEY", ""),
+			BucketName:      l.getEnv("R2_BUCKET_NAME", ""),
+
+			MaxIdleConns:        l.getEnvAsInt("R2_MAX_IDLE_CONNS", 100),
+			MaxConnsPerHost:     l.getEnvAsInt("R2_MAX_CONNS_PER_HOST", 2048),
+			IdleConnTimeout:     l.getEnvAsDuration("R2_IDLE_CONN_TIMEOUT", 90*time.Second),
+			TLSHandshakeTimeout: l.getEnvAsDuration("R2_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+
+			ParallelThreshold:   int64(l.getEnvAsInt("R2_PARALLEL_DOWNLOAD_THRESHOLD", 0)),
+			ParallelPartSize:    int64(l.getEnvAsInt("R2_PARALLEL_DOWNLOAD_PART_SIZE", 8*1024*1024)),
+			ParallelConcurrency: l.getEnvAsInt("R2_PARALLEL_DOWNLOAD_CONCURRENCY", 8),
+		},
+		Signing: SigningConfig{
+			Keys:          l.getEnv("SIGNING_KEYS", ""),
+			RetireOverlap: l.getEnvAsDuration("SIGNING_KEY_OVERLAP", 24*time.Hour),
+			URLDefaultTTL: l.getEnvAsDuration("PRESIGN_DEFAULT_TTL", 15*time.Minute),
+			URLMaxTTL:     l.getEnvAsDuration("PRESIGN_MAX_TTL", 7*24*time.Hour),
+			PublicBaseURL: l.getEnv("PUBLIC_BASE_URL", ""),
+		},
+		Policy: PolicyConfig{
+			Cache: l.getEnv("POLICY_CACHE", ""),
+			Deny:  l.getEnv("POLICY_DENY", ""),
+		},
+		Upload: UploadConfig{
+			PartSize: int64(l.getEnvAsInt("MULTIPART_PART_SIZE", 16*1024*1024)),
+		},
+		Warm: WarmConfig{
+			MaxJobs:        l.getEnvAsInt("WARM_MAX_JOBS", 4),
+			MaxConcurrency: l.getEnvAsInt("WARM_MAX_CONCURRENCY", 16),
+			Timeout:        l.getEnvAsDuration("WARM_JOB_TIMEOUT", time.Hour),
+
+			PreloadManifest:    l.getEnv("CACHE_PRELOAD_MANIFEST", ""),
+			PreloadConcurrency: l.getEnvAsInt("CACHE_PRELOAD_CONCURRENCY", 8),
+		},
+		Mirror: MirrorConfig{
+			URL:          l.getEnv("MIRROR_URL", ""),
+			SampleRate:   l.getEnvAsFloat("MIRROR_SAMPLE_RATE", 0.01),
+			MaxInFlight:  l.getEnvAsInt("MIRROR_MAX_INFLIGHT", 16),
+			MaxPerSecond: l.getEnvAsFloat("MIRROR_MAX_RPS", 20),
+			Timeout:      l.getEnvAsDuration("MIRROR_TIMEOUT", 10*time.Second),
+		},
+		Prefetch: PrefetchConfig{
+			Depth:        l.getEnvAsInt("PREFETCH_DEPTH", 0),
+			Window:       l.getEnvAsDuration("PREFETCH_WINDOW", 30*time.Second),
+			MaxInFlight:  l.getEnvAsInt("PREFETCH_MAX_INFLIGHT", 8),
+			MaxPerSecond: l.getEnvAsFloat("PREFETCH_MAX_RPS", 20),
+			Timeout:      l.getEnvAsDuration("PREFETCH_TIMEOUT", 30*time.Second),
+		},
+		Legacy: LegacyConfig{
+			URL:      l.getEnv("LEGACY_ORIGIN_URL", ""),
+			Prefixes: l.getEnvAsList("LEGACY_ORIGIN_PREFIXES"),
+			Backfill: l.getEnvAsBool("LEGACY_ORIGIN_BACKFILL", false),
+			Timeout:  l.getEnvAsDuration("LEGACY_ORIGIN_TIMEOUT", 30*time.Second),
+		},
+		RetryBudget: RetryBudgetConfig{
+			Retries: l.getEnvAsInt("RETRY_BUDGET", 3),
+			Window:  l.getEnvAsDuration("RETRY_BUDGET_WINDOW", 10*time.Second),
+		},
+		Quota: QuotaConfig{
+			Rules:     l.getEnvAsList("STORAGE_QUOTAS"),
+			Reconcile: l.getEnv("STORAGE_QUOTA_RECONCILE", "@every 1h"),
+		},
+		CAS: CASConfig{
+			Enabled: l.getEnvAsBool("CAS_ENABLED", false),
+			Collect: l.getEnv("CAS_GC_SCHEDULE", ""),
+			Grace:   l.getEnvAsDuration("CAS_GC_GRACE", 24*time.Hour),
+		},
+		Chunks: ChunkConfig{
+			Threshold:      int64(l.getEnvAsInt("CACHE_CHUNK_THRESHOLD", 0)),
+			Size:           int64(l.getEnvAsInt("CACHE_CHUNK_SIZE", 1<<20)),
+			RangeBlockSize: int64(l.getEnvAsInt("CACHE_RANGE_BLOCK_SIZE", 0)),
+		},
+		Scrub: ScrubConfig{
+			Schedule: l.getEnv("CACHE_SCRUB_SCHEDULE", ""),
+			Sample:   l.getEnvAsInt("CACHE_SCRUB_SAMPLE", 100),
+		},
+		Images: ImagesConfig{
+			Enabled:      l.getEnvAsBool("IMAGE_TRANSFORMS_ENABLED", false),
+			MaxDimension: l.getEnvAsInt("IMAGE_MAX_DIMENSION", 4096),
+			Sizes:        l.getEnvAsIntList("IMAGE_SIZES"),
+			MaxPixels:    l.getEnvAsInt("IMAGE_MAX_SOURCE_PIXELS", 50_000_000),
+		},
+		Archive: ArchiveConfig{
+			MaxFiles:       l.getEnvAsInt("ARCHIVE_MAX_FILES", 1000),
+			MaxBytes:       int64(l.getEnvAsInt("ARCHIVE_MAX_BYTES", 1024*1024*1024)),
+			MembersEnabled: l.getEnvAsBool("ARCHIVE_MEMBERS_ENABLED", false),
+			MaxMemberBytes: int64(l.getEnvAsInt("ARCHIVE_MAX_MEMBER_BYTES", 256*1024*1024)),
+		},
+		Encryption: EncryptionConfig{
+			Enabled:    l.getEnvAsBool("ENCRYPTION_ENABLED", false),
+			MasterKeys: l.getEnv("ENCRYPTION_MASTER_KEYS", ""),
+			KMSURL:     l.getEnv("ENCRYPTION_KMS_URL", ""),
+			KMSKey:     l.getEnv("ENCRYPTION_KMS_KEY", ""),
+			KMSToken:   l.getEnv("ENCRYPTION_KMS_TOKEN", ""),
+			Prefixes:   l.getEnvAsList("ENCRYPTION_PREFIXES"),
+			Cache:      l.getEnvAsBool("ENCRYPTION_CACHE", true),
+		},
+		Reports: ReportsConfig{
+			Schedule:           l.getEnv("EFFICIENCY_REPORT_SCHEDULE", ""),
+			StoragePrefix:      l.getEnv("EFFICIENCY_REPORT_PREFIX", "reports/cache-efficiency"),
+			PrefixDepth:        l.getEnvAsInt("EFFICIENCY_PREFIX_DEPTH", 1),
+			EgressCostPerGB:    l.getEnvAsFloat("EFFICIENCY_EGRESS_COST_PER_GB", 0),
+			ReadCostPerMillion: l.getEnvAsFloat("EFFICIENCY_READ_COST_PER_MILLION", 0.36),
+			TopMisses:          l.getEnvAsInt("EFFICIENCY_TOP_MISSES", 20),
+		},
+		GRPC: GRPCConfig{
+			Addr:      l.getEnv("GRPC_ADDR", ""),
+			ChunkSize: l.getEnvAsInt("GRPC_CHUNK_SIZE", 64*1024),
+		},
+		Pipeline: PipelineConfig{
+			Steps:           l.getEnvAsList("UPLOAD_PIPELINE_STEPS"),
+			Workers:         l.getEnvAsInt("UPLOAD_PIPELINE_WORKERS", 2),
+			QueueSize:       l.getEnvAsInt("UPLOAD_PIPELINE_QUEUE_SIZE", 100),
+			MaxAttempts:     l.getEnvAsInt("UPLOAD_PIPELINE_MAX_ATTEMPTS", 3),
+			Backoff:         l.getEnvAsDuration("UPLOAD_PIPELINE_BACKOFF", time.Second),
+			StepTimeout:     l.getEnvAsDuration("UPLOAD_PIPELINE_STEP_TIMEOUT", time.Minute),
+			MaxBytes:        int64(l.getEnvAsInt("UPLOAD_PIPELINE_MAX_BYTES", 32*1024*1024)),
+			ThumbnailPrefix: l.getEnv("UPLOAD_THUMBNAIL_PREFIX", "thumbnails/"),
+			ThumbnailSize:   l.getEnvAsInt("UPLOAD_THUMBNAIL_SIZE", 256),
+			WebhookURL:      l.getEnv("UPLOAD_WEBHOOK_URL", ""),
+			WebhookSecret:   l.getEnv("UPLOAD_WEBHOOK_SECRET", ""),
+		},
+		HotKeys: HotKeysConfig{
+			Window:    l.getEnvAsDuration("HOT_KEY_WINDOW", time.Minute),
+			Threshold: l.getEnvAsFloat("HOT_KEY_THRESHOLD", 10),
+			PinBytes:  int64(l.getEnvAsInt("HOT_KEY_PIN_BYTES", 64<<20)),
+			PinTTL:    l.getEnvAsDuration("HOT_KEY_PIN_TTL", time.Minute),
+		},
+		Events: EventsConfig{
+			WebhookURLs:    l.getEnvAsList("EVENT_WEBHOOK_URLS"),
+			WebhookSecret:  l.getEnv("EVENT_WEBHOOK_SECRET", ""),
+			Types:          l.getEnvAsList("EVENT_TYPES"),
+			Stream:         l.getEnv("EVENT_STREAM", ""),
+			StreamBrokers:  l.getEnvAsList("EVENT_STREAM_BROKERS"),
+			StreamTopic:    l.getEnv("EVENT_STREAM_TOPIC", "file-events"),
+			StreamFormat:   l.getEnv("EVENT_STREAM_FORMAT", "json"),
+			StreamTypes:    l.getEnvAsList("EVENT_STREAM_TYPES"),
+			StreamTLS:      l.getEnvAsBool("EVENT_STREAM_TLS", false),
+			StreamUsername: l.getEnv("EVENT_STREAM_USERNAME", ""),
+			StreamPassword: l.getEnv("EVENT_STREAM_PASSWORD", ""),
+			QueueSize:      l.getEnvAsInt("EVENT_QUEUE_SIZE", 1000),
+			MaxAttempts:    l.getEnvAsInt("EVENT_MAX_ATTEMPTS", 5),
+			Backoff:        l.getEnvAsDuration("EVENT_RETRY_BACKOFF", time.Second),
+			Timeout:        l.getEnvAsDuration("EVENT_TIMEOUT", 10*time.Second),
+		},
+		S3: S3Config{
+			Addr:          l.getEnv("S3_ADDR", ""),
+			Bucket:        l.getEnv("S3_BUCKET", "files"),
+			MaxObjectSize: int64(l.getEnvAsInt("S3_MAX_OBJECT_SIZE", 64*1024*1024)),
+		},
+		WebDAV: WebDAVConfig{
+			Enabled:     l.getEnvAsBool("WEBDAV_ENABLED", false),
+			MaxFileSize: int64(l.getEnvAsInt("WEBDAV_MAX_FILE_SIZE", 64*1024*1024)),
+		},
+		HealthCheck: HealthCheckConfig{
+			Interval: l.getEnvAsDuration("HEALTH_CHECK_INTERVAL", 10*time.Second),
+			Timeout:  l.getEnvAsDuration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
+		},
+		Server: ServerConfig{
+			ReadTimeout:       l.getEnvAsDuration("HTTP_READ_TIMEOUT", 5*time.Minute),
+			ReadHeaderTimeout: l.getEnvAsDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+			WriteTimeout:      l.getEnvAsDuration("HTTP_WRITE_TIMEOUT", 10*time.Minute),
+			IdleTimeout:       l.getEnvAsDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+			TransferTimeout:   l.getEnvAsDuration("HTTP_TRANSFER_TIMEOUT", time.Hour),
+			MaxHeaderBytes:    l.getEnvAsInt("HTTP_MAX_HEADER_BYTES", 64*1024),
+			MaxInFlight:       l.getEnvAsInt("MAX_IN_FLIGHT_REQUESTS", 0),
+			MaxQueue:          l.getEnvAsInt("IN_FLIGHT_QUEUE_SIZE", 64),
+			QueueTimeout:      l.getEnvAsDuration("IN_FLIGHT_QUEUE_TIMEOUT", time.Second),
+		},
+		Timeouts: TimeoutConfig{
+			Request:         l.getEnvAsDuration("REQUEST_TIMEOUT", 30*time.Second),
+			Storage:         l.getEnvAsDuration("STORAGE_TIMEOUT", 25*time.Second),
+			Cache:           l.getEnvAsDuration("CACHE_TIMEOUT", 10*time.Second),
+			DisconnectGrace: l.getEnvAsDuration("FETCH_DISCONNECT_GRACE", 0),
+		},
+		Debug: DebugConfig{
+			Addr:    l.getEnv("DEBUG_ADDR", ""),
+			DumpDir: l.getEnv("DEBUG_DUMP_DIR", os.TempDir()),
+		},
+		AccessLog: AccessLogConfig{
+			Format:         l.getEnv("ACCESS_LOG_FORMAT", "json"),
+			Output:         l.getEnv("ACCESS_LOG_OUTPUT", "stdout"),
+			TrustedProxies: l.getEnvAsList("TRUSTED_PROXIES"),
+		},
+		TLS: TLSConfig{
+			CertFile:             l.getEnv("TLS_CERT_FILE", ""),
+			KeyFile:              l.getEnv("TLS_KEY_FILE", ""),
+			AutocertDomains:      l.getEnvAsList("TLS_AUTOCERT_DOMAINS"),
+			AutocertEmail:        l.getEnv("TLS_AUTOCERT_EMAIL", ""),
+			AutocertCacheDir:     l.getEnv("TLS_AUTOCERT_CACHE_DIR", ""),
+			AutocertDirectoryURL: l.getEnv("TLS_AUTOCERT_DIRECTORY_URL", ""),
+			ClientCAFile:         l.getEnv("TLS_CLIENT_CA_FILE", ""),
+			ClientAuth:           l.getEnv("TLS_CLIENT_AUTH", "require"),
+			ClientAllowedNames:   l.getEnvAsList("TLS_CLIENT_ALLOWED_NAMES"),
+			RedirectAddr:         l.getEnv("HTTP_REDIRECT_ADDR", ""),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   l.getEnvAsList("CORS_ALLOWED_ORIGINS"),
+			AllowedMethods:   l.getEnvAsList("CORS_ALLOWED_METHODS"),
+			AllowedHeaders:   l.getEnvAsList("CORS_ALLOWED_HEADERS"),
+			ExposedHeaders:   l.getEnvAsList("CORS_EXPOSED_HEADERS"),
+			MaxAge:           l.getEnvAsDuration("CORS_MAX_AGE", 10*time.Minute),
+			AllowCredentials: l.getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+		},
+		Keys: KeysConfig{
+			CaseInsensitivePrefixes:    l.getEnvAsList("CASE_INSENSITIVE_PREFIXES"),
+			CanonicalRedirect:          l.getEnvAsBool("CANONICAL_REDIRECT", true),
+			IndexRefresh:               l.getEnvAsDuration("KEY_INDEX_REFRESH", 5*time.Minute),
+			ExistencePrefixes:          l.getEnvAsList("EXISTENCE_FILTER_PREFIXES"),
+			ExistenceFalsePositiveRate: l.getEnvAsFloat("EXISTENCE_FILTER_FALSE_POSITIVE_RATE", 0.01),
+			ExistenceChannel:           l.getEnv("EXISTENCE_FILTER_CHANNEL", "file-cache:existence"),
+			MetadataTTL:                l.getEnvAsDuration("METADATA_CACHE_TTL", 0),
+			MetadataMaxEntries:         l.getEnvAsInt("METADATA_CACHE_MAX_ENTRIES", 100000),
+		},
+		Stream: StreamConfig{
+			MinChunkSize:        l.getEnvAsInt("STREAM_MIN_CHUNK_SIZE", 4*1024),
+			MaxChunkSize:        l.getEnvAsInt("STREAM_MAX_CHUNK_SIZE", 1024*1024),
+			TargetWriteDuration: l.getEnvAsDuration("STREAM_TARGET_WRITE_DURATION", 50*time.Millisecond),
 		},
+		Compression: CompressionConfig{
+			Enabled:               l.getEnvAsBool("COMPRESSION_ENABLED", true),
+			Encodings:             l.getEnvAsList("COMPRESSION_ENCODINGS"),
+			MinBytes:              l.getEnvAsInt("COMPRESSION_MIN_BYTES", 1024),
+			ContentTypes:          l.getEnvAsList("COMPRESSION_CONTENT_TYPES"),
+			CacheVariants:         l.getEnvAsBool("COMPRESSION_CACHE_VARIANTS", false),
+			Precompressed:         l.getEnvAsBool("COMPRESSION_PRECOMPRESSED", false),
+			PrecompressedCheckTTL: l.getEnvAsDuration("COMPRESSION_PRECOMPRESSED_CHECK_TTL", 5*time.Minute),
+		},
+	}
+}
+
+// redacted replaces secrets in reports of the configuration
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of c with credentials replaced, safe to include
+// in diagnostics
+func (c Config) Redacted() Config {
+	redact := func(s *string) {
+		if *s != "" {
+			*s = redacted
+		}
 	}
+	redact(&c.AdminToken)
+	redact(&c.AdminTokens)
+	redact(&c.Redis.Password)
+	redact(&c.Redis.SentinelPassword)
+	redact(&c.R2.AccessKeyID)
+	redact(&c.R2.SecretAccessKey)
+	redact(&c.Signing.Keys)
+	redact(&c.Encryption.MasterKeys)
+	redact(&c.Encryption.KMSToken)
+	redact(&c.Pipeline.WebhookSecret)
+	redact(&c.Events.WebhookSecret)
+	redact(&c.Events.StreamPassword)
+	rawURLs := []*string{&c.Mirror.URL, &c.Legacy.URL, &c.Pipeline.WebhookURL}
+	c.Events.WebhookURLs = slices.Clone(c.Events.WebhookURLs)
+	for i := range c.Events.WebhookURLs {
+		rawURLs = append(rawURLs, &c.Events.WebhookURLs[i])
+	}
+	for _, rawURL := range rawURLs {
+		if u, err := url.Parse(*rawURL); err == nil && u.User != nil {
+			*rawURL = u.Redacted()
+		}
+	}
+	return c
 }
 
 func parseRedisMode(mode string) RedisMode {
 	switch strings.ToLower(mode) {
 	case "disabled", "none", "off", "false":
 		return RedisModeDisabled
+	case "sentinel":
+		return RedisModeSentinel
 	default:
 		return RedisModeEnabled
 	}
 }
 
-func getEnv(key, defaultValue string) string {
+func parseCacheBackend(backend string) CacheBackend {
+	switch strings.ToLower(backend) {
+	case "groupcache":
+		return CacheBackendGroupcache
+	default:
+		return CacheBackendRedis
+	}
+}
+
+// loader reads settings from the environment, falling back to values from
+// a config file, and collects invalid values as it goes
+type loader struct {
+	file map[string]fileValue
+	// used records every key an option reads, to find unknown file keys
+	used map[string]bool
+	errs []error
+}
+
+// lookup returns the value of key and where it came from, for errors
+func (l *loader) lookup(key string) (value, source string) {
+	l.used[key] = true
 	if value := os.Getenv(key); value != "" {
+		return value, key
+	}
+	if v, ok := l.file[key]; ok {
+		return v.value, v.source
+	}
+	return "", key
+}
+
+func (l *loader) invalid(source, value, want string) {
+	l.errs = append(l.errs, fmt.Errorf("%s: %q is not %s", source, value, want))
+}
+
+func (l *loader) getEnv(key, defaultValue string) string {
+	if value, _ := l.lookup(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
+func (l *loader) getEnvAsInt(key string, defaultValue int) int {
+	if value, source := l.lookup(key); value != "" {
+		intVal, err := strconv.Atoi(value)
+		if err == nil {
 			return intVal
 		}
+		l.invalid(source, value, "an integer")
 	}
 	return defaultValue
 }
 
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
+func (l *loader) getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, source := l.lookup(key); value != "" {
+		floatVal, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return floatVal
+		}
+		l.invalid(source, value, "a number")
+	}
+	return defaultValue
+}
+
+// getEnvAsPercent parses a percentage such as "10%" into a fraction; the
+// percent sign is optional
+func (l *loader) getEnvAsPercent(key string, defaultValue float64) float64 {
+	if value, source := l.lookup(key); value != "" {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+		if err == nil {
+			return percent / 100
+		}
+		l.invalid(source, value, "a percentage")
+	}
+	return defaultValue
+}
+
+func (l *loader) getEnvAsBool(key string, defaultValue bool) bool {
+	if value, source := l.lookup(key); value != "" {
+		boolVal, err := strconv.ParseBool(value)
+		if err == nil {
+			return boolVal
+		}
+		l.invalid(source, value, "a boolean")
+	}
+	return defaultValue
+}
+
+// getEnvAsList splits a comma-separated value, dropping empty entries
+func (l *loader) getEnvAsList(key string) []string {
+	value, _ := l.lookup(key)
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvAsIntList splits a comma-separated list of integers
+func (l *loader) getEnvAsIntList(key string) []int {
+	_, source := l.lookup(key)
+	var list []int
+	for _, item := range l.getEnvAsList(key) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			l.invalid(source, item, "an integer")
+			continue
+		}
+		list = append(list, n)
+	}
+	return list
+}
+
+func (l *loader) getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, source := l.lookup(key); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err == nil && duration >= 0 {
 			return duration
 		}
+		l.invalid(source, value, "a non-negative duration")
 	}
 	return defaultValue
 }
@@ -0,0 +1,258 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/config"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+// setRequired sets the settings without defaults
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("R2_ACCOUNT_ID", "account")
+	t.Setenv("R2_ACCESS_KEY_ID", "key")
+	t.Setenv("R2_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("R2_BUCKET_NAME", "bucket")
+}
+
+func TestLoad_FileWithEnvOverrides(t *testing.T) {
+	setRequired(t)
+	path := writeConfig(t, `
+port: 9090
+cache_ttl: 10m
+redis:
+  addr: redis:6379
+  sentinel_addrs: [a:26379, b:26379]
+MIRROR_SAMPLE_RATE: 0.5
+`)
+	t.Setenv("REDIS_ADDR", "override:6379")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Expected the config to load, got %v", err)
+	}
+	if cfg.Port != "9090" || cfg.Redis.CacheTTL != 10*time.Minute || cfg.Mirror.SampleRate != 0.5 {
+		t.Errorf("Expected settings from the file, got port %q, ttl %v, sample rate %v", cfg.Port, cfg.Redis.CacheTTL, cfg.Mirror.SampleRate)
+	}
+	if cfg.Redis.Addr != "override:6379" {
+		t.Errorf("Expected the environment to override the file, got %q", cfg.Redis.Addr)
+	}
+	if got := strings.Join(cfg.Redis.SentinelAddrs, ","); got != "a:26379,b:26379" {
+		t.Errorf("Expected the list from the file, got %q", got)
+	}
+	if cfg.Redis.DialTimeout != 2*time.Second {
+		t.Errorf("Expected defaults for unset keys, got %v", cfg.Redis.DialTimeout)
+	}
+}
+
+func TestLoad_ReportsEveryError(t *testing.T) {
+	path := writeConfig(t, `
+redis:
+  adr: redis:6379
+  db: one
+mystery: true
+`)
+	t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+	t.Setenv("MIRROR_SAMPLE_RATE", "2")
+
+	_, err := config.Load(path)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{
+		"config.yaml:3: redis.adr: unknown key (did you mean redis_addr?)",
+		"config.yaml:5: mystery: unknown key\n",
+		`config.yaml:4: redis.db: "one" is not an integer`,
+		`SHUTDOWN_TIMEOUT: "-1s" is not a non-negative duration`,
+		"MIRROR_SAMPLE_RATE must be between 0 and 1",
+	} {
+		if !strings.Contains(err.Error()+"\n", want) {
+			t.Errorf("Expected the error to contain %q, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoad_DuplicateKeys(t *testing.T) {
+	path := writeConfig(t, `
+redis_addr: a:6379
+redis:
+  addr: b:6379
+`)
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "already set at") {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestLoad_EnvOnly(t *testing.T) {
+	setRequired(t)
+	t.Setenv("PORT", "7070")
+	t.Setenv("CACHE_TTL_JITTER", "10%")
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Expected the config to load, got %v", err)
+	}
+	if cfg.Port != "7070" {
+		t.Errorf("Expected the port from the environment, got %q", cfg.Port)
+	}
+	if cfg.Redis.TTLJitter != 0.1 {
+		t.Errorf("Expected a TTL jitter of 0.1, got %v", cfg.Redis.TTLJitter)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	setRequired(t)
+	tests := []struct {
+		name   string
+		modify func(c *config.Config)
+		want   string
+	}{
+		{name: "defaults", modify: func(*config.Config) {}},
+		{name: "missing bucket", modify: func(c *config.Config) { c.R2.BucketName = "" }, want: "R2_BUCKET_NAME is required"},
+		{name: "bad port", modify: func(c *config.Config) { c.Port = "http" }, want: `PORT "http" is not a port number`},
+		{name: "listen overrides port", modify: func(c *config.Config) { c.Port, c.Listen = "http", ":9090" }},
+		{name: "bad listener", modify: func(c *config.Config) { c.AdminAddr = "localhost" }, want: "ADMIN_ADDR: invalid listener"},
+		{name: "shared port", modify: func(c *config.Config) { c.AdminAddr = "127.0.0.1:8080" }, want: "LISTEN and ADMIN_ADDR both listen on port 8080"},
+		{name: "separate hosts", modify: func(c *config.Config) { c.Listen, c.AdminAddr = "10.0.0.1:8080", "127.0.0.1:8080" }},
+		{name: "zero shutdown timeout", modify: func(c *config.Config) { c.ShutdownTimeout = 0 }, want: "SHUTDOWN_TIMEOUT must be positive"},
+		{
+			name:   "sentinel without addresses",
+			modify: func(c *config.Config) { c.Redis.Mode = config.RedisModeSentinel },
+			want:   "REDIS_SENTINEL_ADDRS is required",
+		},
+		{
+			name:   "groupcache without self",
+			modify: func(c *config.Config) { c.CacheBackend = config.CacheBackendGroupcache },
+			want:   "GROUPCACHE_SELF is required",
+		},
+		{name: "cert without key", modify: func(c *config.Config) { c.Redis.TLSCertFile = "cert.pem" }, want: "REDIS_TLS_KEY_FILE"},
+		{
+			name:   "autocert without cache",
+			modify: func(c *config.Config) { c.TLS.AutocertDomains = []string{"files.example.com"} },
+			want:   "TLS_AUTOCERT_CACHE_DIR is required",
+		},
+		{
+			name: "certificate and autocert",
+			modify: func(c *config.Config) {
+				c.TLS.CertFile, c.TLS.KeyFile, c.TLS.AutocertCacheDir = "cert.pem", "key.pem", "/var/cache/acme"
+				c.TLS.AutocertDomains = []string{"files.example.com"}
+			},
+			want: "mutually exclusive",
+		},
+		{name: "client CA without TLS", modify: func(c *config.Config) { c.TLS.ClientCAFile = "ca.pem" }, want: "TLS_CLIENT_CA_FILE requires"},
+		{
+			name:   "allowed names without client CA",
+			modify: func(c *config.Config) { c.TLS.ClientAllowedNames = []string{"deployer"} },
+			want:   "TLS_CLIENT_ALLOWED_NAMES requires TLS_CLIENT_CA_FILE",
+		},
+		{name: "client auth mode", modify: func(c *config.Config) { c.TLS.ClientAuth = "maybe" }, want: "TLS_CLIENT_AUTH"},
+		{name: "client certificate scopes", modify: func(c *config.Config) { c.AdminClientCerts = "deployer:cache:nuke" }, want: "ADMIN_CLIENT_CERTS"},
+		{
+			name: "CORS credentials for any origin",
+			modify: func(c *config.Config) {
+				c.CORS.AllowedOrigins, c.CORS.AllowCredentials = []string{"*"}, true
+			},
+			want: "CORS_ALLOW_CREDENTIALS",
+		},
+		{name: "CORS origin without scheme", modify: func(c *config.Config) { c.CORS.AllowedOrigins = []string{"app.example.com"} }, want: "CORS_ALLOWED_ORIGINS"},
+		{name: "filename pattern", modify: func(c *config.Config) { c.FilenamePattern = "[a-z" }, want: "FILENAME_PATTERN"},
+		{name: "storage quota without limit", modify: func(c *config.Config) { c.Quota.Rules = []string{"uploads/"} }, want: "STORAGE_QUOTAS"},
+		{name: "quota reconcile schedule", modify: func(c *config.Config) { c.Quota.Reconcile = "hourly" }, want: "STORAGE_QUOTA_RECONCILE"},
+		{name: "cas collect schedule", modify: func(c *config.Config) { c.CAS.Collect = "nightly" }, want: "CAS_GC_SCHEDULE"},
+		{name: "cas without grace", modify: func(c *config.Config) { c.CAS.Enabled = true; c.CAS.Grace = 0 }, want: "CAS_GC_GRACE"},
+		{name: "scrub schedule", modify: func(c *config.Config) { c.Scrub.Schedule = "hourly" }, want: "CACHE_SCRUB_SCHEDULE"},
+		{name: "scrub without sample", modify: func(c *config.Config) { c.Scrub.Schedule = "@every 1h"; c.Scrub.Sample = 0 }, want: "CACHE_SCRUB_SAMPLE"},
+		{name: "image size", modify: func(c *config.Config) { c.Images.Sizes = []int{200, 8192} }, want: "IMAGE_SIZES"},
+		{name: "archive files", modify: func(c *config.Config) { c.Archive.MaxFiles = 0 }, want: "ARCHIVE_MAX_FILES"},
+		{name: "archive members", modify: func(c *config.Config) { c.Archive.MembersEnabled = true; c.Archive.MaxMemberBytes = 0 }, want: "ARCHIVE_MAX_MEMBER_BYTES"},
+		{name: "encryption without keys", modify: func(c *config.Config) { c.Encryption.Enabled = true }, want: "ENCRYPTION_MASTER_KEYS"},
+		{name: "encryption kms without key", modify: func(c *config.Config) {
+			c.Encryption.Enabled = true
+			c.Encryption.KMSURL = "https://vault:8200/v1/transit"
+		}, want: "ENCRYPTION_KMS_KEY"},
+		{name: "event type", modify: func(c *config.Config) { c.Events.Types = []string{"file.renamed"} }, want: "EVENT_TYPES"},
+		{name: "event webhook URL", modify: func(c *config.Config) { c.Events.WebhookURLs = []string{"hooks.example.com"} }, want: "EVENT_WEBHOOK_URLS"},
+		{name: "hot key threshold", modify: func(c *config.Config) { c.HotKeys.Threshold = 0 }, want: "HOT_KEY_THRESHOLD"},
+		{name: "hot key pin TTL", modify: func(c *config.Config) { c.HotKeys.PinTTL = 0 }, want: "HOT_KEY_PIN_TTL"},
+		{name: "chunk size", modify: func(c *config.Config) { c.Chunks.Threshold, c.Chunks.Size = 1<<20, 2<<20 }, want: "CACHE_CHUNK_SIZE"},
+		{name: "range block size", modify: func(c *config.Config) { c.Chunks.RangeBlockSize = -1 }, want: "CACHE_RANGE_BLOCK_SIZE"},
+		{name: "TTL jitter", modify: func(c *config.Config) { c.Redis.TTLJitter = 1 }, want: "CACHE_TTL_JITTER"},
+		{name: "TTL policy", modify: func(c *config.Config) { c.Redis.TTLPolicy = "lru" }, want: "CACHE_TTL_POLICY"},
+		{name: "redis compression", modify: func(c *config.Config) { c.Redis.Compression = "lz4" }, want: "REDIS_COMPRESSION"},
+		{name: "redis compression ratio", modify: func(c *config.Config) { c.Redis.CompressionMaxRatio = 1.5 }, want: "REDIS_COMPRESSION_MAX_RATIO"},
+		{name: "read header timeout", modify: func(c *config.Config) { c.Server.ReadHeaderTimeout = 0 }, want: "HTTP_READ_HEADER_TIMEOUT"},
+		{name: "write timeout", modify: func(c *config.Config) { c.Server.WriteTimeout = time.Second }, want: "HTTP_WRITE_TIMEOUT"},
+		{name: "transfer timeout", modify: func(c *config.Config) { c.Server.TransferTimeout = -time.Second }, want: "HTTP_TRANSFER_TIMEOUT"},
+		{name: "max header bytes", modify: func(c *config.Config) { c.Server.MaxHeaderBytes = 100 }, want: "HTTP_MAX_HEADER_BYTES"},
+		{name: "r2 max idle conns", modify: func(c *config.Config) { c.R2.MaxIdleConns = 0 }, want: "R2_MAX_IDLE_CONNS"},
+		{name: "r2 tls handshake timeout", modify: func(c *config.Config) { c.R2.TLSHandshakeTimeout = time.Minute }, want: "R2_TLS_HANDSHAKE_TIMEOUT"},
+		{name: "r2 parallel part size", modify: func(c *config.Config) { c.R2.ParallelThreshold, c.R2.ParallelPartSize = 64<<20, 1024 }, want: "R2_PARALLEL_DOWNLOAD_PART_SIZE"},
+		{name: "max in flight", modify: func(c *config.Config) { c.Server.MaxInFlight = -1 }, want: "MAX_IN_FLIGHT_REQUESTS"},
+		{name: "in flight queue timeout", modify: func(c *config.Config) { c.Server.QueueTimeout = time.Minute }, want: "IN_FLIGHT_QUEUE_TIMEOUT"},
+		{name: "storage timeout", modify: func(c *config.Config) { c.Timeouts.Storage = c.Timeouts.Request }, want: "STORAGE_TIMEOUT"},
+		{name: "cache timeout", modify: func(c *config.Config) { c.Timeouts.Cache = -time.Second }, want: "CACHE_TIMEOUT"},
+		{name: "disconnect grace", modify: func(c *config.Config) { c.Timeouts.DisconnectGrace = -time.Second }, want: "FETCH_DISCONNECT_GRACE"},
+		{name: "existence filter rate", modify: func(c *config.Config) {
+			c.Keys.ExistencePrefixes, c.Keys.ExistenceFalsePositiveRate = []string{"*"}, 0
+		}, want: "EXISTENCE_FILTER_FALSE_POSITIVE_RATE"},
+		{name: "metadata cache size", modify: func(c *config.Config) { c.Keys.MetadataTTL, c.Keys.MetadataMaxEntries = time.Second, 0 }, want: "METADATA_CACHE_MAX_ENTRIES"},
+		{name: "frequency TTL range", modify: func(c *config.Config) { c.Redis.TTLPolicy, c.Redis.TTLMin = "frequency", 2*time.Hour }, want: "CACHE_TTL_MIN"},
+		{name: "fill lock TTL", modify: func(c *config.Config) { c.Redis.FillLock, c.Redis.FillLockTTL = true, 0 }, want: "CACHE_FILL_LOCK_TTL"},
+		{name: "event stream", modify: func(c *config.Config) { c.Events.Stream = "rabbitmq" }, want: "EVENT_STREAM"},
+		{name: "event stream brokers", modify: func(c *config.Config) { c.Events.Stream = "kafka" }, want: "EVENT_STREAM_BROKERS"},
+		{name: "event stream format", modify: func(c *config.Config) {
+			c.Events.Stream, c.Events.StreamBrokers, c.Events.StreamFormat = "nats", []string{"localhost"}, "avro"
+		}, want: "EVENT_STREAM_FORMAT"},
+		{name: "redirect on the listener port", modify: func(c *config.Config) { c.TLS.RedirectAddr = ":8080" }, want: "LISTEN and HTTP_REDIRECT_ADDR both listen on port 8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load("")
+			if err != nil {
+				t.Fatalf("Expected the defaults to be valid, got %v", err)
+			}
+			tt.modify(cfg)
+			err = cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &config.Config{LogLevel: "info", Redis: config.RedisConfig{CacheTTL: time.Minute, Password: "a"}}
+	new := &config.Config{LogLevel: "info", Redis: config.RedisConfig{CacheTTL: time.Hour, Password: "b"}}
+
+	changes := config.Diff(old, new)
+	want := []config.Change{
+		{Field: "Redis.Password", Old: "[REDACTED]", New: "[REDACTED]"},
+		{Field: "Redis.CacheTTL", Old: "1m0s", New: "1h0m0s"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], changes[i])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is a setting that differs between two configurations
+type Change struct {
+	// Field is the setting's path in Config, such as Redis.CacheTTL
+	Field string
+	Old   string
+	New   string
+}
+
+// Diff lists the settings that differ between old and new, in field order.
+// Secrets are compared as they are but reported redacted.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffStruct(&changes, "",
+		reflect.ValueOf(*old), reflect.ValueOf(*new),
+		reflect.ValueOf(old.Redacted()), reflect.ValueOf(new.Redacted()),
+	)
+	return changes
+}
+
+// diffStruct appends the fields that differ between old and new, formatted
+// from their redacted copies
+func diffStruct(changes *[]Change, prefix string, old, new, oldShown, newShown reflect.Value) {
+	for i := range old.NumField() {
+		name := prefix + old.Type().Field(i).Name
+		o, n := old.Field(i), new.Field(i)
+		if o.Kind() == reflect.Struct {
+			diffStruct(changes, name+".", o, n, oldShown.Field(i), newShown.Field(i))
+			continue
+		}
+		if reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+		*changes = append(*changes, Change{
+			Field: name,
+			Old:   fmt.Sprint(oldShown.Field(i).Interface()),
+			New:   fmt.Sprint(newShown.Field(i).Interface()),
+		})
+	}
+}
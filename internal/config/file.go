@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileValue is a setting read from a config file
+type fileValue struct {
+	value string
+	// source locates the setting in the file for error messages
+	source string
+	line   int
+}
+
+// readFile reads a YAML config file into settings keyed by environment
+// variable name. Keys are the variable names in either case and may be
+// nested on underscores, so redis: {addr: ...} sets REDIS_ADDR; lists are
+// joined with commas. JSON files parse as YAML.
+func readFile(path string) (map[string]fileValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]fileValue)
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of settings", path, root.Line)
+	}
+	if err := flatten(path, root, "", "", values); err != nil {
+		return nil, fmt.Errorf("invalid config file:\n%w", err)
+	}
+	return values, nil
+}
+
+// flatten adds the settings in a mapping node to values, prefixing their
+// keys with those of the enclosing sections
+func flatten(path string, node *yaml.Node, prefix, name string, values map[string]fileValue) error {
+	var errs []error
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		if v.Kind == yaml.AliasNode {
+			v = v.Alias
+		}
+		key, keyName := strings.ToUpper(k.Value), k.Value
+		if prefix != "" {
+			key, keyName = prefix+"_"+key, name+"."+keyName
+		}
+		source := fmt.Sprintf("%s:%d: %s", path, k.Line, keyName)
+
+		var value string
+		switch v.Kind {
+		case yaml.MappingNode:
+			errs = append(errs, flatten(path, v, key, keyName, values))
+			continue
+		case yaml.SequenceNode:
+			items := make([]string, 0, len(v.Content))
+			for _, item := range v.Content {
+				if item.Kind != yaml.ScalarNode {
+					errs = append(errs, fmt.Errorf("%s: list items must be plain values", source))
+					break
+				}
+				items = append(items, item.Value)
+			}
+			value = strings.Join(items, ",")
+		case yaml.ScalarNode:
+			if v.Tag != "!!null" {
+				value = v.Value
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: expected a value, list or section", source))
+			continue
+		}
+
+		if previous, ok := values[key]; ok {
+			errs = append(errs, fmt.Errorf("%s: already set at %s", source, previous.source))
+			continue
+		}
+		values[key] = fileValue{value: value, source: source, line: k.Line}
+	}
+	return errors.Join(errs...)
+}
+
+// unknownKeys reports file settings that no option reads, in file order,
+// suggesting the closest known key for likely typos
+func (l *loader) unknownKeys() []error {
+	var unknown []string
+	for key := range l.file {
+		if !l.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool { return l.file[unknown[i]].line < l.file[unknown[j]].line })
+
+	errs := make([]error, 0, len(unknown))
+	for _, key := range unknown {
+		source := l.file[key].source
+		if suggestion := l.closestKey(key); suggestion != "" {
+			errs = append(errs, fmt.Errorf("%s: unknown key (did you mean %s?)", source, strings.ToLower(suggestion)))
+		} else {
+			errs = append(errs, fmt.Errorf("%s: unknown key", source))
+		}
+	}
+	return errs
+}
+
+// closestKey returns the known key within two edits of key, if any
+func (l *loader) closestKey(key string) string {
+	best, bestDistance := "", 3
+	for known := range l.used {
+		if d := editDistance(key, known); d < bestDistance || (d == bestDistance && known < best) {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
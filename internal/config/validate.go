@@ -0,0 +1,258 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/listen"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/scheduler"
+)
+
+// Validate reports missing required settings, out-of-range values and
+// settings that can't be used together, so misconfiguration stops the
+// service at startup instead of surfacing as errors at request time
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	for _, required := range []struct{ key, value string }{
+		{"R2_ACCOUNT_ID", c.R2.AccountID},
+		{"R2_ACCESS_KEY_ID", c.R2.AccessKeyID},
+		{"R2_SECRET_ACCESS_KEY", c.R2.SecretAccessKey},
+		{"R2_BUCKET_NAME", c.R2.BucketName},
+	} {
+		check(required.value != "", required.key+" is required")
+	}
+	check(c.R2.MaxIdleConns > 0, "R2_MAX_IDLE_CONNS must be positive")
+	check(c.R2.MaxConnsPerHost > 0, "R2_MAX_CONNS_PER_HOST must be positive")
+	check(c.R2.IdleConnTimeout > 0, "R2_IDLE_CONN_TIMEOUT must be positive")
+	check(c.R2.TLSHandshakeTimeout > 0 && c.R2.TLSHandshakeTimeout < c.Timeouts.Storage,
+		"R2_TLS_HANDSHAKE_TIMEOUT must be positive and shorter than STORAGE_TIMEOUT")
+	check(c.R2.ParallelThreshold >= 0, "R2_PARALLEL_DOWNLOAD_THRESHOLD must not be negative")
+	if c.R2.ParallelThreshold > 0 {
+		check(c.R2.ParallelPartSize >= 1024*1024, "R2_PARALLEL_DOWNLOAD_PART_SIZE must be at least 1 MiB")
+		check(c.R2.ParallelConcurrency > 0, "R2_PARALLEL_DOWNLOAD_CONCURRENCY must be positive")
+	}
+
+	if _, err := auth.ParseCredentials(c.AdminTokens); err != nil {
+		errs = append(errs, fmt.Errorf("ADMIN_TOKENS: %w", err))
+	}
+	if _, err := auth.ParseCertificateCredentials(c.AdminClientCerts); err != nil {
+		errs = append(errs, fmt.Errorf("ADMIN_CLIENT_CERTS: %w", err))
+	}
+	if _, err := quota.ParseRules(c.Quota.Rules); err != nil {
+		errs = append(errs, fmt.Errorf("STORAGE_QUOTAS: %w", err))
+	}
+	if _, err := scheduler.ParseSchedule(c.Quota.Reconcile); err != nil {
+		errs = append(errs, fmt.Errorf("STORAGE_QUOTA_RECONCILE: %w", err))
+	}
+	if c.CAS.Collect != "" {
+		if _, err := scheduler.ParseSchedule(c.CAS.Collect); err != nil {
+			errs = append(errs, fmt.Errorf("CAS_GC_SCHEDULE: %w", err))
+		}
+	}
+	if _, err := events.ParseTypes(c.Events.Types); err != nil {
+		errs = append(errs, fmt.Errorf("EVENT_TYPES: %w", err))
+	}
+	for _, target := range c.Events.WebhookURLs {
+		if _, err := events.NewWebhook(target, ""); err != nil {
+			errs = append(errs, fmt.Errorf("EVENT_WEBHOOK_URLS: %w", err))
+		}
+	}
+	if c.Events.Stream != "" {
+		check(c.Events.Stream == "kafka" || c.Events.Stream == "nats", "EVENT_STREAM must be kafka or nats")
+		check(len(c.Events.StreamBrokers) > 0, "EVENT_STREAM_BROKERS must be set when EVENT_STREAM is set")
+		check(c.Events.StreamTopic != "", "EVENT_STREAM_TOPIC must be set when EVENT_STREAM is set")
+		if _, err := events.ParseFormat(c.Events.StreamFormat); err != nil {
+			errs = append(errs, fmt.Errorf("EVENT_STREAM_FORMAT: %w", err))
+		}
+		if _, err := events.ParseTypes(c.Events.StreamTypes); err != nil {
+			errs = append(errs, fmt.Errorf("EVENT_STREAM_TYPES: %w", err))
+		}
+	}
+	if c.Scrub.Schedule != "" {
+		if _, err := scheduler.ParseSchedule(c.Scrub.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("CACHE_SCRUB_SCHEDULE: %w", err))
+		}
+	}
+
+	if c.Listen == "" {
+		port, err := strconv.Atoi(c.Port)
+		check(err == nil && port > 0 && port <= 65535, fmt.Sprintf("PORT %q is not a port number", c.Port))
+	}
+	errs = append(errs, c.validateListeners()...)
+
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(!c.CAS.Enabled || c.CAS.Grace > 0, "CAS_GC_GRACE must be positive when CAS_ENABLED is set")
+	check(c.Chunks.Threshold >= 0, "CACHE_CHUNK_THRESHOLD must not be negative")
+	check(c.Chunks.Threshold == 0 || (c.Chunks.Size > 0 && c.Chunks.Size <= c.Chunks.Threshold),
+		"CACHE_CHUNK_SIZE must be positive and at most CACHE_CHUNK_THRESHOLD")
+	check(c.Chunks.RangeBlockSize >= 0, "CACHE_RANGE_BLOCK_SIZE must not be negative")
+	check(c.Scrub.Schedule == "" || c.Scrub.Sample > 0, "CACHE_SCRUB_SAMPLE must be positive when CACHE_SCRUB_SCHEDULE is set")
+	check(c.Images.MaxDimension > 0, "IMAGE_MAX_DIMENSION must be positive")
+	check(c.Images.MaxPixels > 0, "IMAGE_MAX_SOURCE_PIXELS must be positive")
+	check(c.Archive.MaxFiles > 0, "ARCHIVE_MAX_FILES must be positive")
+	check(c.Archive.MaxBytes > 0, "ARCHIVE_MAX_BYTES must be positive")
+	check(!c.Archive.MembersEnabled || c.Archive.MaxMemberBytes > 0, "ARCHIVE_MAX_MEMBER_BYTES must be positive")
+	if c.Encryption.Enabled {
+		check((c.Encryption.MasterKeys == "") != (c.Encryption.KMSURL == ""),
+			"exactly one of ENCRYPTION_MASTER_KEYS and ENCRYPTION_KMS_URL is required when ENCRYPTION_ENABLED is set")
+		check(c.Encryption.KMSURL == "" || c.Encryption.KMSKey != "", "ENCRYPTION_KMS_KEY is required with ENCRYPTION_KMS_URL")
+	}
+	for _, size := range c.Images.Sizes {
+		check(size > 0 && size <= c.Images.MaxDimension, fmt.Sprintf("IMAGE_SIZES entry %d must be between 1 and IMAGE_MAX_DIMENSION", size))
+	}
+	check(c.Server.ReadTimeout >= 0, "HTTP_READ_TIMEOUT must not be negative")
+	check(c.Server.ReadHeaderTimeout > 0, "HTTP_READ_HEADER_TIMEOUT must be positive")
+	check(c.Server.WriteTimeout >= 0, "HTTP_WRITE_TIMEOUT must not be negative")
+	check(c.Server.WriteTimeout == 0 || c.Server.WriteTimeout > c.Timeouts.Request,
+		"HTTP_WRITE_TIMEOUT must be longer than REQUEST_TIMEOUT")
+	check(c.Server.IdleTimeout >= 0, "HTTP_IDLE_TIMEOUT must not be negative")
+	check(c.Server.TransferTimeout == 0 || c.Server.TransferTimeout > c.Timeouts.Request,
+		"HTTP_TRANSFER_TIMEOUT must be longer than REQUEST_TIMEOUT")
+	check(c.Server.MaxHeaderBytes >= 4096, "HTTP_MAX_HEADER_BYTES must be at least 4096")
+	check(c.Server.MaxInFlight >= 0, "MAX_IN_FLIGHT_REQUESTS must not be negative")
+	check(c.Server.MaxQueue >= 0, "IN_FLIGHT_QUEUE_SIZE must not be negative")
+	check(c.Server.QueueTimeout >= 0 && c.Server.QueueTimeout < c.Timeouts.Request,
+		"IN_FLIGHT_QUEUE_TIMEOUT must not be negative and shorter than REQUEST_TIMEOUT")
+	check(c.Timeouts.Request > 0, "REQUEST_TIMEOUT must be positive")
+	check(c.Timeouts.Storage > 0 && c.Timeouts.Storage < c.Timeouts.Request,
+		"STORAGE_TIMEOUT must be positive and shorter than REQUEST_TIMEOUT")
+	check(c.Timeouts.Cache >= 0 && c.Timeouts.Cache < c.Timeouts.Request,
+		"CACHE_TIMEOUT must not be negative and shorter than REQUEST_TIMEOUT")
+	check(c.Timeouts.DisconnectGrace >= 0, "FETCH_DISCONNECT_GRACE must not be negative")
+	check(len(c.Keys.CaseInsensitivePrefixes) == 0 || c.Keys.IndexRefresh > 0,
+		"KEY_INDEX_REFRESH must be positive when CASE_INSENSITIVE_PREFIXES is set")
+	if len(c.Keys.ExistencePrefixes) > 0 {
+		check(c.Keys.IndexRefresh > 0, "KEY_INDEX_REFRESH must be positive when EXISTENCE_FILTER_PREFIXES is set")
+		check(c.Keys.ExistenceFalsePositiveRate > 0 && c.Keys.ExistenceFalsePositiveRate < 1,
+			"EXISTENCE_FILTER_FALSE_POSITIVE_RATE must be between 0 and 1")
+	}
+	check(c.Keys.MetadataTTL >= 0, "METADATA_CACHE_TTL must not be negative")
+	check(c.Keys.MetadataTTL == 0 || c.Keys.MetadataMaxEntries > 0,
+		"METADATA_CACHE_MAX_ENTRIES must be positive when METADATA_CACHE_TTL is set")
+	check(c.Redis.BreakerThreshold <= 0 || c.Redis.BreakerCooldown > 0,
+		"REDIS_BREAKER_COOLDOWN must be positive when REDIS_BREAKER_THRESHOLD is set")
+	check(c.Redis.NamespaceDepth <= 0 || c.Redis.GenerationRefresh > 0,
+		"CACHE_GENERATION_REFRESH must be positive when CACHE_NAMESPACE_DEPTH is set")
+	check(c.HotKeys.Window >= 0, "HOT_KEY_WINDOW must not be negative")
+	check(c.HotKeys.Window == 0 || c.HotKeys.Threshold > 0, "HOT_KEY_THRESHOLD must be positive")
+	check(c.HotKeys.PinBytes >= 0, "HOT_KEY_PIN_BYTES must not be negative")
+	check(c.HotKeys.PinBytes == 0 || c.HotKeys.PinTTL > 0, "HOT_KEY_PIN_TTL must be positive when HOT_KEY_PIN_BYTES is set")
+	check(!c.Redis.FillLock || c.Redis.FillLockTTL > 0, "CACHE_FILL_LOCK_TTL must be positive when CACHE_FILL_LOCK is set")
+	check(c.Redis.FillLockWait >= 0, "CACHE_FILL_LOCK_WAIT must not be negative")
+	check(c.Redis.TTLJitter >= 0 && c.Redis.TTLJitter < 1, "CACHE_TTL_JITTER must be at least 0% and under 100%")
+	check(c.Redis.TTLPolicy == "fixed" || c.Redis.TTLPolicy == "frequency", "CACHE_TTL_POLICY must be fixed or frequency")
+	if c.Redis.TTLPolicy == "frequency" {
+		check(c.HotKeys.Window > 0, "HOT_KEY_WINDOW must be positive when CACHE_TTL_POLICY is frequency")
+		check(c.Redis.TTLMin > 0 && c.Redis.TTLMin <= c.Redis.TTLMax, "CACHE_TTL_MIN must be positive and at most CACHE_TTL_MAX")
+	}
+	check(slices.Contains([]string{"none", "snappy", "zstd"}, c.Redis.Compression), "REDIS_COMPRESSION must be none, snappy or zstd")
+	check(c.Redis.CompressionMinBytes >= 0, "REDIS_COMPRESSION_MIN_BYTES must not be negative")
+	check(c.Redis.CompressionMaxRatio > 0 && c.Redis.CompressionMaxRatio <= 1, "REDIS_COMPRESSION_MAX_RATIO must be above 0 and at most 1")
+	check(c.Signing.URLDefaultTTL <= c.Signing.URLMaxTTL, "PRESIGN_DEFAULT_TTL must not exceed PRESIGN_MAX_TTL")
+
+	switch c.CacheBackend {
+	case CacheBackendRedis:
+		check(c.Redis.Mode != RedisModeSentinel || len(c.Redis.SentinelAddrs) > 0,
+			"REDIS_SENTINEL_ADDRS is required when REDIS_MODE=sentinel")
+	case CacheBackendGroupcache:
+		check(c.Groupcache.Self != "", "GROUPCACHE_SELF is required when CACHE_BACKEND=groupcache")
+	}
+	check(c.Redis.DB >= 0, "REDIS_DB must not be negative")
+	check((c.Redis.TLSCertFile == "") == (c.Redis.TLSKeyFile == ""),
+		"REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	check(c.TLS.CertFile == "" || len(c.TLS.AutocertDomains) == 0,
+		"TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS are mutually exclusive")
+	check(len(c.TLS.AutocertDomains) == 0 || c.TLS.AutocertCacheDir != "",
+		"TLS_AUTOCERT_CACHE_DIR is required with TLS_AUTOCERT_DOMAINS, so certificates survive restarts")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "" || len(c.TLS.AutocertDomains) > 0,
+		"TLS_CLIENT_CA_FILE requires TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+	check(c.TLS.ClientAuth == "require" || c.TLS.ClientAuth == "optional", "TLS_CLIENT_AUTH must be require or optional")
+	check(len(c.TLS.ClientAllowedNames) == 0 || c.TLS.ClientCAFile != "",
+		"TLS_CLIENT_ALLOWED_NAMES requires TLS_CLIENT_CA_FILE")
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowedOrigins, "*"),
+		"CORS_ALLOW_CREDENTIALS can't be used with CORS_ALLOWED_ORIGINS=*, which would let any site make authenticated requests")
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://"),
+			fmt.Sprintf("CORS_ALLOWED_ORIGINS: %q must be * or start with http:// or https://", origin))
+	}
+	check(c.FilenameMaxLength >= 0, "FILENAME_MAX_LENGTH must not be negative")
+	if _, err := regexp.Compile(c.FilenamePattern); err != nil {
+		errs = append(errs, fmt.Errorf("FILENAME_PATTERN: %w", err))
+	}
+	check(c.AccessLog.Format == "json" || c.AccessLog.Format == "combined" || c.AccessLog.Format == "off",
+		"ACCESS_LOG_FORMAT must be json, combined or off")
+	check(c.Mirror.SampleRate >= 0 && c.Mirror.SampleRate <= 1, "MIRROR_SAMPLE_RATE must be between 0 and 1")
+	check(c.Stream.MinChunkSize <= c.Stream.MaxChunkSize,
+		"STREAM_MIN_CHUNK_SIZE must not exceed STREAM_MAX_CHUNK_SIZE")
+	return errors.Join(errs...)
+}
+
+// validateListeners parses every listener address, and reports servers
+// that would bind the same port
+func (c *Config) validateListeners() []error {
+	listeners := []struct{ key, list string }{
+		{"LISTEN", c.Listen},
+		{"ADMIN_ADDR", c.AdminAddr},
+		{"GRPC_ADDR", c.GRPC.Addr},
+		{"S3_ADDR", c.S3.Addr},
+		{"DEBUG_ADDR", c.Debug.Addr},
+		{"HTTP_REDIRECT_ADDR", c.TLS.RedirectAddr},
+	}
+	if c.Listen == "" {
+		listeners[0].list = ":" + c.Port
+	}
+	if c.CacheBackend == CacheBackendGroupcache {
+		listeners = append(listeners, struct{ key, list string }{"GROUPCACHE_ADDR", c.Groupcache.Addr})
+	}
+
+	var errs []error
+	type bound struct{ key, host string }
+	ports := make(map[string][]bound)
+	for _, l := range listeners {
+		if l.list == "" {
+			continue
+		}
+		specs, err := listen.Parse(l.list)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", l.key, err))
+			continue
+		}
+		for _, spec := range specs {
+			host, port, _ := net.SplitHostPort(spec.Addr)
+			if spec.Interface != "" || port == "0" {
+				continue
+			}
+			for _, other := range ports[port] {
+				if other.key != l.key && overlaps(host, other.host) {
+					errs = append(errs, fmt.Errorf("%s and %s both listen on port %s", other.key, l.key, port))
+				}
+			}
+			ports[port] = append(ports[port], bound{l.key, host})
+		}
+	}
+	return errs
+}
+
+// overlaps reports whether listeners on two hosts of the same port clash
+func overlaps(a, b string) bool {
+	unspecified := func(host string) bool {
+		ip := net.ParseIP(host)
+		return host == "" || (ip != nil && ip.IsUnspecified())
+	}
+	return a == b || unspecified(a) || unspecified(b)
+}
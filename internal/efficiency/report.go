@@ -0,0 +1,248 @@
+package efficiency
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// Report windows
+const (
+	WindowDay  = 24 * time.Hour
+	WindowWeek = 7 * 24 * time.Hour
+)
+
+// Report summarizes cache efficiency over a window
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Since       time.Time `json:"since"`
+	// Window is the length of the report in hours, e.g. "24h"
+	Window string `json:"window"`
+	Totals Stats  `json:"totals"`
+	// Prefixes are sorted by request count, busiest first
+	Prefixes  []Stats     `json:"prefixes"`
+	TopFiles  []KeyCount  `json:"top_files"`
+	TopMisses []KeyMisses `json:"top_misses"`
+}
+
+// Stats are the counters for one prefix, or for every prefix in Totals
+type Stats struct {
+	Prefix   string  `json:"prefix,omitempty"`
+	Requests int64   `json:"requests"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	// ExpiredMisses are misses for keys that had been cached and weren't
+	// deleted or purged, so their entries expired or were evicted
+	ExpiredMisses int64 `json:"expired_misses"`
+	// BytesSaved were served from the cache instead of storage
+	BytesSaved   int64 `json:"bytes_saved"`
+	BytesFetched int64 `json:"bytes_fetched"`
+	// EstimatedSavings is what the hits would have cost as storage reads
+	EstimatedSavings float64 `json:"estimated_savings"`
+	// EstimatedCost is what the misses cost as storage reads
+	EstimatedCost float64 `json:"estimated_cost"`
+}
+
+// KeyMisses counts the misses for a single key
+type KeyMisses struct {
+	Key    string `json:"key"`
+	Misses int64  `json:"misses"`
+}
+
+// KeyCount counts the requests for a single key, hits and misses alike
+type KeyCount struct {
+	Key      string `json:"key"`
+	Requests int64  `json:"requests"`
+}
+
+// Report summarizes the requests recorded over the window ending now. The
+// window is rounded to whole hours, including the current one, and capped at
+// a week.
+func (t *Tracker) Report(window time.Duration) Report {
+	window = min(window.Round(time.Hour), retention)
+	if window < time.Hour {
+		window = time.Hour
+	}
+	now := t.now().UTC()
+	since := now.Truncate(time.Hour).Add(-window).Add(time.Hour)
+
+	var (
+		prefixes = make(map[string]*counts)
+		requests = make(map[string]int64)
+		misses   = make(map[string]int64)
+	)
+	t.mu.Lock()
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.hour.IsZero() || b.hour.Before(since) {
+			continue
+		}
+		for prefix, c := range b.prefixes {
+			total, ok := prefixes[prefix]
+			if !ok {
+				total = &counts{}
+				prefixes[prefix] = total
+			}
+			total.add(c)
+		}
+		for key, n := range b.requests {
+			requests[key] += n
+		}
+		for key, n := range b.misses {
+			misses[key] += n
+		}
+	}
+	t.mu.Unlock()
+
+	report := Report{
+		GeneratedAt: now,
+		Since:       since,
+		Window:      fmt.Sprintf("%dh", int(window.Hours())),
+		Prefixes:    make([]Stats, 0, len(prefixes)),
+		TopFiles:    make([]KeyCount, 0, min(len(requests), t.cfg.TopMisses)),
+		TopMisses:   make([]KeyMisses, 0, min(len(misses), t.cfg.TopMisses)),
+	}
+	var totals counts
+	for prefix, c := range prefixes {
+		totals.add(c)
+		report.Prefixes = append(report.Prefixes, t.stats(prefix, c))
+	}
+	report.Totals = t.stats("", &totals)
+	sort.Slice(report.Prefixes, func(i, j int) bool {
+		a, b := report.Prefixes[i], report.Prefixes[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Prefix < b.Prefix
+	})
+
+	for key, n := range requests {
+		report.TopFiles = append(report.TopFiles, KeyCount{Key: key, Requests: n})
+	}
+	sort.Slice(report.TopFiles, func(i, j int) bool {
+		a, b := report.TopFiles[i], report.TopFiles[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Key < b.Key
+	})
+	if len(report.TopFiles) > t.cfg.TopMisses {
+		report.TopFiles = report.TopFiles[:t.cfg.TopMisses]
+	}
+
+	for key, n := range misses {
+		report.TopMisses = append(report.TopMisses, KeyMisses{Key: key, Misses: n})
+	}
+	sort.Slice(report.TopMisses, func(i, j int) bool {
+		a, b := report.TopMisses[i], report.TopMisses[j]
+		if a.Misses != b.Misses {
+			return a.Misses > b.Misses
+		}
+		return a.Key < b.Key
+	})
+	if len(report.TopMisses) > t.cfg.TopMisses {
+		report.TopMisses = report.TopMisses[:t.cfg.TopMisses]
+	}
+	return report
+}
+
+func (t *Tracker) stats(prefix string, c *counts) Stats {
+	s := Stats{
+		Prefix:        prefix,
+		Requests:      c.hits + c.misses,
+		Hits:          c.hits,
+		Misses:        c.misses,
+		ExpiredMisses: c.expiredMisses,
+		BytesSaved:    c.bytesHit,
+		BytesFetched:  c.bytesMissed,
+
+		EstimatedSavings: t.cost(c.hits, c.bytesHit),
+		EstimatedCost:    t.cost(c.misses, c.bytesMissed),
+	}
+	if s.Requests > 0 {
+		s.HitRatio = float64(c.hits) / float64(s.Requests)
+	}
+	return s
+}
+
+// cost estimates the price of the given number of storage reads, fetching
+// size bytes in total
+func (t *Tracker) cost(reads, size int64) float64 {
+	const gb = 1 << 30
+	return float64(size)/gb*t.cfg.EgressCostPerGB + float64(reads)/1e6*t.cfg.ReadCostPerMillion
+}
+
+// csvHeader names the columns written by WriteCSV
+var csvHeader = []string{
+	"prefix", "requests", "hits", "misses", "hit_ratio", "expired_misses",
+	"bytes_saved", "bytes_fetched", "estimated_savings", "estimated_cost",
+}
+
+// WriteCSV writes one row per prefix, followed by a totals row with the
+// prefix "*". Top files and misses are only included in the JSON form.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	totals := r.Totals
+	totals.Prefix = "*"
+	for _, s := range append(slices.Clone(r.Prefixes), totals) {
+		err := cw.Write([]string{
+			s.Prefix,
+			strconv.FormatInt(s.Requests, 10),
+			strconv.FormatInt(s.Hits, 10),
+			strconv.FormatInt(s.Misses, 10),
+			strconv.FormatFloat(s.HitRatio, 'f', 4, 64),
+			strconv.FormatInt(s.ExpiredMisses, 10),
+			strconv.FormatInt(s.BytesSaved, 10),
+			strconv.FormatInt(s.BytesFetched, 10),
+			strconv.FormatFloat(s.EstimatedSavings, 'f', 4, 64),
+			strconv.FormatFloat(s.EstimatedCost, 'f', 4, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Publish writes the day and week reports to s under prefix, as JSON and
+// CSV, e.g. reports/cache-efficiency/2024-01-02T03:00:00Z/day.json
+func (t *Tracker) Publish(ctx context.Context, s storage.Storage, prefix string) error {
+	generated := t.now().UTC().Truncate(time.Minute).Format(time.RFC3339)
+	for name, window := range map[string]time.Duration{"day": WindowDay, "week": WindowWeek} {
+		report := t.Report(window)
+
+		var jsonBuf, csvBuf bytes.Buffer
+		enc := json.NewEncoder(&jsonBuf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode %s report: %w", name, err)
+		}
+		if err := report.WriteCSV(&csvBuf); err != nil {
+			return fmt.Errorf("failed to encode %s report: %w", name, err)
+		}
+
+		dir := path.Join(prefix, generated)
+		if err := s.PutObject(ctx, path.Join(dir, name+".json"), &jsonBuf, "application/json"); err != nil {
+			return fmt.Errorf("failed to store %s report: %w", name, err)
+		}
+		if err := s.PutObject(ctx, path.Join(dir, name+".csv"), &csvBuf, "text/csv"); err != nil {
+			return fmt.Errorf("failed to store %s report: %w", name, err)
+		}
+	}
+	return nil
+}
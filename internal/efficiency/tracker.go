@@ -0,0 +1,217 @@
+// Package efficiency counts cache hits and misses by key prefix and reports
+// how much storage traffic the cache saves
+package efficiency
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// retention is how far back reports can look
+	retention = 7 * 24 * time.Hour
+	// numBuckets holds a week of hourly buckets plus the current hour
+	numBuckets = int(retention/time.Hour) + 1
+	// maxBucketKeys caps the keys tracked per bucket for top files and top
+	// misses; later keys are still counted under their prefix
+	maxBucketKeys = 10000
+	// maxFilledKeys caps the keys remembered as cached
+	maxFilledKeys = 100000
+)
+
+// Config controls how requests are grouped and priced
+type Config struct {
+	// PrefixDepth is how many leading path segments of a key form its
+	// prefix; zero groups by the first segment
+	PrefixDepth int
+	// EgressCostPerGB estimates the cost of each GB fetched from storage
+	EgressCostPerGB float64
+	// ReadCostPerMillion estimates the cost of each million storage reads
+	ReadCostPerMillion float64
+	// TopMisses is how many of the most missed, and most requested, keys
+	// reports list
+	TopMisses int
+}
+
+// counts accumulates the requests for one prefix
+type counts struct {
+	hits          int64
+	misses        int64
+	expiredMisses int64
+	bytesHit      int64
+	bytesMissed   int64
+}
+
+func (c *counts) add(o *counts) {
+	c.hits += o.hits
+	c.misses += o.misses
+	c.expiredMisses += o.expiredMisses
+	c.bytesHit += o.bytesHit
+	c.bytesMissed += o.bytesMissed
+}
+
+// bucket holds one hour of counters
+type bucket struct {
+	hour     time.Time
+	prefixes map[string]*counts
+	requests map[string]int64
+	misses   map[string]int64
+}
+
+// Tracker records cache lookups in hourly buckets. A nil Tracker records
+// nothing.
+type Tracker struct {
+	cfg Config
+
+	mu      sync.Mutex
+	buckets [numBuckets]bucket
+	// filled remembers keys written to the cache, so a later miss can be
+	// told apart as an expiry or eviction rather than a first request
+	filled map[string]struct{}
+	now    func() time.Time
+}
+
+// NewTracker creates an empty Tracker
+func NewTracker(cfg Config) *Tracker {
+	if cfg.PrefixDepth <= 0 {
+		cfg.PrefixDepth = 1
+	}
+	if cfg.TopMisses <= 0 {
+		cfg.TopMisses = 20
+	}
+	return &Tracker{
+		cfg:    cfg,
+		filled: make(map[string]struct{}),
+		now:    time.Now,
+	}
+}
+
+// Hit records a request for key served from the cache
+func (t *Tracker) Hit(key string, size int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.countsLocked(key)
+	c.hits++
+	c.bytesHit += size
+	countKey(t.bucketLocked().requests, key)
+}
+
+// Miss records a request for key fetched from storage after a cache miss
+func (t *Tracker) Miss(key string, size int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.countsLocked(key)
+	c.misses++
+	c.bytesMissed += size
+	if _, ok := t.filled[key]; ok {
+		c.expiredMisses++
+		delete(t.filled, key)
+	}
+
+	b := t.bucketLocked()
+	countKey(b.requests, key)
+	countKey(b.misses, key)
+}
+
+// countKey counts a request for key, unless the bucket already tracks
+// maxBucketKeys other keys
+func countKey(keys map[string]int64, key string) {
+	if _, ok := keys[key]; ok || len(keys) < maxBucketKeys {
+		keys[key]++
+	}
+}
+
+// Filled records that key was written to the cache
+func (t *Tracker) Filled(key string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.filled) < maxFilledKeys {
+		t.filled[key] = struct{}{}
+	}
+}
+
+// Forget records that keys were removed from the cache on purpose, so their
+// next misses aren't counted as expiries
+func (t *Tracker) Forget(keys ...string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.filled, key)
+	}
+}
+
+// ForgetPrefix is Forget for every key starting with prefix
+func (t *Tracker) ForgetPrefix(prefix string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.filled {
+		if strings.HasPrefix(key, prefix) {
+			delete(t.filled, key)
+		}
+	}
+}
+
+// bucketLocked returns the bucket for the current hour, clearing it if it
+// last held an older hour
+func (t *Tracker) bucketLocked() *bucket {
+	hour := t.now().UTC().Truncate(time.Hour)
+	b := &t.buckets[int(hour.Unix()/3600)%numBuckets]
+	if !b.hour.Equal(hour) {
+		*b = bucket{
+			hour:     hour,
+			prefixes: make(map[string]*counts),
+			requests: make(map[string]int64),
+			misses:   make(map[string]int64),
+		}
+	}
+	return b
+}
+
+func (t *Tracker) countsLocked(key string) *counts {
+	b := t.bucketLocked()
+	prefix := t.prefix(key)
+	c, ok := b.prefixes[prefix]
+	if !ok {
+		c = &counts{}
+		b.prefixes[prefix] = c
+	}
+	return c
+}
+
+// prefix groups key by its leading path segments. Keys with no more
+// segments than the depth are grouped under "/".
+func (t *Tracker) prefix(key string) string {
+	end := 0
+	for range t.cfg.PrefixDepth {
+		i := strings.IndexByte(key[end:], '/')
+		if i < 0 {
+			break
+		}
+		end += i + 1
+	}
+	if end == 0 {
+		return "/"
+	}
+	return key[:end]
+}
@@ -0,0 +1,140 @@
+package efficiency
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func newTestTracker(cfg Config) (*Tracker, *time.Time) {
+	now := time.Date(2024, 1, 8, 12, 30, 0, 0, time.UTC)
+	t := NewTracker(cfg)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestTracker_ReportByPrefix(t *testing.T) {
+	tracker, _ := newTestTracker(Config{ReadCostPerMillion: 1e6, EgressCostPerGB: 1})
+
+	tracker.Hit("images/a.png", 1<<30)
+	tracker.Hit("images/a.png", 1<<30)
+	tracker.Miss("images/b.png", 100)
+	tracker.Miss("docs/x.pdf", 10)
+	tracker.Miss("root.txt", 1)
+
+	report := tracker.Report(WindowDay)
+	if report.Totals.Requests != 5 || report.Totals.Hits != 2 || report.Totals.Misses != 3 {
+		t.Fatalf("Unexpected totals: %+v", report.Totals)
+	}
+	if len(report.Prefixes) != 3 {
+		t.Fatalf("Expected 3 prefixes, got %+v", report.Prefixes)
+	}
+
+	images := report.Prefixes[0]
+	if images.Prefix != "images/" {
+		t.Fatalf("Expected the busiest prefix first, got %q", images.Prefix)
+	}
+	if images.HitRatio < 0.66 || images.HitRatio > 0.67 {
+		t.Errorf("Expected a hit ratio of 2/3, got %v", images.HitRatio)
+	}
+	if images.BytesSaved != 2<<30 || images.BytesFetched != 100 {
+		t.Errorf("Unexpected byte counts: %+v", images)
+	}
+	// Two reads at $1 each plus 2 GB at $1/GB
+	if images.EstimatedSavings != 4 {
+		t.Errorf("Expected estimated savings of 4, got %v", images.EstimatedSavings)
+	}
+	if got := report.Prefixes[1].Prefix + "," + report.Prefixes[2].Prefix; got != "/,docs/" {
+		t.Errorf("Expected top-level keys to be grouped under \"/\", got %s", got)
+	}
+	if len(report.TopFiles) != 4 || report.TopFiles[0] != (KeyCount{Key: "images/a.png", Requests: 2}) {
+		t.Errorf("Expected the most requested file first, got %+v", report.TopFiles)
+	}
+}
+
+func TestTracker_ExpiredMisses(t *testing.T) {
+	tracker, _ := newTestTracker(Config{})
+
+	// First request: not an expiry
+	tracker.Miss("a", 1)
+	tracker.Filled("a")
+	// The entry expired
+	tracker.Miss("a", 1)
+	tracker.Filled("a")
+
+	// A purged entry is not an expiry
+	tracker.Filled("b")
+	tracker.Forget("b")
+	tracker.Miss("b", 1)
+
+	tracker.Filled("dir/c")
+	tracker.ForgetPrefix("dir/")
+	tracker.Miss("dir/c", 1)
+
+	if got := tracker.Report(WindowDay).Totals.ExpiredMisses; got != 1 {
+		t.Errorf("Expected 1 expired miss, got %d", got)
+	}
+}
+
+func TestTracker_Windows(t *testing.T) {
+	tracker, now := newTestTracker(Config{TopMisses: 2})
+
+	tracker.Miss("old", 1)
+	*now = now.Add(3 * 24 * time.Hour)
+	tracker.Miss("recent", 1)
+	tracker.Miss("recent", 1)
+	tracker.Miss("other", 1)
+	tracker.Miss("third", 1)
+
+	day := tracker.Report(WindowDay)
+	if day.Totals.Misses != 4 {
+		t.Errorf("Expected 4 misses in the last day, got %d", day.Totals.Misses)
+	}
+	if len(day.TopMisses) != 2 || day.TopMisses[0] != (KeyMisses{Key: "recent", Misses: 2}) {
+		t.Errorf("Expected the 2 most missed keys, got %+v", day.TopMisses)
+	}
+
+	week := tracker.Report(WindowWeek)
+	if week.Totals.Misses != 5 || week.Window != "168h" {
+		t.Errorf("Expected 5 misses over 168h, got %d over %s", week.Totals.Misses, week.Window)
+	}
+
+	// Buckets older than a week are reused
+	*now = now.Add(7 * 24 * time.Hour)
+	if got := tracker.Report(WindowWeek).Totals.Requests; got != 0 {
+		t.Errorf("Expected expired buckets to be dropped, got %d requests", got)
+	}
+}
+
+func TestTracker_Publish(t *testing.T) {
+	tracker, _ := newTestTracker(Config{})
+	tracker.Hit("images/a.png", 10)
+
+	store := mocks.NewMockStorage()
+	if err := tracker.Publish(context.Background(), store, "reports/cache-efficiency"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	dir := "reports/cache-efficiency/2024-01-08T12:30:00Z/"
+	for _, key := range []string{"day.json", "day.csv", "week.json", "week.csv"} {
+		if exists, _ := store.ObjectExists(context.Background(), dir+key); !exists {
+			t.Errorf("Expected %s to be published", dir+key)
+		}
+	}
+
+	data, err := store.GetObject(context.Background(), dir+"day.csv")
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[1][0] != "images/" || rows[2][0] != "*" {
+		t.Errorf("Expected a header, one prefix and a totals row, got %v", rows)
+	}
+}
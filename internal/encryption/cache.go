@@ -0,0 +1,187 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// Cache encrypts the payloads stored in another cache, bound to their key.
+// Payloads cached before encryption was enabled are served as they are
+// until they expire.
+type Cache struct {
+	inner   cache.Cache
+	enc     *Encryptor
+	metrics *metrics.Metrics
+}
+
+// entryCache is a Cache whose inner cache stores metadata with payloads
+type entryCache struct {
+	*Cache
+	ec cache.EntryCache
+}
+
+// Ensure Cache implements the cache interfaces
+var (
+	_ cache.Cache         = (*Cache)(nil)
+	_ cache.Tombstoner    = (*Cache)(nil)
+	_ cache.VariantIndex  = (*Cache)(nil)
+	_ cache.UsageReporter = (*Cache)(nil)
+	_ cache.Sampler       = (*Cache)(nil)
+	_ cache.EntryCache    = (*entryCache)(nil)
+)
+
+// NewCache encrypts the payloads stored in inner. It keeps metadata with
+// payloads when inner does. m may be nil.
+func NewCache(inner cache.Cache, enc *Encryptor, m *metrics.Metrics) cache.Cache {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	c := &Cache{inner: inner, enc: enc, metrics: m}
+	if ec, ok := inner.(cache.EntryCache); ok {
+		return &entryCache{Cache: c, ec: ec}
+	}
+	return c
+}
+
+// open decrypts a cached payload. Empty and unencrypted payloads are
+// returned as they are.
+func (c *Cache) open(ctx context.Context, key string, data []byte) ([]byte, error) {
+	if !Sealed(data) {
+		return data, nil
+	}
+	plain, err := c.enc.Open(ctx, data, []byte(key))
+	if err != nil {
+		c.metrics.DecryptionFailuresTotal.WithLabelValues("cache").Inc()
+		return nil, fmt.Errorf("failed to decrypt cached %s: %w", key, err)
+	}
+	return plain, nil
+}
+
+// seal encrypts a payload for the cache. Empty payloads, such as entries
+// pointing at a shared blob, have nothing to hide and are stored as is.
+func (c *Cache) seal(ctx context.Context, key string, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	sealed, err := c.enc.Seal(ctx, data, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt cached %s: %w", key, err)
+	}
+	return sealed, nil
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, found, err := c.inner.Get(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	if data, err = c.open(ctx, key, data); err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (c *Cache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	data, age, found, err := c.inner.GetWithAge(ctx, key)
+	if !found || err != nil {
+		return nil, 0, found, err
+	}
+	if data, err = c.open(ctx, key, data); err != nil {
+		return nil, 0, false, err
+	}
+	return data, age, true, nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, data []byte) error {
+	sealed, err := c.seal(ctx, key, data)
+	if err != nil {
+		return err
+	}
+	return c.inner.Set(ctx, key, sealed)
+}
+
+func (c *entryCache) GetEntry(ctx context.Context, key string) (*cache.Entry, bool, error) {
+	entry, found, err := c.ec.GetEntry(ctx, key)
+	if !found || err != nil {
+		return entry, found, err
+	}
+	if entry.Data, err = c.open(ctx, key, entry.Data); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// SetEntry encrypts data, recording the plaintext size in meta
+func (c *entryCache) SetEntry(ctx context.Context, key string, data []byte, meta cache.EntryMeta) error {
+	sealed, err := c.seal(ctx, key, data)
+	if err != nil {
+		return err
+	}
+	if meta.Size == 0 {
+		meta.Size = int64(len(data))
+	}
+	return c.ec.SetEntry(ctx, key, sealed, meta)
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return c.inner.Delete(ctx, keys...)
+}
+
+func (c *Cache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	return c.inner.DeletePrefix(ctx, prefix)
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.inner.Ping(ctx)
+}
+
+func (c *Cache) Close() error {
+	return c.inner.Close()
+}
+
+// Tombstone tombstones key, or deletes it when the inner cache can't keep
+// tombstones
+func (c *Cache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	if ts, ok := c.inner.(cache.Tombstoner); ok {
+		return ts.Tombstone(ctx, key, ttl)
+	}
+	_, err := c.inner.Delete(ctx, key)
+	return err
+}
+
+// AddVariant records key as derived from base when the inner cache keeps a
+// variant index
+func (c *Cache) AddVariant(ctx context.Context, base, key string) error {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.AddVariant(ctx, base, key)
+	}
+	return nil
+}
+
+func (c *Cache) Variants(ctx context.Context, base string) ([]string, error) {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.Variants(ctx, base)
+	}
+	return nil, nil
+}
+
+// Usage reports the usage of the inner cache, which holds the encrypted
+// payloads
+func (c *Cache) Usage(ctx context.Context) (cache.Usage, error) {
+	if reporter, ok := c.inner.(cache.UsageReporter); ok {
+		return reporter.Usage(ctx)
+	}
+	return cache.Usage{}, errors.ErrUnsupported
+}
+
+func (c *Cache) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	if sampler, ok := c.inner.(cache.Sampler); ok {
+		return sampler.SampleKeys(ctx, n)
+	}
+	return nil, errors.ErrUnsupported
+}
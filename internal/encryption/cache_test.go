@@ -0,0 +1,50 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/encryption"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	inner := mocks.NewMockCache()
+	c := encryption.NewCache(inner, newEncryptor(t, "k1:"+masterKey(1)), nil)
+	ec, ok := c.(cache.EntryCache)
+	if !ok {
+		t.Fatal("Expected the cache to keep entry metadata")
+	}
+
+	plain := []byte("payroll")
+	if err := ec.SetEntry(ctx, "hr/payroll.csv", plain, cache.EntryMeta{ETag: `"v1"`}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+	raw, _, _ := inner.GetEntry(ctx, "hr/payroll.csv")
+	if bytes.Contains(raw.Data, plain) || raw.Meta.Size != int64(len(plain)) {
+		t.Errorf("Expected an encrypted payload with the plaintext size, got %q (%d)", raw.Data, raw.Meta.Size)
+	}
+
+	entry, found, err := ec.GetEntry(ctx, "hr/payroll.csv")
+	if err != nil || !found || !bytes.Equal(entry.Data, plain) || entry.Meta.ETag != `"v1"` {
+		t.Fatalf("Expected the decrypted entry, got %+v, %v, %v", entry, found, err)
+	}
+	if data, found, err := c.Get(ctx, "hr/payroll.csv"); err != nil || !found || !bytes.Equal(data, plain) {
+		t.Errorf("Expected Get to decrypt, got %q, %v, %v", data, found, err)
+	}
+
+	// Payloads cached before encryption was enabled are served as they are
+	inner.SetData("legacy.txt", []byte("plain"))
+	if data, found, err := c.Get(ctx, "legacy.txt"); err != nil || !found || string(data) != "plain" {
+		t.Errorf("Expected the unencrypted payload, got %q, %v, %v", data, found, err)
+	}
+
+	// A payload moved to another key is a miss
+	inner.SetData("hr/other.csv", raw.Data)
+	if _, found, err := c.Get(ctx, "hr/other.csv"); found || err == nil {
+		t.Errorf("Expected a moved payload to fail to decrypt, got found=%v, %v", found, err)
+	}
+}
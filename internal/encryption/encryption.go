@@ -0,0 +1,226 @@
+// Package encryption encrypts objects and cached payloads with AES-256-GCM
+// before they leave the service. Payloads are sealed with data keys that
+// are themselves wrapped by a master key or a KMS, and each sealed payload
+// carries its wrapped key, so keys can be rotated without rewriting data.
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sealed payload layout: magic | version (1 byte) | key ID length (1 byte) |
+// key ID | wrapped key length (uint16 BE) | wrapped key | nonce | ciphertext.
+// Everything before the ciphertext is authenticated along with it.
+var magic = []byte{0x00, 'F', 'C', 'X'}
+
+const (
+	version   byte = 1
+	keySize        = 32
+	nonceSize      = 12
+)
+
+// Data keys are replaced after this many seals or this long, well within
+// the limits of random GCM nonces
+const (
+	maxKeyUses  = 1 << 24
+	keyLifetime = time.Hour
+)
+
+// maxUnwrapped bounds the unwrapped data keys kept for opening payloads
+const maxUnwrapped = 4096
+
+// ErrDecrypt is returned (wrapped) for sealed payloads that can't be
+// opened: corrupted, tampered with, or sealed with an unknown key
+var ErrDecrypt = errors.New("failed to decrypt")
+
+// KeyWrapper encrypts data keys with a key that never leaves it
+type KeyWrapper interface {
+	// KeyID names the key new data keys are wrapped with
+	KeyID() string
+	// Wrap encrypts a data key with the key named by KeyID
+	Wrap(ctx context.Context, key []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped with the key named keyID
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// dataKey is a data key ready for sealing, with the header of the payloads
+// it seals
+type dataKey struct {
+	aead    cipher.AEAD
+	header  []byte
+	uses    int
+	created time.Time
+}
+
+// Encryptor seals and opens payloads. Data keys are reused for a while, so
+// the wrapper is only called when one is replaced or first seen.
+type Encryptor struct {
+	wrapper KeyWrapper
+
+	mu        sync.Mutex
+	current   *dataKey
+	unwrapped map[string]cipher.AEAD
+}
+
+// New creates an Encryptor wrapping its data keys with w
+func New(w KeyWrapper) *Encryptor {
+	return &Encryptor{wrapper: w, unwrapped: make(map[string]cipher.AEAD)}
+}
+
+// Sealed reports whether data is a sealed payload
+func Sealed(data []byte) bool {
+	return len(data) > len(magic) && bytes.HasPrefix(data, magic) && data[len(magic)] == version
+}
+
+// Seal encrypts data. aad, such as the name the payload is stored under,
+// must be given again to open it, so payloads can't be swapped.
+func (e *Encryptor) Seal(ctx context.Context, data, aad []byte) ([]byte, error) {
+	key, err := e.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(key.header), len(key.header)+nonceSize+len(data)+key.aead.Overhead())
+	copy(out, key.header)
+	nonce := out[len(out) : len(out)+nonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out = out[:len(out)+nonceSize]
+	return key.aead.Seal(out, nonce, data, additionalData(out, aad)), nil
+}
+
+// Open decrypts a payload sealed by Seal with the same aad
+func (e *Encryptor) Open(ctx context.Context, sealed, aad []byte) ([]byte, error) {
+	keyID, wrapped, rest, err := parseHeader(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < nonceSize {
+		return nil, fmt.Errorf("%w: payload is truncated", ErrDecrypt)
+	}
+	headerLen := len(sealed) - len(rest) + nonceSize
+	data, err := aead.Open(nil, rest[:nonceSize], rest[nonceSize:], additionalData(sealed[:headerLen], aad))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return data, nil
+}
+
+// additionalData authenticates the header with the caller's aad
+func additionalData(header, aad []byte) []byte {
+	return append(append(make([]byte, 0, len(header)+len(aad)), header...), aad...)
+}
+
+// dataKey returns the key new payloads are sealed with, replacing it once
+// it has been used enough
+func (e *Encryptor) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if k := e.current; k != nil && k.uses < maxKeyUses && time.Since(k.created) < keyLifetime {
+		k.uses++
+		return k, nil
+	}
+
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	keyID := e.wrapper.KeyID()
+	wrapped, err := e.wrapper.Wrap(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	if len(keyID) > 255 || len(wrapped) > 65535 {
+		return nil, fmt.Errorf("wrapped data key of %s is too large", keyID)
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{}, magic...)
+	header = append(header, version, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	e.current = &dataKey{aead: aead, header: header, uses: 1, created: time.Now()}
+	e.remember(keyID, wrapped, aead)
+	return e.current, nil
+}
+
+// unwrap returns the cipher for a wrapped data key, asking the wrapper
+// only for keys not seen before
+func (e *Encryptor) unwrap(ctx context.Context, keyID string, wrapped []byte) (cipher.AEAD, error) {
+	id := keyID + "\x00" + string(wrapped)
+	e.mu.Lock()
+	aead, ok := e.unwrapped[id]
+	e.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	raw, err := e.wrapper.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't unwrap data key of %s: %v", ErrDecrypt, keyID, err)
+	}
+	if aead, err = newAEAD(raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	e.mu.Lock()
+	e.remember(keyID, wrapped, aead)
+	e.mu.Unlock()
+	return aead, nil
+}
+
+// remember keeps an unwrapped data key, starting over once there are too
+// many. e.mu must be held.
+func (e *Encryptor) remember(keyID string, wrapped []byte, aead cipher.AEAD) {
+	if len(e.unwrapped) >= maxUnwrapped {
+		clear(e.unwrapped)
+	}
+	e.unwrapped[keyID+"\x00"+string(wrapped)] = aead
+}
+
+// parseHeader splits a sealed payload into its key ID, wrapped data key
+// and the nonce and ciphertext that follow
+func parseHeader(sealed []byte) (string, []byte, []byte, error) {
+	if !Sealed(sealed) {
+		return "", nil, nil, fmt.Errorf("%w: not a sealed payload", ErrDecrypt)
+	}
+	rest := sealed[len(magic)+1:]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+2 {
+		return "", nil, nil, fmt.Errorf("%w: header is truncated", ErrDecrypt)
+	}
+	keyID := string(rest[1 : 1+rest[0]])
+	rest = rest[1+rest[0]:]
+	n := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if len(rest) < n {
+		return "", nil, nil, fmt.Errorf("%w: header is truncated", ErrDecrypt)
+	}
+	return keyID, rest[:n], rest[n:], nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("data key is %d bytes, not %d", len(key), keySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,128 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/encryption"
+)
+
+func masterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func newEncryptor(t *testing.T, spec string) *encryption.Encryptor {
+	t.Helper()
+	keys, err := encryption.ParseMasterKeys(spec)
+	if err != nil {
+		t.Fatalf("ParseMasterKeys failed: %v", err)
+	}
+	return encryption.New(keys)
+}
+
+func TestEncryptor_SealOpen(t *testing.T) {
+	ctx := context.Background()
+	enc := newEncryptor(t, "k1:"+masterKey(1))
+	plain := []byte("quarterly numbers")
+
+	sealed, err := enc.Seal(ctx, plain, []byte("reports/q1.csv"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if !encryption.Sealed(sealed) || bytes.Contains(sealed, plain) {
+		t.Fatalf("Expected a sealed payload hiding the plaintext, got %q", sealed)
+	}
+	got, err := enc.Open(ctx, sealed, []byte("reports/q1.csv"))
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("Expected %q, got %q (%v)", plain, got, err)
+	}
+
+	// Another Encryptor with the same master key opens it too
+	if got, err := newEncryptor(t, "k1:"+masterKey(1)).Open(ctx, sealed, []byte("reports/q1.csv")); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("Expected another replica to open the payload, got %q (%v)", got, err)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	for name, tt := range map[string]struct {
+		sealed []byte
+		aad    string
+	}{
+		"other key":  {sealed, "reports/q2.csv"},
+		"tampered":   {tampered, "reports/q1.csv"},
+		"truncated":  {sealed[:10], "reports/q1.csv"},
+		"not sealed": {plain, "reports/q1.csv"},
+	} {
+		if _, err := enc.Open(ctx, tt.sealed, []byte(tt.aad)); !errors.Is(err, encryption.ErrDecrypt) {
+			t.Errorf("%s: expected ErrDecrypt, got %v", name, err)
+		}
+	}
+}
+
+func TestEncryptor_MasterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	sealed, err := newEncryptor(t, "old:"+masterKey(1)).Seal(ctx, []byte("data"), nil)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+
+	rotated := newEncryptor(t, "old:"+masterKey(1)+",new:"+masterKey(2))
+	if got, err := rotated.Open(ctx, sealed, nil); err != nil || string(got) != "data" {
+		t.Errorf("Expected the retired key to still open payloads, got %q (%v)", got, err)
+	}
+	if _, err := newEncryptor(t, "new:"+masterKey(2)).Open(ctx, sealed, nil); !errors.Is(err, encryption.ErrDecrypt) {
+		t.Errorf("Expected payloads of a removed key to fail, got %v", err)
+	}
+}
+
+func TestParseMasterKeys_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "k1", "k1:not-base64!", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1:" + masterKey(1) + ",k1:" + masterKey(2)} {
+		if _, err := encryption.ParseMasterKeys(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestTransit(t *testing.T) {
+	// A stand-in for the transit engine that "encrypts" by prefixing
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "secret" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/files":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}})
+		case "/v1/transit/decrypt/files":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	enc := encryption.New(encryption.NewTransit(srv.URL+"/v1/transit/", "files", "secret", srv.Client()))
+	sealed, err := enc.Seal(ctx, []byte("data"), nil)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	other := encryption.New(encryption.NewTransit(srv.URL+"/v1/transit", "files", "secret", srv.Client()))
+	if got, err := other.Open(ctx, sealed, nil); err != nil || string(got) != "data" {
+		t.Errorf("Expected the KMS to unwrap the data key, got %q (%v)", got, err)
+	}
+
+	denied := encryption.New(encryption.NewTransit(srv.URL+"/v1/transit", "files", "wrong", srv.Client()))
+	if _, err := denied.Seal(ctx, []byte("data"), nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the KMS error, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MasterKeys wraps data keys with AES-256-GCM master keys held in
+// configuration. The last key wraps new data keys; the others only unwrap,
+// so a master key can be rotated while payloads sealed under it remain.
+type MasterKeys struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// Ensure MasterKeys implements KeyWrapper
+var _ KeyWrapper = (*MasterKeys)(nil)
+
+// ParseMasterKeys reads a comma-separated list of id:key pairs, where each
+// key is 32 base64-encoded bytes
+func ParseMasterKeys(spec string) (*MasterKeys, error) {
+	mk := &MasterKeys{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || encoded == "" {
+			return nil, fmt.Errorf("invalid master key %q: expected id:base64-key", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %s: %w", id, err)
+		}
+		if _, exists := mk.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate master key %s", id)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %s: %w", id, err)
+		}
+		mk.keys[id] = aead
+		mk.current = id
+	}
+	if mk.current == "" {
+		return nil, errors.New("no master keys given")
+	}
+	return mk, nil
+}
+
+func (mk *MasterKeys) KeyID() string {
+	return mk.current
+}
+
+func (mk *MasterKeys) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	aead := mk.keys[mk.current]
+	nonce := make([]byte, nonceSize, nonceSize+len(key)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, key, []byte(mk.current)), nil
+}
+
+func (mk *MasterKeys) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := mk.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", keyID)
+	}
+	if len(wrapped) < nonceSize {
+		return nil, errors.New("wrapped key is truncated")
+	}
+	return aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(keyID))
+}
+
+// Transit wraps data keys with a key held by a KMS speaking the HashiCorp
+// Vault transit API, so the master key never reaches the service
+type Transit struct {
+	baseURL string
+	key     string
+	token   string
+	client  *http.Client
+}
+
+// Ensure Transit implements KeyWrapper
+var _ KeyWrapper = (*Transit)(nil)
+
+// NewTransit wraps data keys with key on the transit engine mounted at
+// baseURL, such as https://vault:8200/v1/transit, authenticating with
+// token. A nil client uses a client with a 10 second timeout.
+func NewTransit(baseURL, key, token string, client *http.Client) *Transit {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Transit{baseURL: strings.TrimSuffix(baseURL, "/"), key: key, token: token, client: client}
+}
+
+// KeyID returns the transit key name; the key version is part of the
+// wrapped key
+func (t *Transit) KeyID() string {
+	return t.key
+}
+
+func (t *Transit) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := t.call(ctx, "encrypt", t.key, map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Ciphertext == "" {
+		return nil, errors.New("KMS returned no ciphertext")
+	}
+	return []byte(resp.Ciphertext), nil
+}
+
+func (t *Transit) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := t.call(ctx, "decrypt", keyID, map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+// call posts body to the transit operation for key and decodes the data
+// field of the response into out
+func (t *Transit) call(ctx context.Context, operation, key string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := t.baseURL + "/" + operation + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", t.token)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("KMS %s failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("KMS %s failed: %s: %s", operation, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("invalid KMS %s response: %w", operation, err)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("invalid KMS %s response: %w", operation, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// User metadata marking encrypted objects
+const (
+	metaAlgorithm = "Encryption"
+	metaLength    = "Plaintext-Length"
+	algorithm     = "aes-256-gcm"
+)
+
+// Backend is a bucket that can store the metadata marking encrypted objects
+type Backend interface {
+	tenant.Backend
+	storage.MetadataPutter
+}
+
+// Storage encrypts the objects written through PutObject under its
+// prefixes and decrypts encrypted objects on reads, wherever they are.
+// Objects are bound to their key, so they can't be copied to another one.
+type Storage struct {
+	tenant.Backend
+	putter   storage.MetadataPutter
+	enc      *Encryptor
+	prefixes []string
+	metrics  *metrics.Metrics
+}
+
+// Ensure Storage implements the storage interfaces
+var _ tenant.Backend = (*Storage)(nil)
+
+// NewStorage encrypts the objects of backend whose keys start with one of
+// prefixes; an empty prefix covers every key. m may be nil.
+func NewStorage(backend Backend, enc *Encryptor, prefixes []string, m *metrics.Metrics) *Storage {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return &Storage{Backend: backend, putter: backend, enc: enc, prefixes: prefixes, metrics: m}
+}
+
+// covers reports whether objects written to key are encrypted
+func (s *Storage) covers(key string) bool {
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// direct fails for uploads that would bypass encryption
+func (s *Storage) direct(key string) error {
+	if s.covers(key) {
+		return fmt.Errorf("%w: %s is encrypted, so it must be uploaded through the service", storage.ErrAccessDenied, key)
+	}
+	return nil
+}
+
+func (s *Storage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := s.GetObjectWithHeaders(ctx, key)
+	return data, err
+}
+
+// GetObjectWithHeaders decrypts encrypted objects, reporting their
+// plaintext length
+func (s *Storage) GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error) {
+	data, headers, err := s.Backend.GetObjectWithHeaders(ctx, key)
+	if err != nil || !encrypted(headers) {
+		return data, headers, err
+	}
+	plain, err := s.enc.Open(ctx, data, []byte(key))
+	if err != nil {
+		s.metrics.DecryptionFailuresTotal.WithLabelValues("storage").Inc()
+		return nil, nil, fmt.Errorf("failed to decrypt object %s: %w", key, err)
+	}
+	headers = plaintextHeaders(headers)
+	headers.Set("Content-Length", strconv.Itoa(len(plain)))
+	return plain, headers, nil
+}
+
+// StatObject reports the plaintext length of encrypted objects
+func (s *Storage) StatObject(ctx context.Context, key string) (http.Header, error) {
+	headers, err := s.Backend.StatObject(ctx, key)
+	if err != nil || !encrypted(headers) {
+		return headers, err
+	}
+	length := headers.Get("X-Amz-Meta-" + metaLength)
+	headers = plaintextHeaders(headers)
+	headers.Del("Content-Length")
+	if length != "" {
+		headers.Set("Content-Length", length)
+	}
+	return headers, nil
+}
+
+// GetObjectRange reads part of unencrypted objects. Ciphertext can only be
+// authenticated whole, so ranges of encrypted objects are unsupported.
+func (s *Storage) GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error) {
+	if s.covers(key) {
+		return nil, nil, fmt.Errorf("%s is encrypted: %w", key, errors.ErrUnsupported)
+	}
+	data, headers, err := s.Backend.GetObjectRange(ctx, key, offset, length)
+	if err == nil && encrypted(headers) {
+		return nil, nil, fmt.Errorf("%s is encrypted: %w", key, errors.ErrUnsupported)
+	}
+	return data, headers, err
+}
+
+// PutObject encrypts data when key is under one of the prefixes
+func (s *Storage) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	if !s.covers(key) {
+		return s.Backend.PutObject(ctx, key, data, contentType)
+	}
+	plain, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	sealed, err := s.enc.Seal(ctx, plain, []byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt object %s: %w", key, err)
+	}
+	return s.putter.PutObjectWithMetadata(ctx, key, bytes.NewReader(sealed), contentType, map[string]string{
+		metaAlgorithm: algorithm,
+		metaLength:    strconv.Itoa(len(plain)),
+	})
+}
+
+func (s *Storage) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	if err := s.direct(key); err != nil {
+		return nil, err
+	}
+	return s.Backend.PresignPut(ctx, key, contentType, metadata, ttl)
+}
+
+func (s *Storage) CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	if err := s.direct(key); err != nil {
+		return "", err
+	}
+	return s.Backend.CreateMultipartUpload(ctx, key, contentType, metadata)
+}
+
+// encrypted reports whether headers describe an encrypted object
+func encrypted(headers http.Header) bool {
+	return strings.EqualFold(headers.Get("X-Amz-Meta-"+metaAlgorithm), algorithm)
+}
+
+// plaintextHeaders describes the plaintext of an encrypted object. The
+// ETag, a digest of the ciphertext, is marked so it isn't taken for one of
+// the content.
+func plaintextHeaders(headers http.Header) http.Header {
+	headers = headers.Clone()
+	headers.Del("X-Amz-Meta-" + metaAlgorithm)
+	headers.Del("X-Amz-Meta-" + metaLength)
+	if etag := strings.Trim(headers.Get("ETag"), `"`); etag != "" {
+		headers.Set("ETag", `"enc-`+etag+`"`)
+	}
+	return headers
+}
+
+// BucketPrefixes returns the prefixes encrypted in bucket. Each rule is a
+// key prefix, applying to every bucket, or bucket:prefix; with no rules,
+// every key of every bucket is encrypted.
+func BucketPrefixes(rules []string, bucket string) []string {
+	if len(rules) == 0 {
+		return []string{""}
+	}
+	var prefixes []string
+	for _, rule := range rules {
+		name, prefix, ok := strings.Cut(rule, ":")
+		switch {
+		case !ok:
+			prefixes = append(prefixes, rule)
+		case name == bucket:
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,105 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/encryption"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	backend := mocks.NewMockStorage()
+	s := encryption.NewStorage(backend, newEncryptor(t, "k1:"+masterKey(1)), []string{"secret/"}, nil)
+
+	plain := []byte("launch codes")
+	if err := s.PutObject(ctx, "secret/codes.txt", bytes.NewReader(plain), "text/plain"); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if err := s.PutObject(ctx, "public/readme.txt", strings.NewReader("hello"), "text/plain"); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	stored, _ := backend.GetObject(ctx, "secret/codes.txt")
+	if bytes.Contains(stored, plain) {
+		t.Error("Expected the object to be stored encrypted")
+	}
+	if stored, _ := backend.GetObject(ctx, "public/readme.txt"); string(stored) != "hello" {
+		t.Errorf("Expected objects outside the prefixes to be stored as is, got %q", stored)
+	}
+
+	data, headers, err := s.GetObjectWithHeaders(ctx, "secret/codes.txt")
+	if err != nil || !bytes.Equal(data, plain) {
+		t.Fatalf("Expected the decrypted object, got %q (%v)", data, err)
+	}
+	if headers.Get("Content-Length") != "12" || headers.Get("X-Amz-Meta-Encryption") != "" {
+		t.Errorf("Expected plaintext headers, got %v", headers)
+	}
+	if data, err := s.GetObject(ctx, "public/readme.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("Expected the plain object, got %q (%v)", data, err)
+	}
+
+	backend.SetObjectHeaders("secret/codes.txt", http.Header{
+		"Etag":                        []string{`"0123abcd"`},
+		"X-Amz-Meta-Encryption":       []string{"aes-256-gcm"},
+		"X-Amz-Meta-Plaintext-Length": []string{"12"},
+	})
+	stat, err := s.StatObject(ctx, "secret/codes.txt")
+	if err != nil {
+		t.Fatalf("StatObject failed: %v", err)
+	}
+	if stat.Get("Content-Length") != "12" || stat.Get("ETag") != `"enc-0123abcd"` {
+		t.Errorf("Expected the plaintext length and a marked ETag, got %v", stat)
+	}
+
+	// Ciphertext is only read whole
+	if _, _, err := s.GetObjectRange(ctx, "secret/codes.txt", 0, 4); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected ranges of encrypted objects to be unsupported, got %v", err)
+	}
+	if data, _, err := s.GetObjectRange(ctx, "public/readme.txt", 1, 3); err != nil || string(data) != "ell" {
+		t.Errorf("Expected the range of the plain object, got %q (%v)", data, err)
+	}
+
+	// Objects are bound to their key
+	backend.SetObject("secret/copy.txt", stored)
+	backend.SetObjectHeaders("secret/copy.txt", http.Header{"X-Amz-Meta-Encryption": []string{"aes-256-gcm"}})
+	if _, err := s.GetObject(ctx, "secret/copy.txt"); !errors.Is(err, encryption.ErrDecrypt) {
+		t.Errorf("Expected a copied object to fail to decrypt, got %v", err)
+	}
+
+	if _, err := s.PresignPut(ctx, "secret/upload.bin", "", nil, time.Minute); !errors.Is(err, storage.ErrAccessDenied) {
+		t.Errorf("Expected direct uploads to encrypted prefixes to be refused, got %v", err)
+	}
+	if _, err := s.CreateMultipartUpload(ctx, "secret/upload.bin", "", nil); !errors.Is(err, storage.ErrAccessDenied) {
+		t.Errorf("Expected multipart uploads to encrypted prefixes to be refused, got %v", err)
+	}
+	if _, err := s.PresignPut(ctx, "public/upload.bin", "", nil, time.Minute); err != nil {
+		t.Errorf("Expected direct uploads elsewhere to work, got %v", err)
+	}
+}
+
+func TestBucketPrefixes(t *testing.T) {
+	tests := []struct {
+		rules  []string
+		bucket string
+		want   []string
+	}{
+		{nil, "files", []string{""}},
+		{[]string{"secret/", "files:private/", "other:"}, "files", []string{"secret/", "private/"}},
+		{[]string{"secret/", "files:private/", "other:"}, "other", []string{"secret/", ""}},
+		{[]string{"files:private/"}, "other", nil},
+	}
+	for _, tt := range tests {
+		if got := encryption.BucketPrefixes(tt.rules, tt.bucket); !slices.Equal(got, tt.want) {
+			t.Errorf("BucketPrefixes(%v, %s) = %q, want %q", tt.rules, tt.bucket, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package events notifies other systems of what happens to files: reads,
+// uploads, deletes, cache misses and purges. Each sink has its own queue, drained by
+// a background worker that retries failed deliveries, so a slow or failing
+// sink never delays the request that caused an event. Events are dropped
+// rather than queued when a sink's queue is full.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// Type names what happened
+type Type string
+
+// Event types
+const (
+	// FileAccessed is published when a file is served, through any API
+	FileAccessed Type = "file.accessed"
+	// FileUploaded is published once a file is stored, whichever API it
+	// was uploaded through
+	FileUploaded Type = "file.uploaded"
+	// FileDeleted is published once a file is deleted from storage
+	FileDeleted Type = "file.deleted"
+	// CacheMiss is published when a file missed the cache and was fetched
+	// from storage
+	CacheMiss Type = "cache.miss"
+	// CachePurged is published when an admin purges cache entries
+	CachePurged Type = "cache.purged"
+)
+
+// Types lists every event type
+var Types = []Type{FileAccessed, FileUploaded, FileDeleted, CacheMiss, CachePurged}
+
+// NotificationTypes are the types webhooks receive unless configured
+// otherwise: every type but FileAccessed, which is published for every read
+var NotificationTypes = []Type{FileUploaded, FileDeleted, CacheMiss, CachePurged}
+
+// ErrPermanent is returned, possibly wrapped, by sinks for deliveries that
+// would fail again, such as ones the receiver rejected. They aren't retried.
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Event describes something that happened to a file or to the cache
+type Event struct {
+	// ID identifies the event, so receivers can ignore redeliveries
+	ID   string `json:"id"`
+	Type Type   `json:"type"`
+	Key  string `json:"key,omitempty"`
+	// Keys and Prefix are the entries an admin purged
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	// Size is the size in bytes, or 0 when unknown
+	Size        int64  `json:"size,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	// Source is the API a file was read or uploaded through
+	Source string `json:"source,omitempty"`
+	// Served is where a file read was served from: cache or storage
+	Served    string    `json:"served,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Sink delivers events to another system
+type Sink interface {
+	// Name identifies the sink in logs and metrics
+	Name() string
+	// Send delivers e. Errors are retried unless they wrap ErrPermanent.
+	Send(ctx context.Context, e Event) error
+}
+
+// Filter returns a sink receiving only the events of the given types from
+// a Bus. No types leaves sink receiving every event.
+func Filter(sink Sink, types []Type) Sink {
+	if len(types) == 0 {
+		return sink
+	}
+	return &filtered{Sink: sink, types: types}
+}
+
+// filtered is a sink receiving only some types of events
+type filtered struct {
+	Sink
+	types []Type
+}
+
+// accepts reports whether sink receives events of type t
+func accepts(sink Sink, t Type) bool {
+	f, ok := sink.(*filtered)
+	return !ok || slices.Contains(f.types, t)
+}
+
+// ParseTypes reads event type names; no names returns nil
+func ParseTypes(names []string) ([]Type, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	types := make([]Type, 0, len(names))
+	for _, name := range names {
+		if !slices.Contains(Types, Type(name)) {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+		types = append(types, Type(name))
+	}
+	return types, nil
+}
+
+// Config controls how events are delivered
+type Config struct {
+	// QueueSize caps the events waiting for each sink
+	QueueSize int
+	// MaxAttempts is how many times a delivery is tried
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each one
+	Backoff time.Duration
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+	// Metrics records deliveries; nil records nowhere
+	Metrics *metrics.Metrics
+}
+
+// delivery is an event queued for a sink, with the context of the request
+// that published it
+type delivery struct {
+	ctx   context.Context
+	event Event
+}
+
+// outbox queues events for one sink
+type outbox struct {
+	sink  Sink
+	queue chan delivery
+}
+
+// Bus publishes events to its sinks in the background. A nil Bus publishes
+// nothing.
+type Bus struct {
+	cfg      Config
+	outboxes []*outbox
+	metrics  *metrics.Metrics
+	wg       sync.WaitGroup
+
+	// ctx is canceled when Close gives up waiting for queued events
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a Bus delivering to sinks and starts a worker for each
+func New(cfg Config, sinks ...Sink) (*Bus, error) {
+	if len(sinks) == 0 {
+		return nil, errors.New("event bus has no sinks")
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Noop()
+	}
+
+	b := &Bus{cfg: cfg, metrics: cfg.Metrics}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	for _, sink := range sinks {
+		o := &outbox{sink: sink, queue: make(chan delivery, cfg.QueueSize)}
+		b.outboxes = append(b.outboxes, o)
+		b.wg.Add(1)
+		go b.work(o)
+	}
+	return b, nil
+}
+
+// Publish queues e for every sink receiving its type. The ID, time, tenant
+// and request ID are filled in from ctx when unset. Sinks receive it
+// detached from ctx but keep its values, such as the request ID.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil || !slices.ContainsFunc(b.outboxes, func(o *outbox) bool { return accepts(o.sink, e.Type) }) {
+		return
+	}
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.RequestID == "" {
+		e.RequestID = logger.RequestID(ctx)
+	}
+	if t, ok := tenant.FromContext(ctx); ok && e.Tenant == "" {
+		e.Tenant = t.ID
+	}
+	d := delivery{ctx: context.WithoutCancel(ctx), event: e}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, o := range b.outboxes {
+		if !accepts(o.sink, e.Type) {
+			continue
+		}
+		if !b.closed {
+			select {
+			case o.queue <- d:
+				b.metrics.EventsTotal.WithLabelValues(o.sink.Name(), "queued").Inc()
+				continue
+			default:
+			}
+		}
+		b.metrics.EventsTotal.WithLabelValues(o.sink.Name(), "dropped").Inc()
+		slog.WarnContext(ctx, "Event queue full, event dropped", "sink", o.sink.Name(), "event", e.Type, "key", e.Key)
+	}
+}
+
+// Queued returns the number of events waiting for delivery, across sinks
+func (b *Bus) Queued() int {
+	if b == nil {
+		return 0
+	}
+	n := 0
+	for _, o := range b.outboxes {
+		n += len(o.queue)
+	}
+	return n
+}
+
+// Close stops accepting events and waits for the queued ones to be
+// delivered. When ctx ends first, running deliveries are canceled and the
+// rest of the queues are dropped.
+func (b *Bus) Close(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, o := range b.outboxes {
+			close(o.queue)
+		}
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work delivers the events queued for o in order
+func (b *Bus) work(o *outbox) {
+	defer b.wg.Done()
+	name := o.sink.Name()
+	for d := range o.queue {
+		if b.ctx.Err() != nil {
+			b.metrics.EventsTotal.WithLabelValues(name, "dropped").Inc()
+			continue
+		}
+		if err := b.deliver(o.sink, d); err != nil {
+			b.metrics.EventsTotal.WithLabelValues(name, "failed").Inc()
+			slog.ErrorContext(d.ctx, "Event delivery failed", "sink", name, "event", d.event.Type, "key", d.event.Key, "id", d.event.ID, "error", err)
+			continue
+		}
+		b.metrics.EventsTotal.WithLabelValues(name, "delivered").Inc()
+	}
+}
+
+// deliver sends d to sink, retrying failures with exponential backoff
+func (b *Bus) deliver(sink Sink, d delivery) error {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(d.ctx, b.cfg.Timeout)
+		stop := context.AfterFunc(b.ctx, cancel)
+		err := sink.Send(ctx, d.event)
+		stop()
+		cancel()
+		if err == nil || errors.Is(err, ErrPermanent) || attempt >= b.cfg.MaxAttempts || b.ctx.Err() != nil {
+			return err
+		}
+
+		b.metrics.EventsTotal.WithLabelValues(sink.Name(), "retry").Inc()
+		backoff := b.cfg.Backoff << (attempt - 1)
+		slog.WarnContext(d.ctx, "Event delivery failed, retrying", "sink", sink.Name(), "event", d.event.Type, "attempt", attempt, "backoff", backoff.String(), "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-b.ctx.Done():
+			return err
+		}
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
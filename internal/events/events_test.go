@@ -0,0 +1,269 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// sinkFunc is a Sink running a function
+type sinkFunc struct {
+	name string
+	send func(ctx context.Context, e events.Event) error
+}
+
+func (s sinkFunc) Name() string { return s.name }
+
+func (s sinkFunc) Send(ctx context.Context, e events.Event) error { return s.send(ctx, e) }
+
+// recorder is a Sink recording the events it receives
+type recorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Send(ctx context.Context, e events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recorder) get() []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]events.Event(nil), r.events...)
+}
+
+// wait waits until r has received n events
+func (r *recorder) wait(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.get()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("recorder has %d events, want %d", len(r.get()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newBus(t *testing.T, cfg events.Config, sinks ...events.Sink) *events.Bus {
+	t.Helper()
+	b, err := events.New(cfg, sinks...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return b
+}
+
+func TestBusDeliversInOrder(t *testing.T) {
+	rec := &recorder{}
+	b := newBus(t, events.Config{}, rec)
+
+	ctx := tenant.NewContext(context.Background(), &tenant.Tenant{ID: "acme"})
+	b.Publish(ctx, events.Event{Type: events.FileUploaded, Key: "a.txt", Size: 3})
+	b.Publish(ctx, events.Event{Type: events.FileDeleted, Key: "a.txt"})
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got := rec.get()
+	if len(got) != 2 || got[0].Type != events.FileUploaded || got[1].Type != events.FileDeleted {
+		t.Fatalf("delivered %+v, want upload then delete", got)
+	}
+	if got[0].ID == "" || got[0].ID == got[1].ID {
+		t.Errorf("IDs = %q, %q, want distinct IDs", got[0].ID, got[1].ID)
+	}
+	if got[0].Time.IsZero() || got[0].Tenant != "acme" || got[0].Size != 3 {
+		t.Errorf("event = %+v, want time, tenant acme and size 3", got[0])
+	}
+}
+
+func TestBusFiltersTypes(t *testing.T) {
+	rec := &recorder{}
+	b := newBus(t, events.Config{}, events.Filter(rec, []events.Type{events.FileDeleted}))
+	b.Publish(context.Background(), events.Event{Type: events.CacheMiss, Key: "a.txt"})
+	b.Publish(context.Background(), events.Event{Type: events.FileDeleted, Key: "a.txt"})
+	b.Close(context.Background())
+
+	if got := rec.get(); len(got) != 1 || got[0].Type != events.FileDeleted {
+		t.Errorf("delivered %+v, want only the delete", got)
+	}
+}
+
+func TestBusRetries(t *testing.T) {
+	var attempts atomic.Int32
+	sink := sinkFunc{name: "flaky", send: func(ctx context.Context, e events.Event) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}}
+	b := newBus(t, events.Config{MaxAttempts: 3, Backoff: time.Millisecond}, sink)
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded, Key: "a.txt"})
+	b.Close(context.Background())
+
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestBusDoesNotRetryPermanentFailures(t *testing.T) {
+	var attempts atomic.Int32
+	sink := sinkFunc{name: "rejecting", send: func(ctx context.Context, e events.Event) error {
+		attempts.Add(1)
+		return events.ErrPermanent
+	}}
+	b := newBus(t, events.Config{MaxAttempts: 5, Backoff: time.Millisecond}, sink)
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded, Key: "a.txt"})
+	b.Close(context.Background())
+
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var delivered atomic.Int32
+	slow := sinkFunc{name: "slow", send: func(ctx context.Context, e events.Event) error {
+		started <- struct{}{}
+		<-release
+		delivered.Add(1)
+		return nil
+	}}
+	rec := &recorder{}
+	b := newBus(t, events.Config{QueueSize: 1}, slow, rec)
+
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded, Key: "1"})
+	<-started
+	rec.wait(t, 1)
+	// One event waits in the slow sink's queue, the next is dropped for it
+	// and still reaches the other sink
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded, Key: "2"})
+	rec.wait(t, 2)
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded, Key: "3"})
+	close(release)
+	b.Close(context.Background())
+
+	if n := delivered.Load(); n != 2 {
+		t.Errorf("slow sink delivered %d events, want 2", n)
+	}
+	if got := rec.get(); len(got) != 3 {
+		t.Errorf("other sink delivered %d events, want 3", len(got))
+	}
+}
+
+func TestBusCloseGivesUp(t *testing.T) {
+	blocked := sinkFunc{name: "blocked", send: func(ctx context.Context, e events.Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	b := newBus(t, events.Config{Timeout: time.Hour}, blocked)
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded, Key: "a.txt"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want deadline exceeded", err)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var b *events.Bus
+	b.Publish(context.Background(), events.Event{Type: events.FileUploaded})
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
+
+func TestParseTypes(t *testing.T) {
+	types, err := events.ParseTypes([]string{"file.uploaded", "cache.purged"})
+	if err != nil || len(types) != 2 {
+		t.Errorf("ParseTypes = %v, %v", types, err)
+	}
+	if _, err := events.ParseTypes([]string{"file.renamed"}); err == nil {
+		t.Error("ParseTypes accepted an unknown type")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers http.Header
+		body    []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		headers = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	hook, err := events.NewWebhook(srv.URL+"/hooks", "s3cret")
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	e := events.Event{ID: "abc", Type: events.FileDeleted, Key: "a.txt", Time: time.Now()}
+	if err := hook.Send(context.Background(), e); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := headers.Get(events.HeaderSignature), events.Sign([]byte("s3cret"), body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if headers.Get(events.HeaderEvent) != "file.deleted" || headers.Get(events.HeaderDelivery) != "abc" {
+		t.Errorf("headers = %v, want event and delivery headers", headers)
+	}
+	var got events.Event
+	if err := json.Unmarshal(body, &got); err != nil || got.Key != "a.txt" || got.Type != events.FileDeleted {
+		t.Errorf("body = %s, want the event", body)
+	}
+}
+
+func TestWebhookFailures(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusInternalServerError, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		hook, _ := events.NewWebhook(srv.URL, "")
+		err := hook.Send(context.Background(), events.Event{Type: events.CacheMiss})
+		srv.Close()
+		if err == nil || errors.Is(err, events.ErrPermanent) != tt.permanent {
+			t.Errorf("status %d: err = %v, want permanent %v", tt.status, err, tt.permanent)
+		}
+	}
+}
+
+func TestNewWebhookRejectsInvalidURLs(t *testing.T) {
+	for _, target := range []string{"", "hooks.example.com", "ftp://example.com/hook"} {
+		if _, err := events.NewWebhook(target, ""); err == nil {
+			t.Errorf("NewWebhook(%q) succeeded", target)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	eventsv1 "github.com/ch374n/file-downloader/api/events/v1"
+)
+
+// Format is how events are serialized for streaming
+type Format string
+
+// Event formats
+const (
+	// FormatJSON encodes events as the JSON posted to webhooks
+	FormatJSON Format = "json"
+	// FormatProtobuf encodes events as the events.v1.Event message in
+	// api/events/v1/events.proto
+	FormatProtobuf Format = "protobuf"
+)
+
+// ParseFormat reads a format name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case FormatJSON, FormatProtobuf:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown event format %q: must be json or protobuf", name)
+}
+
+// ContentType is the media type of events encoded in f
+func (f Format) ContentType() string {
+	if f == FormatProtobuf {
+		return "application/x-protobuf"
+	}
+	return "application/json"
+}
+
+// Marshal encodes e in f
+func (f Format) Marshal(e Event) ([]byte, error) {
+	if f == FormatProtobuf {
+		return proto.Marshal(toProto(e))
+	}
+	return json.Marshal(e)
+}
+
+// toProto converts e to its events.v1.Event message
+func toProto(e Event) *eventsv1.Event {
+	msg := &eventsv1.Event{
+		Id:          e.ID,
+		Type:        string(e.Type),
+		Key:         e.Key,
+		Keys:        e.Keys,
+		Prefix:      e.Prefix,
+		Size:        e.Size,
+		ContentType: e.ContentType,
+		Source:      e.Source,
+		Served:      e.Served,
+		Tenant:      e.Tenant,
+		RequestId:   e.RequestID,
+	}
+	if !e.Time.IsZero() {
+		msg.Time = timestamppb.New(e.Time)
+	}
+	return msg
+}
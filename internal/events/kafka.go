@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+// kafkaDeliveryTimeout bounds how long the client retries a record, so the
+// records Send gave up on don't pile up while the brokers are down. It runs
+// from the record's timestamp, so records are stamped when produced rather
+// than with the time of their event.
+const kafkaDeliveryTimeout = 30 * time.Second
+
+// Kafka errors that call for a delivery to be given up rather than retried
+var kafkaPermanentErrors = []error{
+	kerr.CorruptMessage,
+	kerr.MessageTooLarge,
+	kerr.RecordListTooLarge,
+	kerr.InvalidRecord,
+}
+
+// Kafka produces events to a topic with franz-go, waiting for every in-sync
+// replica to have them. Events are keyed by file name, which the client
+// hashes with murmur2 like the Java client does, so the events of a file
+// stay in order in one partition.
+type Kafka struct {
+	cfg    StreamConfig
+	client *kgo.Client
+}
+
+// Ensure Kafka implements Sink
+var _ Sink = (*Kafka)(nil)
+
+// NewKafka creates a sink producing to the topic cfg.Topic, bootstrapped
+// from cfg.Brokers. Brokers default to port 9092. Brokers are connected to
+// on the first Send.
+func NewKafka(cfg StreamConfig) (*Kafka, error) {
+	if err := cfg.normalize("Kafka", "9092"); err != nil {
+		return nil, err
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID("file-caching-service"),
+		kgo.DefaultProduceTopic(cfg.Topic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProducerLinger(0),
+		kgo.RecordDeliveryTimeout(kafkaDeliveryTimeout),
+	}
+	if cfg.TLS != nil {
+		opts = append(opts, kgo.DialTLSConfig(cfg.TLS))
+	}
+	if cfg.Username != "" {
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism()))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka configuration: %w", err)
+	}
+	return &Kafka{cfg: cfg, client: client}, nil
+}
+
+func (k *Kafka) Name() string { return "kafka:" + k.cfg.Topic }
+
+func (k *Kafka) Send(ctx context.Context, e Event) error {
+	value, err := k.cfg.Format.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode event: %v", ErrPermanent, err)
+	}
+	record := &kgo.Record{
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: "event-type", Value: []byte(e.Type)},
+			{Key: "content-type", Value: []byte(k.cfg.Format.ContentType())},
+		},
+	}
+	if e.Key != "" {
+		record.Key = []byte(e.Key)
+	}
+
+	// The client keeps a record it has sent until the broker answers, so
+	// Send stops waiting at the deadline instead; a record delivered after
+	// that is sent again, which consumers tell apart by its ID
+	done := make(chan error, 1)
+	k.client.Produce(ctx, record, func(_ *kgo.Record, err error) {
+		done <- err
+	})
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err == nil {
+		return nil
+	}
+	for _, permanent := range kafkaPermanentErrors {
+		if errors.Is(err, permanent) {
+			return fmt.Errorf("%w: Kafka rejected the event: %v", ErrPermanent, err)
+		}
+	}
+	return connError(ctx, fmt.Errorf("Kafka produce failed: %w", err))
+}
+
+// Close closes the connections to the brokers, failing the records still
+// being produced
+func (k *Kafka) Close() error {
+	k.client.Close()
+	return nil
+}
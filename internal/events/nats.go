@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsFlushTimeout bounds waiting for the server to confirm a publish when
+// the context has no deadline
+const natsFlushTimeout = 30 * time.Second
+
+// NATS publishes events to a subject with core NATS. Every publish is
+// flushed with a PING, so Send only succeeds once the server has the event;
+// like any core NATS message, it then reaches the subscribers connected at
+// the time.
+type NATS struct {
+	cfg StreamConfig
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// Ensure NATS implements Sink
+var _ Sink = (*NATS)(nil)
+
+// NewNATS creates a sink publishing to the subject cfg.Topic on the first
+// reachable server of cfg.Brokers. Servers default to port 4222.
+func NewNATS(cfg StreamConfig) (*NATS, error) {
+	if err := cfg.normalize("NATS", "4222"); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(cfg.Topic, "*>") {
+		return nil, fmt.Errorf("invalid NATS subject %q: wildcards can't be published to", cfg.Topic)
+	}
+	return &NATS{cfg: cfg}, nil
+}
+
+func (n *NATS) Name() string { return "nats:" + n.cfg.Topic }
+
+func (n *NATS) Send(ctx context.Context, e Event) error {
+	payload, err := n.cfg.Format.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode event: %v", ErrPermanent, err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil || n.conn.IsClosed() {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+	if limit := n.conn.MaxPayload(); limit > 0 && int64(len(payload)) > limit {
+		return fmt.Errorf("%w: event of %d bytes is over the server's %d byte limit", ErrPermanent, len(payload), limit)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, natsFlushTimeout)
+		defer cancel()
+	}
+	if err := n.conn.Publish(n.cfg.Topic, payload); err != nil {
+		n.reset()
+		return fmt.Errorf("NATS publish failed: %w", err)
+	}
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		n.reset()
+		return connError(ctx, fmt.Errorf("NATS publish failed: %w", err))
+	}
+	return nil
+}
+
+// connect opens a connection to the first server of the pool that accepts
+// one. The client doesn't reconnect by itself: a failed Send closes the
+// connection and the next one connects again, so failures reach the retry
+// logic of the sink instead of piling up in a reconnect buffer.
+func (n *NATS) connect() error {
+	scheme := "nats://"
+	opts := []nats.Option{nats.Name("file-caching-service"), nats.DontRandomize(), nats.NoReconnect()}
+	if n.cfg.TLS != nil {
+		scheme = "tls://"
+		opts = append(opts, nats.Secure(n.cfg.TLS))
+	}
+	if n.cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(n.cfg.Username, n.cfg.Password))
+	} else if n.cfg.Password != "" {
+		opts = append(opts, nats.Token(n.cfg.Password))
+	}
+	urls := make([]string, len(n.cfg.Brokers))
+	for i, broker := range n.cfg.Brokers {
+		urls[i] = scheme + broker
+	}
+
+	conn, err := nats.Connect(strings.Join(urls, ","), opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	n.conn = conn
+	return nil
+}
+
+// reset closes the connection after a failure, so the next Send connects
+// again
+func (n *NATS) reset() {
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.conn = nil
+}
+
+// Close closes the connection to the server
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reset()
+	return nil
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StreamConfig is how to reach the Kafka cluster or NATS servers events are
+// streamed to
+type StreamConfig struct {
+	// Brokers are the Kafka bootstrap brokers or the NATS servers, as
+	// host:port
+	Brokers []string
+	// Topic is the Kafka topic or the NATS subject events are published to
+	Topic string
+	// Format is how events are serialized
+	Format Format
+	// TLS encrypts connections when set
+	TLS *tls.Config
+	// Username and Password authenticate with SASL PLAIN to Kafka, or as a
+	// user to NATS; a Password alone is a NATS token
+	Username string
+	Password string
+}
+
+// normalize checks c, filling in defaults and the port of brokers given
+// without one
+func (c *StreamConfig) normalize(kind string, defaultPort string) error {
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("%s needs at least one broker", kind)
+	}
+	brokers := make([]string, len(c.Brokers))
+	for i, broker := range c.Brokers {
+		broker = strings.TrimPrefix(strings.TrimPrefix(broker, "nats://"), "tls://")
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			broker = net.JoinHostPort(broker, defaultPort)
+		}
+		brokers[i] = broker
+	}
+	c.Brokers = brokers
+	if c.Topic == "" || strings.ContainsAny(c.Topic, " \t\r\n") {
+		return fmt.Errorf("invalid %s topic %q", kind, c.Topic)
+	}
+	if c.Format == "" {
+		c.Format = FormatJSON
+	}
+	return nil
+}
+
+// connError reports the cause of a failed exchange on a connection,
+// preferring the context's error when the context interrupted it
+func connError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
+}
@@ -0,0 +1,352 @@
+package events_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"google.golang.org/protobuf/proto"
+
+	eventsv1 "github.com/ch374n/file-downloader/api/events/v1"
+	"github.com/ch374n/file-downloader/internal/events"
+)
+
+// natsServer is a NATS server speaking just enough of the protocol to
+// receive publishes
+type natsServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	connects []string
+	msgs     map[string][][]byte
+}
+
+func newNATSServer(t *testing.T) *natsServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	s := &natsServer{ln: ln, msgs: make(map[string][][]byte)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1024}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			s.mu.Lock()
+			s.connects = append(s.connects, strings.TrimPrefix(line, "CONNECT "))
+			s.mu.Unlock()
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "PUB "):
+			var subject string
+			var n int
+			fmt.Sscanf(line, "PUB %s %d", &subject, &n)
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.msgs[subject] = append(s.msgs[subject], payload[:n])
+			s.mu.Unlock()
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	srv := newNATSServer(t)
+	sink, err := events.NewNATS(events.StreamConfig{
+		Brokers:  []string{"nats://" + srv.ln.Addr().String()},
+		Topic:    "files.events",
+		Password: "token",
+	})
+	if err != nil {
+		t.Fatalf("NewNATS: %v", err)
+	}
+	defer sink.Close()
+
+	for _, key := range []string{"a.txt", "b.txt"} {
+		if err := sink.Send(context.Background(), events.Event{ID: key, Type: events.FileAccessed, Key: key}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if err := sink.Send(context.Background(), events.Event{Type: events.CachePurged, Prefix: strings.Repeat("x", 2048)}); err == nil {
+		t.Error("Send accepted an event over the server's payload limit")
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.connects) != 1 || !strings.Contains(srv.connects[0], `"auth_token":"token"`) {
+		t.Errorf("connects = %v, want one authenticated with the token", srv.connects)
+	}
+	msgs := srv.msgs["files.events"]
+	if len(msgs) != 2 {
+		t.Fatalf("published %d messages, want 2", len(msgs))
+	}
+	var e events.Event
+	if err := json.Unmarshal(msgs[1], &e); err != nil || e.Key != "b.txt" || e.Type != events.FileAccessed {
+		t.Errorf("message = %s, want the event for b.txt", msgs[1])
+	}
+}
+
+func TestNATSFailsOver(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	srv := newNATSServer(t)
+	sink, _ := events.NewNATS(events.StreamConfig{Brokers: []string{down, srv.ln.Addr().String()}, Topic: "files"})
+	defer sink.Close()
+	if err := sink.Send(context.Background(), events.Event{Type: events.FileDeleted, Key: "a.txt"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+// consumeKafka reads n records of topic from the start
+func consumeKafka(t *testing.T, cluster *kfake.Cluster, topic string, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics(topic))
+	if err != nil {
+		t.Fatalf("kgo.NewClient: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("consumed %d records, want %d", len(records), n)
+		}
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+func TestKafka(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.NumBrokers(3), kfake.SeedTopics(8, "events"))
+	defer cluster.Close()
+	sink, err := events.NewKafka(events.StreamConfig{
+		Brokers: cluster.ListenAddrs(),
+		Topic:   "events",
+		Format:  events.FormatProtobuf,
+	})
+	if err != nil {
+		t.Fatalf("NewKafka: %v", err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, e := range []events.Event{
+		{ID: "1", Type: events.FileUploaded, Key: "reports/a.pdf", Size: 42, Time: time.Unix(1700000000, 5)},
+		{ID: "2", Type: events.FileDeleted, Key: "reports/a.pdf"},
+		{ID: "3", Type: events.CachePurged, Prefix: "reports/"},
+	} {
+		if err := sink.Send(ctx, e); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	records := make(map[string]*kgo.Record)
+	for _, r := range consumeKafka(t, cluster, "events", 3) {
+		var msg eventsv1.Event
+		if err := proto.Unmarshal(r.Value, &msg); err != nil {
+			t.Fatalf("decoding record: %v", err)
+		}
+		records[msg.GetId()] = r
+	}
+	first, second, purge := records["1"], records["2"], records["3"]
+	if first == nil || second == nil || purge == nil {
+		t.Fatalf("records = %v, want events 1, 2 and 3", records)
+	}
+	if string(first.Key) != "reports/a.pdf" || first.Partition != second.Partition {
+		t.Errorf("records of one file went to partitions %d and %d", first.Partition, second.Partition)
+	}
+	if purge.Key != nil {
+		t.Errorf("purge key = %q, want none", purge.Key)
+	}
+	headers := make(map[string]string)
+	for _, h := range first.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers["event-type"] != "file.uploaded" || headers["content-type"] != "application/x-protobuf" {
+		t.Errorf("headers = %v", headers)
+	}
+}
+
+func TestKafkaSASL(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.SeedTopics(1, "events"), kfake.EnableSASL(), kfake.Superuser("PLAIN", "svc", "secret"))
+	defer cluster.Close()
+
+	for _, tt := range []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"valid", "secret", false},
+		{"wrong password", "guess", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := events.NewKafka(events.StreamConfig{
+				Brokers:  cluster.ListenAddrs(),
+				Topic:    "events",
+				Username: "svc",
+				Password: tt.password,
+			})
+			if err != nil {
+				t.Fatalf("NewKafka: %v", err)
+			}
+			defer sink.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err = sink.Send(ctx, events.Event{ID: "1", Type: events.FileDeleted, Key: "a.txt"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKafkaRejectedEventIsPermanent(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.SeedTopics(1, "events"))
+	defer cluster.Close()
+	cluster.ControlKey(int16(kmsg.Produce), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		produce := req.(*kmsg.ProduceRequest)
+		resp := produce.ResponseKind().(*kmsg.ProduceResponse)
+		for _, topic := range produce.Topics {
+			rt := kmsg.NewProduceResponseTopic()
+			rt.Topic = topic.Topic
+			for _, partition := range topic.Partitions {
+				rp := kmsg.NewProduceResponseTopicPartition()
+				rp.Partition = partition.Partition
+				rp.ErrorCode = kerr.MessageTooLarge.Code
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+		}
+		return resp, nil, true
+	})
+
+	sink, err := events.NewKafka(events.StreamConfig{Brokers: cluster.ListenAddrs(), Topic: "events"})
+	if err != nil {
+		t.Fatalf("NewKafka: %v", err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = sink.Send(ctx, events.Event{ID: "1", Type: events.FileDeleted, Key: "a.txt"})
+	if !errors.Is(err, events.ErrPermanent) {
+		t.Errorf("Send = %v, want ErrPermanent", err)
+	}
+}
+
+func TestFormatProtobufRoundTrip(t *testing.T) {
+	e := events.Event{
+		ID:          "evt-1",
+		Type:        events.CachePurged,
+		Key:         "reports/a.pdf",
+		Keys:        []string{"reports/a.pdf", "reports/b.pdf"},
+		Prefix:      "reports/",
+		Size:        1 << 40,
+		ContentType: "application/pdf",
+		Source:      "s3",
+		Served:      "cache",
+		Tenant:      "alpha",
+		RequestID:   "req-1",
+		Time:        time.Unix(1700000000, 5).UTC(),
+	}
+	b, err := events.FormatProtobuf.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var msg eventsv1.Event
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	got := events.Event{
+		ID:          msg.GetId(),
+		Type:        events.Type(msg.GetType()),
+		Key:         msg.GetKey(),
+		Keys:        msg.GetKeys(),
+		Prefix:      msg.GetPrefix(),
+		Size:        msg.GetSize(),
+		ContentType: msg.GetContentType(),
+		Source:      msg.GetSource(),
+		Served:      msg.GetServed(),
+		Tenant:      msg.GetTenant(),
+		RequestID:   msg.GetRequestId(),
+		Time:        msg.GetTime().AsTime(),
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("round trip = %+v, want %+v", got, e)
+	}
+
+	// Unset fields stay unset
+	b, err = events.FormatProtobuf.Marshal(events.Event{ID: "evt-2", Type: events.FileDeleted})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	msg.Reset()
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if msg.Time != nil || msg.Keys != nil || msg.Size != 0 {
+		t.Errorf("empty fields were set: %v", &msg)
+	}
+}
+
+func TestNewStreamSinksValidate(t *testing.T) {
+	if _, err := events.NewKafka(events.StreamConfig{Topic: "events"}); err == nil {
+		t.Error("NewKafka accepted no brokers")
+	}
+	if _, err := events.NewKafka(events.StreamConfig{Brokers: []string{"kafka"}}); err == nil {
+		t.Error("NewKafka accepted no topic")
+	}
+	if _, err := events.NewNATS(events.StreamConfig{Brokers: []string{"nats"}, Topic: "files.>"}); err == nil {
+		t.Error("NewNATS accepted a wildcard subject")
+	}
+	if _, err := events.ParseFormat("avro"); err == nil {
+		t.Error("ParseFormat accepted avro")
+	}
+}
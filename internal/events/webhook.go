@@ -0,0 +1,99 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/ch374n/file-downloader/internal/logger"
+)
+
+// Webhook request headers
+const (
+	// HeaderSignature carries the HMAC-SHA256 of the body, as
+	// "sha256=<hex>", when a secret is configured
+	HeaderSignature = "X-Webhook-Signature"
+	// HeaderEvent carries the event type
+	HeaderEvent = "X-Webhook-Event"
+	// HeaderDelivery carries the event ID, the same on every retry
+	HeaderDelivery = "X-Webhook-Delivery"
+)
+
+// Webhook posts events as JSON to a URL. Responses other than 2xx are
+// failures, retried unless they are 4xx other than 408 and 429.
+type Webhook struct {
+	name   string
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// Ensure Webhook implements Sink
+var _ Sink = (*Webhook)(nil)
+
+// NewWebhook creates a Webhook posting to target, signing bodies with
+// secret when it is set
+func NewWebhook(target, secret string) (*Webhook, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q: must be an absolute http(s) URL", u.Redacted())
+	}
+	return &Webhook{name: "webhook:" + u.Host, url: target, secret: []byte(secret), client: &http.Client{}}, nil
+}
+
+// Name identifies the webhook by its host, leaving credentials and paths
+// out of logs and metrics
+func (w *Webhook) Name() string { return w.name }
+
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode event: %v", ErrPermanent, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(e.Type))
+	req.Header.Set(HeaderDelivery, e.ID)
+	if id := logger.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	if len(w.secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: webhook responded with status %d", ErrPermanent, resp.StatusCode)
+	}
+	return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+}
+
+// Sign returns the signature header value for body, so receivers can check
+// it with the shared secret
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
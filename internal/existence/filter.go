@@ -0,0 +1,270 @@
+// Package existence answers whether objects exist without reaching
+// storage: a Bloom filter of the keys in a bucket rules out missing keys,
+// and a short-lived cache remembers the metadata of recent lookups
+package existence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+const (
+	listPageSize = 1000
+	// headroom sizes the filter for this many times the keys listed, so
+	// keys written until the next refresh keep the false positive rate
+	headroom = 2
+	// minCapacity is the fewest keys a filter is sized for
+	minCapacity = 1024
+)
+
+// bloom is a Bloom filter over key hashes
+type bloom struct {
+	bits []uint64
+	k    int
+}
+
+// newBloom sizes a filter for n keys at false positive rate p
+func newBloom(n int, p float64) *bloom {
+	m := int(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := max(1, int(math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloom{bits: make([]uint64, (m+63)/64), k: k}
+}
+
+// hashKey returns the two hashes the filter's k positions are derived from
+func hashKey(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	var h1, h2 uint64
+	for i := range 8 {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	return h1, h2 | 1
+}
+
+func (b *bloom) add(h1, h2 uint64) {
+	m := uint64(len(b.bits)) * 64
+	for i := range uint64(b.k) {
+		pos := (h1 + i*h2) % m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloom) contains(h1, h2 uint64) bool {
+	m := uint64(len(b.bits)) * 64
+	for i := range uint64(b.k) {
+		pos := (h1 + i*h2) % m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Config controls which keys a Filter covers
+type Config struct {
+	// Prefixes lists the key prefixes covered; "*" covers every key
+	Prefixes []string
+	// FalsePositiveRate is the share of missing keys the filter can't tell
+	// apart from stored ones, which are then looked up in storage
+	FalsePositiveRate float64
+}
+
+// Filter tells keys known not to be in a bucket from those that may be.
+// It is rebuilt from the bucket listing by Refresh; until the first
+// refresh, and after it is Reset, every key may exist. A nil Filter knows
+// of no missing key.
+type Filter struct {
+	storage     storage.Storage
+	prefixes    []string
+	fpRate      float64
+	metrics     *metrics.Metrics
+	invalidator cache.Invalidator
+
+	mu     sync.RWMutex
+	filter *bloom
+	// pending holds the keys added during a refresh, which the listing may
+	// have missed
+	pending    map[string]struct{}
+	refreshing bool
+}
+
+// New creates a Filter of the keys of s. m may be nil.
+func New(s storage.Storage, cfg Config, m *metrics.Metrics) *Filter {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	prefixes := make([]string, 0, len(cfg.Prefixes))
+	for _, p := range cfg.Prefixes {
+		if p == "*" {
+			p = ""
+		}
+		prefixes = append(prefixes, p)
+	}
+	return &Filter{storage: s, prefixes: prefixes, fpRate: cfg.FalsePositiveRate, metrics: m}
+}
+
+// Covers reports whether the filter knows of missing keys like key
+func (f *Filter) Covers(key string) bool {
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// MayExist reports whether key may be stored. It is false only for keys
+// covered by the filter and absent from the last listing, and not written
+// since.
+func (f *Filter) MayExist(key string) bool {
+	if f == nil || !f.Covers(key) {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.filter == nil {
+		return true
+	}
+	return f.filter.contains(hashKey(key))
+}
+
+// Add records key as stored, before it is written so no read of it is
+// answered as missing once the write is done
+func (f *Filter) Add(key string) {
+	if f == nil || !f.Covers(key) {
+		return
+	}
+	h1, h2 := hashKey(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.refreshing {
+		f.pending[key] = struct{}{}
+	}
+	if f.filter != nil {
+		f.filter.add(h1, h2)
+	}
+}
+
+// Reset makes every key possibly stored until the next refresh, for when
+// keys added elsewhere may have been missed
+func (f *Filter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filter = nil
+	f.metrics.ExistenceFilterKeys.Set(0)
+}
+
+// Refresh rebuilds the filter from the bucket listing
+func (f *Filter) Refresh(ctx context.Context) error {
+	f.mu.Lock()
+	f.refreshing, f.pending = true, make(map[string]struct{})
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.refreshing, f.pending = false, nil
+		f.mu.Unlock()
+	}()
+
+	var hashes [][2]uint64
+	for _, prefix := range f.prefixes {
+		token := ""
+		for {
+			page, err := f.storage.ListObjects(ctx, prefix, token, listPageSize)
+			if err != nil {
+				return fmt.Errorf("failed to list prefix %q: %w", prefix, err)
+			}
+			for _, obj := range page.Objects {
+				h1, h2 := hashKey(obj.Key)
+				hashes = append(hashes, [2]uint64{h1, h2})
+			}
+			if page.NextToken == "" {
+				break
+			}
+			token = page.NextToken
+		}
+	}
+
+	filter := newBloom(max(len(hashes)*headroom, minCapacity), f.fpRate)
+	for _, h := range hashes {
+		filter.add(h[0], h[1])
+	}
+	f.mu.Lock()
+	for key := range f.pending {
+		filter.add(hashKey(key))
+	}
+	f.filter = filter
+	f.mu.Unlock()
+	f.metrics.ExistenceFilterKeys.Set(float64(len(hashes)))
+	return nil
+}
+
+// Run refreshes the filter every interval until ctx is done
+func (f *Filter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := f.Refresh(ctx); err != nil {
+			slog.Warn("Existence filter refresh failed", "error", err)
+		} else {
+			slog.Debug("Existence filter refreshed", "duration_ms", time.Since(start).Milliseconds())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetInvalidator makes f announce the keys written through this replica
+// on inv, so other replicas add them to their filters. It must be called
+// before f is used.
+func (f *Filter) SetInvalidator(inv cache.Invalidator) {
+	f.invalidator = inv
+}
+
+// Announce adds key like Add and tells the other replicas to add it too
+func (f *Filter) Announce(ctx context.Context, key string) error {
+	if f == nil || !f.Covers(key) {
+		return nil
+	}
+	f.Add(key)
+	if f.invalidator == nil {
+		return nil
+	}
+	return f.invalidator.Publish(ctx, cache.Invalidation{Keys: []string{key}})
+}
+
+// Listen adds the keys other replicas announce until ctx is done. Keys
+// announced while the subscription was down may have been missed, so
+// every key may exist again until the next refresh.
+func (f *Filter) Listen(ctx context.Context) error {
+	if f.invalidator == nil {
+		return errors.New("existence filter has no invalidator")
+	}
+	return f.invalidator.Subscribe(ctx, func(inv cache.Invalidation) {
+		if inv.All {
+			f.Reset()
+			return
+		}
+		for _, key := range inv.Keys {
+			f.Add(key)
+		}
+	})
+}
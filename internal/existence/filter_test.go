@@ -0,0 +1,123 @@
+package existence_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/existence"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func newFilter(t *testing.T, s *mocks.MockStorage, prefixes ...string) *existence.Filter {
+	t.Helper()
+	f := existence.New(s, existence.Config{Prefixes: prefixes, FalsePositiveRate: 0.01}, nil)
+	if err := f.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	return f
+}
+
+func TestFilter_MayExist(t *testing.T) {
+	s := mocks.NewMockStorage()
+	for i := range 2500 {
+		s.SetObject(fmt.Sprintf("images/%d.png", i), nil)
+	}
+	s.SetObject("docs/readme.txt", nil)
+
+	if f := existence.New(s, existence.Config{Prefixes: []string{"*"}, FalsePositiveRate: 0.01}, nil); !f.MayExist("missing.png") {
+		t.Error("Expected every key to be possibly stored before the first refresh")
+	}
+
+	f := newFilter(t, s, "images/")
+	for i := range 2500 {
+		if key := fmt.Sprintf("images/%d.png", i); !f.MayExist(key) {
+			t.Fatalf("Expected listed key %s to be possibly stored", key)
+		}
+	}
+	if !f.MayExist("docs/missing.txt") {
+		t.Error("Expected keys outside the prefixes to be possibly stored")
+	}
+	var falsePositives int
+	for i := range 10000 {
+		if f.MayExist(fmt.Sprintf("images/missing-%d.png", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("Expected about 1%% false positives, got %d in 10000", falsePositives)
+	}
+
+	f.Add("images/new.png")
+	if !f.MayExist("images/new.png") {
+		t.Error("Expected an added key to be possibly stored")
+	}
+	f.Reset()
+	if !f.MayExist("images/missing-0.png") {
+		t.Error("Expected every key to be possibly stored once reset")
+	}
+
+	var nilFilter *existence.Filter
+	if !nilFilter.MayExist("images/missing-0.png") {
+		t.Error("Expected a nil filter to know of no missing key")
+	}
+}
+
+// channelInvalidator delivers the invalidations published on one replica
+// to the other
+type channelInvalidator struct {
+	out, in chan cache.Invalidation
+}
+
+func (c *channelInvalidator) Publish(ctx context.Context, inv cache.Invalidation) error {
+	c.out <- inv
+	return nil
+}
+
+func (c *channelInvalidator) Subscribe(ctx context.Context, handle func(cache.Invalidation)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case inv := <-c.in:
+			handle(inv)
+		}
+	}
+}
+
+func TestFilter_Listen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := mocks.NewMockStorage()
+	a, b := newFilter(t, s, "*"), newFilter(t, s, "*")
+	ab, ba := make(chan cache.Invalidation, 4), make(chan cache.Invalidation, 4)
+	a.SetInvalidator(&channelInvalidator{out: ab, in: ba})
+	b.SetInvalidator(&channelInvalidator{out: ba, in: ab})
+	go b.Listen(ctx)
+
+	if err := a.Announce(ctx, "uploads/new.bin"); err != nil {
+		t.Fatalf("Announce failed: %v", err)
+	}
+	if !a.MayExist("uploads/new.bin") {
+		t.Error("Expected the announcing replica to add the key")
+	}
+	waitFor(t, func() bool { return b.MayExist("uploads/new.bin") }, "the other replica to add the key")
+
+	// A replica that may have missed announcements forgets what is missing
+	ab <- cache.Invalidation{All: true}
+	waitFor(t, func() bool { return b.MayExist("uploads/other.bin") }, "a resubscribed replica to reset")
+}
+
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,164 @@
+package existence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// DefaultStatEntries bounds the remembered objects when StatConfig doesn't
+const DefaultStatEntries = 100000
+
+// StatConfig controls how long object metadata is remembered
+type StatConfig struct {
+	// TTL is how long the metadata of an object, or its absence, is
+	// remembered
+	TTL time.Duration
+	// MaxEntries bounds the objects remembered
+	MaxEntries int
+}
+
+// StatCache remembers the results of StatObject and ObjectExists for a
+// short while, apart from cached payloads, so HEAD requests, conditional
+// GETs and variant lookups don't each reach the wrapped backend. Writes
+// and deletes through it forget the key; those made elsewhere are seen
+// once the TTL passes.
+type StatCache struct {
+	tenant.Backend
+	ttl        time.Duration
+	maxEntries int
+	metrics    *metrics.Metrics
+
+	mu      sync.Mutex
+	entries map[string]statEntry
+	// generation counts the keys forgotten, so a lookup racing a write
+	// doesn't remember what it read before the write
+	generation uint64
+}
+
+// statEntry is the remembered metadata of an object; headers is nil when
+// the object doesn't exist
+type statEntry struct {
+	headers http.Header
+	expires time.Time
+}
+
+// Ensure StatCache implements the storage interfaces
+var _ tenant.Backend = (*StatCache)(nil)
+
+// NewStatCache wraps backend, remembering object metadata as cfg says. m
+// may be nil.
+func NewStatCache(backend tenant.Backend, cfg StatConfig, m *metrics.Metrics) *StatCache {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultStatEntries
+	}
+	return &StatCache{
+		Backend:    backend,
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		metrics:    m,
+		entries:    make(map[string]statEntry),
+	}
+}
+
+// stat returns the metadata of key, or nil when it doesn't exist, reading
+// it from the backend when it isn't remembered
+func (s *StatCache) stat(ctx context.Context, key string) (http.Header, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		s.metrics.MetadataCacheLookupsTotal.WithLabelValues("hit").Inc()
+		return entry.headers, nil
+	}
+	s.metrics.MetadataCacheLookupsTotal.WithLabelValues("miss").Inc()
+
+	headers, err := s.Backend.StatObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		headers, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.remember(key, headers, generation)
+	return headers, nil
+}
+
+// remember records the metadata of key read at generation, unless a key
+// was forgotten since
+func (s *StatCache) remember(key string, headers http.Header, generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if generation != s.generation {
+		return
+	}
+	now := time.Now()
+	if len(s.entries) >= s.maxEntries {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		if len(s.entries) >= s.maxEntries {
+			return
+		}
+	}
+	s.entries[key] = statEntry{headers: headers, expires: now.Add(s.ttl)}
+}
+
+// forget drops what is remembered of key once it was written or deleted
+func (s *StatCache) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	s.generation++
+}
+
+func (s *StatCache) StatObject(ctx context.Context, key string) (http.Header, error) {
+	headers, err := s.stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if headers == nil {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+	}
+	return headers.Clone(), nil
+}
+
+func (s *StatCache) ObjectExists(ctx context.Context, key string) (bool, error) {
+	headers, err := s.stat(ctx, key)
+	return headers != nil, err
+}
+
+func (s *StatCache) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	defer s.forget(key)
+	return s.Backend.PutObject(ctx, key, data, contentType)
+}
+
+func (s *StatCache) DeleteObject(ctx context.Context, key string) error {
+	defer s.forget(key)
+	return s.Backend.DeleteObject(ctx, key)
+}
+
+// PresignPut forgets key, which the client is about to upload
+func (s *StatCache) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	defer s.forget(key)
+	return s.Backend.PresignPut(ctx, key, contentType, metadata, ttl)
+}
+
+func (s *StatCache) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.UploadedPart) error {
+	defer s.forget(key)
+	return s.Backend.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
@@ -0,0 +1,68 @@
+package existence_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ch374n/file-downloader/internal/existence"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func TestStatCache(t *testing.T) {
+	ctx := context.Background()
+	backend := mocks.NewMockStorage()
+	backend.SetObject("a.txt", []byte("stored"))
+	backend.SetObjectHeaders("a.txt", http.Header{"Etag": {`"v1"`}})
+	m := metrics.New(prometheus.NewRegistry())
+	s := existence.NewStatCache(backend, existence.StatConfig{TTL: time.Minute}, m)
+
+	for range 3 {
+		headers, err := s.StatObject(ctx, "a.txt")
+		if err != nil || headers.Get("ETag") != `"v1"` {
+			t.Fatalf("Expected the stored headers, got %v (%v)", headers, err)
+		}
+		if exists, err := s.ObjectExists(ctx, "a.txt"); !exists || err != nil {
+			t.Fatalf("Expected a.txt to exist, got %v (%v)", exists, err)
+		}
+		if _, err := s.StatObject(ctx, "missing.txt"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+	}
+	if hits, misses := testutil.ToFloat64(m.MetadataCacheLookupsTotal.WithLabelValues("hit")), testutil.ToFloat64(m.MetadataCacheLookupsTotal.WithLabelValues("miss")); hits != 7 || misses != 2 {
+		t.Errorf("Expected each object to be looked up once, got %v hits and %v misses", hits, misses)
+	}
+
+	// Writes through the cache are seen straight away
+	if err := s.PutObject(ctx, "missing.txt", strings.NewReader("new"), "text/plain"); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if exists, _ := s.ObjectExists(ctx, "missing.txt"); !exists {
+		t.Error("Expected a written object to exist")
+	}
+	if err := s.DeleteObject(ctx, "a.txt"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if _, err := s.StatObject(ctx, "a.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected a deleted object to be missing, got %v", err)
+	}
+
+	// Changes made elsewhere are seen once the TTL passes
+	short := existence.NewStatCache(backend, existence.StatConfig{TTL: 10 * time.Millisecond}, nil)
+	if exists, _ := short.ObjectExists(ctx, "b.txt"); exists {
+		t.Fatal("Expected b.txt not to exist yet")
+	}
+	backend.SetObject("b.txt", []byte("direct"))
+	time.Sleep(20 * time.Millisecond)
+	if exists, _ := short.ObjectExists(ctx, "b.txt"); !exists {
+		t.Error("Expected b.txt to be found once the TTL passed")
+	}
+}
@@ -0,0 +1,104 @@
+package existence
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// Storage answers reads of keys its Filter knows are missing as not found
+// without reaching the wrapped backend, and adds the keys written through
+// it to the filter
+type Storage struct {
+	tenant.Backend
+	filter  *Filter
+	metrics *metrics.Metrics
+}
+
+// Ensure Storage implements the storage interfaces
+var _ tenant.Backend = (*Storage)(nil)
+
+// NewStorage wraps backend with filter. m may be nil.
+func NewStorage(backend tenant.Backend, filter *Filter, m *metrics.Metrics) *Storage {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return &Storage{Backend: backend, filter: filter, metrics: m}
+}
+
+// missing reports whether key is known not to exist, counting the read of
+// operation it skips
+func (s *Storage) missing(key, operation string) error {
+	if s.filter.MayExist(key) {
+		return nil
+	}
+	s.metrics.ExistenceFilterSkipsTotal.WithLabelValues(operation).Inc()
+	return fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+}
+
+// announce adds key to the filter before it is written
+func (s *Storage) announce(ctx context.Context, key string) {
+	if err := s.filter.Announce(ctx, key); err != nil {
+		slog.WarnContext(ctx, "Failed to announce stored key", "key", key, "error", err)
+	}
+}
+
+func (s *Storage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if err := s.missing(key, "get"); err != nil {
+		return nil, err
+	}
+	return s.Backend.GetObject(ctx, key)
+}
+
+func (s *Storage) GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error) {
+	if err := s.missing(key, "get"); err != nil {
+		return nil, nil, err
+	}
+	return s.Backend.GetObjectWithHeaders(ctx, key)
+}
+
+func (s *Storage) GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error) {
+	if err := s.missing(key, "get"); err != nil {
+		return nil, nil, err
+	}
+	return s.Backend.GetObjectRange(ctx, key, offset, length)
+}
+
+func (s *Storage) StatObject(ctx context.Context, key string) (http.Header, error) {
+	if err := s.missing(key, "stat"); err != nil {
+		return nil, err
+	}
+	return s.Backend.StatObject(ctx, key)
+}
+
+func (s *Storage) ObjectExists(ctx context.Context, key string) (bool, error) {
+	if s.missing(key, "exists") != nil {
+		return false, nil
+	}
+	return s.Backend.ObjectExists(ctx, key)
+}
+
+func (s *Storage) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	s.announce(ctx, key)
+	return s.Backend.PutObject(ctx, key, data, contentType)
+}
+
+// PresignPut adds key to the filter for the upload the client is about to
+// make. An upload made after the next refresh is only seen by the one
+// after it, like the writes that bypass the service.
+func (s *Storage) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	s.announce(ctx, key)
+	return s.Backend.PresignPut(ctx, key, contentType, metadata, ttl)
+}
+
+func (s *Storage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.UploadedPart) error {
+	s.announce(ctx, key)
+	return s.Backend.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
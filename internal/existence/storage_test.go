@@ -0,0 +1,50 @@
+package existence_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/existence"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func TestStorage_SkipsMissingKeys(t *testing.T) {
+	ctx := context.Background()
+	backend := mocks.NewMockStorage()
+	backend.SetObject("files/stored.txt", []byte("stored"))
+	s := existence.NewStorage(backend, newFilter(t, backend, "files/"), nil)
+
+	if data, err := s.GetObject(ctx, "files/stored.txt"); err != nil || string(data) != "stored" {
+		t.Fatalf("Expected the stored file, got %q (%v)", data, err)
+	}
+	if _, err := s.GetObject(ctx, "files/missing.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing key, got %v", err)
+	}
+	if _, err := s.StatObject(ctx, "files/missing.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from StatObject, got %v", err)
+	}
+	if exists, err := s.ObjectExists(ctx, "files/missing.txt"); exists || err != nil {
+		t.Errorf("Expected a missing key not to exist, got %v (%v)", exists, err)
+	}
+	if len(backend.GetCalls) != 1 {
+		t.Errorf("Expected only the stored file to be read, got %v", backend.GetCalls)
+	}
+
+	// Keys written through the storage are found straight away
+	if err := s.PutObject(ctx, "files/missing.txt", strings.NewReader("new"), "text/plain"); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if data, err := s.GetObject(ctx, "files/missing.txt"); err != nil || string(data) != "new" {
+		t.Errorf("Expected the written file, got %q (%v)", data, err)
+	}
+	if _, err := s.PresignPut(ctx, "files/direct.txt", "text/plain", nil, 0); err != nil {
+		t.Fatalf("PresignPut failed: %v", err)
+	}
+	backend.SetObject("files/direct.txt", []byte("direct"))
+	if data, err := s.GetObject(ctx, "files/direct.txt"); err != nil || string(data) != "direct" {
+		t.Errorf("Expected the directly uploaded file, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package features lets trusted callers turn individual behaviors on or off
+// for a single request, so changes can be canaried before flipping the
+// global setting
+package features
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Feature names a behavior that can be overridden per request
+type Feature string
+
+// Overridable features
+const (
+	CacheRead           Feature = "cache-read"            // Serve hits from the cache
+	CacheFill           Feature = "cache-fill"            // Store fetched files in the cache
+	CachePolicy         Feature = "cache-policy"          // Apply POLICY_CACHE admission rules
+	CaseInsensitiveKeys Feature = "case-insensitive-keys" // Resolve names regardless of case
+	HeaderPassthrough   Feature = "header-passthrough"    // Copy object headers onto responses
+)
+
+// Known lists every feature that can be overridden
+var Known = []Feature{
+	CacheRead,
+	CacheFill,
+	CachePolicy,
+	CaseInsensitiveKeys,
+	HeaderPassthrough,
+}
+
+// Overrides maps features to their forced state
+type Overrides map[Feature]bool
+
+// Parse reads a comma-separated list of feature=on|off entries, e.g.
+// "cache-read=off, cache-policy=on"
+func Parse(spec string) (Overrides, error) {
+	overrides := make(Overrides)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, state, ok := strings.Cut(entry, "=")
+		feature := Feature(strings.ToLower(strings.TrimSpace(name)))
+		if !ok {
+			return nil, fmt.Errorf("invalid feature override %q: expected feature=on|off", entry)
+		}
+		if !slices.Contains(Known, feature) {
+			return nil, fmt.Errorf("unknown feature %q", feature)
+		}
+		switch strings.ToLower(strings.TrimSpace(state)) {
+		case "on", "true", "1":
+			overrides[feature] = true
+		case "off", "false", "0":
+			overrides[feature] = false
+		default:
+			return nil, fmt.Errorf("invalid state %q for feature %s: expected on or off", state, feature)
+		}
+	}
+	return overrides, nil
+}
+
+// String formats overrides in the form Parse accepts, sorted by feature
+func (o Overrides) String() string {
+	entries := make([]string, 0, len(o))
+	for feature, on := range o {
+		state := "off"
+		if on {
+			state = "on"
+		}
+		entries = append(entries, string(feature)+"="+state)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+type contextKey struct{}
+
+// WithOverrides returns a context whose requests use o
+func WithOverrides(ctx context.Context, o Overrides) context.Context {
+	return context.WithValue(ctx, contextKey{}, o)
+}
+
+// Enabled reports whether f is on for the request in ctx, falling back to
+// def when the request doesn't override it
+func Enabled(ctx context.Context, f Feature, def bool) bool {
+	o, _ := ctx.Value(contextKey{}).(Overrides)
+	if on, ok := o[f]; ok {
+		return on
+	}
+	return def
+}
@@ -0,0 +1,39 @@
+package features_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/features"
+)
+
+func TestParse(t *testing.T) {
+	overrides, err := features.Parse(" cache-read=off, Cache-Policy=ON ,")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := overrides.String(); got != "cache-policy=on,cache-read=off" {
+		t.Errorf("Unexpected overrides %q", got)
+	}
+
+	for _, spec := range []string{"cache-read", "cache-read=maybe", "stale-serving=on"} {
+		if _, err := features.Parse(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	ctx := context.Background()
+	if !features.Enabled(ctx, features.CacheRead, true) {
+		t.Error("Expected the default without overrides")
+	}
+
+	ctx = features.WithOverrides(ctx, features.Overrides{features.CacheRead: false})
+	if features.Enabled(ctx, features.CacheRead, true) {
+		t.Error("Expected the override to disable cache-read")
+	}
+	if !features.Enabled(ctx, features.CacheFill, true) {
+		t.Error("Expected features without overrides to keep their default")
+	}
+}
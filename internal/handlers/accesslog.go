@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/logger"
+)
+
+// AccessLogFormat selects how access log lines are written
+type AccessLogFormat string
+
+const (
+	AccessLogJSON     AccessLogFormat = "json"     // One JSON object per request
+	AccessLogCombined AccessLogFormat = "combined" // Apache combined log format
+)
+
+// combinedTimeFormat is the timestamp layout of the combined log format
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// TrustedProxies lists the networks whose X-Forwarded-For entries are
+// believed when working out a request's client address
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses IP addresses and CIDR ranges
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent r. Connections
+// from trusted proxies are attributed to the last X-Forwarded-For entry
+// that isn't itself a trusted proxy, so clients can't spoof their address
+// by sending the header themselves.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !p.trusted(addr) {
+		return host
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop
+		if !p.trusted(hop) {
+			break
+		}
+	}
+	return addr.Unmap().String()
+}
+
+// AccessLog writes a line for every request served
+type AccessLog struct {
+	format  AccessLogFormat
+	proxies TrustedProxies
+	now     func() time.Time
+
+	// json writes JSON lines; combined lines are written to out directly
+	json *slog.Logger
+	mu   sync.Mutex
+	out  io.Writer
+}
+
+// NewAccessLog creates an AccessLog writing to out in format, resolving
+// client addresses through proxies
+func NewAccessLog(out io.Writer, format AccessLogFormat, proxies TrustedProxies) *AccessLog {
+	return &AccessLog{
+		format:  format,
+		proxies: proxies,
+		now:     time.Now,
+		json:    slog.New(slog.NewJSONHandler(out, nil)),
+		out:     out,
+	}
+}
+
+// Middleware logs each request served by next once it completes. Wrap it
+// inside RequestIDMiddleware so lines carry the request ID.
+func (l *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := l.now()
+		wrapped := &accessLogWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+		l.write(r, wrapped, start)
+	})
+}
+
+func (l *AccessLog) write(r *http.Request, w *accessLogWriter, start time.Time) {
+	duration := l.now().Sub(start)
+	clientIP := l.proxies.ClientIP(r)
+
+	if l.format == AccessLogCombined {
+		bytes := "-"
+		if w.bytes > 0 {
+			bytes = strconv.FormatInt(w.bytes, 10)
+		}
+		user := "-"
+		if name, _, ok := r.BasicAuth(); ok && name != "" {
+			user = name
+		}
+		line := fmt.Sprintf("%s - %s [%s] %q %d %s %q %q\n",
+			clientIP, user, start.Format(combinedTimeFormat),
+			r.Method+" "+r.RequestURI+" "+r.Proto,
+			w.statusCode, bytes, orDash(r.Referer()), orDash(r.UserAgent()),
+		)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		_, _ = io.WriteString(l.out, line)
+		return
+	}
+
+	l.json.LogAttrs(r.Context(), slog.LevelInfo, "Request completed",
+		slog.String("request_id", logger.RequestID(r.Context())),
+		slog.String("client_ip", clientIP),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("query", r.URL.RawQuery),
+		slog.String("proto", r.Proto),
+		slog.Int("status", w.statusCode),
+		slog.Int64("bytes", w.bytes),
+		slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+		slog.String("cache", w.Header().Get(HeaderCache)),
+		slog.String("referer", r.Referer()),
+		slog.String("user_agent", r.UserAgent()),
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// accessLogWriter records the status and body size of a response
+type accessLogWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	bytes       int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = code >= 200 || code == http.StatusSwitchingProtocols
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
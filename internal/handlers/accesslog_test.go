@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := handlers.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer is believed over the header", remote: "203.0.113.7:5000", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.1.2.3:5000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "spoofed entries before the proxy chain", remote: "10.1.2.3:5000", forwarded: []string{"1.1.1.1, 198.51.100.1, 192.0.2.1"}, want: "198.51.100.1"},
+		{name: "repeated headers", remote: "10.1.2.3:5000", forwarded: []string{"1.1.1.1", "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "only proxies", remote: "10.1.2.3:5000", forwarded: []string{"10.9.9.9"}, want: "10.9.9.9"},
+		{name: "malformed entry", remote: "10.1.2.3:5000", forwarded: []string{"198.51.100.1, junk"}, want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := proxies.ClientIP(req); got != tt.want {
+				t.Errorf("Expected client %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := handlers.ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected an invalid range to be rejected")
+	}
+}
+
+func serveLogged(t *testing.T, format handlers.AccessLogFormat) string {
+	t.Helper()
+	var out bytes.Buffer
+	log := handlers.NewAccessLog(&out, format, nil)
+	handler := handlers.RequestIDMiddleware(log.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(handlers.HeaderCache, "HIT")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt?x=1", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set(handlers.HeaderRequestID, "req-1")
+	req.Header.Set("User-Agent", "curl/8.0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return out.String()
+}
+
+func TestAccessLog_JSON(t *testing.T) {
+	var line map[string]any
+	if err := json.Unmarshal([]byte(serveLogged(t, handlers.AccessLogJSON)), &line); err != nil {
+		t.Fatalf("Expected a JSON line: %v", err)
+	}
+	want := map[string]any{
+		"request_id": "req-1",
+		"client_ip":  "203.0.113.7",
+		"method":     "GET",
+		"path":       "/files/a.txt",
+		"query":      "x=1",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(5),
+		"cache":      "HIT",
+		"user_agent": "curl/8.0",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, line[key])
+		}
+	}
+}
+
+func TestAccessLog_Combined(t *testing.T) {
+	line := serveLogged(t, handlers.AccessLogCombined)
+	pattern := regexp.MustCompile(`^203\.0\.113\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /files/a\.txt\?x=1 HTTP/1\.1" 201 5 "-" "curl/8\.0"\n$`)
+	if !pattern.MatchString(line) {
+		t.Errorf("Expected a combined log line, got %q", line)
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/efficiency"
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/hotkeys"
+	"github.com/ch374n/file-downloader/internal/listen"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/scheduler"
+	"github.com/ch374n/file-downloader/internal/signing"
+	"github.com/ch374n/file-downloader/internal/warmer"
+)
+
+// maxAdminBodySize caps the size of admin request bodies
+const maxAdminBodySize = 1 << 20
+
+// AdminHandler handles operator-facing administrative requests
+type AdminHandler struct {
+	cache      cache.Cache
+	keyring    *signing.Keyring
+	keyOverlap time.Duration
+	scheduler  *scheduler.Scheduler
+	warmJobs   *warmer.Jobs
+	metrics    *metrics.Metrics
+	efficiency *efficiency.Tracker
+	events     *events.Bus
+	hotkeys    *hotkeys.Tracker
+	timeouts   Timeouts
+
+	diagnostics *DiagnosticsConfig
+}
+
+// AdminOption configures optional AdminHandler behavior
+type AdminOption func(*AdminHandler)
+
+// WithKeyring enables signing key management. overlap is how long a retired
+// key keeps verifying when no explicit overlap is requested.
+func WithKeyring(k *signing.Keyring, overlap time.Duration) AdminOption {
+	return func(h *AdminHandler) {
+		h.keyring = k
+		h.keyOverlap = overlap
+	}
+}
+
+// WithScheduler enables listing and triggering background jobs
+func WithScheduler(s *scheduler.Scheduler) AdminOption {
+	return func(h *AdminHandler) {
+		h.scheduler = s
+	}
+}
+
+// WithWarmJobs enables on-demand cache warming
+func WithWarmJobs(j *warmer.Jobs) AdminOption {
+	return func(h *AdminHandler) {
+		h.warmJobs = j
+	}
+}
+
+// WithAdminMetrics sets the collectors AdminHandler records into
+func WithAdminMetrics(m *metrics.Metrics) AdminOption {
+	return func(h *AdminHandler) {
+		h.metrics = m
+	}
+}
+
+// WithAdminTimeouts bounds admin requests like file requests: cache calls
+// by the request timeout and diagnostics probes by the health timeout
+func WithAdminTimeouts(t Timeouts) AdminOption {
+	return func(h *AdminHandler) {
+		h.timeouts = t.withDefaults()
+	}
+}
+
+// NewAdminHandler creates a new AdminHandler with the given dependencies
+func NewAdminHandler(c cache.Cache, opts ...AdminOption) *AdminHandler {
+	h := &AdminHandler{
+		cache:    c,
+		metrics:  metrics.Noop(),
+		timeouts: DefaultTimeouts(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// PurgeRequest selects cache entries to evict. Any combination of fields may be set.
+type PurgeRequest struct {
+	Key    string   `json:"key,omitempty"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+// PurgeCache handles cache purge requests
+func (h *AdminHandler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	if h.cache == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "cache is disabled",
+			ErrorCode: ErrCodeCacheUnavailable,
+		})
+		return
+	}
+
+	var req PurgeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	keys := req.Keys
+	if req.Key != "" {
+		keys = append(keys, req.Key)
+	}
+	if len(keys) == 0 && req.Prefix == "" {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "one of key, keys or prefix is required",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeouts.Request)
+	defer cancel()
+
+	h.efficiency.Forget(keys...)
+	if req.Prefix != "" {
+		h.efficiency.ForgetPrefix(req.Prefix)
+	}
+
+	var purged int64
+	if len(keys) > 0 {
+		n, err := cache.PurgeKeys(ctx, h.cache, keys...)
+		purged += n
+		if err != nil {
+			h.metrics.CacheErrorsTotal.WithLabelValues("delete").Inc()
+			slog.ErrorContext(ctx, "Cache purge failed", "keys", keys, "error", err)
+			h.writePurgeError(w, purged)
+			return
+		}
+	}
+	if req.Prefix != "" {
+		n, err := h.cache.DeletePrefix(ctx, req.Prefix)
+		purged += n
+		if err != nil {
+			h.metrics.CacheErrorsTotal.WithLabelValues("delete").Inc()
+			slog.ErrorContext(ctx, "Cache prefix purge failed", "prefix", req.Prefix, "error", err)
+			h.writePurgeError(w, purged)
+			return
+		}
+	}
+
+	h.metrics.CachePurgedKeysTotal.Add(float64(purged))
+	slog.InfoContext(ctx, "Cache purged", "keys", keys, "prefix", req.Prefix, "purged", purged)
+	h.events.Publish(ctx, events.Event{Type: events.CachePurged, Keys: keys, Prefix: req.Prefix})
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Cache purged",
+		Data: PurgeResult{
+			Purged: purged,
+		},
+	})
+}
+
+func (h *AdminHandler) writePurgeError(w http.ResponseWriter, purged int64) {
+	h.metrics.CachePurgedKeysTotal.Add(float64(purged))
+	writeJSON(w, http.StatusInternalServerError, Response{
+		Success:   false,
+		Message:   "Failed to purge cache",
+		ErrorCode: ErrCodeCacheUnavailable,
+		Data: PurgeResult{
+			Purged: purged,
+		},
+	})
+}
+
+// AdminAuth rejects requests that don't carry the admin token, either as a
+// bearer token or in the X-Admin-Token header. An empty token disables the
+// wrapped endpoints entirely.
+func AdminAuth(token string, next http.HandlerFunc) http.HandlerFunc {
+	authn := auth.NewAuthenticator(auth.Credential{Name: "admin", Token: token, Scopes: []auth.Scope{auth.ScopeAll}})
+	return RequireScope(authn, auth.ScopeAll, next)
+}
+
+// RequireScope rejects requests unless they carry an admin credential, as a
+// bearer token, in the X-Admin-Token header, as basic auth with the
+// credential's name or as a verified client certificate, that grants scope. Without any configured credentials
+// the wrapped endpoints are disabled entirely.
+//
+// Browsers resend basic auth on their own, so basic-authenticated requests
+// that change state must also set X-Requested-With, which cross-site forms
+// can't.
+func RequireScope(authn *auth.Authenticator, scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authn.Enabled() {
+			writeJSON(w, http.StatusForbidden, Response{
+				Success:   false,
+				Message:   "admin API is disabled",
+				ErrorCode: ErrCodeFeatureDisabled,
+			})
+			return
+		}
+
+		token := adminToken(r)
+		user, password, basic := r.BasicAuth()
+		basic = basic && token == ""
+		if basic {
+			token = password
+		}
+		cred, ok := authn.Authenticate(token)
+		if ok && basic && cred.Name != user {
+			ok = false
+		}
+		if token == "" {
+			cred, ok = certificateCredential(authn, r)
+		}
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, Response{
+				Success:   false,
+				Message:   "unauthorized",
+				ErrorCode: ErrCodeUnauthorized,
+			})
+			return
+		}
+		if !cred.Allows(scope) {
+			slog.WarnContext(r.Context(), "Admin credential lacks scope",
+				"credential", cred.Name,
+				"scope", scope,
+				"path", r.URL.Path,
+			)
+			writeJSON(w, http.StatusForbidden, Response{
+				Success:   false,
+				Message:   "credential lacks scope " + string(scope),
+				ErrorCode: ErrCodeAccessDenied,
+			})
+			return
+		}
+
+		if basic && !safeMethod(r.Method) && r.Header.Get("X-Requested-With") == "" {
+			writeJSON(w, http.StatusForbidden, Response{
+				Success:   false,
+				Message:   "X-Requested-With is required with basic auth",
+				ErrorCode: ErrCodeAccessDenied,
+			})
+			return
+		}
+
+		next(w, r.WithContext(auth.WithCredential(r.Context(), cred)))
+	}
+}
+
+// safeMethod reports whether method only reads state
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// BrowserAuth asks browsers to prompt for basic auth when next rejects a
+// request as unauthorized
+func BrowserAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&challengeWriter{ResponseWriter: w}, r)
+	}
+}
+
+// challengeWriter adds a basic auth challenge to 401 responses
+type challengeWriter struct {
+	http.ResponseWriter
+}
+
+func (w *challengeWriter) WriteHeader(status int) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *challengeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// adminToken returns the admin token carried as a bearer token or in the
+// X-Admin-Token header
+func adminToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.Header.Get("X-Admin-Token")
+}
+
+// requestCredential returns the credential of the request's admin token,
+// or else of its client certificate
+func requestCredential(authn *auth.Authenticator, r *http.Request) (*auth.Credential, bool) {
+	if token := adminToken(r); token != "" {
+		return authn.Authenticate(token)
+	}
+	return certificateCredential(authn, r)
+}
+
+// certificateCredential returns the credential granted to the verified
+// client certificate of r, if any
+func certificateCredential(authn *auth.Authenticator, r *http.Request) (*auth.Credential, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, false
+	}
+	return authn.AuthenticateCertificate(listen.CertificateNames(r.TLS.VerifiedChains[0][0]))
+}
+
+// AdminAuthOrSigned is like AdminAuth but also admits requests already
+// authorized by a signed URL (see FileHandler.VerifySignedURL)
+func AdminAuthOrSigned(token string, next http.HandlerFunc) http.HandlerFunc {
+	return signedOr(AdminAuth(token, next), next)
+}
+
+// RequireScopeOrSigned is like RequireScope but also admits requests
+// already authorized by a signed URL (see FileHandler.VerifySignedURL)
+func RequireScopeOrSigned(authn *auth.Authenticator, scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return signedOr(RequireScope(authn, scope, next), next)
+}
+
+func signedOr(authed, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hasSignedAccess(r.Context()) {
+			next(w, r)
+			return
+		}
+		authed(w, r)
+	}
+}
@@ -0,0 +1,490 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/scheduler"
+	"github.com/ch374n/file-downloader/internal/signing"
+	"github.com/ch374n/file-downloader/internal/warmer"
+)
+
+type purgeResponse struct {
+	Success bool             `json:"success"`
+	Message string           `json:"message"`
+	Data    map[string]int64 `json:"data"`
+}
+
+func doPurge(t *testing.T, handler *handlers.AdminHandler, body string) (*httptest.ResponseRecorder, purgeResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/purge", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	handler.PurgeCache(rec, req)
+
+	var resp purgeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return rec, resp
+}
+
+func TestPurgeCache_SingleKey(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockCache.SetData("a.txt", []byte("a"))
+	mockCache.SetData("b.txt", []byte("b"))
+	handler := handlers.NewAdminHandler(mockCache)
+
+	rec, resp := doPurge(t, handler, `{"key": "a.txt"}`)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if resp.Data["purged"] != 1 {
+		t.Errorf("Expected 1 purged, got %d", resp.Data["purged"])
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "b.txt"); !found {
+		t.Error("Expected b.txt to remain cached")
+	}
+}
+
+func TestPurgeCache_KeysAndPrefix(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockCache.SetData("a.txt", []byte("a"))
+	mockCache.SetData("reports/1.pdf", []byte("1"))
+	mockCache.SetData("reports/2.pdf", []byte("2"))
+	mockCache.SetData("keep.txt", []byte("keep"))
+	handler := handlers.NewAdminHandler(mockCache)
+
+	rec, resp := doPurge(t, handler, `{"keys": ["a.txt", "missing.txt"], "prefix": "reports/"}`)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if resp.Data["purged"] != 3 {
+		t.Errorf("Expected 3 purged, got %d", resp.Data["purged"])
+	}
+	if len(mockCache.DeletePrefixCalls) != 1 || mockCache.DeletePrefixCalls[0] != "reports/" {
+		t.Errorf("Expected prefix purge of 'reports/', got %v", mockCache.DeletePrefixCalls)
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "keep.txt"); !found {
+		t.Error("Expected keep.txt to remain cached")
+	}
+}
+
+func TestPurgeCache_CascadesToVariants(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	thumb := cache.VariantKey("photo.jpg", "w=400")
+	mockCache.SetData("photo.jpg", []byte("original"))
+	mockCache.SetData(thumb, []byte("thumbnail"))
+	mockCache.AddVariant(context.Background(), "photo.jpg", thumb)
+	handler := handlers.NewAdminHandler(mockCache)
+
+	_, resp := doPurge(t, handler, `{"key": "photo.jpg"}`)
+
+	if resp.Data["purged"] != 2 {
+		t.Errorf("Expected 2 purged, got %d", resp.Data["purged"])
+	}
+	if _, found, _ := mockCache.Get(context.Background(), thumb); found {
+		t.Error("Expected variant to be purged with its base key")
+	}
+}
+
+func TestPurgeCache_EmptyRequest(t *testing.T) {
+	handler := handlers.NewAdminHandler(mocks.NewMockCache())
+
+	rec, resp := doPurge(t, handler, `{}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if resp.Success {
+		t.Error("Expected success to be false")
+	}
+}
+
+func TestPurgeCache_CacheError(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockCache.DeleteError = mocks.ErrCacheUnavailable
+	handler := handlers.NewAdminHandler(mockCache)
+
+	rec, _ := doPurge(t, handler, `{"key": "a.txt"}`)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestPurgeCache_CacheDisabled(t *testing.T) {
+	handler := handlers.NewAdminHandler(nil)
+
+	rec, _ := doPurge(t, handler, `{"key": "a.txt"}`)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"bearer token", "secret", "Authorization", "Bearer secret", http.StatusOK},
+		{"admin token header", "secret", "X-Admin-Token", "secret", http.StatusOK},
+		{"wrong token", "secret", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"missing token", "secret", "", "", http.StatusUnauthorized},
+		{"admin disabled", "", "Authorization", "Bearer ", http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/cache/purge", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+
+			handlers.AdminAuth(tc.token, ok)(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if cred, _ := auth.CredentialFrom(r.Context()); cred == nil || cred.Name != "warmer" {
+			t.Errorf("Expected credential in context, got %v", cred)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	authn := auth.NewAuthenticator(auth.Credential{Name: "warmer", Token: "w", Scopes: []auth.Scope{auth.ScopeCacheWarm}})
+
+	tests := []struct {
+		name       string
+		scope      auth.Scope
+		token      string
+		wantStatus int
+	}{
+		{"granted scope", auth.ScopeCacheWarm, "w", http.StatusOK},
+		{"missing scope", auth.ScopeTenantsManage, "w", http.StatusForbidden},
+		{"unknown token", auth.ScopeCacheWarm, "x", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/cache/warm", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := httptest.NewRecorder()
+
+			handlers.RequireScope(authn, tc.scope, ok)(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRequireScope_BasicAuth(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	authn := auth.NewAuthenticator(auth.Credential{Name: "warmer", Token: "w", Scopes: []auth.Scope{auth.ScopeCacheWarm}})
+
+	tests := []struct {
+		name          string
+		method        string
+		user          string
+		password      string
+		requestedWith string
+		wantStatus    int
+	}{
+		{"read", http.MethodGet, "warmer", "w", "", http.StatusOK},
+		{"write from script", http.MethodPost, "warmer", "w", "admin-ui", http.StatusOK},
+		{"write without X-Requested-With", http.MethodPost, "warmer", "w", "", http.StatusForbidden},
+		{"wrong user", http.MethodGet, "admin", "w", "", http.StatusUnauthorized},
+		{"wrong password", http.MethodGet, "warmer", "x", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/admin/cache/warm", nil)
+			req.SetBasicAuth(tc.user, tc.password)
+			if tc.requestedWith != "" {
+				req.Header.Set("X-Requested-With", tc.requestedWith)
+			}
+			rec := httptest.NewRecorder()
+
+			handlers.BrowserAuth(handlers.RequireScope(authn, auth.ScopeCacheWarm, ok))(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); (challenge != "") != (rec.Code == http.StatusUnauthorized) {
+				t.Errorf("Expected a basic auth challenge only with 401, got %q", challenge)
+			}
+		})
+	}
+}
+
+func TestRequireScope_ClientCertificate(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	authn := auth.NewAuthenticator(auth.Credential{Name: "warmer", Token: "w", Scopes: []auth.Scope{auth.ScopeCacheWarm}})
+	authn.SetCertificateCredentials(auth.Credential{Name: "spiffe://prod/deployer", Scopes: []auth.Scope{auth.ScopeCachePurge}})
+	deployer := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "deployer"},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "prod", Path: "/deployer"}},
+	}
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		token      string
+		wantStatus int
+	}{
+		{"certificate SAN", deployer, "", http.StatusOK},
+		{"unknown certificate", &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, "", http.StatusUnauthorized},
+		{"no certificate", nil, "", http.StatusUnauthorized},
+		{"token takes precedence", deployer, "w", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/cache/purge", nil)
+			if tc.cert != nil {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tc.cert}}}
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+
+			handlers.RequireScope(authn, auth.ScopeCachePurge, ok)(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAdminUI(t *testing.T) {
+	serve := func(asset string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/ui/"+asset, nil)
+		req.SetPathValue("asset", asset)
+		rec := httptest.NewRecorder()
+		handlers.AdminUI(rec, req)
+		return rec
+	}
+
+	rec := serve("")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected the dashboard page, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Header().Get("Content-Security-Policy"), "default-src 'self'") {
+		t.Errorf("Expected a content security policy, got %q", rec.Header().Get("Content-Security-Policy"))
+	}
+	if !strings.Contains(rec.Body.String(), `src="/admin/ui/app.js"`) {
+		t.Errorf("Expected the page to load its script, got %s", rec.Body.String())
+	}
+
+	for asset, contentType := range map[string]string{"app.js": "text/javascript", "style.css": "text/css"} {
+		if rec := serve(asset); rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), contentType) {
+			t.Errorf("Expected %s to be served as %s, got %d %s", asset, contentType, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+	if rec := serve("missing.js"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown asset, got %d", rec.Code)
+	}
+}
+
+func TestSigningKeys_AddAndRetire(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("s1")})
+	handler := handlers.NewAdminHandler(nil, handlers.WithKeyring(keyring, time.Hour))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(`{"id": "k2"}`))
+	rec := httptest.NewRecorder()
+	handler.AddKey(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	resp := parseResponse(t, rec.Body.Bytes())
+	if resp.Data["secret"] == "" {
+		t.Error("Expected generated secret in response")
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/admin/keys/k1?overlap=30m", nil)
+	req.SetPathValue("id", "k1")
+	rec = httptest.NewRecorder()
+	handler.RetireKey(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if id, _, _ := keyring.Sign([]byte("x")); id != "k2" {
+		t.Errorf("Expected 'k2' to be the signing key, got '%s'", id)
+	}
+
+	// Retiring the last active key is refused
+	req = httptest.NewRequest(http.MethodDelete, "/admin/keys/k2", nil)
+	req.SetPathValue("id", "k2")
+	rec = httptest.NewRecorder()
+	handler.RetireKey(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, rec.Code)
+	}
+}
+
+func TestJobs_ListAndRun(t *testing.T) {
+	hourly, _ := scheduler.ParseSchedule("@hourly")
+	ran := make(chan struct{}, 1)
+	jobs := scheduler.New()
+	_ = jobs.Add(scheduler.Job{
+		Name:     "warmer:reports",
+		Schedule: hourly,
+		Run: func(context.Context) error {
+			ran <- struct{}{}
+			return nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jobs.Start(ctx)
+
+	handler := handlers.NewAdminHandler(nil, handlers.WithScheduler(jobs))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/jobs", handler.ListJobs)
+	mux.HandleFunc("POST /admin/jobs/{name}/run", handler.RunJob)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/jobs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"warmer:reports"`) {
+		t.Errorf("Expected job listing, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/jobs/warmer:reports/run", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Error("Expected job to run")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/jobs/missing/run", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestJobs_SchedulerDisabled(t *testing.T) {
+	handler := handlers.NewAdminHandler(nil)
+
+	rec := httptest.NewRecorder()
+	handler.ListJobs(rec, httptest.NewRequest(http.MethodGet, "/admin/jobs", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestWarmCache_StartAndPoll(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("assets/app.js", []byte("js"))
+	handler := handlers.NewAdminHandler(mockCache,
+		handlers.WithWarmJobs(warmer.NewJobs(mockStorage, mockCache, warmer.DefaultJobsConfig())),
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/cache/warm", handler.WarmCache)
+	mux.HandleFunc("GET /admin/cache/warm/{id}", handler.WarmStatus)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(`{"prefix": "assets/"}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+	if location == "" {
+		t.Fatal("Expected Location header")
+	}
+
+	var resp struct {
+		Data warmer.JobStatus `json:"data"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for resp.Data.State != warmer.JobCompleted && time.Now().Before(deadline) {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, location, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if resp.Data.State != warmer.JobCompleted || resp.Data.Warmed != 1 {
+		t.Errorf("Unexpected job status: %+v", resp.Data)
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "assets/app.js"); !found {
+		t.Error("Expected assets/app.js to be cached")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache/warm/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown job, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestWarmCache_InvalidRequests(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	handler := handlers.NewAdminHandler(mockCache,
+		handlers.WithWarmJobs(warmer.NewJobs(mocks.NewMockStorage(), mockCache, warmer.DefaultJobsConfig())),
+	)
+
+	for _, body := range []string{`{}`, `not json`, `{"keys": ["a"], "concurrency": -1}`} {
+		rec := httptest.NewRecorder()
+		handler.WarmCache(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Body %s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handlers.NewAdminHandler(nil).WarmCache(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(`{"keys": ["a"]}`)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without cache, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// adminUIFiles is the admin dashboard, a static page that calls the admin
+// API from the browser
+//
+//go:embed adminui
+var adminUIFiles embed.FS
+
+// adminUI is adminUIFiles without the directory prefix
+var adminUI, _ = fs.Sub(adminUIFiles, "adminui")
+
+// adminUIPolicy keeps the dashboard to its own scripts and styles, and out
+// of other sites' frames
+const adminUIPolicy = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// AdminUI serves the admin dashboard at /admin/ui and its assets at
+// /admin/ui/{asset}
+func AdminUI(w http.ResponseWriter, r *http.Request) {
+	asset := r.PathValue("asset")
+	if asset == "" {
+		asset = "index.html"
+	}
+	data, err := fs.ReadFile(adminUI, asset)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", adminUIPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, asset, time.Time{}, bytes.NewReader(data))
+}
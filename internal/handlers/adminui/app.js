@@ -0,0 +1,202 @@
+// Admin dashboard for the file caching service. The page is served behind
+// basic auth, which the browser resends with every call to the admin API.
+"use strict";
+
+const refreshInterval = 15000;
+
+const $ = (selector, root = document) => root.querySelector(selector);
+
+async function api(method, path, body) {
+  const init = {
+    method,
+    headers: { "X-Requested-With": "admin-ui" },
+    credentials: "same-origin",
+  };
+  if (body !== undefined) {
+    init.headers["Content-Type"] = "application/json";
+    init.body = JSON.stringify(body);
+  }
+  const resp = await fetch(path, init);
+  let payload = null;
+  try {
+    payload = await resp.json();
+  } catch (err) {
+    throw new Error(`${path}: ${resp.status} ${resp.statusText}`);
+  }
+  if (!resp.ok || !payload.success) {
+    throw new Error(`${path}: ${payload.message || resp.statusText}`);
+  }
+  return payload.data;
+}
+
+function formatBytes(n) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${i === 0 ? n : n.toFixed(1)} ${units[i]}`;
+}
+
+function formatPercent(ratio) {
+  return `${(ratio * 100).toFixed(1)}%`;
+}
+
+// fillTable replaces the rows of the table with one row per item, using
+// textContent so keys and messages are never parsed as HTML
+function fillTable(id, items, columns) {
+  const tbody = $(`#${id} tbody`);
+  tbody.replaceChildren();
+  if (!items || items.length === 0) {
+    const row = tbody.insertRow();
+    const cell = row.insertCell();
+    cell.colSpan = columns.length;
+    cell.className = "muted";
+    cell.textContent = "None";
+    return;
+  }
+  for (const item of items) {
+    const row = tbody.insertRow();
+    for (const column of columns) {
+      row.insertCell().textContent = column(item);
+    }
+  }
+}
+
+function showError(id, err) {
+  const el = $(id);
+  el.textContent = err.message;
+  el.classList.add("error");
+}
+
+async function loadDiagnostics() {
+  let diag;
+  try {
+    diag = await api("GET", "/admin/diagnostics");
+  } catch (err) {
+    showError("#build", err);
+    return;
+  }
+  const build = $("#build");
+  build.classList.remove("error");
+  build.textContent = [diag.build.version, diag.build.revision && diag.build.revision.slice(0, 12), `up ${diag.build.uptime}`]
+    .filter(Boolean)
+    .join(" · ");
+
+  const deps = $("#dependencies");
+  deps.replaceChildren();
+  for (const [name, health] of Object.entries(diag.dependencies)) {
+    const item = document.createElement("li");
+    item.className = health.status;
+    item.textContent = `${name}: ${health.status}`;
+    if (health.error) {
+      item.title = health.error;
+    }
+    deps.append(item);
+  }
+
+  if (diag.cache) {
+    $("#cache-size").textContent = formatBytes(diag.cache.bytes);
+    $("#cache-keys").textContent = `${diag.cache.keys} keys`;
+  } else {
+    $("#cache-size").textContent = "–";
+    $("#cache-keys").textContent = "not reported";
+  }
+
+  fillTable("errors", diag.recent_errors, [
+    (e) => new Date(e.time).toLocaleString(),
+    (e) => e.message + (e.attrs && e.attrs.error ? `: ${e.attrs.error}` : ""),
+    (e) => e.request_id || "",
+  ]);
+}
+
+async function loadReport() {
+  const windowName = $("#window").value;
+  let report;
+  try {
+    report = await api("GET", `/admin/reports/cache-efficiency?window=${encodeURIComponent(windowName)}`);
+  } catch (err) {
+    showError("#requests", err);
+    return;
+  }
+  const totals = report.totals;
+  $("#hit-ratio").textContent = formatPercent(totals.hit_ratio);
+  $("#requests").classList.remove("error");
+  $("#requests").textContent = `${totals.hits} hits / ${totals.requests} requests`;
+  $("#bytes-saved").textContent = formatBytes(totals.bytes_saved);
+  $("#bytes-fetched").textContent = `${formatBytes(totals.bytes_fetched)} fetched`;
+
+  fillTable("top-files", report.top_files, [(f) => f.key, (f) => f.requests]);
+  fillTable("top-misses", report.top_misses, [(m) => m.key, (m) => m.misses]);
+  fillTable("prefixes", report.prefixes, [
+    (p) => p.prefix,
+    (p) => p.requests,
+    (p) => formatPercent(p.hit_ratio),
+    (p) => formatBytes(p.bytes_saved),
+  ]);
+}
+
+async function refresh() {
+  await Promise.all([loadDiagnostics(), loadReport()]);
+  $("#updated").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+}
+
+// bindAction submits form to path with the body built from its mode and
+// target, and shows the result below it
+function bindAction(form, path, build) {
+  form.addEventListener("submit", async (event) => {
+    event.preventDefault();
+    const result = $(".result", form);
+    result.classList.remove("error");
+    result.textContent = "Working…";
+    const mode = form.elements.mode.value;
+    const target = form.elements.target.value.trim();
+    try {
+      const data = await api("POST", path, build(mode, target));
+      result.textContent = JSON.stringify(data, null, 2);
+      refresh();
+    } catch (err) {
+      showError(`#${form.id} .result`, err);
+    }
+  });
+}
+
+async function pollWarmJob(job, result) {
+  while (job.state === "running") {
+    await new Promise((resolve) => setTimeout(resolve, 1000));
+    job = await api("GET", `/admin/cache/warm/${encodeURIComponent(job.id)}`);
+    result.textContent = JSON.stringify(job, null, 2);
+  }
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  bindAction($("#purge"), "/admin/cache/purge", (mode, target) =>
+    mode === "prefix" ? { prefix: target } : { key: target },
+  );
+
+  const warm = $("#warm");
+  warm.addEventListener("submit", async (event) => {
+    event.preventDefault();
+    const result = $(".result", warm);
+    result.classList.remove("error");
+    result.textContent = "Starting…";
+    const target = warm.elements.target.value.trim();
+    const body =
+      warm.elements.mode.value === "prefix"
+        ? { prefix: target }
+        : { keys: target.split(",").map((key) => key.trim()).filter(Boolean) };
+    try {
+      const job = await api("POST", "/admin/cache/warm", body);
+      result.textContent = JSON.stringify(job, null, 2);
+      await pollWarmJob(job, result);
+    } catch (err) {
+      showError("#warm .result", err);
+    }
+  });
+
+  $("#refresh").addEventListener("click", refresh);
+  $("#window").addEventListener("change", loadReport);
+  refresh();
+  setInterval(refresh, refreshInterval);
+});
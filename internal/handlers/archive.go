@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// ArchiveConfig limits the archives served by Archive
+type ArchiveConfig struct {
+	// MaxFiles caps the files in one archive
+	MaxFiles int
+	// MaxBytes caps the total size of the files in one archive
+	MaxBytes int64
+}
+
+// DefaultArchiveConfig returns the archive limits used when none are
+// configured
+func DefaultArchiveConfig() ArchiveConfig {
+	return ArchiveConfig{MaxFiles: 1000, MaxBytes: 1 << 30}
+}
+
+// WithArchiveLimits sets the limits of archives served by Archive
+func WithArchiveLimits(cfg ArchiveConfig) Option {
+	return func(h *FileHandler) {
+		h.archive = cfg
+	}
+}
+
+// archiveFormats maps the format query parameter to the archive's media type
+var archiveFormats = map[string]string{
+	"zip": "application/zip",
+	"tar": "application/x-tar",
+}
+
+// errArchiveTooLarge is returned for prefixes over the archive limits
+var errArchiveTooLarge = errors.New("archive too large")
+
+// archiveWriter adds files to an archive being streamed
+type archiveWriter interface {
+	add(name string, modified time.Time, data []byte) error
+	Close() error
+}
+
+// Archive handles requests for a zip or tar archive of the files under a
+// prefix. The listing is checked against the limits before anything is
+// sent; files are then read one at a time, so only one is held in memory.
+func (h *FileHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	format := query.Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	contentType, ok := archiveFormats[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "format must be zip or tar",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	listCtx, cancel := h.requestContext(r.Context())
+	objects, err := h.archiveObjects(listCtx, prefix)
+	cancel()
+	if errors.Is(err, errArchiveTooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: ErrCodePayloadTooLarge,
+		})
+		return
+	}
+	if err != nil {
+		kind := classifyFailure(r.Context(), listCtx, err)
+		h.metrics.R2RequestsTotal.WithLabelValues("list", string(kind)).Inc()
+		if h.writeTimeoutOrCancel(listCtx, w, kind, "archive", "prefix", prefix, "error", err) {
+			return
+		}
+		slog.ErrorContext(r.Context(), "Storage list error", "prefix", prefix, "error", err)
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Failed to list files",
+			ErrorCode: ErrCodeStorageError,
+		})
+		return
+	}
+	if len(objects) == 0 {
+		writeJSON(w, http.StatusNotFound, Response{
+			Success:   false,
+			Message:   "No files match the prefix",
+			ErrorCode: ErrCodeFileNotFound,
+		})
+		return
+	}
+
+	base := archiveBase(prefix)
+	name := strings.TrimSuffix(strings.TrimPrefix(prefix, base), "/")
+	if name == "" {
+		name = "archive"
+	}
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", contentDisposition("attachment", name+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	var archive archiveWriter
+	if format == "tar" {
+		archive = &tarArchive{w: tar.NewWriter(w)}
+	} else {
+		archive = &zipArchive{w: zip.NewWriter(w)}
+	}
+	for _, obj := range objects {
+		if err := h.addToArchive(r.Context(), archive, obj, strings.TrimPrefix(obj.Key, base)); err != nil {
+			// The status is sent, so the connection is dropped to keep the
+			// client from taking a partial archive for a whole one
+			slog.ErrorContext(r.Context(), "Failed to archive file", "prefix", prefix, "filename", obj.Key, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		slog.WarnContext(r.Context(), "Failed to finish archive", "prefix", prefix, "error", err)
+	}
+}
+
+// archiveObjects lists the files under prefix that may be read, failing
+// with errArchiveTooLarge once they exceed the archive limits
+func (h *FileHandler) archiveObjects(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	var total int64
+	token := ""
+	for {
+		start := time.Now()
+		page, err := h.storage.ListObjects(ctx, prefix, token, maxListLimit)
+		h.metrics.R2RequestDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, err
+		}
+		h.metrics.R2RequestsTotal.WithLabelValues("list", "success").Inc()
+
+		for _, obj := range page.Objects {
+			// Folder markers have no content, and denied files are left out
+			if strings.HasSuffix(obj.Key, "/") || h.policy.Denied(&policy.Request{Name: obj.Key, Method: http.MethodGet}) {
+				continue
+			}
+			objects = append(objects, obj)
+			total += obj.Size
+			if len(objects) > h.archive.MaxFiles {
+				return nil, fmt.Errorf("%w: more than %d files", errArchiveTooLarge, h.archive.MaxFiles)
+			}
+			if total > h.archive.MaxBytes {
+				return nil, fmt.Errorf("%w: more than %d bytes", errArchiveTooLarge, h.archive.MaxBytes)
+			}
+		}
+		if page.NextToken == "" {
+			return objects, nil
+		}
+		token = page.NextToken
+	}
+}
+
+// addToArchive reads a file, from the cache when it holds it, and adds it
+// to the archive under name. Files read from storage aren't cached, so an
+// archive doesn't push hot files out of the cache.
+func (h *FileHandler) addToArchive(clientCtx context.Context, archive archiveWriter, obj storage.ObjectInfo, name string) error {
+	ctx, cancel := h.requestContext(clientCtx)
+	defer cancel()
+
+	if h.cache != nil && features.Enabled(ctx, features.CacheRead, true) {
+		entry, found, err := h.getCached(ctx, obj.Key)
+		if err != nil {
+			slog.WarnContext(ctx, "Cache error", "filename", obj.Key, "error", err)
+		}
+		if found {
+			return archive.add(name, obj.LastModified, entry.Data)
+		}
+	}
+
+	start := time.Now()
+	data, _, err := h.fetchObject(ctx, obj.Key)
+	h.metrics.R2RequestDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+	if err != nil {
+		h.metrics.R2RequestsTotal.WithLabelValues("get", string(classifyFailure(clientCtx, ctx, err))).Inc()
+		return err
+	}
+	h.metrics.R2RequestsTotal.WithLabelValues("get", "success").Inc()
+	return archive.add(name, obj.LastModified, data)
+}
+
+// archiveBase is the part of prefix left out of archive entry names, so
+// entries start at the last folder the prefix names
+func archiveBase(prefix string) string {
+	dir := strings.TrimSuffix(prefix, "/")
+	return dir[:strings.LastIndex(dir, "/")+1]
+}
+
+// entryName cleans an object key for use in an archive, so ".." segments
+// can't make extraction write outside the target folder
+func entryName(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+type zipArchive struct {
+	w *zip.Writer
+}
+
+func (a *zipArchive) add(name string, modified time.Time, data []byte) error {
+	fw, err := a.w.CreateHeader(&zip.FileHeader{
+		Name:     entryName(name),
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.w.Close()
+}
+
+type tarArchive struct {
+	w *tar.Writer
+}
+
+func (a *tarArchive) add(name string, modified time.Time, data []byte) error {
+	err := a.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entryName(name),
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.w.Write(data)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	return a.w.Close()
+}
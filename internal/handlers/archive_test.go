@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestArchive(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("reports/2024/q1.txt", []byte("first quarter"))
+	mockStorage.SetObject("reports/2024/q2/summary.txt", []byte("second quarter"))
+	mockStorage.SetObject("reports/2023/q4.txt", []byte("last year"))
+	mockCache.SetData("reports/2024/q1.txt", []byte("first quarter"))
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	get := func(h *handlers.FileHandler, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Archive(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	want := map[string]string{
+		"2024/q1.txt":         "first quarter",
+		"2024/q2/summary.txt": "second quarter",
+	}
+
+	rec := get(handler, "/archive?prefix=reports/2024/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="2024.zip"` {
+		t.Errorf("Unexpected Content-Disposition %q", got)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+	if len(got) != len(want) || got["2024/q1.txt"] != want["2024/q1.txt"] || got["2024/q2/summary.txt"] != want["2024/q2/summary.txt"] {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	// Cached files aren't read from storage
+	for _, key := range mockStorage.GetCalls {
+		if key == "reports/2024/q1.txt" {
+			t.Error("Expected the cached file to be served from the cache")
+		}
+	}
+
+	rec = get(handler, "/archive?prefix=reports/2024/&format=tar")
+	if got := rec.Header().Get("Content-Type"); got != "application/x-tar" {
+		t.Errorf("Expected a tar archive, got %q", got)
+	}
+	tr := tar.NewReader(rec.Body)
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		if want[hdr.Name] != string(data) {
+			t.Errorf("Unexpected tar entry %s: %q", hdr.Name, data)
+		}
+		files++
+	}
+	if files != len(want) {
+		t.Errorf("Expected %d tar entries, got %d", len(want), files)
+	}
+
+	limited := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithArchiveLimits(handlers.ArchiveConfig{MaxFiles: 1, MaxBytes: 1 << 20}))
+	tests := []struct {
+		name    string
+		handler *handlers.FileHandler
+		target  string
+		status  int
+	}{
+		{"too many files", limited, "/archive?prefix=reports/", http.StatusRequestEntityTooLarge},
+		{"no match", handler, "/archive?prefix=missing/", http.StatusNotFound},
+		{"unknown format", handler, "/archive?prefix=reports/&format=rar", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := get(tt.handler, tt.target); rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// maxRangeBlocks caps the blocks read for one range. Longer ranges are
+// served from the whole file, except open-ended ones, which are cut short
+// as a player seeking through a video expects.
+const maxRangeBlocks = 16
+
+// blocksVariant is the variant key holding the metadata of a file whose
+// blocks are cached
+const blocksVariant = "blocks"
+
+// errBlocksChanged reports a file that changed since its blocks were cached
+var errBlocksChanged = errors.New("file changed since its blocks were cached")
+
+// WithRangeBlocks caches the ranges of files requested with a Range header
+// as aligned blocks of size bytes, read from storage alone, so seeking
+// through a large file never loads it whole
+func WithRangeBlocks(size int64) Option {
+	return func(h *FileHandler) {
+		h.blockSize = size
+	}
+}
+
+// blockKey returns the cache key of block i of filename. Blocks are keyed
+// by ETag so those of different versions of the file are never mixed.
+func blockKey(filename, etag string, i int64) string {
+	return cache.VariantKey(filename, "block:"+strings.Trim(etag, `"`)+":"+strconv.FormatInt(i, 10))
+}
+
+// serveBlockRange serves the range r asks for from cached blocks of the
+// file, reading missing blocks from storage and caching them. It returns
+// false, writing nothing, when the range can't be served this way, leaving
+// the request to be served whole.
+func (h *FileHandler) serveBlockRange(ctx context.Context, w http.ResponseWriter, r *http.Request, filename string) bool {
+	getter, ok := h.storage.(storage.RangeGetter)
+	if !ok || h.blockSize <= 0 || r.Header.Get("If-Range") != "" {
+		return false
+	}
+	offset, length, ok := parseRange(r.Header.Get("Range"))
+	if !ok {
+		return false
+	}
+	meta, ok := h.blockMeta(ctx, filename)
+	if !ok {
+		return false
+	}
+
+	size := meta.Size
+	start, end := cache.ResolveRange(offset, length, size)
+	if start >= size {
+		h.setFileHeaders(ctx, w.Header(), filename, meta)
+		writeUnsatisfiable(w, size)
+		return true
+	}
+	first, last := start/h.blockSize, (end-1)/h.blockSize
+	if last-first >= maxRangeBlocks {
+		if offset < 0 || length >= 0 {
+			return false
+		}
+		last = first + maxRangeBlocks - 1
+		end = (last + 1) * h.blockSize
+	}
+
+	data, cached, err := h.readBlocks(ctx, getter, filename, meta, first, last)
+	skip := start - first*h.blockSize
+	end = min(end, size)
+	if err == nil && int64(len(data)) < skip+end-start {
+		err = fmt.Errorf("blocks %d-%d are shorter than the file", first, last)
+	}
+	if err != nil {
+		if errors.Is(err, errBlocksChanged) {
+			if _, err := h.purgeKeys(ctx, cache.VariantKey(filename, blocksVariant)); err != nil {
+				slog.WarnContext(ctx, "Failed to purge file blocks metadata", "filename", filename, "error", err)
+			}
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			slog.WarnContext(ctx, "Failed to read file blocks", "filename", filename, "error", err)
+		}
+		return false
+	}
+
+	status, source := CacheStatusMiss, sourceStorage
+	if cached {
+		status, source = CacheStatusHit, sourceCache
+		h.metrics.CacheHitsTotal.Inc()
+		h.efficiency.Hit(filename, end-start)
+	} else {
+		h.metrics.CacheMissesTotal.Inc()
+		h.efficiency.Miss(filename, end-start)
+	}
+	slog.InfoContext(ctx, "Cache "+status, "filename", filename, "range", r.Header.Get("Range"))
+	header := w.Header()
+	header.Set(HeaderCache, status)
+	h.setFileHeaders(ctx, header, filename, meta)
+	if notModified(r, meta) {
+		writeNotModified(w)
+		return true
+	}
+	h.writeRange(ctx, w, filename, source, data[skip:skip+end-start], start, end, size)
+	return true
+}
+
+// blockMeta returns the metadata of filename recorded with its blocks,
+// reading it from storage and caching it when it isn't cached. Files
+// without an ETag aren't served from blocks.
+func (h *FileHandler) blockMeta(ctx context.Context, filename string) (cache.EntryMeta, bool) {
+	key := cache.VariantKey(filename, blocksVariant)
+	if entry, found, err := h.getCached(ctx, key); err == nil && found && entry.Meta.ETag != "" {
+		return entry.Meta, true
+	}
+	stater, ok := h.storage.(storage.HeaderStater)
+	if !ok {
+		return cache.EntryMeta{}, false
+	}
+	headers, err := stater.StatObject(ctx, filename)
+	if err != nil {
+		// The request served whole reports the error
+		return cache.EntryMeta{}, false
+	}
+	meta := cache.MetaFromHeaders(headers)
+	meta.Size, err = strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+	if err != nil || meta.ETag == "" {
+		return cache.EntryMeta{}, false
+	}
+	if err := h.storeCached(ctx, key, nil, meta); err != nil {
+		slog.WarnContext(ctx, "Failed to cache file blocks metadata", "filename", filename, "error", err)
+	} else if idx, ok := h.cache.(cache.VariantIndex); ok {
+		if err := idx.AddVariant(ctx, filename, key); err != nil {
+			slog.WarnContext(ctx, "Failed to index variant", "key", key, "error", err)
+		}
+	}
+	return meta, true
+}
+
+// readBlocks returns blocks first to last of filename joined, reporting
+// whether they were all cached. The blocks missing from the cache are read
+// from storage in one request and cached in the background.
+func (h *FileHandler) readBlocks(ctx context.Context, getter storage.RangeGetter, filename string, meta cache.EntryMeta, first, last int64) ([]byte, bool, error) {
+	blocks := make([][]byte, last-first+1)
+	missFirst, missLast := int64(-1), int64(-1)
+	for i := range blocks {
+		n := first + int64(i)
+		entry, found, err := h.getCached(ctx, blockKey(filename, meta.ETag, n))
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read file block", "filename", filename, "block", n, "error", err)
+		}
+		if found {
+			blocks[i] = entry.Data
+			continue
+		}
+		if missFirst < 0 {
+			missFirst = n
+		}
+		missLast = n
+	}
+
+	if missFirst >= 0 {
+		start := time.Now()
+		data, headers, err := getter.GetObjectRange(ctx, filename, missFirst*h.blockSize, (missLast-missFirst+1)*h.blockSize)
+		h.metrics.R2RequestDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+		if err != nil {
+			h.metrics.R2RequestsTotal.WithLabelValues("get", string(classifyFailure(ctx, ctx, err))).Inc()
+			return nil, false, fmt.Errorf("failed to read blocks %d-%d: %w", missFirst, missLast, err)
+		}
+		h.metrics.R2RequestsTotal.WithLabelValues("get", "success").Inc()
+		if headers.Get("ETag") != meta.ETag {
+			return nil, false, errBlocksChanged
+		}
+		for n := missFirst; n <= missLast; n++ {
+			offset := (n - missFirst) * h.blockSize
+			if offset >= int64(len(data)) {
+				return nil, false, fmt.Errorf("block %d is past the end of the file", n)
+			}
+			block := data[offset:min(offset+h.blockSize, int64(len(data)))]
+			if blocks[n-first] == nil {
+				blocks[n-first] = block
+				go h.storeVariant(ctx, filename, blockKey(filename, meta.ETag, n), block, meta)
+			}
+		}
+	}
+
+	joined := make([]byte, 0, int64(len(blocks))*h.blockSize)
+	for _, block := range blocks {
+		joined = append(joined, block...)
+	}
+	return joined, missFirst < 0, nil
+}
@@ -0,0 +1,64 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestGetFile_RangeBlocks(t *testing.T) {
+	data := strings.Repeat("abcdefghij", 100)
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("movie.mp4", []byte(data))
+	mockStorage.SetObjectHeaders("movie.mp4", http.Header{"Etag": {`"v1"`}})
+	mockCache := mocks.NewMockCache()
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithRangeBlocks(100))
+
+	assertRange := func(rangeHeader string, wantStatus int, wantCache, wantRange, wantBody string) {
+		t.Helper()
+		rec := getFile(handler, "movie.mp4", map[string]string{"Range": rangeHeader})
+		if rec.Code != wantStatus {
+			t.Fatalf("Expected status %d for %s, got %d", wantStatus, rangeHeader, rec.Code)
+		}
+		if got := rec.Header().Get(handlers.HeaderCache); got != wantCache {
+			t.Errorf("Expected X-Cache %q for %s, got %q", wantCache, rangeHeader, got)
+		}
+		if got := rec.Header().Get("Content-Range"); got != wantRange {
+			t.Errorf("Expected Content-Range %q, got %q", wantRange, got)
+		}
+		if wantBody != "" && rec.Body.String() != wantBody {
+			t.Errorf("Expected %d bytes for %s, got %d", len(wantBody), rangeHeader, rec.Body.Len())
+		}
+	}
+
+	// Only the blocks holding the range are read from storage
+	assertRange("bytes=150-349", http.StatusPartialContent, handlers.CacheStatusMiss, "bytes 150-349/1000", data[150:350])
+	if len(mockStorage.GetCalls) != 0 {
+		t.Errorf("Expected the file never to be read whole, got %v", mockStorage.GetCalls)
+	}
+	if calls := mockStorage.RangeCalls; len(calls) != 1 || calls[0].Offset != 100 || calls[0].Length != 300 {
+		t.Fatalf("Expected blocks 1-3 to be read in one request, got %+v", calls)
+	}
+	for i, block := range []string{"1", "2", "3"} {
+		waitForCached(t, mockCache, "movie.mp4#block:v1:"+block, data[(i+1)*100:(i+2)*100])
+	}
+
+	// Cached blocks are served without reaching storage, and only the
+	// missing ones are read
+	assertRange("bytes=100-399", http.StatusPartialContent, handlers.CacheStatusHit, "bytes 100-399/1000", data[100:400])
+	assertRange("bytes=-50", http.StatusPartialContent, handlers.CacheStatusMiss, "bytes 950-999/1000", data[950:])
+	assertRange("bytes=2000-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */1000", "")
+	if calls := mockStorage.RangeCalls; len(calls) != 2 || calls[1].Offset != 900 || calls[1].Length != 100 {
+		t.Fatalf("Expected only block 9 to be read, got %+v", calls)
+	}
+
+	// A changed file is served whole, and its new blocks cached after
+	changed := strings.ToUpper(data)
+	mockStorage.SetObject("movie.mp4", []byte(changed))
+	mockStorage.SetObjectHeaders("movie.mp4", http.Header{"Etag": {`"v2"`}})
+	assertRange("bytes=500-599", http.StatusOK, handlers.CacheStatusMiss, "", changed)
+	assertRange("bytes=500-599", http.StatusPartialContent, handlers.CacheStatusMiss, "bytes 500-599/1000", changed[500:600])
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// CacheControlRules selects the Cache-Control header sent with files, so
+// browsers and CDNs in front of the service can cache them
+type CacheControlRules struct {
+	// Default applies to files no extension rule matches; empty sends none
+	Default string
+	// ByExtension maps lower-case extensions, including the dot, to a value
+	ByExtension map[string]string
+}
+
+// ParseCacheControlRules parses semicolon-separated ext[,ext...]=value
+// rules, e.g. ".png,.jpg=public, max-age=86400; .html=no-cache"
+func ParseCacheControlRules(spec string) (map[string]string, error) {
+	rules := make(map[string]string)
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		exts, value, ok := strings.Cut(rule, "=")
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid cache control rule %q: expected ext=value", rule)
+		}
+		for _, ext := range strings.Split(exts, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				return nil, fmt.Errorf("invalid cache control rule %q: empty extension", rule)
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			rules[ext] = value
+		}
+	}
+	return rules, nil
+}
+
+// WithCacheControl sets the Cache-Control header sent with files. A
+// Cache-Control header stored with the object, when passed through, takes
+// precedence.
+func WithCacheControl(rules CacheControlRules) Option {
+	return func(h *FileHandler) {
+		h.cacheControl = rules
+	}
+}
+
+// cacheControlFor returns the configured Cache-Control value for filename
+func (h *FileHandler) cacheControlFor(filename string) string {
+	if value, ok := h.cacheControl.ByExtension[strings.ToLower(filepath.Ext(filename))]; ok {
+		return value
+	}
+	return h.cacheControl.Default
+}
+
+// restrictSharedCaching keeps shared caches from storing a response that was
+// authorized by a signed URL, since a CDN could serve it to anyone
+func restrictSharedCaching(header http.Header) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return
+		}
+	}
+	header.Set("Cache-Control", "private")
+}
@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+func TestParseCacheControlRules(t *testing.T) {
+	rules, err := handlers.ParseCacheControlRules(".png, JPG=public, max-age=86400; .html=no-cache;")
+	if err != nil {
+		t.Fatalf("ParseCacheControlRules failed: %v", err)
+	}
+	want := map[string]string{
+		".png":  "public, max-age=86400",
+		".jpg":  "public, max-age=86400",
+		".html": "no-cache",
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, rules)
+	}
+	for ext, value := range want {
+		if rules[ext] != value {
+			t.Errorf("Expected %s=%q, got %q", ext, value, rules[ext])
+		}
+	}
+
+	for _, spec := range []string{".png", ".png=", "=public", ".png,,.jpg=public"} {
+		if _, err := handlers.ParseCacheControlRules(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestGetFile_CacheControl(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("logo.png", []byte("png"))
+	mockStorage.SetObject("index.html", []byte("<html>"))
+	mockStorage.SetObject("data.bin", []byte("bin"))
+	mockStorage.SetObject("report.pdf", []byte("%PDF"))
+	mockStorage.SetObjectHeaders("report.pdf", http.Header{"Cache-Control": {"private, max-age=60"}})
+
+	handler := handlers.NewFileHandler(nil, mockStorage, handlers.WithCacheControl(handlers.CacheControlRules{
+		Default:     "public, max-age=3600",
+		ByExtension: map[string]string{".png": "public, max-age=86400, immutable", ".html": "no-cache"},
+	}))
+
+	for name, want := range map[string]string{
+		"logo.png":   "public, max-age=86400, immutable",
+		"index.html": "no-cache",
+		"data.bin":   "public, max-age=3600",
+		// The object's own header is passed through
+		"report.pdf": "private, max-age=60",
+	} {
+		if got := getFile(handler, name, nil).Header().Get("Cache-Control"); got != want {
+			t.Errorf("%s: expected Cache-Control %q, got %q", name, want, got)
+		}
+	}
+
+	unconfigured := handlers.NewFileHandler(nil, mockStorage)
+	if got := getFile(unconfigured, "data.bin", nil).Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Expected no Cache-Control by default, got %q", got)
+	}
+}
+
+func TestGetFile_CacheControlSignedURL(t *testing.T) {
+	keyring, err := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a.txt", []byte("content"))
+	handler := handlers.NewFileHandler(nil, mockStorage,
+		handlers.WithSignedURLs(keyring, handlers.DefaultPresignConfig()),
+		handlers.WithCacheControl(handlers.CacheControlRules{Default: "public, max-age=3600"}),
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", handler.VerifySignedURL(handler.GetFile))
+	mux.HandleFunc("POST /presign/{name...}", handler.Presign)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/presign/a.txt", strings.NewReader(`{}`)))
+	var resp struct {
+		Data handlers.PresignResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse presign response: %v", err)
+	}
+	signed, err := url.Parse(resp.Data.URL)
+	if err != nil {
+		t.Fatalf("Invalid URL: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed.RequestURI(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private" {
+		t.Errorf("Expected signed downloads to be private, got %q", got)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// serviceVersion is the version reported by Root and Capabilities
+const serviceVersion = "1.0.0"
+
+// Capabilities lists the optional features enabled in a deployment, so
+// clients can adapt instead of probing endpoints
+type Capabilities struct {
+	Version string `json:"version"`
+	// Cache is false when files are always fetched from storage
+	Cache   bool               `json:"cache"`
+	Uploads UploadCapabilities `json:"uploads"`
+	// Presign reports whether POST /presign/{name} can sign URLs
+	Presign bool `json:"presign"`
+	// Compression lists the encodings responses can be compressed to
+	Compression []string `json:"compression"`
+	// ImageTransforms reports whether GET /files/{name} resizes and
+	// converts images
+	ImageTransforms bool `json:"image_transforms"`
+	// ArchiveMembers reports whether GET /files/{archive}!/{path} serves
+	// files from inside archives
+	ArchiveMembers bool `json:"archive_members"`
+	// Protocols lists the APIs serving files, starting with the HTTP API
+	Protocols []Protocol `json:"protocols"`
+}
+
+// UploadCapabilities describes the ways files can be uploaded
+type UploadCapabilities struct {
+	// Direct reports whether POST /upload-url/{name} works
+	Direct bool `json:"direct"`
+	// Resumable reports whether /uploads/{name} works
+	Resumable bool `json:"resumable"`
+	// PartSize is the part size of resumable uploads
+	PartSize int64 `json:"part_size,omitempty"`
+	// Processing reports whether uploads run through the upload pipeline
+	Processing bool `json:"processing"`
+}
+
+// Protocol describes an API serving files
+type Protocol struct {
+	// Name is http, grpc, s3 or webdav
+	Name string `json:"name"`
+	// Addrs are the listener addresses of APIs served on their own
+	// listeners, marked ";tls" when they serve TLS
+	Addrs []string `json:"addrs,omitempty"`
+	// Path is the path prefix of APIs served by the HTTP listener
+	Path string `json:"path,omitempty"`
+	// Ranges reports whether the API honors byte range requests
+	Ranges bool `json:"ranges"`
+}
+
+// WithProtocols lists the APIs served besides the HTTP API in Capabilities
+func WithProtocols(protocols ...Protocol) Option {
+	return func(h *FileHandler) {
+		h.protocols = append(h.protocols, protocols...)
+	}
+}
+
+// WithResponseCompression lists the encodings CompressionMiddleware
+// offers in Capabilities
+func WithResponseCompression(encodings []string) Option {
+	return func(h *FileHandler) {
+		h.compression = encodings
+	}
+}
+
+// Capabilities handles requests for the features this deployment supports
+func (h *FileHandler) Capabilities(w http.ResponseWriter, r *http.Request) {
+	_, direct := h.storage.(storage.UploadPresigner)
+	_, resumable := h.storage.(storage.MultipartUploader)
+
+	caps := Capabilities{
+		Version: serviceVersion,
+		Cache:   h.cache != nil,
+		Uploads: UploadCapabilities{
+			Direct:     direct,
+			Resumable:  resumable,
+			Processing: h.pipeline != nil,
+		},
+		Presign:         h.signer != nil,
+		Compression:     append([]string{}, h.compression...),
+		ImageTransforms: h.images != nil,
+		ArchiveMembers:  h.memberMaxBytes > 0,
+		Protocols:       append([]Protocol{{Name: "http", Path: "/files"}}, h.protocols...),
+	}
+	if resumable {
+		caps.Uploads.PartSize = h.partSize
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    caps,
+	})
+}
@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+type capabilitiesResponse struct {
+	Success bool                  `json:"success"`
+	Data    handlers.Capabilities `json:"data"`
+}
+
+func getCapabilities(t *testing.T, handler *handlers.FileHandler) handlers.Capabilities {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.Capabilities(rec, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var resp capabilitiesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return resp.Data
+}
+
+func TestCapabilities_Minimal(t *testing.T) {
+	caps := getCapabilities(t, handlers.NewFileHandler(nil, mocks.NewMockStorage()))
+
+	if caps.Cache || caps.Presign || caps.Uploads.Processing || caps.ImageTransforms || caps.ArchiveMembers {
+		t.Errorf("Expected optional features to be off, got %+v", caps)
+	}
+	if !caps.Uploads.Direct || !caps.Uploads.Resumable || caps.Uploads.PartSize != handlers.DefaultPartSize {
+		t.Errorf("Expected the storage's upload support, got %+v", caps.Uploads)
+	}
+	if caps.Compression == nil || len(caps.Compression) != 0 {
+		t.Errorf("Expected an empty compression list, got %v", caps.Compression)
+	}
+	if len(caps.Protocols) != 1 || caps.Protocols[0].Name != "http" || caps.Protocols[0].Ranges {
+		t.Errorf("Expected only the HTTP API, without ranges, got %+v", caps.Protocols)
+	}
+}
+
+func TestCapabilities_Enabled(t *testing.T) {
+	handler := handlers.NewFileHandler(mocks.NewMockCache(), mocks.NewMockStorage(),
+		handlers.WithResponseCompression([]string{handlers.EncodingBrotli, handlers.EncodingGzip}),
+		handlers.WithProtocols(
+			handlers.Protocol{Name: "s3", Addrs: []string{":9000"}, Ranges: true},
+			handlers.Protocol{Name: "webdav", Path: "/dav/", Ranges: true},
+		),
+	)
+	caps := getCapabilities(t, handler)
+
+	if !caps.Cache {
+		t.Error("Expected the cache to be reported")
+	}
+	if len(caps.Compression) != 2 || caps.Compression[0] != handlers.EncodingBrotli {
+		t.Errorf("Expected br and gzip, got %v", caps.Compression)
+	}
+	if len(caps.Protocols) != 3 || caps.Protocols[1].Name != "s3" || caps.Protocols[2].Path != "/dav/" {
+		t.Errorf("Expected the HTTP, S3 and WebDAV APIs, got %+v", caps.Protocols)
+	}
+}
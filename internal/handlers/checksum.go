@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/features"
+)
+
+// HeaderChecksumSHA256 carries the base64 SHA-256 digest of an upload body,
+// as in the S3 API
+const HeaderChecksumSHA256 = "X-Amz-Checksum-Sha256"
+
+// checksumVariant is the cache variant holding a file's digests
+const checksumVariant = "checksum"
+
+// Upload digest failures
+var (
+	// errInvalidDigest is returned for digest headers that aren't valid
+	// base64 digests
+	errInvalidDigest = errors.New("invalid digest header")
+	// errBadDigest is returned for bodies that don't match their digest
+	errBadDigest = errors.New("body does not match its digest")
+)
+
+// FileChecksum holds the hex-encoded digests of a file
+type FileChecksum struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+}
+
+// verifyDigests checks data against the Content-MD5 and
+// X-Amz-Checksum-Sha256 headers of an upload, when present
+func verifyDigests(header http.Header, data []byte) error {
+	digests := []struct {
+		name string
+		sum  func([]byte) []byte
+	}{
+		{"Content-MD5", func(b []byte) []byte { sum := md5.Sum(b); return sum[:] }},
+		{HeaderChecksumSHA256, func(b []byte) []byte { sum := sha256.Sum256(b); return sum[:] }},
+	}
+	for _, d := range digests {
+		value := header.Get(d.name)
+		if value == "" {
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(value)
+		sum := d.sum(data)
+		if err != nil || len(want) != len(sum) {
+			return fmt.Errorf("%w: %s", errInvalidDigest, d.name)
+		}
+		if !bytes.Equal(want, sum) {
+			return fmt.Errorf("%w: %s", errBadDigest, d.name)
+		}
+	}
+	return nil
+}
+
+// writeDigestError writes the response for an upload failing verifyDigests
+func writeDigestError(ctx context.Context, w http.ResponseWriter, filename string, err error) {
+	slog.InfoContext(ctx, "Rejected upload digest", "filename", filename, "error", err)
+	code := ErrCodeBadDigest
+	if errors.Is(err, errInvalidDigest) {
+		code = ErrCodeInvalidRequest
+	}
+	writeJSON(w, http.StatusBadRequest, Response{
+		Success:   false,
+		Message:   err.Error(),
+		ErrorCode: code,
+	})
+}
+
+// Checksum handles requests for the SHA-256 and MD5 digests of a file, so
+// clients can verify what they downloaded. Digests are cached alongside the
+// file and purged with it.
+func (h *FileHandler) Checksum(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	filename, err := h.resolveName(ctx, r.PathValue("name"), http.MethodGet)
+	if errors.Is(err, errPolicyDenied) {
+		writeJSON(w, http.StatusForbidden, Response{
+			Success:   false,
+			Message:   "Access denied",
+			ErrorCode: ErrCodeAccessDenied,
+		})
+		return
+	}
+	if err != nil {
+		writeInvalidFilename(w, r, r.PathValue("name"), err)
+		return
+	}
+
+	sums, err := h.fileChecksum(r.Context(), ctx, filename)
+	if err != nil {
+		h.writeReadFailure(r.Context(), ctx, w, "checksum", filename, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    sums,
+	})
+}
+
+// fileChecksum returns the digests of filename from the cache when they
+// were computed for its current ETag, or else computes and caches them
+func (h *FileHandler) fileChecksum(clientCtx, ctx context.Context, filename string) (*FileChecksum, error) {
+	key := cache.VariantKey(filename, checksumVariant)
+	if h.cache != nil && features.Enabled(ctx, features.CacheRead, true) {
+		stat, err := h.statFile(clientCtx, ctx, filename)
+		if err != nil {
+			return nil, err
+		}
+		entry, found, err := h.getCached(ctx, key)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read cached checksum", "filename", filename, "error", err)
+		}
+		var sums FileChecksum
+		if found && entry.Meta.ETag == stat.meta.ETag && json.Unmarshal(entry.Data, &sums) == nil {
+			return &sums, nil
+		}
+	}
+
+	file, err := h.readThrough(clientCtx, ctx, filename, false)
+	if err != nil {
+		return nil, err
+	}
+	sha := sha256.Sum256(file.data)
+	sum := md5.Sum(file.data)
+	sums := &FileChecksum{
+		Name:   filename,
+		Size:   int64(len(file.data)),
+		SHA256: hex.EncodeToString(sha[:]),
+		MD5:    hex.EncodeToString(sum[:]),
+	}
+	if h.cache != nil {
+		if encoded, err := json.Marshal(sums); err == nil {
+			go h.storeVariant(ctx, filename, key, encoded, file.meta)
+		}
+	}
+	return sums, nil
+}
@@ -0,0 +1,158 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// TestChecksumRoutes checks checksums and files under a directory are
+// routed apart, however their names end
+func TestChecksumRoutes(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("docs/checksum", []byte("not a digest"))
+	mockStorage.SetObject("a/b", []byte("nested"))
+	handler := handlers.NewFileHandler(nil, mockStorage)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name...}", handler.GetFile)
+	mux.HandleFunc("GET /checksums/{name...}", handler.Checksum)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/docs/checksum", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "not a digest" {
+		t.Errorf("Expected the file docs/checksum, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checksums/a/b", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data handlers.FileChecksum `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	sha := sha256.Sum256([]byte("nested"))
+	if resp.Data.Name != "a/b" || resp.Data.SHA256 != hex.EncodeToString(sha[:]) {
+		t.Errorf("Expected the checksum of a/b, got %+v", resp.Data)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("build/app.tar", []byte("artifact"))
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /checksums/{name...}", handler.Checksum)
+
+	get := func() handlers.FileChecksum {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checksums/build/app.tar", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data handlers.FileChecksum `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return resp.Data
+	}
+
+	sha := sha256.Sum256([]byte("artifact"))
+	sum := md5.Sum([]byte("artifact"))
+	got := get()
+	if got.SHA256 != hex.EncodeToString(sha[:]) || got.MD5 != hex.EncodeToString(sum[:]) || got.Size != 8 {
+		t.Errorf("Unexpected checksum %+v", got)
+	}
+
+	// The digests are cached as a variant of the file
+	key := cache.VariantKey("build/app.tar", "checksum")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, found, _ := mockCache.Get(context.Background(), key); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the checksum to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	variants, _ := mockCache.Variants(context.Background(), "build/app.tar")
+	if len(variants) != 1 || variants[0] != key {
+		t.Errorf("Expected the checksum to be purged with the file, got variants %v", variants)
+	}
+
+	mockStorage.GetCalls = nil
+	get()
+	if len(mockStorage.GetCalls) != 0 {
+		t.Errorf("Expected cached digests to be served without reading storage, got %v", mockStorage.GetCalls)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checksums/missing.tar", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing file, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestMultipart_PartDigests(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mux := newMultipartMux(mocks.NewMockCache(), mockStorage)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads/app.tar", nil))
+	base := "/uploads/" + decodeUpload(t, rec).UploadID + "/app.tar?part=1"
+
+	sha := sha256.Sum256([]byte("part one"))
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		code   handlers.ErrorCode
+	}{
+		{"matching checksum", handlers.HeaderChecksumSHA256, base64.StdEncoding.EncodeToString(sha[:]), http.StatusOK, ""},
+		{"mismatched checksum", handlers.HeaderChecksumSHA256, base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)), http.StatusBadRequest, handlers.ErrCodeBadDigest},
+		{"mismatched md5", "Content-MD5", base64.StdEncoding.EncodeToString(make([]byte, md5.Size)), http.StatusBadRequest, handlers.ErrCodeBadDigest},
+		{"malformed md5", "Content-MD5", "not-base64", http.StatusBadRequest, handlers.ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, base, strings.NewReader("part one"))
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp handlers.Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if resp.ErrorCode != tt.code {
+				t.Errorf("Expected error code %s, got %s", tt.code, resp.ErrorCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// Supported content encodings
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// brotliLevel trades ratio for speed, since most responses are compressed
+// on the fly
+const brotliLevel = 5
+
+// CompressionConfig controls response compression
+type CompressionConfig struct {
+	// Encodings are offered in this order of preference when a client
+	// accepts several equally
+	Encodings []string
+	// MinSize is the smallest body worth compressing
+	MinSize int
+	// ContentTypes lists the compressible media types; "text/*" matches
+	// every subtype
+	ContentTypes []string
+}
+
+// DefaultCompressionConfig returns the compression settings used when none
+// are configured
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Encodings: []string{EncodingBrotli, EncodingGzip},
+		MinSize:   1024,
+		ContentTypes: []string{
+			"text/*",
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"application/xhtml+xml",
+			"application/manifest+json",
+			"application/ld+json",
+			"image/svg+xml",
+		},
+	}
+}
+
+// Validate reports unsupported encodings
+func (c CompressionConfig) Validate() error {
+	for _, encoding := range c.Encodings {
+		if _, ok := encoders[encoding]; !ok {
+			return fmt.Errorf("unsupported compression encoding %q: expected %s or %s", encoding, EncodingBrotli, EncodingGzip)
+		}
+	}
+	return nil
+}
+
+// negotiate picks the encoding for a response to r from its Accept-Encoding
+// header, or returns "" to send it as is
+func (c CompressionConfig) negotiate(r *http.Request) string {
+	if accepted := c.accepted(r); len(accepted) > 0 {
+		return accepted[0]
+	}
+	return ""
+}
+
+// accepted returns the configured encodings r accepts, best first. Equally
+// acceptable encodings keep their configured order.
+func (c CompressionConfig) accepted(r *http.Request) []string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, item := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(item, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					continue
+				}
+				q = parsed
+			}
+			switch name {
+			case "*":
+				wildcard = q
+			case "x-gzip":
+				qualities[EncodingGzip] = q
+			default:
+				qualities[name] = q
+			}
+		}
+	}
+
+	quality := func(encoding string) float64 {
+		if q, ok := qualities[encoding]; ok {
+			return q
+		}
+		return wildcard
+	}
+	var accepted []string
+	for _, encoding := range c.Encodings {
+		if quality(encoding) > 0 {
+			accepted = append(accepted, encoding)
+		}
+	}
+	slices.SortStableFunc(accepted, func(a, b string) int {
+		return cmp.Compare(quality(b), quality(a))
+	})
+	return accepted
+}
+
+// compressible reports whether bodies of contentType are worth compressing
+func (c CompressionConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.ContentTypes {
+		if t == mediaType {
+			return true
+		}
+		if family, ok := strings.CutSuffix(t, "*"); ok && strings.HasSuffix(family, "/") && strings.HasPrefix(mediaType, family) {
+			return true
+		}
+	}
+	return false
+}
+
+// encoder is the common interface of the gzip and brotli writers
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders pools a writer per encoding; compressor state is large enough
+// that allocating one per response shows up under load
+var encoders = map[string]*sync.Pool{
+	EncodingBrotli: {New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }},
+	EncodingGzip: {New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+}
+
+func getEncoder(encoding string, w io.Writer) encoder {
+	enc := encoders[encoding].Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+func putEncoder(encoding string, enc encoder) {
+	enc.Reset(io.Discard)
+	encoders[encoding].Put(enc)
+}
+
+// encode compresses data in one go
+func encode(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := getEncoder(encoding, &buf)
+	defer putEncoder(encoding, enc)
+	if _, err := enc.Write(data); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addVary adds a field to the Vary header unless it is already listed
+func addVary(header http.Header, field string) {
+	for _, value := range header.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
+}
+
+// setContentEncoding marks a response as compressed. A strong ETag names the
+// uncompressed bytes, so it is weakened; conditional requests compare ETags
+// weakly and still match.
+func setContentEncoding(header http.Header, encoding string) {
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", encoding)
+	addVary(header, "Accept-Encoding")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// CompressionMiddleware compresses responses with a compressible content
+// type for clients that accept a configured encoding. Responses that are
+// already encoded, partial or smaller than the minimum size are sent as is.
+// Compressible responses carry Vary: Accept-Encoding either way, so shared
+// caches keep the encodings apart.
+func CompressionMiddleware(cfg CompressionConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{ResponseWriter: w, cfg: cfg, encoding: cfg.negotiate(r)}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter decides whether to compress when the handler writes its
+// header; with no encoding it only adds Vary. A compressible body without a
+// Content-Length is held back until it reaches the minimum size, so short
+// error responses go out as is.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      CompressionConfig
+	encoding string
+
+	status  int // set once the handler has written its header
+	pending bool
+	buf     []byte
+	enc     encoder
+	done    bool // the header has been sent to the client
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 || code < http.StatusOK {
+		// Informational responses and superfluous calls go straight through
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || !cw.cfg.compressible(header.Get("Content-Type")) {
+		cw.send()
+		return
+	}
+	addVary(header, "Accept-Encoding")
+	if cw.encoding == "" || code == http.StatusNoContent || code == http.StatusPartialContent || code == http.StatusNotModified || header.Get("Content-Range") != "" {
+		cw.send()
+		return
+	}
+
+	if length := header.Get("Content-Length"); length != "" {
+		if n, err := strconv.Atoi(length); err != nil || n < cw.cfg.MinSize {
+			cw.send()
+			return
+		}
+		cw.start()
+		return
+	}
+	cw.pending = true
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		header := cw.Header()
+		if _, ok := header["Content-Type"]; !ok {
+			header.Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.pending {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= cw.cfg.MinSize {
+			if err := cw.start(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// start compresses the rest of the response, including anything held back
+func (cw *compressWriter) start() error {
+	setContentEncoding(cw.Header(), cw.encoding)
+	cw.enc = getEncoder(cw.encoding, cw.ResponseWriter)
+	cw.send()
+
+	buf := cw.buf
+	cw.pending, cw.buf = false, nil
+	if len(buf) > 0 {
+		if _, err := cw.enc.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send writes the header to the client
+func (cw *compressWriter) send() {
+	if !cw.done {
+		cw.done = true
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+}
+
+// FlushError sends what has been written so far. A body still held back is
+// compressed, since a handler that flushes is streaming.
+func (cw *compressWriter) FlushError() error {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.pending {
+		if err := cw.start(); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Flush implements http.Flusher
+func (cw *compressWriter) Flush() {
+	_ = cw.FlushError()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response, sending a body that stayed under the
+// minimum size uncompressed
+func (cw *compressWriter) close() {
+	if cw.pending {
+		cw.pending = false
+		cw.Header().Set("Content-Length", strconv.Itoa(len(cw.buf)))
+		cw.send()
+		if _, err := cw.ResponseWriter.Write(cw.buf); err != nil {
+			slog.Debug("Failed to write response body", "error", err)
+		}
+		return
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Close(); err != nil {
+			slog.Debug("Failed to finish compressed response", "encoding", cw.encoding, "error", err)
+		}
+		putEncoder(cw.encoding, cw.enc)
+		cw.enc = nil
+	}
+}
+
+// WithCompressedVariants caches compressed copies of files served from the
+// cache, keyed by encoding, so popular files aren't compressed on every
+// request. Other responses are left to CompressionMiddleware.
+func WithCompressedVariants(cfg CompressionConfig) Option {
+	return func(h *FileHandler) {
+		h.variants = &cfg
+	}
+}
+
+// compressedVariant returns data encoded for the client from the cache,
+// compressing and caching it on a miss, and marks the response as encoded.
+// Variants are matched to the file by ETag, so files without one are left
+// to CompressionMiddleware.
+func (h *FileHandler) compressedVariant(ctx context.Context, w http.ResponseWriter, r *http.Request, filename string, data []byte, meta cache.EntryMeta) ([]byte, bool) {
+	header := w.Header()
+	if meta.ETag == "" || len(data) < h.variants.MinSize || header.Get("Content-Encoding") != "" || !h.variants.compressible(header.Get("Content-Type")) {
+		return nil, false
+	}
+	encoding := h.variants.negotiate(r)
+	if encoding == "" {
+		addVary(header, "Accept-Encoding")
+		return nil, false
+	}
+
+	key := cache.VariantKey(filename, encoding)
+	entry, found, err := h.getCached(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read compressed variant", "filename", filename, "encoding", encoding, "error", err)
+	}
+
+	var encoded []byte
+	if found && entry.Meta.ETag == meta.ETag {
+		encoded = entry.Data
+	} else {
+		if encoded, err = encode(encoding, data); err != nil {
+			slog.WarnContext(ctx, "Failed to compress file", "filename", filename, "encoding", encoding, "error", err)
+			return nil, false
+		}
+		go h.storeVariant(ctx, filename, key, encoded, meta)
+	}
+
+	setContentEncoding(header, encoding)
+	return encoded, true
+}
+
+// storeVariant caches data derived from filename, such as a compressed
+// copy, and registers it so it is purged along with the file
+func (h *FileHandler) storeVariant(ctx context.Context, filename, key string, encoded []byte, meta cache.EntryMeta) {
+	h.metrics.CacheAsyncWrites.Inc()
+	defer h.metrics.CacheAsyncWrites.Dec()
+	ctx, cancel := h.requestContext(context.WithoutCancel(ctx))
+	defer cancel()
+
+	variantMeta := cache.EntryMeta{ETag: meta.ETag, ContentType: meta.ContentType, TTL: meta.TTL}
+	if err := h.storeCached(ctx, key, encoded, variantMeta); err != nil {
+		if !errors.Is(err, cache.ErrTombstoned) {
+			slog.WarnContext(ctx, "Failed to cache variant", "key", key, "error", err)
+		}
+		return
+	}
+	if idx, ok := h.cache.(cache.VariantIndex); ok {
+		if err := idx.AddVariant(ctx, filename, key); err != nil {
+			slog.WarnContext(ctx, "Failed to index variant", "key", key, "error", err)
+		}
+	}
+}
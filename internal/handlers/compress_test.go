@@ -0,0 +1,193 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case handlers.EncodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Invalid gzip body: %v", err)
+		}
+		r = gr
+	case handlers.EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to decompress %s body: %v", encoding, err)
+	}
+	return string(data)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"name":"file.txt"},`, 200)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = io.WriteString(w, large)
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"ok":true}`)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, large)
+		case "/encoded":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = io.WriteString(w, large)
+		}
+	})
+	handler := handlers.CompressionMiddleware(handlers.DefaultCompressionConfig(), next)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantVary       bool
+	}{
+		{"brotli preferred", "/json", "gzip, deflate, br", "br", true},
+		{"gzip only", "/json", "gzip", "gzip", true},
+		{"quality ordering", "/json", "br;q=0.5, gzip", "gzip", true},
+		{"refused encoding", "/json", "br;q=0, gzip;q=0", "", true},
+		{"wildcard", "/json", "*", "br", true},
+		{"no accept-encoding", "/json", "", "", true},
+		{"below minimum size", "/small", "gzip", "", true},
+		{"incompressible type", "/image", "gzip", "", false},
+		{"already encoded", "/encoded", "br", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if got := rec.Header().Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+				t.Errorf("Expected Vary: Accept-Encoding %v, got %q", tt.wantVary, rec.Header().Get("Vary"))
+			}
+			if tt.path == "/json" && tt.wantEncoding != "" {
+				if got := decompress(t, tt.wantEncoding, rec.Body.Bytes()); got != large {
+					t.Errorf("Decompressed body doesn't match, got %d bytes", len(got))
+				}
+				if got := rec.Header().Get("ETag"); got != `W/"v1"` {
+					t.Errorf("Expected a weakened ETag, got %q", got)
+				}
+			}
+			if tt.path == "/small" && rec.Body.String() != `{"ok":true}` {
+				t.Errorf("Expected the small body as is, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware_FileResponse(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	content := strings.Repeat("<p>hello</p>\n", 200)
+	mockStorage.SetObject("index.html", []byte(content))
+	fileHandler := handlers.NewFileHandler(nil, mockStorage)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", fileHandler.GetFile)
+	handler := handlers.CompressionMiddleware(handlers.DefaultCompressionConfig(), mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/index.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected gzip, got %q", got)
+	}
+	if rec.Header().Get("Content-Length") != "" {
+		t.Error("Expected the uncompressed Content-Length to be dropped")
+	}
+	if got := decompress(t, "gzip", rec.Body.Bytes()); got != content {
+		t.Error("Decompressed file doesn't match")
+	}
+}
+
+func TestGetFile_CompressedVariants(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	handler := handlers.NewFileHandler(mockCache, mocks.NewMockStorage(),
+		handlers.WithCompressedVariants(handlers.DefaultCompressionConfig()),
+	)
+	content := strings.Repeat("body { color: red; }\n", 100)
+	mockCache.SetEntryData("site.css", []byte(content), cache.EntryMeta{ETag: `"v1"`})
+	key := cache.VariantKey("site.css", "br")
+
+	rec := getFile(handler, "site.css", map[string]string{"Accept-Encoding": "br"})
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Expected br, got %q", got)
+	}
+	if got := decompress(t, "br", rec.Body.Bytes()); got != content {
+		t.Error("Decompressed file doesn't match")
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Expected Content-Length of the compressed body, got %s", got)
+	}
+
+	// The variant is cached in the background and registered for purges
+	deadline := time.Now().Add(time.Second)
+	for {
+		if variants, _ := mockCache.Variants(context.Background(), "site.css"); len(variants) == 1 && variants[0] == key {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the variant to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Later hits are served from the variant
+	mockCache.SetEntryData(key, []byte("cached variant"), cache.EntryMeta{ETag: `"v1"`})
+	rec = getFile(handler, "site.css", map[string]string{"Accept-Encoding": "br"})
+	if rec.Body.String() != "cached variant" {
+		t.Errorf("Expected the cached variant, got %q", rec.Body.String())
+	}
+
+	// A variant of an older version is replaced
+	mockCache.SetEntryData("site.css", []byte(content), cache.EntryMeta{ETag: `"v2"`})
+	rec = getFile(handler, "site.css", map[string]string{"Accept-Encoding": "br"})
+	if got := decompress(t, "br", rec.Body.Bytes()); got != content {
+		t.Error("Expected a stale variant to be recompressed")
+	}
+
+	// Clients that don't accept an encoding get the file as is
+	rec = getFile(handler, "site.css", nil)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != content {
+		t.Error("Expected an uncompressed response without Accept-Encoding")
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// genericContentTypes are stored content types that say nothing about the
+// file, so the one derived from its name is used instead
+var genericContentTypes = map[string]bool{
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+}
+
+// objectContentType returns the content type stored with an object, or the
+// one implied by its filename when none or only a generic one was stored
+func objectContentType(filename string, meta cache.EntryMeta) string {
+	if meta.ContentType == "" || genericContentTypes[strings.ToLower(meta.ContentType)] {
+		return contentTypeFor(filename)
+	}
+	return meta.ContentType
+}
+
+// notModified reports whether a GET or HEAD request's preconditions show the
+// client already holds this version of the file. If-None-Match takes
+// precedence over If-Modified-Since, as in RFC 9110.
+func notModified(r *http.Request, meta cache.EntryMeta) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, meta.ETag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || meta.LastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(meta.LastModified)
+	return err == nil && !modified.After(since)
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for to a
+// comma-separated list of entity tags
+func etagMatches(list, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified sends a 304, dropping the headers that describe a body
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
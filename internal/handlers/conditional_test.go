@@ -0,0 +1,155 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+const testLastModified = "Tue, 02 Jan 2024 03:04:05 GMT"
+
+// getFile requests target, a file name optionally followed by a query
+func getFile(handler *handlers.FileHandler, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/files/"+target, nil)
+	name, _, _ := strings.Cut(target, "?")
+	req.SetPathValue("name", name)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler.GetFile(rec, req)
+	return rec
+}
+
+func TestGetFile_CachedMetadata(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	mockStorage.SetObject("report", []byte("%PDF"))
+	mockStorage.SetObjectHeaders("report", http.Header{
+		"Content-Type":  {"application/pdf"},
+		"Etag":          {`"v1"`},
+		"Last-Modified": {testLastModified},
+	})
+
+	check := func(rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+			t.Errorf("Expected stored Content-Type, got %q", got)
+		}
+		if got := rec.Header().Get("ETag"); got != `"v1"` {
+			t.Errorf("Expected ETag \"v1\", got %q", got)
+		}
+		if got := rec.Header().Get("Last-Modified"); got != testLastModified {
+			t.Errorf("Expected Last-Modified %q, got %q", testLastModified, got)
+		}
+	}
+
+	check(getFile(handler, "report", nil))
+
+	// The cache is written in the background
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, found, _ := mockCache.Get(context.Background(), "report"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the file to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mockStorage.ClearObjects()
+	rec := getFile(handler, "report", nil)
+	if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusHit {
+		t.Fatalf("Expected a cache hit, got %q", got)
+	}
+	check(rec)
+}
+
+func TestGetFile_ConditionalRequests(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	handler := handlers.NewFileHandler(mockCache, mocks.NewMockStorage())
+	if err := mockCache.SetEntry(context.Background(), "a.txt", []byte("hello"), cache.EntryMeta{
+		ETag:         `"abc"`,
+		LastModified: testLastModified,
+	}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": `"xyz", W/"abc"`}, http.StatusNotModified},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `"old"`}, http.StatusOK},
+		{"etag takes precedence", map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": testLastModified}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": testLastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Mon, 01 Jan 2024 00:00:00 GMT"}, http.StatusOK},
+		{"unconditional", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getFile(handler, "a.txt", tt.headers)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusNotModified {
+				if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+					t.Errorf("Expected an empty 304, got body %q and Content-Type %q", rec.Body.String(), rec.Header().Get("Content-Type"))
+				}
+				if got := rec.Header().Get("ETag"); got != `"abc"` {
+					t.Errorf("Expected the 304 to carry the ETag, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetFile_GenericStoredContentType(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(nil, mockStorage)
+	mockStorage.SetObject("page.html", []byte("<p>"))
+	mockStorage.SetObjectHeaders("page.html", http.Header{"Content-Type": {"binary/octet-stream"}})
+
+	if got := getFile(handler, "page.html", nil).Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Expected the content type derived from the name, got %q", got)
+	}
+}
+
+func TestGetFile_ObjectTTL(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	mockStorage.SetObject("report", []byte("v1"))
+	mockStorage.SetObjectHeaders("report", http.Header{"X-Amz-Meta-Cache-Ttl": {"3600"}})
+	getFile(handler, "report", nil)
+	waitForCached(t, mockCache, "report", "v1")
+
+	entry, _, _ := mockCache.GetEntry(context.Background(), "report")
+	if entry.Meta.TTL != time.Hour {
+		t.Errorf("Expected the object's TTL to be cached with it, got %s", entry.Meta.TTL)
+	}
+
+	// An entry past its own TTL is refetched even if the cache still holds it
+	mockCache.SetEntryData("report", []byte("v1"), cache.EntryMeta{TTL: time.Nanosecond})
+	mockStorage.SetObject("report", []byte("v2"))
+	rec := getFile(handler, "report", nil)
+	if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusMiss {
+		t.Errorf("Expected a cache miss for an expired entry, got %q", got)
+	}
+	if rec.Body.String() != "v2" {
+		t.Errorf("Expected the refetched file, got %q", rec.Body.String())
+	}
+}
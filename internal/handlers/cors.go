@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins lists origins such as https://app.example.com; "*"
+	// allows every origin and https://*.example.com its subdomains
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders lists request headers preflights may ask for; "*"
+	// allows whatever is asked
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers scripts may read beyond the
+	// safelisted ones
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+	// AllowCredentials lets requests carry cookies, basic auth and client
+	// certificates
+	AllowCredentials bool
+}
+
+// DefaultCORSConfig returns the CORS settings used for those not
+// configured. No origin is allowed by default.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{http.MethodGet, http.MethodHead},
+		AllowedHeaders: []string{
+			"Authorization",
+			"Range",
+			"If-Match",
+			"If-None-Match",
+			"If-Modified-Since",
+			"If-Range",
+			"X-Request-ID",
+		},
+		ExposedHeaders: []string{
+			"Accept-Ranges",
+			"Content-Range",
+			"Content-Disposition",
+			"ETag",
+			"X-Cache",
+			"X-Request-ID",
+		},
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+// allowsOrigin reports whether origin may make cross-origin requests
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.example.com matches any subdomain, not the domain itself
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			rest, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if found && strings.HasSuffix(rest, "."+strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CORSMiddleware adds CORS headers to responses for allowed origins and
+// answers their preflight requests itself, since the routes don't accept
+// OPTIONS. Requests from other origins are served without the headers, so
+// browsers keep scripts from reading the responses.
+func CORSMiddleware(cfg CORSConfig, next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	anyHeader := slices.Contains(cfg.AllowedHeaders, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		// Responses differ by origin unless every origin gets the same "*"
+		if !anyOrigin || cfg.AllowCredentials {
+			h.Add("Vary", "Origin")
+		}
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !cfg.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if anyOrigin && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", methods)
+			if anyHeader {
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+			} else if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
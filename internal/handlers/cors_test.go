@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+func serveCORS(cfg handlers.CORSConfig, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+	rec := httptest.NewRecorder()
+	handlers.CORSMiddleware(cfg, next).ServeHTTP(rec, req)
+	return rec, called
+}
+
+func TestCORSMiddleware_Origins(t *testing.T) {
+	cfg := handlers.DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://app.example.com", "https://*.preview.example.com"}
+
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{origin: "https://app.example.com", want: "https://app.example.com"},
+		{origin: "https://pr-12.preview.example.com", want: "https://pr-12.preview.example.com"},
+		{origin: "https://preview.example.com"},
+		{origin: "http://app.example.com"},
+		{origin: "https://evil.com"},
+		{origin: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec, called := serveCORS(cfg, req)
+
+			if !called {
+				t.Fatal("Expected the request to be served")
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.want, got)
+			}
+			if (rec.Header().Get("Access-Control-Expose-Headers") != "") != (tt.want != "") {
+				t.Errorf("Expected exposed headers only for allowed origins, got %q", rec.Header().Get("Access-Control-Expose-Headers"))
+			}
+			if rec.Header().Get("Vary") != "Origin" {
+				t.Errorf("Expected Vary: Origin, got %q", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_AnyOrigin(t *testing.T) {
+	cfg := handlers.DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"*"}
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	rec, _ := serveCORS(cfg, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin *, got %q", got)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "" {
+		t.Errorf("Expected no Vary for a response shared by every origin, got %q", vary)
+	}
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	cfg := handlers.DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://app.example.com"}
+	cfg.AllowCredentials = true
+
+	req := httptest.NewRequest(http.MethodOptions, "/files/a.txt", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "range")
+	rec, called := serveCORS(cfg, req)
+
+	if called {
+		t.Error("Expected the preflight not to reach the routes")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	req.Header.Set("Origin", "https://evil.com")
+	rec, called = serveCORS(cfg, req)
+	if called || rec.Code != http.StatusNoContent {
+		t.Errorf("Expected a bare 204 for a disallowed origin, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS headers for a disallowed origin, got %q", got)
+	}
+}
+
+func TestCORSMiddleware_AnyHeader(t *testing.T) {
+	cfg := handlers.DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://app.example.com"}
+	cfg.AllowedHeaders = []string{"*"}
+
+	req := httptest.NewRequest(http.MethodOptions, "/files/a.txt", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "x-custom, range")
+	rec, _ := serveCORS(cfg, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "x-custom, range" {
+		t.Errorf("Expected the requested headers to be allowed, got %q", got)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// TransferMiddleware replaces the server's read and write timeouts with
+// timeout for routes moving file bodies, which can take far longer than
+// other requests. A zero timeout lifts both, leaving the server's header
+// read and idle timeouts to bound slow clients.
+func TransferMiddleware(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		rc := http.NewResponseController(w)
+		for _, err := range []error{rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline)} {
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				slog.DebugContext(r.Context(), "Failed to set transfer deadline", "path", r.URL.Path, "error", err)
+			}
+		}
+		next(w, r)
+	}
+}
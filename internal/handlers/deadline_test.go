@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+func TestTransferMiddleware(t *testing.T) {
+	// A response that takes longer than the server's write timeout
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /plain", slow)
+	mux.HandleFunc("GET /transfer", handlers.TransferMiddleware(5*time.Second, slow))
+	mux.HandleFunc("GET /unbounded", handlers.TransferMiddleware(0, slow))
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	get := func(path string) (string, error) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if _, err := get("/plain"); err == nil {
+		t.Error("Expected the server's write timeout to cut off other routes")
+	}
+	for _, path := range []string{"/transfer", "/unbounded"} {
+		if body, err := get(path); err != nil || body != "done" {
+			t.Errorf("GET %s = %q, %v; want the whole response", path, body, err)
+		}
+	}
+}
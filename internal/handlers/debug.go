@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+)
+
+// DebugDump lists the files written by a dump
+type DebugDump struct {
+	Goroutines string `json:"goroutines"`
+	Heap       string `json:"heap"`
+}
+
+// NewDebugHandler serves the runtime debug endpoints: net/http/pprof under
+// /debug/pprof/, expvar at /debug/vars, and POST /debug/dump, which writes
+// a goroutine and heap dump to dumpDir for retrieval after the fact
+func NewDebugHandler(dumpDir string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("POST /debug/dump", func(w http.ResponseWriter, r *http.Request) {
+		dump, err := writeDebugDump(dumpDir, time.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Debug dump failed", "dir", dumpDir, "error", err)
+			writeJSON(w, http.StatusInternalServerError, Response{
+				Success:   false,
+				Message:   "failed to write dump",
+				ErrorCode: ErrCodeInternal,
+			})
+			return
+		}
+		slog.InfoContext(r.Context(), "Wrote debug dump", "goroutines", dump.Goroutines, "heap", dump.Heap)
+		writeJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Dump written",
+			Data:    dump,
+		})
+	})
+	return mux
+}
+
+// writeDebugDump writes the stacks of every goroutine and a heap profile,
+// taken after a GC so it reflects live memory, into dir
+func writeDebugDump(dir string, now time.Time) (DebugDump, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return DebugDump{}, fmt.Errorf("failed to create dump directory: %w", err)
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+	dump := DebugDump{
+		Goroutines: filepath.Join(dir, "goroutines-"+stamp+".txt"),
+		Heap:       filepath.Join(dir, "heap-"+stamp+".pb.gz"),
+	}
+	if err := writeProfile(dump.Goroutines, "goroutine", 2); err != nil {
+		return DebugDump{}, err
+	}
+	runtime.GC()
+	if err := writeProfile(dump.Heap, "heap", 0); err != nil {
+		return DebugDump{}, err
+	}
+	return dump, nil
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s dump: %w", name, err)
+	}
+	if err := runtimepprof.Lookup(name).WriteTo(f, debug); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s dump: %w", name, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+func TestDebugHandler(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dumps")
+	handler := handlers.NewDebugHandler(dir)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/vars"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d", path, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/dump", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected dumps to require POST, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/debug/dump", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Data handlers.DebugDump `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	stacks, err := os.ReadFile(resp.Data.Goroutines)
+	if err != nil || !strings.Contains(string(stacks), "goroutine") {
+		t.Errorf("Expected goroutine stacks in %s, got %v", resp.Data.Goroutines, err)
+	}
+	if info, err := os.Stat(resp.Data.Heap); err != nil || info.Size() == 0 || filepath.Dir(resp.Data.Heap) != dir {
+		t.Errorf("Expected a heap profile in %s, got %s (%v)", dir, resp.Data.Heap, err)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// DefaultTombstoneTTL is how long a deleted file's tombstone blocks cache
+// fills. It should outlast the slowest read that can still be in flight.
+const DefaultTombstoneTTL = time.Minute
+
+// WithTombstoneTTL sets how long deleted files are kept out of the cache
+func WithTombstoneTTL(ttl time.Duration) Option {
+	return func(h *FileHandler) {
+		h.tombstoneTTL = ttl
+	}
+}
+
+// errInvalidation wraps cache failures after a file was changed in storage
+var errInvalidation = errors.New("cache invalidation failed")
+
+// DeleteFile deletes a file from storage and evicts it and its variants
+// from the cache
+func (h *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	purged, err := h.deleteFile(ctx, filename)
+	if errors.Is(err, errInvalidation) {
+		slog.ErrorContext(ctx, "Failed to invalidate deleted file", "filename", filename, "error", err)
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "File deleted but cache invalidation failed",
+			ErrorCode: ErrCodeCacheUnavailable,
+		})
+		return
+	}
+	if err != nil {
+		kind := classifyFailure(r.Context(), ctx, err)
+		if h.writeTimeoutOrCancel(ctx, w, kind, "delete", "filename", filename, "error", err) {
+			return
+		}
+		slog.ErrorContext(ctx, "Storage error", "filename", filename, "error", err)
+		if errors.Is(err, storage.ErrAccessDenied) {
+			writeJSON(w, http.StatusForbidden, Response{
+				Success:   false,
+				Message:   "Access denied",
+				ErrorCode: ErrCodeAccessDenied,
+			})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Failed to delete file",
+			ErrorCode: ErrCodeStorageError,
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "File deleted", "filename", filename, "purged", purged)
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "File deleted",
+		Data: PurgeResult{
+			Purged: purged,
+		},
+	})
+}
+
+// deleteFile deletes filename from storage and evicts it and its variants
+// from the cache. When the cache supports it, the entry is replaced by a
+// tombstone so reads that fetched the file before the delete can't cache it
+// again. Cache failures are wrapped in errInvalidation.
+func (h *FileHandler) deleteFile(ctx context.Context, filename string) (int64, error) {
+	if err := h.storage.DeleteObject(ctx, filename); err != nil {
+		return 0, err
+	}
+	h.events.Publish(ctx, events.Event{Type: events.FileDeleted, Key: filename})
+
+	h.efficiency.Forget(filename)
+	h.precompressed.forget(filename)
+	if h.cache == nil {
+		return 0, nil
+	}
+	purged, err := h.purgeKeys(ctx, filename)
+	if err == nil {
+		if t, ok := h.cache.(cache.Tombstoner); ok {
+			err = t.Tombstone(ctx, filename, h.tombstoneTTL)
+		}
+	}
+	if err != nil {
+		return purged, fmt.Errorf("%w: %w", errInvalidation, err)
+	}
+	h.metrics.CachePurgedKeysTotal.Add(float64(purged))
+	return purged, nil
+}
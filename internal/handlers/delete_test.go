@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func newDeleteMux(mockCache *mocks.MockCache, mockStorage *mocks.MockStorage) *http.ServeMux {
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", handler.GetFile)
+	mux.HandleFunc("DELETE /files/{name}", handler.DeleteFile)
+	return mux
+}
+
+func TestDeleteFile_TombstonesCacheEntry(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mux := newDeleteMux(mockCache, mockStorage)
+
+	mockStorage.SetObject("report.pdf", []byte("old"))
+	mockCache.SetData("report.pdf", []byte("old"))
+	_ = mockCache.AddVariant(context.Background(), "report.pdf", cache.VariantKey("report.pdf", "thumb"))
+	mockCache.SetData(cache.VariantKey("report.pdf", "thumb"), []byte("thumb"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/files/report.pdf", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	if len(mockStorage.DeleteCalls) != 1 || mockStorage.DeleteCalls[0] != "report.pdf" {
+		t.Errorf("Expected report.pdf to be deleted from storage, got %v", mockStorage.DeleteCalls)
+	}
+	if _, found, _ := mockCache.Get(context.Background(), cache.VariantKey("report.pdf", "thumb")); found {
+		t.Error("Expected the variant to be purged")
+	}
+	if !mockCache.Tombstoned("report.pdf") {
+		t.Fatal("Expected a tombstone for report.pdf")
+	}
+
+	// A read that fetched the file before the delete must not cache it again
+	err := mockCache.Set(context.Background(), "report.pdf", []byte("old"))
+	if !errors.Is(err, cache.ErrTombstoned) {
+		t.Errorf("Expected ErrTombstoned for a racing fill, got %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/report.pdf", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after delete, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestDeleteFile_StorageError(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.DeleteError = errors.New("boom")
+	mux := newDeleteMux(mockCache, mockStorage)
+
+	mockCache.SetData("report.pdf", []byte("cached"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/files/report.pdf", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if mockCache.Tombstoned("report.pdf") {
+		t.Error("Expected no tombstone when the delete failed")
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "report.pdf"); !found {
+		t.Error("Expected the cached file to be kept when the delete failed")
+	}
+}
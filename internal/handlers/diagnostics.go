@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/mirror"
+	"github.com/ch374n/file-downloader/internal/pipeline"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// startTime is when the process started, for reporting uptime
+var startTime = time.Now()
+
+// DiagnosticsConfig supplies the parts of the diagnostics report the admin
+// handler doesn't otherwise know about
+type DiagnosticsConfig struct {
+	// Config is the effective configuration, with secrets already redacted
+	Config any
+	// Storage is health-checked alongside the cache
+	Storage storage.Storage
+	// Mirror reports its in-flight requests; nil when mirroring is off
+	Mirror *mirror.Mirror
+	// Pipeline reports its queued uploads; nil when the pipeline is off
+	Pipeline *pipeline.Pipeline
+}
+
+// DiagnosticsReport bundles the state operators attach to incident tickets
+type DiagnosticsReport struct {
+	GeneratedAt  time.Time                   `json:"generated_at"`
+	Build        BuildInfo                   `json:"build"`
+	Config       any                         `json:"config,omitempty"`
+	LogLevel     string                      `json:"log_level"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+	Queues       map[string]int              `json:"queues"`
+	RecentErrors []logger.ErrorSample        `json:"recent_errors"`
+	// Cache is how much the cache holds, when it can report it
+	Cache *cache.Usage `json:"cache,omitempty"`
+}
+
+// BuildInfo identifies the running binary
+type BuildInfo struct {
+	GoVersion    string    `json:"go_version"`
+	Module       string    `json:"module,omitempty"`
+	Version      string    `json:"version,omitempty"`
+	Revision     string    `json:"revision,omitempty"`
+	RevisionTime string    `json:"revision_time,omitempty"`
+	Modified     bool      `json:"modified,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	Uptime       string    `json:"uptime"`
+}
+
+// DependencyHealth is the result of a single health probe
+type DependencyHealth struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// WithDiagnostics enables the diagnostics report
+func WithDiagnostics(cfg DiagnosticsConfig) AdminOption {
+	return func(h *AdminHandler) {
+		h.diagnostics = &cfg
+	}
+}
+
+// Diagnostics handles requests for a single document describing the
+// service's configuration, dependencies and recent failures. It reports
+// unhealthy dependencies rather than failing, so it stays useful during
+// an incident.
+func (h *AdminHandler) Diagnostics(w http.ResponseWriter, r *http.Request) {
+	if h.diagnostics == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "diagnostics are not configured",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeouts.Health)
+	defer cancel()
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: DiagnosticsReport{
+			GeneratedAt:  timestamp(time.Now()),
+			Build:        buildInfo(),
+			Config:       h.diagnostics.Config,
+			LogLevel:     logger.Level(),
+			Dependencies: h.probeDependencies(ctx),
+			Queues:       h.queueDepths(),
+			RecentErrors: logger.RecentErrors(),
+			Cache:        h.cacheUsage(ctx),
+		},
+	})
+}
+
+// cacheUsage reports the cache's size, or nil when the cache can't report
+// it
+func (h *AdminHandler) cacheUsage(ctx context.Context) *cache.Usage {
+	reporter, ok := h.cache.(cache.UsageReporter)
+	if !ok {
+		return nil
+	}
+	usage, err := reporter.Usage(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read cache usage", "error", err)
+		if usage.Keys == 0 && usage.Bytes == 0 {
+			return nil
+		}
+	}
+	return &usage
+}
+
+// probeDependencies health-checks the cache and storage concurrently
+func (h *AdminHandler) probeDependencies(ctx context.Context) map[string]DependencyHealth {
+	probes := map[string]func(context.Context) error{}
+	if h.cache != nil {
+		probes["redis"] = h.cache.Ping
+	}
+	if h.diagnostics.Storage != nil {
+		probes["r2"] = h.diagnostics.Storage.HealthCheck
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		health = map[string]DependencyHealth{"redis": {Status: "disabled"}}
+	)
+	for name, probe := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := probe(ctx)
+			result := DependencyHealth{Status: "healthy", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "unhealthy"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			health[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return health
+}
+
+// queueDepths reports the background work currently in progress
+func (h *AdminHandler) queueDepths() map[string]int {
+	queues := map[string]int{}
+	if h.warmJobs != nil {
+		queues["warm_jobs_running"] = h.warmJobs.Running()
+	}
+	if h.scheduler != nil {
+		running := 0
+		for _, job := range h.scheduler.Status() {
+			if job.Running {
+				running++
+			}
+		}
+		queues["scheduled_jobs_running"] = running
+	}
+	if h.diagnostics.Mirror != nil {
+		queues["mirror_in_flight"] = h.diagnostics.Mirror.InFlight()
+	}
+	if h.diagnostics.Pipeline != nil {
+		queues["upload_pipeline_queued"] = h.diagnostics.Pipeline.Queued()
+	}
+	return queues
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		GoVersion: runtime.Version(),
+		StartedAt: timestamp(startTime),
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = build.Main.Path
+	info.Version = build.Main.Version
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
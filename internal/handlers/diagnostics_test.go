@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/config"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/scheduler"
+)
+
+type diagnosticsResponse struct {
+	Success bool                       `json:"success"`
+	Data    handlers.DiagnosticsReport `json:"data"`
+}
+
+func TestDiagnostics(t *testing.T) {
+	logger.Init("error")
+	slog.Error("Storage error", "filename", "a.txt", "error", errors.New("boom"))
+
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.HealthCheckError = errors.New("bucket unreachable")
+	cfg := config.Config{AdminToken: "s3cret", R2: config.R2Config{BucketName: "files", SecretAccessKey: "key"}}
+	handler := handlers.NewAdminHandler(mocks.NewMockCache(),
+		handlers.WithScheduler(scheduler.New()),
+		handlers.WithDiagnostics(handlers.DiagnosticsConfig{
+			Config:  cfg.Redacted(),
+			Storage: mockStorage,
+		}),
+	)
+
+	rec := httptest.NewRecorder()
+	handler.Diagnostics(rec, httptest.NewRequest(http.MethodGet, "/admin/diagnostics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var resp diagnosticsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	report := resp.Data
+
+	if got := report.Dependencies["redis"].Status; got != "healthy" {
+		t.Errorf("Expected healthy redis, got %q", got)
+	}
+	if r2 := report.Dependencies["r2"]; r2.Status != "unhealthy" || r2.Error != "bucket unreachable" {
+		t.Errorf("Expected unhealthy r2 with its error, got %+v", r2)
+	}
+	if _, ok := report.Queues["scheduled_jobs_running"]; !ok {
+		t.Errorf("Expected scheduler queue depth, got %v", report.Queues)
+	}
+	if report.Build.GoVersion == "" {
+		t.Error("Expected build info to include the Go version")
+	}
+
+	body := rec.Body.String()
+	for _, secret := range []string{"s3cret", `"key"`} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Expected %s to be redacted from %s", secret, body)
+		}
+	}
+
+	if len(report.RecentErrors) == 0 || report.RecentErrors[0].Message != "Storage error" {
+		t.Fatalf("Expected the logged error to be sampled, got %+v", report.RecentErrors)
+	}
+	if got := report.RecentErrors[0].Attrs["error"]; got != "boom" {
+		t.Errorf("Expected error attribute boom, got %q", got)
+	}
+}
+
+func TestDiagnostics_CacheUsage(t *testing.T) {
+	diskCache, err := cache.NewDiskCache(cache.DiskConfig{Dir: t.TempDir(), MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to create disk cache: %v", err)
+	}
+	if err := diskCache.Set(context.Background(), "a.txt", []byte("hello")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	handler := handlers.NewAdminHandler(diskCache, handlers.WithDiagnostics(handlers.DiagnosticsConfig{}))
+
+	rec := httptest.NewRecorder()
+	handler.Diagnostics(rec, httptest.NewRequest(http.MethodGet, "/admin/diagnostics", nil))
+
+	var resp diagnosticsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if usage := resp.Data.Cache; usage == nil || usage.Keys != 1 || usage.Bytes != diskCache.Size() {
+		t.Errorf("Expected the disk cache usage, got %+v", usage)
+	}
+}
+
+func TestDiagnostics_NotConfigured(t *testing.T) {
+	handler := handlers.NewAdminHandler(nil)
+
+	rec := httptest.NewRecorder()
+	handler.Diagnostics(rec, httptest.NewRequest(http.MethodGet, "/admin/diagnostics", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
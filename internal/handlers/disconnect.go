@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// Outcomes of the storage fetches whose client disconnected
+const (
+	disconnectCanceled  = "canceled"
+	disconnectCompleted = "completed"
+)
+
+// WithDisconnectGrace keeps fetching a file from storage for up to grace
+// after its client disconnects, so a nearly complete fetch still fills the
+// cache and the client's retry is a hit. Fetches are otherwise canceled
+// with their request.
+func WithDisconnectGrace(grace time.Duration) Option {
+	return func(h *FileHandler) {
+		h.disconnectGrace = grace
+	}
+}
+
+// fetchContext returns the context a storage fetch for a request runs in.
+// ctx carries the request deadline and clientCtx is the incoming request
+// context; with a disconnect grace, the fetch outlives clientCtx by up to
+// the grace, never past the deadline. release must be called once the
+// fetch is done.
+func (h *FileHandler) fetchContext(clientCtx, ctx context.Context) (fetchCtx context.Context, release func()) {
+	if h.disconnectGrace <= 0 {
+		return ctx, func() {}
+	}
+	parent, cancelDeadline := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+	if deadline, ok := ctx.Deadline(); ok {
+		parent, cancelDeadline = context.WithDeadline(parent, deadline)
+	}
+	fetchCtx, cancel := context.WithCancel(parent)
+	grace := h.disconnectGrace
+	stop := context.AfterFunc(clientCtx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return fetchCtx, func() {
+		stop()
+		cancel()
+		cancelDeadline()
+	}
+}
@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestGetFile_ClientDisconnect(t *testing.T) {
+	disconnect := func(grace time.Duration) (*mocks.MockCache, *metrics.Metrics, *httptest.ResponseRecorder) {
+		mockStorage := mocks.NewMockStorage()
+		mockStorage.SetObject("video.mp4", []byte("content"))
+		mockStorage.GetDelay = 50 * time.Millisecond
+		mockCache := mocks.NewMockCache()
+		m := metrics.New(prometheus.NewRegistry())
+		handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithMetrics(m), handlers.WithDisconnectGrace(grace))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		req := httptest.NewRequest(http.MethodGet, "/files/video.mp4", nil).WithContext(ctx)
+		req.SetPathValue("name", "video.mp4")
+		rec := httptest.NewRecorder()
+		handler.GetFile(rec, req)
+		return mockCache, m, rec
+	}
+
+	// Without a grace the fetch is canceled along with the request
+	mockCache, m, rec := disconnect(0)
+	if rec.Code != handlers.StatusClientClosedRequest {
+		t.Errorf("Expected status %d, got %d", handlers.StatusClientClosedRequest, rec.Code)
+	}
+	if got := testutil.ToFloat64(m.ClientDisconnectsTotal.WithLabelValues("canceled")); got != 1 {
+		t.Errorf("Expected 1 canceled fetch, got %v", got)
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "video.mp4"); found {
+		t.Error("Expected a canceled fetch not to be cached")
+	}
+
+	// Within the grace the fetch completes and fills the cache
+	mockCache, m, rec = disconnect(time.Second)
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected nothing written to the disconnected client, got %q", rec.Body.String())
+	}
+	if got := testutil.ToFloat64(m.ClientDisconnectsTotal.WithLabelValues("completed")); got != 1 {
+		t.Errorf("Expected 1 completed fetch, got %v", got)
+	}
+	waitForCached(t, mockCache, "video.mp4", "content")
+}
@@ -0,0 +1,30 @@
+package handlers
+
+// ErrorCode is a machine-readable error identifier returned in the
+// error_code field of failed responses. Codes are stable; messages are not.
+type ErrorCode string
+
+// Error taxonomy. Clients should branch on these codes rather than on HTTP
+// status or message text.
+const (
+	// Request problems (4xx)
+	ErrCodeInvalidRequest  ErrorCode = "INVALID_REQUEST"   // Malformed parameters or body
+	ErrCodeFileNotFound    ErrorCode = "FILE_NOT_FOUND"    // Object does not exist in storage
+	ErrCodeAccessDenied    ErrorCode = "ACCESS_DENIED"     // Rejected by policy or storage permissions
+	ErrCodeUnauthorized    ErrorCode = "UNAUTHORIZED"      // Missing or invalid credentials
+	ErrCodePayloadTooLarge ErrorCode = "PAYLOAD_TOO_LARGE" // Request or object exceeds a size limit
+	ErrCodeConflict        ErrorCode = "CONFLICT"          // Request conflicts with current state
+	ErrCodeNotFound        ErrorCode = "NOT_FOUND"         // Non-file resource (e.g. a signing key) does not exist
+	ErrCodeTooManyRequests ErrorCode = "TOO_MANY_REQUESTS" // A concurrency or rate limit was reached; retry later
+	ErrCodeQuotaExceeded   ErrorCode = "QUOTA_EXCEEDED"    // The write would exceed a storage quota
+	ErrCodeBadDigest       ErrorCode = "BAD_DIGEST"        // The body does not match its Content-MD5 or checksum header
+
+	// Dependency and server problems (5xx)
+	ErrCodeRequestTimeout   ErrorCode = "REQUEST_TIMEOUT"   // The service's own deadline expired
+	ErrCodeStorageTimeout   ErrorCode = "STORAGE_TIMEOUT"   // Storage did not respond in time
+	ErrCodeStorageError     ErrorCode = "STORAGE_ERROR"     // Storage returned an unexpected error
+	ErrCodeCacheUnavailable ErrorCode = "CACHE_UNAVAILABLE" // Cache is disabled or failing
+	ErrCodeFeatureDisabled  ErrorCode = "FEATURE_DISABLED"  // Endpoint is not enabled in this deployment
+	ErrCodeServiceUnhealthy ErrorCode = "SERVICE_UNHEALTHY" // A required dependency is down
+	ErrCodeInternal         ErrorCode = "INTERNAL_ERROR"    // Unexpected server-side failure
+)
@@ -0,0 +1,25 @@
+package handlers
+
+import "github.com/ch374n/file-downloader/internal/events"
+
+// APIs reported with file reads to event sinks
+const (
+	apiHTTP   = "http"
+	apiGRPC   = "grpc"
+	apiS3     = "s3"
+	apiWebDAV = "webdav"
+)
+
+// WithEvents publishes file reads, uploads, deletes and cache misses to b
+func WithEvents(b *events.Bus) Option {
+	return func(h *FileHandler) {
+		h.events = b
+	}
+}
+
+// WithAdminEvents publishes cache purges to b
+func WithAdminEvents(b *events.Bus) AdminOption {
+	return func(h *AdminHandler) {
+		h.events = b
+	}
+}
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// eventRecorder is an event sink recording the events it receives
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *eventRecorder) Name() string { return "record" }
+
+func (r *eventRecorder) Send(ctx context.Context, e events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestFileEvents(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	recorder := &eventRecorder{}
+	bus, err := events.New(events.Config{}, recorder)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithEvents(bus))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", h.GetFile)
+	mux.HandleFunc("DELETE /files/{name}", h.DeleteFile)
+
+	mockStorage.SetObject("miss.txt", []byte("from storage"))
+	mockCache.SetData("hit.txt", []byte("from cache"))
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/files/miss.txt", nil),
+		httptest.NewRequest(http.MethodGet, "/files/hit.txt", nil),
+		httptest.NewRequest(http.MethodDelete, "/files/miss.txt", nil),
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d: %s", req.Method, req.URL.Path, rec.Code, rec.Body.String())
+		}
+	}
+
+	admin := handlers.NewAdminHandler(mockCache, handlers.WithAdminEvents(bus))
+	if rec, _ := doPurge(t, admin, `{"prefix": "reports/"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected purge to succeed, got %d", rec.Code)
+	}
+
+	if _, err := putFile(withToken("write-token"), newGRPCClient(t, h, 0), "up.txt", []byte("uploaded"), 4); err != nil {
+		t.Fatalf("PutFile failed: %v", err)
+	}
+	bus.Close(context.Background())
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	got := make(map[events.Type][]events.Event)
+	for _, e := range recorder.events {
+		got[e.Type] = append(got[e.Type], e)
+	}
+	if e := got[events.CacheMiss]; len(e) != 1 || e[0].Key != "miss.txt" || e[0].Size != 12 {
+		t.Errorf("Expected one cache miss for miss.txt, got %+v", e)
+	}
+	if e := got[events.FileDeleted]; len(e) != 1 || e[0].Key != "miss.txt" {
+		t.Errorf("Expected miss.txt to be deleted, got %+v", e)
+	}
+	if e := got[events.CachePurged]; len(e) != 1 || e[0].Prefix != "reports/" {
+		t.Errorf("Expected a purge of reports/, got %+v", e)
+	}
+	if e := got[events.FileAccessed]; len(e) != 2 || e[0].Key != "miss.txt" || e[0].Served != "storage" ||
+		e[1].Key != "hit.txt" || e[1].Served != "cache" || e[1].Source != "http" || e[1].Size != 10 {
+		t.Errorf("Expected reads of miss.txt from storage and hit.txt from cache, got %+v", e)
+	}
+	if e := got[events.FileUploaded]; len(e) != 1 || e[0].Key != "up.txt" || e[0].Source != "grpc" || e[0].Size != 8 {
+		t.Errorf("Expected the gRPC upload, got %+v", e)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// StatusClientClosedRequest is the nginx-style status recorded when the
+// client goes away before a response is written. It is never seen by the
+// client; it only keeps aborted requests out of the 5xx error budget.
+const StatusClientClosedRequest = 499
+
+// failureKind classifies why a dependency call failed
+type failureKind string
+
+const (
+	failureClientCanceled  failureKind = "client_canceled"  // Client disconnected or canceled
+	failureServerTimeout   failureKind = "server_timeout"   // Our own request deadline expired
+	failureUpstreamTimeout failureKind = "upstream_timeout" // The dependency timed out on its own
+	failureError           failureKind = "error"            // Any other failure
+)
+
+// classifyFailure decides whether err was caused by the client, by our
+// request deadline, or by the dependency. clientCtx is the incoming request
+// context and opCtx the derived context carrying the handler deadline.
+func classifyFailure(clientCtx, opCtx context.Context, err error) failureKind {
+	if errors.Is(clientCtx.Err(), context.Canceled) {
+		return failureClientCanceled
+	}
+	if errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+		return failureServerTimeout
+	}
+
+	var netErr net.Error
+	if errors.Is(err, storage.ErrTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return failureUpstreamTimeout
+	}
+	return failureError
+}
+
+// writeTimeoutOrCancel handles the cancellation and timeout failure kinds and
+// reports whether it wrote a response. Other failures are left to the caller.
+func (h *FileHandler) writeTimeoutOrCancel(ctx context.Context, w http.ResponseWriter, kind failureKind, operation string, logAttrs ...any) bool {
+	switch kind {
+	case failureClientCanceled:
+		h.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.InfoContext(ctx, "Client canceled request", logAttrs...)
+		w.WriteHeader(StatusClientClosedRequest)
+		return true
+	case failureServerTimeout:
+		h.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.WarnContext(ctx, "Request deadline exceeded", logAttrs...)
+		writeJSON(w, http.StatusGatewayTimeout, Response{
+			Success:   false,
+			Message:   "Request timeout",
+			ErrorCode: ErrCodeRequestTimeout,
+		})
+		return true
+	case failureUpstreamTimeout:
+		h.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.WarnContext(ctx, "Storage timed out", logAttrs...)
+		writeJSON(w, http.StatusGatewayTimeout, Response{
+			Success:   false,
+			Message:   "Storage timeout",
+			ErrorCode: ErrCodeStorageTimeout,
+		})
+		return true
+	}
+	return false
+}
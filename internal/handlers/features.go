@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/features"
+)
+
+// Feature override headers. The applied overrides are echoed back so callers
+// can confirm they took effect.
+const (
+	HeaderFeatureOverride        = "X-Feature-Override"
+	HeaderFeatureOverrideApplied = "X-Feature-Override-Applied"
+)
+
+// FeatureOverrides applies the X-Feature-Override header (see
+// features.Parse) to requests authorized by a signed URL or by an admin
+// credential with the features:override scope. Other callers' overrides are
+// ignored; malformed overrides from trusted callers are rejected.
+func FeatureOverrides(authn *auth.Authenticator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		spec := r.Header.Get(HeaderFeatureOverride)
+		if spec == "" {
+			next(w, r)
+			return
+		}
+
+		if !hasSignedAccess(r.Context()) {
+			cred, ok := requestCredential(authn, r)
+			if !ok || !cred.Allows(auth.ScopeFeaturesOverride) {
+				slog.InfoContext(r.Context(), "Ignoring feature override from untrusted caller", "path", r.URL.Path)
+				next(w, r)
+				return
+			}
+		}
+
+		overrides, err := features.Parse(spec)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Success:   false,
+				Message:   err.Error(),
+				ErrorCode: ErrCodeInvalidRequest,
+			})
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Applying feature overrides", "overrides", overrides.String())
+		w.Header().Set(HeaderFeatureOverrideApplied, overrides.String())
+		next(w, r.WithContext(features.WithOverrides(r.Context(), overrides)))
+	}
+}
@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func newFeatureOverrideMux(mockCache *mocks.MockCache, mockStorage *mocks.MockStorage) *http.ServeMux {
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "canary", Token: "canary-token", Scopes: []auth.Scope{auth.ScopeFeaturesOverride}},
+		auth.Credential{Name: "ops", Token: "ops-token", Scopes: []auth.Scope{auth.ScopeCachePurge}},
+	)
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", handlers.FeatureOverrides(authn, handler.GetFile))
+	return mux
+}
+
+func TestFeatureOverrides_BypassesCacheForTrustedCaller(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockCache.SetData("a.txt", []byte("cached"))
+	mockStorage.SetObject("a.txt", []byte("fresh"))
+	mux := newFeatureOverrideMux(mockCache, mockStorage)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+	req.Header.Set("Authorization", "Bearer canary-token")
+	req.Header.Set(handlers.HeaderFeatureOverride, "cache-read=off,cache-fill=off")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Body.String() != "fresh" {
+		t.Errorf("Expected the file from storage, got %q", rec.Body.String())
+	}
+	if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusBypass {
+		t.Errorf("Expected X-Cache %s, got %q", handlers.CacheStatusBypass, got)
+	}
+	if got := rec.Header().Get(handlers.HeaderFeatureOverrideApplied); got != "cache-fill=off,cache-read=off" {
+		t.Errorf("Expected the applied overrides to be echoed, got %q", got)
+	}
+	if len(mockCache.SetCalls) != 0 {
+		t.Errorf("Expected no cache fill, got %d writes", len(mockCache.SetCalls))
+	}
+}
+
+func TestFeatureOverrides_IgnoredWithoutScope(t *testing.T) {
+	for _, token := range []string{"", "ops-token", "wrong"} {
+		mockCache := mocks.NewMockCache()
+		mockCache.SetData("a.txt", []byte("cached"))
+		mux := newFeatureOverrideMux(mockCache, mocks.NewMockStorage())
+
+		req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set(handlers.HeaderFeatureOverride, "cache-read=off")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Body.String() != "cached" {
+			t.Errorf("token %q: expected the cached file, got %q", token, rec.Body.String())
+		}
+		if got := rec.Header().Get(handlers.HeaderFeatureOverrideApplied); got != "" {
+			t.Errorf("token %q: expected no overrides applied, got %q", token, got)
+		}
+	}
+}
+
+func TestFeatureOverrides_RejectsInvalidOverride(t *testing.T) {
+	mux := newFeatureOverrideMux(mocks.NewMockCache(), mocks.NewMockStorage())
+
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+	req.Header.Set("X-Admin-Token", "canary-token")
+	req.Header.Set(handlers.HeaderFeatureOverride, "warp-drive=on")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
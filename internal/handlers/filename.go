@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// errInvalidFilename is returned for names rejected by FilenameRules
+var errInvalidFilename = errors.New("invalid filename")
+
+// FilenameRules restricts the file names requests may use. Names are
+// always rejected when they are empty, absolute, not UTF-8, contain
+// control characters or have a "." or ".." segment, whatever the rules.
+type FilenameRules struct {
+	// MaxLength caps names in bytes; 0 means no limit
+	MaxLength int
+	// Pattern, when set, must match the whole name
+	Pattern *regexp.Regexp
+}
+
+// WithFilenameRules sets the rules file names are checked against
+func WithFilenameRules(rules FilenameRules) Option {
+	return func(h *FileHandler) {
+		h.filenames = rules
+	}
+}
+
+// Check returns an error wrapping errInvalidFilename when name breaks the
+// rules
+func (rules FilenameRules) Check(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s", errInvalidFilename, reason)
+	}
+	switch {
+	case name == "":
+		return invalid("name is empty")
+	case !utf8.ValidString(name):
+		return invalid("name is not valid UTF-8")
+	case rules.MaxLength > 0 && len(name) > rules.MaxLength:
+		return invalid(fmt.Sprintf("name is longer than %d bytes", rules.MaxLength))
+	case strings.HasPrefix(name, "/"), strings.HasPrefix(name, `\`), len(name) >= 2 && name[1] == ':' && isASCIILetter(name[0]):
+		return invalid("name is an absolute path")
+	case strings.ContainsFunc(name, unicode.IsControl):
+		return invalid("name contains control characters")
+	}
+	for _, segment := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == "." || segment == ".." {
+			return invalid(`name contains a "." or ".." segment`)
+		}
+	}
+	if rules.Pattern != nil && !rules.Pattern.MatchString(name) {
+		return invalid("name doesn't match the allowed pattern")
+	}
+	return nil
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// pathFilename returns the {name} path value of r, writing a 400 when it
+// breaks the filename rules
+func (h *FileHandler) pathFilename(w http.ResponseWriter, r *http.Request) (string, bool) {
+	filename := r.PathValue("name")
+	if err := h.filenames.Check(filename); err != nil {
+		writeInvalidFilename(w, r, filename, err)
+		return "", false
+	}
+	return filename, true
+}
+
+func writeInvalidFilename(w http.ResponseWriter, r *http.Request, filename string, err error) {
+	// %q keeps control characters out of the log line
+	slog.InfoContext(r.Context(), "Rejected filename", "filename", fmt.Sprintf("%q", filename), "error", err)
+	writeJSON(w, http.StatusBadRequest, Response{
+		Success:   false,
+		Message:   err.Error(),
+		ErrorCode: ErrCodeInvalidRequest,
+	})
+}
+
+// contentDisposition formats a Content-Disposition header for the base
+// name of filename. Characters that could break out of the quoted string
+// are replaced in filename, and names that aren't plain ASCII are also
+// sent percent-encoded as filename* (RFC 6266).
+func contentDisposition(disposition, filename string) string {
+	name := path.Base(filename)
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range name {
+		switch {
+		case r > unicode.MaxASCII:
+			ascii = false
+			fallback.WriteByte('_')
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	value := disposition + `; filename="` + fallback.String() + `"`
+	if !ascii {
+		value += "; filename*=UTF-8''" + encodeAttrValue(name)
+	}
+	return value
+}
+
+// encodeAttrValue percent-encodes s as an RFC 8187 ext-value, leaving only
+// attr-chars as they are
+func encodeAttrValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isASCIILetter(c) || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	return b.String()
+}
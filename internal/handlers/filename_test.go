@@ -0,0 +1,105 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestFilenameRules_Check(t *testing.T) {
+	rules := handlers.FilenameRules{MaxLength: 20, Pattern: regexp.MustCompile(`^(?:[\w./ -]+)$`)}
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "report.pdf", valid: true},
+		{name: "docs/2024/q1.pdf", valid: true},
+		{name: "..hidden", valid: true},
+		{name: ""},
+		{name: "../etc/passwd"},
+		{name: "docs/../../etc"},
+		{name: `docs\..\secret`},
+		{name: "./report.pdf"},
+		{name: "/etc/passwd"},
+		{name: `C:\Windows`},
+		{name: "a\r\nSet-Cookie: x"},
+		{name: "nul\x00byte"},
+		{name: "bad\xffutf8"},
+		{name: strings.Repeat("a", 21)},
+		{name: "semi;colon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.Check(tt.name)
+			if tt.valid != (err == nil) {
+				t.Errorf("Expected valid %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestGetFile_InvalidFilename(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/..%2Fsecret", nil)
+	req.SetPathValue("name", "../secret")
+	rec := httptest.NewRecorder()
+
+	handler.GetFile(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	if len(mockStorage.GetCalls) != 0 {
+		t.Error("Expected storage not to be called")
+	}
+}
+
+func TestDeleteFile_InvalidFilename(t *testing.T) {
+	handler := handlers.NewFileHandler(nil, mocks.NewMockStorage(),
+		handlers.WithFilenameRules(handlers.FilenameRules{Pattern: regexp.MustCompile(`^[a-z.]+$`)}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/files/Report.pdf", nil)
+	req.SetPathValue("name", "Report.pdf")
+	rec := httptest.NewRecorder()
+
+	handler.DeleteFile(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestGetFile_ContentDispositionEscaped(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: `a"; attachment; x="y.txt`, want: `inline; filename="a_; attachment; x=_y.txt"`},
+		{name: "docs/report.pdf", want: `inline; filename="report.pdf"`},
+		{name: "résumé.pdf", want: `inline; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := mocks.NewMockStorage()
+			handler := handlers.NewFileHandler(nil, mockStorage)
+			mockStorage.SetObject(tt.name, []byte("data"))
+
+			req := httptest.NewRequest(http.MethodGet, "/files/x", nil)
+			req.SetPathValue("name", tt.name)
+			rec := httptest.NewRecorder()
+
+			handler.GetFile(rec, req)
+
+			if got := rec.Header().Get("Content-Disposition"); got != tt.want {
+				t.Errorf("Expected Content-Disposition %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
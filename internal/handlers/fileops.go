@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// File operations shared by the gRPC, S3 and WebDAV APIs, which have no redirects,
+// signed URLs or content negotiation to fit in around them
+
+// errPolicyDenied is returned for names covered by a deny policy
+var errPolicyDenied = errors.New("access denied by policy")
+
+// fileRead is a file read through the cache
+type fileRead struct {
+	data []byte
+	meta cache.EntryMeta
+	// status is one of the CacheStatus values
+	status string
+	// age is how long ago the file was cached, on hits
+	age time.Duration
+}
+
+// Sources of served file bytes, for the response_bytes_total metric
+const (
+	sourceCache   = "cache"
+	sourceStorage = "storage"
+)
+
+// source reports whether the file was served from the cache or storage
+func (f *fileRead) source() string {
+	if f.status == CacheStatusHit || f.status == CacheStatusStale {
+		return sourceCache
+	}
+	return sourceStorage
+}
+
+// countingWriter counts the body bytes written through it
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countServed records n bytes of filename sent to a client through api
+// from source, and announces the read to event sinks
+func (h *FileHandler) countServed(ctx context.Context, filename, api, source string, n int64) {
+	if n > 0 {
+		h.metrics.ResponseBytesTotal.WithLabelValues(source).Add(float64(n))
+	}
+	h.events.Publish(ctx, events.Event{Type: events.FileAccessed, Key: filename, Size: n, Source: api, Served: source})
+}
+
+// writeReadFailure writes the response for a file that couldn't be read
+// for operation
+func (h *FileHandler) writeReadFailure(clientCtx, ctx context.Context, w http.ResponseWriter, operation, filename string, err error) {
+	kind := classifyFailure(clientCtx, ctx, err)
+	if h.writeTimeoutOrCancel(ctx, w, kind, operation, "filename", filename, "error", err) {
+		return
+	}
+	slog.ErrorContext(ctx, "Storage error", "filename", filename, "error", err)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, Response{
+			Success:   false,
+			Message:   "File not found",
+			ErrorCode: ErrCodeFileNotFound,
+		})
+	case errors.Is(err, storage.ErrAccessDenied):
+		writeJSON(w, http.StatusForbidden, Response{
+			Success:   false,
+			Message:   "Access denied",
+			ErrorCode: ErrCodeAccessDenied,
+		})
+	default:
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Failed to retrieve file",
+			ErrorCode: ErrCodeStorageError,
+		})
+	}
+}
+
+// fileStat describes a file without its content
+type fileStat struct {
+	size   int64
+	meta   cache.EntryMeta
+	cached bool
+}
+
+// resolveName checks a requested name against the filename rules, maps it
+// to its canonical case and checks it against the deny policies
+func (h *FileHandler) resolveName(ctx context.Context, filename, method string) (string, error) {
+	if err := h.filenames.Check(filename); err != nil {
+		return "", err
+	}
+	if h.caseIndex != nil && features.Enabled(ctx, features.CaseInsensitiveKeys, true) {
+		if canonical, ok := h.caseIndex.Resolve(filename); ok && canonical != filename {
+			slog.InfoContext(ctx, "Resolved canonical name", "filename", filename, "canonical", canonical)
+			filename = canonical
+		}
+	}
+	if h.policy.Denied(&policy.Request{Name: filename, Method: method}) {
+		slog.InfoContext(ctx, "Request denied by policy", "filename", filename)
+		return "", errPolicyDenied
+	}
+	return filename, nil
+}
+
+// readThrough returns filename from the cache, or from storage on a miss,
+// filling the cache in the background. refresh skips the cache lookup.
+// clientCtx is the incoming request context and ctx carries the deadline.
+func (h *FileHandler) readThrough(clientCtx, ctx context.Context, filename string, refresh bool) (*fileRead, error) {
+	h.hotkeys.Observe(filename)
+	if h.cache != nil {
+		h.prefetcher.Observe(ctx, filename, h.prefetchFile)
+	}
+
+	status := CacheStatusBypass
+	unlock := unlocked
+	switch {
+	case h.cache == nil, !features.Enabled(ctx, features.CacheRead, true):
+		slog.InfoContext(ctx, "Cache bypassed, fetching from storage", "filename", filename)
+	case refresh:
+		slog.InfoContext(ctx, "Refresh requested, fetching from storage", "filename", filename)
+		status = CacheStatusRefresh
+	default:
+		start := time.Now()
+		entry, found, err := h.getCached(ctx, filename)
+		h.metrics.CacheOperationDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+		if err != nil {
+			slog.ErrorContext(ctx, "Cache error", "filename", filename, "error", err)
+		}
+		status = CacheStatusHit
+		if !found {
+			var waited *cache.Entry
+			if waited, status, unlock = h.awaitFill(ctx, filename); waited != nil {
+				entry, found = waited, true
+			}
+		}
+		if found {
+			h.metrics.CacheHitsTotal.Inc()
+			h.efficiency.Hit(filename, int64(len(entry.Data)))
+			slog.InfoContext(ctx, "Cache "+status, "filename", filename)
+			return &fileRead{data: entry.Data, meta: entry.Meta, status: status, age: entry.Age}, nil
+		}
+		h.metrics.CacheMissesTotal.Inc()
+		slog.InfoContext(ctx, "Cache MISS", "filename", filename)
+		status = CacheStatusMiss
+	}
+
+	data, meta, fromLegacy, err := h.fetchWithFallback(clientCtx, ctx, filename)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	if status == CacheStatusMiss {
+		h.efficiency.Miss(filename, int64(len(data)))
+		h.events.Publish(ctx, events.Event{Type: events.CacheMiss, Key: filename, Size: int64(len(data))})
+	}
+	h.fillCache(ctx, http.MethodGet, filename, data, meta, fromLegacy, unlock)
+	return &fileRead{data: data, meta: meta, status: status}, nil
+}
+
+// statFile describes filename from its cache entry, or else from storage,
+// without fetching its content when the backend allows it
+func (h *FileHandler) statFile(clientCtx, ctx context.Context, filename string) (*fileStat, error) {
+	if h.cache != nil && features.Enabled(ctx, features.CacheRead, true) {
+		entry, found, err := h.getCached(ctx, filename)
+		if err != nil {
+			slog.ErrorContext(ctx, "Cache error", "filename", filename, "error", err)
+		}
+		if found {
+			return &fileStat{size: int64(len(entry.Data)), meta: entry.Meta, cached: true}, nil
+		}
+	}
+
+	if stater, ok := h.storage.(storage.HeaderStater); ok {
+		headers, err := stater.StatObject(ctx, filename)
+		if err == nil {
+			size, _ := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+			return &fileStat{size: size, meta: cache.MetaFromHeaders(headers)}, nil
+		}
+		// Files not yet migrated are only found by fetching them
+		if !errors.Is(err, storage.ErrNotFound) || h.legacy == nil || !h.legacy.Covers(filename) {
+			return nil, err
+		}
+	}
+
+	data, meta, _, err := h.fetchWithFallback(clientCtx, ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return &fileStat{size: int64(len(data)), meta: meta}, nil
+}
+
+// fetchWithFallback reads filename from storage, falling back to the legacy
+// origin for files not yet migrated, and records the same metrics as GetFile
+func (h *FileHandler) fetchWithFallback(clientCtx, ctx context.Context, filename string) ([]byte, cache.EntryMeta, bool, error) {
+	start := time.Now()
+	data, meta, err := h.fetchObject(ctx, filename)
+	h.metrics.R2RequestDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+
+	if errors.Is(err, storage.ErrNotFound) && h.legacy != nil && h.legacy.Covers(filename) {
+		h.metrics.R2RequestsTotal.WithLabelValues("get", string(failureError)).Inc()
+		data, meta, err = h.fetchLegacy(ctx, filename)
+		return data, meta, true, err
+	}
+	if err != nil {
+		h.metrics.R2RequestsTotal.WithLabelValues("get", string(classifyFailure(clientCtx, ctx, err))).Inc()
+		return nil, cache.EntryMeta{}, false, err
+	}
+	h.metrics.R2RequestsTotal.WithLabelValues("get", "success").Inc()
+	return data, meta, false, nil
+}
+
+// listPage lists one page of the objects under prefix and records the same
+// metrics as ListFiles
+func (h *FileHandler) listPage(clientCtx, ctx context.Context, prefix, token string, limit int) (*storage.ListResult, error) {
+	start := time.Now()
+	page, err := h.storage.ListObjects(ctx, prefix, token, limit)
+	h.metrics.R2RequestDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+	if err != nil {
+		h.metrics.R2RequestsTotal.WithLabelValues("list", string(classifyFailure(clientCtx, ctx, err))).Inc()
+		return nil, err
+	}
+	h.metrics.R2RequestsTotal.WithLabelValues("list", "success").Inc()
+	return page, nil
+}
+
+// invalidate evicts filename and its variants from the cache after it was
+// written to storage. Cache failures are wrapped in errInvalidation.
+func (h *FileHandler) invalidate(ctx context.Context, filename string) (int64, error) {
+	h.precompressed.forget(filename)
+	if h.cache == nil {
+		return 0, nil
+	}
+	purged, err := h.purgeKeys(ctx, filename)
+	if err != nil {
+		return purged, fmt.Errorf("%w: %w", errInvalidation, err)
+	}
+	h.metrics.CachePurgedKeysTotal.Add(float64(purged))
+	return purged, nil
+}
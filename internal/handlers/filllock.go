@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// fillLockPolls is how many times a replica checks the cache while waiting
+// for another replica to fill it
+const fillLockPolls = 20
+
+// WithFillLock makes replicas take l before fetching a missed file from
+// storage, holding it for up to ttl until the file is cached. Replicas that
+// find the lock held serve the expired entry if one is left, or else wait up
+// to wait for the file to be cached before fetching it themselves.
+func WithFillLock(l cache.FillLock, ttl, wait time.Duration) Option {
+	return func(h *FileHandler) {
+		h.fillLock = l
+		h.fillLockTTL = ttl
+		h.fillLockWait = wait
+	}
+}
+
+// unlocked is the release of a fill lock that wasn't taken
+func unlocked() {}
+
+// awaitFill is called after filename missed the cache. It returns the
+// entry to serve and its cache status when another replica is fetching the
+// file, or else the release of the lock this replica took, to call once the
+// file is cached.
+func (h *FileHandler) awaitFill(ctx context.Context, filename string) (*cache.Entry, string, func()) {
+	if h.fillLock == nil {
+		return nil, "", unlocked
+	}
+	unlock, ok, err := h.fillLock.TryLock(ctx, filename, h.fillLockTTL)
+	if err != nil {
+		h.metrics.CacheFillLocksTotal.WithLabelValues("error").Inc()
+		slog.WarnContext(ctx, "Fill lock failed, fetching from storage", "filename", filename, "error", err)
+		return nil, "", unlocked
+	}
+	if ok {
+		h.metrics.CacheFillLocksTotal.WithLabelValues("acquired").Inc()
+		return nil, "", unlock
+	}
+
+	if entry := h.expiredEntry(ctx, filename); entry != nil {
+		h.metrics.CacheFillLocksTotal.WithLabelValues("stale").Inc()
+		slog.InfoContext(ctx, "File being fetched by another replica, serving expired entry", "filename", filename)
+		return entry, CacheStatusStale, unlocked
+	}
+
+	slog.InfoContext(ctx, "File being fetched by another replica, waiting", "filename", filename)
+	ticker := time.NewTicker(max(h.fillLockWait/fillLockPolls, time.Millisecond))
+	defer ticker.Stop()
+	timeout := time.NewTimer(h.fillLockWait)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, "", unlocked
+		case <-timeout.C:
+			h.metrics.CacheFillLocksTotal.WithLabelValues("timeout").Inc()
+			slog.InfoContext(ctx, "Gave up waiting for another replica, fetching from storage", "filename", filename)
+			return nil, "", unlocked
+		case <-ticker.C:
+		}
+		if entry, found, _ := h.getCached(ctx, filename); found {
+			h.metrics.CacheFillLocksTotal.WithLabelValues("waited").Inc()
+			return entry, CacheStatusHit, unlocked
+		}
+		// The holder gave up without caching the file, so fetch it here
+		if unlock, ok, err := h.fillLock.TryLock(ctx, filename, h.fillLockTTL); err == nil && ok {
+			h.metrics.CacheFillLocksTotal.WithLabelValues("acquired").Inc()
+			return nil, "", unlock
+		}
+	}
+}
+
+// expiredEntry returns filename's cache entry if it outlived its object's
+// TTL but is still stored
+func (h *FileHandler) expiredEntry(ctx context.Context, filename string) *cache.Entry {
+	entries, ok := h.cache.(cache.EntryCache)
+	if !ok {
+		return nil
+	}
+	entry, found, err := entries.GetEntry(ctx, filename)
+	if err != nil || !found || !entry.Expired() {
+		return nil
+	}
+	return entry
+}
@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// fakeFillLock is a fill lock whose holder the test controls
+type fakeFillLock struct {
+	mu       sync.Mutex
+	held     bool
+	released chan struct{}
+}
+
+func (l *fakeFillLock) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held {
+		return nil, false, nil
+	}
+	l.held = true
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.held = false
+			l.mu.Unlock()
+			close(l.released)
+		})
+	}, true, nil
+}
+
+func TestFillLock(t *testing.T) {
+	getFile := func(h *handlers.FileHandler) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /files/{name}", h.GetFile)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/cold.txt", nil))
+		return rec
+	}
+
+	t.Run("holder fetches and releases once cached", func(t *testing.T) {
+		mockCache, mockStorage := mocks.NewMockCache(), mocks.NewMockStorage()
+		mockStorage.SetObject("cold.txt", []byte("from storage"))
+		lock := &fakeFillLock{released: make(chan struct{})}
+		h := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithFillLock(lock, time.Minute, time.Second))
+
+		if rec := getFile(h); rec.Header().Get(handlers.HeaderCache) != handlers.CacheStatusMiss {
+			t.Fatalf("Expected a miss, got %q", rec.Header().Get(handlers.HeaderCache))
+		}
+		select {
+		case <-lock.released:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the lock to be released")
+		}
+		if _, found, _ := mockCache.Get(context.Background(), "cold.txt"); !found {
+			t.Error("Expected the file to be cached before the lock was released")
+		}
+	})
+
+	t.Run("waits for another replica", func(t *testing.T) {
+		mockCache, mockStorage := mocks.NewMockCache(), mocks.NewMockStorage()
+		mockStorage.SetObject("cold.txt", []byte("from storage"))
+		lock := &fakeFillLock{held: true}
+		h := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithFillLock(lock, time.Minute, 5*time.Second))
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			mockCache.SetData("cold.txt", []byte("from replica"))
+		}()
+		rec := getFile(h)
+		if rec.Body.String() != "from replica" || rec.Header().Get(handlers.HeaderCache) != handlers.CacheStatusHit {
+			t.Errorf("Expected the file another replica cached, got %q with %q", rec.Body.String(), rec.Header().Get(handlers.HeaderCache))
+		}
+		if len(mockStorage.GetCalls) != 0 {
+			t.Errorf("Expected no storage fetch, got %v", mockStorage.GetCalls)
+		}
+	})
+
+	t.Run("serves an expired entry", func(t *testing.T) {
+		mockCache, mockStorage := mocks.NewMockCache(), mocks.NewMockStorage()
+		mockStorage.SetObject("cold.txt", []byte("from storage"))
+		mockCache.SetEntryData("cold.txt", []byte("expired"), cache.EntryMeta{TTL: time.Second})
+		mockCache.SetDataWithAge("cold.txt", []byte("expired"), time.Minute)
+		lock := &fakeFillLock{held: true}
+		h := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithFillLock(lock, time.Minute, 5*time.Second))
+
+		rec := getFile(h)
+		if rec.Body.String() != "expired" || rec.Header().Get(handlers.HeaderCache) != handlers.CacheStatusStale {
+			t.Errorf("Expected the expired entry, got %q with %q", rec.Body.String(), rec.Header().Get(handlers.HeaderCache))
+		}
+	})
+
+	t.Run("fetches after waiting too long", func(t *testing.T) {
+		mockCache, mockStorage := mocks.NewMockCache(), mocks.NewMockStorage()
+		mockStorage.SetObject("cold.txt", []byte("from storage"))
+		lock := &fakeFillLock{held: true}
+		h := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithFillLock(lock, time.Minute, 20*time.Millisecond))
+
+		if rec := getFile(h); rec.Body.String() != "from storage" {
+			t.Errorf("Expected the file from storage, got %q", rec.Body.String())
+		}
+	})
+}
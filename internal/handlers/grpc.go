@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	filecachev1 "github.com/ch374n/file-downloader/api/filecache/v1"
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// DefaultGRPCChunkSize is the size of the chunks GetFile streams files in
+const DefaultGRPCChunkSize = 64 * 1024
+
+// FileService serves the gRPC FileService API from a FileHandler's cache and
+// storage, so both APIs see the same files. Reads are public like their HTTP
+// counterparts; PutFile and DeleteFile need the files:write scope.
+type FileService struct {
+	filecachev1.UnimplementedFileServiceServer
+
+	files     *FileHandler
+	authn     *auth.Authenticator
+	chunkSize int
+}
+
+// NewFileService creates a FileService backed by files. Writes are
+// authorized against authn; a chunkSize of zero uses DefaultGRPCChunkSize.
+func NewFileService(files *FileHandler, authn *auth.Authenticator, chunkSize int) *FileService {
+	if chunkSize <= 0 {
+		chunkSize = DefaultGRPCChunkSize
+	}
+	return &FileService{files: files, authn: authn, chunkSize: chunkSize}
+}
+
+// grpcCacheStatus maps cache status header values to their enum; expired
+// entries served while another replica fetches the file are hits
+var grpcCacheStatus = map[string]filecachev1.CacheStatus{
+	CacheStatusHit:     filecachev1.CacheStatus_CACHE_STATUS_HIT,
+	CacheStatusStale:   filecachev1.CacheStatus_CACHE_STATUS_HIT,
+	CacheStatusMiss:    filecachev1.CacheStatus_CACHE_STATUS_MISS,
+	CacheStatusBypass:  filecachev1.CacheStatus_CACHE_STATUS_BYPASS,
+	CacheStatusRefresh: filecachev1.CacheStatus_CACHE_STATUS_REFRESH,
+}
+
+// GetFile streams a file, reading through the cache like GET /files/{name}
+func (s *FileService) GetFile(req *filecachev1.GetFileRequest, stream grpc.ServerStreamingServer[filecachev1.GetFileResponse]) error {
+	h := s.files
+	clientCtx := stream.Context()
+	ctx, cancel := withDefaultTimeout(clientCtx, h.timeouts.Request)
+	defer cancel()
+
+	filename, err := s.resolve(ctx, req.GetName(), http.MethodGet)
+	if err != nil {
+		return err
+	}
+
+	if req.GetRefresh() && h.refreshAuth != nil {
+		cred, ok := h.refreshAuth.Authenticate(grpcToken(ctx))
+		if !ok || !cred.Allows(auth.ScopeCachePurge) {
+			return status.Error(codes.PermissionDenied, errRefreshForbidden.Error())
+		}
+	}
+
+	file, err := h.readThrough(clientCtx, ctx, filename, req.GetRefresh())
+	if err != nil {
+		return s.fail(clientCtx, ctx, "get", err, "filename", filename)
+	}
+	sent, err := s.sendFile(stream, &filecachev1.GetFileHeader{
+		Info:        h.protoFileInfo(filename, int64(len(file.data)), file.meta),
+		CacheStatus: grpcCacheStatus[file.status],
+		AgeSeconds:  int64(file.age.Seconds()),
+	}, file.data)
+	h.countServed(ctx, filename, apiGRPC, file.source(), sent)
+	return err
+}
+
+// sendFile streams header followed by data in chunks, and returns the
+// number of data bytes sent
+func (s *FileService) sendFile(stream grpc.ServerStreamingServer[filecachev1.GetFileResponse], header *filecachev1.GetFileHeader, data []byte) (int64, error) {
+	if err := stream.Send(&filecachev1.GetFileResponse{
+		Part: &filecachev1.GetFileResponse_Header{Header: header},
+	}); err != nil {
+		return 0, err
+	}
+	var sent int64
+	for len(data) > 0 {
+		n := min(len(data), s.chunkSize)
+		if err := stream.Send(&filecachev1.GetFileResponse{
+			Part: &filecachev1.GetFileResponse_Chunk{Chunk: data[:n]},
+		}); err != nil {
+			return sent, err
+		}
+		sent += int64(n)
+		data = data[n:]
+	}
+	return sent, nil
+}
+
+// PutFile stores a streamed file and evicts the previous version from the
+// cache. Files up to the multipart part size are stored in one request;
+// larger ones are uploaded part by part as they arrive, so at most one part
+// is held in memory.
+func (s *FileService) PutFile(stream grpc.ClientStreamingServer[filecachev1.PutFileRequest, filecachev1.PutFileResponse]) error {
+	h := s.files
+	clientCtx := stream.Context()
+	ctx, cancel := withDefaultTimeout(clientCtx, h.timeouts.Request)
+	defer cancel()
+
+	ctx, err := s.requireScope(ctx, auth.ScopeFilesWrite)
+	if err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return status.Error(codes.InvalidArgument, "header is required")
+	}
+	if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil || header.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "the first message must be a header naming the file")
+	}
+	if err := h.filenames.Check(header.GetName()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	upload := &grpcUpload{
+		storage:     h.storage,
+		name:        header.GetName(),
+		contentType: header.GetContentType(),
+		partSize:    h.partSize,
+		timeout:     h.timeouts.Request,
+	}
+	if upload.contentType == "" {
+		upload.contentType = contentTypeFor(upload.name)
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err == nil && msg.GetHeader() != nil {
+			err = status.Error(codes.InvalidArgument, "only the first message may be a header")
+		}
+		if err == nil {
+			err = upload.write(ctx, msg.GetChunk())
+		}
+		if err != nil {
+			upload.abort(ctx)
+			return s.fail(clientCtx, ctx, "put", err, "filename", upload.name)
+		}
+	}
+	if err := upload.close(ctx); err != nil {
+		upload.abort(ctx)
+		return s.fail(clientCtx, ctx, "put", err, "filename", upload.name)
+	}
+
+	purged, err := h.invalidate(ctx, upload.name)
+	if err != nil {
+		return s.fail(clientCtx, ctx, "put", err, "filename", upload.name)
+	}
+
+	slog.InfoContext(ctx, "File stored", "filename", upload.name, "size", upload.size, "parts", len(upload.parts), "purged", purged)
+	h.processUpload(ctx, upload.name, upload.size, upload.contentType, uploadSourceGRPC)
+	return stream.SendAndClose(&filecachev1.PutFileResponse{Name: upload.name, Size: upload.size, Purged: purged})
+}
+
+// grpcUpload writes a streamed file to storage, switching to a multipart
+// upload once it outgrows a single part
+type grpcUpload struct {
+	storage     storage.Storage
+	name        string
+	contentType string
+	partSize    int64
+	// timeout bounds aborting an unfinished upload
+	timeout time.Duration
+
+	buf      []byte
+	size     int64
+	uploader storage.MultipartUploader
+	uploadID string
+	parts    []storage.UploadedPart
+}
+
+// write buffers chunk, uploading the buffer as a part each time it fills.
+// A full buffer is only uploaded once more data arrives, so a file of
+// exactly one part is still stored in a single request.
+func (u *grpcUpload) write(ctx context.Context, chunk []byte) error {
+	for len(chunk) > 0 {
+		if int64(len(u.buf)) == u.partSize {
+			if err := u.flush(ctx); err != nil {
+				return err
+			}
+		}
+		n := min(int64(len(chunk)), u.partSize-int64(len(u.buf)))
+		u.buf = append(u.buf, chunk[:n]...)
+		u.size += n
+		chunk = chunk[n:]
+	}
+	return nil
+}
+
+// flush uploads the buffer as the next part, starting the multipart upload
+// on the first call
+func (u *grpcUpload) flush(ctx context.Context) error {
+	if u.uploader == nil {
+		uploader, ok := u.storage.(storage.MultipartUploader)
+		if !ok {
+			return status.Errorf(codes.ResourceExhausted, "files over %d bytes need a storage backend that supports multipart uploads", u.partSize)
+		}
+		id, err := uploader.CreateMultipartUpload(ctx, u.name, u.contentType, nil)
+		if err != nil {
+			return err
+		}
+		u.uploader, u.uploadID = uploader, id
+	}
+	if len(u.parts) == maxUploadParts {
+		return status.Errorf(codes.ResourceExhausted, "files may have at most %d parts of %d bytes", maxUploadParts, u.partSize)
+	}
+
+	part, err := u.uploader.UploadPart(ctx, u.name, u.uploadID, int32(len(u.parts)+1), bytes.NewReader(u.buf), int64(len(u.buf)))
+	if err != nil {
+		return err
+	}
+	u.parts = append(u.parts, *part)
+	u.buf = u.buf[:0]
+	return nil
+}
+
+// close stores what is left of the file
+func (u *grpcUpload) close(ctx context.Context) error {
+	if u.uploader == nil {
+		return u.storage.PutObject(ctx, u.name, bytes.NewReader(u.buf), u.contentType)
+	}
+	if len(u.buf) > 0 {
+		if err := u.flush(ctx); err != nil {
+			return err
+		}
+	}
+	return u.uploader.CompleteMultipartUpload(ctx, u.name, u.uploadID, u.parts)
+}
+
+// abort discards the parts of an unfinished multipart upload. It runs
+// detached from ctx, which is usually canceled by then.
+func (u *grpcUpload) abort(ctx context.Context) {
+	if u.uploader == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), u.timeout)
+	defer cancel()
+	if err := u.uploader.AbortMultipartUpload(ctx, u.name, u.uploadID); err != nil {
+		slog.WarnContext(ctx, "Failed to abort multipart upload", "filename", u.name, "upload_id", u.uploadID, "error", err)
+	}
+}
+
+// DeleteFile deletes a file like DELETE /files/{name}
+func (s *FileService) DeleteFile(ctx context.Context, req *filecachev1.DeleteFileRequest) (*filecachev1.DeleteFileResponse, error) {
+	clientCtx := ctx
+	ctx, cancel := withDefaultTimeout(ctx, s.files.timeouts.Request)
+	defer cancel()
+
+	ctx, err := s.requireScope(ctx, auth.ScopeFilesWrite)
+	if err != nil {
+		return nil, err
+	}
+	filename := req.GetName()
+	if filename == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := s.files.filenames.Check(filename); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	purged, err := s.files.deleteFile(ctx, filename)
+	if err != nil {
+		return nil, s.fail(clientCtx, ctx, "delete", err, "filename", filename)
+	}
+	slog.InfoContext(ctx, "File deleted", "filename", filename, "purged", purged)
+	return &filecachev1.DeleteFileResponse{Purged: purged}, nil
+}
+
+// StatFile returns a file's metadata. Cached files are described from their
+// cache entry; others are looked up in storage, without fetching their
+// content when the backend allows it.
+func (s *FileService) StatFile(ctx context.Context, req *filecachev1.StatFileRequest) (*filecachev1.StatFileResponse, error) {
+	clientCtx := ctx
+	ctx, cancel := withDefaultTimeout(ctx, s.files.timeouts.Request)
+	defer cancel()
+
+	filename, err := s.resolve(ctx, req.GetName(), http.MethodHead)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := s.files.statFile(clientCtx, ctx, filename)
+	if err != nil {
+		return nil, s.fail(clientCtx, ctx, "stat", err, "filename", filename)
+	}
+	return &filecachev1.StatFileResponse{
+		Info:   s.files.protoFileInfo(filename, stat.size, stat.meta),
+		Cached: stat.cached,
+	}, nil
+}
+
+// ListFiles lists files one page at a time like GET /files. Page tokens are
+// interchangeable with the HTTP API's cursors.
+func (s *FileService) ListFiles(ctx context.Context, req *filecachev1.ListFilesRequest) (*filecachev1.ListFilesResponse, error) {
+	h := s.files
+	clientCtx := ctx
+	ctx, cancel := withDefaultTimeout(ctx, h.timeouts.Request)
+	defer cancel()
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit < 1 || limit > maxListLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxListLimit)
+	}
+	cursor, err := parseListCursor(req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	start := time.Now()
+	result, err := h.storage.ListObjects(ctx, req.GetPrefix(), cursor.Token, min(cursor.Skip+limit, maxListLimit))
+	h.metrics.R2RequestDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+	if err != nil {
+		h.metrics.R2RequestsTotal.WithLabelValues("list", string(classifyFailure(clientCtx, ctx, err))).Inc()
+		return nil, s.fail(clientCtx, ctx, "list", err, "prefix", req.GetPrefix())
+	}
+	h.metrics.R2RequestsTotal.WithLabelValues("list", "success").Inc()
+
+	objects := result.Objects[min(cursor.Skip, len(result.Objects)):]
+	resp := &filecachev1.ListFilesResponse{
+		Files:         make([]*filecachev1.FileInfo, 0, len(objects)),
+		NextPageToken: result.NextToken,
+	}
+	for _, obj := range objects {
+		resp.Files = append(resp.Files, &filecachev1.FileInfo{
+			Name:         obj.Key,
+			Size:         obj.Size,
+			LastModified: timestamppb.New(obj.LastModified),
+		})
+	}
+	return resp, nil
+}
+
+// resolve validates a requested name, maps it to its canonical case and
+// checks it against the deny policies
+func (s *FileService) resolve(ctx context.Context, filename, method string) (string, error) {
+	if filename == "" {
+		return "", status.Error(codes.InvalidArgument, "name is required")
+	}
+	filename, err := s.files.resolveName(ctx, filename, method)
+	if errors.Is(err, errInvalidFilename) {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return "", status.Error(codes.PermissionDenied, "access denied")
+	}
+	return filename, nil
+}
+
+// requireScope authorizes the call's credential for scope, returning ctx
+// carrying the credential. Without configured credentials writes are
+// disabled, as on the HTTP API.
+func (s *FileService) requireScope(ctx context.Context, scope auth.Scope) (context.Context, error) {
+	if !s.authn.Enabled() {
+		return ctx, status.Error(codes.PermissionDenied, "admin API is disabled")
+	}
+	cred, ok := s.authn.Authenticate(grpcToken(ctx))
+	if !ok {
+		return ctx, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	if !cred.Allows(scope) {
+		slog.WarnContext(ctx, "Admin credential lacks scope", "credential", cred.Name, "scope", scope)
+		return ctx, status.Errorf(codes.PermissionDenied, "credential lacks the %s scope", scope)
+	}
+	return auth.WithCredential(ctx, cred), nil
+}
+
+// fail converts a failed call's error to a gRPC status, recording aborts
+// like writeTimeoutOrCancel. Errors that already are statuses pass through.
+func (s *FileService) fail(clientCtx, ctx context.Context, operation string, err error, logAttrs ...any) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, errInvalidation) {
+		slog.ErrorContext(ctx, "Failed to invalidate cache", append(logAttrs, "error", err)...)
+		return status.Error(codes.Unavailable, "file changed but cache invalidation failed")
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.InfoContext(ctx, "Rejected write over quota", append(logAttrs, "error", err)...)
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	logAttrs = append(logAttrs, "error", err)
+	kind := classifyFailure(clientCtx, ctx, err)
+	switch kind {
+	case failureClientCanceled:
+		s.files.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.InfoContext(ctx, "Client canceled request", logAttrs...)
+		return status.Error(codes.Canceled, "request canceled")
+	case failureServerTimeout:
+		s.files.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.WarnContext(ctx, "Request deadline exceeded", logAttrs...)
+		return status.Error(codes.DeadlineExceeded, "request timeout")
+	case failureUpstreamTimeout:
+		s.files.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.WarnContext(ctx, "Storage timed out", logAttrs...)
+		return status.Error(codes.Unavailable, "storage timeout")
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, "file not found")
+	case errors.Is(err, storage.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, storage.ErrInvalidPart):
+		return status.Error(codes.InvalidArgument, "upload parts were rejected by storage")
+	}
+	slog.ErrorContext(ctx, "Storage error", logAttrs...)
+	return status.Error(codes.Internal, "storage error")
+}
+
+// protoFileInfo describes a file with its metadata as a FileInfo
+func (h *FileHandler) protoFileInfo(filename string, size int64, meta cache.EntryMeta) *filecachev1.FileInfo {
+	info := &filecachev1.FileInfo{
+		Name:        filename,
+		Size:        size,
+		ContentType: objectContentType(filename, meta),
+		Etag:        meta.ETag,
+		Headers:     h.passthroughHeaders(meta.Headers),
+	}
+	if modified, err := http.ParseTime(meta.LastModified); err == nil {
+		info.LastModified = timestamppb.New(modified)
+	}
+	return info
+}
+
+// withDefaultTimeout bounds ctx by d unless the client set its own deadline
+func withDefaultTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// grpcToken returns the admin token carried as bearer authorization
+// metadata or in x-admin-token
+func grpcToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return token
+		}
+	}
+	if values := md.Get("x-admin-token"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// GRPCServerOptions returns interceptors that give every call a request ID,
+// taken from x-request-id metadata when valid, and a retry budget, and
+// record the call in m and the log
+func GRPCServerOptions(m *metrics.Metrics, budget retrybudget.Config) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx = grpcRequestContext(ctx, budget)
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			recordGRPCCall(ctx, m, info.FullMethod, start, err)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx := grpcRequestContext(ss.Context(), budget)
+			start := time.Now()
+			err := handler(srv, &grpcServerStream{ServerStream: ss, ctx: ctx})
+			recordGRPCCall(ctx, m, info.FullMethod, start, err)
+			return err
+		}),
+	}
+}
+
+// grpcRequestContext attaches the call's request ID and retry budget to ctx
+// and echoes the ID in the response header
+func grpcRequestContext(ctx context.Context, budget retrybudget.Config) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(HeaderRequestID); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(HeaderRequestID, id))
+	ctx = retrybudget.WithBudget(ctx, retrybudget.New(budget))
+	return logger.WithRequestID(ctx, id)
+}
+
+func recordGRPCCall(ctx context.Context, m *metrics.Metrics, method string, start time.Time, err error) {
+	duration := time.Since(start).Seconds()
+	code := status.Code(err)
+	m.GRPCRequestsTotal.WithLabelValues(method, code.String()).Inc()
+	m.GRPCRequestDuration.WithLabelValues(method).Observe(duration)
+
+	slog.InfoContext(ctx, "Request completed",
+		"method", method,
+		"code", code.String(),
+		"duration_ms", duration*1000,
+	)
+}
+
+// grpcServerStream overrides the context of a server stream
+type grpcServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,352 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	filecachev1 "github.com/ch374n/file-downloader/api/filecache/v1"
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// newGRPCClient serves a FileService for h over an in-memory connection
+func newGRPCClient(t *testing.T, h *handlers.FileHandler, chunkSize int) filecachev1.FileServiceClient {
+	t.Helper()
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "writer", Token: "write-token", Scopes: []auth.Scope{auth.ScopeFilesWrite}},
+		auth.Credential{Name: "reader", Token: "read-token", Scopes: []auth.Scope{auth.ScopeReportsRead}},
+	)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(handlers.GRPCServerOptions(metrics.Noop(), retrybudget.Config{})...)
+	filecachev1.RegisterFileServiceServer(server, handlers.NewFileService(h, authn, chunkSize))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return filecachev1.NewFileServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// streamFile reads a GetFile stream into its header and content
+func streamFile(t *testing.T, client filecachev1.FileServiceClient, name string) (*filecachev1.GetFileHeader, []byte, int, error) {
+	t.Helper()
+	stream, err := client.GetFile(context.Background(), &filecachev1.GetFileRequest{Name: name})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	var (
+		header *filecachev1.GetFileHeader
+		data   []byte
+		chunks int
+	)
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return header, data, chunks, nil
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if h := resp.GetHeader(); h != nil {
+			header = h
+			continue
+		}
+		data = append(data, resp.GetChunk()...)
+		chunks++
+	}
+}
+
+func putFile(ctx context.Context, client filecachev1.FileServiceClient, name string, data []byte, chunkSize int) (*filecachev1.PutFileResponse, error) {
+	stream, err := client.PutFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&filecachev1.PutFileRequest{
+		Part: &filecachev1.PutFileRequest_Header{Header: &filecachev1.PutFileHeader{Name: name}},
+	}); err != nil {
+		return nil, err
+	}
+	for len(data) > 0 {
+		n := min(len(data), chunkSize)
+		if err := stream.Send(&filecachev1.PutFileRequest{
+			Part: &filecachev1.PutFileRequest_Chunk{Chunk: data[:n]},
+		}); err != nil {
+			return nil, err
+		}
+		data = data[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestFileService_GetFile(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(mockCache, mockStorage), 4)
+
+	mockStorage.SetObject("notes.txt", []byte("hello, world"))
+
+	header, data, chunks, err := streamFile(t, client, "notes.txt")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if header.GetCacheStatus() != filecachev1.CacheStatus_CACHE_STATUS_MISS {
+		t.Errorf("Expected a miss, got %v", header.GetCacheStatus())
+	}
+	if string(data) != "hello, world" || chunks != 3 {
+		t.Errorf("Expected the file in 3 chunks, got %q in %d", data, chunks)
+	}
+	if got := header.GetInfo().GetContentType(); got != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the content type from the extension, got %q", got)
+	}
+
+	// The cache is written in the background
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, found, _ := mockCache.Get(context.Background(), "notes.txt"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the file to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	header, data, _, err = streamFile(t, client, "notes.txt")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if header.GetCacheStatus() != filecachev1.CacheStatus_CACHE_STATUS_HIT || string(data) != "hello, world" {
+		t.Errorf("Expected a hit with the file, got %v with %q", header.GetCacheStatus(), data)
+	}
+}
+
+func TestFileService_GetFile_Errors(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(nil, mockStorage), 0)
+
+	if _, _, _, err := streamFile(t, client, "missing.txt"); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+	if _, _, _, err := streamFile(t, client, ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an empty name, got %v", err)
+	}
+
+	mockStorage.GetError = storage.ErrAccessDenied
+	if _, _, _, err := streamFile(t, client, "secret.txt"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestFileService_PutFile(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(mockCache, mockStorage), 0)
+
+	mockCache.SetData("notes.txt", []byte("old"))
+
+	resp, err := putFile(withToken("write-token"), client, "notes.txt", []byte("new content"), 4)
+	if err != nil {
+		t.Fatalf("PutFile failed: %v", err)
+	}
+	if resp.GetSize() != 11 || resp.GetPurged() != 1 {
+		t.Errorf("Expected 11 bytes stored and 1 entry purged, got %v", resp)
+	}
+	if len(mockStorage.PutCalls) != 1 || string(mockStorage.PutCalls[0].Data) != "new content" {
+		t.Fatalf("Expected a single put of the file, got %v", mockStorage.PutCalls)
+	}
+	if got := mockStorage.PutCalls[0].ContentType; got != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the content type from the extension, got %q", got)
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "notes.txt"); found {
+		t.Error("Expected the old version to be purged")
+	}
+}
+
+func TestFileService_PutFile_Multipart(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(nil, mockStorage, handlers.WithMultipartPartSize(storage.MinPartSize)), 0)
+
+	data := bytes.Repeat([]byte("0123456789"), (2*storage.MinPartSize+10)/10)
+	resp, err := putFile(withToken("write-token"), client, "video.mp4", data, 1<<20)
+	if err != nil {
+		t.Fatalf("PutFile failed: %v", err)
+	}
+	if resp.GetSize() != int64(len(data)) {
+		t.Errorf("Expected %d bytes stored, got %d", len(data), resp.GetSize())
+	}
+	if len(mockStorage.PutCalls) != 0 {
+		t.Errorf("Expected a multipart upload, got %d single puts", len(mockStorage.PutCalls))
+	}
+	stored, err := mockStorage.GetObject(context.Background(), "video.mp4")
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("Expected the parts to be assembled into the file, got %d bytes (%v)", len(stored), err)
+	}
+}
+
+func TestFileService_PutFile_Auth(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(nil, mockStorage), 0)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{name: "no token", ctx: context.Background(), want: codes.Unauthenticated},
+		{name: "unknown token", ctx: withToken("nope"), want: codes.Unauthenticated},
+		{name: "missing scope", ctx: withToken("read-token"), want: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := putFile(tt.ctx, client, "notes.txt", []byte("x"), 1); status.Code(err) != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if len(mockStorage.PutCalls) != 0 {
+		t.Errorf("Expected nothing to be stored, got %v", mockStorage.PutCalls)
+	}
+}
+
+func TestFileService_DeleteFile(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(mockCache, mockStorage), 0)
+
+	mockStorage.SetObject("report.pdf", []byte("old"))
+	mockCache.SetData("report.pdf", []byte("old"))
+
+	if _, err := client.DeleteFile(context.Background(), &filecachev1.DeleteFileRequest{Name: "report.pdf"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a token, got %v", err)
+	}
+
+	resp, err := client.DeleteFile(withToken("write-token"), &filecachev1.DeleteFileRequest{Name: "report.pdf"})
+	if err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if resp.GetPurged() != 1 {
+		t.Errorf("Expected 1 entry purged, got %d", resp.GetPurged())
+	}
+	if !mockCache.Tombstoned("report.pdf") {
+		t.Error("Expected a tombstone for report.pdf")
+	}
+	if exists, _ := mockStorage.ObjectExists(context.Background(), "report.pdf"); exists {
+		t.Error("Expected report.pdf to be deleted from storage")
+	}
+}
+
+func TestFileService_StatFile(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(mockCache, mockStorage), 0)
+
+	mockStorage.SetObject("stored.bin", []byte("12345"))
+	mockCache.SetEntryData("cached.txt", []byte("abc"), cache.EntryMeta{
+		ETag:         `"v1"`,
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+	})
+
+	resp, err := client.StatFile(context.Background(), &filecachev1.StatFileRequest{Name: "cached.txt"})
+	if err != nil {
+		t.Fatalf("StatFile failed: %v", err)
+	}
+	info := resp.GetInfo()
+	if !resp.GetCached() || info.GetSize() != 3 || info.GetEtag() != `"v1"` {
+		t.Errorf("Expected the cached entry to be described, got %v", resp)
+	}
+	if got := info.GetLastModified().AsTime(); !got.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected the Last-Modified date, got %v", got)
+	}
+
+	resp, err = client.StatFile(context.Background(), &filecachev1.StatFileRequest{Name: "stored.bin"})
+	if err != nil {
+		t.Fatalf("StatFile failed: %v", err)
+	}
+	if resp.GetCached() || resp.GetInfo().GetSize() != 5 {
+		t.Errorf("Expected the stored file to be described, got %v", resp)
+	}
+	if len(mockStorage.GetCalls) != 0 {
+		t.Errorf("Expected the file to be stat'ed without fetching it, got %v", mockStorage.GetCalls)
+	}
+
+	if _, err := client.StatFile(context.Background(), &filecachev1.StatFileRequest{Name: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
+
+func TestFileService_ListFiles(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(nil, mockStorage), 0)
+
+	for _, name := range []string{"docs/a", "docs/b", "docs/c", "other"} {
+		mockStorage.SetObject(name, []byte(name))
+	}
+
+	var names []string
+	req := &filecachev1.ListFilesRequest{Prefix: "docs/", Limit: 2}
+	for {
+		resp, err := client.ListFiles(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ListFiles failed: %v", err)
+		}
+		for _, file := range resp.GetFiles() {
+			names = append(names, file.GetName())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	if len(names) != 3 || names[0] != "docs/a" || names[2] != "docs/c" {
+		t.Errorf("Expected the docs/ files, got %v", names)
+	}
+
+	_, err := client.ListFiles(context.Background(), &filecachev1.ListFilesRequest{Limit: 5000})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an oversized limit, got %v", err)
+	}
+}
+
+func TestGRPCServerOptions_RequestID(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	client := newGRPCClient(t, handlers.NewFileHandler(nil, mockStorage), 0)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "abc-123")
+	var header metadata.MD
+	if _, err := client.ListFiles(ctx, &filecachev1.ListFilesRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if got := header.Get(handlers.HeaderRequestID); len(got) != 1 || got[0] != "abc-123" {
+		t.Errorf("Expected the request ID to be echoed, got %v", got)
+	}
+}
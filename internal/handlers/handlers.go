@@ -3,72 +3,186 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"mime"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/ch374n/file-downloader/internal/auth"
 	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/efficiency"
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/healthcheck"
+	"github.com/ch374n/file-downloader/internal/hotkeys"
+	"github.com/ch374n/file-downloader/internal/imaging"
+	"github.com/ch374n/file-downloader/internal/keyindex"
+	"github.com/ch374n/file-downloader/internal/legacy"
+	"github.com/ch374n/file-downloader/internal/logger"
 	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/pipeline"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/prefetch"
+	"github.com/ch374n/file-downloader/internal/signing"
 	"github.com/ch374n/file-downloader/internal/storage"
 )
 
 // Response is the standard API response structure
 type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-	Data    any    `json:"data,omitempty"`
+	Success   bool      `json:"success"`
+	Message   string    `json:"message,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+	Data      any       `json:"data,omitempty"`
 }
 
+// Cache status response headers
+const (
+	HeaderCache    = "X-Cache"
+	HeaderCacheAge = "X-Cache-Age"
+
+	CacheStatusHit         = "HIT"         // Served from cache
+	CacheStatusMiss        = "MISS"        // Fetched from storage after a cache lookup
+	CacheStatusBypass      = "BYPASS"      // Caching was skipped for this request
+	CacheStatusRefresh     = "REFRESH"     // Fetched from storage on request, overwriting the cache
+	CacheStatusRevalidated = "REVALIDATED" // Served from cache after storage confirmed it unchanged
+	CacheStatusStale       = "STALE"       // Served from an expired entry while another replica fetches the file
+)
+
 // FileHandler handles file-related HTTP requests
 type FileHandler struct {
 	cache   cache.Cache
 	storage storage.Storage
+	stream  StreamConfig
+	policy  policy.Set
+
+	filenames FilenameRules
+
+	caseIndex    *keyindex.CaseIndex
+	caseRedirect bool
+
+	legacy *legacy.Origin
+
+	refreshAuth *auth.Authenticator
+
+	efficiency *efficiency.Tracker
+
+	signer  *signing.Keyring
+	presign PresignConfig
+	archive ArchiveConfig
+
+	partSize int64
+
+	// maxResponseBytes is changed at runtime by SetMaxResponseBytes
+	maxResponseBytes atomic.Int64
+	passthrough      map[string]bool
+	cacheControl     CacheControlRules
+	variants         *CompressionConfig
+	images           *imaging.Config
+	memberMaxBytes   int64
+	precompressed    *precompressed
+	prefetcher       *prefetch.Prefetcher
+	hotkeys          *hotkeys.Tracker
+	ttlPolicy        cache.TTLPolicy
+	blockSize        int64
+	timeouts         Timeouts
+	disconnectGrace  time.Duration
+	pipeline         *pipeline.Pipeline
+	events           *events.Bus
+	tombstoneTTL     time.Duration
+	fillLock         cache.FillLock
+	fillLockTTL      time.Duration
+	fillLockWait     time.Duration
+	protocols        []Protocol
+	compression      []string
+
+	// readyNeedsCache fails readiness while the cache is unreachable, and
+	// draining once shutdown has begun
+	prober          *healthcheck.Prober
+	readyNeedsCache bool
+	draining        atomic.Bool
+
+	metrics *metrics.Metrics
 }
 
-// NewFileHandler creates a new FileHandler with the given dependencies
-func NewFileHandler(c cache.Cache, s storage.Storage) *FileHandler {
-	return &FileHandler{
-		cache:   c,
-		storage: s,
+// Option configures optional FileHandler behavior
+type Option func(*FileHandler)
+
+// WithStreamConfig sets how response bodies are chunked when written to clients
+func WithStreamConfig(cfg StreamConfig) Option {
+	return func(h *FileHandler) {
+		h.stream = cfg
 	}
 }
 
-// Health handles health check requests
-func (h *FileHandler) Health(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+// WithMetrics sets the collectors FileHandler records into
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(h *FileHandler) {
+		h.metrics = m
+	}
+}
 
-	health := map[string]string{
-		"status": "healthy",
+// WithPolicies sets the request policies consulted by GetFile
+func WithPolicies(p policy.Set) Option {
+	return func(h *FileHandler) {
+		h.policy = p
 	}
+}
 
-	// Check cache (optional - doesn't affect overall health)
-	if h.cache != nil {
-		if err := h.cache.Ping(ctx); err != nil {
-			health["redis"] = "unhealthy: " + err.Error()
-		} else {
-			health["redis"] = "healthy"
-		}
-	} else {
-		health["redis"] = "disabled"
+// WithCaseInsensitiveKeys resolves names covered by idx regardless of case.
+// When redirect is set, clients are sent to the canonical name with a 301
+// instead of being served the canonical file directly.
+func WithCaseInsensitiveKeys(idx *keyindex.CaseIndex, redirect bool) Option {
+	return func(h *FileHandler) {
+		h.caseIndex = idx
+		h.caseRedirect = redirect
+	}
+}
+
+// NewFileHandler creates a new FileHandler with the given dependencies
+func NewFileHandler(c cache.Cache, s storage.Storage, opts ...Option) *FileHandler {
+	h := &FileHandler{
+		cache:    c,
+		storage:  s,
+		stream:   DefaultStreamConfig(),
+		presign:  DefaultPresignConfig(),
+		archive:  DefaultArchiveConfig(),
+		partSize: DefaultPartSize,
+
+		timeouts:     DefaultTimeouts(),
+		tombstoneTTL: DefaultTombstoneTTL,
+		metrics:      metrics.Noop(),
+	}
+	h.maxResponseBytes.Store(DefaultMaxResponseBytes)
+	WithHeaderPassthrough(DefaultHeaderPassthrough)(h)
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
+}
+
+// Health handles health check requests
+func (h *FileHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeouts.Health)
+	defer cancel()
 
-	// Check storage (required - affects overall health)
-	if err := h.storage.HealthCheck(ctx); err != nil {
-		health["status"] = "unhealthy"
-		health["r2"] = "unhealthy: " + err.Error()
+	// The cache is optional and doesn't affect overall health
+	health, _, storageErr := h.checkHealth(ctx)
+	if storageErr != nil {
+		health.Status = "unhealthy"
 		writeJSON(w, http.StatusServiceUnavailable, Response{
-			Success: false,
-			Message: "Service is unhealthy",
-			Data:    health,
+			Success:   false,
+			Message:   "Service is unhealthy",
+			ErrorCode: ErrCodeServiceUnhealthy,
+			Data:      health,
 		})
 		return
 	}
-	health["r2"] = "healthy"
 
 	writeJSON(w, http.StatusOK, Response{
 		Success: true,
@@ -77,13 +191,37 @@ func (h *FileHandler) Health(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// checkHealth reports the reachability of the cache and storage in the
+// returned status, whose overall Status is left healthy for callers to
+// decide
+func (h *FileHandler) checkHealth(ctx context.Context) (health HealthStatus, cacheErr, storageErr error) {
+	health.Status = "healthy"
+	health.LogLevel = logger.Level()
+	if h.cache != nil {
+		status := h.probe(ctx, HealthCheckCache, h.cache.Ping)
+		cacheErr = status.Err
+		health.Redis = dependencyHealth(cacheErr)
+		checkedAt := timestamp(status.CheckedAt)
+		health.RedisCheckedAt = &checkedAt
+	} else {
+		health.Redis = "disabled"
+	}
+
+	status := h.probe(ctx, HealthCheckStorage, h.storage.HealthCheck)
+	storageErr = status.Err
+	health.R2 = dependencyHealth(storageErr)
+	checkedAt := timestamp(status.CheckedAt)
+	health.R2CheckedAt = &checkedAt
+	return health, cacheErr, storageErr
+}
+
 // Root handles the root endpoint
 func (h *FileHandler) Root(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, Response{
 		Success: true,
 		Message: "File Caching Service",
-		Data: map[string]string{
-			"version": "1.0.0",
+		Data: ServiceInfo{
+			Version: serviceVersion,
 		},
 	})
 }
@@ -94,114 +232,370 @@ func (h *FileHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 
 	if filename == "" {
 		writeJSON(w, http.StatusBadRequest, Response{
-			Success: false,
-			Message: "filename is required",
+			Success:   false,
+			Message:   "filename is required",
+			ErrorCode: ErrCodeInvalidRequest,
 		})
 		return
 	}
+	if strings.HasSuffix(filename, "/") && strings.Trim(filename, "/") != "" {
+		h.RedirectTrailingSlash(w, r)
+		return
+	}
+	if err := h.filenames.Check(filename); err != nil {
+		writeInvalidFilename(w, r, filename, err)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel := h.requestContext(r.Context())
 	defer cancel()
 
-	// Check cache only if available
+	if h.caseIndex != nil && features.Enabled(ctx, features.CaseInsensitiveKeys, true) {
+		if canonical, ok := h.caseIndex.Resolve(filename); ok && canonical != filename {
+			if h.caseRedirect {
+				slog.InfoContext(ctx, "Redirecting to canonical name", "filename", filename, "canonical", canonical)
+				http.Redirect(w, r, requestPath(ctx, filePath(canonical)), http.StatusMovedPermanently)
+				return
+			}
+			slog.InfoContext(ctx, "Resolved canonical name", "filename", filename, "canonical", canonical)
+			filename = canonical
+		}
+	}
+
+	// A signed URL is an explicit grant, so it overrides deny policies
+	if !hasSignedAccess(ctx) && h.policy.Denied(&policy.Request{Name: filename, Method: r.Method}) {
+		slog.InfoContext(ctx, "Request denied by policy", "filename", filename)
+		writeJSON(w, http.StatusForbidden, Response{
+			Success:   false,
+			Message:   "Access denied",
+			ErrorCode: ErrCodeAccessDenied,
+		})
+		return
+	}
+
+	refresh, err := h.refreshRequested(r)
+	if err != nil {
+		status, code := http.StatusBadRequest, ErrCodeInvalidRequest
+		if errors.Is(err, errRefreshForbidden) {
+			status, code = http.StatusForbidden, ErrCodeAccessDenied
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+
+	if archive, member, ok := splitMember(filename); ok && h.memberMaxBytes > 0 {
+		h.serveMember(ctx, w, r, archive, member, refresh)
+		return
+	}
+
+	if h.images != nil && imaging.Requested(r.URL.Query()) {
+		h.serveImage(ctx, w, r, filename, refresh)
+		return
+	}
+
+	// Reading numbered files in order loads the next ones ahead of time
+	h.hotkeys.Observe(filename)
 	if h.cache != nil {
+		h.prefetcher.Observe(ctx, filename, h.prefetchFile)
+	}
+
+	// A pre-compressed copy stored next to the file is served in its place
+	name := filename
+	filename, encoding := h.precompressedKey(ctx, w, r, filename)
+
+	// Check cache only if available
+	cacheMissed := false
+	unlock := unlocked
+	switch {
+	case h.cache == nil:
+		slog.InfoContext(ctx, "Cache disabled, fetching from storage", "filename", filename)
+		w.Header().Set(HeaderCache, CacheStatusBypass)
+	case !features.Enabled(ctx, features.CacheRead, true):
+		slog.InfoContext(ctx, "Cache read overridden, fetching from storage", "filename", filename)
+		w.Header().Set(HeaderCache, CacheStatusBypass)
+	case refresh:
+		slog.InfoContext(ctx, "Refresh requested, fetching from storage", "filename", filename)
+		w.Header().Set(HeaderCache, CacheStatusRefresh)
+	default:
+		// A range of a chunked file is read from the chunks holding it
+		// alone, and a range of a file not cached whole from its blocks
+		if encoding == "" && !wantsRevalidation(r) && (h.serveCachedRange(ctx, w, r, filename) || h.serveBlockRange(ctx, w, r, filename)) {
+			return
+		}
+
 		start := time.Now()
-		data, found, err := h.cache.Get(ctx, filename)
-		metrics.CacheOperationDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+		entry, found, err := h.getCached(ctx, filename)
+		h.metrics.CacheOperationDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
 
 		if err != nil {
-			slog.Error("Cache error", "filename", filename, "error", err)
+			slog.ErrorContext(ctx, "Cache error", "filename", filename, "error", err)
+		}
+
+		status := CacheStatusHit
+		if found && wantsRevalidation(r) {
+			if found = h.revalidate(ctx, filename, entry); found {
+				status = CacheStatusRevalidated
+			} else {
+				slog.InfoContext(ctx, "Cached file failed revalidation", "filename", filename)
+			}
+		}
+		if !found {
+			var waited *cache.Entry
+			if waited, status, unlock = h.awaitFill(ctx, filename); waited != nil {
+				entry, found = waited, true
+			}
 		}
 
 		if found {
-			metrics.CacheHitsTotal.Inc()
-			slog.Info("Cache HIT", "filename", filename)
-			writeFileResponse(w, filename, data)
+			h.metrics.CacheHitsTotal.Inc()
+			h.efficiency.Hit(filename, int64(len(entry.Data)))
+			slog.InfoContext(ctx, "Cache "+status, "filename", filename)
+			w.Header().Set(HeaderCache, status)
+			w.Header().Set(HeaderCacheAge, strconv.Itoa(int(entry.Age.Seconds())))
+			if encoding != "" {
+				entry.Meta = markPrecompressed(w, entry.Meta, encoding)
+			}
+			h.writeFileResponse(ctx, w, r, name, entry.Data, entry.Meta, true)
 			return
 		}
 
-		metrics.CacheMissesTotal.Inc()
-		slog.Info("Cache MISS", "filename", filename)
-	} else {
-		slog.Info("Cache disabled, fetching from storage", "filename", filename)
+		h.metrics.CacheMissesTotal.Inc()
+		slog.InfoContext(ctx, "Cache MISS", "filename", filename)
+		w.Header().Set(HeaderCache, CacheStatusMiss)
+		cacheMissed = true
 	}
 
 	// Fetch from storage
+	fetchCtx, release := h.fetchContext(r.Context(), ctx)
+	defer release()
 	start := time.Now()
-	data, err := h.storage.GetObject(ctx, filename)
+	data, meta, err := h.fetchObject(fetchCtx, filename)
 	duration := time.Since(start).Seconds()
-	metrics.R2RequestDuration.WithLabelValues("get").Observe(duration)
+	h.metrics.R2RequestDuration.WithLabelValues("get").Observe(duration)
+
+	// The pre-compressed copy was removed since it was last seen, so start
+	// over with the original
+	if encoding != "" && errors.Is(err, storage.ErrNotFound) {
+		unlock()
+		slog.InfoContext(ctx, "Pre-compressed file missing, serving original", "key", filename)
+		h.precompressed.record(filename, false)
+		h.GetFile(w, r)
+		return
+	}
 
-	if err != nil {
-		metrics.R2RequestsTotal.WithLabelValues("get", "error").Inc()
-		slog.Error("Storage error", "filename", filename, "error", err)
+	// Files not yet migrated may still be on the legacy origin
+	fromLegacy := false
+	if errors.Is(err, storage.ErrNotFound) && h.legacy != nil && h.legacy.Covers(filename) {
+		h.metrics.R2RequestsTotal.WithLabelValues("get", string(failureError)).Inc()
+		data, meta, err = h.fetchLegacy(fetchCtx, filename)
+		fromLegacy = true
+	}
 
-		if ctx.Err() == context.DeadlineExceeded {
-			writeJSON(w, http.StatusGatewayTimeout, Response{
-				Success: false,
-				Message: "Request timeout",
-			})
+	if err != nil {
+		unlock()
+		kind := classifyFailure(r.Context(), ctx, err)
+		if !fromLegacy {
+			h.metrics.R2RequestsTotal.WithLabelValues("get", string(kind)).Inc()
+		}
+		if kind == failureClientCanceled {
+			h.metrics.ClientDisconnectsTotal.WithLabelValues(disconnectCanceled).Inc()
+		}
+		if h.writeTimeoutOrCancel(ctx, w, kind, "get", "filename", filename, "error", err) {
 			return
 		}
 
-		if isNotFoundError(err) {
+		slog.ErrorContext(ctx, "Storage error", "filename", filename, "error", err)
+
+		if errors.Is(err, storage.ErrNotFound) {
 			writeJSON(w, http.StatusNotFound, Response{
-				Success: false,
-				Message: "File not found",
+				Success:   false,
+				Message:   "File not found",
+				ErrorCode: ErrCodeFileNotFound,
+			})
+			return
+		}
+		if errors.Is(err, storage.ErrAccessDenied) {
+			writeJSON(w, http.StatusForbidden, Response{
+				Success:   false,
+				Message:   "Access denied",
+				ErrorCode: ErrCodeAccessDenied,
 			})
 			return
 		}
 
 		writeJSON(w, http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "Failed to retrieve file",
+			Success:   false,
+			Message:   "Failed to retrieve file",
+			ErrorCode: ErrCodeStorageError,
 		})
 		return
 	}
 
-	metrics.R2RequestsTotal.WithLabelValues("get", "success").Inc()
+	if !fromLegacy {
+		h.metrics.R2RequestsTotal.WithLabelValues("get", "success").Inc()
+	}
+	if cacheMissed {
+		h.efficiency.Miss(filename, int64(len(data)))
+		h.events.Publish(ctx, events.Event{Type: events.CacheMiss, Key: filename, Size: int64(len(data))})
+	}
 
-	// Cache the file only if cache is available
-	if h.cache != nil {
-		go func() {
-			bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
+	h.fillCache(ctx, r.Method, filename, data, meta, fromLegacy, unlock)
 
-			start := time.Now()
-			if err := h.cache.Set(bgCtx, filename, data); err != nil {
-				slog.Error("Failed to cache file", "filename", filename, "error", err)
-			} else {
-				slog.Info("Cached file", "filename", filename)
-			}
-			metrics.CacheOperationDuration.WithLabelValues("set").Observe(time.Since(start).Seconds())
-		}()
+	// The fetch finished within the disconnect grace, so only the cache
+	// gets the file
+	if r.Context().Err() != nil {
+		h.metrics.ClientDisconnectsTotal.WithLabelValues(disconnectCompleted).Inc()
+		slog.InfoContext(ctx, "Client disconnected while the file was fetched", "filename", filename)
+		return
+	}
+
+	respMeta := meta
+	if encoding != "" {
+		respMeta = markPrecompressed(w, meta, encoding)
+	}
+	h.writeFileResponse(ctx, w, r, name, data, respMeta, false)
+}
+
+// fillCache stores a file fetched from storage in the background, unless the
+// cache policy excludes it, and calls done once the file is cached or skipped
+func (h *FileHandler) fillCache(ctx context.Context, method, filename string, data []byte, meta cache.EntryMeta, fromLegacy bool, done func()) {
+	// Cache the file only if cache is available and policy allows it
+	cacheable := !features.Enabled(ctx, features.CachePolicy, true) || h.policy.Cacheable(&policy.Request{
+		Name:        filename,
+		Size:        int64(len(data)),
+		Method:      method,
+		ContentType: contentTypeFor(filename),
+	})
+	if !cacheable {
+		slog.InfoContext(ctx, "Cache policy excluded file", "filename", filename, "size", len(data))
 	}
+	// Legacy files are cached only when they are also being copied to storage,
+	// so the cache never holds a file storage doesn't know about
+	backfilled := !fromLegacy || h.legacy.Backfill()
+	if h.cache == nil || !cacheable || !backfilled || !features.Enabled(ctx, features.CacheFill, true) {
+		done()
+		return
+	}
+	h.metrics.CacheAsyncWrites.Inc()
+	go func() {
+		defer done()
+		defer h.metrics.CacheAsyncWrites.Dec()
+		// Detach from the request so the write outlives it but keeps its log context
+		bgCtx, cancel := h.requestContext(context.WithoutCancel(ctx))
+		defer cancel()
+
+		start := time.Now()
+		if err := h.storeCached(bgCtx, filename, data, meta); errors.Is(err, cache.ErrTombstoned) {
+			slog.InfoContext(bgCtx, "Skipped caching deleted file", "filename", filename)
+		} else if errors.Is(err, cache.ErrCircuitOpen) {
+			slog.DebugContext(bgCtx, "Skipped caching while the cache is bypassed", "filename", filename)
+		} else if err != nil {
+			slog.ErrorContext(bgCtx, "Failed to cache file", "filename", filename, "error", err)
+		} else {
+			h.efficiency.Filled(filename)
+			slog.InfoContext(bgCtx, "Cached file", "filename", filename)
+		}
+		h.metrics.CacheOperationDuration.WithLabelValues("set").Observe(time.Since(start).Seconds())
+	}()
+}
+
+// RedirectTrailingSlash sends /files/{name}/ to /files/{name}
+func (h *FileHandler) RedirectTrailingSlash(w http.ResponseWriter, r *http.Request) {
+	target := requestPath(r.Context(), filePath(strings.TrimRight(r.PathValue("name"), "/")))
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
 
-	writeFileResponse(w, filename, data)
+// filePath returns the URL path that serves the named file, keeping the
+// slashes of nested keys
+func filePath(name string) string {
+	return resourcePath("files", name)
+}
+
+// resourcePath returns the URL path of the named file under prefix, such
+// as its upload callback under uploaded, keeping the slashes of nested keys
+func resourcePath(prefix, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + prefix + "/" + strings.Join(segments, "/")
+}
+
+// MetricsOption configures MetricsMiddleware
+type MetricsOption func(*metricsLabels)
+
+// metricsLabels decides the path label of requests
+type metricsLabels struct {
+	route string
+	paths map[string]bool
+}
+
+// WithMetricsRoute labels requests with route when they weren't routed by
+// a ServeMux pattern, such as those of the S3 server
+func WithMetricsRoute(route string) MetricsOption {
+	return func(l *metricsLabels) {
+		l.route = route
+	}
 }
 
-// MetricsMiddleware wraps a handler to record HTTP metrics
-func MetricsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// WithMetricsPaths keeps the listed request paths as their own label
+// rather than their route's, to single out a few hot files
+func WithMetricsPaths(paths ...string) MetricsOption {
+	return func(l *metricsLabels) {
+		for _, path := range paths {
+			l.paths[path] = true
+		}
+	}
+}
+
+// path returns the label for r: an allowlisted path, or the route pattern
+// that matched it, so metrics don't get a series per file
+func (l *metricsLabels) path(r *http.Request) string {
+	if l.paths[r.URL.Path] {
+		return r.URL.Path
+	}
+	if l.route != "" {
+		return l.route
+	}
+	if r.Pattern == "" {
+		return "other"
+	}
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
+
+// MetricsMiddleware wraps a handler to record HTTP metrics into m, labeled
+// by route template (e.g. /files/{name}) rather than the requested path
+func MetricsMiddleware(m *metrics.Metrics, next http.HandlerFunc, opts ...MetricsOption) http.HandlerFunc {
+	labels := &metricsLabels{paths: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(labels)
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		route := labels.path(r)
+		active := m.HTTPInflightRequests.WithLabelValues(route)
+		active.Inc()
+		defer active.Dec()
 
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next(wrapped, r)
 
 		duration := time.Since(start).Seconds()
-		path := r.URL.Path
 		method := r.Method
 		status := strconv.Itoa(wrapped.statusCode)
 
-		metrics.HTTPRequestsTotal.WithLabelValues(method, path, status).Inc()
-		metrics.HTTPRequestDuration.WithLabelValues(method, path).Observe(duration)
-
-		slog.Info("Request completed",
-			"method", method,
-			"path", path,
-			"status", wrapped.statusCode,
-			"duration_ms", duration*1000,
-		)
+		m.HTTPRequestsTotal.WithLabelValues(method, route, status).Inc()
+		m.HTTPRequestDuration.WithLabelValues(method, route).Observe(duration)
 	}
 }
 
@@ -215,21 +609,75 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func writeFileResponse(w http.ResponseWriter, filename string, data []byte) {
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
-	if contentType == "" {
-		contentType = "application/octet-stream"
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// writeFileResponse writes data with the object's content type, validators
+// and passthrough headers, falling back to a content type derived from the
+// filename. Conditional requests the client is up to date for get a 304.
+// Files served from the cache are sent from their compressed variants when
+// those are enabled.
+func (h *FileHandler) writeFileResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, filename string, data []byte, meta cache.EntryMeta, cached bool) {
+	header := w.Header()
+	h.setFileHeaders(ctx, header, filename, meta)
+	if notModified(r, meta) {
+		writeNotModified(w)
+		return
 	}
 
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Disposition", "inline; filename=\""+filename+"\"")
+	if cached && h.variants != nil {
+		if encoded, ok := h.compressedVariant(ctx, w, r, filename, data, meta); ok {
+			data = encoded
+		}
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(data)))
 	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+
+	source := sourceStorage
+	if cached {
+		source = sourceCache
+	}
+	n, err := newAdaptiveWriter(w, h.stream, h.metrics).WriteBody(data)
+	h.countServed(ctx, filename, apiHTTP, source, n)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to write response body", "filename", filename, "error", err)
+	}
+}
+
+// setFileHeaders sets the headers describing filename on its response
+func (h *FileHandler) setFileHeaders(ctx context.Context, header http.Header, filename string, meta cache.EntryMeta) {
+	header.Set("Content-Type", objectContentType(filename, meta))
+	header.Set("Content-Disposition", contentDisposition("inline", filename))
+	if meta.ETag != "" {
+		header.Set("ETag", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		header.Set("Last-Modified", meta.LastModified)
+	}
+	if value := h.cacheControlFor(filename); value != "" {
+		header.Set("Cache-Control", value)
+	}
+	// Passthrough headers stay in the cache entry when overridden off, so
+	// other requests keep getting them
+	if features.Enabled(ctx, features.HeaderPassthrough, true) {
+		for name, value := range h.passthroughHeaders(meta.Headers) {
+			header.Set(name, value)
+		}
+	}
+	if hasSignedAccess(ctx) {
+		restrictSharedCaching(header)
+	}
 }
 
-func isNotFoundError(err error) bool {
-	return strings.Contains(err.Error(), "NoSuchKey") ||
-		strings.Contains(err.Error(), "not found")
+func contentTypeFor(filename string) string {
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
@@ -1,19 +1,34 @@
 package handlers_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/keyindex"
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/metrics"
 	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/policy"
 )
 
 type TestResponse struct {
-	Success bool              `json:"success"`
-	Message string            `json:"message"`
-	Data    map[string]string `json:"data"`
+	Success   bool              `json:"success"`
+	Message   string            `json:"message"`
+	ErrorCode string            `json:"error_code"`
+	Data      map[string]string `json:"data"`
 }
 
 func parseResponse(t *testing.T, body []byte) TestResponse {
@@ -298,6 +313,9 @@ func TestGetFile_FileNotFound(t *testing.T) {
 	if resp.Message != "File not found" {
 		t.Errorf("Expected message 'File not found', got '%s'", resp.Message)
 	}
+	if resp.ErrorCode != string(handlers.ErrCodeFileNotFound) {
+		t.Errorf("Expected error code '%s', got '%s'", handlers.ErrCodeFileNotFound, resp.ErrorCode)
+	}
 }
 
 func TestGetFile_StorageError(t *testing.T) {
@@ -320,6 +338,9 @@ func TestGetFile_StorageError(t *testing.T) {
 	if resp.Success {
 		t.Error("Expected success to be false")
 	}
+	if resp.ErrorCode != string(handlers.ErrCodeStorageError) {
+		t.Errorf("Expected error code '%s', got '%s'", handlers.ErrCodeStorageError, resp.ErrorCode)
+	}
 }
 
 func TestGetFile_CacheErrorFallsBackToStorage(t *testing.T) {
@@ -447,6 +468,181 @@ func TestGetFile_CacheSetError_StillSucceeds(t *testing.T) {
 	}
 }
 
+func TestGetFile_CacheStatusHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		withCache  bool
+		cached     bool
+		wantStatus string
+		wantAge    string
+	}{
+		{"hit", true, true, handlers.CacheStatusHit, "120"},
+		{"miss", true, false, handlers.CacheStatusMiss, ""},
+		{"bypass", false, false, handlers.CacheStatusBypass, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCache := mocks.NewMockCache()
+			mockStorage := mocks.NewMockStorage()
+			mockStorage.SetObject("test.txt", []byte("content"))
+			if tc.cached {
+				mockCache.SetDataWithAge("test.txt", []byte("content"), 2*time.Minute)
+			}
+
+			handler := handlers.NewFileHandler(nil, mockStorage)
+			if tc.withCache {
+				handler = handlers.NewFileHandler(mockCache, mockStorage)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/files/test.txt", nil)
+			req.SetPathValue("name", "test.txt")
+			rec := httptest.NewRecorder()
+
+			handler.GetFile(rec, req)
+
+			if got := rec.Header().Get(handlers.HeaderCache); got != tc.wantStatus {
+				t.Errorf("Expected X-Cache '%s', got '%s'", tc.wantStatus, got)
+			}
+			if got := rec.Header().Get(handlers.HeaderCacheAge); got != tc.wantAge {
+				t.Errorf("Expected X-Cache-Age '%s', got '%s'", tc.wantAge, got)
+			}
+		})
+	}
+}
+
+func TestGetFile_ByteMetrics(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a.txt", []byte("hello"))
+	m := metrics.New(prometheus.NewRegistry())
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithMetrics(m))
+
+	get := func() {
+		req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+		req.SetPathValue("name", "a.txt")
+		handler.GetFile(httptest.NewRecorder(), req)
+	}
+
+	get()
+	if got := testutil.ToFloat64(m.ResponseBytesTotal.WithLabelValues("storage")); got != 5 {
+		t.Errorf("Expected 5 bytes served from storage, got %v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.CacheStoredBytesTotal) != 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 5 bytes stored in the cache, got %v", testutil.ToFloat64(m.CacheStoredBytesTotal))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	get()
+	if got := testutil.ToFloat64(m.ResponseBytesTotal.WithLabelValues("cache")); got != 5 {
+		t.Errorf("Expected 5 bytes served from the cache, got %v", got)
+	}
+}
+
+func TestGetFile_CacheErrorMetrics(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockCache.GetError = errors.New("cache down")
+	mockCache.SetError = errors.New("cache down")
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a.txt", []byte("hello"))
+	m := metrics.New(prometheus.NewRegistry())
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithMetrics(m))
+
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt", nil)
+	req.SetPathValue("name", "a.txt")
+	rr := httptest.NewRecorder()
+	handler.GetFile(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected the file to be served from storage, got %d", rr.Code)
+	}
+	if got := testutil.ToFloat64(m.CacheErrorsTotal.WithLabelValues("get")); got != 1 {
+		t.Errorf("Expected 1 failed cache read, got %v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.CacheErrorsTotal.WithLabelValues("set")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the failed cache write to be counted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMetricsMiddleware_RouteLabels(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", handlers.MetricsMiddleware(m, ok, handlers.WithMetricsPaths("/files/hot.txt")))
+	mux.HandleFunc("/s3/", handlers.MetricsMiddleware(m, ok, handlers.WithMetricsRoute("/{bucket}/{key...}")))
+
+	for _, path := range []string{"/files/a.txt", "/files/b.txt", "/files/hot.txt", "/s3/bucket/a.txt"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	tests := []struct {
+		path string
+		want float64
+	}{
+		{path: "/files/{name}", want: 2},
+		{path: "/files/hot.txt", want: 1},
+		{path: "/{bucket}/{key...}", want: 1},
+		{path: "/files/a.txt", want: 0},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(m.HTTPRequestsTotal.WithLabelValues(http.MethodGet, tt.path, "200")); got != tt.want {
+			t.Errorf("Expected %v requests labeled %s, got %v", tt.want, tt.path, got)
+		}
+	}
+}
+
+func TestMetricsMiddleware_InflightRequests(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	inflight := m.HTTPInflightRequests.WithLabelValues("/files/{name}")
+	var during float64
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", handlers.MetricsMiddleware(m, func(w http.ResponseWriter, r *http.Request) {
+		during = testutil.ToFloat64(inflight)
+	}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/files/a.txt", nil))
+	if during != 1 {
+		t.Errorf("Expected 1 request in flight while serving, got %v", during)
+	}
+	if got := testutil.ToFloat64(inflight); got != 0 {
+		t.Errorf("Expected no requests in flight once served, got %v", got)
+	}
+}
+
+func TestGetFile_LargeFileStreamedInChunks(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(nil, mockStorage, handlers.WithStreamConfig(handlers.StreamConfig{
+		MinChunkSize:        1024,
+		MaxChunkSize:        8 * 1024,
+		TargetWriteDuration: time.Millisecond,
+	}))
+
+	testData := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	mockStorage.SetObject("large.bin", testData)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/large.bin", nil)
+	req.SetPathValue("name", "large.bin")
+	rec := httptest.NewRecorder()
+
+	handler.GetFile(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), testData) {
+		t.Errorf("Expected %d body bytes, got %d", len(testData), rec.Body.Len())
+	}
+	if rec.Header().Get("Content-Length") != strconv.Itoa(len(testData)) {
+		t.Errorf("Expected Content-Length %d, got '%s'", len(testData), rec.Header().Get("Content-Length"))
+	}
+}
+
 func BenchmarkGetFile_CacheHit(b *testing.B) {
 	mockCache := mocks.NewMockCache()
 	mockStorage := mocks.NewMockStorage()
@@ -479,3 +675,338 @@ func BenchmarkGetFile_CacheMiss(b *testing.B) {
 		handler.GetFile(rec, req)
 	}
 }
+
+func TestGetFile_ClientCanceled(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.GetError = context.Canceled
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/files/test.txt", nil).WithContext(ctx)
+	req.SetPathValue("name", "test.txt")
+	rec := httptest.NewRecorder()
+
+	handler.GetFile(rec, req)
+
+	if rec.Code != handlers.StatusClientClosedRequest {
+		t.Errorf("Expected status %d, got %d", handlers.StatusClientClosedRequest, rec.Code)
+	}
+}
+
+func TestGetFile_RequestTimeout(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("test.txt", []byte("content"))
+	mockStorage.GetDelay = time.Second
+	handler := handlers.NewFileHandler(nil, mockStorage, handlers.WithTimeouts(handlers.Timeouts{Request: 20 * time.Millisecond}))
+
+	req := httptest.NewRequest(http.MethodGet, "/files/test.txt", nil)
+	req.SetPathValue("name", "test.txt")
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.GetFile(rec, req)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the request timeout to cut the request short, took %v", elapsed)
+	}
+	resp := parseResponse(t, rec.Body.Bytes())
+	if rec.Code != http.StatusGatewayTimeout || resp.ErrorCode != string(handlers.ErrCodeRequestTimeout) {
+		t.Errorf("Expected %d %s, got %d %s", http.StatusGatewayTimeout, handlers.ErrCodeRequestTimeout, rec.Code, resp.ErrorCode)
+	}
+}
+
+func TestGetFile_UpstreamTimeout(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.GetError = fmt.Errorf("failed to get object: %w", os.ErrDeadlineExceeded)
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/test.txt", nil)
+	req.SetPathValue("name", "test.txt")
+	rec := httptest.NewRecorder()
+
+	handler.GetFile(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+
+	resp := parseResponse(t, rec.Body.Bytes())
+	if resp.ErrorCode != string(handlers.ErrCodeStorageTimeout) {
+		t.Errorf("Expected error code '%s', got '%s'", handlers.ErrCodeStorageTimeout, resp.ErrorCode)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logger.RequestID(r.Context())
+	})
+	handler := handlers.RequestIDMiddleware(next)
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"propagates client ID", "abc-123", true},
+		{"generates when missing", "", false},
+		{"replaces invalid ID", "bad id\nwith newline", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.incoming != "" {
+				req.Header.Set(handlers.HeaderRequestID, tc.incoming)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(handlers.HeaderRequestID)
+			if got == "" {
+				t.Fatal("Expected X-Request-ID in response")
+			}
+			if got != seen {
+				t.Errorf("Expected context request ID '%s', got '%s'", got, seen)
+			}
+			if tc.wantSame && got != tc.incoming {
+				t.Errorf("Expected '%s' to be propagated, got '%s'", tc.incoming, got)
+			}
+			if !tc.wantSame && got == tc.incoming {
+				t.Errorf("Expected a generated ID, got '%s'", got)
+			}
+		})
+	}
+}
+
+func TestGetFile_Policies(t *testing.T) {
+	policies, err := policy.CompileSet("size < 10", "prefix('private/')")
+	if err != nil {
+		t.Fatalf("CompileSet failed: %v", err)
+	}
+
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("private/a.txt", []byte("secret"))
+	mockStorage.SetObject("big.txt", []byte("more than ten bytes"))
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithPolicies(policies))
+
+	req := httptest.NewRequest(http.MethodGet, "/files/private/a.txt", nil)
+	req.SetPathValue("name", "private/a.txt")
+	rec := httptest.NewRecorder()
+	handler.GetFile(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if len(mockStorage.GetCalls) != 0 {
+		t.Error("Expected denied request not to reach storage")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/files/big.txt", nil)
+	req.SetPathValue("name", "big.txt")
+	rec = httptest.NewRecorder()
+	handler.GetFile(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(mockCache.SetCalls) != 0 {
+		t.Errorf("Expected cache policy to skip caching, got %d set calls", len(mockCache.SetCalls))
+	}
+}
+
+func TestGetFile_CaseInsensitiveKeys(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("reports/Report.PDF", []byte("pdf"))
+	mockStorage.SetObject("other/Notes.txt", []byte("notes"))
+
+	idx := keyindex.NewCaseIndex(mockStorage, []string{"reports/"})
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	get := func(handler *handlers.FileHandler, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/"+name, nil)
+		req.SetPathValue("name", name)
+		rec := httptest.NewRecorder()
+		handler.GetFile(rec, req)
+		return rec
+	}
+
+	redirecting := handlers.NewFileHandler(nil, mockStorage, handlers.WithCaseInsensitiveKeys(idx, true))
+	rec := get(redirecting, "reports/report.pdf")
+	if rec.Code != http.StatusMovedPermanently {
+		t.Fatalf("Expected status %d, got %d", http.StatusMovedPermanently, rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/files/reports/Report.PDF" {
+		t.Errorf("Expected redirect to canonical name, got %q", loc)
+	}
+
+	serving := handlers.NewFileHandler(nil, mockStorage, handlers.WithCaseInsensitiveKeys(idx, false))
+	rec = get(serving, "REPORTS/report.pdf")
+	if rec.Code != http.StatusOK || rec.Body.String() != "pdf" {
+		t.Errorf("Expected canonical file to be served, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Prefixes outside the configured list stay case-sensitive
+	rec = get(serving, "other/notes.txt")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestRedirectTrailingSlash(t *testing.T) {
+	handler := handlers.NewFileHandler(nil, mocks.NewMockStorage())
+
+	req := httptest.NewRequest(http.MethodGet, "/files/test.txt/?download=1", nil)
+	req.SetPathValue("name", "test.txt")
+	rec := httptest.NewRecorder()
+	handler.RedirectTrailingSlash(rec, req)
+
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/files/test.txt?download=1" {
+		t.Errorf("Expected Location /files/test.txt?download=1, got %q", loc)
+	}
+}
+
+func TestGetFile_RedirectsTrailingSlash(t *testing.T) {
+	handler := handlers.NewFileHandler(mocks.NewMockCache(), mocks.NewMockStorage())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name...}", handler.GetFile)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/reports/2024/q3.pdf/?download=1", nil))
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/files/reports/2024/q3.pdf?download=1" {
+		t.Errorf("Expected Location /files/reports/2024/q3.pdf?download=1, got %q", loc)
+	}
+}
+
+func TestGetFile_StorageSentinelErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   handlers.ErrorCode
+	}{
+		{"not found", mocks.ErrObjectNotFound, http.StatusNotFound, handlers.ErrCodeFileNotFound},
+		{"access denied", mocks.ErrAccessDenied, http.StatusForbidden, handlers.ErrCodeAccessDenied},
+		{"timeout", mocks.ErrStorageTimeout, http.StatusGatewayTimeout, handlers.ErrCodeStorageTimeout},
+		{"other", mocks.ErrStorageError, http.StatusInternalServerError, handlers.ErrCodeStorageError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := mocks.NewMockStorage()
+			mockStorage.GetError = fmt.Errorf("failed to get object test.txt: %w", tt.err)
+			handler := handlers.NewFileHandler(nil, mockStorage)
+
+			req := httptest.NewRequest(http.MethodGet, "/files/test.txt", nil)
+			req.SetPathValue("name", "test.txt")
+			rec := httptest.NewRecorder()
+			handler.GetFile(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			resp := parseResponse(t, rec.Body.Bytes())
+			if resp.ErrorCode != string(tt.wantCode) {
+				t.Errorf("Expected error code '%s', got '%s'", tt.wantCode, resp.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestGetFile_HeaderPassthrough(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	mockStorage.SetObject("page.html", []byte("bonjour"))
+	mockStorage.SetObjectHeaders("page.html", http.Header{
+		"Content-Language": {"fr"},
+		"Content-Encoding": {"gzip"},
+		"X-Amz-Meta-Owner": {"web"},
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/page.html", nil)
+		req.SetPathValue("name", "page.html")
+		rec := httptest.NewRecorder()
+		handler.GetFile(rec, req)
+		return rec
+	}
+	check := func(rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if got := rec.Header().Get("Content-Language"); got != "fr" {
+			t.Errorf("Expected Content-Language 'fr', got '%s'", got)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Expected Content-Encoding 'gzip', got '%s'", got)
+		}
+		if got := rec.Header().Get("X-Amz-Meta-Owner"); got != "" {
+			t.Errorf("Expected X-Amz-Meta-Owner to be dropped, got '%s'", got)
+		}
+	}
+
+	miss := get()
+	if miss.Header().Get(handlers.HeaderCache) != handlers.CacheStatusMiss {
+		t.Fatalf("Expected first request to miss, got %s", miss.Header().Get(handlers.HeaderCache))
+	}
+	check(miss)
+
+	// The cache is written in the background
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, found, _ := mockCache.Get(context.Background(), "page.html"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the file to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	hit := get()
+	if hit.Header().Get(handlers.HeaderCache) != handlers.CacheStatusHit {
+		t.Fatalf("Expected second request to hit, got %s", hit.Header().Get(handlers.HeaderCache))
+	}
+	check(hit)
+}
+
+func TestGetFile_HeaderPassthroughConfigured(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(nil, mockStorage,
+		handlers.WithHeaderPassthrough([]string{"x-amz-meta-owner", "content-length"}))
+
+	mockStorage.SetObject("data.bin", []byte("payload"))
+	mockStorage.SetObjectHeaders("data.bin", http.Header{
+		"Content-Language": {"fr"},
+		"Content-Length":   {"999"},
+		"X-Amz-Meta-Owner": {"web"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/files/data.bin", nil)
+	req.SetPathValue("name", "data.bin")
+	rec := httptest.NewRecorder()
+	handler.GetFile(rec, req)
+
+	if got := rec.Header().Get("X-Amz-Meta-Owner"); got != "web" {
+		t.Errorf("Expected X-Amz-Meta-Owner 'web', got '%s'", got)
+	}
+	if got := rec.Header().Get("Content-Language"); got != "" {
+		t.Errorf("Expected Content-Language to be dropped, got '%s'", got)
+	}
+	if got := rec.Header().Get("Content-Length"); got != "7" {
+		t.Errorf("Expected Content-Length '7', got '%s'", got)
+	}
+}
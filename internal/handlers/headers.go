@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// DefaultHeaderPassthrough lists the object headers copied onto responses
+// when none are configured
+var DefaultHeaderPassthrough = []string{"Content-Language", "Content-Encoding", "Cache-Control"}
+
+// unsafePassthrough are headers the server manages itself; copying them
+// from object metadata would corrupt responses
+var unsafePassthrough = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Range":     true,
+	"Keep-Alive":        true,
+	"Set-Cookie":        true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	HeaderCache:         true,
+	HeaderCacheAge:      true,
+	HeaderRequestID:     true,
+
+	HeaderFeatureOverrideApplied: true,
+}
+
+// WithHeaderPassthrough sets the object headers, such as Content-Language or
+// X-Amz-Meta-Owner, that are copied from storage onto file responses. They
+// are kept in the cache entry so hits are served with the same headers.
+func WithHeaderPassthrough(names []string) Option {
+	return func(h *FileHandler) {
+		h.passthrough = make(map[string]bool, len(names))
+		for _, name := range names {
+			name = http.CanonicalHeaderKey(name)
+			if unsafePassthrough[name] {
+				slog.Warn("Ignoring unsafe passthrough header", "header", name)
+				continue
+			}
+			h.passthrough[name] = true
+		}
+	}
+}
+
+// WithTTLPolicy sets how long files are cached when their object has no
+// cache-ttl metadata; without one the cache's configured TTL is used
+func WithTTLPolicy(p cache.TTLPolicy) Option {
+	return func(h *FileHandler) {
+		h.ttlPolicy = p
+	}
+}
+
+// passthroughHeaders keeps the allow-listed headers of an object
+func (h *FileHandler) passthroughHeaders(headers map[string]string) map[string]string {
+	var kept map[string]string
+	for name, value := range headers {
+		if !h.passthrough[http.CanonicalHeaderKey(name)] || value == "" {
+			continue
+		}
+		if kept == nil {
+			kept = make(map[string]string)
+		}
+		kept[http.CanonicalHeaderKey(name)] = value
+	}
+	return kept
+}
+
+// getCached reads filename from the cache along with its metadata, which is
+// empty for legacy entries and caches that don't keep any. An entry past the
+// TTL set in its object's metadata is a miss, whatever the cache's own TTL.
+func (h *FileHandler) getCached(ctx context.Context, filename string) (*cache.Entry, bool, error) {
+	ctx, cancel := h.cacheContext(ctx)
+	defer cancel()
+	if entries, ok := h.cache.(cache.EntryCache); ok {
+		entry, found, err := entries.GetEntry(ctx, filename)
+		h.countCacheError("get", err)
+		if found && entry.Expired() {
+			return nil, false, err
+		}
+		return entry, found, err
+	}
+
+	data, age, found, err := h.cache.GetWithAge(ctx, filename)
+	h.countCacheError("get", err)
+	if !found {
+		return nil, found, err
+	}
+	return &cache.Entry{Data: data, Age: age}, true, err
+}
+
+// fetchObject reads filename from storage along with the metadata stored
+// with it. Every header is kept so a later change to the passthrough list
+// applies to entries cached before it.
+func (h *FileHandler) fetchObject(ctx context.Context, filename string) ([]byte, cache.EntryMeta, error) {
+	getter, ok := h.storage.(storage.HeaderGetter)
+	if !ok {
+		data, err := h.storage.GetObject(ctx, filename)
+		return data, cache.EntryMeta{}, err
+	}
+
+	data, headers, err := getter.GetObjectWithHeaders(ctx, filename)
+	if err != nil {
+		return nil, cache.EntryMeta{}, err
+	}
+	return data, cache.MetaFromHeaders(headers), nil
+}
+
+// storeCached writes filename to the cache, with its metadata when the cache
+// supports it
+func (h *FileHandler) storeCached(ctx context.Context, filename string, data []byte, meta cache.EntryMeta) error {
+	ctx, cancel := h.cacheContext(ctx)
+	defer cancel()
+	var err error
+	if entries, ok := h.cache.(cache.EntryCache); ok {
+		ttlSource := "object"
+		if meta.TTL == 0 && h.ttlPolicy != nil {
+			meta.TTL, ttlSource = h.ttlPolicy.TTL(filename), "policy"
+		}
+		err = entries.SetEntry(ctx, filename, data, meta)
+		if err == nil && meta.TTL > 0 {
+			h.metrics.CacheEntryTTL.WithLabelValues(ttlSource).Observe(meta.TTL.Seconds())
+		}
+	} else {
+		err = h.cache.Set(ctx, filename, data)
+	}
+	if err == nil {
+		h.metrics.CacheStoredBytesTotal.Add(float64(len(data)))
+	}
+	h.countCacheError("set", err)
+	return err
+}
+
+// purgeKeys evicts keys and their variants from the cache
+func (h *FileHandler) purgeKeys(ctx context.Context, keys ...string) (int64, error) {
+	ctx, cancel := h.cacheContext(ctx)
+	defer cancel()
+	purged, err := cache.PurgeKeys(ctx, h.cache, keys...)
+	h.countCacheError("delete", err)
+	return purged, err
+}
+
+// countCacheError records a failed cache operation; deleted files refusing
+// to be cached again, and writes skipped while the cache is bypassed,
+// aren't failures
+func (h *FileHandler) countCacheError(operation string, err error) {
+	if err != nil && !errors.Is(err, cache.ErrTombstoned) && !errors.Is(err, cache.ErrCircuitOpen) {
+		h.metrics.CacheErrorsTotal.WithLabelValues(operation).Inc()
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ch374n/file-downloader/internal/hotkeys"
+)
+
+const (
+	// defaultHotKeysLimit is how many keys HotKeys lists by default
+	defaultHotKeysLimit = 20
+	// maxHotKeysLimit caps the keys HotKeys lists
+	maxHotKeysLimit = 1000
+)
+
+// WithHotKeys counts file reads into t to find hot keys
+func WithHotKeys(t *hotkeys.Tracker) Option {
+	return func(h *FileHandler) {
+		h.hotkeys = t
+	}
+}
+
+// WithAdminHotKeys enables listing the most requested keys
+func WithAdminHotKeys(t *hotkeys.Tracker) AdminOption {
+	return func(h *AdminHandler) {
+		h.hotkeys = t
+	}
+}
+
+// HotKeysReport is the response to GET /admin/hotkeys
+type HotKeysReport struct {
+	// Window is how far back rates are measured, in seconds
+	Window float64 `json:"window_seconds"`
+	// Threshold is the rate in requests per second at which keys are hot
+	Threshold float64       `json:"threshold"`
+	Keys      []hotkeys.Key `json:"keys"`
+}
+
+// HotKeys lists the most requested keys over the hot key window, most
+// requested first. The limit query parameter caps how many are listed.
+func (h *AdminHandler) HotKeys(w http.ResponseWriter, r *http.Request) {
+	if h.hotkeys == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "hot key tracking is not configured",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return
+	}
+
+	limit := defaultHotKeysLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHotKeysLimit {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Success:   false,
+				Message:   "limit must be between 1 and " + strconv.Itoa(maxHotKeysLimit),
+				ErrorCode: ErrCodeInvalidRequest,
+			})
+			return
+		}
+		limit = n
+	}
+
+	keys := h.hotkeys.Top(limit)
+	if keys == nil {
+		keys = []hotkeys.Key{}
+	}
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: HotKeysReport{
+			Window:    h.hotkeys.Window().Seconds(),
+			Threshold: h.hotkeys.Threshold(),
+			Keys:      keys,
+		},
+	})
+}
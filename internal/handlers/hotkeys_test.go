@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/hotkeys"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+type hotKeysResponse struct {
+	Success bool                   `json:"success"`
+	Data    handlers.HotKeysReport `json:"data"`
+}
+
+func TestHotKeys(t *testing.T) {
+	tracker := hotkeys.New(hotkeys.Config{Window: time.Minute, Threshold: 0.05}, nil)
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a.png", []byte("a"))
+	mockStorage.SetObject("b.png", []byte("b"))
+	files := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithHotKeys(tracker))
+	admin := handlers.NewAdminHandler(mockCache, handlers.WithAdminHotKeys(tracker))
+
+	for range 3 {
+		getFile(files, "a.png", nil)
+	}
+	getFile(files, "b.png", nil)
+
+	rec := httptest.NewRecorder()
+	admin.HotKeys(rec, httptest.NewRequest(http.MethodGet, "/admin/hotkeys?limit=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var resp hotKeysResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Data.Window != 60 || resp.Data.Threshold != 0.05 {
+		t.Errorf("Unexpected window or threshold: %+v", resp.Data)
+	}
+	if len(resp.Data.Keys) != 1 {
+		t.Fatalf("Expected the limit to cap the keys, got %+v", resp.Data.Keys)
+	}
+	if key := resp.Data.Keys[0]; key.Key != "a.png" || key.Requests != 3 || !key.Hot {
+		t.Errorf("Unexpected busiest key: %+v", key)
+	}
+	if !tracker.Hot("a.png") || tracker.Hot("b.png") {
+		t.Error("Expected only a.png to be hot")
+	}
+}
+
+func TestHotKeys_Errors(t *testing.T) {
+	tracker := hotkeys.New(hotkeys.Config{Window: time.Minute, Threshold: 1}, nil)
+	tests := []struct {
+		name    string
+		handler *handlers.AdminHandler
+		query   string
+		want    int
+	}{
+		{"not configured", handlers.NewAdminHandler(nil), "", http.StatusServiceUnavailable},
+		{"bad limit", handlers.NewAdminHandler(nil, handlers.WithAdminHotKeys(tracker)), "?limit=x", http.StatusBadRequest},
+		{"limit too large", handlers.NewAdminHandler(nil, handlers.WithAdminHotKeys(tracker)), "?limit=1001", http.StatusBadRequest},
+		{"empty", handlers.NewAdminHandler(nil, handlers.WithAdminHotKeys(tracker)), "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.HotKeys(rec, httptest.NewRequest(http.MethodGet, "/admin/hotkeys"+tt.query, nil))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/imaging"
+)
+
+// WithImageTransforms serves resized and converted copies of images when
+// GET /files/{name} is given w, h, format or q query parameters. Each
+// transform is cached as a variant of the file.
+func WithImageTransforms(cfg imaging.Config) Option {
+	return func(h *FileHandler) {
+		h.images = &cfg
+	}
+}
+
+// serveImage writes the transform of filename requested by the query,
+// from the cache when it was made from the file's current ETag
+func (h *FileHandler) serveImage(ctx context.Context, w http.ResponseWriter, r *http.Request, filename string, refresh bool) {
+	opts, err := h.images.ParseOptions(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	key := cache.VariantKey(filename, opts.Variant())
+
+	if h.cache != nil && !refresh && features.Enabled(ctx, features.CacheRead, true) {
+		stat, err := h.statFile(r.Context(), ctx, filename)
+		if err != nil {
+			h.writeReadFailure(r.Context(), ctx, w, "image", filename, err)
+			return
+		}
+		entry, found, err := h.getCached(ctx, key)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read cached image", "key", key, "error", err)
+		}
+		if found && entry.Meta.ETag == stat.meta.ETag {
+			h.metrics.ImageTransformsTotal.WithLabelValues("hit").Inc()
+			w.Header().Set(HeaderCache, CacheStatusHit)
+			h.writeFileResponse(ctx, w, r, filename, entry.Data, imageMeta(stat.meta, entry.Meta.ContentType, opts), true)
+			return
+		}
+	}
+
+	file, err := h.readThrough(r.Context(), ctx, filename, refresh)
+	if err != nil {
+		h.writeReadFailure(r.Context(), ctx, w, "image", filename, err)
+		return
+	}
+	data, format, err := h.images.Transform(file.data, opts)
+	if err != nil {
+		h.metrics.ImageTransformsTotal.WithLabelValues("failed").Inc()
+		slog.InfoContext(ctx, "Failed to transform image", "filename", filename, "error", err)
+		status, code := http.StatusBadRequest, ErrCodeInvalidRequest
+		if errors.Is(err, imaging.ErrTooLarge) {
+			status, code = http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+	h.metrics.ImageTransformsTotal.WithLabelValues("transformed").Inc()
+
+	meta := file.meta
+	meta.ContentType = imaging.ContentType(format)
+	if h.cache != nil && meta.ETag != "" {
+		go h.storeVariant(ctx, filename, key, data, meta)
+	}
+	w.Header().Set(HeaderCache, CacheStatusMiss)
+	h.writeFileResponse(ctx, w, r, filename, data, imageMeta(file.meta, meta.ContentType, opts), false)
+}
+
+// imageMeta describes a transformed image of the file described by meta.
+// Its ETag is derived from the file's, so clients can revalidate each
+// transform separately.
+func imageMeta(meta cache.EntryMeta, contentType string, opts imaging.Options) cache.EntryMeta {
+	out := cache.EntryMeta{ContentType: contentType, LastModified: meta.LastModified}
+	if meta.ETag != "" {
+		out.ETag = strings.TrimSuffix(meta.ETag, `"`) + "-" + opts.Variant() + `"`
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/imaging"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestGetFile_ImageTransforms(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewNRGBA(image.Rect(0, 0, 800, 600))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	mockCache := mocks.NewMockCache()
+	mockCache.SetEntryData("photos/cat.png", src.Bytes(), cache.EntryMeta{ETag: `"v1"`, ContentType: "image/png"})
+	handler := handlers.NewFileHandler(mockCache, mocks.NewMockStorage(),
+		handlers.WithImageTransforms(imaging.Config{MaxDimension: 2000, Sizes: []int{200, 400}, MaxPixels: 1_000_000}),
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name...}", handler.GetFile)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/files/photos/cat.png?w=400&format=jpeg")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	config, format, err := image.DecodeConfig(rec.Body)
+	if err != nil || format != "jpeg" || config.Width != 400 || config.Height != 300 {
+		t.Errorf("Expected a 400x300 JPEG, got %dx%d %s (%v)", config.Width, config.Height, format, err)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %q", got)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || etag == `"v1"` {
+		t.Errorf("Expected an ETag for the transform, got %q", etag)
+	}
+
+	// The transform is cached as a variant of the file
+	deadline := time.Now().Add(time.Second)
+	for {
+		if variants, _ := mockCache.Variants(context.Background(), "photos/cat.png"); len(variants) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the transform to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	rec = get("/files/photos/cat.png?w=400&format=jpeg")
+	if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusHit || rec.Header().Get("ETag") != etag {
+		t.Errorf("Expected the cached transform, got %s with ETag %q", got, rec.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/files/photos/cat.png?w=300", http.StatusBadRequest},
+		{"/files/photos/cat.png?format=webp", http.StatusBadRequest},
+		{"/files/photos/missing.png?w=200", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := get(tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.target, tt.status, rec.Code)
+			continue
+		}
+		var resp handlers.Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Success {
+			t.Errorf("%s: expected an error response, got %s", tt.target, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/scheduler"
+)
+
+// ListJobs handles requests listing scheduled jobs and their last runs
+func (h *AdminHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	if !h.requireScheduler(w) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    h.scheduler.Status(),
+	})
+}
+
+// RunJob handles requests to run a scheduled job immediately
+func (h *AdminHandler) RunJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireScheduler(w) {
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := h.scheduler.Trigger(name); err != nil {
+		status, code := http.StatusInternalServerError, ErrCodeInternal
+		switch {
+		case errors.Is(err, scheduler.ErrJobNotFound):
+			status, code = http.StatusNotFound, ErrCodeNotFound
+		case errors.Is(err, scheduler.ErrJobRunning):
+			status, code = http.StatusConflict, ErrCodeConflict
+		case errors.Is(err, scheduler.ErrNotStarted):
+			status, code = http.StatusServiceUnavailable, ErrCodeFeatureDisabled
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Job triggered", "job", name)
+	writeJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Message: "Job triggered",
+	})
+}
+
+func (h *AdminHandler) requireScheduler(w http.ResponseWriter) bool {
+	if h.scheduler == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "no scheduled jobs are configured",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return false
+	}
+	return true
+}
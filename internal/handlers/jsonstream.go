@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// DefaultMaxResponseBytes caps the size of streamed JSON list responses
+const DefaultMaxResponseBytes = 8 << 20
+
+// WithMaxResponseBytes caps the size of JSON list responses
+func WithMaxResponseBytes(n int64) Option {
+	return func(h *FileHandler) {
+		h.SetMaxResponseBytes(n)
+	}
+}
+
+// SetMaxResponseBytes changes the cap on JSON list responses, applying to
+// responses started from now on
+func (h *FileHandler) SetMaxResponseBytes(n int64) {
+	h.maxResponseBytes.Store(n)
+}
+
+// errResponseTooLarge is returned when an item doesn't fit under the cap
+var errResponseTooLarge = errors.New("response size limit reached")
+
+// trailerReserve is kept free below the cap for the closing fields of a
+// list response, such as the next cursor
+const trailerReserve = 4 << 10
+
+// jsonList streams a success response whose data object holds one array,
+// encoding items one at a time so a response is never built in memory.
+// Nothing is written until the first item is accepted, so callers can still
+// send an error response when even one item doesn't fit.
+type jsonList struct {
+	w       http.ResponseWriter
+	field   string
+	limit   int64
+	written int64
+	count   int
+	buf     bytes.Buffer
+	enc     *json.Encoder
+	err     error
+}
+
+func newJSONList(w http.ResponseWriter, field string, limit int64) *jsonList {
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	l := &jsonList{w: w, field: field, limit: limit}
+	l.enc = json.NewEncoder(&l.buf)
+	return l
+}
+
+// Add appends v to the array. It returns errResponseTooLarge, writing
+// nothing, when v would push the response over the size cap.
+func (l *jsonList) Add(v any) error {
+	if l.err != nil {
+		return l.err
+	}
+
+	l.buf.Reset()
+	if l.count == 0 {
+		l.buf.WriteString(`{"success":true,"data":{"`)
+		l.buf.WriteString(l.field)
+		l.buf.WriteString(`":[`)
+	} else {
+		l.buf.WriteByte(',')
+	}
+	if err := l.enc.Encode(v); err != nil {
+		return err
+	}
+	// Encode terminates each value with a newline
+	l.buf.Truncate(l.buf.Len() - 1)
+
+	if l.written+int64(l.buf.Len())+trailerReserve > l.limit {
+		return errResponseTooLarge
+	}
+	if l.count == 0 {
+		l.w.Header().Set("Content-Type", "application/json")
+		l.w.WriteHeader(http.StatusOK)
+	}
+	n, err := l.w.Write(l.buf.Bytes())
+	l.written += int64(n)
+	l.count++
+	l.err = err
+	return err
+}
+
+// Len returns the number of items written
+func (l *jsonList) Len() int {
+	return l.count
+}
+
+// Close ends the array and the response. extra holds further fields of the
+// data object; empty values are omitted.
+func (l *jsonList) Close(extra map[string]string) {
+	if l.err != nil {
+		return
+	}
+
+	l.buf.Reset()
+	if l.count == 0 {
+		l.w.Header().Set("Content-Type", "application/json")
+		l.w.WriteHeader(http.StatusOK)
+		l.buf.WriteString(`{"success":true,"data":{"`)
+		l.buf.WriteString(l.field)
+		l.buf.WriteString(`":[`)
+	}
+	l.buf.WriteByte(']')
+	for name, value := range extra {
+		if value == "" {
+			continue
+		}
+		l.buf.WriteByte(',')
+		_ = l.enc.Encode(name)
+		l.buf.Truncate(l.buf.Len() - 1)
+		l.buf.WriteByte(':')
+		_ = l.enc.Encode(value)
+		l.buf.Truncate(l.buf.Len() - 1)
+	}
+	l.buf.WriteString("}}\n")
+	_, l.err = l.w.Write(l.buf.Bytes())
+}
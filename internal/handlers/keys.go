@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+// AddKeyRequest registers a new signing key. A secret is generated when omitted.
+type AddKeyRequest struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// ListKeys handles requests listing the signing keys in the keyring
+func (h *AdminHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.requireKeyring(w) {
+		return
+	}
+
+	h.keyring.Prune()
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    h.keyring.Keys(),
+	})
+}
+
+// AddKey handles requests adding a new signing key, which immediately
+// becomes the key used for new signatures
+func (h *AdminHandler) AddKey(w http.ResponseWriter, r *http.Request) {
+	if !h.requireKeyring(w) {
+		return
+	}
+
+	var req AddKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil || req.ID == "" {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "id is required",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	secret := []byte(req.Secret)
+	generated := len(secret) == 0
+	if generated {
+		var err error
+		if secret, err = signing.GenerateSecret(); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to generate signing key", "error", err)
+			writeJSON(w, http.StatusInternalServerError, Response{
+				Success:   false,
+				Message:   "Failed to generate signing key",
+				ErrorCode: ErrCodeInternal,
+			})
+			return
+		}
+	}
+
+	if err := h.keyring.Add(req.ID, secret); err != nil {
+		status, code := http.StatusBadRequest, ErrCodeInvalidRequest
+		if errors.Is(err, signing.ErrKeyExists) {
+			status, code = http.StatusConflict, ErrCodeConflict
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Signing key added", "key_id", req.ID)
+
+	data := SigningKeyAdded{ID: req.ID}
+	if generated {
+		data.Secret = string(secret)
+	}
+	writeJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Signing key added",
+		Data:    data,
+	})
+}
+
+// RetireKey handles requests retiring a signing key. Signatures made with
+// the key keep verifying for the overlap window (?overlap=, default from config).
+func (h *AdminHandler) RetireKey(w http.ResponseWriter, r *http.Request) {
+	if !h.requireKeyring(w) {
+		return
+	}
+
+	id := r.PathValue("id")
+	overlap := h.keyOverlap
+	if v := r.URL.Query().Get("overlap"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Success:   false,
+				Message:   "invalid overlap duration",
+				ErrorCode: ErrCodeInvalidRequest,
+			})
+			return
+		}
+		overlap = d
+	}
+
+	if err := h.keyring.Retire(id, overlap); err != nil {
+		status, code := http.StatusConflict, ErrCodeConflict
+		if errors.Is(err, signing.ErrKeyNotFound) {
+			status, code = http.StatusNotFound, ErrCodeNotFound
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Signing key retired", "key_id", id, "overlap", overlap)
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Signing key retired",
+		Data: SigningKeyRetired{
+			ID:        id,
+			ExpiresAt: timestamp(time.Now().Add(overlap)),
+		},
+	})
+}
+
+func (h *AdminHandler) requireKeyring(w http.ResponseWriter) bool {
+	if h.keyring == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "signing is not configured",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return false
+	}
+	return true
+}
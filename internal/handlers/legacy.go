@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/legacy"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// WithLegacyOrigin serves files missing from storage from a legacy HTTP
+// server, for the prefixes it covers
+func WithLegacyOrigin(o *legacy.Origin) Option {
+	return func(h *FileHandler) {
+		h.legacy = o
+	}
+}
+
+// fetchLegacy looks up a file missing from storage on the legacy origin,
+// copying it into storage when the origin backfills
+func (h *FileHandler) fetchLegacy(ctx context.Context, filename string) ([]byte, cache.EntryMeta, error) {
+	data, headers, err := h.legacy.Fetch(ctx, filename)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.metrics.LegacyRequestsTotal.WithLabelValues("not_found").Inc()
+		return nil, cache.EntryMeta{}, err
+	case err != nil:
+		h.metrics.LegacyRequestsTotal.WithLabelValues("error").Inc()
+		return nil, cache.EntryMeta{}, err
+	}
+	h.metrics.LegacyRequestsTotal.WithLabelValues("found").Inc()
+	slog.InfoContext(ctx, "Served file from legacy origin", "filename", filename, "size", len(data))
+
+	meta := cache.MetaFromHeaders(headers)
+	if h.legacy.Backfill() {
+		go h.backfill(ctx, filename, data, meta)
+	}
+	return data, meta, nil
+}
+
+// backfill copies a file found on the legacy origin into storage, so later
+// requests no longer depend on the legacy server
+func (h *FileHandler) backfill(ctx context.Context, filename string, data []byte, meta cache.EntryMeta) {
+	// Detach from the request so the upload outlives it but keeps its log context
+	ctx, cancel := h.requestContext(context.WithoutCancel(ctx))
+	defer cancel()
+
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = contentTypeFor(filename)
+	}
+	if err := h.storage.PutObject(ctx, filename, bytes.NewReader(data), contentType); err != nil {
+		slog.ErrorContext(ctx, "Failed to backfill file from legacy origin", "filename", filename, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Backfilled file from legacy origin", "filename", filename)
+}
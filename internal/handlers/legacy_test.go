@@ -0,0 +1,93 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/legacy"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func newLegacyOrigin(t *testing.T, backfill bool) *legacy.Origin {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/archive/old.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("from legacy"))
+	}))
+	t.Cleanup(server.Close)
+
+	origin, err := legacy.New(legacy.Config{BaseURL: server.URL, Prefixes: []string{"archive/"}, Backfill: backfill})
+	if err != nil {
+		t.Fatalf("legacy.New failed: %v", err)
+	}
+	return origin
+}
+
+func TestGetFile_LegacyFallback(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithLegacyOrigin(newLegacyOrigin(t, true)))
+
+	rec := getFile(handler, "archive/old.txt", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "from legacy" {
+		t.Errorf("Expected the legacy file, got %q", rec.Body.String())
+	}
+
+	// Storage and the cache are back-filled in the background
+	ctx := context.Background()
+	deadline := time.Now().Add(time.Second)
+	for {
+		exists, _ := mockStorage.ObjectExists(ctx, "archive/old.txt")
+		_, cached, _ := mockCache.Get(ctx, "archive/old.txt")
+		if exists && cached {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for backfill: in storage %v, cached %v", exists, cached)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := mockStorage.PutCalls[0].ContentType; got != "text/plain" {
+		t.Errorf("Expected the legacy Content-Type to be stored, got %q", got)
+	}
+}
+
+func TestGetFile_LegacyFallbackWithoutBackfill(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithLegacyOrigin(newLegacyOrigin(t, false)))
+
+	if rec := getFile(handler, "archive/old.txt", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	ctx := context.Background()
+	if exists, _ := mockStorage.ObjectExists(ctx, "archive/old.txt"); exists {
+		t.Error("Expected storage not to be back-filled")
+	}
+	if _, cached, _ := mockCache.Get(ctx, "archive/old.txt"); cached {
+		t.Error("Expected the legacy file not to be cached")
+	}
+}
+
+func TestGetFile_LegacyFallbackNotFound(t *testing.T) {
+	handler := handlers.NewFileHandler(mocks.NewMockCache(), mocks.NewMockStorage(), handlers.WithLegacyOrigin(newLegacyOrigin(t, true)))
+
+	for _, name := range []string{"archive/missing.txt", "reports/old.txt"} {
+		if rec := getFile(handler, name, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/inflight"
+)
+
+// retryAfterSaturated is the Retry-After sent with requests turned away by
+// the concurrency limit, in seconds
+const retryAfterSaturated = "1"
+
+// LimitMiddleware serves requests only while l has a slot for them,
+// answering 503 with Retry-After when every slot is taken and the queue is
+// full. A nil l serves every request.
+func LimitMiddleware(l *inflight.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, err := l.Acquire(r.Context())
+		if err != nil {
+			if !errors.Is(err, inflight.ErrSaturated) {
+				// The client went away while queued
+				w.WriteHeader(StatusClientClosedRequest)
+				return
+			}
+			slog.DebugContext(r.Context(), "Too many requests in flight", "path", r.URL.Path,
+				"in_flight", l.InFlight(), "queued", l.Queued())
+			w.Header().Set("Retry-After", retryAfterSaturated)
+			writeJSON(w, http.StatusServiceUnavailable, Response{
+				Success:   false,
+				Message:   "Too many requests in flight, retry later",
+				ErrorCode: ErrCodeTooManyRequests,
+			})
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/inflight"
+)
+
+func TestLimitMiddleware(t *testing.T) {
+	l := inflight.New(inflight.Config{MaxInFlight: 1}, nil)
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := handlers.LimitMiddleware(l, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusOK)
+	})
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(first, httptest.NewRequest(http.MethodGet, "/files/a.txt", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/files/b.txt", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d while saturated, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+	var resp handlers.Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.ErrorCode != handlers.ErrCodeTooManyRequests {
+		t.Errorf("Expected error code %s, got %+v (%v)", handlers.ErrCodeTooManyRequests, resp, err)
+	}
+
+	close(finish)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Errorf("Expected the admitted request to be served, got %d", first.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Listing page size bounds
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// FileInfo describes a file in a listing
+type FileInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// SizeHuman is Size in binary units, set with ?pretty=true
+	SizeHuman    string    `json:"size_human,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ListFilesResponse is one page of a file listing
+type ListFilesResponse struct {
+	Files      []FileInfo `json:"files"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// resumeCursorPrefix marks cursors that resume part-way through a storage
+// page; storage continuation tokens never start with it
+const resumeCursorPrefix = "~"
+
+// listCursor is a position in a listing: a storage continuation token and
+// the number of objects of that page already returned
+type listCursor struct {
+	Token string `json:"t,omitempty"`
+	Skip  int    `json:"s"`
+}
+
+func parseListCursor(raw string) (listCursor, error) {
+	encoded, ok := strings.CutPrefix(raw, resumeCursorPrefix)
+	if !ok {
+		return listCursor{Token: raw}, nil
+	}
+
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err == nil && (c.Skip < 0 || c.Skip >= maxListLimit) {
+		err = errors.New("skip out of range")
+	}
+	return c, err
+}
+
+func (c listCursor) String() string {
+	if c.Skip == 0 {
+		return c.Token
+	}
+	data, _ := json.Marshal(c)
+	return resumeCursorPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ListFiles handles paginated file listing requests. Responses are streamed
+// and capped in size; a page that hits the cap ends early with a cursor that
+// resumes where it stopped.
+func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	cursor, err := parseListCursor(query.Get("cursor"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid cursor",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	limit := defaultListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Success:   false,
+				Message:   "limit must be between 1 and " + strconv.Itoa(maxListLimit),
+				ErrorCode: ErrCodeInvalidRequest,
+			})
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	start := time.Now()
+	result, err := h.storage.ListObjects(ctx, prefix, cursor.Token, min(cursor.Skip+limit, maxListLimit))
+	h.metrics.R2RequestDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		kind := classifyFailure(r.Context(), ctx, err)
+		h.metrics.R2RequestsTotal.WithLabelValues("list", string(kind)).Inc()
+		if h.writeTimeoutOrCancel(ctx, w, kind, "list", "prefix", prefix, "error", err) {
+			return
+		}
+
+		slog.ErrorContext(ctx, "Storage list error", "prefix", prefix, "error", err)
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Failed to list files",
+			ErrorCode: ErrCodeStorageError,
+		})
+		return
+	}
+
+	h.metrics.R2RequestsTotal.WithLabelValues("list", "success").Inc()
+
+	objects := result.Objects[min(cursor.Skip, len(result.Objects)):]
+	next := result.NextToken
+	pretty := wantsPretty(r)
+	list := newJSONList(w, "files", h.maxResponseBytes.Load())
+	for i, obj := range objects {
+		info := FileInfo{
+			Name:         obj.Key,
+			Size:         obj.Size,
+			LastModified: timestamp(obj.LastModified),
+		}
+		if pretty {
+			info.SizeHuman = humanBytes(obj.Size)
+		}
+		err := list.Add(info)
+		if errors.Is(err, errResponseTooLarge) {
+			if list.Len() == 0 {
+				writeJSON(w, http.StatusRequestEntityTooLarge, Response{
+					Success:   false,
+					Message:   "listing entry exceeds the response size limit",
+					ErrorCode: ErrCodePayloadTooLarge,
+				})
+				return
+			}
+			h.metrics.ResponseTruncationsTotal.WithLabelValues("list").Inc()
+			next = listCursor{Token: cursor.Token, Skip: cursor.Skip + i}.String()
+			break
+		}
+		if err != nil {
+			slog.DebugContext(ctx, "Failed to write listing", "prefix", prefix, "error", err)
+			return
+		}
+	}
+	list.Close(map[string]string{"next_cursor": next})
+}
@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+type listResponse struct {
+	Success bool                       `json:"success"`
+	Message string                     `json:"message"`
+	Data    handlers.ListFilesResponse `json:"data"`
+}
+
+func listFiles(t *testing.T, handler *handlers.FileHandler, url string) (*httptest.ResponseRecorder, listResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	rec := httptest.NewRecorder()
+
+	handler.ListFiles(rec, req)
+
+	var resp listResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return rec, resp
+}
+
+func TestListFiles_Pagination(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("reports/a.pdf", []byte("aaa"))
+	mockStorage.SetObject("reports/b.pdf", []byte("bb"))
+	mockStorage.SetObject("reports/c.pdf", []byte("c"))
+	mockStorage.SetObject("other.txt", []byte("x"))
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	rec, resp := listFiles(t, handler, "/files?prefix=reports/&limit=2")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if len(resp.Data.Files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(resp.Data.Files))
+	}
+	if resp.Data.Files[0].Name != "reports/a.pdf" || resp.Data.Files[0].Size != 3 {
+		t.Errorf("Unexpected first file: %+v", resp.Data.Files[0])
+	}
+	if resp.Data.NextCursor == "" {
+		t.Fatal("Expected a next cursor")
+	}
+
+	_, resp = listFiles(t, handler, "/files?prefix=reports/&limit=2&cursor="+resp.Data.NextCursor)
+
+	if len(resp.Data.Files) != 1 || resp.Data.Files[0].Name != "reports/c.pdf" {
+		t.Errorf("Unexpected second page: %+v", resp.Data.Files)
+	}
+	if resp.Data.NextCursor != "" {
+		t.Errorf("Expected no next cursor, got '%s'", resp.Data.NextCursor)
+	}
+}
+
+func TestListFiles_Pretty(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("small.txt", []byte("abc"))
+	mockStorage.SetObject("large.bin", make([]byte, 1536))
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	rec, resp := listFiles(t, handler, "/files")
+	if strings.Contains(rec.Body.String(), "size_human") {
+		t.Errorf("Expected no human-readable sizes by default, got %s", rec.Body.String())
+	}
+
+	_, resp = listFiles(t, handler, "/files?pretty=true")
+	sizes := map[string]string{}
+	for _, f := range resp.Data.Files {
+		sizes[f.Name] = f.SizeHuman
+		if f.LastModified.Location() != time.UTC || f.LastModified.Nanosecond() != 0 {
+			t.Errorf("Expected a UTC timestamp to the second, got %v", f.LastModified)
+		}
+	}
+	if sizes["small.txt"] != "3 B" || sizes["large.bin"] != "1.5 KiB" {
+		t.Errorf("Unexpected human-readable sizes %v", sizes)
+	}
+}
+
+func TestListFiles_InvalidLimit(t *testing.T) {
+	handler := handlers.NewFileHandler(nil, mocks.NewMockStorage())
+
+	for _, limit := range []string{"0", "abc", "5000"} {
+		rec, resp := listFiles(t, handler, "/files?limit="+limit)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: expected status %d, got %d", limit, http.StatusBadRequest, rec.Code)
+		}
+		if resp.Success {
+			t.Errorf("limit=%s: expected success to be false", limit)
+		}
+	}
+}
+
+func TestListFiles_StorageError(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.ListError = mocks.ErrStorageError
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	rec, _ := listFiles(t, handler, "/files")
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestListFiles_ResponseSizeLimit(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	want := make(map[string]bool)
+	for i := range 50 {
+		name := fmt.Sprintf("logs/%03d-%s.txt", i, strings.Repeat("x", 200))
+		mockStorage.SetObject(name, []byte("x"))
+		want[name] = true
+	}
+	// Room for a handful of entries per response
+	handler := handlers.NewFileHandler(nil, mockStorage, handlers.WithMaxResponseBytes(6<<10))
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 50 {
+			t.Fatal("Listing did not terminate")
+		}
+		rec, resp := listFiles(t, handler, "/files?prefix=logs/&limit=20&cursor="+url.QueryEscape(cursor))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if rec.Body.Len() > 6<<10 {
+			t.Errorf("Response of %d bytes exceeds the limit", rec.Body.Len())
+		}
+		if len(resp.Data.Files) == 0 {
+			t.Fatal("Expected a non-empty page")
+		}
+		for _, f := range resp.Data.Files {
+			if seen[f.Name] {
+				t.Errorf("File %s listed twice", f.Name)
+			}
+			seen[f.Name] = true
+		}
+		if cursor = resp.Data.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if len(seen) != len(want) {
+		t.Errorf("Expected %d files across pages, got %d", len(want), len(seen))
+	}
+}
+
+func TestListFiles_EntryTooLarge(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a.txt", []byte("a"))
+	handler := handlers.NewFileHandler(nil, mockStorage, handlers.WithMaxResponseBytes(1<<10))
+
+	rec, resp := listFiles(t, handler, "/files")
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	if resp.Success {
+		t.Error("Expected success to be false")
+	}
+}
+
+func TestListFiles_InvalidCursor(t *testing.T) {
+	handler := handlers.NewFileHandler(nil, mocks.NewMockStorage())
+
+	rec, _ := listFiles(t, handler, "/files?cursor=~not-base64!")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/logger"
+)
+
+// LogLevelRequest sets the minimum level logged
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// LogLevel reports the minimum level logged, and the level it replaced
+// when it was just changed
+type LogLevel struct {
+	Level    string `json:"level"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// GetLogLevel handles requests for the current log level
+func (h *AdminHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    LogLevel{Level: logger.Level()},
+	})
+}
+
+// SetLogLevel handles requests to change the log level at runtime, such as
+// to debug during an incident. The change lasts until the next restart, or
+// until a reload changes LOG_LEVEL.
+func (h *AdminHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	if _, ok := logger.ParseLevel(req.Level); !ok {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "level must be one of debug, info, warn or error",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	previous := logger.Level()
+	logger.SetLevel(req.Level)
+	credential := ""
+	if cred, ok := auth.CredentialFrom(r.Context()); ok {
+		credential = cred.Name
+	}
+	// Logged at warn so the change is seen at any level
+	slog.WarnContext(r.Context(), "Log level changed",
+		"level", req.Level,
+		"previous", previous,
+		"credential", credential,
+	)
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    LogLevel{Level: logger.Level(), Previous: previous},
+	})
+}
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	previous := logger.Level()
+	t.Cleanup(func() { logger.SetLevel(previous) })
+	logger.SetLevel("info")
+	handler := handlers.NewAdminHandler(nil)
+
+	rec := httptest.NewRecorder()
+	handler.SetLogLevel(rec, httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(`{"level":"debug"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	resp := parseResponse(t, rec.Body.Bytes())
+	if resp.Data["level"] != "debug" || resp.Data["previous"] != "info" {
+		t.Errorf("Expected the new and previous levels, got %+v", resp.Data)
+	}
+	if got := logger.Level(); got != "debug" {
+		t.Errorf("Expected the level to change at once, got %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.GetLogLevel(rec, httptest.NewRequest(http.MethodGet, "/admin/loglevel", nil))
+	if resp := parseResponse(t, rec.Body.Bytes()); resp.Data["level"] != "debug" {
+		t.Errorf("Expected the current level, got %+v", resp.Data)
+	}
+
+	// /health reports the level too
+	rec = httptest.NewRecorder()
+	handlers.NewFileHandler(nil, mocks.NewMockStorage()).Health(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if resp := parseResponse(t, rec.Body.Bytes()); resp.Data["log_level"] != "debug" {
+		t.Errorf("Expected the health status to include the level, got %+v", resp.Data)
+	}
+}
+
+func TestSetLogLevel_Invalid(t *testing.T) {
+	previous := logger.Level()
+	handler := handlers.NewAdminHandler(nil)
+
+	for _, body := range []string{`{"level":"verbose"}`, `{}`, `not json`} {
+		rec := httptest.NewRecorder()
+		handler.SetLogLevel(rec, httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, rec.Code)
+		}
+	}
+	if got := logger.Level(); got != previous {
+		t.Errorf("Expected the level to stay %q, got %q", previous, got)
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/policy"
+)
+
+// memberSeparator splits an archive's name from the path of a file inside
+// it, as in firmware.zip!/boot/config.txt
+const memberSeparator = "!/"
+
+// Archive member failures
+var (
+	// errMemberNotFound is returned for paths the archive doesn't hold
+	errMemberNotFound = errors.New("file not found in archive")
+	// errInvalidArchive is returned for archives that can't be read
+	errInvalidArchive = errors.New("invalid archive")
+	// errMemberTooLarge is returned for files over the extraction limit
+	errMemberTooLarge = errors.New("file in archive too large")
+)
+
+// WithArchiveMembers serves single files from inside stored .zip, .tar,
+// .tar.gz and .tgz archives at GET /files/{archive}!/{path}, extracting at
+// most maxBytes. Each extracted file is cached as a variant of the archive.
+func WithArchiveMembers(maxBytes int64) Option {
+	return func(h *FileHandler) {
+		h.memberMaxBytes = maxBytes
+	}
+}
+
+// splitMember splits name into an archive and the path of a file inside
+// it. Names whose part before the separator isn't a supported archive are
+// left whole.
+func splitMember(name string) (string, string, bool) {
+	archive, member, ok := strings.Cut(name, memberSeparator)
+	if !ok || member == "" || archiveKind(archive) == "" {
+		return "", "", false
+	}
+	return archive, member, true
+}
+
+// archiveKind returns zip, tar or tar.gz for names with an archive
+// extension, or an empty string for other names
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	}
+	return ""
+}
+
+// serveMember writes the file at member inside archive, from the cache
+// when it was extracted from the archive's current ETag
+func (h *FileHandler) serveMember(ctx context.Context, w http.ResponseWriter, r *http.Request, archive, member string, refresh bool) {
+	// Deny policies for the archive cover the files inside it
+	if !hasSignedAccess(ctx) && h.policy.Denied(&policy.Request{Name: archive, Method: r.Method}) {
+		slog.InfoContext(ctx, "Request denied by policy", "filename", archive)
+		writeJSON(w, http.StatusForbidden, Response{
+			Success:   false,
+			Message:   "Access denied",
+			ErrorCode: ErrCodeAccessDenied,
+		})
+		return
+	}
+
+	name := archive + memberSeparator + member
+	key := cache.VariantKey(archive, "member:"+member)
+
+	if h.cache != nil && !refresh && features.Enabled(ctx, features.CacheRead, true) {
+		stat, err := h.statFile(r.Context(), ctx, archive)
+		if err != nil {
+			h.writeReadFailure(r.Context(), ctx, w, "member", archive, err)
+			return
+		}
+		entry, found, err := h.getCached(ctx, key)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read cached archive member", "key", key, "error", err)
+		}
+		if found && entry.Meta.ETag == stat.meta.ETag {
+			h.metrics.ArchiveMembersTotal.WithLabelValues("hit").Inc()
+			w.Header().Set(HeaderCache, CacheStatusHit)
+			h.writeFileResponse(ctx, w, r, name, entry.Data, memberMeta(stat.meta, member), true)
+			return
+		}
+	}
+
+	file, err := h.readThrough(r.Context(), ctx, archive, refresh)
+	if err != nil {
+		h.writeReadFailure(r.Context(), ctx, w, "member", archive, err)
+		return
+	}
+	data, err := extractMember(file.data, archiveKind(archive), member, h.memberMaxBytes)
+	if err != nil {
+		h.metrics.ArchiveMembersTotal.WithLabelValues("failed").Inc()
+		slog.InfoContext(ctx, "Failed to extract archive member", "archive", archive, "member", member, "error", err)
+		status, code := http.StatusBadRequest, ErrCodeInvalidRequest
+		switch {
+		case errors.Is(err, errMemberNotFound):
+			status, code = http.StatusNotFound, ErrCodeFileNotFound
+		case errors.Is(err, errMemberTooLarge):
+			status, code = http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+	h.metrics.ArchiveMembersTotal.WithLabelValues("extracted").Inc()
+
+	if h.cache != nil && file.meta.ETag != "" {
+		go h.storeVariant(ctx, archive, key, data, file.meta)
+	}
+	w.Header().Set(HeaderCache, CacheStatusMiss)
+	h.writeFileResponse(ctx, w, r, name, data, memberMeta(file.meta, member), false)
+}
+
+// memberMeta describes the file at member inside the archive described by
+// meta. Its content type comes from the member's extension and its ETag is
+// derived from the archive's.
+func memberMeta(meta cache.EntryMeta, member string) cache.EntryMeta {
+	out := cache.EntryMeta{LastModified: meta.LastModified}
+	if meta.ETag != "" {
+		out.ETag = fmt.Sprintf(`%s-%08x"`, strings.TrimSuffix(meta.ETag, `"`), crc32.ChecksumIEEE([]byte(member)))
+	}
+	return out
+}
+
+// extractMember reads the regular file at member from an archive of the
+// given kind, failing once it exceeds maxBytes
+func extractMember(data []byte, kind, member string, maxBytes int64) ([]byte, error) {
+	member = entryName(member)
+	if kind == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+		}
+		for _, f := range zr.File {
+			if entryName(f.Name) != member || f.Mode().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+			}
+			defer rc.Close()
+			return readMember(rc, maxBytes)
+		}
+		return nil, errMemberNotFound
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	if kind == "tar.gz" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errMemberNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+		}
+		if hdr.Typeflag == tar.TypeReg && entryName(hdr.Name) == member {
+			return readMember(tr, maxBytes)
+		}
+	}
+}
+
+// readMember reads r whole, failing once it exceeds maxBytes, so archives
+// that inflate to a huge file can't exhaust memory
+func readMember(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", errMemberTooLarge, maxBytes)
+	}
+	return data, nil
+}
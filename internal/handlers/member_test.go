@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestGetFile_ArchiveMembers(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for name, data := range map[string]string{"boot/config.txt": "speed=fast", "big.bin": "0123456789abcdef"} {
+		fw, _ := zw.Create(name)
+		fw.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	var tarred bytes.Buffer
+	gz := gzip.NewWriter(&tarred)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "./docs/readme.md", Mode: 0o644, Size: 5})
+	tw.Write([]byte("hello"))
+	tw.Close()
+	gz.Close()
+
+	mockCache := mocks.NewMockCache()
+	mockCache.SetEntryData("firmware/v2.zip", zipped.Bytes(), cache.EntryMeta{ETag: `"v2"`})
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("bundles/docs.tar.gz", tarred.Bytes())
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithArchiveMembers(12))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name...}", handler.GetFile)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/files/firmware/v2.zip!/boot/config.txt")
+	if rec.Code != http.StatusOK || rec.Body.String() != "speed=fast" {
+		t.Fatalf("Expected the member, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the member's content type, got %q", got)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || etag == `"v2"` {
+		t.Errorf("Expected an ETag for the member, got %q", etag)
+	}
+
+	// The member is cached as a variant of the archive
+	deadline := time.Now().Add(time.Second)
+	for {
+		if variants, _ := mockCache.Variants(context.Background(), "firmware/v2.zip"); len(variants) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the member to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	rec = get("/files/firmware/v2.zip!/boot/config.txt")
+	if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusHit || rec.Header().Get("ETag") != etag {
+		t.Errorf("Expected the cached member, got %s with ETag %q", got, rec.Header().Get("ETag"))
+	}
+
+	rec = get("/files/bundles/docs.tar.gz!/docs/readme.md")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("Expected the tar member, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/files/firmware/v2.zip!/missing.txt", http.StatusNotFound},
+		{"/files/firmware/v2.zip!/big.bin", http.StatusRequestEntityTooLarge},
+		{"/files/firmware/v3.zip!/boot/config.txt", http.StatusNotFound},
+		{"/files/bundles/docs.tar.gz!/docs", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := get(tt.target); rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.target, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestGetFile_ArchiveMembersDisabled(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("odd.zip!/name.txt", []byte("a plain file"))
+	handler := handlers.NewFileHandler(nil, mockStorage)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/files/odd.zip!/name.txt", nil)
+	req.SetPathValue("name", "odd.zip!/name.txt")
+	handler.GetFile(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "a plain file" {
+		t.Errorf("Expected the file named with the separator, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// DefaultPartSize is the multipart part size used when none is configured
+const DefaultPartSize = 16 * 1024 * 1024
+
+// maxUploadParts is the most parts an S3-compatible upload may have
+const maxUploadParts = 10000
+
+// MultipartUpload describes an in-progress resumable upload. Part n covers
+// bytes [(n-1)*PartSize, n*PartSize) of the file; every part except the
+// last must be exactly PartSize bytes.
+type MultipartUpload struct {
+	UploadID string                 `json:"upload_id"`
+	Name     string                 `json:"name"`
+	PartSize int64                  `json:"part_size"`
+	Parts    []storage.UploadedPart `json:"parts,omitempty"`
+	// Received is the number of contiguous bytes stored from offset 0,
+	// i.e. the offset to resume from
+	Received int64 `json:"received"`
+}
+
+// WithMultipartPartSize sets the part size for resumable uploads. Sizes
+// below storage.MinPartSize are raised to it.
+func WithMultipartPartSize(size int64) Option {
+	return func(h *FileHandler) {
+		h.partSize = max(size, storage.MinPartSize)
+	}
+}
+
+// CreateUpload handles requests starting a resumable upload
+func (h *FileHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	uploader, ok := h.multipartUploader(w)
+	if !ok {
+		return
+	}
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+
+	contentType := r.URL.Query().Get("content_type")
+	if contentType == "" {
+		contentType = contentTypeFor(filename)
+	}
+	metadata, err := uploadMetadata(r.URL.Query().Get("cache_ttl"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	uploadID, err := uploader.CreateMultipartUpload(r.Context(), filename, contentType, metadata)
+	if err != nil {
+		writeMultipartError(r.Context(), w, err, "filename", filename)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Multipart upload started", "filename", filename, "upload_id", uploadID)
+	writeJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Data: MultipartUpload{
+			UploadID: uploadID,
+			Name:     filename,
+			PartSize: h.partSize,
+		},
+	})
+}
+
+// GetUpload handles requests for the state of a resumable upload, so a
+// client can work out which parts to resend
+func (h *FileHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	uploader, ok := h.multipartUploader(w)
+	if !ok {
+		return
+	}
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	uploadID := r.PathValue("id")
+
+	parts, err := uploader.ListParts(r.Context(), filename, uploadID)
+	if err != nil {
+		writeMultipartError(r.Context(), w, err, "filename", filename, "upload_id", uploadID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: MultipartUpload{
+			UploadID: uploadID,
+			Name:     filename,
+			PartSize: h.partSize,
+			Parts:    parts,
+			Received: contiguousBytes(parts),
+		},
+	})
+}
+
+// UploadPart handles a single part, addressed by ?part=N (1-based) or by
+// ?offset=BYTES, which must be a multiple of the part size. A part sent
+// with Content-MD5 or X-Amz-Checksum-Sha256 is only stored if it matches.
+func (h *FileHandler) UploadPart(w http.ResponseWriter, r *http.Request) {
+	uploader, ok := h.multipartUploader(w)
+	if !ok {
+		return
+	}
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	uploadID := r.PathValue("id")
+
+	partNumber, ok := h.partNumber(r)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "part must be 1-" + strconv.Itoa(maxUploadParts) + ", or offset a multiple of " + strconv.FormatInt(h.partSize, 10),
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	if r.ContentLength > h.partSize {
+		writePartTooLarge(w, h.partSize)
+		return
+	}
+	// Parts are buffered so the SDK can sign and retry them
+	data, err := io.ReadAll(io.LimitReader(r.Body, h.partSize+1))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to read upload part", "filename", filename, "part", partNumber, "error", err)
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "failed to read request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	if int64(len(data)) > h.partSize {
+		writePartTooLarge(w, h.partSize)
+		return
+	}
+	if len(data) == 0 {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "part body is empty",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	if err := verifyDigests(r.Header, data); err != nil {
+		writeDigestError(r.Context(), w, filename, err)
+		return
+	}
+
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	part, err := uploader.UploadPart(ctx, filename, uploadID, partNumber, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		kind := classifyFailure(r.Context(), ctx, err)
+		if h.writeTimeoutOrCancel(ctx, w, kind, "upload_part", "filename", filename, "part", partNumber, "error", err) {
+			return
+		}
+		writeMultipartError(ctx, w, err, "filename", filename, "upload_id", uploadID, "part", partNumber)
+		return
+	}
+
+	slog.DebugContext(ctx, "Stored upload part", "filename", filename, "upload_id", uploadID, "part", partNumber, "size", part.Size)
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    part,
+	})
+}
+
+// CompleteUpload handles requests assembling the stored parts into the
+// final object. Parts must be contiguous from 1. The cached copy of the
+// file is invalidated once the object is in place.
+func (h *FileHandler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	uploader, ok := h.multipartUploader(w)
+	if !ok {
+		return
+	}
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	uploadID := r.PathValue("id")
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	parts, err := uploader.ListParts(ctx, filename, uploadID)
+	if err != nil {
+		writeMultipartError(ctx, w, err, "filename", filename, "upload_id", uploadID)
+		return
+	}
+	if missing := firstMissingPart(parts); missing > 0 {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "part " + strconv.Itoa(int(missing)) + " has not been uploaded",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	if err := uploader.CompleteMultipartUpload(ctx, filename, uploadID, parts); err != nil {
+		writeMultipartError(ctx, w, err, "filename", filename, "upload_id", uploadID)
+		return
+	}
+
+	var purged int64
+	h.precompressed.forget(filename)
+	if h.cache != nil {
+		if purged, err = h.purgeKeys(ctx, filename); err != nil {
+			slog.ErrorContext(ctx, "Failed to invalidate uploaded file", "filename", filename, "error", err)
+		}
+		h.metrics.CachePurgedKeysTotal.Add(float64(purged))
+	}
+
+	size := contiguousBytes(parts)
+	slog.InfoContext(ctx, "Multipart upload completed",
+		"filename", filename,
+		"upload_id", uploadID,
+		"parts", len(parts),
+		"size", size,
+	)
+	h.processUpload(ctx, filename, size, contentTypeFor(filename), uploadSourceMultipart)
+	completed := UploadCompleted{
+		Name:   filename,
+		Size:   size,
+		Parts:  len(parts),
+		Purged: purged,
+	}
+	if wantsPretty(r) {
+		completed.SizeHuman = humanBytes(size)
+	}
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    completed,
+	})
+}
+
+// AbortUpload handles requests discarding a resumable upload and its parts
+func (h *FileHandler) AbortUpload(w http.ResponseWriter, r *http.Request) {
+	uploader, ok := h.multipartUploader(w)
+	if !ok {
+		return
+	}
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	uploadID := r.PathValue("id")
+
+	if err := uploader.AbortMultipartUpload(r.Context(), filename, uploadID); err != nil {
+		writeMultipartError(r.Context(), w, err, "filename", filename, "upload_id", uploadID)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Multipart upload aborted", "filename", filename, "upload_id", uploadID)
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Upload aborted",
+	})
+}
+
+func (h *FileHandler) multipartUploader(w http.ResponseWriter) (storage.MultipartUploader, bool) {
+	uploader, ok := h.storage.(storage.MultipartUploader)
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "storage backend does not support resumable uploads",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+	}
+	return uploader, ok
+}
+
+// partNumber reads the part addressed by the part or offset query parameter
+func (h *FileHandler) partNumber(r *http.Request) (int32, bool) {
+	query := r.URL.Query()
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || offset < 0 || offset%h.partSize != 0 {
+			return 0, false
+		}
+		n := offset/h.partSize + 1
+		return int32(n), n <= maxUploadParts
+	}
+
+	n, err := strconv.Atoi(query.Get("part"))
+	if err != nil || n < 1 || n > maxUploadParts {
+		return 0, false
+	}
+	return int32(n), true
+}
+
+// contiguousBytes sums the sizes of parts 1..k with no gaps
+func contiguousBytes(parts []storage.UploadedPart) int64 {
+	var total int64
+	for i, p := range parts {
+		if p.Number != int32(i+1) {
+			break
+		}
+		total += p.Size
+	}
+	return total
+}
+
+// firstMissingPart returns the first gap in parts, or 0 when they are
+// contiguous from 1. An upload with no parts is missing part 1.
+func firstMissingPart(parts []storage.UploadedPart) int32 {
+	for i, p := range parts {
+		if p.Number != int32(i+1) {
+			return int32(i + 1)
+		}
+	}
+	if len(parts) == 0 {
+		return 1
+	}
+	return 0
+}
+
+func writePartTooLarge(w http.ResponseWriter, partSize int64) {
+	writeJSON(w, http.StatusRequestEntityTooLarge, Response{
+		Success:   false,
+		Message:   "part exceeds the part size of " + strconv.FormatInt(partSize, 10) + " bytes",
+		ErrorCode: ErrCodePayloadTooLarge,
+	})
+}
+
+func writeMultipartError(ctx context.Context, w http.ResponseWriter, err error, logAttrs ...any) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, Response{
+			Success:   false,
+			Message:   "Upload not found",
+			ErrorCode: ErrCodeNotFound,
+		})
+	case errors.Is(err, storage.ErrInvalidPart):
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "Upload parts were rejected by storage",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+	case errors.Is(err, quota.ErrExceeded):
+		writeQuotaExceeded(ctx, w, err)
+	default:
+		slog.ErrorContext(ctx, "Multipart upload failed", append(logAttrs, "error", err)...)
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Upload failed",
+			ErrorCode: ErrCodeStorageError,
+		})
+	}
+}
+
+func writeQuotaExceeded(ctx context.Context, w http.ResponseWriter, err error) {
+	slog.InfoContext(ctx, "Rejected write over quota", "error", err)
+	writeJSON(w, http.StatusRequestEntityTooLarge, Response{
+		Success:   false,
+		Message:   err.Error(),
+		ErrorCode: ErrCodeQuotaExceeded,
+	})
+}
@@ -0,0 +1,199 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func newMultipartMux(mockCache *mocks.MockCache, mockStorage *mocks.MockStorage) *http.ServeMux {
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithMultipartPartSize(storage.MinPartSize))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /uploads/{name...}", handler.CreateUpload)
+	mux.HandleFunc("GET /uploads/{id}/{name...}", handler.GetUpload)
+	mux.HandleFunc("PUT /uploads/{id}/{name...}", handler.UploadPart)
+	mux.HandleFunc("POST /complete/{id}/{name...}", handler.CompleteUpload)
+	mux.HandleFunc("DELETE /uploads/{id}/{name...}", handler.AbortUpload)
+	return mux
+}
+
+func decodeUpload(t *testing.T, rec *httptest.ResponseRecorder) handlers.MultipartUpload {
+	t.Helper()
+
+	var resp struct {
+		Data handlers.MultipartUpload `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return resp.Data
+}
+
+func TestMultipart_ResumeAndComplete(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mux := newMultipartMux(mockCache, mockStorage)
+	_ = mockCache.Set(context.Background(), "videos/2024/clip.mp4", []byte("stale"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads/videos/2024/clip.mp4", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	upload := decodeUpload(t, rec)
+	if upload.UploadID == "" || upload.PartSize != storage.MinPartSize {
+		t.Fatalf("Unexpected upload: %+v", upload)
+	}
+	// Nested keys keep their slashes after the upload ID
+	base := "/uploads/" + upload.UploadID + "/videos/2024/clip.mp4"
+	complete := "/complete/" + upload.UploadID + "/videos/2024/clip.mp4"
+
+	first := bytes.Repeat([]byte("a"), storage.MinPartSize)
+	last := []byte("tail")
+
+	// The last part arrives first, addressed by offset
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, base+"?offset="+strconv.Itoa(storage.MinPartSize), bytes.NewReader(last)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// Completing with a gap is rejected
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, complete, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d with part 1 missing, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// Resume reports nothing contiguous yet
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base, nil))
+	if state := decodeUpload(t, rec); len(state.Parts) != 1 || state.Received != 0 {
+		t.Errorf("Unexpected upload state: %+v", state)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, base+"?part=1", bytes.NewReader(first)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base, nil))
+	if state := decodeUpload(t, rec); state.Received != int64(len(first)+len(last)) {
+		t.Errorf("Expected %d bytes received, got %+v", len(first)+len(last), state)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, complete, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	data, err := mockStorage.GetObject(context.Background(), "videos/2024/clip.mp4")
+	if err != nil {
+		t.Fatalf("Expected assembled object: %v", err)
+	}
+	if !bytes.Equal(data, append(first, last...)) {
+		t.Errorf("Assembled object has %d bytes, want %d", len(data), len(first)+len(last))
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "videos/2024/clip.mp4"); found {
+		t.Error("Expected stale cache entry to be purged")
+	}
+
+	// The upload is gone once completed
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after completion, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestMultipart_UploadPartValidation(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mux := newMultipartMux(mocks.NewMockCache(), mockStorage)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads/a.bin", nil))
+	base := "/uploads/" + decodeUpload(t, rec).UploadID + "/a.bin"
+
+	tests := []struct {
+		name       string
+		target     string
+		body       []byte
+		wantStatus int
+	}{
+		{"missing part", base, []byte("x"), http.StatusBadRequest},
+		{"part zero", base + "?part=0", []byte("x"), http.StatusBadRequest},
+		{"unaligned offset", base + "?offset=100", []byte("x"), http.StatusBadRequest},
+		{"empty body", base + "?part=1", nil, http.StatusBadRequest},
+		{"oversized part", base + "?part=1", make([]byte, storage.MinPartSize+1), http.StatusRequestEntityTooLarge},
+		{"unknown upload", "/uploads/nope/a.bin?part=1", []byte("x"), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, tt.target, bytes.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMultipart_QuotaExceeded(t *testing.T) {
+	tracker, err := quota.NewTracker(nil, quota.Rule{Limit: 1024})
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+	handler := handlers.NewFileHandler(nil, quota.NewStorage(mocks.NewMockStorage(), tracker), handlers.WithMultipartPartSize(storage.MinPartSize))
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /uploads/{name...}", handler.CreateUpload)
+	mux.HandleFunc("PUT /uploads/{id}/{name...}", handler.UploadPart)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads/a.bin", nil))
+	base := "/uploads/" + decodeUpload(t, rec).UploadID + "/a.bin"
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, base+"?part=1", bytes.NewReader(make([]byte, 2048))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+	}
+	var resp handlers.Response
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.ErrorCode != handlers.ErrCodeQuotaExceeded {
+		t.Errorf("Expected error code %s, got %s", handlers.ErrCodeQuotaExceeded, resp.ErrorCode)
+	}
+}
+
+func TestMultipart_Abort(t *testing.T) {
+	mux := newMultipartMux(mocks.NewMockCache(), mocks.NewMockStorage())
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploads/a.bin", nil))
+	base := "/uploads/" + decodeUpload(t, rec).UploadID + "/a.bin"
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, base, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, base+"?part=1", bytes.NewReader([]byte("x"))))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after abort, got %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the service's endpoints. Routes registered in main
+// are checked against it by tests, so it stays in sync.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// apiDocsPage renders openapi.json with Swagger UI, loaded from a CDN
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>File Caching Service API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// OpenAPISpec returns the OpenAPI 3 document served at /openapi.json
+func OpenAPISpec() []byte {
+	return openAPISpec
+}
+
+// OpenAPI serves the OpenAPI 3 document describing the API
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(openAPISpec)
+}
+
+// APIDocs serves a Swagger UI page for the OpenAPI document
+func APIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(apiDocsPage))
+}
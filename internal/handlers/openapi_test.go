@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+func TestOpenAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlers.OpenAPI(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected application/json, got %q", got)
+	}
+
+	var spec map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	// Every reference points at a defined component
+	components, _ := spec["components"].(map[string]any)
+	for _, m := range regexp.MustCompile(`"\$ref": "#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		section, _ := components[m[1]].(map[string]any)
+		if _, ok := section[m[2]]; !ok {
+			t.Errorf("Unresolved reference #/components/%s/%s", m[1], m[2])
+		}
+	}
+}
+
+func TestOpenAPI_ErrorCodes(t *testing.T) {
+	codes := []handlers.ErrorCode{
+		handlers.ErrCodeInvalidRequest, handlers.ErrCodeFileNotFound, handlers.ErrCodeAccessDenied,
+		handlers.ErrCodeUnauthorized, handlers.ErrCodePayloadTooLarge, handlers.ErrCodeConflict,
+		handlers.ErrCodeNotFound, handlers.ErrCodeTooManyRequests, handlers.ErrCodeRequestTimeout,
+		handlers.ErrCodeStorageTimeout, handlers.ErrCodeStorageError, handlers.ErrCodeCacheUnavailable,
+		handlers.ErrCodeFeatureDisabled, handlers.ErrCodeServiceUnhealthy, handlers.ErrCodeInternal,
+	}
+
+	var spec struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(handlers.OpenAPISpec(), &spec); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	documented := strings.Join(spec.Components.Schemas["Response"].Properties["error_code"].Enum, ",")
+	for _, code := range codes {
+		if !strings.Contains(","+documented+",", ","+string(code)+",") {
+			t.Errorf("Error code %s is missing from the Response schema", code)
+		}
+	}
+}
+
+func TestAPIDocs(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlers.APIDocs(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected HTML, got %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `"/openapi.json"`) {
+		t.Error("Expected the page to load /openapi.json")
+	}
+}
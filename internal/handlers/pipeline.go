@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/ch374n/file-downloader/internal/events"
+	"github.com/ch374n/file-downloader/internal/pipeline"
+)
+
+// Upload sources reported to the upload pipeline and event sinks
+const (
+	uploadSourceDirect    = "direct"
+	uploadSourceMultipart = "multipart"
+	uploadSourceGRPC      = "grpc"
+	uploadSourceS3        = "s3"
+	uploadSourceWebDAV    = "webdav"
+)
+
+// WithUploadPipeline runs the files uploaded through any of the APIs
+// through p once they are stored
+func WithUploadPipeline(p *pipeline.Pipeline) Option {
+	return func(h *FileHandler) {
+		h.pipeline = p
+	}
+}
+
+// processUpload hands a stored file to the upload pipeline and announces
+// it to event sinks. size is 0 when unknown.
+func (h *FileHandler) processUpload(ctx context.Context, filename string, size int64, contentType, source string) {
+	h.pipeline.Submit(ctx, pipeline.Upload{
+		Key:         filename,
+		Size:        size,
+		ContentType: contentType,
+		Source:      source,
+	})
+	h.events.Publish(ctx, events.Event{
+		Type:        events.FileUploaded,
+		Key:         filename,
+		Size:        size,
+		ContentType: contentType,
+		Source:      source,
+	})
+}
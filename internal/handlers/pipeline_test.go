@@ -0,0 +1,64 @@
+package handlers_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/pipeline"
+)
+
+// uploadRecorder is a pipeline step recording the uploads it sees
+type uploadRecorder struct {
+	mu      sync.Mutex
+	uploads []pipeline.Upload
+}
+
+func (r *uploadRecorder) Name() string { return "record" }
+
+func (r *uploadRecorder) Run(ctx context.Context, job *pipeline.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uploads = append(r.uploads, job.Upload)
+	return nil
+}
+
+func TestUploadPipeline(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	recorder := &uploadRecorder{}
+	p, err := pipeline.New(pipeline.Config{Steps: []pipeline.Step{recorder}, Load: mockStorage.GetObject})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := handlers.NewFileHandler(nil, mockStorage, handlers.WithUploadPipeline(p))
+
+	if _, err := putFile(withToken("write-token"), newGRPCClient(t, h, 0), "a.txt", []byte("from grpc"), 4); err != nil {
+		t.Fatalf("PutFile failed: %v", err)
+	}
+	_, err = newS3Client(newS3Server(t, h), "writer", "write-token").PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("files"),
+		Key:    aws.String("b.txt"),
+		Body:   strings.NewReader("from s3"),
+	})
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	p.Close(context.Background())
+
+	got := make(map[string]pipeline.Upload)
+	for _, u := range recorder.uploads {
+		got[u.Key] = u
+	}
+	if u := got["a.txt"]; u.Source != "grpc" || u.Size != 9 {
+		t.Errorf("Expected the gRPC upload, got %+v", u)
+	}
+	if u := got["b.txt"]; u.Source != "s3" || u.Size != 7 || u.ContentType == "" {
+		t.Errorf("Expected the S3 upload, got %+v", u)
+	}
+}
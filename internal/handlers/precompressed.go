@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// DefaultPrecompressedTTL is how long the presence or absence of a
+// pre-compressed copy is remembered
+const DefaultPrecompressedTTL = 5 * time.Minute
+
+// maxPrecompressedChecks bounds the remembered lookups
+const maxPrecompressedChecks = 100000
+
+// precompressedSuffixes are appended to a file name to find its
+// pre-compressed copy in storage
+var precompressedSuffixes = map[string]string{
+	EncodingBrotli: ".br",
+	EncodingGzip:   ".gz",
+}
+
+// precompressed finds copies of files compressed ahead of time and stored
+// next to them, e.g. app.js.br and app.js.gz for app.js
+type precompressed struct {
+	cfg CompressionConfig
+	ttl time.Duration
+
+	mu     sync.Mutex
+	checks map[string]precompressedCheck
+}
+
+// precompressedCheck remembers whether a pre-compressed copy exists
+type precompressedCheck struct {
+	exists  bool
+	expires time.Time
+}
+
+// WithPrecompressed serves pre-compressed copies stored next to files, such
+// as app.js.br, to clients that accept their encoding. Whether a copy exists
+// is checked in storage and remembered for ttl, so a copy uploaded directly
+// to storage can take that long to be picked up.
+func WithPrecompressed(cfg CompressionConfig, ttl time.Duration) Option {
+	return func(h *FileHandler) {
+		if ttl <= 0 {
+			ttl = DefaultPrecompressedTTL
+		}
+		h.precompressed = &precompressed{
+			cfg:    cfg,
+			ttl:    ttl,
+			checks: make(map[string]precompressedCheck),
+		}
+	}
+}
+
+// precompressedKey returns the storage key to serve filename from and its
+// encoding, or filename and "" when no acceptable copy exists
+func (h *FileHandler) precompressedKey(ctx context.Context, w http.ResponseWriter, r *http.Request, filename string) (string, string) {
+	p := h.precompressed
+	if p == nil || !p.cfg.compressible(contentTypeFor(filename)) {
+		return filename, ""
+	}
+	addVary(w.Header(), "Accept-Encoding")
+
+	for _, encoding := range p.cfg.accepted(r) {
+		key := filename + precompressedSuffixes[encoding]
+		if h.precompressedExists(ctx, key) {
+			return key, encoding
+		}
+	}
+	return filename, ""
+}
+
+// precompressedExists checks storage for key, remembering the answer. Failed
+// checks aren't remembered.
+func (h *FileHandler) precompressedExists(ctx context.Context, key string) bool {
+	if exists, ok := h.precompressed.lookup(key); ok {
+		return exists
+	}
+	exists, err := h.storage.ObjectExists(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to check for pre-compressed file", "key", key, "error", err)
+		return false
+	}
+	h.precompressed.record(key, exists)
+	return exists
+}
+
+func (p *precompressed) lookup(key string) (exists, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	check, ok := p.checks[key]
+	if !ok || time.Now().After(check.expires) {
+		return false, false
+	}
+	return check.exists, true
+}
+
+func (p *precompressed) record(key string, exists bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if len(p.checks) >= maxPrecompressedChecks {
+		for k, check := range p.checks {
+			if now.After(check.expires) {
+				delete(p.checks, k)
+			}
+		}
+		if len(p.checks) >= maxPrecompressedChecks {
+			return
+		}
+	}
+	p.checks[key] = precompressedCheck{exists: exists, expires: now.Add(p.ttl)}
+}
+
+// forget drops what is known about key after it was written or deleted
+// through the service
+func (p *precompressed) forget(key string) {
+	if p == nil {
+		return
+	}
+	for _, suffix := range precompressedSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			p.mu.Lock()
+			delete(p.checks, key)
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// markPrecompressed describes a pre-compressed copy as its original file:
+// the content type comes from the original's name rather than the one stored
+// with the copy
+func markPrecompressed(w http.ResponseWriter, meta cache.EntryMeta, encoding string) cache.EntryMeta {
+	w.Header().Set("Content-Encoding", encoding)
+	meta.ContentType = ""
+	return meta
+}
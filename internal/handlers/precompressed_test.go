@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func compressed(t *testing.T, encoding, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch encoding {
+	case handlers.EncodingBrotli:
+		bw := brotli.NewWriter(&buf)
+		if _, err = bw.Write([]byte(content)); err == nil {
+			err = bw.Close()
+		}
+	case handlers.EncodingGzip:
+		gw := gzip.NewWriter(&buf)
+		if _, err = gw.Write([]byte(content)); err == nil {
+			err = gw.Close()
+		}
+	}
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetFile_Precompressed(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(nil, mockStorage,
+		handlers.WithPrecompressed(handlers.DefaultCompressionConfig(), time.Minute),
+	)
+	content := strings.Repeat("console.log('hello');\n", 100)
+	mockStorage.SetObject("app.js", []byte(content))
+	mockStorage.SetObject("app.js.gz", compressed(t, "gzip", content))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"gzip copy", "gzip", "gzip"},
+		{"brotli copy missing", "br, gzip", "gzip"},
+		{"no acceptable copy", "br", ""},
+		{"no accept-encoding", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getFile(handler, "app.js", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.Contains(got, "javascript") {
+				t.Errorf("Expected the original's content type, got %q", got)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+			}
+			if got := decompress(t, tt.wantEncoding, rec.Body.Bytes()); got != content {
+				t.Error("Decompressed file doesn't match")
+			}
+		})
+	}
+
+	// Lookups are remembered, including missing copies
+	checks := len(mockStorage.ExistsCalls)
+	getFile(handler, "app.js", map[string]string{"Accept-Encoding": "br, gzip"})
+	if got := len(mockStorage.ExistsCalls); got != checks {
+		t.Errorf("Expected remembered lookups, got %d more checks", got-checks)
+	}
+}
+
+func TestGetFile_PrecompressedRemoved(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(nil, mockStorage,
+		handlers.WithPrecompressed(handlers.DefaultCompressionConfig(), time.Minute),
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name}", handler.GetFile)
+	mux.HandleFunc("DELETE /files/{name}", handler.DeleteFile)
+
+	content := strings.Repeat("body { color: red; }\n", 100)
+	mockStorage.SetObject("site.css", []byte(content))
+	mockStorage.SetObject("site.css.br", compressed(t, "br", content))
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/site.css", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if got := get().Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Expected br, got %q", got)
+	}
+
+	// A copy removed behind the service's back falls back to the original
+	if err := mockStorage.DeleteObject(context.Background(), "site.css.br"); err != nil {
+		t.Fatal(err)
+	}
+	rec := get()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("Expected the original, got %d with %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Body.String() != content {
+		t.Error("Expected the original's content")
+	}
+
+	// A copy uploaded again is picked up once deleted through the service
+	mockStorage.SetObject("site.css.br", compressed(t, "br", content))
+	if got := get().Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("Expected the missing copy to be remembered, got %q", got)
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/files/site.css.br", nil)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	mockStorage.SetObject("site.css.br", compressed(t, "br", content))
+	if got := get().Header().Get("Content-Encoding"); got != "br" {
+		t.Errorf("Expected the copy after it was deleted through the service, got %q", got)
+	}
+}
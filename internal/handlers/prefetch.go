@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/prefetch"
+)
+
+// WithPrefetcher loads the files following ones read in order into the
+// cache. It has no effect without a cache.
+func WithPrefetcher(p *prefetch.Prefetcher) Option {
+	return func(h *FileHandler) {
+		h.prefetcher = p
+	}
+}
+
+// prefetchFile loads filename into the cache unless it is already there or
+// the cache policy excludes it
+func (h *FileHandler) prefetchFile(ctx context.Context, filename string) error {
+	if !features.Enabled(ctx, features.CacheFill, true) {
+		return nil
+	}
+	if _, found, err := h.getCached(ctx, filename); err == nil && found {
+		return nil
+	}
+
+	data, meta, err := h.fetchObject(ctx, filename)
+	if err != nil {
+		return err
+	}
+	cacheable := h.policy.Cacheable(&policy.Request{
+		Name:        filename,
+		Size:        int64(len(data)),
+		Method:      http.MethodGet,
+		ContentType: contentTypeFor(filename),
+	})
+	if !cacheable {
+		return nil
+	}
+
+	if err := h.storeCached(ctx, filename, data, meta); err != nil && !errors.Is(err, cache.ErrTombstoned) {
+		return err
+	}
+	h.efficiency.Filled(filename)
+	return nil
+}
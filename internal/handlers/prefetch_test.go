@@ -0,0 +1,38 @@
+package handlers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/prefetch"
+)
+
+func TestGetFile_PrefetchesSequentialReads(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	prefetcher, err := prefetch.New(prefetch.Config{Depth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithPrefetcher(prefetcher))
+	for _, name := range []string{"page-01.png", "page-02.png", "page-03.png", "page-04.png"} {
+		mockStorage.SetObject(name, []byte(name))
+	}
+	mockCache.SetData("page-03.png", []byte("cached"))
+
+	getFile(handler, "page-01.png", nil)
+	getFile(handler, "page-02.png", nil)
+	prefetcher.Wait()
+
+	if data, found, _ := mockCache.Get(context.Background(), "page-04.png"); !found || string(data) != "page-04.png" {
+		t.Errorf("Expected page-04.png to be prefetched, got %q", data)
+	}
+	// Files already cached aren't fetched again
+	for _, key := range mockStorage.GetCalls {
+		if key == "page-03.png" {
+			t.Error("Expected the cached page-03.png not to be fetched")
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+// PresignConfig controls the signed URLs issued by Presign
+type PresignConfig struct {
+	// DefaultTTL applies when a request doesn't specify one
+	DefaultTTL time.Duration
+	// MaxTTL caps the lifetime a client may request
+	MaxTTL time.Duration
+	// BaseURL prefixes issued URLs, e.g. https://files.example.com.
+	// When empty it is derived from the incoming request.
+	BaseURL string
+}
+
+// DefaultPresignConfig returns the presign settings used when none are configured
+func DefaultPresignConfig() PresignConfig {
+	return PresignConfig{
+		DefaultTTL: 15 * time.Minute,
+		MaxTTL:     7 * 24 * time.Hour,
+	}
+}
+
+// presignableMethods are the methods a signed URL may grant
+var presignableMethods = []string{http.MethodGet, http.MethodHead}
+
+// PresignRequest is the body of a presign request. Both fields are optional.
+type PresignRequest struct {
+	// TTL is a duration such as "15m" or "24h"
+	TTL string `json:"ttl,omitempty"`
+	// Methods defaults to GET and HEAD
+	Methods []string `json:"methods,omitempty"`
+}
+
+// PresignResponse describes an issued signed URL
+type PresignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Methods   []string  `json:"methods"`
+}
+
+// WithSignedURLs enables Presign and signed URL verification using keyring
+func WithSignedURLs(keyring *signing.Keyring, cfg PresignConfig) Option {
+	return func(h *FileHandler) {
+		h.signer = keyring
+		h.presign = cfg
+	}
+}
+
+// Presign handles requests for a time-limited signed URL to a file
+func (h *FileHandler) Presign(w http.ResponseWriter, r *http.Request) {
+	filename := r.PathValue("name")
+	if filename == "" {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "filename is required",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	if err := h.filenames.Check(filename); err != nil {
+		writeInvalidFilename(w, r, filename, err)
+		return
+	}
+	if h.signer == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "signing is not configured",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return
+	}
+
+	var req PresignRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	ttl, ok := h.requestTTL(w, req.TTL)
+	if !ok {
+		return
+	}
+
+	methods := req.Methods
+	if len(methods) == 0 {
+		methods = presignableMethods
+	}
+	for _, m := range methods {
+		if !isPresignable(m) {
+			writeJSON(w, http.StatusBadRequest, Response{
+				Success:   false,
+				Message:   "methods may only contain GET and HEAD",
+				ErrorCode: ErrCodeInvalidRequest,
+			})
+			return
+		}
+	}
+
+	path := filePath(filename)
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	query, err := h.signer.SignURL(signedPath(r.Context(), path), methods, expiresAt)
+	if err != nil {
+		status, code := http.StatusInternalServerError, ErrCodeInternal
+		if errors.Is(err, signing.ErrNoActiveKey) {
+			status, code = http.StatusServiceUnavailable, ErrCodeFeatureDisabled
+		}
+		slog.ErrorContext(r.Context(), "Failed to sign URL", "filename", filename, "error", err)
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Issued signed URL",
+		"filename", filename,
+		"key_id", query.Get(signing.ParamKeyID),
+		"ttl", ttl.String(),
+	)
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: PresignResponse{
+			URL:       h.baseURL(r) + requestPath(r.Context(), path) + "?" + query.Encode(),
+			ExpiresAt: timestamp(expiresAt),
+			Methods:   strings.Split(query.Get(signing.ParamMethods), ","),
+		},
+	})
+}
+
+// VerifySignedURL wraps a file handler so that requests carrying a signed
+// URL are verified. A valid signature lets downloads past deny policies and
+// upload callbacks past admin auth; an invalid or expired one is rejected.
+// Unsigned requests pass through.
+func (h *FileHandler) VerifySignedURL(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !signing.HasSignature(query) {
+			next(w, r)
+			return
+		}
+
+		err := signing.ErrInvalidSignature
+		if h.signer != nil {
+			err = h.signer.VerifyURL(r.Method, signedPath(r.Context(), r.URL.EscapedPath()), query)
+		}
+		if err != nil {
+			h.metrics.SignedURLVerificationsTotal.WithLabelValues(signedURLResult(err)).Inc()
+			slog.InfoContext(r.Context(), "Rejected signed URL", "path", r.URL.Path, "error", err)
+			writeJSON(w, http.StatusForbidden, Response{
+				Success:   false,
+				Message:   err.Error(),
+				ErrorCode: ErrCodeAccessDenied,
+			})
+			return
+		}
+
+		h.metrics.SignedURLVerificationsTotal.WithLabelValues("valid").Inc()
+		next(w, r.WithContext(withSignedAccess(r.Context())))
+	}
+}
+
+// requestTTL parses a client-requested TTL, falling back to the default and
+// enforcing the maximum. It writes the error response when the TTL is invalid.
+func (h *FileHandler) requestTTL(w http.ResponseWriter, raw string) (time.Duration, bool) {
+	if raw == "" {
+		return h.presign.DefaultTTL, true
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 || ttl > h.presign.MaxTTL {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "ttl must be a positive duration no longer than " + h.presign.MaxTTL.String(),
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return 0, false
+	}
+	return ttl, true
+}
+
+func (h *FileHandler) baseURL(r *http.Request) string {
+	if h.presign.BaseURL != "" {
+		return strings.TrimSuffix(h.presign.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func isPresignable(method string) bool {
+	for _, m := range presignableMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func signedURLResult(err error) string {
+	switch {
+	case errors.Is(err, signing.ErrURLExpired):
+		return "expired"
+	case errors.Is(err, signing.ErrMethodNotAllowed):
+		return "method_not_allowed"
+	default:
+		return "invalid"
+	}
+}
+
+type signedAccessKey struct{}
+
+func withSignedAccess(ctx context.Context) context.Context {
+	return context.WithValue(ctx, signedAccessKey{}, true)
+}
+
+// hasSignedAccess reports whether the request was authorized by a signed URL
+func hasSignedAccess(ctx context.Context) bool {
+	ok, _ := ctx.Value(signedAccessKey{}).(bool)
+	return ok
+}
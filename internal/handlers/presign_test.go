@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+func newPresignMux(t *testing.T) *http.ServeMux {
+	t.Helper()
+
+	keyring, err := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	policies, err := policy.CompileSet("", "prefix('private')")
+	if err != nil {
+		t.Fatalf("CompileSet failed: %v", err)
+	}
+
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("private.txt", []byte("secret content"))
+	mockStorage.SetObject("private/reports/q3 final.pdf", []byte("nested content"))
+
+	handler := handlers.NewFileHandler(nil, mockStorage,
+		handlers.WithPolicies(policies),
+		handlers.WithSignedURLs(keyring, handlers.PresignConfig{
+			DefaultTTL: handlers.DefaultPresignConfig().DefaultTTL,
+			MaxTTL:     handlers.DefaultPresignConfig().MaxTTL,
+			BaseURL:    "https://files.example.com/",
+		}),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name...}", handler.VerifySignedURL(handler.GetFile))
+	mux.HandleFunc("POST /presign/{name...}", handler.Presign)
+	return mux
+}
+
+func presign(t *testing.T, mux *http.ServeMux, body string) (*httptest.ResponseRecorder, handlers.PresignResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/presign/private.txt", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data handlers.PresignResponse `json:"data"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp.Data
+}
+
+func TestPresign_SignedURLGrantsAccess(t *testing.T) {
+	mux := newPresignMux(t)
+
+	// Denied without a signature
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/private.txt", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected unsigned request to be denied, got %d", rec.Code)
+	}
+
+	rec, data := presign(t, mux, `{"ttl": "5m", "methods": ["GET"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if !strings.HasPrefix(data.URL, "https://files.example.com/files/private.txt?") {
+		t.Errorf("Unexpected URL %q", data.URL)
+	}
+	if len(data.Methods) != 1 || data.Methods[0] != "GET" {
+		t.Errorf("Expected methods [GET], got %v", data.Methods)
+	}
+
+	signed, err := url.Parse(data.URL)
+	if err != nil {
+		t.Fatalf("Invalid URL: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed.RequestURI(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "secret content" {
+		t.Errorf("Expected signed request to succeed, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Tampering with the signature is rejected
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed.RequestURI()+"x", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected tampered signature to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestPresign_NestedKey(t *testing.T) {
+	mux := newPresignMux(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/presign/private/reports/q3%20final.pdf", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var resp struct {
+		Data handlers.PresignResponse `json:"data"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if !strings.HasPrefix(resp.Data.URL, "https://files.example.com/files/private/reports/q3%20final.pdf?") {
+		t.Errorf("Expected the URL to keep the key's slashes, got %q", resp.Data.URL)
+	}
+
+	signed, err := url.Parse(resp.Data.URL)
+	if err != nil {
+		t.Fatalf("Invalid URL: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed.RequestURI(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "nested content" {
+		t.Errorf("Expected signed request to succeed, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	for _, path := range []string{"/files/private/reports/q3%20final.pdf", "/files/private%2Freports%2Fq3%20final.pdf"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected unsigned %s to be denied, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestPresign_InvalidParameters(t *testing.T) {
+	mux := newPresignMux(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"bad ttl", `{"ttl": "soon"}`},
+		{"ttl too long", `{"ttl": "8760h"}`},
+		{"unsupported method", `{"methods": ["DELETE"]}`},
+		{"malformed body", `{`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := presign(t, mux, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+
+	rec, data := presign(t, mux, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected empty body to use defaults, got %d", rec.Code)
+	}
+	if len(data.Methods) != 2 {
+		t.Errorf("Expected default methods GET and HEAD, got %v", data.Methods)
+	}
+}
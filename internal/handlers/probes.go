@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/healthcheck"
+)
+
+// Names of the checks a health prober runs for FileHandler
+const (
+	HealthCheckCache   = "cache"
+	HealthCheckStorage = "storage"
+)
+
+// WithHealthProber reports dependency health from p's latest checks,
+// which should be named HealthCheckCache and HealthCheckStorage, instead of
+// checking them on every request
+func WithHealthProber(p *healthcheck.Prober) Option {
+	return func(h *FileHandler) {
+		h.prober = p
+	}
+}
+
+// WithReadinessRequiresCache makes /readyz fail while the cache is
+// unreachable, for deployments where storage can't take the uncached load
+func WithReadinessRequiresCache(required bool) Option {
+	return func(h *FileHandler) {
+		h.readyNeedsCache = required
+	}
+}
+
+// probe returns the prober's latest outcome of the named check, running
+// check inline without a prober or before its first run
+func (h *FileHandler) probe(ctx context.Context, name string, check healthcheck.Check) healthcheck.Status {
+	if h.prober != nil {
+		if status, ok := h.prober.Status(name); ok {
+			return status
+		}
+	}
+	return healthcheck.Status{Err: check(ctx), CheckedAt: time.Now()}
+}
+
+// dependencyHealth describes a dependency's health for HealthStatus
+func dependencyHealth(err error) string {
+	if err != nil {
+		return "unhealthy: " + err.Error()
+	}
+	return "healthy"
+}
+
+// Drain marks the service as shutting down, failing /readyz from then on so
+// load balancers stop routing to it before the listeners close
+func (h *FileHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Livez reports that the process is up. It checks no dependencies, so a
+// storage outage makes pods unready rather than restarting them.
+func (h *FileHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Service is alive",
+	})
+}
+
+// Readyz reports whether the service should receive traffic: storage is
+// reachable, the cache too when required, and it isn't shutting down
+func (h *FileHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "Service is shutting down",
+			ErrorCode: ErrCodeServiceUnhealthy,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeouts.Health)
+	defer cancel()
+
+	health, cacheErr, storageErr := h.checkHealth(ctx)
+	if storageErr != nil || (h.readyNeedsCache && cacheErr != nil) {
+		health.Status = "unhealthy"
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "Service is not ready",
+			ErrorCode: ErrCodeServiceUnhealthy,
+			Data:      health,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Service is ready",
+		Data:    health,
+	})
+}
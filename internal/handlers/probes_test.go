@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/healthcheck"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestLivez_IgnoresDependencies(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.HealthCheckError = mocks.ErrBucketNotFound
+	handler := handlers.NewFileHandler(nil, mockStorage)
+	handler.Drain()
+
+	rec := httptest.NewRecorder()
+	handler.Livez(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with storage down and draining, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheDown    bool
+		storageDown  bool
+		requireCache bool
+		drain        bool
+		want         int
+	}{
+		{name: "ready", want: http.StatusOK},
+		{name: "cache down", cacheDown: true, want: http.StatusOK},
+		{name: "cache down and required", cacheDown: true, requireCache: true, want: http.StatusServiceUnavailable},
+		{name: "storage down", storageDown: true, want: http.StatusServiceUnavailable},
+		{name: "draining", drain: true, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCache := mocks.NewMockCache()
+			if tt.cacheDown {
+				mockCache.PingError = mocks.ErrCacheUnavailable
+			}
+			mockStorage := mocks.NewMockStorage()
+			if tt.storageDown {
+				mockStorage.HealthCheckError = mocks.ErrBucketNotFound
+			}
+			handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithReadinessRequiresCache(tt.requireCache))
+			if tt.drain {
+				handler.Drain()
+			}
+
+			rec := httptest.NewRecorder()
+			handler.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if resp := parseResponse(t, rec.Body.Bytes()); resp.Success != (tt.want == http.StatusOK) {
+				t.Errorf("Expected success to match the status, got %+v", resp)
+			}
+		})
+	}
+}
+
+func TestHealth_UsesProberResults(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	prober := healthcheck.NewProber(time.Second, map[string]healthcheck.Check{
+		handlers.HealthCheckCache:   mockCache.Ping,
+		handlers.HealthCheckStorage: mockStorage.HealthCheck,
+	})
+	prober.Check(context.Background())
+	handler := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithHealthProber(prober))
+
+	// Outages since the last check aren't seen until the next one
+	mockStorage.HealthCheckError = mocks.ErrBucketNotFound
+	rec := httptest.NewRecorder()
+	handler.Health(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the last check's status 200, got %d", rec.Code)
+	}
+	resp := parseResponse(t, rec.Body.Bytes())
+	if resp.Data["r2_checked_at"] == "" || resp.Data["redis_checked_at"] == "" {
+		t.Errorf("Expected the check times, got %+v", resp.Data)
+	}
+
+	prober.Check(context.Background())
+	rec = httptest.NewRecorder()
+	handler.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 after the next check, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+)
+
+// parseRange parses a Range header holding a single byte range into the
+// offset and length a cache.RangeCache reads. Other ranges, such as several
+// at once, aren't handled and the whole file is served instead.
+func parseRange(header string) (offset, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+	if first == "" {
+		// The last bytes of the file
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		return -n, -1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if last == "" {
+		return start, -1, true
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end - start + 1, true
+}
+
+// serveCachedRange serves the range r asks for from the cache, reading only
+// the part of the entry it needs. It returns false, writing nothing, when
+// the file isn't cached or the cache can't read ranges, leaving the request
+// to be served whole.
+func (h *FileHandler) serveCachedRange(ctx context.Context, w http.ResponseWriter, r *http.Request, filename string) bool {
+	rc, ok := h.cache.(cache.RangeCache)
+	if !ok || r.Header.Get("If-Range") != "" {
+		return false
+	}
+	offset, length, ok := parseRange(r.Header.Get("Range"))
+	if !ok {
+		return false
+	}
+
+	start := time.Now()
+	cacheCtx, cancel := h.cacheContext(ctx)
+	entry, found, err := rc.GetRange(cacheCtx, filename, offset, length)
+	cancel()
+	h.metrics.CacheOperationDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+	if errors.Is(err, errors.ErrUnsupported) {
+		return false
+	}
+	h.countCacheError("get", err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Cache error", "filename", filename, "error", err)
+		return false
+	}
+	if !found || entry.Expired() {
+		return false
+	}
+
+	h.metrics.CacheHitsTotal.Inc()
+	h.efficiency.Hit(filename, int64(len(entry.Data)))
+	slog.InfoContext(ctx, "Cache "+CacheStatusHit, "filename", filename, "range", r.Header.Get("Range"))
+	header := w.Header()
+	header.Set(HeaderCache, CacheStatusHit)
+	header.Set(HeaderCacheAge, strconv.Itoa(int(entry.Age.Seconds())))
+	h.setFileHeaders(ctx, header, filename, entry.Meta)
+	if notModified(r, entry.Meta) {
+		writeNotModified(w)
+		return true
+	}
+
+	size := entry.Meta.Size
+	first, end := cache.ResolveRange(offset, length, size)
+	if first >= size {
+		writeUnsatisfiable(w, size)
+		return true
+	}
+	h.writeRange(ctx, w, filename, sourceCache, entry.Data, first, end, size)
+	return true
+}
+
+// writeUnsatisfiable answers a range starting past the end of a file of
+// size bytes
+func writeUnsatisfiable(w http.ResponseWriter, size int64) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	writeJSON(w, http.StatusRequestedRangeNotSatisfiable, Response{
+		Success:   false,
+		Message:   "Range not satisfiable",
+		ErrorCode: ErrCodeInvalidRequest,
+	})
+}
+
+// writeRange writes data, bytes first to end of a file of size bytes, as a
+// partial response
+func (h *FileHandler) writeRange(ctx context.Context, w http.ResponseWriter, filename, source string, data []byte, first, end, size int64) {
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, end-1, size))
+	header.Set("Content-Length", strconv.FormatInt(end-first, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	n, err := newAdaptiveWriter(w, h.stream, h.metrics).WriteBody(data)
+	h.countServed(ctx, filename, apiHTTP, source, n)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to write response body", "filename", filename, "error", err)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/chunked"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestGetFile_CachedRange(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 30)
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("video.mp4", data)
+	chunks := chunked.NewCache(mocks.NewMockCache(), chunked.Config{Threshold: 100, ChunkSize: 64})
+	if err := chunks.(cache.EntryCache).SetEntry(context.Background(), "video.mp4", data, cache.EntryMeta{ETag: `"v1"`}); err != nil {
+		t.Fatalf("SetEntry failed: %v", err)
+	}
+	handler := handlers.NewFileHandler(chunks, mockStorage)
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantRange  string
+		wantBody   []byte
+	}{
+		{"range", map[string]string{"Range": "bytes=60-139"}, http.StatusPartialContent, "bytes 60-139/300", data[60:140]},
+		{"open ended", map[string]string{"Range": "bytes=250-"}, http.StatusPartialContent, "bytes 250-299/300", data[250:]},
+		{"suffix", map[string]string{"Range": "bytes=-10"}, http.StatusPartialContent, "bytes 290-299/300", data[290:]},
+		{"unsatisfiable", map[string]string{"Range": "bytes=400-"}, http.StatusRequestedRangeNotSatisfiable, "bytes */300", nil},
+		{"several ranges", map[string]string{"Range": "bytes=0-1,5-6"}, http.StatusOK, "", data},
+		{"if-range", map[string]string{"Range": "bytes=0-9", "If-Range": `"v0"`}, http.StatusOK, "", data},
+		{"not modified", map[string]string{"Range": "bytes=0-9", "If-None-Match": `"v1"`}, http.StatusNotModified, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getFile(handler, "video.mp4", tt.headers)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("Expected Content-Range %q, got %q", tt.wantRange, got)
+			}
+			if tt.wantBody != nil && !bytes.Equal(rec.Body.Bytes(), tt.wantBody) {
+				t.Errorf("Expected %d bytes, got %q", len(tt.wantBody), rec.Body.String())
+			}
+			if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusHit {
+				t.Errorf("Expected a cache hit, got %q", got)
+			}
+		})
+	}
+}
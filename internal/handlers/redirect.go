@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+)
+
+// RedirectHTTPS redirects plain-HTTP requests to the same URL over HTTPS on
+// port, leaving the port out when it is 443. The redirect is permanent and
+// keeps the method, so clients resend uploads to the secure URL.
+func RedirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "Host header is required", http.StatusBadRequest)
+			return
+		}
+		switch ip := net.ParseIP(host); {
+		case port != "" && port != "443":
+			host = net.JoinHostPort(host, port)
+		case ip != nil && ip.To4() == nil:
+			// IPv6 literals keep their brackets without a port
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,39 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   string
+		host   string
+		target string
+		want   string
+	}{
+		{name: "default port", port: "443", host: "files.example.com", target: "/files/a.txt?x=1", want: "https://files.example.com/files/a.txt?x=1"},
+		{name: "port dropped from host", port: "443", host: "files.example.com:80", target: "/", want: "https://files.example.com/"},
+		{name: "custom port", port: "8443", host: "files.example.com:8080", target: "/health", want: "https://files.example.com:8443/health"},
+		{name: "IPv6", port: "443", host: "[2001:db8::1]:80", target: "/", want: "https://[2001:db8::1]/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.target, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			handlers.RedirectHTTPS(tt.port).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Errorf("Expected status 308, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("Expected redirect to %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
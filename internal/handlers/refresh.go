@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+var (
+	errInvalidRefresh   = errors.New("refresh must be true or false")
+	errRefreshForbidden = errors.New("refresh requires an admin credential with the cache:purge scope")
+)
+
+// WithRefreshAuth restricts ?refresh=true to admin credentials with the
+// cache:purge scope. Without it, any caller may force a refresh.
+func WithRefreshAuth(authn *auth.Authenticator) Option {
+	return func(h *FileHandler) {
+		h.refreshAuth = authn
+	}
+}
+
+// refreshRequested reports whether the request forces a fresh fetch from
+// storage with ?refresh=true
+func (h *FileHandler) refreshRequested(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("refresh")
+	if value == "" {
+		return false, nil
+	}
+	refresh, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errInvalidRefresh
+	}
+	if !refresh || h.refreshAuth == nil {
+		return refresh, nil
+	}
+
+	cred, ok := requestCredential(h.refreshAuth, r)
+	if !ok || !cred.Allows(auth.ScopeCachePurge) {
+		return false, errRefreshForbidden
+	}
+	return true, nil
+}
+
+// wantsRevalidation reports whether the client asked for cached copies to be
+// checked against the origin with Cache-Control: no-cache, or the HTTP/1.0
+// Pragma: no-cache
+func wantsRevalidation(r *http.Request) bool {
+	for _, value := range r.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return true
+			}
+		}
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Pragma")), "no-cache")
+}
+
+// revalidate reports whether a cached entry still matches the stored object.
+// Entries without an ETag, and storage that can't report one without
+// fetching the object, are never considered fresh. An entry whose object was
+// deleted is purged.
+func (h *FileHandler) revalidate(ctx context.Context, filename string, entry *cache.Entry) bool {
+	stater, ok := h.storage.(storage.HeaderStater)
+	if !ok || entry.Meta.ETag == "" {
+		return false
+	}
+
+	headers, err := stater.StatObject(ctx, filename)
+	if errors.Is(err, storage.ErrNotFound) {
+		if _, err := h.purgeKeys(ctx, filename); err != nil {
+			slog.WarnContext(ctx, "Failed to purge entry for deleted file", "filename", filename, "error", err)
+		}
+		return false
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to revalidate cached file", "filename", filename, "error", err)
+		return false
+	}
+	return headers.Get("ETag") == entry.Meta.ETag
+}
@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// waitForCached waits for the background cache fill to store want under key
+func waitForCached(t *testing.T, c *mocks.MockCache, key, want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if data, found, _ := c.Get(context.Background(), key); found && string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s to be cached as %q", key, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGetFile_Refresh(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	handler := handlers.NewFileHandler(mockCache, mockStorage)
+
+	mockCache.Set(context.Background(), "a.txt", []byte("stale"))
+	mockStorage.SetObject("a.txt", []byte("fresh"))
+
+	rec := getFile(handler, "a.txt?refresh=true", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "fresh" {
+		t.Fatalf("Expected the stored file, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusRefresh {
+		t.Errorf("Expected X-Cache %s, got %q", handlers.CacheStatusRefresh, got)
+	}
+	waitForCached(t, mockCache, "a.txt", "fresh")
+
+	if rec := getFile(handler, "a.txt?refresh=maybe", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid refresh, got %d", rec.Code)
+	}
+}
+
+func TestGetFile_RefreshRequiresAdmin(t *testing.T) {
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "ops", Token: "purger", Scopes: []auth.Scope{auth.ScopeCachePurge}},
+		auth.Credential{Name: "ci", Token: "warmer", Scopes: []auth.Scope{auth.ScopeCacheWarm}},
+	)
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a.txt", []byte("fresh"))
+	handler := handlers.NewFileHandler(mocks.NewMockCache(), mockStorage, handlers.WithRefreshAuth(authn))
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"anonymous", "", http.StatusForbidden},
+		{"missing scope", "warmer", http.StatusForbidden},
+		{"purge scope", "purger", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.token != "" {
+				headers["Authorization"] = "Bearer " + tt.token
+			}
+			if rec := getFile(handler, "a.txt?refresh=true", headers); rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestGetFile_NoCacheRevalidates(t *testing.T) {
+	noCache := map[string]string{"Cache-Control": "max-age=0, no-cache"}
+
+	t.Run("unchanged", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		mockStorage := mocks.NewMockStorage()
+		handler := handlers.NewFileHandler(mockCache, mockStorage)
+		mockCache.SetEntry(context.Background(), "a.txt", []byte("cached"), cache.EntryMeta{ETag: `"v1"`})
+		mockStorage.SetObject("a.txt", []byte("cached"))
+		mockStorage.SetObjectHeaders("a.txt", http.Header{"Etag": {`"v1"`}})
+
+		rec := getFile(handler, "a.txt", noCache)
+		if got := rec.Header().Get(handlers.HeaderCache); got != handlers.CacheStatusRevalidated {
+			t.Errorf("Expected X-Cache %s, got %q", handlers.CacheStatusRevalidated, got)
+		}
+		if len(mockStorage.GetCalls) != 0 {
+			t.Errorf("Expected revalidation not to fetch the object, got %v", mockStorage.GetCalls)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		mockStorage := mocks.NewMockStorage()
+		handler := handlers.NewFileHandler(mockCache, mockStorage)
+		mockCache.SetEntry(context.Background(), "a.txt", []byte("stale"), cache.EntryMeta{ETag: `"v1"`})
+		mockStorage.SetObject("a.txt", []byte("fresh"))
+		mockStorage.SetObjectHeaders("a.txt", http.Header{"Etag": {`"v2"`}})
+
+		rec := getFile(handler, "a.txt", noCache)
+		if rec.Body.String() != "fresh" || rec.Header().Get(handlers.HeaderCache) != handlers.CacheStatusMiss {
+			t.Errorf("Expected a fresh MISS, got %q with X-Cache %q", rec.Body.String(), rec.Header().Get(handlers.HeaderCache))
+		}
+		waitForCached(t, mockCache, "a.txt", "fresh")
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		handler := handlers.NewFileHandler(mockCache, mocks.NewMockStorage())
+		mockCache.SetEntry(context.Background(), "a.txt", []byte("stale"), cache.EntryMeta{ETag: `"v1"`})
+
+		if rec := getFile(handler, "a.txt", map[string]string{"Pragma": "no-cache"}); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", rec.Code)
+		}
+		if _, found, _ := mockCache.Get(context.Background(), "a.txt"); found {
+			t.Error("Expected the entry for the deleted file to be purged")
+		}
+	})
+
+	t.Run("without cache-control", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		mockStorage := mocks.NewMockStorage()
+		handler := handlers.NewFileHandler(mockCache, mockStorage)
+		mockCache.SetEntry(context.Background(), "a.txt", []byte("cached"), cache.EntryMeta{ETag: `"v1"`})
+
+		if rec := getFile(handler, "a.txt", nil); rec.Header().Get(handlers.HeaderCache) != handlers.CacheStatusHit {
+			t.Errorf("Expected a HIT, got %q", rec.Header().Get(handlers.HeaderCache))
+		}
+		if len(mockStorage.StatCalls) != 0 {
+			t.Errorf("Expected no revalidation, got %v", mockStorage.StatCalls)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/efficiency"
+)
+
+// WithEfficiencyTracker records cache hits and misses into t
+func WithEfficiencyTracker(t *efficiency.Tracker) Option {
+	return func(h *FileHandler) {
+		h.efficiency = t
+	}
+}
+
+// WithEfficiencyReports enables the cache efficiency report. Purges are
+// recorded into t so they aren't mistaken for expiries.
+func WithEfficiencyReports(t *efficiency.Tracker) AdminOption {
+	return func(h *AdminHandler) {
+		h.efficiency = t
+	}
+}
+
+// reportWindows are the windows accepted by CacheEfficiencyReport
+var reportWindows = map[string]time.Duration{
+	"day":  efficiency.WindowDay,
+	"week": efficiency.WindowWeek,
+}
+
+// CacheEfficiencyReport handles requests for the cache efficiency report.
+// The window query parameter selects "day" (the default) or "week", and
+// format selects "json" (the default) or "csv".
+func (h *AdminHandler) CacheEfficiencyReport(w http.ResponseWriter, r *http.Request) {
+	if h.efficiency == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "cache efficiency reports are not configured",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	windowName := query.Get("window")
+	if windowName == "" {
+		windowName = "day"
+	}
+	window, ok := reportWindows[windowName]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "window must be day or week",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	report := h.efficiency.Report(window)
+	switch query.Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, Response{
+			Success: true,
+			Data:    report,
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="cache-efficiency-`+windowName+`.csv"`)
+		w.WriteHeader(http.StatusOK)
+		if err := report.WriteCSV(w); err != nil {
+			slog.WarnContext(r.Context(), "Failed to write cache efficiency report", "error", err)
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "format must be json or csv",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/efficiency"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+type efficiencyResponse struct {
+	Success bool              `json:"success"`
+	Data    efficiency.Report `json:"data"`
+}
+
+func TestCacheEfficiencyReport(t *testing.T) {
+	tracker := efficiency.NewTracker(efficiency.Config{})
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("images/a.png", []byte("png"))
+	files := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithEfficiencyTracker(tracker))
+	admin := handlers.NewAdminHandler(mockCache, handlers.WithEfficiencyReports(tracker))
+
+	getFile(files, "images/a.png", nil)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, found, _ := mockCache.Get(context.Background(), "images/a.png"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the file to be cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	getFile(files, "images/a.png", nil)
+	getFile(files, "images/missing.png", nil)
+
+	rec := httptest.NewRecorder()
+	admin.CacheEfficiencyReport(rec, httptest.NewRequest(http.MethodGet, "/admin/reports/cache-efficiency?window=week", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var resp efficiencyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	// The request for a missing file is neither a hit nor a served miss
+	if totals := resp.Data.Totals; totals.Hits != 1 || totals.Misses != 1 || totals.BytesSaved != 3 {
+		t.Errorf("Unexpected totals: %+v", totals)
+	}
+	if resp.Data.Window != "168h" {
+		t.Errorf("Expected the week window, got %q", resp.Data.Window)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.CacheEfficiencyReport(rec, httptest.NewRequest(http.MethodGet, "/admin/reports/cache-efficiency?format=csv", nil))
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("Expected CSV, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), "images/,2,1,1,") {
+		t.Errorf("Expected a row for images/, got %q", rec.Body.String())
+	}
+}
+
+func TestCacheEfficiencyReport_Errors(t *testing.T) {
+	tracker := efficiency.NewTracker(efficiency.Config{})
+	tests := []struct {
+		name    string
+		handler *handlers.AdminHandler
+		query   string
+		want    int
+	}{
+		{"not configured", handlers.NewAdminHandler(nil), "", http.StatusServiceUnavailable},
+		{"unknown window", handlers.NewAdminHandler(nil, handlers.WithEfficiencyReports(tracker)), "?window=month", http.StatusBadRequest},
+		{"unknown format", handlers.NewAdminHandler(nil, handlers.WithEfficiencyReports(tracker)), "?format=xml", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.CacheEfficiencyReport(rec, httptest.NewRequest(http.MethodGet, "/admin/reports/cache-efficiency"+tt.query, nil))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
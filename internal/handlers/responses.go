@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ServiceInfo identifies the service at the root endpoint
+type ServiceInfo struct {
+	Version string `json:"version"`
+}
+
+// HealthStatus is the result of a health check. Redis and R2 are
+// "healthy", "disabled" or "unhealthy: " followed by the error, as of
+// their CheckedAt times.
+type HealthStatus struct {
+	Status         string     `json:"status"`
+	Redis          string     `json:"redis"`
+	RedisCheckedAt *time.Time `json:"redis_checked_at,omitempty"`
+	R2             string     `json:"r2,omitempty"`
+	R2CheckedAt    *time.Time `json:"r2_checked_at,omitempty"`
+	LogLevel       string     `json:"log_level"`
+}
+
+// PurgeResult reports how many cache entries a request evicted
+type PurgeResult struct {
+	Purged int64 `json:"purged"`
+}
+
+// UploadCompleted describes a file assembled from a resumable upload
+type UploadCompleted struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	SizeHuman string `json:"size_human,omitempty"`
+	Parts     int    `json:"parts"`
+	Purged    int64  `json:"purged"`
+}
+
+// SigningKeyAdded identifies a new signing key. Secret is only set when the
+// service generated it, and can't be read back later.
+type SigningKeyAdded struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// SigningKeyRetired reports when a retired key stops verifying
+type SigningKeyRetired struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// timestamp normalizes t for responses, so every time is RFC 3339 in UTC
+// to the second
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// wantsPretty reports whether the client asked for human-readable fields
+// alongside raw values with ?pretty=true
+func wantsPretty(r *http.Request) bool {
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
+}
+
+// humanBytes formats n in binary units, such as "1.5 MiB"
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
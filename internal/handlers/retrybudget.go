@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+)
+
+// RetryBudgetMiddleware gives each request a retry budget shared by all of
+// its storage and cache calls, including background cache writes
+func RetryBudgetMiddleware(cfg retrybudget.Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := retrybudget.WithBudget(r.Context(), retrybudget.New(cfg))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,562 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/features"
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/sigv4"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// DefaultS3MaxObjectSize caps objects uploaded through the S3 API, which
+// are buffered in memory since multipart uploads aren't supported there
+const DefaultS3MaxObjectSize = 64 * 1024 * 1024
+
+// s3Namespace is the XML namespace of S3 responses
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3TimeFormat is how S3 formats timestamps in XML bodies
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// S3Handler serves a minimal S3-compatible API over the same cache and
+// storage as FileHandler, so S3 SDKs and tools can use the service without
+// the /files/ API. Storage is exposed as a single bucket addressed
+// path-style. Requests signed with SigV4 are authenticated with the
+// credential name as access key ID and its token as secret access key;
+// unsigned requests may only read.
+type S3Handler struct {
+	files         *FileHandler
+	authn         *auth.Authenticator
+	verifier      *sigv4.Verifier
+	bucket        string
+	maxObjectSize int64
+	created       time.Time
+	mux           *http.ServeMux
+}
+
+// NewS3Handler creates an S3Handler exposing the files of h as bucket.
+// maxObjectSize <= 0 uses DefaultS3MaxObjectSize.
+func NewS3Handler(h *FileHandler, authn *auth.Authenticator, bucket string, maxObjectSize int64) *S3Handler {
+	if maxObjectSize <= 0 {
+		maxObjectSize = DefaultS3MaxObjectSize
+	}
+	s := &S3Handler{
+		files:         h,
+		authn:         authn,
+		bucket:        bucket,
+		maxObjectSize: maxObjectSize,
+		created:       time.Now().UTC(),
+		mux:           http.NewServeMux(),
+	}
+	s.verifier = sigv4.NewVerifier(func(accessKey string) (string, bool) {
+		cred, ok := authn.Lookup(accessKey)
+		if !ok {
+			return "", false
+		}
+		return cred.Token, true
+	})
+
+	s.mux.HandleFunc("GET /{$}", s.listBuckets)
+	s.mux.HandleFunc("GET /{bucket}", s.getBucket)
+	s.mux.HandleFunc("GET /{bucket}/{$}", s.getBucket)
+	s.mux.HandleFunc("PUT /{bucket}", s.createBucket)
+	s.mux.HandleFunc("GET /{bucket}/{key...}", s.getObject)
+	s.mux.HandleFunc("PUT /{bucket}/{key...}", s.putObject)
+	s.mux.HandleFunc("DELETE /{bucket}/{key...}", s.deleteObject)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "This operation is not supported")
+	})
+	return s
+}
+
+// ServeHTTP authenticates the request and routes it to its operation
+func (s *S3Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if id := logger.RequestID(r.Context()); id != "" {
+		w.Header().Set("x-amz-request-id", id)
+	}
+	r, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authenticate verifies the signature of signed requests and attaches their
+// credential to the request context. Unsigned requests may only read, and
+// writes need a credential with the files:write scope.
+func (s *S3Handler) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	write := r.Method != http.MethodGet && r.Method != http.MethodHead
+	if r.Header.Get("Authorization") == "" {
+		if r.URL.Query().Has("X-Amz-Signature") {
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "Presigned URLs are not supported")
+			return nil, false
+		}
+		if write {
+			writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "Anonymous writes are not allowed")
+			return nil, false
+		}
+		return r, true
+	}
+
+	accessKey, err := s.verifier.Verify(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Rejected S3 signature", "error", err)
+		switch {
+		case errors.Is(err, sigv4.ErrUnknownKey):
+			writeS3Error(w, r, http.StatusForbidden, "InvalidAccessKeyId", "The access key ID does not exist")
+		case errors.Is(err, sigv4.ErrSignatureMismatch):
+			writeS3Error(w, r, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature does not match")
+		case errors.Is(err, sigv4.ErrSkewed):
+			writeS3Error(w, r, http.StatusForbidden, "RequestTimeTooSkewed", "The request time is too far from the server time")
+		default:
+			writeS3Error(w, r, http.StatusBadRequest, "AuthorizationHeaderMalformed", err.Error())
+		}
+		return nil, false
+	}
+	cred, _ := s.authn.Lookup(accessKey)
+	if write && !cred.Allows(auth.ScopeFilesWrite) {
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "Access denied")
+		return nil, false
+	}
+	return r.WithContext(auth.WithCredential(r.Context(), cred)), true
+}
+
+// checkBucket reports whether the request addresses the bucket, and
+// whether it has no query parameters but the allowed ones. Anything else
+// selects an operation or subresource that isn't implemented.
+func (s *S3Handler) checkBucket(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	if r.PathValue("bucket") != s.bucket {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return false
+	}
+	for name := range r.URL.Query() {
+		if name != "x-id" && !slices.Contains(allowed, name) {
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "The "+name+" parameter is not supported")
+			return false
+		}
+	}
+	return true
+}
+
+// s3Bucket is a bucket in a ListAllMyBucketsResult
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+// listBuckets handles ListBuckets, which always lists the one bucket
+func (s *S3Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	writeXML(w, http.StatusOK, listAllMyBucketsResult{
+		Xmlns:   s3Namespace,
+		Buckets: []s3Bucket{{Name: s.bucket, CreationDate: s.created.Format(s3TimeFormat)}},
+	})
+}
+
+// createBucket handles CreateBucket, which succeeds for the existing bucket
+// so tools that create their destination first keep working
+func (s *S3Handler) createBucket(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("bucket") != s.bucket {
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "Only the "+s.bucket+" bucket exists")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+// s3Object is an object in a ListBucketResult
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	KeyCount              int              `xml:"KeyCount"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	EncodingType          string           `xml:"EncodingType,omitempty"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// getBucket handles HeadBucket, GetBucketLocation and ListObjectsV2.
+// Keys sharing a prefix up to the delimiter are collapsed within a page, so
+// a common prefix spanning several pages is listed once per page.
+func (s *S3Handler) getBucket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkBucket(w, r, "list-type", "prefix", "delimiter", "max-keys", "continuation-token", "encoding-type", "fetch-owner", "location") {
+		return
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	query := r.URL.Query()
+	if query.Has("location") {
+		writeXML(w, http.StatusOK, locationConstraint{Xmlns: s3Namespace})
+		return
+	}
+	if query.Get("list-type") != "2" {
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 (list-type=2) is supported")
+		return
+	}
+	encoding := query.Get("encoding-type")
+	if encoding != "" && encoding != "url" {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid encoding-type")
+		return
+	}
+
+	maxKeys := maxListLimit
+	if raw := query.Get("max-keys"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "max-keys must be a non-negative integer")
+			return
+		}
+		maxKeys = min(n, maxListLimit)
+	}
+	cursor, err := parseListCursor(query.Get("continuation-token"))
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "The continuation token is not valid")
+		return
+	}
+
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	result := listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              s.bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		EncodingType:      encoding,
+		ContinuationToken: query.Get("continuation-token"),
+	}
+	if maxKeys > 0 {
+		h := s.files
+		ctx, cancel := s.files.requestContext(r.Context())
+		defer cancel()
+
+		page, err := h.listPage(r.Context(), ctx, prefix, cursor.Token, min(cursor.Skip+maxKeys, maxListLimit))
+		if err != nil {
+			s.writeFailure(w, r, ctx, "list", err, "prefix", prefix)
+			return
+		}
+
+		seen := make(map[string]bool)
+		for _, obj := range page.Objects[min(cursor.Skip, len(page.Objects)):] {
+			if delimiter != "" {
+				if i := strings.Index(obj.Key[len(prefix):], delimiter); i >= 0 {
+					common := obj.Key[:len(prefix)+i+len(delimiter)]
+					if !seen[common] {
+						seen[common] = true
+						result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: s3EncodeKey(common, encoding)})
+					}
+					continue
+				}
+			}
+			result.Contents = append(result.Contents, s3Object{
+				Key:          s3EncodeKey(obj.Key, encoding),
+				LastModified: obj.LastModified.UTC().Format(s3TimeFormat),
+				Size:         obj.Size,
+				StorageClass: "STANDARD",
+			})
+		}
+		result.NextContinuationToken = page.NextToken
+		result.IsTruncated = page.NextToken != ""
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	result.Prefix = s3EncodeKey(prefix, encoding)
+	result.Delimiter = s3EncodeKey(delimiter, encoding)
+	writeXML(w, http.StatusOK, result)
+}
+
+// s3EncodeKey percent-encodes key for encoding-type=url listings, which let
+// clients list keys that aren't valid in XML
+func s3EncodeKey(key, encoding string) string {
+	if encoding != "url" {
+		return key
+	}
+	return strings.ReplaceAll(url.QueryEscape(key), "+", "%20")
+}
+
+// getObject handles GetObject and HeadObject. Range and conditional
+// requests are answered from the cached content.
+func (s *S3Handler) getObject(w http.ResponseWriter, r *http.Request) {
+	if !s.checkBucket(w, r) {
+		return
+	}
+	key := r.PathValue("key")
+	h := s.files
+	ctx, cancel := s.files.requestContext(r.Context())
+	defer cancel()
+
+	filename, err := h.resolveName(ctx, key, r.Method)
+	if err != nil {
+		s.writeFailure(w, r, ctx, "get", err, "filename", key)
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		stat, err := h.statFile(r.Context(), ctx, filename)
+		if err != nil {
+			s.writeFailure(w, r, ctx, "get", err, "filename", filename)
+			return
+		}
+		s.writeObjectHeaders(ctx, w, filename, stat.meta)
+		if notModified(r, stat.meta) {
+			writeNotModified(w)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(stat.size, 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	file, err := h.readThrough(r.Context(), ctx, filename, false)
+	if err != nil {
+		s.writeFailure(w, r, ctx, "get", err, "filename", filename)
+		return
+	}
+	s.writeObjectHeaders(ctx, w, filename, file.meta)
+	w.Header().Set(HeaderCache, file.status)
+	modified, _ := http.ParseTime(file.meta.LastModified)
+	counted := &countingWriter{ResponseWriter: w}
+	http.ServeContent(counted, r, "", modified, bytes.NewReader(file.data))
+	h.countServed(ctx, filename, apiS3, file.source(), counted.n)
+}
+
+// writeObjectHeaders sets the headers describing an object, including its
+// user metadata
+func (s *S3Handler) writeObjectHeaders(ctx context.Context, w http.ResponseWriter, filename string, meta cache.EntryMeta) {
+	header := w.Header()
+	header.Set("Content-Type", objectContentType(filename, meta))
+	header.Set("Accept-Ranges", "bytes")
+	if meta.ETag != "" {
+		header.Set("ETag", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		header.Set("Last-Modified", meta.LastModified)
+	}
+	if features.Enabled(ctx, features.HeaderPassthrough, true) {
+		for name, value := range s.files.passthroughHeaders(meta.Headers) {
+			header.Set(name, value)
+		}
+	}
+	for name, value := range meta.Headers {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Amz-Meta-") {
+			header.Set(name, value)
+		}
+	}
+}
+
+// putObject handles PutObject. The body is buffered to check it against
+// its signed hash, Content-MD5 and x-amz-checksum-sha256 before anything is
+// stored.
+func (s *S3Handler) putObject(w http.ResponseWriter, r *http.Request) {
+	if !s.checkBucket(w, r) {
+		return
+	}
+	key := r.PathValue("key")
+	if err := s.files.filenames.Check(key); err != nil {
+		s.writeFailure(w, r, r.Context(), "put", err, "filename", key)
+		return
+	}
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported")
+		return
+	}
+
+	var body io.Reader = r.Body
+	if sigv4.IsChunked(r) {
+		body = sigv4.NewChunkedReader(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, s.maxObjectSize+1))
+	if err != nil {
+		slog.InfoContext(r.Context(), "Failed to read S3 upload", "filename", key, "error", err)
+		writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody", "The request body could not be read")
+		return
+	}
+	if int64(len(data)) > s.maxObjectSize {
+		writeS3Error(w, r, http.StatusBadRequest, "EntityTooLarge", "Objects may be at most "+strconv.FormatInt(s.maxObjectSize, 10)+" bytes")
+		return
+	}
+	if err := sigv4.VerifyPayload(r, data); err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The body does not match its signed hash")
+		return
+	}
+	if err := verifyDigests(r.Header, data); err != nil {
+		if errors.Is(err, errInvalidDigest) {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidDigest", "The Content-MD5 or checksum you specified is not valid")
+			return
+		}
+		writeS3Error(w, r, http.StatusBadRequest, "BadDigest", "The body does not match its Content-MD5 or checksum")
+		return
+	}
+	sum := md5.Sum(data)
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = contentTypeFor(key)
+	}
+	h := s.files
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	if err := h.storage.PutObject(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		s.writeFailure(w, r, ctx, "put", err, "filename", key)
+		return
+	}
+	purged, err := h.invalidate(ctx, key)
+	if err != nil {
+		s.writeFailure(w, r, ctx, "put", err, "filename", key)
+		return
+	}
+
+	slog.InfoContext(ctx, "File stored", "filename", key, "size", len(data), "purged", purged)
+	h.processUpload(ctx, key, int64(len(data)), contentType, uploadSourceS3)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteObject handles DeleteObject, which like S3 succeeds for missing
+// objects when the storage backend does
+func (s *S3Handler) deleteObject(w http.ResponseWriter, r *http.Request) {
+	if !s.checkBucket(w, r) {
+		return
+	}
+	key := r.PathValue("key")
+	if err := s.files.filenames.Check(key); err != nil {
+		s.writeFailure(w, r, r.Context(), "delete", err, "filename", key)
+		return
+	}
+	ctx, cancel := s.files.requestContext(r.Context())
+	defer cancel()
+
+	purged, err := s.files.deleteFile(ctx, key)
+	if err != nil {
+		s.writeFailure(w, r, ctx, "delete", err, "filename", key)
+		return
+	}
+	slog.InfoContext(ctx, "File deleted", "filename", key, "purged", purged)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeFailure writes the S3 error for a failed file operation
+func (s *S3Handler) writeFailure(w http.ResponseWriter, r *http.Request, ctx context.Context, operation string, err error, logAttrs ...any) {
+	logAttrs = append(logAttrs, "error", err)
+	switch {
+	case errors.Is(err, errPolicyDenied):
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "Access denied")
+		return
+	case errors.Is(err, errInvalidFilename):
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	case errors.Is(err, quota.ErrExceeded):
+		slog.InfoContext(ctx, "Rejected write over quota", logAttrs...)
+		writeS3Error(w, r, http.StatusForbidden, "QuotaExceeded", err.Error())
+		return
+	case errors.Is(err, errInvalidation):
+		slog.ErrorContext(ctx, "Failed to invalidate cache", logAttrs...)
+		writeS3Error(w, r, http.StatusServiceUnavailable, "ServiceUnavailable", "The object changed but cache invalidation failed")
+		return
+	}
+
+	kind := classifyFailure(r.Context(), ctx, err)
+	switch kind {
+	case failureClientCanceled:
+		s.files.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.InfoContext(ctx, "Client canceled request", logAttrs...)
+		w.WriteHeader(StatusClientClosedRequest)
+		return
+	case failureServerTimeout:
+		s.files.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.WarnContext(ctx, "Request deadline exceeded", logAttrs...)
+		writeS3Error(w, r, http.StatusServiceUnavailable, "ServiceUnavailable", "Request timeout")
+		return
+	case failureUpstreamTimeout:
+		s.files.metrics.RequestAbortsTotal.WithLabelValues(operation, string(kind)).Inc()
+		slog.WarnContext(ctx, "Storage timed out", logAttrs...)
+		writeS3Error(w, r, http.StatusServiceUnavailable, "ServiceUnavailable", "Storage timeout")
+		return
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	case errors.Is(err, storage.ErrAccessDenied):
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "Access denied")
+	default:
+		slog.ErrorContext(ctx, "Storage error", logAttrs...)
+		writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "Storage error")
+	}
+}
+
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId,omitempty"`
+}
+
+// writeS3Error writes an S3 error document. Responses to HEAD requests
+// carry the status alone, as S3's do.
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, s3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: logger.RequestID(r.Context()),
+	})
+}
+
+func writeXML(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("Error encoding XML response", "error", err)
+	}
+}
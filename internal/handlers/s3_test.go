@@ -0,0 +1,221 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// newS3Server serves the S3 API for h as bucket "files"
+func newS3Server(t *testing.T, h *handlers.FileHandler) *httptest.Server {
+	t.Helper()
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "writer", Token: "write-token", Scopes: []auth.Scope{auth.ScopeFilesWrite}},
+		auth.Credential{Name: "reader", Token: "read-token", Scopes: []auth.Scope{auth.ScopeReportsRead}},
+	)
+	server := httptest.NewServer(handlers.RequestIDMiddleware(handlers.NewS3Handler(h, authn, "files", 1024)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newS3Client creates an SDK client for server signing with accessKey and
+// secret, or sending unsigned requests when accessKey is empty
+func newS3Client(server *httptest.Server, accessKey, secret string) *s3.Client {
+	var creds aws.CredentialsProvider = aws.AnonymousCredentials{}
+	if accessKey != "" {
+		creds = credentials.NewStaticCredentialsProvider(accessKey, secret, "")
+	}
+	return s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		Region:       "auto",
+		UsePathStyle: true,
+		Credentials:  creds,
+		HTTPClient:   server.Client(),
+	})
+}
+
+func s3ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func TestS3Handler_Objects(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	server := newS3Server(t, handlers.NewFileHandler(mockCache, mockStorage))
+	client := newS3Client(server, "writer", "write-token")
+	ctx := context.Background()
+
+	mockCache.SetData("docs/notes.txt", []byte("old"))
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("files"),
+		Key:    aws.String("docs/notes.txt"),
+		Body:   strings.NewReader("hello, world"),
+	})
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if len(mockStorage.PutCalls) != 1 || string(mockStorage.PutCalls[0].Data) != "hello, world" {
+		t.Fatalf("Expected a single put of the object, got %v", mockStorage.PutCalls)
+	}
+	if _, found, _ := mockCache.Get(ctx, "docs/notes.txt"); found {
+		t.Error("Expected the old version to be purged")
+	}
+
+	// Reads need no credentials
+	anonymous := newS3Client(server, "", "")
+	got, err := anonymous.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("files"), Key: aws.String("docs/notes.txt")})
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	data, _ := io.ReadAll(got.Body)
+	got.Body.Close()
+	if string(data) != "hello, world" {
+		t.Errorf("Expected the stored content, got %q", data)
+	}
+
+	ranged, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("files"), Key: aws.String("docs/notes.txt"), Range: aws.String("bytes=7-")})
+	if err != nil {
+		t.Fatalf("Ranged GetObject failed: %v", err)
+	}
+	data, _ = io.ReadAll(ranged.Body)
+	ranged.Body.Close()
+	if string(data) != "world" {
+		t.Errorf("Expected the requested range, got %q", data)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("files"), Key: aws.String("docs/notes.txt")})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if aws.ToInt64(head.ContentLength) != 12 || aws.ToString(head.ContentType) != "text/plain; charset=utf-8" {
+		t.Errorf("Expected 12 bytes of text, got %d of %q", aws.ToInt64(head.ContentLength), aws.ToString(head.ContentType))
+	}
+
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("files"), Key: aws.String("docs/notes.txt")}); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("files"), Key: aws.String("docs/notes.txt")})
+	if code := s3ErrorCode(err); code != "NoSuchKey" {
+		t.Errorf("Expected NoSuchKey after the delete, got %v", err)
+	}
+}
+
+func TestS3Handler_ListObjectsV2(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	server := newS3Server(t, handlers.NewFileHandler(nil, mockStorage))
+	client := newS3Client(server, "reader", "read-token")
+
+	for _, name := range []string{"docs/a b.txt", "docs/b.txt", "docs/sub/c.txt", "docs/sub/d.txt", "other.txt"} {
+		mockStorage.SetObject(name, []byte(name))
+	}
+
+	var keys, prefixes []string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String("files"),
+		Prefix:    aws.String("docs/"),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(2),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(p.Prefix))
+		}
+	}
+	if strings.Join(keys, ",") != "docs/a b.txt,docs/b.txt" {
+		t.Errorf("Expected the files directly under docs/, got %q", keys)
+	}
+	if len(prefixes) == 0 || prefixes[0] != "docs/sub/" {
+		t.Errorf("Expected docs/sub/ as a common prefix, got %q", prefixes)
+	}
+
+	_, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("elsewhere")})
+	if code := s3ErrorCode(err); code != "NoSuchBucket" {
+		t.Errorf("Expected NoSuchBucket, got %v", err)
+	}
+}
+
+func TestS3Handler_Auth(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	server := newS3Server(t, handlers.NewFileHandler(nil, mockStorage))
+	ctx := context.Background()
+	put := &s3.PutObjectInput{
+		Bucket: aws.String("files"),
+		Key:    aws.String("notes.txt"),
+		Body:   strings.NewReader("content"),
+	}
+
+	tests := []struct {
+		name      string
+		accessKey string
+		secret    string
+		wantCode  string
+	}{
+		{name: "anonymous", wantCode: "AccessDenied"},
+		{name: "wrong secret", accessKey: "writer", secret: "guess", wantCode: "SignatureDoesNotMatch"},
+		{name: "unknown key", accessKey: "nobody", secret: "write-token", wantCode: "InvalidAccessKeyId"},
+		{name: "missing scope", accessKey: "reader", secret: "read-token", wantCode: "AccessDenied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			put.Body = strings.NewReader("content")
+			_, err := newS3Client(server, tt.accessKey, tt.secret).PutObject(ctx, put)
+			if code := s3ErrorCode(err); code != tt.wantCode {
+				t.Errorf("Expected %s, got %v", tt.wantCode, err)
+			}
+		})
+	}
+	if len(mockStorage.PutCalls) != 0 {
+		t.Errorf("Expected nothing to be stored, got %v", mockStorage.PutCalls)
+	}
+}
+
+func TestS3Handler_Limits(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	server := newS3Server(t, handlers.NewFileHandler(nil, mockStorage))
+	client := newS3Client(server, "writer", "write-token")
+
+	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("files"),
+		Key:    aws.String("big.bin"),
+		Body:   bytes.NewReader(make([]byte, 2048)),
+	})
+	if code := s3ErrorCode(err); code != "EntityTooLarge" {
+		t.Errorf("Expected EntityTooLarge, got %v", err)
+	}
+
+	// Operations outside the supported subset are refused rather than
+	// mistaken for object reads
+	resp, err := server.Client().Get(server.URL + "/files/notes.txt?tagging")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected 501 for an unsupported subresource, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// StreamConfig controls how response bodies are written to clients
+type StreamConfig struct {
+	// MinChunkSize and MaxChunkSize bound the size of a single write
+	MinChunkSize int
+	MaxChunkSize int
+	// TargetWriteDuration is how long a single chunk write should take;
+	// chunk sizes are scaled from the observed client throughput to hit it
+	TargetWriteDuration time.Duration
+}
+
+// DefaultStreamConfig returns the stream settings used when none are configured
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		MinChunkSize:        4 * 1024,
+		MaxChunkSize:        1024 * 1024,
+		TargetWriteDuration: 50 * time.Millisecond,
+	}
+}
+
+// adaptiveWriter writes a body to the client in chunks sized from the
+// client's observed throughput, flushing each one, so slow clients get
+// small steady writes and fast ones few large writes. Bodies are already
+// in memory; the chunk size only paces writes and doesn't bound memory.
+type adaptiveWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	cfg     StreamConfig
+	chunk   int
+	metrics *metrics.Metrics
+}
+
+func newAdaptiveWriter(w http.ResponseWriter, cfg StreamConfig, m *metrics.Metrics) *adaptiveWriter {
+	if cfg.MinChunkSize <= 0 || cfg.MaxChunkSize < cfg.MinChunkSize {
+		cfg = DefaultStreamConfig()
+	}
+	return &adaptiveWriter{
+		w:     w,
+		rc:    http.NewResponseController(w),
+		cfg:   cfg,
+		chunk: cfg.MinChunkSize,
+
+		metrics: m,
+	}
+}
+
+// WriteBody writes data to the client and returns the number of bytes
+// written. Chunks are slices of data, so no copy of the body is made.
+func (a *adaptiveWriter) WriteBody(data []byte) (int64, error) {
+	var written int64
+	for len(data) > 0 {
+		n := min(a.chunk, len(data))
+		start := time.Now()
+		m, err := a.w.Write(data[:n])
+		if err == nil {
+			err = a.flush()
+		}
+		elapsed := time.Since(start)
+		a.metrics.ResponseChunkSize.Observe(float64(n))
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+		a.adjust(n, elapsed)
+		data = data[n:]
+	}
+	return written, nil
+}
+
+func (a *adaptiveWriter) flush() error {
+	if err := a.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// adjust sizes the next chunk so that writing it takes roughly TargetWriteDuration
+func (a *adaptiveWriter) adjust(n int, elapsed time.Duration) {
+	if elapsed <= 0 {
+		a.chunk = min(a.chunk*2, a.cfg.MaxChunkSize)
+		return
+	}
+
+	throughput := float64(n) / elapsed.Seconds()
+	a.metrics.ClientThroughput.Observe(throughput)
+
+	next := int(throughput * a.cfg.TargetWriteDuration.Seconds())
+	// Grow gradually so a single fast write can't jump straight to the max
+	next = min(next, a.chunk*2)
+	a.chunk = max(a.cfg.MinChunkSize, min(next, a.cfg.MaxChunkSize))
+}
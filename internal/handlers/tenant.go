@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+type tenantPrefixKey struct{}
+
+// TenantMiddleware resolves each request to a tenant from its path prefix,
+// then its Host header, then the tenant owning its admin credential, and
+// serves it with the tenant in the context. The path prefix is stripped
+// before next routes the request. Credentials of one tenant are rejected
+// on another's host or path; requests resolving to no tenant are served
+// as they are. Credentials not owned by a tenant work on every tenant.
+func TenantMiddleware(tenants *tenant.Registry, authn *auth.Authenticator, m *metrics.Metrics, next http.Handler) http.Handler {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, rest, byPath := tenants.ByPath(r.URL.Path)
+		if !byPath {
+			t, _ = tenants.ByHost(r.Host)
+		}
+		if cred, ok := requestCredential(authn, r); ok {
+			if owner, owned := tenants.ByCredential(cred.Name); owned {
+				if t != nil && t != owner {
+					slog.InfoContext(r.Context(), "Rejected credential of another tenant", "credential", cred.Name, "tenant", t.ID)
+					writeJSON(w, http.StatusForbidden, Response{
+						Success:   false,
+						Message:   "credential doesn't belong to this tenant",
+						ErrorCode: ErrCodeAccessDenied,
+					})
+					return
+				}
+				t = owner
+			}
+		}
+		if t == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := tenant.NewContext(r.Context(), t)
+		if byPath {
+			ctx = context.WithValue(ctx, tenantPrefixKey{}, t.PathPrefix)
+			r = stripTenantPrefix(r, t.PathPrefix, rest)
+		}
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+		m.TenantRequestsTotal.WithLabelValues(t.ID, strconv.Itoa(wrapped.statusCode)).Inc()
+	})
+}
+
+// stripTenantPrefix returns a shallow copy of r with prefix removed from its
+// path, as http.StripPrefix does
+func stripTenantPrefix(r *http.Request, prefix, rest string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = rest
+	// An escaped path not starting with prefix as written is recomputed
+	// from Path
+	r2.URL.RawPath = ""
+	if raw, ok := strings.CutPrefix(r.URL.RawPath, prefix); ok {
+		r2.URL.RawPath = raw
+	}
+	return r2
+}
+
+// requestPath returns the path clients use for path, which includes the
+// prefix of a tenant resolved from the request path
+func requestPath(ctx context.Context, path string) string {
+	prefix, _ := ctx.Value(tenantPrefixKey{}).(string)
+	return prefix + path
+}
+
+// signedPath returns what is signed for path, so URLs signed for one
+// tenant don't verify for another
+func signedPath(ctx context.Context, path string) string {
+	if t, ok := tenant.FromContext(ctx); ok {
+		return "/tenants/" + t.ID + path
+	}
+	return path
+}
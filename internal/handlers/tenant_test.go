@@ -0,0 +1,155 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/signing"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+func newTenantServer(t *testing.T) (http.Handler, *mocks.MockCache) {
+	t.Helper()
+
+	tenants, err := tenant.New(
+		tenant.Tenant{ID: "alpha", Hosts: []string{"alpha.example.com"}, Credentials: []string{"alpha-ci"}, Bucket: "alpha-files"},
+		tenant.Tenant{ID: "beta", PathPrefix: "/teams/beta", KeyPrefix: "beta/"},
+	)
+	if err != nil {
+		t.Fatalf("tenant.New failed: %v", err)
+	}
+	fallback := mocks.NewMockStorage()
+	fallback.SetObject("a.txt", []byte("shared"))
+	fallback.SetObject("beta/a.txt", []byte("beta"))
+	alphaBucket := mocks.NewMockStorage()
+	alphaBucket.SetObject("a.txt", []byte("alpha"))
+	files, err := tenant.NewStorage(tenants, fallback, map[string]tenant.Backend{"alpha-files": alphaBucket})
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	keyring, err := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	mockCache := mocks.NewMockCache()
+	handler := handlers.NewFileHandler(tenant.NewCache(mockCache, nil), files,
+		handlers.WithSignedURLs(keyring, handlers.DefaultPresignConfig()),
+	)
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "alpha-ci", Token: "alpha-token", Scopes: []auth.Scope{auth.ScopeAll}},
+		auth.Credential{Name: "ops", Token: "ops-token", Scopes: []auth.Scope{auth.ScopeAll}},
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{name...}", handler.VerifySignedURL(handler.GetFile))
+	mux.HandleFunc("POST /presign/{name...}", handlers.RequireScope(authn, auth.ScopeFilesPresign, handler.Presign))
+	return handlers.TenantMiddleware(tenants, authn, nil, mux), mockCache
+}
+
+func TestTenantMiddleware_ServesTenantFiles(t *testing.T) {
+	server, mockCache := newTenantServer(t)
+
+	tests := []struct {
+		name   string
+		host   string
+		path   string
+		header string
+		want   string
+	}{
+		{name: "no tenant", host: "files.example.com", path: "/files/a.txt", want: "shared"},
+		{name: "host", host: "alpha.example.com:8080", path: "/files/a.txt", want: "alpha"},
+		{name: "path prefix", host: "files.example.com", path: "/teams/beta/files/a.txt", want: "beta"},
+		{name: "credential", host: "files.example.com", path: "/files/a.txt", header: "Bearer alpha-token", want: "alpha"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+				t.Errorf("Expected %q, got %d %q", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// Each tenant's copy is cached under its own namespace
+	for _, key := range []string{"a.txt", "tenant#alpha/a.txt", "tenant#beta/a.txt"} {
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, found, _ := mockCache.Get(context.Background(), key); found {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected cache entry %s", key)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestTenantMiddleware_RejectsOtherTenantsCredential(t *testing.T) {
+	server, _ := newTenantServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/teams/beta/presign/a.txt", nil)
+	req.Header.Set("Authorization", "Bearer alpha-token")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// Credentials not owned by a tenant work on every tenant
+	req = httptest.NewRequest(http.MethodPost, "/teams/beta/presign/a.txt", nil)
+	req.Header.Set("Authorization", "Bearer ops-token")
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
+
+func TestTenantMiddleware_SignedURLs(t *testing.T) {
+	server, _ := newTenantServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/teams/beta/presign/a.txt", nil)
+	req.Header.Set("Authorization", "Bearer ops-token")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	var resp struct {
+		Data handlers.PresignResponse `json:"data"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	signed, err := url.Parse(resp.Data.URL)
+	if err != nil || !strings.HasPrefix(signed.Path, "/teams/beta/files/") {
+		t.Fatalf("Expected a URL under the tenant's path prefix, got %q (%v)", resp.Data.URL, err)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed.RequestURI(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "beta" {
+		t.Errorf("Expected the signed URL to serve beta's file, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// The signature doesn't carry over to another tenant's copy of the file
+	other := httptest.NewRequest(http.MethodGet, "/files/a.txt?"+signed.RawQuery, nil)
+	other.Host = "alpha.example.com"
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, other)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another tenant, got %d", http.StatusForbidden, rec.Code)
+	}
+}
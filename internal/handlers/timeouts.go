@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds the work done for requests
+type Timeouts struct {
+	// Request bounds serving a request, storage and cache calls included
+	Request time.Duration
+	// Health bounds the checks of /health and /readyz
+	Health time.Duration
+	// Cache bounds each cache read and write; zero leaves them to Request
+	Cache time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used when none are configured
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Request: 30 * time.Second,
+		Health:  5 * time.Second,
+	}
+}
+
+// WithTimeouts sets the request, health check and cache timeouts; zero
+// request and health timeouts keep their defaults. Storage calls are
+// bounded by the storage itself, more tightly than requests, so a timed out
+// bucket is told apart from a request that ran out of time.
+func WithTimeouts(t Timeouts) Option {
+	return func(h *FileHandler) {
+		h.timeouts = t.withDefaults()
+	}
+}
+
+// withDefaults fills in zero request and health timeouts
+func (t Timeouts) withDefaults() Timeouts {
+	defaults := DefaultTimeouts()
+	if t.Request <= 0 {
+		t.Request = defaults.Request
+	}
+	if t.Health <= 0 {
+		t.Health = defaults.Health
+	}
+	return t
+}
+
+// requestContext bounds ctx by the request timeout
+func (h *FileHandler) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, h.timeouts.Request)
+}
+
+// cacheContext bounds ctx by the cache timeout, when one is set
+func (h *FileHandler) cacheContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if h.timeouts.Cache <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, h.timeouts.Cache)
+}
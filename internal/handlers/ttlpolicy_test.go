@@ -0,0 +1,49 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+// ttlByKey is a TTL policy with a fixed TTL per key
+type ttlByKey map[string]time.Duration
+
+func (p ttlByKey) TTL(key string) time.Duration {
+	return p[key]
+}
+
+func TestTTLPolicy(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("hot.txt", []byte("hot"))
+	mockStorage.SetObject("pinned.txt", []byte("pinned"))
+	headers := http.Header{}
+	headers.Set("X-Amz-Meta-"+cache.ObjectTTLMetadata, "10s")
+	mockStorage.SetObjectHeaders("pinned.txt", headers)
+	policy := ttlByKey{"hot.txt": time.Hour, "pinned.txt": time.Hour}
+	h := handlers.NewFileHandler(mockCache, mockStorage, handlers.WithTTLPolicy(policy))
+
+	for file, want := range map[string]time.Duration{"hot.txt": time.Hour, "pinned.txt": 10 * time.Second} {
+		getFile(h, file, nil)
+		deadline := time.Now().Add(time.Second)
+		for {
+			entry, found, _ := mockCache.GetEntry(context.Background(), file)
+			if found {
+				if entry.Meta.TTL != want {
+					t.Errorf("Expected %s to be cached for %s, got %s", file, want, entry.Meta.TTL)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s to be cached", file)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
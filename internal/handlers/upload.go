@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/policy"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/signing"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// callbackGrace is how long an upload callback URL stays valid after the
+// upload URL itself expires, so slow uploads can still report completion
+const callbackGrace = 15 * time.Minute
+
+// UploadURLRequest is the body of an upload URL request. All fields are optional.
+type UploadURLRequest struct {
+	// ContentType defaults to the type implied by the file extension
+	ContentType string `json:"content_type,omitempty"`
+	// TTL is a duration such as "15m"
+	TTL string `json:"ttl,omitempty"`
+	// CacheTTL is how long the service caches the file, such as "1h",
+	// overriding the configured TTL. It is stored as cache-ttl metadata, so
+	// the upload must send the returned headers.
+	CacheTTL string `json:"cache_ttl,omitempty"`
+}
+
+// UploadURLResponse describes a presigned direct-to-storage upload
+type UploadURLResponse struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	// CallbackURL is a signed URL to POST once the upload completes; it is
+	// omitted when URL signing is not configured
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// UploadedRequest is the optional body of an upload callback
+type UploadedRequest struct {
+	// Warm fetches the new object into the cache after invalidating it
+	Warm bool `json:"warm,omitempty"`
+}
+
+// UploadedResponse reports the cache changes made by an upload callback
+type UploadedResponse struct {
+	Purged int64 `json:"purged"`
+	Warmed bool  `json:"warmed"`
+}
+
+// UploadURL handles requests for a presigned URL that uploads a file
+// directly to storage, bypassing the service
+func (h *FileHandler) UploadURL(w http.ResponseWriter, r *http.Request) {
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	presigner, ok := h.storage.(storage.UploadPresigner)
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "storage backend does not support direct uploads",
+			ErrorCode: ErrCodeFeatureDisabled,
+		})
+		return
+	}
+
+	var req UploadURLRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	ttl, ok := h.requestTTL(w, req.TTL)
+	if !ok {
+		return
+	}
+	metadata, err := uploadMetadata(req.CacheTTL)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = contentTypeFor(filename)
+	}
+
+	presigned, err := presigner.PresignPut(r.Context(), filename, contentType, metadata, ttl)
+	if errors.Is(err, quota.ErrExceeded) {
+		writeQuotaExceeded(r.Context(), w, err)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to presign upload", "filename", filename, "error", err)
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Failed to create upload URL",
+			ErrorCode: ErrCodeStorageError,
+		})
+		return
+	}
+
+	resp := UploadURLResponse{
+		URL:       presigned.URL,
+		Method:    presigned.Method,
+		ExpiresAt: timestamp(presigned.ExpiresAt),
+	}
+	if len(presigned.Headers) > 0 {
+		resp.Headers = make(map[string]string, len(presigned.Headers))
+		for name := range presigned.Headers {
+			resp.Headers[name] = presigned.Headers.Get(name)
+		}
+	}
+	if h.signer != nil {
+		callbackPath := resourcePath("uploaded", filename)
+		query, err := h.signer.SignURL(signedPath(r.Context(), callbackPath), []string{http.MethodPost}, presigned.ExpiresAt.Add(callbackGrace))
+		switch {
+		case err == nil:
+			resp.CallbackURL = h.baseURL(r) + requestPath(r.Context(), callbackPath) + "?" + query.Encode()
+		case !errors.Is(err, signing.ErrNoActiveKey):
+			slog.WarnContext(r.Context(), "Failed to sign upload callback", "filename", filename, "error", err)
+		}
+	}
+
+	slog.InfoContext(r.Context(), "Issued upload URL", "filename", filename, "ttl", ttl.String())
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    resp,
+	})
+}
+
+// Uploaded handles notifications that a direct upload has landed. The cached
+// copy and its variants are invalidated and, on request, the new object is
+// fetched into the cache.
+func (h *FileHandler) Uploaded(w http.ResponseWriter, r *http.Request) {
+	filename, ok := h.pathFilename(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(r.Context())
+	defer cancel()
+
+	var req UploadedRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	exists, err := h.storage.ObjectExists(ctx, filename)
+	if err != nil {
+		kind := classifyFailure(r.Context(), ctx, err)
+		if h.writeTimeoutOrCancel(ctx, w, kind, "exists", "filename", filename, "error", err) {
+			return
+		}
+		slog.ErrorContext(ctx, "Storage error", "filename", filename, "error", err)
+		writeJSON(w, http.StatusInternalServerError, Response{
+			Success:   false,
+			Message:   "Failed to check upload",
+			ErrorCode: ErrCodeStorageError,
+		})
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, Response{
+			Success:   false,
+			Message:   "Uploaded file not found",
+			ErrorCode: ErrCodeFileNotFound,
+		})
+		return
+	}
+
+	var resp UploadedResponse
+	h.precompressed.forget(filename)
+	if h.cache != nil {
+		purged, err := h.purgeKeys(ctx, filename)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to invalidate uploaded file", "filename", filename, "error", err)
+			writeJSON(w, http.StatusInternalServerError, Response{
+				Success:   false,
+				Message:   "Failed to invalidate cache",
+				ErrorCode: ErrCodeCacheUnavailable,
+			})
+			return
+		}
+		h.metrics.CachePurgedKeysTotal.Add(float64(purged))
+		resp.Purged = purged
+
+		if req.Warm {
+			resp.Warmed = h.warm(ctx, r.Method, filename)
+		}
+	}
+
+	slog.InfoContext(ctx, "Upload completed", "filename", filename, "purged", resp.Purged, "warmed", resp.Warmed)
+	h.processUpload(ctx, filename, 0, contentTypeFor(filename), uploadSourceDirect)
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    resp,
+	})
+}
+
+// uploadMetadata returns the user metadata to store with an uploaded file,
+// or an error if the requested cache TTL is invalid
+func uploadMetadata(cacheTTL string) (map[string]string, error) {
+	if cacheTTL == "" {
+		return nil, nil
+	}
+	if _, err := cache.ParseObjectTTL(cacheTTL); err != nil {
+		return nil, err
+	}
+	return map[string]string{cache.ObjectTTLMetadata: cacheTTL}, nil
+}
+
+// warm fetches filename into the cache if the cache policy allows it
+func (h *FileHandler) warm(ctx context.Context, method, filename string) bool {
+	data, meta, err := h.fetchObject(ctx, filename)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to fetch uploaded file for warming", "filename", filename, "error", err)
+		return false
+	}
+
+	cacheable := h.policy.Cacheable(&policy.Request{
+		Name:        filename,
+		Size:        int64(len(data)),
+		Method:      method,
+		ContentType: contentTypeFor(filename),
+	})
+	if !cacheable {
+		return false
+	}
+
+	if err := h.storeCached(ctx, filename, data, meta); err != nil {
+		slog.WarnContext(ctx, "Failed to warm uploaded file", "filename", filename, "error", err)
+		return false
+	}
+	return true
+}
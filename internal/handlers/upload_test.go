@@ -0,0 +1,172 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+func newUploadMux(t *testing.T, mockCache *mocks.MockCache, mockStorage *mocks.MockStorage) *http.ServeMux {
+	t.Helper()
+
+	keyring, err := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	handler := handlers.NewFileHandler(mockCache, mockStorage,
+		handlers.WithSignedURLs(keyring, handlers.DefaultPresignConfig()),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload-url/{name...}", handler.UploadURL)
+	mux.HandleFunc("POST /uploaded/{name...}",
+		handler.VerifySignedURL(handlers.AdminAuthOrSigned("admin-token", handler.Uploaded)))
+	return mux
+}
+
+func TestUpload_URLAndCallback(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mux := newUploadMux(t, mockCache, mockStorage)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload-url/report.pdf", strings.NewReader(`{"ttl": "10m"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data handlers.UploadURLResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Data.Method != http.MethodPut || !strings.HasPrefix(resp.Data.URL, "https://storage.test/report.pdf") {
+		t.Errorf("Unexpected upload URL: %+v", resp.Data)
+	}
+	if resp.Data.Headers["Content-Type"] != "application/pdf" {
+		t.Errorf("Expected Content-Type from extension, got %v", resp.Data.Headers)
+	}
+	if resp.Data.CallbackURL == "" {
+		t.Fatal("Expected a signed callback URL")
+	}
+	callback, err := url.Parse(resp.Data.CallbackURL)
+	if err != nil {
+		t.Fatalf("Invalid callback URL: %v", err)
+	}
+
+	// Callback before the upload lands
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, callback.RequestURI(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d before upload, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// The upload replaces a stale cached copy
+	_ = mockCache.Set(context.Background(), "report.pdf", []byte("old"))
+	mockStorage.SetObject("report.pdf", []byte("new"))
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, callback.RequestURI(), strings.NewReader(`{"warm": true}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var done struct {
+		Data handlers.UploadedResponse `json:"data"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &done)
+	if done.Data.Purged != 1 || !done.Data.Warmed {
+		t.Errorf("Expected purge and warm, got %+v", done.Data)
+	}
+	if data, _, _ := mockCache.Get(context.Background(), "report.pdf"); string(data) != "new" {
+		t.Errorf("Expected cache to hold the new upload, got %q", data)
+	}
+}
+
+func TestUploaded_RequiresAuth(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("report.pdf", []byte("new"))
+	mux := newUploadMux(t, mocks.NewMockCache(), mockStorage)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/uploaded/report.pdf", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without credentials, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/uploaded/report.pdf", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d with admin token, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestUpload_CacheTTL(t *testing.T) {
+	mux := newUploadMux(t, mocks.NewMockCache(), mocks.NewMockStorage())
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload-url/report.pdf", strings.NewReader(`{"cache_ttl": "1h"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data handlers.UploadURLResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if got := resp.Data.Headers["X-Amz-Meta-Cache-Ttl"]; got != "1h" {
+		t.Errorf("Expected cache-ttl metadata header, got %v", resp.Data.Headers)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload-url/report.pdf", strings.NewReader(`{"cache_ttl": "soon"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid cache TTL, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestUpload_NestedKey(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mux := newUploadMux(t, mocks.NewMockCache(), mockStorage)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload-url/reports/2024/q3.pdf", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data handlers.UploadURLResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !strings.HasPrefix(resp.Data.URL, "https://storage.test/reports/2024/q3.pdf") {
+		t.Errorf("Expected the upload URL for the nested key, got %q", resp.Data.URL)
+	}
+	callback, err := url.Parse(resp.Data.CallbackURL)
+	if err != nil {
+		t.Fatalf("Invalid callback URL: %v", err)
+	}
+	if callback.Path != "/uploaded/reports/2024/q3.pdf" {
+		t.Errorf("Expected the callback to keep the key's slashes, got %q", callback.Path)
+	}
+
+	mockStorage.SetObject("reports/2024/q3.pdf", []byte("new"))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, callback.RequestURI(), nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
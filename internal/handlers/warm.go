@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ch374n/file-downloader/internal/warmer"
+)
+
+// WarmRequest selects the keys to pull into the cache. Keys and Prefix may
+// be combined.
+type WarmRequest struct {
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	// Concurrency is the number of parallel fetches, capped by the server
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// WarmCache handles requests to warm the cache in the background. It
+// responds with a job that can be polled at /admin/cache/warm/{id}.
+func (h *AdminHandler) WarmCache(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWarmJobs(w) {
+		return
+	}
+
+	var req WarmRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "invalid request body",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	if len(req.Keys) == 0 && req.Prefix == "" {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "one of keys or prefix is required",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+	if req.Concurrency < 0 {
+		writeJSON(w, http.StatusBadRequest, Response{
+			Success:   false,
+			Message:   "concurrency must be positive",
+			ErrorCode: ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	job, err := h.warmJobs.Start(warmer.Spec{
+		Keys:        req.Keys,
+		Prefix:      req.Prefix,
+		Concurrency: req.Concurrency,
+	})
+	if err != nil {
+		status, code := http.StatusInternalServerError, ErrCodeInternal
+		switch {
+		case errors.Is(err, warmer.ErrTooManyJobs):
+			status, code = http.StatusTooManyRequests, ErrCodeTooManyRequests
+		case errors.Is(err, warmer.ErrClosed):
+			status, code = http.StatusServiceUnavailable, ErrCodeServiceUnhealthy
+		}
+		writeJSON(w, status, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Warm job started", "job_id", job.ID, "keys", len(req.Keys), "prefix", req.Prefix)
+	w.Header().Set("Location", "/admin/cache/warm/"+job.ID)
+	writeJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Message: "Warm job started",
+		Data:    job,
+	})
+}
+
+// WarmStatus handles requests polling the progress of a warm job
+func (h *AdminHandler) WarmStatus(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWarmJobs(w) {
+		return
+	}
+
+	job, err := h.warmJobs.Get(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: ErrCodeNotFound,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    job,
+	})
+}
+
+func (h *AdminHandler) requireWarmJobs(w http.ResponseWriter) bool {
+	if h.warmJobs == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{
+			Success:   false,
+			Message:   "cache is disabled",
+			ErrorCode: ErrCodeCacheUnavailable,
+		})
+		return false
+	}
+	return true
+}
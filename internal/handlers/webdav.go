@@ -0,0 +1,797 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// WebDAVPrefix is the path the WebDAV API is served under
+const WebDAVPrefix = "/dav"
+
+// DefaultWebDAVMaxFileSize caps files written over WebDAV, which are
+// buffered in memory before they are stored
+const DefaultWebDAVMaxFileSize = 64 * 1024 * 1024
+
+// webDAVMaxListKeys caps the keys scanned to list, move or delete a
+// directory, since storage can only list everything under a prefix
+const webDAVMaxListKeys = 10000
+
+// webDAVDirContentType is the content type of the empty objects keeping
+// directories created over WebDAV, as "<dir>/"
+const webDAVDirContentType = "application/x-directory"
+
+// webDAVReadMethods may be sent without credentials
+var webDAVReadMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+// WebDAVHandler serves storage over WebDAV under WebDAVPrefix, so it can be
+// mounted in Finder, Explorer and the like. Directories are the "/"
+// separated prefixes of keys, and reads go through the cache. Reads may be
+// anonymous; writes need a credential with the files:write scope, sent as
+// basic auth with its name as user and token as password, or as a bearer
+// token. Locks are held in memory, so clients locking files must stick to
+// one replica.
+type WebDAVHandler struct {
+	files       *FileHandler
+	authn       *auth.Authenticator
+	maxFileSize int64
+	dav         *webdav.Handler
+}
+
+// NewWebDAVHandler creates a WebDAVHandler for the files of h.
+// maxFileSize <= 0 uses DefaultWebDAVMaxFileSize.
+func NewWebDAVHandler(h *FileHandler, authn *auth.Authenticator, maxFileSize int64) *WebDAVHandler {
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultWebDAVMaxFileSize
+	}
+	return &WebDAVHandler{
+		files:       h,
+		authn:       authn,
+		maxFileSize: maxFileSize,
+		dav: &webdav.Handler{
+			Prefix:     WebDAVPrefix,
+			FileSystem: &davFS{files: h, maxFileSize: maxFileSize},
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil && !os.IsNotExist(err) {
+					slog.WarnContext(r.Context(), "WebDAV request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+				}
+			},
+		},
+	}
+}
+
+// ServeHTTP authenticates the request and serves it
+func (d *WebDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, token, basic := r.BasicAuth()
+	if !basic {
+		token = adminToken(r)
+	}
+	read := webDAVReadMethods[r.Method]
+
+	if token != "" || !read {
+		cred, ok := d.authn.Authenticate(token)
+		if token == "" && !basic {
+			cred, ok = certificateCredential(d.authn, r)
+		}
+		if !ok || (basic && cred.Name != user) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="files", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !read && !cred.Allows(auth.ScopeFilesWrite) {
+			http.Error(w, "credential lacks scope "+string(auth.ScopeFilesWrite), http.StatusForbidden)
+			return
+		}
+		r = r.WithContext(auth.WithCredential(r.Context(), cred))
+	}
+	if r.Method == http.MethodPut && r.ContentLength > d.maxFileSize {
+		http.Error(w, fmt.Sprintf("files may be at most %d bytes", d.maxFileSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	stats := &davStats{infos: make(map[string]*davFileInfo)}
+	ctx := context.WithValue(r.Context(), davStatsKey{}, stats)
+	if r.Method == http.MethodPut {
+		ctx = context.WithValue(ctx, davUploadKey{}, r.Header)
+	}
+	if r.Method != http.MethodGet {
+		d.dav.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+	counted := &countingWriter{ResponseWriter: w}
+	d.dav.ServeHTTP(counted, r.WithContext(ctx))
+	if key, source := stats.getRead(); source != "" {
+		d.files.countServed(ctx, key, apiWebDAV, source, counted.n)
+	}
+}
+
+type davStatsKey struct{}
+
+// davUploadKey carries the headers of a PUT, so the file written can be
+// checked against its digests before it is stored
+type davUploadKey struct{}
+
+// davStats remembers the files described while serving one request, since
+// PROPFIND stats each entry of a directory listing again
+type davStats struct {
+	mu    sync.Mutex
+	infos map[string]*davFileInfo
+	// key and source are the last file read and where it came from, for
+	// counting the bytes a GET serves
+	key    string
+	source string
+}
+
+func davStatsFrom(ctx context.Context) *davStats {
+	stats, _ := ctx.Value(davStatsKey{}).(*davStats)
+	return stats
+}
+
+func (s *davStats) setRead(key, source string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key, s.source = key, source
+}
+
+func (s *davStats) getRead() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key, s.source
+}
+
+func (s *davStats) get(key string) (*davFileInfo, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.infos[key]
+	return info, ok
+}
+
+func (s *davStats) put(key string, info *davFileInfo) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.infos[key] = info
+}
+
+// reset forgets everything after a write
+func (s *davStats) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.infos)
+}
+
+// davFileInfo describes a file or directory. Modification times are kept
+// to the second, as storage reports them in headers, so the ETags WebDAV
+// derives from them agree between listings and reads.
+type davFileInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	dir         bool
+	contentType string
+}
+
+func (i *davFileInfo) Name() string       { return i.name }
+func (i *davFileInfo) Size() int64        { return i.size }
+func (i *davFileInfo) ModTime() time.Time { return i.modTime }
+func (i *davFileInfo) IsDir() bool        { return i.dir }
+func (i *davFileInfo) Sys() any           { return nil }
+
+func (i *davFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ContentType saves WebDAV from reading files to sniff their type
+func (i *davFileInfo) ContentType(context.Context) (string, error) {
+	if i.contentType != "" {
+		return i.contentType, nil
+	}
+	return contentTypeFor(i.name), nil
+}
+
+// davFS is a webdav.FileSystem over the cache and storage of a FileHandler
+type davFS struct {
+	files       *FileHandler
+	maxFileSize int64
+}
+
+// davClean cleans a WebDAV path, which keeps the trailing slash of
+// collections
+func davClean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// davKey maps a clean WebDAV path to a key
+func davKey(name string) string {
+	return strings.TrimPrefix(name, "/")
+}
+
+// davError converts storage errors to the os errors WebDAV checks for
+func davError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		err = os.ErrNotExist
+	case errors.Is(err, errPolicyDenied), errors.Is(err, errInvalidFilename), errors.Is(err, storage.ErrAccessDenied), errors.Is(err, quota.ErrExceeded):
+		err = os.ErrPermission
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name = davClean(name)
+	info, err := fs.stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (fs *davFS) stat(ctx context.Context, name string) (*davFileInfo, error) {
+	key := davKey(name)
+	if key == "" {
+		return &davFileInfo{name: "/", dir: true}, nil
+	}
+	stats := davStatsFrom(ctx)
+	if info, ok := stats.get(key); ok {
+		return info, nil
+	}
+
+	h := fs.files
+	opCtx, cancel := h.requestContext(ctx)
+	defer cancel()
+	filename, err := h.resolveName(opCtx, key, http.MethodGet)
+	if err != nil {
+		return nil, davError("stat", name, err)
+	}
+	var info *davFileInfo
+	stat, err := h.statFile(ctx, opCtx, filename)
+	switch {
+	case err == nil:
+		modTime, _ := http.ParseTime(stat.meta.LastModified)
+		info = &davFileInfo{
+			name:        path.Base(key),
+			size:        stat.size,
+			modTime:     modTime,
+			contentType: objectContentType(filename, stat.meta),
+		}
+	case errors.Is(err, storage.ErrNotFound):
+		// Not a file, but a directory if any key is under it
+		page, err := h.listPage(ctx, opCtx, key+"/", "", 1)
+		if err != nil {
+			return nil, davError("stat", name, err)
+		}
+		if len(page.Objects) == 0 {
+			return nil, davError("stat", name, storage.ErrNotFound)
+		}
+		info = &davFileInfo{name: path.Base(key), dir: true, modTime: page.Objects[0].LastModified.Truncate(time.Second)}
+	default:
+		return nil, davError("stat", name, err)
+	}
+	stats.put(key, info)
+	return info, nil
+}
+
+// checkParent returns an error unless the directory holding name exists
+func (fs *davFS) checkParent(ctx context.Context, name string) error {
+	parent, err := fs.stat(ctx, path.Dir(name))
+	if err != nil {
+		return err
+	}
+	if !parent.dir {
+		return &os.PathError{Op: "stat", Path: path.Dir(name), Err: errors.New("not a directory")}
+	}
+	return nil
+}
+
+// listKeys returns the keys under prefix, failing if there are more than
+// webDAVMaxListKeys
+func (fs *davFS) listKeys(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	token := ""
+	for {
+		opCtx, cancel := fs.files.requestContext(ctx)
+		page, err := fs.files.listPage(ctx, opCtx, prefix, token, maxListLimit)
+		cancel()
+		if err != nil {
+			return objects, err
+		}
+		objects = append(objects, page.Objects...)
+		if page.NextToken == "" {
+			return objects, nil
+		}
+		if len(objects) >= webDAVMaxListKeys {
+			return objects, fmt.Errorf("more than %d files under %s", webDAVMaxListKeys, prefix)
+		}
+		token = page.NextToken
+	}
+}
+
+func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = davClean(name)
+	key := davKey(name)
+	// PROPPATCH opens files read-write without creating or truncating them,
+	// and must not overwrite them on close
+	if flag&(os.O_CREATE|os.O_TRUNC) != 0 {
+		if key == "" {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrInvalid}
+		}
+		if err := fs.files.filenames.Check(key); err != nil {
+			return nil, davError("open", name, err)
+		}
+		if err := fs.checkParent(ctx, name); err != nil {
+			return nil, err
+		}
+		return &davWriteFile{fs: fs, ctx: ctx, name: name, key: key}, nil
+	}
+
+	info, err := fs.stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.dir {
+		return &davDir{fs: fs, ctx: ctx, key: key, info: info}, nil
+	}
+	return &davFile{fs: fs, ctx: ctx, key: key, info: info}, nil
+}
+
+func (fs *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = davClean(name)
+	key := davKey(name)
+	if _, err := fs.stat(ctx, name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := fs.checkParent(ctx, name); err != nil {
+		return err
+	}
+
+	opCtx, cancel := fs.files.requestContext(ctx)
+	defer cancel()
+	if err := fs.files.storage.PutObject(opCtx, key+"/", bytes.NewReader(nil), webDAVDirContentType); err != nil {
+		return davError("mkdir", name, err)
+	}
+	davStatsFrom(ctx).reset()
+	slog.InfoContext(ctx, "Directory created", "prefix", key+"/")
+	return nil
+}
+
+func (fs *davFS) RemoveAll(ctx context.Context, name string) error {
+	name = davClean(name)
+	key := davKey(name)
+	if key == "" {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+	info, err := fs.stat(ctx, name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer davStatsFrom(ctx).reset()
+
+	if !info.dir {
+		return fs.remove(ctx, name, key)
+	}
+	objects, err := fs.listKeys(ctx, key+"/")
+	if err != nil {
+		return davError("remove", name, err)
+	}
+	for _, obj := range objects {
+		if err := fs.remove(ctx, name, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove deletes key. Cache failures are logged, as the file is gone from
+// storage by then.
+func (fs *davFS) remove(ctx context.Context, name, key string) error {
+	opCtx, cancel := fs.files.requestContext(ctx)
+	defer cancel()
+	purged, err := fs.files.deleteFile(opCtx, key)
+	if errors.Is(err, errInvalidation) {
+		slog.ErrorContext(ctx, "Failed to invalidate cache", "filename", key, "error", err)
+	} else if err != nil {
+		return davError("remove", name, err)
+	}
+	slog.InfoContext(ctx, "File deleted", "filename", key, "purged", purged)
+	return nil
+}
+
+// Rename copies the files under oldName to newName and deletes them, since
+// storage can't rename in place
+func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, newName = davClean(oldName), davClean(newName)
+	oldKey, newKey := davKey(oldName), davKey(newName)
+	if oldKey == "" || newKey == "" {
+		return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrPermission}
+	}
+	if err := fs.files.filenames.Check(newKey); err != nil {
+		return davError("rename", newName, err)
+	}
+	info, err := fs.stat(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if err := fs.checkParent(ctx, newName); err != nil {
+		return err
+	}
+	defer davStatsFrom(ctx).reset()
+
+	if !info.dir {
+		return fs.move(ctx, oldName, oldKey, newKey)
+	}
+	objects, err := fs.listKeys(ctx, oldKey+"/")
+	if err != nil {
+		return davError("rename", oldName, err)
+	}
+	// Every file is checked before any is moved, so a denied file doesn't
+	// leave the directory half moved
+	for _, obj := range objects {
+		if _, err := fs.checkMove(ctx, oldName, obj.Key, newKey+strings.TrimPrefix(obj.Key, oldKey)); err != nil {
+			return err
+		}
+	}
+	for _, obj := range objects {
+		if err := fs.move(ctx, oldName, obj.Key, newKey+strings.TrimPrefix(obj.Key, oldKey)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMove applies the request policies to a move of from to to, as a
+// read of from and a write of to, and returns the name from resolves to
+func (fs *davFS) checkMove(ctx context.Context, name, from, to string) (string, error) {
+	from, err := fs.files.resolveName(ctx, from, http.MethodGet)
+	if err != nil {
+		return "", davError("rename", name, err)
+	}
+	if _, err := fs.files.resolveName(ctx, to, http.MethodPut); err != nil {
+		return "", davError("rename", name, err)
+	}
+	return from, nil
+}
+
+// move stores the content of from as to and deletes from
+func (fs *davFS) move(ctx context.Context, name, from, to string) error {
+	h := fs.files
+	from, err := fs.checkMove(ctx, name, from, to)
+	if err != nil {
+		return err
+	}
+	opCtx, cancel := h.requestContext(ctx)
+	defer cancel()
+
+	data, meta, _, err := h.fetchWithFallback(ctx, opCtx, from)
+	if err != nil {
+		return davError("rename", name, err)
+	}
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = contentTypeFor(to)
+	}
+	if err := h.storage.PutObject(opCtx, to, bytes.NewReader(data), contentType); err != nil {
+		return davError("rename", name, err)
+	}
+	if _, err := h.invalidate(opCtx, to); err != nil {
+		slog.ErrorContext(ctx, "Failed to invalidate cache", "filename", to, "error", err)
+	}
+	if err := fs.remove(ctx, name, from); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "File moved", "from", from, "to", to)
+	if contentType != webDAVDirContentType {
+		h.processUpload(opCtx, to, int64(len(data)), contentType, uploadSourceWebDAV)
+	}
+	return nil
+}
+
+// davFile is a file opened for reading. Its content is only read through
+// the cache once it is read, so PROPFIND and HEAD requests only stat it.
+type davFile struct {
+	fs     *davFS
+	ctx    context.Context
+	key    string
+	info   *davFileInfo
+	reader *bytes.Reader
+	// pos is the offset sought to before the content was loaded
+	pos int64
+}
+
+func (f *davFile) load() error {
+	if f.reader != nil {
+		return nil
+	}
+	h := f.fs.files
+	ctx, cancel := h.requestContext(f.ctx)
+	defer cancel()
+
+	filename, err := h.resolveName(ctx, f.key, http.MethodGet)
+	if err != nil {
+		return davError("read", f.key, err)
+	}
+	file, err := h.readThrough(f.ctx, ctx, filename, false)
+	if err != nil {
+		return davError("read", f.key, err)
+	}
+	f.reader = bytes.NewReader(file.data)
+	davStatsFrom(f.ctx).setRead(filename, file.source())
+	_, err = f.reader.Seek(f.pos, io.SeekStart)
+	return err
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Read(p)
+}
+
+// Seek works on the stat'ed size until the content is loaded, so
+// http.ServeContent can find the size without reading the file
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader != nil {
+		return f.reader.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *davFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.key, Err: errors.New("not a directory")}
+}
+
+func (f *davFile) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.key, Err: os.ErrPermission}
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) { return f.info, nil }
+func (f *davFile) Close() error               { return nil }
+
+// davDir is an open directory, listed on the first Readdir
+type davDir struct {
+	fs      *davFS
+	ctx     context.Context
+	key     string
+	info    *davFileInfo
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.listed {
+		if err := d.list(); err != nil {
+			return nil, err
+		}
+		d.listed = true
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// list reads the entries of the directory from the keys under it: files
+// directly in it and the directories their remaining "/" separated
+// segments imply. Listings stop at webDAVMaxListKeys keys.
+func (d *davDir) list() error {
+	prefix := ""
+	if d.key != "" {
+		prefix = d.key + "/"
+	}
+	stats := davStatsFrom(d.ctx)
+	dirs := make(map[string]*davFileInfo)
+
+	token, scanned := "", 0
+	for {
+		opCtx, cancel := d.fs.files.requestContext(d.ctx)
+		page, err := d.fs.files.listPage(d.ctx, opCtx, prefix, token, maxListLimit)
+		cancel()
+		if err != nil {
+			return davError("readdir", "/"+d.key, err)
+		}
+		for _, obj := range page.Objects {
+			name, _, isDir := strings.Cut(obj.Key[len(prefix):], "/")
+			if name == "" {
+				continue
+			}
+			modTime := obj.LastModified.Truncate(time.Second)
+			if isDir {
+				if dir, ok := dirs[name]; ok {
+					if modTime.After(dir.modTime) {
+						dir.modTime = modTime
+					}
+					continue
+				}
+				dir := &davFileInfo{name: name, dir: true, modTime: modTime}
+				dirs[name] = dir
+				d.entries = append(d.entries, dir)
+				stats.put(prefix+name, dir)
+				continue
+			}
+			info := &davFileInfo{name: name, size: obj.Size, modTime: modTime}
+			d.entries = append(d.entries, info)
+			stats.put(prefix+name, info)
+		}
+
+		scanned += len(page.Objects)
+		if page.NextToken == "" {
+			return nil
+		}
+		if scanned >= webDAVMaxListKeys {
+			slog.WarnContext(d.ctx, "WebDAV directory listing truncated", "prefix", prefix, "keys", scanned)
+			return nil
+		}
+		token = page.NextToken
+	}
+}
+
+func (d *davDir) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: "/" + d.key, Err: errors.New("is a directory")}
+}
+
+func (d *davDir) Seek(int64, int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: "/" + d.key, Err: errors.New("is a directory")}
+}
+
+func (d *davDir) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: "/" + d.key, Err: errors.New("is a directory")}
+}
+
+func (d *davDir) Stat() (os.FileInfo, error) { return d.info, nil }
+func (d *davDir) Close() error               { return nil }
+
+// davWriteFile buffers a file being written and stores it on Close, unless
+// writing it failed
+type davWriteFile struct {
+	fs   *davFS
+	ctx  context.Context
+	name string
+	key  string
+	buf  bytes.Buffer
+	err  error
+	done bool
+}
+
+func (f *davWriteFile) tooLarge() error {
+	return &os.PathError{Op: "write", Path: f.name, Err: fmt.Errorf("files may be at most %d bytes", f.fs.maxFileSize)}
+}
+
+func (f *davWriteFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	if int64(f.buf.Len()+len(p)) > f.fs.maxFileSize {
+		f.err = f.tooLarge()
+		return 0, f.err
+	}
+	return f.buf.Write(p)
+}
+
+// ReadFrom lets io.Copy hand over the request body, so a body that fails
+// to read is noticed and not stored truncated
+func (f *davWriteFile) ReadFrom(r io.Reader) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	n, err := f.buf.ReadFrom(io.LimitReader(r, f.fs.maxFileSize-int64(f.buf.Len())+1))
+	if err == nil && int64(f.buf.Len()) > f.fs.maxFileSize {
+		err = f.tooLarge()
+	}
+	f.err = err
+	return n, err
+}
+
+func (f *davWriteFile) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrPermission}
+}
+
+func (f *davWriteFile) Seek(int64, int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrPermission}
+}
+
+func (f *davWriteFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+}
+
+func (f *davWriteFile) Stat() (os.FileInfo, error) {
+	return &davFileInfo{
+		name:    path.Base(f.key),
+		size:    int64(f.buf.Len()),
+		modTime: time.Now().Truncate(time.Second),
+	}, nil
+}
+
+func (f *davWriteFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if f.err != nil {
+		return f.err
+	}
+
+	if header, ok := f.ctx.Value(davUploadKey{}).(http.Header); ok {
+		if err := verifyDigests(header, f.buf.Bytes()); err != nil {
+			slog.InfoContext(f.ctx, "Rejected upload digest", "filename", f.key, "error", err)
+			return &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+
+	h := f.fs.files
+	ctx, cancel := h.requestContext(f.ctx)
+	defer cancel()
+	contentType := contentTypeFor(f.key)
+	size := int64(f.buf.Len())
+	if err := h.storage.PutObject(ctx, f.key, &f.buf, contentType); err != nil {
+		return davError("write", f.name, err)
+	}
+	davStatsFrom(f.ctx).reset()
+	purged, err := h.invalidate(ctx, f.key)
+	if err != nil {
+		return davError("write", f.name, err)
+	}
+
+	slog.InfoContext(ctx, "File stored", "filename", f.key, "size", size, "purged", purged)
+	h.processUpload(ctx, f.key, size, contentType, uploadSourceWebDAV)
+	return nil
+}
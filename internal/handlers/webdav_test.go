@@ -0,0 +1,238 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/auth"
+	"github.com/ch374n/file-downloader/internal/handlers"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/policy"
+)
+
+// newWebDAVServer serves the WebDAV API for h, allowing files of up to
+// 1 KiB
+func newWebDAVServer(t *testing.T, h *handlers.FileHandler) *httptest.Server {
+	t.Helper()
+	authn := auth.NewAuthenticator(
+		auth.Credential{Name: "writer", Token: "write-token", Scopes: []auth.Scope{auth.ScopeFilesWrite}},
+		auth.Credential{Name: "reader", Token: "read-token", Scopes: []auth.Scope{auth.ScopeReportsRead}},
+	)
+	mux := http.NewServeMux()
+	mux.Handle(handlers.WebDAVPrefix+"/", handlers.NewWebDAVHandler(h, authn, 1024))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// davRequest sends a WebDAV request, authenticated as user unless it is
+// empty, and returns the response status and body
+func davRequest(t *testing.T, server *httptest.Server, method, path, user, password, body string, headers map[string]string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestWebDAVHandler_Propfind(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("top.txt", []byte("top"))
+	mockStorage.SetObject("docs/a.txt", []byte("aaa"))
+	mockStorage.SetObject("docs/sub/b.txt", []byte("bbb"))
+	server := newWebDAVServer(t, handlers.NewFileHandler(mocks.NewMockCache(), mockStorage))
+
+	status, body := davRequest(t, server, "PROPFIND", "/dav/", "", "", "", map[string]string{"Depth": "1"})
+	if status != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", status, body)
+	}
+	for _, want := range []string{"<D:href>/dav/</D:href>", "<D:href>/dav/top.txt</D:href>", "<D:href>/dav/docs/</D:href>", "<D:collection"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the listing to contain %s, got %s", want, body)
+		}
+	}
+	if strings.Contains(body, "a.txt") {
+		t.Errorf("Expected only the top level, got %s", body)
+	}
+
+	status, body = davRequest(t, server, "PROPFIND", "/dav/docs/", "", "", "", map[string]string{"Depth": "1"})
+	if status != http.StatusMultiStatus || !strings.Contains(body, "/dav/docs/a.txt") || !strings.Contains(body, "/dav/docs/sub/") {
+		t.Errorf("Expected the docs listing, got %d: %s", status, body)
+	}
+	if !strings.Contains(body, "<D:getcontentlength>3</D:getcontentlength>") {
+		t.Errorf("Expected file sizes in the listing, got %s", body)
+	}
+	if len(mockStorage.GetCalls) != 0 {
+		t.Errorf("Expected listings not to read files, got %v", mockStorage.GetCalls)
+	}
+
+	if status, _ := davRequest(t, server, "PROPFIND", "/dav/missing/", "", "", "", map[string]string{"Depth": "0"}); status != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing directory, got %d", status)
+	}
+}
+
+func TestWebDAVHandler_GetThroughCache(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("docs/a.txt", []byte("stored"))
+	mockCache.SetData("docs/a.txt", []byte("cached"))
+	server := newWebDAVServer(t, handlers.NewFileHandler(mockCache, mockStorage))
+
+	status, body := davRequest(t, server, http.MethodGet, "/dav/docs/a.txt", "", "", "", nil)
+	if status != http.StatusOK || body != "cached" {
+		t.Errorf("Expected the cached content, got %d: %q", status, body)
+	}
+	if len(mockStorage.GetCalls) != 0 {
+		t.Errorf("Expected no storage reads, got %v", mockStorage.GetCalls)
+	}
+
+	mockCache.ClearData()
+	status, _ = davRequest(t, server, http.MethodHead, "/dav/docs/a.txt", "", "", "", nil)
+	if status != http.StatusOK || len(mockStorage.GetCalls) != 0 {
+		t.Errorf("Expected HEAD to only stat the file, got %d and reads %v", status, mockStorage.GetCalls)
+	}
+	status, body = davRequest(t, server, http.MethodGet, "/dav/docs/a.txt", "", "", "", map[string]string{"Range": "bytes=0-2"})
+	if status != http.StatusPartialContent || body != "sto" {
+		t.Errorf("Expected a range of the stored content, got %d: %q", status, body)
+	}
+}
+
+func TestWebDAVHandler_Auth(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	server := newWebDAVServer(t, handlers.NewFileHandler(mocks.NewMockCache(), mockStorage))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "wrong token", user: "writer", password: "nope", want: http.StatusUnauthorized},
+		{name: "token of another credential", user: "writer", password: "read-token", want: http.StatusUnauthorized},
+		{name: "missing scope", user: "reader", password: "read-token", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := davRequest(t, server, http.MethodPut, "/dav/a.txt", tt.user, tt.password, "data", nil); status != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, status)
+			}
+		})
+	}
+	if len(mockStorage.PutCalls) != 0 {
+		t.Errorf("Expected nothing to be stored, got %v", mockStorage.PutCalls)
+	}
+
+	if status, _ := davRequest(t, server, http.MethodPut, "/dav/big.bin", "writer", "write-token", strings.Repeat("x", 2048), nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a file over the limit, got %d", status)
+	}
+}
+
+func TestWebDAVHandler_Writes(t *testing.T) {
+	ctx := context.Background()
+	mockCache := mocks.NewMockCache()
+	mockStorage := mocks.NewMockStorage()
+	server := newWebDAVServer(t, handlers.NewFileHandler(mockCache, mockStorage))
+	write := func(method, path, body string, headers map[string]string) int {
+		t.Helper()
+		status, _ := davRequest(t, server, method, path, "writer", "write-token", body, headers)
+		return status
+	}
+	exists := func(key string) bool {
+		ok, _ := mockStorage.ObjectExists(ctx, key)
+		return ok
+	}
+
+	if status := write(http.MethodPut, "/dav/docs/a.txt", "hello", nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409 without the parent directory, got %d", status)
+	}
+	if status := write("MKCOL", "/dav/docs/", "", nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 for MKCOL, got %d", status)
+	}
+	if !exists("docs/") {
+		t.Error("Expected a directory marker to be stored")
+	}
+
+	mockCache.SetData("docs/a.txt", []byte("old"))
+	if status := write(http.MethodPut, "/dav/docs/a.txt", "hello", nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 for PUT, got %d", status)
+	}
+	if put := mockStorage.PutCalls[len(mockStorage.PutCalls)-1]; put.Key != "docs/a.txt" || string(put.Data) != "hello" || put.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected put %s %q %s", put.Key, put.Data, put.ContentType)
+	}
+	if _, found, _ := mockCache.Get(ctx, "docs/a.txt"); found {
+		t.Error("Expected the old version to be purged")
+	}
+
+	if status := write("MOVE", "/dav/docs/", "", map[string]string{"Destination": server.URL + "/dav/moved/"}); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 for MOVE, got %d", status)
+	}
+	if exists("docs/a.txt") || exists("docs/") || !exists("moved/a.txt") || !exists("moved/") {
+		t.Error("Expected the directory and its files to be moved")
+	}
+	if status, body := davRequest(t, server, http.MethodGet, "/dav/moved/a.txt", "", "", "", nil); status != http.StatusOK || body != "hello" {
+		t.Errorf("Expected the moved file, got %d: %q", status, body)
+	}
+
+	if status := write(http.MethodDelete, "/dav/moved/", "", nil); status != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for DELETE, got %d", status)
+	}
+	if exists("moved/a.txt") || exists("moved/") {
+		t.Error("Expected the directory and its files to be deleted")
+	}
+}
+
+func TestWebDAVHandler_MoveDenied(t *testing.T) {
+	ctx := context.Background()
+	policies, err := policy.CompileSet("", "prefix('private/')")
+	if err != nil {
+		t.Fatalf("CompileSet failed: %v", err)
+	}
+	mockStorage := mocks.NewMockStorage()
+	for _, key := range []string{"private/", "private/a.txt", "private/b.txt", "docs/", "docs/c.txt"} {
+		mockStorage.SetObject(key, []byte(key))
+	}
+	server := newWebDAVServer(t, handlers.NewFileHandler(mocks.NewMockCache(), mockStorage, handlers.WithPolicies(policies)))
+	move := func(from, to string) int {
+		t.Helper()
+		status, _ := davRequest(t, server, "MOVE", from, "writer", "write-token", "", map[string]string{"Destination": server.URL + to})
+		return status
+	}
+
+	// Moving a directory reads every file under it, so the denied files
+	// can't be moved out from under the policy
+	if status := move("/dav/private/", "/dav/public/"); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 moving a denied directory, got %d", status)
+	}
+	// Nor can files be moved under a denied prefix
+	if status := move("/dav/docs/", "/dav/private/docs/"); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 moving into a denied directory, got %d", status)
+	}
+	for _, key := range []string{"private/a.txt", "private/b.txt", "docs/c.txt"} {
+		if ok, _ := mockStorage.ObjectExists(ctx, key); !ok {
+			t.Errorf("Expected %s to stay in place", key)
+		}
+	}
+	for _, key := range []string{"public/a.txt", "public/b.txt", "private/docs/c.txt"} {
+		if ok, _ := mockStorage.ObjectExists(ctx, key); ok {
+			t.Errorf("Expected %s not to be written", key)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package healthcheck checks dependencies in the background, so health
+// endpoints can report their status without reaching them on every request
+package healthcheck
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Check reports whether a dependency is reachable
+type Check func(ctx context.Context) error
+
+// Status is the outcome of a dependency's latest check
+type Status struct {
+	Err       error
+	CheckedAt time.Time
+}
+
+// Prober runs named checks periodically and keeps their latest outcome
+type Prober struct {
+	checks  map[string]Check
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	status map[string]Status
+}
+
+// NewProber creates a Prober for checks, giving each timeout per run
+func NewProber(timeout time.Duration, checks map[string]Check) *Prober {
+	return &Prober{
+		checks:  checks,
+		timeout: timeout,
+		status:  make(map[string]Status, len(checks)),
+	}
+}
+
+// Check runs every check concurrently and records their outcomes
+func (p *Prober) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, check := range p.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+			err := check(checkCtx)
+
+			p.mu.Lock()
+			previous, checked := p.status[name]
+			p.status[name] = Status{Err: err, CheckedAt: time.Now()}
+			p.mu.Unlock()
+
+			// Log transitions only, not every failed probe
+			if err != nil && (!checked || previous.Err == nil) {
+				slog.Warn("Dependency unhealthy", "dependency", name, "error", err)
+			} else if err == nil && checked && previous.Err != nil {
+				slog.Info("Dependency recovered", "dependency", name)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Run checks every interval until ctx is canceled
+func (p *Prober) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Check(ctx)
+		}
+	}
+}
+
+// Status returns the latest outcome of the named check, and false until it
+// has run
+func (p *Prober) Status(name string) (Status, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	status, ok := p.status[name]
+	return status, ok
+}
@@ -0,0 +1,76 @@
+package healthcheck_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/healthcheck"
+)
+
+func TestProber_Check(t *testing.T) {
+	errDown := errors.New("down")
+	var calls atomic.Int32
+	prober := healthcheck.NewProber(time.Second, map[string]healthcheck.Check{
+		"up":   func(context.Context) error { calls.Add(1); return nil },
+		"down": func(context.Context) error { return errDown },
+	})
+
+	if _, ok := prober.Status("up"); ok {
+		t.Error("Expected no status before the first check")
+	}
+
+	before := time.Now()
+	prober.Check(context.Background())
+	up, ok := prober.Status("up")
+	if !ok || up.Err != nil || up.CheckedAt.Before(before) {
+		t.Errorf("Expected a fresh healthy status, got %+v", up)
+	}
+	if down, _ := prober.Status("down"); !errors.Is(down.Err, errDown) {
+		t.Errorf("Expected the check's error, got %v", down.Err)
+	}
+
+	// Reading the status doesn't run the check again
+	prober.Status("up")
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 check, got %d", got)
+	}
+}
+
+func TestProber_Timeout(t *testing.T) {
+	prober := healthcheck.NewProber(10*time.Millisecond, map[string]healthcheck.Check{
+		"slow": func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	prober.Check(context.Background())
+	if status, _ := prober.Status("slow"); !errors.Is(status.Err, context.DeadlineExceeded) {
+		t.Errorf("Expected the check to time out, got %v", status.Err)
+	}
+}
+
+func TestProber_Run(t *testing.T) {
+	var calls atomic.Int32
+	prober := healthcheck.NewProber(time.Second, map[string]healthcheck.Check{
+		"dep": func(context.Context) error { calls.Add(1); return nil },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		prober.Run(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected periodic checks, got %d", calls.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,188 @@
+// Package hotkeys measures per-key request rates over a sliding window to
+// find the keys requested so often they need protecting
+package hotkeys
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+const (
+	// numSlots is how many slots the window is divided into; the window
+	// slides one slot at a time
+	numSlots = 10
+	// maxSlotKeys caps the keys counted per slot; keys first seen once the
+	// slot is full are counted from the next slot on
+	maxSlotKeys = 100000
+)
+
+// Config controls when a key is hot
+type Config struct {
+	// Window is how far back request rates are measured
+	Window time.Duration
+	// Threshold is the rate, in requests per second over the window, at
+	// which a key is hot
+	Threshold float64
+}
+
+// slot counts the requests for each key during one part of the window
+type slot struct {
+	start  time.Time
+	counts map[string]int64
+}
+
+// Key is a key's request rate
+type Key struct {
+	Key      string  `json:"key"`
+	Requests int64   `json:"requests"`
+	Rate     float64 `json:"rate"`
+	Hot      bool    `json:"hot"`
+}
+
+// Tracker counts requests per key. A nil Tracker counts nothing and finds
+// no key hot.
+type Tracker struct {
+	cfg     Config
+	slotLen time.Duration
+	metrics *metrics.Metrics
+
+	mu    sync.Mutex
+	slots [numSlots]slot
+	now   func() time.Time
+}
+
+// New creates a Tracker
+func New(cfg Config, m *metrics.Metrics) *Tracker {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return &Tracker{
+		cfg:     cfg,
+		slotLen: max(cfg.Window/numSlots, time.Millisecond),
+		metrics: m,
+		now:     time.Now,
+	}
+}
+
+// Window is how far back request rates are measured
+func (t *Tracker) Window() time.Duration {
+	return t.cfg.Window
+}
+
+// Threshold is the request rate at which a key is hot
+func (t *Tracker) Threshold() float64 {
+	return t.cfg.Threshold
+}
+
+// Observe counts a request for key
+func (t *Tracker) Observe(key string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.current()
+	if _, ok := s.counts[key]; ok || len(s.counts) < maxSlotKeys {
+		s.counts[key]++
+	}
+}
+
+// current returns the slot for now, clearing it if it last held an older
+// part of the window
+func (t *Tracker) current() *slot {
+	now := t.now()
+	start := now.Truncate(t.slotLen)
+	s := &t.slots[int(start.UnixNano()/int64(t.slotLen))%numSlots]
+	if !s.start.Equal(start) {
+		t.metrics.HotKeys.Set(float64(t.countHot(now)))
+		s.start = start
+		s.counts = make(map[string]int64)
+	}
+	return s
+}
+
+// requests sums key's requests over the window ending at now
+func (t *Tracker) requests(key string, now time.Time) int64 {
+	var n int64
+	for i := range t.slots {
+		if t.inWindow(&t.slots[i], now) {
+			n += t.slots[i].counts[key]
+		}
+	}
+	return n
+}
+
+func (t *Tracker) inWindow(s *slot, now time.Time) bool {
+	return s.counts != nil && now.Sub(s.start) < t.cfg.Window
+}
+
+// rate converts requests over the window to requests per second
+func (t *Tracker) rate(requests int64) float64 {
+	return float64(requests) / t.cfg.Window.Seconds()
+}
+
+// Hot reports whether key is requested at least at the threshold rate
+func (t *Tracker) Hot(key string) bool {
+	return t != nil && t.Rate(key) >= t.cfg.Threshold
+}
+
+// Rate returns key's requests per second over the window
+func (t *Tracker) Rate(key string) float64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rate(t.requests(key, t.now()))
+}
+
+// totals sums the requests of every key over the window ending at now
+func (t *Tracker) totals(now time.Time) map[string]int64 {
+	totals := make(map[string]int64)
+	for i := range t.slots {
+		if s := &t.slots[i]; t.inWindow(s, now) {
+			for key, n := range s.counts {
+				totals[key] += n
+			}
+		}
+	}
+	return totals
+}
+
+func (t *Tracker) countHot(now time.Time) int {
+	hot := 0
+	for _, n := range t.totals(now) {
+		if t.rate(n) >= t.cfg.Threshold {
+			hot++
+		}
+	}
+	return hot
+}
+
+// Top returns the n most requested keys, most requested first
+func (t *Tracker) Top(n int) []Key {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	totals := t.totals(t.now())
+	t.mu.Unlock()
+
+	keys := make([]Key, 0, len(totals))
+	for key, requests := range totals {
+		rate := t.rate(requests)
+		keys = append(keys, Key{Key: key, Requests: requests, Rate: rate, Hot: rate >= t.cfg.Threshold})
+	}
+	slices.SortFunc(keys, func(a, b Key) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), strings.Compare(a.Key, b.Key))
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
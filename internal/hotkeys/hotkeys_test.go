@@ -0,0 +1,81 @@
+package hotkeys
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestTracker(cfg Config) (*Tracker, *time.Time) {
+	now := time.Date(2024, 1, 8, 12, 30, 0, 0, time.UTC)
+	t := New(cfg, nil)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestTracker_Hot(t *testing.T) {
+	tracker, now := newTestTracker(Config{Window: 10 * time.Second, Threshold: 2})
+
+	for range 19 {
+		tracker.Observe("a.png")
+	}
+	tracker.Observe("b.png")
+	if tracker.Hot("a.png") {
+		t.Fatal("Expected 19 requests in 10s to stay under the threshold")
+	}
+	tracker.Observe("a.png")
+	if !tracker.Hot("a.png") {
+		t.Fatal("Expected 20 requests in 10s to reach the threshold")
+	}
+	if rate := tracker.Rate("a.png"); rate != 2 {
+		t.Fatalf("Expected a rate of 2/s, got %v", rate)
+	}
+	if tracker.Hot("b.png") || tracker.Hot("missing.png") {
+		t.Fatal("Expected rarely requested keys not to be hot")
+	}
+
+	// Requests age out one slot at a time
+	*now = now.Add(9 * time.Second)
+	if !tracker.Hot("a.png") {
+		t.Fatal("Expected requests within the window to still count")
+	}
+	*now = now.Add(time.Second)
+	if tracker.Hot("a.png") {
+		t.Fatal("Expected requests older than the window to be forgotten")
+	}
+}
+
+func TestTracker_Top(t *testing.T) {
+	tracker, now := newTestTracker(Config{Window: 10 * time.Second, Threshold: 1})
+
+	for range 5 {
+		tracker.Observe("b.png")
+	}
+	*now = now.Add(3 * time.Second)
+	for range 12 {
+		tracker.Observe("a.png")
+	}
+	tracker.Observe("c.png")
+	tracker.Observe("d.png")
+
+	top := tracker.Top(3)
+	if len(top) != 3 {
+		t.Fatalf("Expected 3 keys, got %+v", top)
+	}
+	if top[0] != (Key{Key: "a.png", Requests: 12, Rate: 1.2, Hot: true}) {
+		t.Errorf("Unexpected busiest key: %+v", top[0])
+	}
+	if top[1] != (Key{Key: "b.png", Requests: 5, Rate: 0.5}) {
+		t.Errorf("Unexpected second key: %+v", top[1])
+	}
+	if top[2].Key != "c.png" {
+		t.Errorf("Expected ties to be ordered by key, got %q", top[2].Key)
+	}
+}
+
+func TestTracker_Nil(t *testing.T) {
+	var tracker *Tracker
+	tracker.Observe("a.png")
+	if tracker.Hot("a.png") || tracker.Top(10) != nil {
+		t.Fatal("Expected a nil tracker to track nothing")
+	}
+}
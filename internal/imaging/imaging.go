@@ -0,0 +1,198 @@
+// Package imaging resizes and converts images on request. Images are
+// scaled to fit the requested box, never enlarged, and re-encoded in the
+// requested format.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // WebP sources are decoded but not encoded
+)
+
+// DefaultQuality is the JPEG quality used when none is requested
+const DefaultQuality = 80
+
+// Transform failures
+var (
+	// ErrInvalidOptions is returned (wrapped) for query parameters that
+	// don't describe an allowed transform
+	ErrInvalidOptions = errors.New("invalid image options")
+	// ErrUnsupportedFormat is returned (wrapped) for output formats that
+	// can't be encoded
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrNotImage is returned (wrapped) for files that aren't a decodable
+	// image
+	ErrNotImage = errors.New("not a supported image")
+	// ErrTooLarge is returned for images with more pixels than allowed
+	ErrTooLarge = errors.New("image too large to transform")
+)
+
+// Config limits the transforms clients may request
+type Config struct {
+	// MaxDimension caps the requested width and height in pixels
+	MaxDimension int
+	// Sizes, when set, lists the only widths and heights allowed, so
+	// clients can't fill the cache with arbitrary variants
+	Sizes []int
+	// MaxPixels caps the pixels of source images, so huge images can't
+	// exhaust memory while decoding
+	MaxPixels int
+}
+
+// Options describes one transform. A zero width or height leaves that side
+// to the aspect ratio, and an empty format keeps the source format.
+type Options struct {
+	Width   int
+	Height  int
+	Format  string
+	Quality int
+}
+
+// Requested reports whether query asks for a transform
+func Requested(query url.Values) bool {
+	return query.Has("w") || query.Has("h") || query.Has("format") || query.Has("q")
+}
+
+// ParseOptions reads the w, h, format and q query parameters, checking
+// them against cfg
+func (cfg Config) ParseOptions(query url.Values) (Options, error) {
+	opts := Options{Quality: DefaultQuality}
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"w", &opts.Width},
+		{"h", &opts.Height},
+	} {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > cfg.MaxDimension {
+			return Options{}, fmt.Errorf("%w: %s must be between 1 and %d", ErrInvalidOptions, p.name, cfg.MaxDimension)
+		}
+		if len(cfg.Sizes) > 0 && !slices.Contains(cfg.Sizes, n) {
+			return Options{}, fmt.Errorf("%w: %s must be one of %v", ErrInvalidOptions, p.name, cfg.Sizes)
+		}
+		*p.value = n
+	}
+
+	if raw := query.Get("q"); raw != "" {
+		q, err := strconv.Atoi(raw)
+		if err != nil || q < 1 || q > 100 {
+			return Options{}, fmt.Errorf("%w: q must be between 1 and 100", ErrInvalidOptions)
+		}
+		opts.Quality = q
+	}
+
+	switch format := strings.ToLower(query.Get("format")); format {
+	case "":
+	case "jpeg", "jpg":
+		opts.Format = "jpeg"
+	case "png", "gif":
+		opts.Format = format
+	case "webp":
+		return Options{}, fmt.Errorf("%w: webp images can be read but not written", ErrUnsupportedFormat)
+	default:
+		return Options{}, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+	return opts, nil
+}
+
+// Variant names the cached copy produced by opts
+func (opts Options) Variant() string {
+	format := opts.Format
+	if format == "" {
+		format = "source"
+	}
+	return fmt.Sprintf("image:%dx%d:q%d:%s", opts.Width, opts.Height, opts.Quality, format)
+}
+
+// ContentType returns the media type of an encoded image format
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// Transform decodes data, scales it to fit opts and encodes it. It returns
+// the encoded image and its format.
+func (cfg Config) Transform(data []byte, opts Options) ([]byte, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+	if cfg.MaxPixels > 0 && config.Width*config.Height > cfg.MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+
+	if opts.Format != "" {
+		format = opts.Format
+	} else if format == "webp" {
+		// Keep transparency, which JPEG can't hold
+		format = "png"
+	}
+
+	dst := resize(src, opts.Width, opts.Height, format == "jpeg")
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: opts.Quality})
+	case "png":
+		err = png.Encode(&buf, dst)
+	case "gif":
+		// Animated GIFs keep their first frame
+		err = gif.Encode(&buf, dst, nil)
+	default:
+		return nil, "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode %s image: %w", format, err)
+	}
+	return buf.Bytes(), format, nil
+}
+
+// resize scales src to fit within width x height, keeping its aspect ratio.
+// Images are never enlarged. Transparency is flattened onto white when
+// opaque is set.
+func resize(src image.Image, width, height int, opaque bool) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := 1.0
+	if width > 0 && width < w {
+		scale = float64(width) / float64(w)
+	}
+	if height > 0 && height < h {
+		scale = min(scale, float64(height)/float64(h))
+	}
+	w = max(1, int(float64(w)*scale+0.5))
+	h = max(1, int(float64(h)*scale+0.5))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	op := xdraw.Src
+	if opaque {
+		xdraw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, xdraw.Src)
+		op = xdraw.Over
+	}
+	if w == bounds.Dx() && h == bounds.Dy() {
+		xdraw.Draw(dst, dst.Bounds(), src, bounds.Min, op)
+		return dst
+	}
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, op, nil)
+	return dst
+}
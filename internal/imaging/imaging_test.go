@@ -0,0 +1,95 @@
+package imaging_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/imaging"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseOptions(t *testing.T) {
+	cfg := imaging.Config{MaxDimension: 1000, Sizes: []int{100, 400}}
+	tests := []struct {
+		query string
+		want  imaging.Options
+		err   error
+	}{
+		{"w=400&format=JPG&q=60", imaging.Options{Width: 400, Format: "jpeg", Quality: 60}, nil},
+		{"h=100", imaging.Options{Height: 100, Quality: imaging.DefaultQuality}, nil},
+		{"w=300", imaging.Options{}, imaging.ErrInvalidOptions},
+		{"w=0", imaging.Options{}, imaging.ErrInvalidOptions},
+		{"q=101", imaging.Options{}, imaging.ErrInvalidOptions},
+		{"format=webp", imaging.Options{}, imaging.ErrUnsupportedFormat},
+		{"format=bmp", imaging.Options{}, imaging.ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := cfg.ParseOptions(query)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseOptions(%q) error = %v, want %v", tt.query, err, tt.err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseOptions(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	cfg := imaging.Config{MaxDimension: 1000, MaxPixels: 1_000_000}
+	src := encodePNG(t, 200, 100)
+
+	tests := []struct {
+		name   string
+		opts   imaging.Options
+		format string
+		w, h   int
+	}{
+		{"fit width", imaging.Options{Width: 50}, "png", 50, 25},
+		{"fit box", imaging.Options{Width: 100, Height: 20, Format: "jpeg", Quality: 80}, "jpeg", 40, 20},
+		{"never enlarged", imaging.Options{Width: 400}, "png", 200, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, format, err := cfg.Transform(src, tt.opts)
+			if err != nil {
+				t.Fatalf("Transform failed: %v", err)
+			}
+			config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Failed to decode result: %v", err)
+			}
+			if format != tt.format || decoded != tt.format || config.Width != tt.w || config.Height != tt.h {
+				t.Errorf("Expected a %dx%d %s, got a %dx%d %s (reported %s)", tt.w, tt.h, tt.format, config.Width, config.Height, decoded, format)
+			}
+		})
+	}
+
+	if _, _, err := cfg.Transform([]byte("not an image"), imaging.Options{Width: 10}); !errors.Is(err, imaging.ErrNotImage) {
+		t.Errorf("Expected ErrNotImage, got %v", err)
+	}
+	small := imaging.Config{MaxDimension: 1000, MaxPixels: 100}
+	if _, _, err := small.Transform(src, imaging.Options{Width: 10}); !errors.Is(err, imaging.ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package inflight caps the file requests served at once, letting a few
+// more wait briefly for a slot, so a traffic spike is turned away early
+// instead of holding hundreds of full file buffers in memory
+package inflight
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// Reasons requests are turned away, used to label metrics
+const (
+	ReasonQueueFull    = "queue_full"
+	ReasonQueueTimeout = "queue_timeout"
+)
+
+// ErrSaturated is returned when a request can't be served because every
+// slot is taken and the queue is full, or it waited too long for a slot
+var ErrSaturated = errors.New("too many requests in flight")
+
+// Config sets the limiter's bounds
+type Config struct {
+	// MaxInFlight caps the requests served at once; 0 means no limit
+	MaxInFlight int
+	// MaxQueue caps the requests waiting for a slot; 0 turns requests
+	// away as soon as every slot is taken
+	MaxQueue int
+	// QueueTimeout bounds how long a request waits for a slot; 0 waits
+	// until the request is canceled
+	QueueTimeout time.Duration
+}
+
+// Limiter hands out a fixed number of slots to requests. A nil *Limiter
+// admits everything. It is safe for concurrent use.
+type Limiter struct {
+	slots        chan struct{}
+	maxQueue     int64
+	queueTimeout time.Duration
+	queued       atomic.Int64
+	metrics      *metrics.Metrics
+}
+
+// New creates a limiter, or returns nil when cfg sets no limit
+func New(cfg Config, m *metrics.Metrics) *Limiter {
+	if cfg.MaxInFlight <= 0 {
+		return nil
+	}
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return &Limiter{
+		slots:        make(chan struct{}, cfg.MaxInFlight),
+		maxQueue:     int64(max(cfg.MaxQueue, 0)),
+		queueTimeout: cfg.QueueTimeout,
+		metrics:      m,
+	}
+}
+
+// Acquire takes a slot, waiting in the queue while none is free. It
+// returns ErrSaturated when the queue is full or the wait times out, and
+// ctx's error when ctx is done first. release must be called once the
+// request is served.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.admit(), nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		l.metrics.FileRequestsRejectedTotal.WithLabelValues(ReasonQueueFull).Inc()
+		return nil, ErrSaturated
+	}
+	l.metrics.FileRequestsQueued.Inc()
+	defer func() {
+		l.queued.Add(-1)
+		l.metrics.FileRequestsQueued.Dec()
+	}()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.admit(), nil
+	case <-timeout:
+		l.metrics.FileRequestsRejectedTotal.WithLabelValues(ReasonQueueTimeout).Inc()
+		return nil, ErrSaturated
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// InFlight returns the number of requests holding a slot
+func (l *Limiter) InFlight() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+// Queued returns the number of requests waiting for a slot
+func (l *Limiter) Queued() int {
+	if l == nil {
+		return 0
+	}
+	return int(l.queued.Load())
+}
+
+// admit records a taken slot and returns its release
+func (l *Limiter) admit() func() {
+	l.metrics.FileRequestsInFlight.Inc()
+	var once atomic.Bool
+	return func() {
+		if once.CompareAndSwap(false, true) {
+			l.metrics.FileRequestsInFlight.Dec()
+			<-l.slots
+		}
+	}
+}
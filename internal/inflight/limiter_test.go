@@ -0,0 +1,111 @@
+package inflight_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ch374n/file-downloader/internal/inflight"
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.New(prometheus.NewRegistry())
+	l := inflight.New(inflight.Config{MaxInFlight: 2, MaxQueue: 1, QueueTimeout: 100 * time.Millisecond}, m)
+
+	first, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	second, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if got := testutil.ToFloat64(m.FileRequestsInFlight); got != 2 {
+		t.Errorf("Expected 2 requests in flight, got %v", got)
+	}
+
+	// A queued request gets the next free slot
+	admitted := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(ctx)
+		if err == nil {
+			defer release()
+		}
+		admitted <- err
+	}()
+	for l.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(m.FileRequestsQueued); got != 1 {
+		t.Errorf("Expected 1 queued request, got %v", got)
+	}
+
+	// Past the queue, requests are turned away straight away
+	if _, err := l.Acquire(ctx); !errors.Is(err, inflight.ErrSaturated) {
+		t.Errorf("Expected ErrSaturated with the queue full, got %v", err)
+	}
+	first()
+	first()
+	if err := <-admitted; err != nil {
+		t.Errorf("Expected the queued request to be admitted, got %v", err)
+	}
+
+	// Requests waiting longer than the queue timeout are turned away
+	third, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if _, err := l.Acquire(ctx); !errors.Is(err, inflight.ErrSaturated) {
+		t.Errorf("Expected ErrSaturated after the queue timeout, got %v", err)
+	}
+	second()
+	third()
+
+	if got := testutil.ToFloat64(m.FileRequestsInFlight); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.FileRequestsQueued); got != 0 {
+		t.Errorf("Expected no queued requests, got %v", got)
+	}
+	for _, reason := range []string{inflight.ReasonQueueFull, inflight.ReasonQueueTimeout} {
+		if got := testutil.ToFloat64(m.FileRequestsRejectedTotal.WithLabelValues(reason)); got != 1 {
+			t.Errorf("Expected 1 %s rejection, got %v", reason, got)
+		}
+	}
+}
+
+func TestLimiter_Canceled(t *testing.T) {
+	l := inflight.New(inflight.Config{MaxInFlight: 1, MaxQueue: 1}, nil)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with its context, got %v", err)
+	}
+	if l.Queued() != 0 {
+		t.Errorf("Expected the canceled request to leave the queue, got %d queued", l.Queued())
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	l := inflight.New(inflight.Config{}, nil)
+	if l != nil {
+		t.Fatal("Expected no limiter without a limit")
+	}
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a nil limiter to admit requests, got %v", err)
+	}
+	release()
+}
@@ -0,0 +1,150 @@
+// Package keyindex maintains lookup indexes over storage keys
+package keyindex
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// listPageSize is the page size used when scanning storage to build indexes
+const listPageSize = 1000
+
+// CaseIndex maps lowercased keys to their canonical stored spelling for a
+// set of prefixes, so lookups under those prefixes can ignore case
+type CaseIndex struct {
+	storage  storage.Storage
+	prefixes []string
+
+	mu        sync.RWMutex
+	canonical map[string]string
+	exact     map[string]struct{}
+}
+
+// NewCaseIndex creates an index covering keys under the given prefixes.
+// A "*" prefix covers every key. The index is empty until Refresh runs.
+func NewCaseIndex(s storage.Storage, prefixes []string) *CaseIndex {
+	normalized := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p == "*" {
+			p = ""
+		}
+		normalized = append(normalized, strings.ToLower(p))
+	}
+	return &CaseIndex{
+		storage:   s,
+		prefixes:  normalized,
+		canonical: make(map[string]string),
+		exact:     make(map[string]struct{}),
+	}
+}
+
+// Covers reports whether name falls under a case-insensitive prefix
+func (c *CaseIndex) Covers(name string) bool {
+	lower := strings.ToLower(name)
+	for _, p := range c.prefixes {
+		if strings.HasPrefix(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the canonical key for name, if one is indexed. A name that
+// exists with its exact spelling resolves to itself.
+func (c *CaseIndex) Resolve(name string) (string, bool) {
+	if !c.Covers(name) {
+		return "", false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.exact[name]; ok {
+		return name, true
+	}
+	canonical, ok := c.canonical[strings.ToLower(name)]
+	return canonical, ok
+}
+
+// Refresh rebuilds the index by listing every covered prefix. When two keys
+// differ only by case the lexically first one wins.
+func (c *CaseIndex) Refresh(ctx context.Context) error {
+	canonical := make(map[string]string)
+	exact := make(map[string]struct{})
+
+	for _, prefix := range c.prefixes {
+		// Storage listing is case-sensitive, so list from the first
+		// case-insensitive character onwards and filter locally
+		listPrefix := caseStablePrefix(prefix)
+		token := ""
+		for {
+			page, err := c.storage.ListObjects(ctx, listPrefix, token, listPageSize)
+			if err != nil {
+				return fmt.Errorf("failed to index prefix %q: %w", prefix, err)
+			}
+			for _, obj := range page.Objects {
+				lower := strings.ToLower(obj.Key)
+				if !strings.HasPrefix(lower, prefix) {
+					continue
+				}
+				exact[obj.Key] = struct{}{}
+				if existing, ok := canonical[lower]; !ok || obj.Key < existing {
+					canonical[lower] = obj.Key
+				}
+			}
+			if page.NextToken == "" {
+				break
+			}
+			token = page.NextToken
+		}
+	}
+
+	c.mu.Lock()
+	c.canonical = canonical
+	c.exact = exact
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the index every interval until ctx is canceled
+func (c *CaseIndex) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := c.Refresh(ctx); err != nil {
+			slog.Warn("Case-insensitive key index refresh failed", "error", err)
+		} else {
+			c.mu.RLock()
+			size := len(c.canonical)
+			c.mu.RUnlock()
+			slog.Debug("Case-insensitive key index refreshed",
+				"keys", size,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// caseStablePrefix returns the leading part of a lowercased prefix that has
+// no letters, i.e. the part whose spelling can't vary by case
+func caseStablePrefix(prefix string) string {
+	for i, r := range prefix {
+		if strings.ToUpper(string(r)) != string(r) {
+			return prefix[:i]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,54 @@
+package keyindex_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/keyindex"
+	"github.com/ch374n/file-downloader/internal/mocks"
+)
+
+func TestCaseIndex_Resolve(t *testing.T) {
+	s := mocks.NewMockStorage()
+	s.SetObject("Docs/Report.PDF", nil)
+	s.SetObject("Docs/report.pdf", nil)
+	s.SetObject("Docs/Summary.txt", nil)
+	s.SetObject("images/Logo.png", nil)
+
+	idx := keyindex.NewCaseIndex(s, []string{"docs/"})
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"docs/summary.TXT", "Docs/Summary.txt", true},
+		{"Docs/report.pdf", "Docs/report.pdf", true},
+		{"DOCS/REPORT.PDF", "Docs/Report.PDF", true},
+		{"docs/missing.txt", "", false},
+		{"images/logo.png", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := idx.Resolve(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Resolve(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCaseIndex_Wildcard(t *testing.T) {
+	s := mocks.NewMockStorage()
+	s.SetObject("README.md", nil)
+
+	idx := keyindex.NewCaseIndex(s, []string{"*"})
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	if got, ok := idx.Resolve("readme.MD"); !ok || got != "README.md" {
+		t.Errorf("Resolve = %q, %v; want README.md, true", got, ok)
+	}
+}
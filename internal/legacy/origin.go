@@ -0,0 +1,127 @@
+// Package legacy reads files from the HTTP file server this service is
+// replacing. During a migration, keys under configured prefixes that are
+// missing from storage are looked up there instead, so clients can be cut
+// over before the data has been copied.
+package legacy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// Config controls which keys fall back to the legacy origin
+type Config struct {
+	// BaseURL is the legacy server's base URL; keys are appended to its path
+	BaseURL string
+	// Prefixes lists the key prefixes served from the legacy origin when
+	// missing from storage; "*" covers every key
+	Prefixes []string
+	// Backfill copies files found on the legacy origin into storage and the
+	// cache, so each one is fetched from the legacy origin only once
+	Backfill bool
+	// Timeout bounds each legacy request, including reading its body
+	Timeout time.Duration
+}
+
+// Origin fetches files from a legacy HTTP server
+type Origin struct {
+	base     *url.URL
+	prefixes []string
+	backfill bool
+	client   *http.Client
+}
+
+// New creates an Origin for cfg
+func New(cfg Config) (*Origin, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid legacy origin: %w", err)
+	}
+	if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid legacy origin %q: must be an absolute http(s) URL", cfg.BaseURL)
+	}
+	if len(cfg.Prefixes) == 0 {
+		return nil, fmt.Errorf("legacy origin %q has no prefixes", cfg.BaseURL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	prefixes := make([]string, 0, len(cfg.Prefixes))
+	for _, p := range cfg.Prefixes {
+		if p == "*" {
+			p = ""
+		}
+		prefixes = append(prefixes, p)
+	}
+	return &Origin{
+		base:     base,
+		prefixes: prefixes,
+		backfill: cfg.Backfill,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Covers reports whether key falls under a legacy prefix
+func (o *Origin) Covers(key string) bool {
+	for _, p := range o.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backfill reports whether files found on the legacy origin should be copied
+// into storage and the cache
+func (o *Origin) Backfill() bool {
+	return o.backfill
+}
+
+// Fetch downloads key from the legacy origin with its response headers. A
+// missing file is reported as storage.ErrNotFound and a refused one as
+// storage.ErrAccessDenied, like the storage backends do.
+func (o *Origin) Fetch(ctx context.Context, key string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.base.JoinPath(key).String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build legacy request: %w", err)
+	}
+	if id := logger.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("legacy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, nil, storage.ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, nil, storage.ErrAccessDenied
+	case resp.StatusCode != http.StatusOK:
+		return nil, nil, fmt.Errorf("legacy origin returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read legacy response: %w", err)
+	}
+
+	// Only object headers are worth keeping; the rest describe this exchange
+	headers := resp.Header.Clone()
+	for _, name := range []string{"Connection", "Date", "Keep-Alive", "Server", "Set-Cookie", "Transfer-Encoding"} {
+		headers.Del(name)
+	}
+	return data, headers, nil
+}
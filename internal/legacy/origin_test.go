@@ -0,0 +1,109 @@
+package legacy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/legacy"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func TestNew_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  legacy.Config
+	}{
+		{"relative URL", legacy.Config{BaseURL: "/files", Prefixes: []string{"*"}}},
+		{"unsupported scheme", legacy.Config{BaseURL: "ftp://legacy.example.com", Prefixes: []string{"*"}}},
+		{"no prefixes", legacy.Config{BaseURL: "http://legacy.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := legacy.New(tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestOrigin_Covers(t *testing.T) {
+	origin, err := legacy.New(legacy.Config{BaseURL: "http://legacy.example.com", Prefixes: []string{"archive/", "old-"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for key, want := range map[string]bool{
+		"archive/2019/report.pdf": true,
+		"old-logo.png":            true,
+		"reports/q1.pdf":          false,
+		"Archive/report.pdf":      false,
+	} {
+		if got := origin.Covers(key); got != want {
+			t.Errorf("Covers(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	all, err := legacy.New(legacy.Config{BaseURL: "http://legacy.example.com", Prefixes: []string{"*"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if !all.Covers("anything") {
+		t.Error("Expected \"*\" to cover every key")
+	}
+}
+
+func TestOrigin_Fetch(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		switch r.URL.Path {
+		case "/static/archive/a b.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("ETag", `"legacy"`)
+			w.Header().Set("Set-Cookie", "session=1")
+			w.Write([]byte("hello"))
+		case "/static/archive/private.txt":
+			w.WriteHeader(http.StatusForbidden)
+		case "/static/archive/broken.txt":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	origin, err := legacy.New(legacy.Config{BaseURL: server.URL + "/static/", Prefixes: []string{"archive/"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	data, headers, err := origin.Fetch(ctx, "archive/a b.txt")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("Expected body %q, got %q", "hello", data)
+	}
+	if gotPath != "/static/archive/a%20b.txt" {
+		t.Errorf("Expected the key to be escaped under the base path, got %q", gotPath)
+	}
+	if headers.Get("ETag") != `"legacy"` || headers.Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected object headers to be kept, got %v", headers)
+	}
+	if headers.Get("Set-Cookie") != "" {
+		t.Error("Expected Set-Cookie to be dropped")
+	}
+
+	if _, _, err := origin.Fetch(ctx, "archive/missing.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, _, err := origin.Fetch(ctx, "archive/private.txt"); !errors.Is(err, storage.ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+	if _, _, err := origin.Fetch(ctx, "archive/broken.txt"); err == nil || errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected an upstream error, got %v", err)
+	}
+}
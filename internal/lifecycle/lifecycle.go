@@ -0,0 +1,122 @@
+// Package lifecycle starts and stops the service's components in order.
+// Components register hooks as they are created; they are started in
+// registration order and stopped in reverse, so a component is stopped
+// before anything it depends on.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a hook that doesn't set its own timeout
+const DefaultTimeout = 10 * time.Second
+
+// Hook is a component's start and stop functions. Either may be nil.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	// Timeout bounds OnStart and OnStop each; zero uses DefaultTimeout
+	Timeout time.Duration
+}
+
+// Manager runs registered hooks. Hooks are stopped only if they were
+// started, and each hook is stopped at most once.
+type Manager struct {
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+// New creates a Manager with no hooks
+func New() *Manager {
+	return &Manager{}
+}
+
+// Append registers a hook to run after those already registered
+func (m *Manager) Append(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, h)
+}
+
+// Start runs the start hooks in registration order. If one fails, the hooks
+// already started are stopped and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for m.started < len(m.hooks) {
+		hook := m.hooks[m.started]
+		if hook.OnStart != nil {
+			if err := run(ctx, hook, hook.OnStart); err != nil {
+				err = fmt.Errorf("failed to start %s: %w", hook.Name, err)
+				if stopErr := m.stopLocked(ctx); stopErr != nil {
+					err = errors.Join(err, stopErr)
+				}
+				return err
+			}
+			slog.DebugContext(ctx, "Started component", "component", hook.Name)
+		}
+		m.started++
+	}
+	return nil
+}
+
+// Stop runs the stop hooks of started components in reverse order. Every
+// hook runs even if an earlier one fails or times out; their errors are
+// joined.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopLocked(ctx)
+}
+
+func (m *Manager) stopLocked(ctx context.Context) error {
+	var errs []error
+	for ; m.started > 0; m.started-- {
+		hook := m.hooks[m.started-1]
+		if hook.OnStop == nil {
+			continue
+		}
+		start := time.Now()
+		if err := run(ctx, hook, hook.OnStop); err != nil {
+			slog.ErrorContext(ctx, "Failed to stop component", "component", hook.Name, "error", err)
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", hook.Name, err))
+			continue
+		}
+		slog.InfoContext(ctx, "Stopped component", "component", hook.Name, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return errors.Join(errs...)
+}
+
+// run calls fn with the hook's timeout. A hook that ignores its context is
+// abandoned when the timeout expires, so one stuck component can't block
+// the others.
+func run(ctx context.Context, hook Hook, fn func(context.Context) error) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		select {
+		case err := <-done:
+			return err
+		default:
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/lifecycle"
+)
+
+// recorder logs hook calls in order
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) hook(name string) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			r.calls = append(r.calls, "start "+name)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			r.calls = append(r.calls, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestManager_Order(t *testing.T) {
+	var rec recorder
+	m := lifecycle.New()
+	m.Append(rec.hook("cache"))
+	m.Append(lifecycle.Hook{Name: "no-op"})
+	m.Append(rec.hook("scheduler"))
+	m.Append(rec.hook("server"))
+
+	ctx := context.Background()
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	// Stopping twice is a no-op
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Second Stop failed: %v", err)
+	}
+
+	want := []string{
+		"start cache", "start scheduler", "start server",
+		"stop server", "stop scheduler", "stop cache",
+	}
+	if !reflect.DeepEqual(rec.calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, rec.calls)
+	}
+}
+
+func TestManager_StartFailureStopsStarted(t *testing.T) {
+	var rec recorder
+	m := lifecycle.New()
+	m.Append(rec.hook("cache"))
+	m.Append(lifecycle.Hook{
+		Name:    "server",
+		OnStart: func(context.Context) error { return errors.New("address in use") },
+		OnStop: func(context.Context) error {
+			t.Error("Expected the failed hook not to be stopped")
+			return nil
+		},
+	})
+	m.Append(rec.hook("never"))
+
+	err := m.Start(context.Background())
+	if err == nil || err.Error() != "failed to start server: address in use" {
+		t.Fatalf("Expected the start error, got %v", err)
+	}
+	if want := []string{"start cache", "stop cache"}; !reflect.DeepEqual(rec.calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, rec.calls)
+	}
+}
+
+func TestManager_StopContinuesPastFailures(t *testing.T) {
+	var rec recorder
+	m := lifecycle.New()
+	m.Append(rec.hook("cache"))
+	m.Append(lifecycle.Hook{
+		Name:    "stuck",
+		OnStop:  func(context.Context) error { select {} },
+		Timeout: 10 * time.Millisecond,
+	})
+	m.Append(lifecycle.Hook{
+		Name:   "broken",
+		OnStop: func(context.Context) error { return errors.New("boom") },
+	})
+
+	ctx := context.Background()
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	err := m.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the stuck hook to time out, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "failed to stop broken: boom") {
+		t.Errorf("Expected the broken hook's error, got %v", err)
+	}
+	if want := []string{"start cache", "stop cache"}; !reflect.DeepEqual(rec.calls, want) {
+		t.Errorf("Expected every hook to be stopped, got %v", rec.calls)
+	}
+}
@@ -0,0 +1,337 @@
+// Package listen opens the listeners servers accept connections on, from a
+// list of addresses that can pin the address family, bind to the addresses
+// of a network interface and carry their own TLS settings. It lets a
+// server listen on IPv4 and IPv6 separately, on one interface only, or in
+// plain text internally and over TLS at the edge.
+//
+// A list is comma-separated; each entry is
+//
+//	[network://]host:port[;option=value...]
+//
+// where network is tcp (the default, dual-stack for an empty or
+// unspecified host), tcp4 or tcp6, and the options are
+//
+//	interface=name     listen on each address of the interface, on port
+//	cert=file          serve TLS with this certificate chain...
+//	key=file           ...and private key
+//	client_ca=file     require client certificates signed by these CAs
+//	client_auth=mode   require (default) or optional, with client_ca
+//	client_names=a|b   only accept client certificates with one of these
+//	                   names as their common name or a SAN, with client_ca
+//	min_tls=version    1.2 (default) or 1.3
+package listen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// TLS holds the TLS settings of a listener
+type TLS struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables client certificate checks when set
+	ClientCAFile string
+	// ClientOptional accepts clients without a certificate, still checking
+	// the ones that present one
+	ClientOptional bool
+	// ClientNames, when set, limits client certificates to those with one
+	// of the names as their common name or a DNS, email or URI SAN
+	ClientNames []string
+	MinVersion  uint16
+	// GetCertificate, when set, supplies certificates in place of CertFile
+	// and KeyFile, such as those obtained over ACME
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// NextProtos are offered over ALPN ahead of the server's own, such as
+	// acme-tls/1 for ACME challenges
+	NextProtos []string
+}
+
+// Spec is a parsed listener address
+type Spec struct {
+	Network string
+	Addr    string
+	// Interface expands the listener to each address of the interface
+	Interface string
+	// TLS is nil for plain-text listeners
+	TLS *TLS
+}
+
+// String formats s for logs, without file paths
+func (s Spec) String() string {
+	var b strings.Builder
+	if s.Network != "tcp" {
+		b.WriteString(s.Network + "://")
+	}
+	b.WriteString(s.Addr)
+	if s.Interface != "" {
+		b.WriteString(";interface=" + s.Interface)
+	}
+	if s.TLS != nil {
+		b.WriteString(";tls")
+		if s.TLS.ClientCAFile != "" {
+			b.WriteString(";mtls")
+		}
+	}
+	return b.String()
+}
+
+// Loopback reports whether s only accepts connections from this host
+func (s Spec) Loopback() bool {
+	if s.Interface != "" {
+		return false
+	}
+	host, _, _ := net.SplitHostPort(s.Addr)
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Parse parses a comma-separated list of listener addresses
+func Parse(list string) ([]Spec, error) {
+	var specs []Spec
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		spec, err := parseSpec(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener %q: %w", entry, err)
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("no listener addresses")
+	}
+	return specs, nil
+}
+
+func parseSpec(entry string) (Spec, error) {
+	addr, options, _ := strings.Cut(entry, ";")
+	spec := Spec{Network: "tcp", Addr: addr}
+	if network, rest, ok := strings.Cut(addr, "://"); ok {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return Spec{}, fmt.Errorf("unsupported network %q", network)
+		}
+		spec.Network, spec.Addr = network, rest
+	}
+	if _, _, err := net.SplitHostPort(spec.Addr); err != nil {
+		return Spec{}, err
+	}
+
+	var tlsOpts TLS
+	var clientAuth string
+	for _, option := range strings.Split(options, ";") {
+		if option = strings.TrimSpace(option); option == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(option, "=")
+		if !ok || value == "" {
+			return Spec{}, fmt.Errorf("option %q has no value", name)
+		}
+		switch name {
+		case "interface":
+			spec.Interface = value
+		case "cert":
+			tlsOpts.CertFile = value
+		case "key":
+			tlsOpts.KeyFile = value
+		case "client_ca":
+			tlsOpts.ClientCAFile = value
+		case "client_auth":
+			clientAuth = value
+		case "client_names":
+			tlsOpts.ClientNames = strings.Split(value, "|")
+		case "min_tls":
+			switch value {
+			case "1.2":
+				tlsOpts.MinVersion = tls.VersionTLS12
+			case "1.3":
+				tlsOpts.MinVersion = tls.VersionTLS13
+			default:
+				return Spec{}, fmt.Errorf("unsupported min_tls %q: must be 1.2 or 1.3", value)
+			}
+		default:
+			return Spec{}, fmt.Errorf("unknown option %q", name)
+		}
+	}
+
+	switch clientAuth {
+	case "", "require":
+	case "optional":
+		tlsOpts.ClientOptional = true
+	default:
+		return Spec{}, fmt.Errorf("unsupported client_auth %q: must be require or optional", clientAuth)
+	}
+	if clientAuth != "" && tlsOpts.ClientCAFile == "" {
+		return Spec{}, errors.New("client_auth needs client_ca")
+	}
+	if tlsOpts.ClientNames != nil && tlsOpts.ClientCAFile == "" {
+		return Spec{}, errors.New("client_names needs client_ca")
+	}
+	if tlsOpts.CertFile != "" || tlsOpts.KeyFile != "" || tlsOpts.ClientCAFile != "" || tlsOpts.MinVersion != 0 {
+		if tlsOpts.CertFile == "" || tlsOpts.KeyFile == "" {
+			return Spec{}, errors.New("TLS needs both cert and key")
+		}
+		if tlsOpts.MinVersion == 0 {
+			tlsOpts.MinVersion = tls.VersionTLS12
+		}
+		spec.TLS = &tlsOpts
+	}
+	return spec, nil
+}
+
+// Listen opens a listener for each address of specs. TLS listeners offer
+// nextProtos for ALPN, such as "h2" for HTTP/2 and gRPC. If any listener
+// fails, the ones already opened are closed.
+func Listen(specs []Spec, nextProtos ...string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	fail := func(err error) ([]net.Listener, error) {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil, err
+	}
+
+	for _, spec := range specs {
+		var tlsConfig *tls.Config
+		if spec.TLS != nil {
+			var err error
+			if tlsConfig, err = spec.TLS.config(nextProtos); err != nil {
+				return fail(fmt.Errorf("listener %s: %w", spec, err))
+			}
+		}
+		addrs, err := spec.addrs()
+		if err != nil {
+			return fail(fmt.Errorf("listener %s: %w", spec, err))
+		}
+		for _, addr := range addrs {
+			l, err := net.Listen(spec.Network, addr)
+			if err != nil {
+				return fail(err)
+			}
+			if tlsConfig != nil {
+				l = tls.NewListener(l, tlsConfig)
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners, nil
+}
+
+// addrs returns the addresses to listen on: the spec's own, or the port on
+// each address of its interface that belongs to its network
+func (s Spec) addrs() ([]string, error) {
+	if s.Interface == "" {
+		return []string{s.Addr}, nil
+	}
+	_, port, _ := net.SplitHostPort(s.Addr)
+	iface, err := net.InterfaceByName(s.Interface)
+	if err != nil {
+		return nil, err
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, a := range ifaceAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		is4 := ip.To4() != nil
+		if (s.Network == "tcp4" && !is4) || (s.Network == "tcp6" && is4) {
+			continue
+		}
+		host := ip.String()
+		// Link-local IPv6 addresses only mean something with their zone
+		if !is4 && ip.IsLinkLocalUnicast() {
+			host += "%" + iface.Name
+		}
+		addrs = append(addrs, net.JoinHostPort(host, port))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("interface %s has no %s addresses", s.Interface, s.Network)
+	}
+	return addrs, nil
+}
+
+// config loads the certificates of t into a server TLS config, unless
+// they are supplied by GetCertificate
+func (t *TLS) config(nextProtos []string) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: t.GetCertificate,
+		MinVersion:     t.MinVersion,
+		NextProtos:     append(slices.Clone(t.NextProtos), nextProtos...),
+	}
+	if t.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", t.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if t.ClientOptional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		if len(t.ClientNames) > 0 {
+			config.VerifyConnection = t.verifyClientName
+		}
+	}
+	return config, nil
+}
+
+// verifyClientName rejects verified client certificates without one of
+// t's ClientNames. Clients without a certificate are left to ClientAuth.
+func (t *TLS) verifyClientName(cs tls.ConnectionState) error {
+	if len(cs.VerifiedChains) == 0 {
+		return nil
+	}
+	leaf := cs.VerifiedChains[0][0]
+	for _, name := range CertificateNames(leaf) {
+		if slices.Contains(t.ClientNames, name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate %q is not in the allowed names", leaf.Subject.CommonName)
+}
+
+// CertificateNames returns the common name of cert followed by its DNS,
+// email and URI SANs
+func CertificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
@@ -0,0 +1,356 @@
+package listen_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/listen"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []listen.Spec
+	}{
+		{name: "port only", input: ":8080", want: []listen.Spec{{Network: "tcp", Addr: ":8080"}}},
+		{
+			name:  "dual stack",
+			input: "tcp4://0.0.0.0:8080, tcp6://[::]:8080",
+			want: []listen.Spec{
+				{Network: "tcp4", Addr: "0.0.0.0:8080"},
+				{Network: "tcp6", Addr: "[::]:8080"},
+			},
+		},
+		{name: "interface", input: "tcp4://:9000;interface=eth0", want: []listen.Spec{{Network: "tcp4", Addr: ":9000", Interface: "eth0"}}},
+		{
+			name:  "tls",
+			input: ":8443;cert=c.pem;key=k.pem;min_tls=1.3",
+			want: []listen.Spec{{Network: "tcp", Addr: ":8443", TLS: &listen.TLS{
+				CertFile: "c.pem", KeyFile: "k.pem", MinVersion: tls.VersionTLS13,
+			}}},
+		},
+		{
+			name:  "client names",
+			input: ":8443;cert=c.pem;key=k.pem;client_ca=ca.pem;client_names=deployer|spiffe://prod/ops",
+			want: []listen.Spec{{Network: "tcp", Addr: ":8443", TLS: &listen.TLS{
+				CertFile: "c.pem", KeyFile: "k.pem", ClientCAFile: "ca.pem", ClientNames: []string{"deployer", "spiffe://prod/ops"}, MinVersion: tls.VersionTLS12,
+			}}},
+		},
+		{
+			name:  "mtls",
+			input: ":8443;cert=c.pem;key=k.pem;client_ca=ca.pem;client_auth=optional",
+			want: []listen.Spec{{Network: "tcp", Addr: ":8443", TLS: &listen.TLS{
+				CertFile: "c.pem", KeyFile: "k.pem", ClientCAFile: "ca.pem", ClientOptional: true, MinVersion: tls.VersionTLS12,
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listen.Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"8080",
+		"udp://:53",
+		":8080;bogus=1",
+		":8080;interface",
+		":8443;cert=c.pem",
+		":8443;cert=c.pem;key=k.pem;min_tls=1.1",
+		":8443;cert=c.pem;key=k.pem;client_auth=require",
+		":8443;cert=c.pem;key=k.pem;client_ca=ca.pem;client_auth=maybe",
+		":8443;cert=c.pem;key=k.pem;client_names=deployer",
+	} {
+		if _, err := listen.Parse(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestSpec_String(t *testing.T) {
+	specs, err := listen.Parse("tcp6://[::1]:8443;cert=/secret/c.pem;key=/secret/k.pem;client_ca=/secret/ca.pem")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := specs[0].String(); got != "tcp6://[::1]:8443;tls;mtls" {
+		t.Errorf("Unexpected string %q", got)
+	}
+}
+
+func TestSpec_Loopback(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:6060":              true,
+		"[::1]:6060":                  true,
+		"localhost:6060":              true,
+		":6060":                       false,
+		"0.0.0.0:6060":                false,
+		"10.0.0.5:6060":               false,
+		"127.0.0.1:6060;interface=lo": false,
+	}
+	for addr, want := range tests {
+		specs, err := listen.Parse(addr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", addr, err)
+		}
+		if got := specs[0].Loopback(); got != want {
+			t.Errorf("Expected Loopback() of %q to be %v, got %v", addr, want, got)
+		}
+	}
+}
+
+func TestListen_Plain(t *testing.T) {
+	specs, _ := listen.Parse("tcp4://127.0.0.1:0")
+	listeners, err := listen.Listen(specs)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listeners[0].Close()
+
+	if len(listeners) != 1 {
+		t.Fatalf("Expected one listener, got %d", len(listeners))
+	}
+	conn, err := net.Dial("tcp", listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestListen_IPv6(t *testing.T) {
+	probe, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available")
+	}
+	probe.Close()
+
+	specs, _ := listen.Parse("tcp4://127.0.0.1:0,tcp6://[::1]:0")
+	listeners, err := listen.Listen(specs)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	for _, l := range listeners {
+		defer l.Close()
+	}
+	if len(listeners) != 2 || listeners[1].Addr().(*net.TCPAddr).IP.To4() != nil {
+		t.Errorf("Expected an IPv4 and an IPv6 listener, got %v", listeners)
+	}
+}
+
+func TestListen_ClosesOnFailure(t *testing.T) {
+	taken, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer taken.Close()
+
+	specs, _ := listen.Parse("tcp4://127.0.0.1:0,tcp4://" + taken.Addr().String())
+	if _, err := listen.Listen(specs); err == nil {
+		t.Fatal("Expected an error for an address in use")
+	}
+}
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key to
+// dir, returning their paths and a pool trusting it
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string, pool *x509.CertPool, cert tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, pool, cert
+}
+
+// serve serves an HTTP handler on the listener of spec, returning its URL
+func serve(t *testing.T, spec string) string {
+	t.Helper()
+	specs, err := listen.Parse(spec)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	listeners, err := listen.Listen(specs, "h2", "http/1.1")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	go server.Serve(listeners[0])
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listeners[0].Addr().String()
+}
+
+func get(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return resp.Proto, nil
+}
+
+func TestListen_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pool, _ := writeCert(t, dir, "server")
+	url := serve(t, "tcp4://127.0.0.1:0;cert="+certFile+";key="+keyFile)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	defer client.CloseIdleConnections()
+	proto, err := get(client, url)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if proto != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2 over ALPN, got %s", proto)
+	}
+}
+
+func TestListen_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pool, _ := writeCert(t, dir, "server")
+	caFile, _, _, clientCert := writeCert(t, dir, "client")
+
+	tests := []struct {
+		name     string
+		mode     string
+		withCert bool
+		wantErr  bool
+	}{
+		{name: "required with certificate", mode: "require", withCert: true},
+		{name: "required without certificate", mode: "require", wantErr: true},
+		{name: "optional without certificate", mode: "optional"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := serve(t, "tcp4://127.0.0.1:0;cert="+certFile+";key="+keyFile+";client_ca="+caFile+";client_auth="+tt.mode)
+			tlsConfig := &tls.Config{RootCAs: pool}
+			if tt.withCert {
+				tlsConfig.Certificates = []tls.Certificate{clientCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			defer client.CloseIdleConnections()
+
+			_, err := get(client, url)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestListen_ClientNames(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pool, _ := writeCert(t, dir, "server")
+	caFile, _, _, clientCert := writeCert(t, dir, "client")
+
+	for _, tt := range []struct {
+		names   string
+		wantErr bool
+	}{
+		{names: "deployer|client"},
+		{names: "deployer", wantErr: true},
+	} {
+		t.Run(tt.names, func(t *testing.T) {
+			url := serve(t, "tcp4://127.0.0.1:0;cert="+certFile+";key="+keyFile+";client_ca="+caFile+";client_names="+tt.names)
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      pool,
+				Certificates: []tls.Certificate{clientCert},
+			}}}
+			defer client.CloseIdleConnections()
+
+			_, err := get(client, url)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestListen_MissingCertificate(t *testing.T) {
+	specs, _ := listen.Parse("tcp4://127.0.0.1:0;cert=/nonexistent.pem;key=/nonexistent-key.pem")
+	if _, err := listen.Listen(specs); err == nil {
+		t.Error("Expected an error for a missing certificate")
+	}
+}
+
+func TestListen_GetCertificate(t *testing.T) {
+	_, _, pool, cert := writeCert(t, t.TempDir(), "server")
+	listeners, err := listen.Listen([]listen.Spec{{Network: "tcp4", Addr: "127.0.0.1:0", TLS: &listen.TLS{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil },
+		NextProtos:     []string{"acme-tls/1"},
+		MinVersion:     tls.VersionTLS12,
+	}}}, "http/1.1")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(listeners[0])
+	t.Cleanup(func() { server.Close() })
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	defer client.CloseIdleConnections()
+	if _, err := get(client, "https://"+listeners[0].Addr().String()); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxErrorSamples is how many recent error records are kept for diagnostics
+const maxErrorSamples = 50
+
+// ErrorSample is a recently logged error record
+type ErrorSample struct {
+	Time      time.Time         `json:"time"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"request_id,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// errorRing keeps the most recent error samples
+type errorRing struct {
+	mu      sync.Mutex
+	samples []ErrorSample
+	next    int
+}
+
+var recentErrors errorRing
+
+// RecentErrors returns the most recently logged errors, newest first
+func RecentErrors() []ErrorSample {
+	recentErrors.mu.Lock()
+	defer recentErrors.mu.Unlock()
+
+	n := len(recentErrors.samples)
+	out := make([]ErrorSample, 0, n)
+	for i := range n {
+		out = append(out, recentErrors.samples[(recentErrors.next-1-i+n)%n])
+	}
+	return out
+}
+
+// recordError keeps r if it is an error-level record
+func recordError(ctx context.Context, r slog.Record) {
+	if r.Level < slog.LevelError {
+		return
+	}
+
+	sample := ErrorSample{
+		Time:      r.Time,
+		Message:   r.Message,
+		RequestID: RequestID(ctx),
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if sample.Attrs == nil {
+			sample.Attrs = make(map[string]string, r.NumAttrs())
+		}
+		sample.Attrs[a.Key] = a.Value.Resolve().String()
+		return true
+	})
+
+	recentErrors.mu.Lock()
+	defer recentErrors.mu.Unlock()
+	if len(recentErrors.samples) < maxErrorSamples {
+		recentErrors.samples = append(recentErrors.samples, sample)
+	} else {
+		recentErrors.samples[recentErrors.next] = sample
+	}
+	recentErrors.next = (recentErrors.next + 1) % maxErrorSamples
+}
@@ -3,31 +3,50 @@ package logger
 import (
 	"log/slog"
 	"os"
+	"strings"
 )
 
 var Log *slog.Logger
 
-func Init(level string) {
-	var logLevel slog.Level
+// level is shared by the handler so SetLevel applies to every logger
+var level slog.LevelVar
 
-	switch level {
+func Init(logLevel string) {
+	SetLevel(logLevel)
+
+	opts := &slog.HandlerOptions{
+		Level: &level,
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, opts)
+	Log = slog.New(contextHandler{handler})
+	slog.SetDefault(Log)
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (slog.Level, bool) {
+	switch name {
 	case "debug":
-		logLevel = slog.LevelDebug
+		return slog.LevelDebug, true
 	case "info":
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo, true
 	case "warn":
-		logLevel = slog.LevelWarn
+		return slog.LevelWarn, true
 	case "error":
-		logLevel = slog.LevelError
+		return slog.LevelError, true
 	default:
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo, false
 	}
+}
 
-	opts := &slog.HandlerOptions{
-		Level: logLevel,
-	}
+// SetLevel changes the minimum level logged, taking effect at once.
+// Unknown levels log at info.
+func SetLevel(logLevel string) {
+	l, _ := ParseLevel(logLevel)
+	level.Set(l)
+}
 
-	handler := slog.NewJSONHandler(os.Stdout, opts)
-	Log = slog.New(handler)
-	slog.SetDefault(Log)
+// Level returns the name of the minimum level logged
+func Level() string {
+	return strings.ToLower(level.Level().String())
 }
@@ -1,68 +1,666 @@
+// Package metrics defines the service's Prometheus collectors
 package metrics
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var (
+// Metrics holds the service's collectors. Components take a *Metrics
+// instead of using package globals, so the service can be embedded in other
+// binaries and several instances can coexist, each with its own registry.
+type Metrics struct {
 	// HTTP metrics
-	HTTPRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "path", "status"},
-	)
-
-	HTTPRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "path"},
-	)
+	HTTPRequestsTotal        *prometheus.CounterVec
+	HTTPRequestDuration      *prometheus.HistogramVec
+	ResponseTruncationsTotal *prometheus.CounterVec
+	RequestAbortsTotal       *prometheus.CounterVec
+	ResponseBytesTotal       *prometheus.CounterVec
+	// HTTPInflightRequests is the number of requests being served by route
+	HTTPInflightRequests *prometheus.GaugeVec
+
+	// Response streaming metrics
+	ResponseChunkSize prometheus.Histogram
+	ClientThroughput  prometheus.Histogram
 
 	// Cache metrics
-	CacheHitsTotal = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "cache_hits_total",
-			Help: "Total number of cache hits",
-		},
-	)
-
-	CacheMissesTotal = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "cache_misses_total",
-			Help: "Total number of cache misses",
-		},
-	)
-
-	CacheOperationDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "cache_operation_duration_seconds",
-			Help:    "Cache operation duration in seconds",
-			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
-		},
-		[]string{"operation"},
-	)
+	CacheHitsTotal             prometheus.Counter
+	CacheMissesTotal           prometheus.Counter
+	CacheOperationDuration     *prometheus.HistogramVec
+	CachePurgedKeysTotal       prometheus.Counter
+	CacheEntriesMigratedTotal  prometheus.Counter
+	CacheNamespaceFlushesTotal prometheus.Counter
+	CacheStoredBytesTotal      prometheus.Counter
+	CacheErrorsTotal           *prometheus.CounterVec
+	// CacheCircuitOpen is 1 while Redis is bypassed after repeated failures
+	CacheCircuitOpen             prometheus.Gauge
+	CacheCircuitTransitionsTotal *prometheus.CounterVec
+	// CacheFillLocksTotal counts cache misses by how the fill lock went
+	CacheFillLocksTotal *prometheus.CounterVec
+	// HotKeys is the number of keys requested over the hot key threshold
+	HotKeys prometheus.Gauge
+	// CacheEntryTTL is the TTL of entries stored with a TTL of their own
+	CacheEntryTTL *prometheus.HistogramVec
+	// CacheCompressionBytesTotal counts the payloads compressed before they
+	// were stored in Redis, by size before and after
+	CacheCompressionBytesTotal *prometheus.CounterVec
+	// CacheAsyncWrites is the number of background cache writes running
+	CacheAsyncWrites prometheus.Gauge
 
 	// R2 metrics
-	R2RequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "r2_requests_total",
-			Help: "Total number of R2 requests",
-		},
-		[]string{"operation", "status"},
-	)
-
-	R2RequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "r2_request_duration_seconds",
-			Help:    "R2 request duration in seconds",
-			Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10},
-		},
-		[]string{"operation"},
-	)
-)
+	R2RequestsTotal   *prometheus.CounterVec
+	R2RequestDuration *prometheus.HistogramVec
+	R2AttemptDuration *prometheus.HistogramVec
+	R2RetriesTotal    *prometheus.CounterVec
+	R2ConnectDuration *prometheus.HistogramVec
+
+	// Retry budget metrics
+	RetryBudgetExhaustedTotal *prometheus.CounterVec
+
+	// Scheduler metrics
+	JobRunsTotal    *prometheus.CounterVec
+	JobDuration     *prometheus.HistogramVec
+	WarmedKeysTotal *prometheus.CounterVec
+
+	// Signed URL metrics
+	SignedURLVerificationsTotal *prometheus.CounterVec
+
+	// Shadow mirroring metrics
+	MirrorRequestsTotal         *prometheus.CounterVec
+	MirrorStatusMismatchesTotal *prometheus.CounterVec
+	MirrorDuration              prometheus.Histogram
+
+	// Legacy origin metrics
+	LegacyRequestsTotal *prometheus.CounterVec
+
+	// Prefetch metrics
+	PrefetchRequestsTotal *prometheus.CounterVec
+
+	// gRPC metrics
+	GRPCRequestsTotal   *prometheus.CounterVec
+	GRPCRequestDuration *prometheus.HistogramVec
+
+	// Upload pipeline metrics
+	PipelineUploadsTotal *prometheus.CounterVec
+	PipelineStepsTotal   *prometheus.CounterVec
+	PipelineStepDuration *prometheus.HistogramVec
+
+	// Tenant metrics
+	TenantRequestsTotal     *prometheus.CounterVec
+	TenantCacheLookupsTotal *prometheus.CounterVec
+
+	// Storage quota metrics
+	StorageQuotaUsedBytes       *prometheus.GaugeVec
+	StorageQuotaLimitBytes      *prometheus.GaugeVec
+	StorageQuotaRejectionsTotal *prometheus.CounterVec
+
+	// Content-addressable storage metrics
+	ContentStoreWritesTotal         *prometheus.CounterVec
+	ContentStoreBlobsCollectedTotal prometheus.Counter
+
+	// Cache integrity metrics
+	CacheIntegrityChecksTotal   prometheus.Counter
+	CacheIntegrityFailuresTotal *prometheus.CounterVec
+
+	// Image transform metrics
+	ImageTransformsTotal *prometheus.CounterVec
+
+	// Archive member metrics
+	ArchiveMembersTotal *prometheus.CounterVec
+
+	// Encryption metrics
+	DecryptionFailuresTotal *prometheus.CounterVec
+
+	// Event notification metrics
+	EventsTotal *prometheus.CounterVec
+
+	// Existence filter metrics
+	ExistenceFilterKeys       prometheus.Gauge
+	ExistenceFilterSkipsTotal *prometheus.CounterVec
+	MetadataCacheLookupsTotal *prometheus.CounterVec
+
+	// Client disconnect metrics
+	ClientDisconnectsTotal *prometheus.CounterVec
+
+	// Concurrency limit metrics
+	FileRequestsInFlight      prometheus.Gauge
+	FileRequestsQueued        prometheus.Gauge
+	FileRequestsRejectedTotal *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them with reg. With a nil reg
+// the collectors are created without being registered.
+func New(reg prometheus.Registerer) *Metrics {
+	f := promauto.With(reg)
+	return &Metrics{
+		// HTTP metrics
+		HTTPRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_requests_total",
+				Help: "Total number of HTTP requests",
+			},
+			[]string{"method", "path", "status"},
+		),
+
+		HTTPRequestDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_request_duration_seconds",
+				Help:    "HTTP request duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"method", "path"},
+		),
+
+		ResponseTruncationsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_response_truncations_total",
+				Help: "Total number of JSON list responses cut short by the response size limit, by endpoint",
+			},
+			[]string{"endpoint"},
+		),
+
+		RequestAbortsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_request_aborts_total",
+				Help: "Total number of requests that ended early, by operation and reason (client_canceled, server_timeout, upstream_timeout)",
+			},
+			[]string{"operation", "reason"},
+		),
+
+		ResponseBytesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "response_bytes_total",
+				Help: "Total file bytes sent to clients, by where the file came from (cache, storage)",
+			},
+			[]string{"source"},
+		),
+
+		HTTPInflightRequests: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_inflight_requests",
+				Help: "Number of HTTP requests being served by path",
+			},
+			[]string{"path"},
+		),
+
+		// Response streaming metrics
+		ResponseChunkSize: f.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "http_response_chunk_size_bytes",
+				Help:    "Size of individual response body writes in bytes",
+				Buckets: prometheus.ExponentialBuckets(4096, 2, 9),
+			},
+		),
+
+		ClientThroughput: f.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "http_client_throughput_bytes_per_second",
+				Help:    "Observed client download throughput in bytes per second",
+				Buckets: prometheus.ExponentialBuckets(16*1024, 4, 8),
+			},
+		),
+
+		// Cache metrics
+		CacheHitsTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_hits_total",
+				Help: "Total number of cache hits",
+			},
+		),
+
+		CacheMissesTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_misses_total",
+				Help: "Total number of cache misses",
+			},
+		),
+
+		CacheOperationDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "cache_operation_duration_seconds",
+				Help:    "Cache operation duration in seconds",
+				Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
+			},
+			[]string{"operation"},
+		),
+
+		CachePurgedKeysTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_purged_keys_total",
+				Help: "Total number of cache keys removed by admin purges",
+			},
+		),
+
+		CacheEntriesMigratedTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_entries_migrated_total",
+				Help: "Total number of legacy cache entries rewritten in envelope format",
+			},
+		),
+		CacheNamespaceFlushesTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_namespace_flushes_total",
+				Help: "Total number of cache namespaces flushed by bumping their generation",
+			},
+		),
+
+		CacheStoredBytesTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_stored_bytes_total",
+				Help: "Total bytes of file content written to the cache",
+			},
+		),
+
+		CacheErrorsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_errors_total",
+				Help: "Total number of failed cache operations, by operation (get, set, delete)",
+			},
+			[]string{"operation"},
+		),
+
+		CacheCircuitOpen: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "cache_circuit_open",
+				Help: "Whether Redis is being bypassed after repeated failures (1) or not (0)",
+			},
+		),
+
+		CacheCircuitTransitionsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_circuit_transitions_total",
+				Help: "Total number of times the Redis circuit breaker opened or closed, by state",
+			},
+			[]string{"state"},
+		),
+
+		CacheFillLocksTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_fill_locks_total",
+				Help: "Total number of cache misses by fill lock result (acquired, waited, stale, timeout, error)",
+			},
+			[]string{"result"},
+		),
+
+		HotKeys: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "hot_keys",
+				Help: "Number of keys requested at or above the hot key threshold over the window",
+			},
+		),
+
+		CacheEntryTTL: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "cache_entry_ttl_seconds",
+				Help:    "TTL of files stored in the cache by source (object metadata or TTL policy)",
+				Buckets: []float64{30, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600},
+			},
+			[]string{"source"},
+		),
+
+		CacheCompressionBytesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_compression_bytes_total",
+				Help: "Bytes of payloads compressed before they were stored in Redis, by stage (original or compressed)",
+			},
+			[]string{"stage"},
+		),
+
+		CacheAsyncWrites: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "cache_async_writes_inflight",
+				Help: "Number of cache writes running in the background after their response was sent",
+			},
+		),
+
+		// R2 metrics
+		R2RequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "r2_requests_total",
+				Help: "Total number of R2 requests",
+			},
+			[]string{"operation", "status"},
+		),
+
+		R2RequestDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "r2_request_duration_seconds",
+				Help:    "R2 request duration in seconds",
+				Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			[]string{"operation"},
+		),
+
+		R2AttemptDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "r2_attempt_duration_seconds",
+				Help:    "Duration of individual R2 HTTP attempts, including retries",
+				Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			[]string{"operation", "status"},
+		),
+
+		R2RetriesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "r2_retries_total",
+				Help: "Total number of R2 request retries",
+			},
+			[]string{"operation"},
+		),
+
+		R2ConnectDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "r2_connect_duration_seconds",
+				Help:    "Duration of new R2 connection phases (TCP connect, TLS handshake)",
+				Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1},
+			},
+			[]string{"phase"},
+		),
+
+		// Retry budget metrics
+		RetryBudgetExhaustedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "retry_budget_exhausted_total",
+				Help: "Total number of retries skipped because the request retry budget was exhausted",
+			},
+			[]string{"kind"},
+		),
+
+		// Scheduler metrics
+		JobRunsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "scheduler_job_runs_total",
+				Help: "Total number of scheduled job runs by result",
+			},
+			[]string{"job", "result"},
+		),
+
+		JobDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "scheduler_job_duration_seconds",
+				Help:    "Scheduled job run duration in seconds",
+				Buckets: []float64{.1, .5, 1, 5, 15, 60, 300, 900, 3600},
+			},
+			[]string{"job"},
+		),
+
+		WarmedKeysTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_warmed_keys_total",
+				Help: "Total number of keys processed by cache warmers by result",
+			},
+			[]string{"warmer", "result"},
+		),
+
+		// Signed URL metrics
+		SignedURLVerificationsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "signed_url_verifications_total",
+				Help: "Total number of signed URL verifications by result",
+			},
+			[]string{"result"},
+		),
+
+		// Shadow mirroring metrics
+		MirrorRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mirror_requests_total",
+				Help: "Total number of sampled requests mirrored to the shadow deployment by result (ok, error, dropped_rate, dropped_inflight)",
+			},
+			[]string{"result"},
+		),
+
+		MirrorStatusMismatchesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mirror_status_mismatches_total",
+				Help: "Total number of mirrored requests whose shadow status differed from the primary status",
+			},
+			[]string{"primary", "shadow"},
+		),
+
+		MirrorDuration: f.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mirror_request_duration_seconds",
+				Help:    "Shadow deployment response duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+
+		// Legacy origin metrics
+		LegacyRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "legacy_requests_total",
+				Help: "Total number of files missing from storage looked up on the legacy origin by result (found, not_found, error)",
+			},
+			[]string{"result"},
+		),
+
+		// Prefetch metrics
+		PrefetchRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "prefetch_requests_total",
+				Help: "Total number of files following sequential reads prefetched into the cache by result (ok, error, dropped_rate, dropped_inflight)",
+			},
+			[]string{"result"},
+		),
+
+		GRPCRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_requests_total",
+				Help: "Total number of gRPC calls by method and status code",
+			},
+			[]string{"method", "code"},
+		),
+
+		GRPCRequestDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_request_duration_seconds",
+				Help:    "gRPC call duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"method"},
+		),
+
+		// Upload pipeline metrics
+		PipelineUploadsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "upload_pipeline_uploads_total",
+				Help: "Total number of uploads handed to the post-upload pipeline by result (queued, dropped, completed, failed)",
+			},
+			[]string{"result"},
+		),
+
+		PipelineStepsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "upload_pipeline_steps_total",
+				Help: "Total number of post-upload pipeline step attempts by step and result (ok, skipped, retry, error)",
+			},
+			[]string{"step", "result"},
+		),
+
+		PipelineStepDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "upload_pipeline_step_duration_seconds",
+				Help:    "Post-upload pipeline step attempt duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"step"},
+		),
+
+		// Tenant metrics
+		TenantRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "tenant_requests_total",
+				Help: "Total number of HTTP requests resolved to a tenant by tenant and status",
+			},
+			[]string{"tenant", "status"},
+		),
+
+		TenantCacheLookupsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "tenant_cache_lookups_total",
+				Help: "Total number of cache lookups made for a tenant by tenant and result (hit, miss)",
+			},
+			[]string{"tenant", "result"},
+		),
+
+		// Storage quota metrics
+		StorageQuotaUsedBytes: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "storage_quota_used_bytes",
+				Help: "Bytes stored against each storage quota by tenant and key prefix",
+			},
+			[]string{"tenant", "prefix"},
+		),
+
+		StorageQuotaLimitBytes: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "storage_quota_limit_bytes",
+				Help: "Limit of each storage quota in bytes by tenant and key prefix",
+			},
+			[]string{"tenant", "prefix"},
+		),
+
+		StorageQuotaRejectionsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_quota_rejections_total",
+				Help: "Total number of writes rejected for exceeding a storage quota by tenant and key prefix",
+			},
+			[]string{"tenant", "prefix"},
+		),
+
+		// Content-addressable storage metrics
+		ContentStoreWritesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cas_writes_total",
+				Help: "Total number of objects written by content hash by result (stored, deduplicated)",
+			},
+			[]string{"result"},
+		),
+
+		ContentStoreBlobsCollectedTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cas_blobs_collected_total",
+				Help: "Total number of unreferenced content-addressed blobs deleted",
+			},
+		),
+
+		// Cache integrity metrics
+		CacheIntegrityChecksTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_integrity_checks_total",
+				Help: "Total number of cached files checked against storage",
+			},
+		),
+
+		CacheIntegrityFailuresTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_integrity_failures_total",
+				Help: "Total number of cached files evicted for failing their integrity check by reason (size, digest, etag, missing)",
+			},
+			[]string{"reason"},
+		),
+
+		// Image transform metrics
+		ImageTransformsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "image_transforms_total",
+				Help: "Total number of transformed images served by result (hit, transformed, failed)",
+			},
+			[]string{"result"},
+		),
+
+		// Archive member metrics
+		ArchiveMembersTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "archive_members_total",
+				Help: "Total number of files served from inside archives by result (hit, extracted, failed)",
+			},
+			[]string{"result"},
+		),
+
+		// Encryption metrics
+		DecryptionFailuresTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "decryption_failures_total",
+				Help: "Total number of encrypted payloads that failed to decrypt by where they were read from (storage, cache)",
+			},
+			[]string{"target"},
+		),
+
+		// Event notification metrics
+		EventsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "events_total",
+				Help: "Total number of file event notifications by sink and result (queued, dropped, delivered, retry, failed)",
+			},
+			[]string{"sink", "result"},
+		),
+
+		// Existence filter metrics
+		ExistenceFilterKeys: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "existence_filter_keys",
+				Help: "Number of keys listed into the existence filter at its last refresh",
+			},
+		),
+
+		ExistenceFilterSkipsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "existence_filter_skips_total",
+				Help: "Total number of storage reads answered as not found by the existence filter by operation",
+			},
+			[]string{"operation"},
+		),
+
+		MetadataCacheLookupsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "metadata_cache_lookups_total",
+				Help: "Total number of object metadata and existence lookups by result (hit, miss)",
+			},
+			[]string{"result"},
+		),
+
+		// Client disconnect metrics
+		ClientDisconnectsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "client_disconnects_total",
+				Help: "Total number of storage fetches whose client disconnected before they finished by outcome (canceled, completed)",
+			},
+			[]string{"outcome"},
+		),
+
+		// Concurrency limit metrics
+		FileRequestsInFlight: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "file_requests_in_flight",
+				Help: "Number of file requests holding a concurrency slot",
+			},
+		),
+
+		FileRequestsQueued: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "file_requests_queued",
+				Help: "Number of file requests waiting for a concurrency slot",
+			},
+		),
+
+		FileRequestsRejectedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "file_requests_rejected_total",
+				Help: "Total number of file requests turned away by the concurrency limit by reason (queue_full, queue_timeout)",
+			},
+			[]string{"reason"},
+		),
+	}
+}
+
+var noop = sync.OnceValue(func() *Metrics { return New(nil) })
+
+// Noop returns collectors that are never registered. Components fall back
+// to it when no Metrics is provided.
+func Noop() *Metrics {
+	return noop()
+}
@@ -0,0 +1,44 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+func TestNew_InstancesCoexist(t *testing.T) {
+	regA, regB := prometheus.NewRegistry(), prometheus.NewRegistry()
+	a, b := metrics.New(regA), metrics.New(regB)
+
+	a.CacheHitsTotal.Inc()
+	a.CacheHitsTotal.Inc()
+	b.CacheHitsTotal.Inc()
+
+	if got := testutil.ToFloat64(a.CacheHitsTotal); got != 2 {
+		t.Errorf("Expected 2 hits on the first instance, got %v", got)
+	}
+	if got := testutil.ToFloat64(b.CacheHitsTotal); got != 1 {
+		t.Errorf("Expected 1 hit on the second instance, got %v", got)
+	}
+
+	n, err := testutil.GatherAndCount(regA, "cache_hits_total")
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected cache_hits_total to be registered once, got %d", n)
+	}
+}
+
+func TestNoop_IsUnregistered(t *testing.T) {
+	metrics.Noop().CacheHitsTotal.Inc()
+
+	// Registering the same names again must not conflict with Noop
+	metrics.New(prometheus.NewRegistry())
+	if metrics.Noop() != metrics.Noop() {
+		t.Error("Expected Noop to return a shared instance")
+	}
+}
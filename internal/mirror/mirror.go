@@ -0,0 +1,275 @@
+// Package mirror copies a sample of read traffic to a shadow deployment so
+// new cache policies or backends can be validated under real load. Mirrored
+// requests are fire-and-forget: they never delay or change the primary
+// response, and are dropped rather than queued when over budget.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/logger"
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// HeaderShadow marks mirrored requests so the shadow deployment can tell
+// them apart, and so they are never mirrored again
+const HeaderShadow = "X-Shadow-Request"
+
+// Config controls which requests are mirrored and how much load the
+// mirror may generate
+type Config struct {
+	// Target is the base URL of the shadow deployment
+	Target string
+	// SampleRate is the fraction of read requests to mirror, from 0 to 1
+	SampleRate float64
+	// MaxInFlight caps concurrent mirrored requests; 0 means no limit
+	MaxInFlight int
+	// MaxPerSecond caps the mirrored request rate; 0 means no limit
+	MaxPerSecond float64
+	// Timeout bounds each mirrored request, including reading its body
+	Timeout time.Duration
+	// Metrics records mirrored requests; nil records nowhere
+	Metrics *metrics.Metrics
+}
+
+// Mirror sends sampled requests to a shadow deployment
+type Mirror struct {
+	target     *url.URL
+	sampleRate float64
+	timeout    time.Duration
+	client     *http.Client
+	slots      chan struct{}
+	inFlight   atomic.Int64
+	wg         sync.WaitGroup
+	metrics    *metrics.Metrics
+
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// New creates a Mirror for cfg
+func New(cfg Config) (*Mirror, error) {
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror target: %w", err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid mirror target %q: must be an absolute http(s) URL", cfg.Target)
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid mirror sample rate %v: must be between 0 and 1", cfg.SampleRate)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Noop()
+	}
+
+	m := &Mirror{
+		target:     target,
+		sampleRate: cfg.SampleRate,
+		timeout:    cfg.Timeout,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		rate:       cfg.MaxPerSecond,
+		tokens:     max(cfg.MaxPerSecond, 1),
+		now:        time.Now,
+		metrics:    cfg.Metrics,
+	}
+	if cfg.MaxInFlight > 0 {
+		m.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	m.last = m.now()
+	return m, nil
+}
+
+// Middleware mirrors a sample of the GET and HEAD requests served by next
+func (m *Mirror) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !m.sampled(r) {
+			next(w, r)
+			return
+		}
+
+		primary := make(chan int, 1)
+		if !m.dispatch(r, primary) {
+			next(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		primary <- recorder.status
+	}
+}
+
+// InFlight returns the number of mirrored requests still running
+func (m *Mirror) InFlight() int {
+	return int(m.inFlight.Load())
+}
+
+// Wait blocks until all mirrored requests have finished
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+// SetMaxPerSecond changes the cap on the mirrored request rate; 0 means no
+// limit
+func (m *Mirror) SetMaxPerSecond(rate float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rate = rate
+	m.tokens = min(m.tokens, max(rate, 1))
+}
+
+func (m *Mirror) sampled(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get(HeaderShadow) != "" {
+		return false
+	}
+	return m.sampleRate >= 1 || rand.Float64() < m.sampleRate
+}
+
+// dispatch starts the mirrored request if the budget allows it. The primary
+// status is read from primary once the primary response is written.
+func (m *Mirror) dispatch(r *http.Request, primary <-chan int) bool {
+	if !m.allow() {
+		m.metrics.MirrorRequestsTotal.WithLabelValues("dropped_rate").Inc()
+		return false
+	}
+	if m.slots != nil {
+		select {
+		case m.slots <- struct{}{}:
+		default:
+			m.metrics.MirrorRequestsTotal.WithLabelValues("dropped_inflight").Inc()
+			return false
+		}
+	}
+
+	// The shadow request must outlive the primary one but keep its request ID
+	ctx := logger.WithRequestID(context.Background(), logger.RequestID(r.Context()))
+	req, err := m.newRequest(ctx, r)
+	if err != nil {
+		m.release()
+		slog.WarnContext(ctx, "Failed to build mirrored request", "path", r.URL.Path, "error", err)
+		m.metrics.MirrorRequestsTotal.WithLabelValues("error").Inc()
+		return false
+	}
+
+	m.wg.Add(1)
+	m.inFlight.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.inFlight.Add(-1)
+		defer m.release()
+		m.send(ctx, req, primary)
+	}()
+	return true
+}
+
+func (m *Mirror) send(ctx context.Context, req *http.Request, primary <-chan int) {
+	start := time.Now()
+	resp, err := m.client.Do(req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	m.metrics.MirrorDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		slog.DebugContext(ctx, "Mirrored request failed", "path", req.URL.Path, "error", err)
+		m.metrics.MirrorRequestsTotal.WithLabelValues("error").Inc()
+		return
+	}
+	m.metrics.MirrorRequestsTotal.WithLabelValues("ok").Inc()
+
+	select {
+	case status := <-primary:
+		if status != resp.StatusCode {
+			m.metrics.MirrorStatusMismatchesTotal.WithLabelValues(strconv.Itoa(status), strconv.Itoa(resp.StatusCode)).Inc()
+			slog.InfoContext(ctx, "Mirrored response status differs",
+				"path", req.URL.Path,
+				"primary", status,
+				"shadow", resp.StatusCode,
+			)
+		}
+	case <-time.After(m.timeout):
+	}
+}
+
+// newRequest copies r for the shadow deployment. Credentials are not
+// forwarded.
+func (m *Mirror) newRequest(ctx context.Context, r *http.Request) (*http.Request, error) {
+	target := *m.target
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	req.Header.Set(HeaderShadow, "1")
+	if id := logger.RequestID(r.Context()); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	return req, nil
+}
+
+// allow takes a token from the rate budget
+func (m *Mirror) allow() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rate <= 0 {
+		return true
+	}
+
+	now := m.now()
+	m.tokens = min(m.tokens+now.Sub(m.last).Seconds()*m.rate, max(m.rate, 1))
+	m.last = now
+	if m.tokens < 1 {
+		return false
+	}
+	m.tokens--
+	return true
+}
+
+func (m *Mirror) release() {
+	if m.slots != nil {
+		<-m.slots
+	}
+}
+
+// statusRecorder captures the primary response status
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *statusRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,163 @@
+package mirror_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/mirror"
+)
+
+// shadowServer records the requests it receives
+type shadowServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	release  chan struct{}
+}
+
+func newShadowServer(t *testing.T, status int) *shadowServer {
+	t.Helper()
+
+	s := &shadowServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		release := s.release
+		s.mu.Unlock()
+		if release != nil {
+			<-release
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *shadowServer) received() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestMirror_CopiesSampledReads(t *testing.T) {
+	shadow := newShadowServer(t, http.StatusOK)
+	m, err := mirror.New(mirror.Config{Target: shadow.URL + "/shadow/", SampleRate: 1})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := m.Middleware(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/a.txt?sig=abc", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Range", "bytes=0-9")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected primary status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	// Writes are never mirrored
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/files/a.txt", nil))
+	// Nor are requests that are already mirrored
+	loop := httptest.NewRequest(http.MethodGet, "/files/b.txt", nil)
+	loop.Header.Set(mirror.HeaderShadow, "1")
+	handler(httptest.NewRecorder(), loop)
+
+	m.Wait()
+	got := shadow.received()
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 mirrored request, got %d", len(got))
+	}
+	if got[0].URL.Path != "/shadow/files/a.txt" || got[0].URL.RawQuery != "sig=abc" {
+		t.Errorf("Unexpected mirrored URL %s", got[0].URL)
+	}
+	if got[0].Header.Get(mirror.HeaderShadow) != "1" {
+		t.Error("Expected mirrored request to be marked")
+	}
+	if got[0].Header.Get("Authorization") != "" {
+		t.Error("Expected credentials to be stripped")
+	}
+	if got[0].Header.Get("Range") != "bytes=0-9" {
+		t.Error("Expected other headers to be forwarded")
+	}
+}
+
+func TestMirror_ZeroSampleRate(t *testing.T) {
+	shadow := newShadowServer(t, http.StatusOK)
+	m, err := mirror.New(mirror.Config{Target: shadow.URL, SampleRate: 0})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for range 10 {
+		m.Middleware(okHandler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/files/a.txt", nil))
+	}
+	m.Wait()
+	if n := len(shadow.received()); n != 0 {
+		t.Errorf("Expected no mirrored requests, got %d", n)
+	}
+}
+
+func TestMirror_Budget(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  mirror.Config
+	}{
+		{"in-flight limit", mirror.Config{SampleRate: 1, MaxInFlight: 1}},
+		{"rate limit", mirror.Config{SampleRate: 1, MaxPerSecond: 0.001}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shadow := newShadowServer(t, http.StatusOK)
+			shadow.release = make(chan struct{})
+			tt.cfg.Target = shadow.URL
+			m, err := mirror.New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			// Over budget requests are dropped, never delayed
+			start := time.Now()
+			for range 5 {
+				m.Middleware(okHandler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/files/a.txt", nil))
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Primary requests were delayed by %v", elapsed)
+			}
+
+			close(shadow.release)
+			m.Wait()
+			if n := len(shadow.received()); n != 1 {
+				t.Errorf("Expected 1 mirrored request, got %d", n)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  mirror.Config
+	}{
+		{"relative target", mirror.Config{Target: "/shadow"}},
+		{"unsupported scheme", mirror.Config{Target: "ftp://shadow"}},
+		{"sample rate above 1", mirror.Config{Target: "http://shadow", SampleRate: 1.5}},
+		{"negative sample rate", mirror.Config{Target: "http://shadow", SampleRate: -0.1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mirror.New(tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
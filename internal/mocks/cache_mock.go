@@ -3,38 +3,56 @@ package mocks
 import (
 	"context"
 	"errors"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
 )
 
 // MockCache is a mock implementation of cache.Cache for testing
 type MockCache struct {
-	mu   sync.RWMutex
-	data map[string][]byte
+	mu       sync.RWMutex
+	data     map[string][]byte
+	storedAt map[string]time.Time
+	meta     map[string]cache.EntryMeta
+	variants map[string][]string
+	// tombstones maps deleted keys to when their tombstone expires
+	tombstones map[string]time.Time
 
 	// Control behavior
-	GetError   error
-	SetError   error
-	PingError  error
-	CloseError error
+	GetError    error
+	SetError    error
+	DeleteError error
+	PingError   error
+	CloseError  error
 
 	// Track calls
-	GetCalls   []string
-	SetCalls   []SetCall
-	PingCalls  int
-	CloseCalls int
+	GetCalls          []string
+	SetCalls          []SetCall
+	DeleteCalls       []string
+	DeletePrefixCalls []string
+	PingCalls         int
+	CloseCalls        int
 }
 
 type SetCall struct {
 	Key  string
 	Data []byte
+	// Meta is set for SetEntry calls
+	Meta *cache.EntryMeta
 }
 
 // NewMockCache creates a new mock cache
 func NewMockCache() *MockCache {
 	return &MockCache{
-		data:     make(map[string][]byte),
-		GetCalls: make([]string, 0),
-		SetCalls: make([]SetCall, 0),
+		data:       make(map[string][]byte),
+		storedAt:   make(map[string]time.Time),
+		meta:       make(map[string]cache.EntryMeta),
+		variants:   make(map[string][]string),
+		tombstones: make(map[string]time.Time),
+		GetCalls:   make([]string, 0),
+		SetCalls:   make([]SetCall, 0),
 	}
 }
 
@@ -53,6 +71,18 @@ func (m *MockCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
 	return data, found, nil
 }
 
+// GetWithAge retrieves data and the time since it was stored
+func (m *MockCache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	data, found, err := m.Get(ctx, key)
+	if !found || err != nil {
+		return data, 0, found, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return data, time.Since(m.storedAt[key]), true, nil
+}
+
 // Set stores data in mock cache
 func (m *MockCache) Set(ctx context.Context, key string, data []byte) error {
 	m.mu.Lock()
@@ -63,11 +93,158 @@ func (m *MockCache) Set(ctx context.Context, key string, data []byte) error {
 	if m.SetError != nil {
 		return m.SetError
 	}
+	if m.tombstonedLocked(key) {
+		return cache.ErrTombstoned
+	}
 
 	m.data[key] = data
+	m.storedAt[key] = time.Now()
+	delete(m.meta, key)
 	return nil
 }
 
+// GetEntry retrieves data with the metadata stored by SetEntry
+func (m *MockCache) GetEntry(ctx context.Context, key string) (*cache.Entry, bool, error) {
+	data, age, found, err := m.GetWithAge(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return &cache.Entry{Data: data, Meta: m.meta[key], Age: age}, true, nil
+}
+
+// SetEntry stores data with metadata in mock cache
+func (m *MockCache) SetEntry(ctx context.Context, key string, data []byte, meta cache.EntryMeta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.SetCalls = append(m.SetCalls, SetCall{Key: key, Data: data, Meta: &meta})
+
+	if m.SetError != nil {
+		return m.SetError
+	}
+	if m.tombstonedLocked(key) {
+		return cache.ErrTombstoned
+	}
+
+	m.data[key] = data
+	m.storedAt[key] = time.Now()
+	m.meta[key] = meta
+	return nil
+}
+
+// Delete removes keys from mock cache
+func (m *MockCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.DeleteCalls = append(m.DeleteCalls, keys...)
+
+	if m.DeleteError != nil {
+		return 0, m.DeleteError
+	}
+
+	var n int64
+	for _, key := range keys {
+		delete(m.variants, key)
+		delete(m.tombstones, key)
+		if _, found := m.data[key]; found {
+			delete(m.data, key)
+			delete(m.storedAt, key)
+			delete(m.meta, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// DeletePrefix removes all keys with the given prefix from mock cache
+func (m *MockCache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.DeletePrefixCalls = append(m.DeletePrefixCalls, prefix)
+
+	if m.DeleteError != nil {
+		return 0, m.DeleteError
+	}
+
+	for key := range m.tombstones {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.tombstones, key)
+		}
+	}
+
+	var n int64
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.data, key)
+			delete(m.storedAt, key)
+			delete(m.meta, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Tombstone replaces key with a tombstone that expires after ttl
+func (m *MockCache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.SetError != nil {
+		return m.SetError
+	}
+	delete(m.data, key)
+	delete(m.storedAt, key)
+	delete(m.meta, key)
+	m.tombstones[key] = time.Now().Add(ttl)
+	return nil
+}
+
+// Tombstoned reports whether key holds a live tombstone
+func (m *MockCache) Tombstoned(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tombstonedLocked(key)
+}
+
+func (m *MockCache) tombstonedLocked(key string) bool {
+	expires, found := m.tombstones[key]
+	return found && time.Now().Before(expires)
+}
+
+// AddVariant records key as derived from base
+func (m *MockCache) AddVariant(ctx context.Context, base, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.variants[base] = append(m.variants[base], key)
+	return nil
+}
+
+// Variants returns the derived keys recorded for base
+func (m *MockCache) Variants(ctx context.Context, base string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.variants[base], nil
+}
+
+// SampleKeys returns up to n stored keys
+func (m *MockCache) SampleKeys(ctx context.Context, n int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, min(n, len(m.data)))
+	for key := range m.data {
+		if len(keys) == n {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
 // Ping checks mock cache health
 func (m *MockCache) Ping(ctx context.Context) error {
 	m.mu.Lock()
@@ -91,6 +268,24 @@ func (m *MockCache) SetData(key string, data []byte) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.data[key] = data
+	m.storedAt[key] = time.Now()
+}
+
+// SetEntryData pre-populates a cache entry with metadata for testing
+func (m *MockCache) SetEntryData(key string, data []byte, meta cache.EntryMeta) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+	m.storedAt[key] = time.Now()
+	m.meta[key] = meta
+}
+
+// SetDataWithAge pre-populates cache data as if it was stored age ago
+func (m *MockCache) SetDataWithAge(key string, data []byte, age time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+	m.storedAt[key] = time.Now().Add(-age)
 }
 
 // ClearData clears all cached data
@@ -98,6 +293,10 @@ func (m *MockCache) ClearData() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.data = make(map[string][]byte)
+	m.storedAt = make(map[string]time.Time)
+	m.meta = make(map[string]cache.EntryMeta)
+	m.variants = make(map[string][]string)
+	m.tombstones = make(map[string]time.Time)
 }
 
 // Reset resets all mock state
@@ -106,16 +305,27 @@ func (m *MockCache) Reset() {
 	defer m.mu.Unlock()
 
 	m.data = make(map[string][]byte)
+	m.storedAt = make(map[string]time.Time)
+	m.meta = make(map[string]cache.EntryMeta)
+	m.variants = make(map[string][]string)
+	m.tombstones = make(map[string]time.Time)
 	m.GetCalls = make([]string, 0)
 	m.SetCalls = make([]SetCall, 0)
+	m.DeleteCalls = make([]string, 0)
+	m.DeletePrefixCalls = make([]string, 0)
 	m.PingCalls = 0
 	m.CloseCalls = 0
 	m.GetError = nil
 	m.SetError = nil
+	m.DeleteError = nil
 	m.PingError = nil
 	m.CloseError = nil
 }
 
+var _ cache.EntryCache = (*MockCache)(nil)
+var _ cache.Tombstoner = (*MockCache)(nil)
+var _ cache.Sampler = (*MockCache)(nil)
+
 // Common errors for testing
 var (
 	ErrCacheUnavailable = errors.New("cache unavailable")
@@ -328,3 +328,31 @@ func TestMockStorage_ClearObjects(t *testing.T) {
 		t.Error("key2 should be cleared")
 	}
 }
+
+func TestMockStorage_ListObjects(t *testing.T) {
+	storage := mocks.NewMockStorage()
+	ctx := context.Background()
+
+	storage.SetObject("a/1", []byte("1"))
+	storage.SetObject("a/2", []byte("22"))
+	storage.SetObject("b/1", []byte("333"))
+
+	result, err := storage.ListObjects(ctx, "a/", "", 1)
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(result.Objects) != 1 || result.Objects[0].Key != "a/1" {
+		t.Errorf("Unexpected first page: %+v", result.Objects)
+	}
+
+	result, err = storage.ListObjects(ctx, "a/", result.NextToken, 1)
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(result.Objects) != 1 || result.Objects[0].Size != 2 {
+		t.Errorf("Unexpected second page: %+v", result.Objects)
+	}
+	if result.NextToken != "" {
+		t.Errorf("Expected no next token, got '%s'", result.NextToken)
+	}
+}
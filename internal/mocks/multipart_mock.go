@@ -0,0 +1,139 @@
+package mocks
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+type mockUpload struct {
+	key         string
+	contentType string
+	metadata    map[string]string
+	parts       map[int32][]byte
+}
+
+var _ storage.MultipartUploader = (*MockStorage)(nil)
+
+// CreateMultipartUpload starts an in-memory multipart upload
+func (m *MockStorage) CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.MultipartError != nil {
+		return "", m.MultipartError
+	}
+
+	m.uploadSeq++
+	id := fmt.Sprintf("upload-%d", m.uploadSeq)
+	m.uploads[id] = &mockUpload{key: key, contentType: contentType, metadata: metadata, parts: make(map[int32][]byte)}
+	return id, nil
+}
+
+// UploadPart stores a part; re-uploading a part number replaces it
+func (m *MockStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (*storage.UploadedPart, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.MultipartError != nil {
+		return nil, m.MultipartError
+	}
+	upload, err := m.uploadLocked(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	upload.parts[partNumber] = data
+	return &storage.UploadedPart{Number: partNumber, ETag: etag(data), Size: int64(len(data))}, nil
+}
+
+// ListParts returns the stored parts ordered by part number
+func (m *MockStorage) ListParts(ctx context.Context, key, uploadID string) ([]storage.UploadedPart, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, err := m.uploadLocked(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]storage.UploadedPart, 0, len(upload.parts))
+	for n, data := range upload.parts {
+		parts = append(parts, storage.UploadedPart{Number: n, ETag: etag(data), Size: int64(len(data))})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+// CompleteMultipartUpload concatenates the listed parts into the object
+func (m *MockStorage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.UploadedPart) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.MultipartError != nil {
+		return m.MultipartError
+	}
+	upload, err := m.uploadLocked(key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var object []byte
+	for i, p := range parts {
+		data, ok := upload.parts[p.Number]
+		if !ok || etag(data) != p.ETag || (i > 0 && p.Number <= parts[i-1].Number) {
+			return fmt.Errorf("%w: part %d", storage.ErrInvalidPart, p.Number)
+		}
+		object = append(object, data...)
+	}
+
+	m.objects[key] = object
+	m.modTimes[key] = time.Now()
+	headers := make(http.Header)
+	if upload.contentType != "" {
+		headers.Set("Content-Type", upload.contentType)
+	}
+	for name, value := range upload.metadata {
+		headers.Set("X-Amz-Meta-"+name, value)
+	}
+	m.headers[key] = headers
+	delete(m.uploads, uploadID)
+	return nil
+}
+
+// AbortMultipartUpload discards an upload and its parts
+func (m *MockStorage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.uploadLocked(key, uploadID); err != nil {
+		return err
+	}
+	delete(m.uploads, uploadID)
+	return nil
+}
+
+func (m *MockStorage) uploadLocked(key, uploadID string) (*mockUpload, error) {
+	upload, ok := m.uploads[uploadID]
+	if !ok || upload.key != key {
+		return nil, fmt.Errorf("%w: NoSuchUpload: %s", storage.ErrNotFound, uploadID)
+	}
+	return upload, nil
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -3,30 +3,58 @@ package mocks
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/storage"
 )
 
 // MockStorage is a mock implementation of storage.Storage for testing
 type MockStorage struct {
-	mu      sync.RWMutex
-	objects map[string][]byte
+	mu       sync.RWMutex
+	objects  map[string][]byte
+	modTimes map[string]time.Time
+	headers  map[string]http.Header
+
+	uploads   map[string]*mockUpload
+	uploadSeq int
 
 	// Control behavior
 	GetError         error
 	PutError         error
 	DeleteError      error
 	ExistsError      error
+	ListError        error
+	PresignError     error
+	MultipartError   error
 	HealthCheckError error
+	// GetDelay makes GetObject wait before responding, or until ctx is done
+	GetDelay time.Duration
 
 	// Track calls
 	GetCalls         []string
 	PutCalls         []PutCall
 	DeleteCalls      []string
 	ExistsCalls      []string
+	StatCalls        []string
+	RangeCalls       []RangeCall
+	ListCalls        []string
+	PresignCalls     []string
 	HealthCheckCalls int
 }
 
+// RangeCall is a GetObjectRange call
+type RangeCall struct {
+	Key            string
+	Offset, Length int64
+}
+
 type PutCall struct {
 	Key         string
 	ContentType string
@@ -37,15 +65,30 @@ type PutCall struct {
 func NewMockStorage() *MockStorage {
 	return &MockStorage{
 		objects:     make(map[string][]byte),
+		modTimes:    make(map[string]time.Time),
+		headers:     make(map[string]http.Header),
+		uploads:     make(map[string]*mockUpload),
 		GetCalls:    make([]string, 0),
 		PutCalls:    make([]PutCall, 0),
 		DeleteCalls: make([]string, 0),
 		ExistsCalls: make([]string, 0),
+		ListCalls:   make([]string, 0),
 	}
 }
 
 // GetObject retrieves an object from mock storage
 func (m *MockStorage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	delay := m.GetDelay
+	m.mu.RUnlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -63,6 +106,68 @@ func (m *MockStorage) GetObject(ctx context.Context, key string) ([]byte, error)
 	return data, nil
 }
 
+// GetObjectWithHeaders retrieves an object and the headers set with SetObjectHeaders
+func (m *MockStorage) GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error) {
+	data, err := m.GetObject(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	headers := m.headers[key].Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	return data, headers, nil
+}
+
+// StatObject returns the headers set with SetObjectHeaders for a stored object
+func (m *MockStorage) StatObject(ctx context.Context, key string) (http.Header, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.StatCalls = append(m.StatCalls, key)
+
+	if m.GetError != nil {
+		return nil, m.GetError
+	}
+	data, found := m.objects[key]
+	if !found {
+		return nil, storage.ErrNotFound
+	}
+	headers := m.headers[key].Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("Content-Length", strconv.Itoa(len(data)))
+	return headers, nil
+}
+
+// GetObjectRange returns part of an object and the headers set with
+// SetObjectHeaders, with the object's whole size as Content-Length
+func (m *MockStorage) GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.RangeCalls = append(m.RangeCalls, RangeCall{Key: key, Offset: offset, Length: length})
+
+	if m.GetError != nil {
+		return nil, nil, m.GetError
+	}
+	data, found := m.objects[key]
+	if !found {
+		return nil, nil, storage.ErrNotFound
+	}
+	headers := m.headers[key].Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("Content-Length", strconv.Itoa(len(data)))
+	start := min(offset, int64(len(data)))
+	return data[start:min(start+length, int64(len(data)))], headers, nil
+}
+
 // PutObject stores an object in mock storage
 func (m *MockStorage) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
 	m.mu.Lock()
@@ -84,6 +189,21 @@ func (m *MockStorage) PutObject(ctx context.Context, key string, data io.Reader,
 	}
 
 	m.objects[key] = content
+	m.modTimes[key] = time.Now()
+	return nil
+}
+
+// PutObjectWithMetadata stores an object whose headers hold metadata as
+// X-Amz-Meta-* headers
+func (m *MockStorage) PutObjectWithMetadata(ctx context.Context, key string, data io.Reader, contentType string, metadata map[string]string) error {
+	if err := m.PutObject(ctx, key, data, contentType); err != nil {
+		return err
+	}
+	headers := make(http.Header)
+	for name, value := range metadata {
+		headers.Set("X-Amz-Meta-"+name, value)
+	}
+	m.SetObjectHeaders(key, headers)
 	return nil
 }
 
@@ -99,6 +219,7 @@ func (m *MockStorage) DeleteObject(ctx context.Context, key string) error {
 	}
 
 	delete(m.objects, key)
+	delete(m.modTimes, key)
 	return nil
 }
 
@@ -117,6 +238,67 @@ func (m *MockStorage) ObjectExists(ctx context.Context, key string) (bool, error
 	return found, nil
 }
 
+// ListObjects lists objects in key order. The continuation token is the
+// last key of the previous page.
+func (m *MockStorage) ListObjects(ctx context.Context, prefix, continuationToken string, limit int) (*storage.ListResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ListCalls = append(m.ListCalls, prefix)
+
+	if m.ListError != nil {
+		return nil, m.ListError
+	}
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) && key > continuationToken {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := &storage.ListResult{}
+	for i, key := range keys {
+		if limit > 0 && i == limit {
+			result.NextToken = keys[i-1]
+			break
+		}
+		result.Objects = append(result.Objects, storage.ObjectInfo{
+			Key:          key,
+			Size:         int64(len(m.objects[key])),
+			LastModified: m.modTimes[key],
+		})
+	}
+	return result, nil
+}
+
+// PresignPut returns a fake upload URL for key
+func (m *MockStorage) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.PresignCalls = append(m.PresignCalls, key)
+
+	if m.PresignError != nil {
+		return nil, m.PresignError
+	}
+
+	headers := http.Header{}
+	if contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+	for name, value := range metadata {
+		headers.Set("X-Amz-Meta-"+name, value)
+	}
+	return &storage.PresignedRequest{
+		URL:       "https://storage.test/" + key + "?signature=mock",
+		Method:    http.MethodPut,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
 // HealthCheck checks mock storage health
 func (m *MockStorage) HealthCheck(ctx context.Context) error {
 	m.mu.Lock()
@@ -131,6 +313,14 @@ func (m *MockStorage) SetObject(key string, data []byte) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.objects[key] = data
+	m.modTimes[key] = time.Now()
+}
+
+// SetObjectHeaders sets the headers stored with an object
+func (m *MockStorage) SetObjectHeaders(key string, headers http.Header) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.headers[key] = headers
 }
 
 // ClearObjects clears all stored objects
@@ -138,6 +328,8 @@ func (m *MockStorage) ClearObjects() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.objects = make(map[string][]byte)
+	m.modTimes = make(map[string]time.Time)
+	m.headers = make(map[string]http.Header)
 }
 
 // Reset resets all mock state
@@ -146,22 +338,31 @@ func (m *MockStorage) Reset() {
 	defer m.mu.Unlock()
 
 	m.objects = make(map[string][]byte)
+	m.modTimes = make(map[string]time.Time)
+	m.uploads = make(map[string]*mockUpload)
 	m.GetCalls = make([]string, 0)
 	m.PutCalls = make([]PutCall, 0)
 	m.DeleteCalls = make([]string, 0)
 	m.ExistsCalls = make([]string, 0)
+	m.ListCalls = make([]string, 0)
+	m.PresignCalls = nil
 	m.HealthCheckCalls = 0
 	m.GetError = nil
 	m.PutError = nil
 	m.DeleteError = nil
 	m.ExistsError = nil
+	m.ListError = nil
+	m.PresignError = nil
+	m.MultipartError = nil
 	m.HealthCheckError = nil
+	m.GetDelay = 0
 }
 
 // Common errors for testing
 var (
-	ErrObjectNotFound = errors.New("NoSuchKey: The specified key does not exist")
-	ErrStorageTimeout = errors.New("storage timeout")
+	ErrObjectNotFound = fmt.Errorf("%w: NoSuchKey: The specified key does not exist", storage.ErrNotFound)
+	ErrStorageTimeout = fmt.Errorf("%w: operation timed out", storage.ErrTimeout)
+	ErrAccessDenied   = fmt.Errorf("%w: AccessDenied: Access Denied", storage.ErrAccessDenied)
 	ErrStorageError   = errors.New("storage error")
 	ErrBucketNotFound = errors.New("bucket not found")
 )
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Checksum records the SHA-256 and MD5 digests of uploaded files, as a
+// ChecksumResult
+type Checksum struct{}
+
+// ChecksumResult holds the hex-encoded digests of a file
+type ChecksumResult struct {
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+}
+
+func (Checksum) Name() string { return "checksum" }
+
+func (c Checksum) Run(ctx context.Context, job *Job) error {
+	data, err := job.Data(ctx)
+	if err != nil {
+		return err
+	}
+	sha := sha256.Sum256(data)
+	sum := md5.Sum(data)
+	job.SetResult(c.Name(), ChecksumResult{
+		SHA256: hex.EncodeToString(sha[:]),
+		MD5:    hex.EncodeToString(sum[:]),
+	})
+	return nil
+}
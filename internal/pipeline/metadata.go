@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Metadata extracts descriptive metadata from uploaded files as a
+// MetadataResult: the dimensions and EXIF tags of images and the page count
+// of PDFs. Other files are skipped. The file type is sniffed from the
+// content rather than trusted from the upload.
+type Metadata struct{}
+
+// MetadataResult is the metadata found in a file
+type MetadataResult struct {
+	Format string `json:"format"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// EXIF holds the main EXIF tags of JPEG files by tag name
+	EXIF map[string]any `json:"exif,omitempty"`
+	// Pages is the page count of PDF files, when it could be found
+	Pages int `json:"pages,omitempty"`
+}
+
+func (Metadata) Name() string { return "metadata" }
+
+func (m Metadata) Run(ctx context.Context, job *Job) error {
+	data, err := job.Data(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result MetadataResult
+	switch sniffed := http.DetectContentType(data); {
+	case sniffed == "application/pdf":
+		result = MetadataResult{Format: "pdf", Pages: pdfPageCount(data)}
+	case strings.HasPrefix(sniffed, "image/"):
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: undecodable image: %v", ErrSkip, err)
+		}
+		result = MetadataResult{Format: format, Width: config.Width, Height: config.Height}
+		if format == "jpeg" {
+			result.EXIF = readEXIF(data)
+		}
+	default:
+		return fmt.Errorf("%w: no metadata for %s", ErrSkip, sniffed)
+	}
+	job.SetResult(m.Name(), result)
+	return nil
+}
+
+// pdfPage matches page objects but not the /Pages tree nodes
+var pdfPage = regexp.MustCompile(`/Type\s*/Page\b`)
+
+// pdfPageCount counts the page objects of a PDF. Pages inside compressed
+// object streams aren't visible, in which case 0 is returned.
+func pdfPageCount(data []byte) int {
+	return len(pdfPage.FindAllIndex(data, -1))
+}
+
+// EXIF tags reported by readEXIF, by the IFD they are read from
+var (
+	exifMainTags = map[uint16]string{
+		0x010F: "Make",
+		0x0110: "Model",
+		0x0112: "Orientation",
+		0x0131: "Software",
+		0x0132: "DateTime",
+	}
+	exifSubTags = map[uint16]string{
+		0x9003: "DateTimeOriginal",
+		0x8827: "ISOSpeedRatings",
+		0xA434: "LensModel",
+	}
+)
+
+// exifIFDPointer is the tag of the offset of the EXIF sub-IFD
+const exifIFDPointer = 0x8769
+
+// readEXIF returns the EXIF tags of a JPEG file, or nil when it has none.
+// Malformed EXIF data is ignored.
+func readEXIF(data []byte) map[string]any {
+	tiff := exifSegment(data)
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil
+	}
+
+	tags := make(map[string]any)
+	sub := readIFD(tiff, order, order.Uint32(tiff[4:]), exifMainTags, tags)
+	if sub > 0 {
+		readIFD(tiff, order, sub, exifSubTags, tags)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// exifSegment returns the TIFF data of the Exif APP1 segment of a JPEG
+func exifSegment(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		// Start of scan: the metadata segments are all before it
+		if marker == 0xDA {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i = end
+	}
+	return nil
+}
+
+// readIFD adds the wanted tags of the IFD at offset to tags and returns the
+// offset of the EXIF sub-IFD, if it points to one
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32, wanted map[uint16]string, tags map[string]any) uint32 {
+	if int64(offset)+2 > int64(len(tiff)) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	var sub uint32
+	for i := range count {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(tiff) {
+			break
+		}
+		entry := tiff[start : start+12]
+		tag, kind, n := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+		if tag == exifIFDPointer && kind == 4 {
+			sub = order.Uint32(entry[8:])
+			continue
+		}
+		name, ok := wanted[tag]
+		if !ok {
+			continue
+		}
+		switch kind {
+		case 2: // ASCII, inline when it fits in 4 bytes
+			value := entry[8:12]
+			if n > 4 {
+				at := order.Uint32(entry[8:])
+				if int64(at)+int64(n) > int64(len(tiff)) {
+					continue
+				}
+				value = tiff[at : at+n]
+			}
+			tags[name] = strings.TrimRight(string(value[:min(int(n), len(value))]), "\x00 ")
+		case 3: // SHORT
+			tags[name] = int(order.Uint16(entry[8:]))
+		case 4: // LONG
+			tags[name] = int(order.Uint32(entry[8:]))
+		}
+	}
+	return sub
+}
@@ -0,0 +1,321 @@
+// Package pipeline post-processes uploaded files: checksums, metadata
+// extraction, thumbnails, webhooks and the like. Uploads are queued and run
+// through the configured steps in order by a pool of background workers,
+// with failed steps retried. Uploads are dropped rather than queued when
+// the queue is full, so they never delay the upload response.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// ErrSkip is returned, possibly wrapped, by steps that don't apply to an
+// upload. It is not retried and the following steps still run.
+var ErrSkip = errors.New("step skipped")
+
+// Upload describes a file that was stored
+type Upload struct {
+	Key string
+	// Size is the size in bytes, or 0 when unknown
+	Size        int64
+	ContentType string
+	// Source is the API the file was uploaded through
+	Source string
+	// Time is when the upload completed
+	Time time.Time
+}
+
+// Step is one stage of the pipeline
+type Step interface {
+	// Name identifies the step in logs, metrics and results
+	Name() string
+	// Run processes job. Errors are retried unless they wrap ErrSkip.
+	Run(ctx context.Context, job *Job) error
+}
+
+// LoadFunc reads the content of key from storage
+type LoadFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Job is an upload going through the pipeline. Its steps run one after
+// another, share its content, which is loaded on first use, and record what
+// they find in its results for the steps that follow.
+type Job struct {
+	Upload Upload
+
+	ctx      context.Context
+	load     LoadFunc
+	maxBytes int64
+	data     []byte
+	results  map[string]any
+}
+
+// NewJob creates a job for u outside a pipeline, loading its content with
+// load. It lets steps be run on their own.
+func NewJob(u Upload, load LoadFunc) *Job {
+	return &Job{Upload: u, ctx: context.Background(), load: load, results: make(map[string]any)}
+}
+
+// Data returns the content of the upload. Files over the pipeline's size
+// limit are skipped.
+func (j *Job) Data(ctx context.Context) ([]byte, error) {
+	if j.data != nil {
+		return j.data, nil
+	}
+	if j.maxBytes > 0 && j.Upload.Size > j.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes is over the %d byte limit", ErrSkip, j.Upload.Size, j.maxBytes)
+	}
+	data, err := j.load(ctx, j.Upload.Key)
+	if err != nil {
+		return nil, err
+	}
+	j.Upload.Size = int64(len(data))
+	if j.maxBytes > 0 && j.Upload.Size > j.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes is over the %d byte limit", ErrSkip, j.Upload.Size, j.maxBytes)
+	}
+	j.data = data
+	return data, nil
+}
+
+// SetResult records the outcome of the step named step
+func (j *Job) SetResult(step string, value any) {
+	j.results[step] = value
+}
+
+// Result returns the outcome recorded by the step named step
+func (j *Job) Result(step string) (any, bool) {
+	value, ok := j.results[step]
+	return value, ok
+}
+
+// Results returns the outcomes recorded so far, by step name
+func (j *Job) Results() map[string]any {
+	results := make(map[string]any, len(j.results))
+	for step, value := range j.results {
+		results[step] = value
+	}
+	return results
+}
+
+// Config controls the steps uploads go through and the work the pipeline
+// may do at once
+type Config struct {
+	// Steps run in order on every upload
+	Steps []Step
+	// Load reads uploaded files for the steps that need their content
+	Load LoadFunc
+	// Workers is how many uploads are processed at once
+	Workers int
+	// QueueSize caps the uploads waiting for a worker
+	QueueSize int
+	// MaxAttempts is how many times a failing step is tried
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each one
+	Backoff time.Duration
+	// StepTimeout bounds each attempt of a step
+	StepTimeout time.Duration
+	// MaxBytes caps the files steps load the content of; 0 means no limit
+	MaxBytes int64
+	// Metrics records processed uploads and steps; nil records nowhere
+	Metrics *metrics.Metrics
+}
+
+// Pipeline runs uploads through its steps in the background. A nil
+// Pipeline does nothing.
+type Pipeline struct {
+	cfg     Config
+	queue   chan *Job
+	metrics *metrics.Metrics
+	wg      sync.WaitGroup
+
+	// ctx is canceled when Close gives up waiting for running jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a Pipeline for cfg and starts its workers
+func New(cfg Config) (*Pipeline, error) {
+	if len(cfg.Steps) == 0 {
+		return nil, errors.New("upload pipeline has no steps")
+	}
+	if cfg.Load == nil {
+		return nil, errors.New("upload pipeline has no loader")
+	}
+	seen := make(map[string]bool)
+	for _, step := range cfg.Steps {
+		if seen[step.Name()] {
+			return nil, fmt.Errorf("duplicate upload pipeline step %q", step.Name())
+		}
+		seen[step.Name()] = true
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.StepTimeout <= 0 {
+		cfg.StepTimeout = time.Minute
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Noop()
+	}
+
+	p := &Pipeline{
+		cfg:     cfg,
+		queue:   make(chan *Job, cfg.QueueSize),
+		metrics: cfg.Metrics,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for range cfg.Workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p, nil
+}
+
+// Submit queues u for processing and reports whether it was queued. Steps
+// run detached from ctx but keep its values, such as the request ID.
+func (p *Pipeline) Submit(ctx context.Context, u Upload) bool {
+	if p == nil {
+		return false
+	}
+	if u.Time.IsZero() {
+		u.Time = time.Now()
+	}
+	job := &Job{
+		Upload:   u,
+		ctx:      context.WithoutCancel(ctx),
+		load:     p.cfg.Load,
+		maxBytes: p.cfg.MaxBytes,
+		results:  make(map[string]any),
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.closed {
+		select {
+		case p.queue <- job:
+			p.metrics.PipelineUploadsTotal.WithLabelValues("queued").Inc()
+			return true
+		default:
+		}
+	}
+	p.metrics.PipelineUploadsTotal.WithLabelValues("dropped").Inc()
+	slog.WarnContext(ctx, "Upload pipeline full, upload not processed", "filename", u.Key)
+	return false
+}
+
+// Queued returns the number of uploads waiting for a worker
+func (p *Pipeline) Queued() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.queue)
+}
+
+// Close stops accepting uploads and waits for the queued ones to be
+// processed. When ctx ends first, running steps are canceled and the rest
+// of the queue is dropped.
+func (p *Pipeline) Close(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pipeline) work() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		if p.ctx.Err() != nil {
+			p.metrics.PipelineUploadsTotal.WithLabelValues("dropped").Inc()
+			continue
+		}
+		p.process(job)
+	}
+}
+
+// process runs job through the steps in order. A step that still fails
+// after its retries ends the run, since later steps may build on it.
+func (p *Pipeline) process(job *Job) {
+	for _, step := range p.cfg.Steps {
+		if err := p.runStep(step, job); err != nil {
+			p.metrics.PipelineUploadsTotal.WithLabelValues("failed").Inc()
+			slog.ErrorContext(job.ctx, "Upload pipeline step failed", "filename", job.Upload.Key, "step", step.Name(), "error", err)
+			return
+		}
+	}
+	p.metrics.PipelineUploadsTotal.WithLabelValues("completed").Inc()
+	slog.InfoContext(job.ctx, "Upload processed", "filename", job.Upload.Key, "steps", len(p.cfg.Steps))
+}
+
+// runStep runs step on job, retrying failures with exponential backoff
+func (p *Pipeline) runStep(step Step, job *Job) error {
+	name := step.Name()
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(job.ctx, p.cfg.StepTimeout)
+		stop := context.AfterFunc(p.ctx, cancel)
+		err := step.Run(ctx, job)
+		stop()
+		cancel()
+		p.metrics.PipelineStepDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+		switch {
+		case err == nil:
+			p.metrics.PipelineStepsTotal.WithLabelValues(name, "ok").Inc()
+			return nil
+		case errors.Is(err, ErrSkip):
+			p.metrics.PipelineStepsTotal.WithLabelValues(name, "skipped").Inc()
+			slog.DebugContext(job.ctx, "Upload pipeline step skipped", "filename", job.Upload.Key, "step", name, "reason", err)
+			return nil
+		case attempt >= p.cfg.MaxAttempts || p.ctx.Err() != nil:
+			p.metrics.PipelineStepsTotal.WithLabelValues(name, "error").Inc()
+			return err
+		}
+
+		p.metrics.PipelineStepsTotal.WithLabelValues(name, "retry").Inc()
+		backoff := p.cfg.Backoff << (attempt - 1)
+		slog.WarnContext(job.ctx, "Upload pipeline step failed, retrying", "filename", job.Upload.Key, "step", name, "attempt", attempt, "backoff", backoff.String(), "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			p.metrics.PipelineStepsTotal.WithLabelValues(name, "error").Inc()
+			return err
+		}
+	}
+}
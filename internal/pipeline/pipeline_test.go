@@ -0,0 +1,267 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/pipeline"
+)
+
+// stepFunc is a Step running a function
+type stepFunc struct {
+	name string
+	run  func(ctx context.Context, job *pipeline.Job) error
+}
+
+func (s stepFunc) Name() string { return s.name }
+
+func (s stepFunc) Run(ctx context.Context, job *pipeline.Job) error { return s.run(ctx, job) }
+
+// trace records the steps run, in order
+type trace struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (tr *trace) step(name string, errs ...error) pipeline.Step {
+	return stepFunc{name: name, run: func(ctx context.Context, job *pipeline.Job) error {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		attempt := 0
+		for _, call := range tr.calls {
+			if call == name+":"+job.Upload.Key {
+				attempt++
+			}
+		}
+		tr.calls = append(tr.calls, name+":"+job.Upload.Key)
+		if attempt < len(errs) {
+			return errs[attempt]
+		}
+		return nil
+	}}
+}
+
+func (tr *trace) get() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return slices.Clone(tr.calls)
+}
+
+func load(ctx context.Context, key string) ([]byte, error) {
+	return []byte("content of " + key), nil
+}
+
+func newPipeline(t *testing.T, cfg pipeline.Config) *pipeline.Pipeline {
+	t.Helper()
+	if cfg.Load == nil {
+		cfg.Load = load
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = time.Millisecond
+	}
+	p, err := pipeline.New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return p
+}
+
+func TestPipeline_RunsStepsInOrder(t *testing.T) {
+	var tr trace
+	var seen any
+	report := stepFunc{name: "report", run: func(ctx context.Context, job *pipeline.Job) error {
+		seen, _ = job.Result("first")
+		return nil
+	}}
+	first := stepFunc{name: "first", run: func(ctx context.Context, job *pipeline.Job) error {
+		data, err := job.Data(ctx)
+		job.SetResult("first", string(data))
+		return err
+	}}
+	p := newPipeline(t, pipeline.Config{Steps: []pipeline.Step{first, tr.step("second"), report}, Workers: 1})
+
+	if !p.Submit(context.Background(), pipeline.Upload{Key: "a.txt"}) {
+		t.Fatal("Expected the upload to be queued")
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := tr.get(); !slices.Equal(got, []string{"second:a.txt"}) {
+		t.Errorf("Expected the second step to run once, got %v", got)
+	}
+	if seen != "content of a.txt" {
+		t.Errorf("Expected later steps to see earlier results, got %v", seen)
+	}
+}
+
+func TestPipeline_Retries(t *testing.T) {
+	var tr trace
+	flaky := errors.New("flaky")
+	p := newPipeline(t, pipeline.Config{
+		Steps: []pipeline.Step{
+			tr.step("fetch", flaky, flaky),
+			tr.step("notify"),
+		},
+		MaxAttempts: 3,
+	})
+	p.Submit(context.Background(), pipeline.Upload{Key: "a"})
+	p.Close(context.Background())
+
+	want := []string{"fetch:a", "fetch:a", "fetch:a", "notify:a"}
+	if got := tr.get(); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestPipeline_FailedStepEndsRun(t *testing.T) {
+	var tr trace
+	broken := errors.New("broken")
+	p := newPipeline(t, pipeline.Config{
+		Steps: []pipeline.Step{
+			tr.step("fetch", broken, broken),
+			tr.step("notify"),
+		},
+		MaxAttempts: 2,
+	})
+	p.Submit(context.Background(), pipeline.Upload{Key: "a"})
+	p.Close(context.Background())
+
+	if got := tr.get(); !slices.Equal(got, []string{"fetch:a", "fetch:a"}) {
+		t.Errorf("Expected two attempts and no later steps, got %v", got)
+	}
+}
+
+func TestPipeline_Skip(t *testing.T) {
+	var tr trace
+	p := newPipeline(t, pipeline.Config{
+		Steps: []pipeline.Step{
+			tr.step("thumbnail", fmt.Errorf("%w: not an image", pipeline.ErrSkip)),
+			tr.step("notify"),
+		},
+	})
+	p.Submit(context.Background(), pipeline.Upload{Key: "a"})
+	p.Close(context.Background())
+
+	if got := tr.get(); !slices.Equal(got, []string{"thumbnail:a", "notify:a"}) {
+		t.Errorf("Expected a skipped step not to be retried or end the run, got %v", got)
+	}
+}
+
+func TestPipeline_MaxBytes(t *testing.T) {
+	var loadErr error
+	step := stepFunc{name: "read", run: func(ctx context.Context, job *pipeline.Job) error {
+		_, loadErr = job.Data(ctx)
+		return loadErr
+	}}
+	p := newPipeline(t, pipeline.Config{Steps: []pipeline.Step{step}, MaxBytes: 4})
+	p.Submit(context.Background(), pipeline.Upload{Key: "a"})
+	p.Close(context.Background())
+
+	if !errors.Is(loadErr, pipeline.ErrSkip) {
+		t.Errorf("Expected files over the limit to be skipped, got %v", loadErr)
+	}
+}
+
+func TestPipeline_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	block := stepFunc{name: "block", run: func(ctx context.Context, job *pipeline.Job) error {
+		<-release
+		return nil
+	}}
+	p := newPipeline(t, pipeline.Config{Steps: []pipeline.Step{block}, Workers: 1, QueueSize: 1})
+
+	// One upload is taken by the worker and one waits in the queue
+	p.Submit(context.Background(), pipeline.Upload{Key: "a"})
+	deadline := time.Now().Add(time.Second)
+	for p.Queued() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !p.Submit(context.Background(), pipeline.Upload{Key: "b"}) {
+		t.Fatal("Expected the second upload to be queued")
+	}
+	if p.Submit(context.Background(), pipeline.Upload{Key: "c"}) {
+		t.Error("Expected uploads to be dropped when the queue is full")
+	}
+	close(release)
+	p.Close(context.Background())
+
+	if p.Submit(context.Background(), pipeline.Upload{Key: "d"}) {
+		t.Error("Expected uploads to be dropped after Close")
+	}
+}
+
+func TestPipeline_CloseTimeout(t *testing.T) {
+	canceled := make(chan struct{})
+	block := stepFunc{name: "block", run: func(ctx context.Context, job *pipeline.Job) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}}
+	p := newPipeline(t, pipeline.Config{Steps: []pipeline.Step{block}})
+	p.Submit(context.Background(), pipeline.Upload{Key: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up, got %v", err)
+	}
+	select {
+	case <-canceled:
+	default:
+		t.Error("Expected the running step to be canceled")
+	}
+}
+
+func TestNilPipeline(t *testing.T) {
+	var p *pipeline.Pipeline
+	if p.Submit(context.Background(), pipeline.Upload{Key: "a"}) {
+		t.Error("Expected a nil pipeline to queue nothing")
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Errorf("Expected Close to succeed, got %v", err)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	step := stepFunc{name: "a", run: func(context.Context, *pipeline.Job) error { return nil }}
+	tests := []struct {
+		name string
+		cfg  pipeline.Config
+	}{
+		{name: "no steps", cfg: pipeline.Config{Load: load}},
+		{name: "no loader", cfg: pipeline.Config{Steps: []pipeline.Step{step}}},
+		{name: "duplicate step", cfg: pipeline.Config{Steps: []pipeline.Step{step, step}, Load: load}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := pipeline.New(tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := pipeline.NewRegistry()
+	registry.Register("checksum", func() (pipeline.Step, error) { return pipeline.Checksum{}, nil })
+	registry.Register("webhook", func() (pipeline.Step, error) { return pipeline.NewWebhook("", "") })
+
+	steps, err := registry.Build([]string{"checksum"})
+	if err != nil || len(steps) != 1 || steps[0].Name() != "checksum" {
+		t.Fatalf("Expected the checksum step, got %v (%v)", steps, err)
+	}
+
+	// Factories only run for the steps selected
+	if _, err := registry.Build([]string{"webhook"}); err == nil || !strings.Contains(err.Error(), "webhook") {
+		t.Errorf("Expected the webhook factory error, got %v", err)
+	}
+	if _, err := registry.Build([]string{"exif"}); err == nil || !strings.Contains(err.Error(), "checksum, webhook") {
+		t.Errorf("Expected an unknown step error listing the known steps, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Factory creates a step, usually from configuration captured when it was
+// registered. It is only called for steps that are selected, so steps that
+// aren't used need no configuration.
+type Factory func() (Step, error)
+
+// Registry maps step names to factories, so configuration can choose the
+// steps uploads go through and their order
+type Registry struct {
+	factories map[string]Factory
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// Register adds the step named name. It panics if the name is taken.
+func (r *Registry) Register(name string, factory Factory) {
+	if _, ok := r.factories[name]; ok {
+		panic("pipeline: step " + name + " registered twice")
+	}
+	r.factories[name] = factory
+}
+
+// Names returns the registered step names, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Build creates the steps named by names, in that order
+func (r *Registry) Build(names []string) ([]Step, error) {
+	steps := make([]Step, 0, len(names))
+	for _, name := range names {
+		factory, ok := r.factories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown upload pipeline step %q (known: %s)", name, strings.Join(r.Names(), ", "))
+		}
+		step, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("upload pipeline step %q: %w", name, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
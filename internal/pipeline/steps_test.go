@@ -0,0 +1,231 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/pipeline"
+)
+
+// jobFor creates a job for a file with content data
+func jobFor(key string, data []byte) *pipeline.Job {
+	return pipeline.NewJob(pipeline.Upload{Key: key}, func(context.Context, string) ([]byte, error) {
+		return data, nil
+	})
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xFF})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// jpegWithEXIF encodes a JPEG carrying an Exif segment with Make,
+// Orientation and, in the EXIF sub-IFD, DateTimeOriginal
+func jpegWithEXIF(t *testing.T) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, testImage(8, 4), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	le := binary.LittleEndian
+	const (
+		ifd0     = 8
+		subIFD   = ifd0 + 2 + 3*12 + 4
+		makeAt   = subIFD + 2 + 12 + 4
+		takenAt  = makeAt + 6
+		takenStr = "2024:05:01 10:00:00\x00"
+	)
+	entry := func(b []byte, tag, kind uint16, count, value uint32) []byte {
+		b = le.AppendUint16(b, tag)
+		b = le.AppendUint16(b, kind)
+		b = le.AppendUint32(b, count)
+		return le.AppendUint32(b, value)
+	}
+	tiff := []byte("II")
+	tiff = le.AppendUint16(tiff, 42)
+	tiff = le.AppendUint32(tiff, ifd0)
+	tiff = le.AppendUint16(tiff, 3)
+	tiff = entry(tiff, 0x010F, 2, 6, makeAt)
+	tiff = entry(tiff, 0x0112, 3, 1, 6)
+	tiff = entry(tiff, 0x8769, 4, 1, subIFD)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = entry(tiff, 0x9003, 2, uint32(len(takenStr)), takenAt)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, "Canon\x00"+takenStr...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, img.Bytes()[2:]...)
+}
+
+func TestChecksum(t *testing.T) {
+	job := jobFor("a.txt", []byte("hello"))
+	if err := (pipeline.Checksum{}).Run(context.Background(), job); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	result, _ := job.Result("checksum")
+	sums := result.(pipeline.ChecksumResult)
+	if sums.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" || sums.MD5 != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("Unexpected digests %+v", sums)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n1 0 obj << /Type /Pages /Count 2 >>\n2 0 obj << /Type /Page >>\n3 0 obj <</Type/Page>>\n%%EOF")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     pipeline.MetadataResult
+		wantEXIF map[string]any
+		wantSkip bool
+	}{
+		{name: "png", data: encodePNG(t, testImage(30, 20)), want: pipeline.MetadataResult{Format: "png", Width: 30, Height: 20}},
+		{
+			name:     "jpeg with exif",
+			data:     jpegWithEXIF(t),
+			want:     pipeline.MetadataResult{Format: "jpeg", Width: 8, Height: 4},
+			wantEXIF: map[string]any{"Make": "Canon", "Orientation": 6, "DateTimeOriginal": "2024:05:01 10:00:00"},
+		},
+		{name: "pdf", data: pdf, want: pipeline.MetadataResult{Format: "pdf", Pages: 2}},
+		{name: "text", data: []byte("just text"), wantSkip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := jobFor("file", tt.data)
+			err := (pipeline.Metadata{}).Run(context.Background(), job)
+			if tt.wantSkip {
+				if !errors.Is(err, pipeline.ErrSkip) {
+					t.Errorf("Expected the file to be skipped, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			result, _ := job.Result("metadata")
+			want := tt.want
+			want.EXIF = tt.wantEXIF
+			if got := result.(pipeline.MetadataResult); !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	step, err := pipeline.NewThumbnail(mockStorage, "thumbs/", 50)
+	if err != nil {
+		t.Fatalf("NewThumbnail failed: %v", err)
+	}
+
+	job := jobFor("photos/wide.png", encodePNG(t, testImage(200, 100)))
+	if err := step.Run(context.Background(), job); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	result, _ := job.Result("thumbnail")
+	if got := result.(pipeline.ThumbnailResult); got != (pipeline.ThumbnailResult{Key: "thumbs/photos/wide.png.jpg", Width: 50, Height: 25}) {
+		t.Errorf("Unexpected thumbnail %+v", got)
+	}
+	if len(mockStorage.PutCalls) != 1 || mockStorage.PutCalls[0].ContentType != "image/jpeg" {
+		t.Fatalf("Expected the thumbnail to be stored as a JPEG, got %v", mockStorage.PutCalls)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(mockStorage.PutCalls[0].Data))
+	if err != nil || thumb.Bounds().Dx() != 50 {
+		t.Errorf("Expected a 50 pixel wide JPEG, got %v (%v)", thumb, err)
+	}
+
+	for name, job := range map[string]*pipeline.Job{
+		"not an image": jobFor("notes.txt", []byte("text")),
+		"thumbnail":    jobFor("thumbs/photos/wide.png.jpg", mockStorage.PutCalls[0].Data),
+	} {
+		if err := step.Run(context.Background(), job); !errors.Is(err, pipeline.ErrSkip) {
+			t.Errorf("Expected %s to be skipped, got %v", name, err)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var (
+		event     pipeline.WebhookEvent
+		signature string
+		status    = http.StatusNoContent
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if r.Header.Get(pipeline.HeaderWebhookSignature) != signature {
+			signature = ""
+		}
+		json.Unmarshal(body, &event)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	step, err := pipeline.NewWebhook(server.URL, "s3cret")
+	if err != nil {
+		t.Fatalf("NewWebhook failed: %v", err)
+	}
+	job := jobFor("a.txt", []byte("hello"))
+	job.Upload.Source = "s3"
+	job.SetResult("checksum", pipeline.ChecksumResult{SHA256: "abc"})
+
+	if err := step.Run(context.Background(), job); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if signature == "" {
+		t.Error("Expected a valid signature")
+	}
+	if event.Event != "upload.processed" || event.Key != "a.txt" || event.Source != "s3" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if checksum, ok := event.Results["checksum"].(map[string]any); !ok || checksum["sha256"] != "abc" {
+		t.Errorf("Expected the checksum result, got %v", event.Results)
+	}
+
+	status = http.StatusInternalServerError
+	if err := step.Run(context.Background(), job); err == nil {
+		t.Error("Expected an error for a failed delivery")
+	}
+
+	if _, err := pipeline.NewWebhook("not a url", ""); err == nil {
+		t.Error("Expected an error for an invalid URL")
+	}
+}
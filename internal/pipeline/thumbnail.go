@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// DefaultThumbnailSize is the default longest side of thumbnails in pixels
+const DefaultThumbnailSize = 256
+
+// Thumbnail stores a scaled-down JPEG copy of uploaded images under a
+// prefix, as <prefix><key>.jpg, and records its key as a ThumbnailResult.
+// Files that aren't JPEG, PNG or GIF images are skipped, as are the
+// thumbnails themselves.
+type Thumbnail struct {
+	storage storage.Storage
+	prefix  string
+	size    int
+}
+
+// ThumbnailResult describes a stored thumbnail
+type ThumbnailResult struct {
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// NewThumbnail creates a Thumbnail step storing thumbnails in s under
+// prefix. size <= 0 uses DefaultThumbnailSize.
+func NewThumbnail(s storage.Storage, prefix string, size int) (*Thumbnail, error) {
+	if prefix == "" {
+		return nil, errors.New("thumbnail prefix is required")
+	}
+	if size <= 0 {
+		size = DefaultThumbnailSize
+	}
+	return &Thumbnail{storage: s, prefix: prefix, size: size}, nil
+}
+
+func (t *Thumbnail) Name() string { return "thumbnail" }
+
+func (t *Thumbnail) Run(ctx context.Context, job *Job) error {
+	if strings.HasPrefix(job.Upload.Key, t.prefix) {
+		return fmt.Errorf("%w: already a thumbnail", ErrSkip)
+	}
+	data, err := job.Data(ctx)
+	if err != nil {
+		return err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: not a supported image: %v", ErrSkip, err)
+	}
+
+	thumb := scaleDown(src, t.size)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	key := t.prefix + job.Upload.Key + ".jpg"
+	if err := t.storage.PutObject(ctx, key, &buf, "image/jpeg"); err != nil {
+		return fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	bounds := thumb.Bounds()
+	job.SetResult(t.Name(), ThumbnailResult{Key: key, Width: bounds.Dx(), Height: bounds.Dy()})
+	return nil
+}
+
+// scaleDown fits src within size x size pixels, averaging the source pixels
+// each thumbnail pixel covers. Smaller images keep their size.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/bounds.Dx())
+		} else {
+			w, h = max(1, w*size/bounds.Dy()), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		y0 := bounds.Min.Y + y*bounds.Dy()/h
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/h)
+		for x := range w {
+			x0 := bounds.Min.X + x*bounds.Dx()/w
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/w)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			// JPEG has no alpha, so transparency is flattened onto white
+			white := 0xFF - uint8(a/n>>8)
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r/n>>8) + white,
+				G: uint8(g/n>>8) + white,
+				B: uint8(b/n>>8) + white,
+				A: 0xFF,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/logger"
+)
+
+// HeaderWebhookSignature carries the HMAC-SHA256 of webhook bodies, as
+// "sha256=<hex>", when a secret is configured
+const HeaderWebhookSignature = "X-Webhook-Signature"
+
+// Webhook posts a WebhookEvent with the results of the previous steps to a
+// URL. Responses other than 2xx are failures and retried.
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// WebhookEvent is the body of webhook requests
+type WebhookEvent struct {
+	Event       string         `json:"event"`
+	Key         string         `json:"key"`
+	Size        int64          `json:"size"`
+	ContentType string         `json:"content_type,omitempty"`
+	Source      string         `json:"source,omitempty"`
+	UploadedAt  time.Time      `json:"uploaded_at"`
+	Results     map[string]any `json:"results,omitempty"`
+}
+
+// NewWebhook creates a Webhook step posting to target, signing bodies with
+// secret when it is set
+func NewWebhook(target, secret string) (*Webhook, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q: must be an absolute http(s) URL", u.Redacted())
+	}
+	return &Webhook{url: target, secret: []byte(secret), client: &http.Client{}}, nil
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Run(ctx context.Context, job *Job) error {
+	body, err := json.Marshal(WebhookEvent{
+		Event:       "upload.processed",
+		Key:         job.Upload.Key,
+		Size:        job.Upload.Size,
+		ContentType: job.Upload.ContentType,
+		Source:      job.Upload.Source,
+		UploadedAt:  job.Upload.Time.UTC(),
+		Results:     job.Results(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := logger.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(HeaderWebhookSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+// Package policy implements a small expression language for per-request
+// decisions such as whether a file may be cached or must be denied.
+//
+// Expressions combine request attributes with boolean logic, e.g.
+//
+//	size < 10MB && prefix('public/')
+//	ext == '.exe' || matches('^tmp/')
+//
+// Attributes: name, ext, size (bytes, 0 when unknown), method, content_type.
+// Functions: prefix(s), suffix(s), contains(s), glob(pattern), matches(regexp),
+// all applied to the request name. Sizes accept B, KB, MB and GB suffixes.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Request holds the attributes an expression can refer to
+type Request struct {
+	Name        string
+	Size        int64
+	Method      string
+	ContentType string
+}
+
+// Expr is a compiled policy expression, safe for concurrent use
+type Expr struct {
+	src  string
+	eval func(*Request) bool
+}
+
+// Compile parses and type-checks an expression
+func Compile(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("policy %q: %w", src, err)
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("policy %q: %w", src, err)
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("policy %q: unexpected %q at %d", src, tok.text, tok.pos)
+	}
+	if n.typ != typeBool {
+		return nil, fmt.Errorf("policy %q: expression must evaluate to a boolean", src)
+	}
+	return &Expr{src: src, eval: n.boolFn}, nil
+}
+
+// MustCompile is like Compile but panics on error
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Eval evaluates the expression against a request. A nil Expr matches nothing.
+func (e *Expr) Eval(r *Request) bool {
+	if e == nil {
+		return false
+	}
+	return e.eval(r)
+}
+
+// String returns the expression source
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+type valueType int
+
+const (
+	typeBool valueType = iota
+	typeInt
+	typeString
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeBool:
+		return "bool"
+	case typeInt:
+		return "int"
+	default:
+		return "string"
+	}
+}
+
+// node is a typed, compiled sub-expression. Exactly one of the functions is
+// set, matching typ.
+type node struct {
+	typ    valueType
+	boolFn func(*Request) bool
+	intFn  func(*Request) int64
+	strFn  func(*Request) string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) acceptOp(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireBool(left, right); err != nil {
+			return nil, err
+		}
+		l, r := left.boolFn, right.boolFn
+		left = &node{typ: typeBool, boolFn: func(req *Request) bool { return l(req) || r(req) }}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireBool(left, right); err != nil {
+			return nil, err
+		}
+		l, r := left.boolFn, right.boolFn
+		left = &node{typ: typeBool, boolFn: func(req *Request) bool { return l(req) && r(req) }}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (*node, error) {
+	if p.acceptOp("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireBool(operand); err != nil {
+			return nil, err
+		}
+		fn := operand.boolFn
+		return &node{typ: typeBool, boolFn: func(req *Request) bool { return !fn(req) }}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (*node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return left, nil
+	}
+	switch tok.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if left.typ != right.typ {
+		return nil, fmt.Errorf("cannot compare %s with %s at %d", left.typ, right.typ, tok.pos)
+	}
+	return compare(tok, left, right)
+}
+
+func compare(op token, left, right *node) (*node, error) {
+	switch left.typ {
+	case typeInt:
+		l, r := left.intFn, right.intFn
+		var fn func(a, b int64) bool
+		switch op.text {
+		case "==":
+			fn = func(a, b int64) bool { return a == b }
+		case "!=":
+			fn = func(a, b int64) bool { return a != b }
+		case "<":
+			fn = func(a, b int64) bool { return a < b }
+		case "<=":
+			fn = func(a, b int64) bool { return a <= b }
+		case ">":
+			fn = func(a, b int64) bool { return a > b }
+		case ">=":
+			fn = func(a, b int64) bool { return a >= b }
+		}
+		return &node{typ: typeBool, boolFn: func(req *Request) bool { return fn(l(req), r(req)) }}, nil
+	case typeString:
+		l, r := left.strFn, right.strFn
+		switch op.text {
+		case "==":
+			return &node{typ: typeBool, boolFn: func(req *Request) bool { return l(req) == r(req) }}, nil
+		case "!=":
+			return &node{typ: typeBool, boolFn: func(req *Request) bool { return l(req) != r(req) }}, nil
+		}
+	case typeBool:
+		l, r := left.boolFn, right.boolFn
+		switch op.text {
+		case "==":
+			return &node{typ: typeBool, boolFn: func(req *Request) bool { return l(req) == r(req) }}, nil
+		case "!=":
+			return &node{typ: typeBool, boolFn: func(req *Request) bool { return l(req) != r(req) }}, nil
+		}
+	}
+	return nil, fmt.Errorf("operator %s is not supported for %s at %d", op.text, left.typ, op.pos)
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at %d", closing.pos)
+		}
+		return n, nil
+	case tokNumber:
+		v, err := parseSize(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("%w at %d", err, tok.pos)
+		}
+		return &node{typ: typeInt, intFn: func(*Request) int64 { return v }}, nil
+	case tokString:
+		v := tok.text
+		return &node{typ: typeString, strFn: func(*Request) string { return v }}, nil
+	case tokIdent:
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return identifier(tok)
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+func identifier(tok token) (*node, error) {
+	switch tok.text {
+	case "true":
+		return &node{typ: typeBool, boolFn: func(*Request) bool { return true }}, nil
+	case "false":
+		return &node{typ: typeBool, boolFn: func(*Request) bool { return false }}, nil
+	case "name":
+		return &node{typ: typeString, strFn: func(r *Request) string { return r.Name }}, nil
+	case "ext":
+		return &node{typ: typeString, strFn: func(r *Request) string { return strings.ToLower(path.Ext(r.Name)) }}, nil
+	case "method":
+		return &node{typ: typeString, strFn: func(r *Request) string { return r.Method }}, nil
+	case "content_type":
+		return &node{typ: typeString, strFn: func(r *Request) string { return r.ContentType }}, nil
+	case "size":
+		return &node{typ: typeInt, intFn: func(r *Request) int64 { return r.Size }}, nil
+	}
+	return nil, fmt.Errorf("unknown attribute %q at %d", tok.text, tok.pos)
+}
+
+func (p *parser) parseCall(fnTok token) (*node, error) {
+	p.next() // (
+	arg := p.next()
+	if arg.kind != tokString {
+		return nil, fmt.Errorf("%s expects a string argument at %d", fnTok.text, arg.pos)
+	}
+	if closing := p.next(); closing.kind != tokRParen {
+		return nil, fmt.Errorf("%s takes exactly one argument at %d", fnTok.text, closing.pos)
+	}
+
+	s := arg.text
+	var fn func(*Request) bool
+	switch fnTok.text {
+	case "prefix":
+		fn = func(r *Request) bool { return strings.HasPrefix(r.Name, s) }
+	case "suffix":
+		fn = func(r *Request) bool { return strings.HasSuffix(r.Name, s) }
+	case "contains":
+		fn = func(r *Request) bool { return strings.Contains(r.Name, s) }
+	case "glob":
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q at %d", s, arg.pos)
+		}
+		fn = func(r *Request) bool {
+			ok, _ := path.Match(s, r.Name)
+			return ok
+		}
+	case "matches":
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %q at %d: %w", s, arg.pos, err)
+		}
+		fn = func(r *Request) bool { return re.MatchString(r.Name) }
+	default:
+		return nil, fmt.Errorf("unknown function %q at %d", fnTok.text, fnTok.pos)
+	}
+	return &node{typ: typeBool, boolFn: fn}, nil
+}
+
+func requireBool(nodes ...*node) error {
+	for _, n := range nodes {
+		if n.typ != typeBool {
+			return fmt.Errorf("expected boolean operand, got %s", n.typ)
+		}
+	}
+	return nil
+}
+
+// parseSize parses an integer with an optional B/KB/MB/GB suffix
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(s)
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.mult
+			break
+		}
+	}
+
+	v, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return v * multiplier, nil
+}
+
+// Set holds the compiled policies consulted while serving requests
+type Set struct {
+	// Cache decides whether a fetched file may be stored in the cache.
+	// When nil every file is cacheable.
+	Cache *Expr
+	// Deny rejects matching requests before any lookup. When nil nothing is denied.
+	Deny *Expr
+}
+
+// Cacheable reports whether the cache policy allows storing r
+func (s Set) Cacheable(r *Request) bool {
+	return s.Cache == nil || s.Cache.Eval(r)
+}
+
+// Denied reports whether the deny policy rejects r
+func (s Set) Denied(r *Request) bool {
+	return s.Deny.Eval(r)
+}
+
+// CompileSet compiles the cache and deny expressions; empty sources leave
+// the corresponding policy unset
+func CompileSet(cacheSrc, denySrc string) (Set, error) {
+	var (
+		set Set
+		err error
+	)
+	if cacheSrc != "" {
+		if set.Cache, err = Compile(cacheSrc); err != nil {
+			return Set{}, err
+		}
+	}
+	if denySrc != "" {
+		if set.Deny, err = Compile(denySrc); err != nil {
+			return Set{}, err
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,81 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/policy"
+)
+
+func TestCompile_Eval(t *testing.T) {
+	tests := []struct {
+		expr string
+		req  policy.Request
+		want bool
+	}{
+		{"size < 10MB && prefix('public/')", policy.Request{Name: "public/a.png", Size: 1 << 20}, true},
+		{"size < 10MB && prefix('public/')", policy.Request{Name: "public/a.png", Size: 20 << 20}, false},
+		{"size < 10MB && prefix('public/')", policy.Request{Name: "private/a.png", Size: 1}, false},
+		{"ext == '.exe' || matches('^tmp/')", policy.Request{Name: "setup.EXE"}, true},
+		{"ext == '.exe' || matches('^tmp/')", policy.Request{Name: "tmp/x.txt"}, true},
+		{"ext == '.exe' || matches('^tmp/')", policy.Request{Name: "doc.txt"}, false},
+		{"!(suffix('.log') || contains('secret'))", policy.Request{Name: "app.txt"}, true},
+		{"!(suffix('.log') || contains('secret'))", policy.Request{Name: "my-secret.txt"}, false},
+		{"glob('reports/*.pdf') && method == \"GET\"", policy.Request{Name: "reports/q3.pdf", Method: "GET"}, true},
+		{"content_type != 'text/html' && size >= 512KB", policy.Request{ContentType: "image/png", Size: 512 << 10}, true},
+		{"true == (!false)", policy.Request{}, true},
+	}
+
+	for _, tc := range tests {
+		expr, err := policy.Compile(tc.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %v", tc.expr, err)
+		}
+		if got := expr.Eval(&tc.req); got != tc.want {
+			t.Errorf("%q with %+v: expected %v, got %v", tc.expr, tc.req, tc.want, got)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"size",
+		"size < 'big'",
+		"name < 'b'",
+		"unknown == 1",
+		"prefix(1)",
+		"nope('x')",
+		"matches('[')",
+		"size < 10XB",
+		"(size < 1",
+		"size < 1 size",
+		"'unterminated",
+		"size # 1",
+	} {
+		if _, err := policy.Compile(src); err == nil {
+			t.Errorf("Expected Compile(%q) to fail", src)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	var empty policy.Set
+	req := &policy.Request{Name: "a.txt", Size: 100}
+	if !empty.Cacheable(req) {
+		t.Error("Expected empty set to cache everything")
+	}
+	if empty.Denied(req) {
+		t.Error("Expected empty set to deny nothing")
+	}
+
+	set, err := policy.CompileSet("size < 50", "ext == '.txt'")
+	if err != nil {
+		t.Fatalf("CompileSet failed: %v", err)
+	}
+	if set.Cacheable(req) {
+		t.Error("Expected file above size limit to be uncacheable")
+	}
+	if !set.Denied(req) {
+		t.Error("Expected .txt to be denied")
+	}
+}
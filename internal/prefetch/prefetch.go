@@ -0,0 +1,291 @@
+// Package prefetch detects clients reading numbered files in order, such as
+// page-001.png then page-002.png, and loads the files that follow into the
+// cache before they are requested. Prefetches run in the background and are
+// dropped rather than queued when over budget.
+package prefetch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// maxSeries caps the numbered series tracked at once
+const maxSeries = 10000
+
+// maxDigits bounds the numbers recognized in keys so they fit in an int
+const maxDigits = 9
+
+// Config controls how far ahead files are loaded and how much load
+// prefetching may generate
+type Config struct {
+	// Depth is how many of the following files are loaded
+	Depth int
+	// Window is how soon after the previous file a request must come to
+	// count as reading in order
+	Window time.Duration
+	// MaxInFlight caps concurrent prefetches; 0 means no limit
+	MaxInFlight int
+	// MaxPerSecond caps the files prefetched per second; 0 means no limit
+	MaxPerSecond float64
+	// Timeout bounds each prefetch, which loads its files one after another
+	Timeout time.Duration
+	// Metrics records prefetched files; nil records nowhere
+	Metrics *metrics.Metrics
+}
+
+// FetchFunc loads key into the cache
+type FetchFunc func(ctx context.Context, key string) error
+
+// series identifies the keys that differ only in their last number
+type series struct {
+	prefix, suffix string
+}
+
+// key returns the series key for n, zero padded to width
+func (s series) key(n, width int) string {
+	return s.prefix + fmt.Sprintf("%0*d", width, n) + s.suffix
+}
+
+// seriesState is what is known about the reads of one series
+type seriesState struct {
+	last int
+	seen time.Time
+	// prefetched is the highest number loaded or being loaded
+	prefetched int
+}
+
+// Prefetcher watches the keys requested and prefetches the ones that
+// follow sequential reads. A nil Prefetcher does nothing.
+type Prefetcher struct {
+	cfg     Config
+	slots   chan struct{}
+	wg      sync.WaitGroup
+	metrics *metrics.Metrics
+
+	mu     sync.Mutex
+	series map[series]*seriesState
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// New creates a Prefetcher for cfg
+func New(cfg Config) (*Prefetcher, error) {
+	if cfg.Depth <= 0 {
+		return nil, fmt.Errorf("invalid prefetch depth %d: must be positive", cfg.Depth)
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Noop()
+	}
+
+	p := &Prefetcher{
+		cfg:     cfg,
+		metrics: cfg.Metrics,
+		rate:    cfg.MaxPerSecond,
+		tokens:  max(cfg.MaxPerSecond, 1),
+		now:     time.Now,
+		series:  make(map[series]*seriesState),
+	}
+	if cfg.MaxInFlight > 0 {
+		p.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	p.last = p.now()
+	return p, nil
+}
+
+// Observe records a request for key. When it follows the previous number of
+// its series, the next files are loaded with fetch in the background,
+// detached from ctx but keeping its values.
+func (p *Prefetcher) Observe(ctx context.Context, key string, fetch FetchFunc) {
+	if p == nil {
+		return
+	}
+	s, n, width, ok := parse(key)
+	if !ok {
+		return
+	}
+
+	from, to, ok := p.advance(s, n)
+	if !ok {
+		return
+	}
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			p.metrics.PrefetchRequestsTotal.WithLabelValues("dropped_inflight").Add(float64(to - from + 1))
+			p.rewind(s, to, from-1)
+			return
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.release()
+		p.run(ctx, s, from, to, width, fetch)
+	}()
+}
+
+// Wait blocks until all prefetches have finished
+func (p *Prefetcher) Wait() {
+	if p != nil {
+		p.wg.Wait()
+	}
+}
+
+// SetMaxPerSecond changes the cap on the files prefetched per second; 0
+// means no limit
+func (p *Prefetcher) SetMaxPerSecond(rate float64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rate = rate
+	p.tokens = min(p.tokens, max(rate, 1))
+}
+
+// advance records n as the latest read of s and returns the numbers to
+// prefetch, if any
+func (p *Prefetcher) advance(s series, n int) (from, to int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	state, exists := p.series[s]
+	if !exists {
+		if len(p.series) >= maxSeries {
+			p.sweepLocked(now)
+			if len(p.series) >= maxSeries {
+				return 0, 0, false
+			}
+		}
+		state = &seriesState{prefetched: n}
+		p.series[s] = state
+	}
+	sequential := exists && n == state.last+1 && now.Sub(state.seen) <= p.cfg.Window
+	state.last, state.seen = n, now
+	if !sequential {
+		return 0, 0, false
+	}
+
+	from, to = max(n+1, state.prefetched+1), n+p.cfg.Depth
+	if from > to {
+		return 0, 0, false
+	}
+	state.prefetched = to
+	return from, to, true
+}
+
+// rewind lets numbers after last be prefetched again, unless a later
+// prefetch has moved past to since
+func (p *Prefetcher) rewind(s series, to, last int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if state, ok := p.series[s]; ok && state.prefetched == to {
+		state.prefetched = last
+	}
+}
+
+// sweepLocked forgets series not read within the window
+func (p *Prefetcher) sweepLocked(now time.Time) {
+	for s, state := range p.series {
+		if now.Sub(state.seen) > p.cfg.Window {
+			delete(p.series, s)
+		}
+	}
+}
+
+// run loads from..to in order, stopping at the first failure as the series
+// has most likely ended
+func (p *Prefetcher) run(ctx context.Context, s series, from, to, width int, fetch FetchFunc) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	for n := from; n <= to; n++ {
+		if !p.allow() {
+			p.metrics.PrefetchRequestsTotal.WithLabelValues("dropped_rate").Add(float64(to - n + 1))
+			p.rewind(s, to, n-1)
+			return
+		}
+		key := s.key(n, width)
+		if err := fetch(ctx, key); err != nil {
+			slog.DebugContext(ctx, "Prefetch failed", "key", key, "error", err)
+			p.metrics.PrefetchRequestsTotal.WithLabelValues("error").Inc()
+			return
+		}
+		p.metrics.PrefetchRequestsTotal.WithLabelValues("ok").Inc()
+	}
+	slog.DebugContext(ctx, "Prefetched files", "from", s.key(from, width), "to", s.key(to, width))
+}
+
+// allow takes a token from the rate budget
+func (p *Prefetcher) allow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rate <= 0 {
+		return true
+	}
+
+	now := p.now()
+	p.tokens = min(p.tokens+now.Sub(p.last).Seconds()*p.rate, max(p.rate, 1))
+	p.last = now
+	if p.tokens < 1 {
+		return false
+	}
+	p.tokens--
+	return true
+}
+
+func (p *Prefetcher) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+// parse splits key around the last number in its final path segment.
+// width is the number's length when it is zero padded.
+func parse(key string) (s series, n, width int, ok bool) {
+	base := strings.LastIndexByte(key, '/') + 1
+	end := len(key)
+	for end > base && !isDigit(key[end-1]) {
+		end--
+	}
+	start := end
+	for start > base && isDigit(key[start-1]) {
+		start--
+	}
+	digits := key[start:end]
+	if digits == "" || len(digits) > maxDigits {
+		return series{}, 0, 0, false
+	}
+
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return series{}, 0, 0, false
+	}
+	if len(digits) > 1 && digits[0] == '0' {
+		width = len(digits)
+	}
+	return series{prefix: key[:start], suffix: key[end:]}, n, width, true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,174 @@
+package prefetch_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/prefetch"
+)
+
+// recorder is a FetchFunc that records the keys it is asked for
+type recorder struct {
+	mu      sync.Mutex
+	keys    []string
+	missing map[string]bool
+	release chan struct{}
+}
+
+func (r *recorder) fetch(ctx context.Context, key string) error {
+	r.mu.Lock()
+	r.keys = append(r.keys, key)
+	release := r.release
+	r.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	if r.missing[key] {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+func (r *recorder) fetched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.keys)
+}
+
+func newPrefetcher(t *testing.T, cfg prefetch.Config) *prefetch.Prefetcher {
+	t.Helper()
+	p, err := prefetch.New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return p
+}
+
+func TestPrefetcher_SequentialReads(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{
+			name: "zero padded",
+			keys: []string{"docs/a/page-008.png", "docs/a/page-009.png"},
+			want: []string{"docs/a/page-010.png", "docs/a/page-011.png"},
+		},
+		{
+			name: "unpadded",
+			keys: []string{"scan9.jpg", "scan10.jpg"},
+			want: []string{"scan11.jpg", "scan12.jpg"},
+		},
+		{
+			name: "sliding window",
+			keys: []string{"p1", "p2", "p3"},
+			want: []string{"p3", "p4", "p5"},
+		},
+		{
+			name: "single read",
+			keys: []string{"page-1.png"},
+		},
+		{
+			name: "out of order",
+			keys: []string{"page-1.png", "page-3.png", "page-2.png"},
+		},
+		{
+			name: "number outside the file name",
+			keys: []string{"v1/page.png", "v2/page.png"},
+		},
+		{
+			name: "different series",
+			keys: []string{"a/page-1.png", "b/page-2.png"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPrefetcher(t, prefetch.Config{Depth: 2})
+			rec := &recorder{}
+			for _, key := range tt.keys {
+				p.Observe(context.Background(), key, rec.fetch)
+				p.Wait()
+			}
+			if got := rec.fetched(); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v to be prefetched, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrefetcher_StopsAtMissingFile(t *testing.T) {
+	p := newPrefetcher(t, prefetch.Config{Depth: 4})
+	rec := &recorder{missing: map[string]bool{"page-4": true}}
+
+	p.Observe(context.Background(), "page-1", rec.fetch)
+	p.Observe(context.Background(), "page-2", rec.fetch)
+	p.Wait()
+
+	want := []string{"page-3", "page-4"}
+	if got := rec.fetched(); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestPrefetcher_Window(t *testing.T) {
+	p := newPrefetcher(t, prefetch.Config{Depth: 1, Window: 10 * time.Millisecond})
+	rec := &recorder{}
+
+	p.Observe(context.Background(), "page-1", rec.fetch)
+	time.Sleep(20 * time.Millisecond)
+	p.Observe(context.Background(), "page-2", rec.fetch)
+	p.Wait()
+
+	if got := rec.fetched(); len(got) != 0 {
+		t.Errorf("Expected reads further apart than the window to be ignored, got %v", got)
+	}
+}
+
+func TestPrefetcher_Budget(t *testing.T) {
+	t.Run("in flight", func(t *testing.T) {
+		p := newPrefetcher(t, prefetch.Config{Depth: 1, MaxInFlight: 1})
+		rec := &recorder{release: make(chan struct{})}
+
+		p.Observe(context.Background(), "a-1", rec.fetch)
+		p.Observe(context.Background(), "a-2", rec.fetch)
+		p.Observe(context.Background(), "b-1", rec.fetch)
+		p.Observe(context.Background(), "b-2", rec.fetch)
+		close(rec.release)
+		p.Wait()
+
+		if got := rec.fetched(); !slices.Equal(got, []string{"a-3"}) {
+			t.Errorf("Expected the second prefetch to be dropped, got %v", got)
+		}
+
+		// A dropped prefetch is retried on the next sequential read
+		p.Observe(context.Background(), "b-3", rec.fetch)
+		p.Wait()
+		if got := rec.fetched(); !slices.Equal(got, []string{"a-3", "b-4"}) {
+			t.Errorf("Expected b-4 after the retry, got %v", got)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		p := newPrefetcher(t, prefetch.Config{Depth: 5, MaxPerSecond: 2})
+		rec := &recorder{}
+
+		p.Observe(context.Background(), "page-1", rec.fetch)
+		p.Observe(context.Background(), "page-2", rec.fetch)
+		p.Wait()
+
+		if got := rec.fetched(); !slices.Equal(got, []string{"page-3", "page-4"}) {
+			t.Errorf("Expected the rate to cap prefetches at 2, got %v", got)
+		}
+	})
+}
+
+func TestNew_InvalidDepth(t *testing.T) {
+	if _, err := prefetch.New(prefetch.Config{}); err == nil {
+		t.Error("Expected an error for a zero depth")
+	}
+}
@@ -0,0 +1,258 @@
+// Package quota caps the bytes stored per tenant and key prefix. Usage is
+// kept up to date as objects are written and deleted through the service,
+// and reconciled with the bucket listing to pick up writes made around it.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// ErrExceeded is returned (wrapped) for writes that would take usage past
+// a quota
+var ErrExceeded = errors.New("storage quota exceeded")
+
+// Rule caps the bytes stored under Prefix by Tenant
+type Rule struct {
+	// Tenant is nil for the shared namespace of requests without a tenant
+	Tenant *tenant.Tenant
+	// Prefix is relative to the tenant's keys; empty covers all of them
+	Prefix string
+	Limit  int64
+}
+
+// tenantID labels the rule's metrics; empty for the shared namespace
+func (r Rule) tenantID() string {
+	if r.Tenant == nil {
+		return ""
+	}
+	return r.Tenant.ID
+}
+
+func (r Rule) String() string {
+	s := "shared namespace"
+	if r.Tenant != nil {
+		s = "tenant " + r.Tenant.ID
+	}
+	if r.Prefix != "" {
+		s += " prefix " + r.Prefix
+	}
+	return s
+}
+
+// Usage reports a rule's usage
+type Usage struct {
+	Tenant string `json:"tenant,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Used   int64  `json:"used_bytes"`
+	Limit  int64  `json:"limit_bytes"`
+}
+
+// Tracker keeps the usage of each rule
+type Tracker struct {
+	rules   []Rule
+	metrics *metrics.Metrics
+
+	mu   sync.Mutex
+	used []int64
+}
+
+// NewTracker returns a Tracker enforcing rules, reporting usage to m, which
+// may be nil. Usage starts at zero until the first reconciliation.
+func NewTracker(m *metrics.Metrics, rules ...Rule) (*Tracker, error) {
+	for _, r := range rules {
+		if r.Limit <= 0 {
+			return nil, fmt.Errorf("quota for %s must be positive", r)
+		}
+	}
+	if m == nil {
+		m = metrics.Noop()
+	}
+	t := &Tracker{rules: rules, metrics: m, used: make([]int64, len(rules))}
+	for _, r := range rules {
+		m.StorageQuotaLimitBytes.WithLabelValues(r.tenantID(), r.Prefix).Set(float64(r.Limit))
+	}
+	return t, nil
+}
+
+// matching returns the indexes of the rules covering key in ctx's tenant
+func (t *Tracker) matching(ctx context.Context, key string) []int {
+	owner, _ := tenant.FromContext(ctx)
+	var idx []int
+	for i, r := range t.rules {
+		if r.Tenant == owner && strings.HasPrefix(key, r.Prefix) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// Reserve adds delta bytes to the usage of key's rules, failing with
+// ErrExceeded without changing anything when that takes any of them past
+// its limit. Negative deltas always succeed.
+func (t *Tracker) Reserve(ctx context.Context, key string, delta int64) error {
+	idx := t.matching(ctx, key)
+	if len(idx) == 0 || delta == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if delta > 0 {
+		for _, i := range idx {
+			if t.used[i]+delta > t.rules[i].Limit {
+				t.metrics.StorageQuotaRejectionsTotal.WithLabelValues(t.rules[i].tenantID(), t.rules[i].Prefix).Inc()
+				return fmt.Errorf("%w: %s uses %d of %d bytes", ErrExceeded, t.rules[i], t.used[i], t.rules[i].Limit)
+			}
+		}
+	}
+	for _, i := range idx {
+		t.add(i, delta)
+	}
+	return nil
+}
+
+// Release subtracts bytes from the usage of key's rules
+func (t *Tracker) Release(ctx context.Context, key string, bytes int64) {
+	t.adjust(ctx, key, -bytes)
+}
+
+// adjust adds delta bytes to the usage of key's rules regardless of their
+// limits, for writes that already happened
+func (t *Tracker) adjust(ctx context.Context, key string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	idx := t.matching(ctx, key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, i := range idx {
+		t.add(i, delta)
+	}
+}
+
+// Check fails with ErrExceeded when any of key's rules has no room left
+func (t *Tracker) Check(ctx context.Context, key string) error {
+	idx := t.matching(ctx, key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, i := range idx {
+		if t.used[i] >= t.rules[i].Limit {
+			t.metrics.StorageQuotaRejectionsTotal.WithLabelValues(t.rules[i].tenantID(), t.rules[i].Prefix).Inc()
+			return fmt.Errorf("%w: %s uses %d of %d bytes", ErrExceeded, t.rules[i], t.used[i], t.rules[i].Limit)
+		}
+	}
+	return nil
+}
+
+// add changes the usage of rule i; t.mu must be held
+func (t *Tracker) add(i int, delta int64) {
+	t.used[i] = max(t.used[i]+delta, 0)
+	t.metrics.StorageQuotaUsedBytes.WithLabelValues(t.rules[i].tenantID(), t.rules[i].Prefix).Set(float64(t.used[i]))
+}
+
+// Usage reports the usage of every rule
+func (t *Tracker) Usage() []Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := make([]Usage, len(t.rules))
+	for i, r := range t.rules {
+		usage[i] = Usage{Tenant: r.tenantID(), Prefix: r.Prefix, Used: t.used[i], Limit: r.Limit}
+	}
+	return usage
+}
+
+// Reconcile recounts the usage of every rule from the listing of s.
+// Writes made while a rule is listed may be counted twice or not at all
+// until the next reconciliation.
+func (t *Tracker) Reconcile(ctx context.Context, s storage.Storage) error {
+	var errs []error
+	for i, r := range t.rules {
+		listCtx := ctx
+		if r.Tenant != nil {
+			listCtx = tenant.NewContext(ctx, r.Tenant)
+		}
+		total, err := listedBytes(listCtx, s, r.Prefix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r, err))
+			continue
+		}
+		t.mu.Lock()
+		drift := total - t.used[i]
+		t.add(i, drift)
+		t.mu.Unlock()
+		if drift != 0 {
+			slog.InfoContext(ctx, "Reconciled storage quota usage", "quota", r.String(), "used_bytes", total, "drift_bytes", drift)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listedBytes sums the sizes of the objects under prefix
+func listedBytes(ctx context.Context, s storage.Storage, prefix string) (int64, error) {
+	var total int64
+	token := ""
+	for {
+		page, err := s.ListObjects(ctx, prefix, token, 1000)
+		if err != nil {
+			return 0, err
+		}
+		for _, obj := range page.Objects {
+			total += obj.Size
+		}
+		if page.NextToken == "" {
+			return total, nil
+		}
+		token = page.NextToken
+	}
+}
+
+// ParseRules parses prefix=bytes pairs for the shared namespace, where a
+// prefix of * covers every key
+func ParseRules(pairs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(pairs))
+	for _, pair := range pairs {
+		prefix, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid quota %q: expected prefix=bytes", pair)
+		}
+		bytes, err := strconv.ParseInt(strings.TrimSpace(limit), 10, 64)
+		if err != nil || bytes <= 0 {
+			return nil, fmt.Errorf("invalid quota %q: limit must be a positive number of bytes", pair)
+		}
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "*" {
+			prefix = ""
+		}
+		rules = append(rules, Rule{Prefix: prefix, Limit: bytes})
+	}
+	return rules, nil
+}
+
+// TenantRules returns the quotas declared for tenants
+func TenantRules(tenants []*tenant.Tenant) []Rule {
+	var rules []Rule
+	for _, t := range tenants {
+		if t.QuotaBytes > 0 {
+			rules = append(rules, Rule{Tenant: t, Limit: t.QuotaBytes})
+		}
+		prefixes := make([]string, 0, len(t.PrefixQuotas))
+		for prefix := range t.PrefixQuotas {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			rules = append(rules, Rule{Tenant: t, Prefix: prefix, Limit: t.PrefixQuotas[prefix]})
+		}
+	}
+	return rules
+}
@@ -0,0 +1,114 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+func TestTracker_Reserve(t *testing.T) {
+	tracker, err := quota.NewTracker(nil,
+		quota.Rule{Limit: 100},
+		quota.Rule{Prefix: "uploads/", Limit: 10},
+	)
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := tracker.Reserve(ctx, "uploads/a.bin", 8); err != nil {
+		t.Fatalf("Expected 8 bytes to fit, got %v", err)
+	}
+	if err := tracker.Reserve(ctx, "uploads/b.bin", 4); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected the prefix quota to be exceeded, got %v", err)
+	}
+	if err := tracker.Reserve(ctx, "reports/q3.pdf", 92); err != nil {
+		t.Errorf("Expected keys outside the prefix to only count against the total, got %v", err)
+	}
+	if err := tracker.Check(ctx, "reports/q4.pdf"); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected a full total quota to fail the check, got %v", err)
+	}
+
+	tracker.Release(ctx, "uploads/a.bin", 8)
+	if err := tracker.Reserve(ctx, "uploads/b.bin", 9); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected the total quota to be exceeded, got %v", err)
+	}
+	if err := tracker.Reserve(ctx, "uploads/b.bin", 2); err != nil {
+		t.Errorf("Expected 2 bytes to fit after the release, got %v", err)
+	}
+
+	want := []quota.Usage{{Used: 94, Limit: 100}, {Prefix: "uploads/", Used: 2, Limit: 10}}
+	for i, got := range tracker.Usage() {
+		if got != want[i] {
+			t.Errorf("Expected usage %+v, got %+v", want[i], got)
+		}
+	}
+}
+
+func TestTracker_Tenants(t *testing.T) {
+	registry, err := tenant.New(
+		tenant.Tenant{ID: "alpha", Hosts: []string{"alpha.example.com"}, QuotaBytes: 10, PrefixQuotas: map[string]int64{"tmp/": 5}},
+		tenant.Tenant{ID: "beta", Hosts: []string{"beta.example.com"}},
+	)
+	if err != nil {
+		t.Fatalf("tenant.New failed: %v", err)
+	}
+	tracker, err := quota.NewTracker(nil, quota.TenantRules(registry.Tenants())...)
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+	alpha, _ := registry.ByHost("alpha.example.com")
+	beta, _ := registry.ByHost("beta.example.com")
+
+	if err := tracker.Reserve(tenant.NewContext(context.Background(), alpha), "tmp/a", 6); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected alpha's prefix quota to be exceeded, got %v", err)
+	}
+	if err := tracker.Reserve(tenant.NewContext(context.Background(), beta), "tmp/a", 1000); err != nil {
+		t.Errorf("Expected beta to have no quota, got %v", err)
+	}
+	if err := tracker.Reserve(context.Background(), "tmp/a", 1000); err != nil {
+		t.Errorf("Expected the shared namespace to have no quota, got %v", err)
+	}
+}
+
+func TestTracker_Reconcile(t *testing.T) {
+	s := mocks.NewMockStorage()
+	s.SetObject("uploads/a.bin", make([]byte, 7))
+	s.SetObject("uploads/b.bin", make([]byte, 5))
+	s.SetObject("reports/q3.pdf", make([]byte, 100))
+
+	tracker, err := quota.NewTracker(nil, quota.Rule{Prefix: "uploads/", Limit: 20})
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := tracker.Reserve(ctx, "uploads/c.bin", 3); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	if err := tracker.Reconcile(ctx, s); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if used := tracker.Usage()[0].Used; used != 12 {
+		t.Errorf("Expected usage recounted to 12 bytes, got %d", used)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := quota.ParseRules([]string{"*=1000", "uploads/=10"})
+	if err != nil {
+		t.Fatalf("ParseRules failed: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Prefix != "" || rules[0].Limit != 1000 || rules[1].Prefix != "uploads/" {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+
+	for _, pair := range []string{"uploads/", "uploads/=ten", "uploads/=0"} {
+		if _, err := quota.ParseRules([]string{pair}); err == nil {
+			t.Errorf("Expected an error for %q", pair)
+		}
+	}
+}
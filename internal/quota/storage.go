@@ -0,0 +1,181 @@
+package quota
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// Storage enforces a Tracker's quotas on the writes made through it. Reads
+// go straight to the wrapped backend.
+type Storage struct {
+	tenant.Backend
+	tracker *Tracker
+
+	mu sync.Mutex
+	// parts holds the bytes reserved for the parts of in-progress multipart
+	// uploads, by upload ID and part number
+	parts map[string]map[int32]int64
+}
+
+// Ensure Storage implements the storage interfaces
+var _ tenant.Backend = (*Storage)(nil)
+
+// NewStorage wraps backend with the quotas of tracker
+func NewStorage(backend tenant.Backend, tracker *Tracker) *Storage {
+	return &Storage{
+		Backend: backend,
+		tracker: tracker,
+		parts:   make(map[string]map[int32]int64),
+	}
+}
+
+// storedSize returns the size of the object at key, or 0 when there is none
+func (s *Storage) storedSize(ctx context.Context, key string) (int64, error) {
+	headers, err := s.Backend.StatObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	size, _ := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+	return size, nil
+}
+
+// PutObject stores data when the growth it causes fits the quotas of key
+func (s *Storage) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	if len(s.tracker.matching(ctx, key)) == 0 {
+		return s.Backend.PutObject(ctx, key, data, contentType)
+	}
+	var size int64
+	if sized, ok := data.(interface{ Len() int }); ok {
+		size = int64(sized.Len())
+	} else {
+		buf, err := io.ReadAll(data)
+		if err != nil {
+			return fmt.Errorf("failed to read object %s: %w", key, err)
+		}
+		size, data = int64(len(buf)), bytes.NewReader(buf)
+	}
+	old, err := s.storedSize(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.tracker.Reserve(ctx, key, size-old); err != nil {
+		return err
+	}
+	if err := s.Backend.PutObject(ctx, key, data, contentType); err != nil {
+		s.tracker.adjust(ctx, key, old-size)
+		return err
+	}
+	return nil
+}
+
+// DeleteObject deletes key, returning its bytes to the quotas
+func (s *Storage) DeleteObject(ctx context.Context, key string) error {
+	if len(s.tracker.matching(ctx, key)) == 0 {
+		return s.Backend.DeleteObject(ctx, key)
+	}
+	old, err := s.storedSize(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.Backend.DeleteObject(ctx, key); err != nil {
+		return err
+	}
+	s.tracker.Release(ctx, key, old)
+	return nil
+}
+
+// PresignPut authorizes a direct upload unless a quota of key is already
+// full. The upload's size isn't known, so it is counted at the next
+// reconciliation.
+func (s *Storage) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	if err := s.tracker.Check(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.Backend.PresignPut(ctx, key, contentType, metadata, ttl)
+}
+
+// CreateMultipartUpload starts an upload unless a quota of key is already
+// full
+func (s *Storage) CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	if err := s.tracker.Check(ctx, key); err != nil {
+		return "", err
+	}
+	return s.Backend.CreateMultipartUpload(ctx, key, contentType, metadata)
+}
+
+// UploadPart reserves the part's bytes before storing it. A part uploaded
+// again replaces the reservation of the previous attempt.
+func (s *Storage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (*storage.UploadedPart, error) {
+	s.mu.Lock()
+	previous := s.parts[uploadID][partNumber]
+	s.mu.Unlock()
+	if err := s.tracker.Reserve(ctx, key, size-previous); err != nil {
+		return nil, err
+	}
+	part, err := s.Backend.UploadPart(ctx, key, uploadID, partNumber, body, size)
+	if err != nil {
+		s.tracker.adjust(ctx, key, previous-size)
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.parts[uploadID] == nil {
+		s.parts[uploadID] = make(map[int32]int64)
+	}
+	s.parts[uploadID][partNumber] = size
+	s.mu.Unlock()
+	return part, nil
+}
+
+// CompleteMultipartUpload assembles the upload, replacing the reservations
+// of its parts with the size of the object and returning the bytes of the
+// object it overwrites
+func (s *Storage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.UploadedPart) error {
+	old, err := s.storedSize(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.Backend.CompleteMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		return err
+	}
+	var size int64
+	for _, part := range parts {
+		size += part.Size
+	}
+	reserved := s.forget(uploadID)
+	s.tracker.adjust(ctx, key, size-reserved-old)
+	return nil
+}
+
+// AbortMultipartUpload discards the upload and the reservations of its
+// parts
+func (s *Storage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	if err := s.Backend.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		return err
+	}
+	s.tracker.Release(ctx, key, s.forget(uploadID))
+	return nil
+}
+
+// forget drops the reservations of uploadID, returning their total
+func (s *Storage) forget(uploadID string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total int64
+	for _, size := range s.parts[uploadID] {
+		total += size
+	}
+	delete(s.parts, uploadID)
+	return total
+}
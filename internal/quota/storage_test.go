@@ -0,0 +1,94 @@
+package quota_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/quota"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+func newQuotaStorage(t *testing.T, limit int64) (*quota.Storage, *quota.Tracker, *mocks.MockStorage) {
+	t.Helper()
+	tracker, err := quota.NewTracker(nil, quota.Rule{Limit: limit})
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+	backend := mocks.NewMockStorage()
+	return quota.NewStorage(backend, tracker), tracker, backend
+}
+
+func TestStorage_PutAndDelete(t *testing.T) {
+	s, tracker, backend := newQuotaStorage(t, 10)
+	ctx := context.Background()
+
+	if err := s.PutObject(ctx, "a.txt", strings.NewReader("123456"), "text/plain"); err != nil {
+		t.Fatalf("Expected 6 bytes to fit, got %v", err)
+	}
+	err := s.PutObject(ctx, "b.txt", strings.NewReader("12345"), "text/plain")
+	if !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected the quota to be exceeded, got %v", err)
+	}
+	if exists, _ := backend.ObjectExists(ctx, "b.txt"); exists {
+		t.Error("Expected the rejected object not to be stored")
+	}
+
+	// Overwrites only count the growth
+	if err := s.PutObject(ctx, "a.txt", strings.NewReader("123456789"), "text/plain"); err != nil {
+		t.Errorf("Expected the overwrite to fit, got %v", err)
+	}
+	if used := tracker.Usage()[0].Used; used != 9 {
+		t.Errorf("Expected 9 bytes used, got %d", used)
+	}
+
+	if err := s.DeleteObject(ctx, "a.txt"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if used := tracker.Usage()[0].Used; used != 0 {
+		t.Errorf("Expected the delete to free the bytes, got %d used", used)
+	}
+}
+
+func TestStorage_Multipart(t *testing.T) {
+	s, tracker, _ := newQuotaStorage(t, 10)
+	ctx := context.Background()
+
+	uploadID, err := s.CreateMultipartUpload(ctx, "big.bin", "", nil)
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+	var parts []storage.UploadedPart
+	for i, size := range []int{4, 4} {
+		part, err := s.UploadPart(ctx, "big.bin", uploadID, int32(i+1), bytes.NewReader(make([]byte, size)), int64(size))
+		if err != nil {
+			t.Fatalf("UploadPart failed: %v", err)
+		}
+		parts = append(parts, *part)
+	}
+	if _, err := s.UploadPart(ctx, "big.bin", uploadID, 3, bytes.NewReader(make([]byte, 4)), 4); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected the third part to exceed the quota, got %v", err)
+	}
+	// Uploading a part again replaces its reservation
+	retried, err := s.UploadPart(ctx, "big.bin", uploadID, 2, bytes.NewReader(make([]byte, 6)), 6)
+	if err != nil {
+		t.Fatalf("Expected the retried part to fit, got %v", err)
+	}
+	parts[1] = *retried
+
+	if err := s.CompleteMultipartUpload(ctx, "big.bin", uploadID, parts); err != nil {
+		t.Fatalf("CompleteMultipartUpload failed: %v", err)
+	}
+	if used := tracker.Usage()[0].Used; used != 10 {
+		t.Errorf("Expected 10 bytes used, got %d", used)
+	}
+	if _, err := s.CreateMultipartUpload(ctx, "more.bin", "", nil); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected a full quota to refuse new uploads, got %v", err)
+	}
+	if _, err := s.PresignPut(ctx, "more.bin", "", nil, 0); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("Expected a full quota to refuse direct uploads, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package reload re-reads the configuration at runtime and applies the
+// settings that can change without a restart
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/config"
+)
+
+// ApplyFunc applies settings from a reloaded configuration
+type ApplyFunc func(cfg *config.Config) error
+
+type applier struct {
+	fields []string
+	apply  ApplyFunc
+}
+
+// Reloader loads the configuration on demand and hands changed settings to
+// the components that registered for them
+type Reloader struct {
+	load func() (*config.Config, error)
+
+	mu       sync.Mutex
+	current  *config.Config
+	appliers []applier
+}
+
+// New creates a Reloader for the running configuration, reloading it with
+// load
+func New(current *config.Config, load func() (*config.Config, error)) *Reloader {
+	return &Reloader{load: load, current: current}
+}
+
+// Register calls apply when any of fields, as named by config.Diff,
+// changes on reload
+func (r *Reloader) Register(apply ApplyFunc, fields ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, applier{fields: fields, apply: apply})
+}
+
+// Reload loads the configuration and applies the settings that changed,
+// logging each change. Changes no component applies are logged as needing
+// a restart. An invalid configuration is rejected as a whole.
+func (r *Reloader) Reload() ([]config.Change, error) {
+	cfg, err := r.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload configuration: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changes := config.Diff(r.current, cfg)
+	if len(changes) == 0 {
+		slog.Info("Configuration reloaded, nothing changed")
+		return nil, nil
+	}
+
+	applied := make(map[string]bool)
+	var errs []error
+	for _, a := range r.appliers {
+		if !slices.ContainsFunc(changes, func(c config.Change) bool { return slices.Contains(a.fields, c.Field) }) {
+			continue
+		}
+		if err := a.apply(cfg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, field := range a.fields {
+			applied[field] = true
+		}
+	}
+	for _, c := range changes {
+		if applied[c.Field] {
+			slog.Info("Configuration changed", "field", c.Field, "old", c.Old, "new", c.New)
+		} else {
+			slog.Warn("Configuration changed, restart to apply", "field", c.Field, "old", c.Old, "new", c.New)
+		}
+	}
+	r.current = cfg
+	return changes, errors.Join(errs...)
+}
+
+// Watch reloads on every signal received on signals, and when the file at
+// path changes, checked every interval; no path or interval disables the
+// check. It returns when ctx is canceled.
+func (r *Reloader) Watch(ctx context.Context, signals <-chan os.Signal, path string, interval time.Duration) {
+	var tick <-chan time.Time
+	if path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last := fileVersion(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			slog.Info("Reloading configuration", "signal", sig.String())
+		case <-tick:
+			version := fileVersion(path)
+			if version == last {
+				continue
+			}
+			last = version
+			slog.Info("Reloading configuration", "file", path)
+		}
+		if _, err := r.Reload(); err != nil {
+			slog.Error("Configuration reload failed", "error", err)
+		}
+	}
+}
+
+// version identifies the contents of a file without reading it
+type version struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileVersion(path string) version {
+	if path == "" {
+		return version{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return version{}
+	}
+	return version{modTime: info.ModTime(), size: info.Size()}
+}
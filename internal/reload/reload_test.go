@@ -0,0 +1,105 @@
+package reload_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/config"
+	"github.com/ch374n/file-downloader/internal/reload"
+)
+
+func TestReloader_Reload(t *testing.T) {
+	current := &config.Config{LogLevel: "info", Port: "8080"}
+	next := &config.Config{LogLevel: "debug", Port: "9090"}
+	reloader := reload.New(current, func() (*config.Config, error) { return next, nil })
+
+	var level, other string
+	reloader.Register(func(c *config.Config) error { level = c.LogLevel; return nil }, "LogLevel")
+	reloader.Register(func(c *config.Config) error { other = "called"; return nil }, "MaxResponseBytes")
+
+	changes, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Expected the reload to succeed, got %v", err)
+	}
+	if len(changes) != 2 || changes[0].Field != "Port" || changes[1].Field != "LogLevel" {
+		t.Errorf("Expected Port and LogLevel to change, got %+v", changes)
+	}
+	if level != "debug" {
+		t.Errorf("Expected the new log level to be applied, got %q", level)
+	}
+	if other != "" {
+		t.Error("Expected appliers of unchanged settings not to be called")
+	}
+
+	// Reloading the same configuration again changes nothing
+	if changes, _ := reloader.Reload(); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
+
+func TestReloader_RejectsInvalidConfig(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	reloader := reload.New(&config.Config{}, func() (*config.Config, error) { return nil, errInvalid })
+	called := false
+	reloader.Register(func(*config.Config) error { called = true; return nil }, "LogLevel")
+
+	if _, err := reloader.Reload(); !errors.Is(err, errInvalid) {
+		t.Errorf("Expected the load error, got %v", err)
+	}
+	if called {
+		t.Error("Expected nothing to be applied")
+	}
+}
+
+func TestReloader_WatchesFileAndSignals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("log_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var loads atomic.Int32
+	reloader := reload.New(&config.Config{}, func() (*config.Config, error) {
+		loads.Add(1)
+		return &config.Config{}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		reloader.Watch(ctx, signals, path, 5*time.Millisecond)
+		close(done)
+	}()
+
+	waitFor := func(n int32) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for loads.Load() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d reloads, got %d", n, loads.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	signals <- os.Interrupt
+	waitFor(1)
+
+	// Unchanged files aren't reloaded
+	time.Sleep(20 * time.Millisecond)
+	if got := loads.Load(); got != 1 {
+		t.Errorf("Expected no reload of an unchanged file, got %d", got)
+	}
+
+	if err := os.WriteFile(path, []byte("log_level: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(2)
+	cancel()
+	<-done
+}
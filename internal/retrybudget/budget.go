@@ -0,0 +1,99 @@
+// Package retrybudget bounds the retries a single request can trigger
+// across every backend it calls, so partial outages can't amplify one
+// request into many storage and cache calls
+package retrybudget
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// Retry kinds, used to label metrics
+const (
+	KindStorage = "storage"
+	KindCache   = "cache"
+)
+
+// ErrExhausted is returned (joined with the failure) when a call wasn't
+// retried because the request's budget was spent
+var ErrExhausted = errors.New("retry budget exhausted")
+
+// Config sets the budget given to each request
+type Config struct {
+	// Retries is the number of retries shared by all backend calls
+	Retries int
+	// Window is how long after the request starts retries may still begin;
+	// zero means no limit
+	Window time.Duration
+	// Metrics records refused retries; nil records nowhere
+	Metrics *metrics.Metrics
+}
+
+// Budget is a request's remaining retries. It is safe for concurrent use.
+type Budget struct {
+	remaining atomic.Int64
+	deadline  time.Time
+	metrics   *metrics.Metrics
+}
+
+// New creates a budget starting now
+func New(cfg Config) *Budget {
+	b := &Budget{metrics: cfg.Metrics}
+	if b.metrics == nil {
+		b.metrics = metrics.Noop()
+	}
+	b.remaining.Store(int64(max(cfg.Retries, 0)))
+	if cfg.Window > 0 {
+		b.deadline = time.Now().Add(cfg.Window)
+	}
+	return b
+}
+
+// Spend takes one retry of kind from the budget. It returns false, and
+// counts the refusal, when no retries are left or the window has passed.
+func (b *Budget) Spend(kind string) bool {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		b.metrics.RetryBudgetExhaustedTotal.WithLabelValues(kind).Inc()
+		return false
+	}
+	for {
+		n := b.remaining.Load()
+		if n <= 0 {
+			b.metrics.RetryBudgetExhaustedTotal.WithLabelValues(kind).Inc()
+			return false
+		}
+		if b.remaining.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// Remaining returns the number of retries left
+func (b *Budget) Remaining() int {
+	return int(b.remaining.Load())
+}
+
+type contextKey struct{}
+
+// WithBudget returns a context whose backend calls draw on b
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, contextKey{}, b)
+}
+
+// FromContext returns the budget stored in ctx, if any
+func FromContext(ctx context.Context) (*Budget, bool) {
+	b, ok := ctx.Value(contextKey{}).(*Budget)
+	return b, ok
+}
+
+// Allow spends a retry of kind from ctx's budget. Calls made outside a
+// request, such as cache warming, carry no budget and are always allowed;
+// their own retry limits still apply.
+func Allow(ctx context.Context, kind string) bool {
+	b, ok := FromContext(ctx)
+	return !ok || b.Spend(kind)
+}
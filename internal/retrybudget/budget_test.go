@@ -0,0 +1,73 @@
+package retrybudget_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+)
+
+func TestBudget_Spend(t *testing.T) {
+	b := retrybudget.New(retrybudget.Config{Retries: 2})
+
+	if !b.Spend(retrybudget.KindStorage) || !b.Spend(retrybudget.KindCache) {
+		t.Fatal("Expected the first two retries to be allowed")
+	}
+	if b.Spend(retrybudget.KindStorage) {
+		t.Error("Expected the third retry to be refused")
+	}
+	if b.Remaining() != 0 {
+		t.Errorf("Expected 0 retries remaining, got %d", b.Remaining())
+	}
+}
+
+func TestBudget_WindowExpired(t *testing.T) {
+	b := retrybudget.New(retrybudget.Config{Retries: 5, Window: time.Millisecond})
+	time.Sleep(5 * time.Millisecond)
+
+	if b.Spend(retrybudget.KindStorage) {
+		t.Error("Expected retries to be refused after the window")
+	}
+}
+
+func TestBudget_ConcurrentSpend(t *testing.T) {
+	b := retrybudget.New(retrybudget.Config{Retries: 10})
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Spend(retrybudget.KindCache) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("Expected exactly 10 retries to be allowed, got %d", allowed)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	if !retrybudget.Allow(context.Background(), retrybudget.KindStorage) {
+		t.Error("Expected calls without a budget to be allowed")
+	}
+
+	ctx := retrybudget.WithBudget(context.Background(), retrybudget.New(retrybudget.Config{Retries: 1}))
+	if !retrybudget.Allow(ctx, retrybudget.KindStorage) {
+		t.Error("Expected the first retry to be allowed")
+	}
+	if retrybudget.Allow(ctx, retrybudget.KindCache) {
+		t.Error("Expected the budget to be shared across kinds")
+	}
+}
@@ -0,0 +1,58 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/scheduler"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	base := time.Date(2024, 6, 14, 10, 30, 15, 0, time.UTC) // Friday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90m", base.Add(90 * time.Minute)},
+		{"@hourly", time.Date(2024, 6, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 6, 15, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 6, 14, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 6, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{"30 4 1,15 * *", time.Date(2024, 6, 15, 4, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := scheduler.ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule failed: %v", err)
+			}
+			if got := s.Next(base); !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"@every soon",
+		"@every -1m",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := scheduler.ParseSchedule(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
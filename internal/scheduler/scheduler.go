@@ -0,0 +1,235 @@
+// Package scheduler runs named background jobs on cron-style schedules
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobRunning   = errors.New("job is already running")
+	ErrDuplicateJob = errors.New("job already registered")
+	ErrNotStarted   = errors.New("scheduler is not running")
+	ErrNeverFires   = errors.New("schedule never fires")
+)
+
+// Job is a named unit of work run on a schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+// JobStatus describes a job's most recent and next run
+type JobStatus struct {
+	Name         string    `json:"name"`
+	Schedule     string    `json:"schedule"`
+	Running      bool      `json:"running"`
+	NextRun      time.Time `json:"next_run"`
+	LastRun      time.Time `json:"last_run,omitempty"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+type jobState struct {
+	job     Job
+	trigger chan struct{}
+
+	mu       sync.Mutex
+	running  bool
+	next     time.Time
+	lastRun  time.Time
+	lastTook time.Duration
+	lastErr  error
+}
+
+// Scheduler runs registered jobs until its context is canceled. A job never
+// overlaps with itself: a run that comes due while the previous one is still
+// going is skipped.
+type Scheduler struct {
+	mu   sync.RWMutex
+	jobs map[string]*jobState
+	ctx  context.Context
+	now  func() time.Time
+	// runs tracks job runs in progress, so Wait can outlast them
+	runs sync.WaitGroup
+
+	metrics *metrics.Metrics
+}
+
+// Option configures optional Scheduler behavior
+type Option func(*Scheduler)
+
+// WithMetrics sets the collectors job runs are recorded into
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Scheduler) {
+		s.metrics = m
+	}
+}
+
+// New creates an empty scheduler
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		jobs:    make(map[string]*jobState),
+		now:     time.Now,
+		metrics: metrics.Noop(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add registers a job. Jobs added after Start begin running immediately.
+func (s *Scheduler) Add(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.Name]; exists {
+		return ErrDuplicateJob
+	}
+	if job.Schedule.Next(s.now()).IsZero() {
+		return ErrNeverFires
+	}
+
+	state := &jobState{job: job, trigger: make(chan struct{}, 1)}
+	s.jobs[job.Name] = state
+	if s.ctx != nil {
+		go s.loop(s.ctx, state)
+	}
+	return nil
+}
+
+// Start runs every registered job on its schedule until ctx is canceled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx = ctx
+	for _, state := range s.jobs {
+		go s.loop(ctx, state)
+	}
+}
+
+// Trigger runs a job now, outside its schedule
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.RLock()
+	state, exists := s.jobs[name]
+	started := s.ctx != nil
+	s.mu.RUnlock()
+
+	if !exists {
+		return ErrJobNotFound
+	}
+	if !started {
+		return ErrNotStarted
+	}
+
+	state.mu.Lock()
+	running := state.running
+	state.mu.Unlock()
+	if running {
+		return ErrJobRunning
+	}
+
+	select {
+	case state.trigger <- struct{}{}:
+	default:
+		// A trigger is already pending
+	}
+	return nil
+}
+
+// Status returns the state of every job, sorted by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, state := range s.jobs {
+		state.mu.Lock()
+		status := JobStatus{
+			Name:     state.job.Name,
+			Schedule: state.job.Schedule.String(),
+			Running:  state.running,
+			NextRun:  state.next,
+			LastRun:  state.lastRun,
+		}
+		if !state.lastRun.IsZero() {
+			status.LastDuration = state.lastTook.String()
+		}
+		if state.lastErr != nil {
+			status.LastError = state.lastErr.Error()
+		}
+		state.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (s *Scheduler) loop(ctx context.Context, state *jobState) {
+	for {
+		next := state.job.Schedule.Next(s.now())
+		state.mu.Lock()
+		state.next = next
+		state.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-state.trigger:
+			timer.Stop()
+		}
+
+		s.run(ctx, state)
+	}
+}
+
+// Wait blocks until job runs in progress have finished. Cancel the context
+// passed to Start first, or new runs may keep starting.
+func (s *Scheduler) Wait() {
+	s.runs.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, state *jobState) {
+	s.runs.Add(1)
+	defer s.runs.Done()
+	name := state.job.Name
+
+	state.mu.Lock()
+	state.running = true
+	state.mu.Unlock()
+
+	slog.Info("Job started", "job", name)
+	start := time.Now()
+	err := state.job.Run(ctx)
+	took := time.Since(start)
+
+	state.mu.Lock()
+	state.running = false
+	state.lastRun = start
+	state.lastTook = took
+	state.lastErr = err
+	state.mu.Unlock()
+
+	result := "success"
+	if err != nil {
+		result = "error"
+		slog.Error("Job failed", "job", name, "duration_ms", took.Milliseconds(), "error", err)
+	} else {
+		slog.Info("Job finished", "job", name, "duration_ms", took.Milliseconds())
+	}
+	s.metrics.JobRunsTotal.WithLabelValues(name, result).Inc()
+	s.metrics.JobDuration.WithLabelValues(name).Observe(took.Seconds())
+}
@@ -0,0 +1,69 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/scheduler"
+)
+
+func TestScheduler_TriggerAndStatus(t *testing.T) {
+	daily, _ := scheduler.ParseSchedule("@daily")
+	ran := make(chan struct{}, 1)
+
+	s := scheduler.New()
+	err := s.Add(scheduler.Job{
+		Name:     "nightly",
+		Schedule: daily,
+		Run: func(context.Context) error {
+			ran <- struct{}{}
+			return errors.New("boom")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := s.Add(scheduler.Job{Name: "nightly", Schedule: daily}); !errors.Is(err, scheduler.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+	if err := s.Trigger("nightly"); !errors.Is(err, scheduler.ErrNotStarted) {
+		t.Errorf("Expected ErrNotStarted before Start, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	if err := s.Trigger("missing"); !errors.Is(err, scheduler.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if err := s.Trigger("nightly"); err != nil {
+		t.Fatalf("Trigger failed: %v", err)
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Expected triggered job to run")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		status := s.Status()
+		if len(status) != 1 {
+			t.Fatalf("Expected 1 job, got %d", len(status))
+		}
+		if status[0].LastError == "boom" {
+			if status[0].Schedule != "0 0 * * *" {
+				t.Errorf("Unexpected schedule %q", status[0].Schedule)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected last error to be recorded, got %+v", status[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,211 @@
+// Package scrub checks a random sample of cached files against storage and
+// evicts the entries that don't match, so a truncated or stale payload is
+// served until the next scrub rather than until it expires.
+package scrub
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/storage"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+// Reasons an entry fails its check, as reported by
+// cache_integrity_failures_total
+const (
+	// ReasonSize is a payload that isn't the size recorded with it or the
+	// size of the object in storage
+	ReasonSize = "size"
+	// ReasonDigest is a payload that doesn't hash to the ETag it was
+	// cached with
+	ReasonDigest = "digest"
+	// ReasonETag is an entry cached for a different version of the object
+	ReasonETag = "etag"
+	// ReasonMissing is an entry for an object no longer in storage
+	ReasonMissing = "missing"
+)
+
+// Config controls what a Scrubber checks
+type Config struct {
+	// Sample is the number of keys checked per run
+	Sample int
+	// Tenants maps namespaced cache keys back to their tenant; nil when
+	// there are no tenants
+	Tenants *tenant.Registry
+	// Skip leaves out keys whose objects may be missing from storage
+	// legitimately, such as files still served from a legacy origin
+	Skip func(name string) bool
+	// Metrics records checks and failures; nil records nowhere
+	Metrics *metrics.Metrics
+}
+
+// Result summarizes one run
+type Result struct {
+	Checked int
+	Evicted int
+}
+
+// Scrubber checks cached files against storage
+type Scrubber struct {
+	cache   cache.Cache
+	sampler cache.Sampler
+	entries cache.EntryCache
+	storage storage.HeaderStater
+	sample  int
+	tenants *tenant.Registry
+	skip    func(string) bool
+	metrics *metrics.Metrics
+}
+
+// New creates a Scrubber for c, which holds files under their raw cache
+// keys, checking them against s. It fails when c can't sample its keys or
+// doesn't keep the metadata needed to check entries.
+func New(c cache.Cache, s storage.HeaderStater, cfg Config) (*Scrubber, error) {
+	sampler, ok := c.(cache.Sampler)
+	if !ok {
+		return nil, fmt.Errorf("cache can't sample keys: %w", errors.ErrUnsupported)
+	}
+	entries, ok := c.(cache.EntryCache)
+	if !ok {
+		return nil, fmt.Errorf("cache doesn't keep entry metadata: %w", errors.ErrUnsupported)
+	}
+	if cfg.Sample <= 0 {
+		return nil, fmt.Errorf("invalid scrub sample %d: must be positive", cfg.Sample)
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.Noop()
+	}
+	return &Scrubber{
+		cache:   c,
+		sampler: sampler,
+		entries: entries,
+		storage: s,
+		sample:  cfg.Sample,
+		tenants: cfg.Tenants,
+		skip:    cfg.Skip,
+		metrics: cfg.Metrics,
+	}, nil
+}
+
+// Run checks a sample of cached files and evicts those failing their
+// check, along with their variants. Entries are left alone when storage
+// can't be reached.
+func (s *Scrubber) Run(ctx context.Context) (Result, error) {
+	keys, err := s.sampler.SampleKeys(ctx, s.sample)
+	if len(keys) == 0 && err != nil {
+		return Result{}, fmt.Errorf("failed to sample the cache: %w", err)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to sample part of the cache", "error", err)
+	}
+
+	var result Result
+	var errs []error
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		checked, reason, err := s.check(ctx, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		if !checked {
+			continue
+		}
+		result.Checked++
+		s.metrics.CacheIntegrityChecksTotal.Inc()
+		if reason == "" {
+			continue
+		}
+
+		s.metrics.CacheIntegrityFailuresTotal.WithLabelValues(reason).Inc()
+		slog.WarnContext(ctx, "Evicting cache entry that failed its integrity check", "key", key, "reason", reason)
+		if _, err := cache.PurgeKeys(ctx, s.cache, key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to evict %s: %w", key, err))
+			continue
+		}
+		result.Evicted++
+	}
+	return result, errors.Join(errs...)
+}
+
+// check returns why the entry for key should be evicted, or an empty reason
+// when it is intact. Derived keys and keys no longer cached aren't checked.
+func (s *Scrubber) check(ctx context.Context, key string) (bool, string, error) {
+	name := key
+	if s.tenants != nil {
+		if t, rest, ok := s.tenants.SplitCacheKey(key); ok {
+			ctx = tenant.NewContext(ctx, t)
+			name = rest
+		}
+	}
+	// Variants, blobs and index keys all contain '#', which file names can't
+	if strings.Contains(name, "#") || (s.skip != nil && s.skip(name)) {
+		return false, "", nil
+	}
+
+	entry, found, err := s.entries.GetEntry(ctx, key)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read entry: %w", err)
+	}
+	if !found {
+		return false, "", nil
+	}
+	if reason := checkPayload(entry); reason != "" {
+		return true, reason, nil
+	}
+
+	headers, err := s.storage.StatObject(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return true, ReasonMissing, nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to stat object: %w", err)
+	}
+	if size, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64); err == nil && size != int64(len(entry.Data)) {
+		return true, ReasonSize, nil
+	}
+	if etag := headers.Get("ETag"); etag != "" && entry.Meta.ETag != "" && etag != entry.Meta.ETag {
+		return true, ReasonETag, nil
+	}
+	return true, "", nil
+}
+
+// checkPayload compares an entry with the size and ETag it was cached with.
+// ETags that are a plain MD5 or SHA-256 of the content, as for objects
+// uploaded in one part or stored by content hash, are checked as digests.
+func checkPayload(entry *cache.Entry) string {
+	if entry.Meta.Size > 0 && entry.Meta.Size != int64(len(entry.Data)) {
+		return ReasonSize
+	}
+	etag := strings.Trim(entry.Meta.ETag, `"`)
+	if _, err := hex.DecodeString(etag); err != nil {
+		return ""
+	}
+	var sum []byte
+	switch len(etag) {
+	case 2 * md5.Size:
+		digest := md5.Sum(entry.Data)
+		sum = digest[:]
+	case 2 * sha256.Size:
+		digest := sha256.Sum256(entry.Data)
+		sum = digest[:]
+	default:
+		return ""
+	}
+	if !strings.EqualFold(hex.EncodeToString(sum), etag) {
+		return ReasonDigest
+	}
+	return ""
+}
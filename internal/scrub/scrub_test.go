@@ -0,0 +1,104 @@
+package scrub_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/scrub"
+)
+
+func etagOf(data string) string {
+	sum := md5.Sum([]byte(data))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func TestScrubber_Run(t *testing.T) {
+	c := mocks.NewMockCache()
+	s := mocks.NewMockStorage()
+	stored := func(name, data, etag string) {
+		s.SetObject(name, []byte(data))
+		s.SetObjectHeaders(name, http.Header{"Etag": []string{etag}})
+	}
+
+	stored("intact.txt", "intact", etagOf("intact"))
+	c.SetEntryData("intact.txt", []byte("intact"), cache.EntryMeta{ETag: etagOf("intact"), Size: 6})
+
+	stored("truncated.txt", "truncated payload", etagOf("truncated payload"))
+	c.SetEntryData("truncated.txt", []byte("trunc"), cache.EntryMeta{ETag: etagOf("truncated payload"), Size: 17})
+
+	stored("corrupt.txt", "corrupt", etagOf("corrupt"))
+	c.SetEntryData("corrupt.txt", []byte("c0rrupt"), cache.EntryMeta{ETag: etagOf("corrupt"), Size: 7})
+
+	stored("stale.txt", "new", `"v2"`)
+	c.SetEntryData("stale.txt", []byte("old"), cache.EntryMeta{ETag: `"v1"`, Size: 3})
+
+	c.SetEntryData("deleted.txt", []byte("gone"), cache.EntryMeta{Size: 4})
+	c.SetData(cache.VariantKey("deleted.txt", "gzip"), []byte("derived"))
+
+	scrubber, err := scrub.New(c, s, scrub.Config{Sample: 10})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	result, err := scrubber.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Checked != 5 || result.Evicted != 4 {
+		t.Errorf("Expected 5 files checked and 4 evicted, got %+v", result)
+	}
+
+	for _, key := range []string{"truncated.txt", "corrupt.txt", "stale.txt", "deleted.txt"} {
+		if _, found, _ := c.Get(context.Background(), key); found {
+			t.Errorf("Expected %s to be evicted", key)
+		}
+	}
+	if _, found, _ := c.Get(context.Background(), "intact.txt"); !found {
+		t.Error("Expected the intact entry to be kept")
+	}
+}
+
+func TestScrubber_StorageErrors(t *testing.T) {
+	c := mocks.NewMockCache()
+	s := mocks.NewMockStorage()
+	s.SetObject("a.txt", []byte("a"))
+	c.SetEntryData("a.txt", []byte("a"), cache.EntryMeta{Size: 1})
+	s.GetError = errors.New("storage unavailable")
+
+	scrubber, err := scrub.New(c, s, scrub.Config{Sample: 10})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	result, err := scrubber.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "storage unavailable") {
+		t.Errorf("Expected the storage error, got %v", err)
+	}
+	if result.Evicted != 0 {
+		t.Errorf("Expected nothing evicted while storage is down, got %+v", result)
+	}
+	if _, found, _ := c.Get(context.Background(), "a.txt"); !found {
+		t.Error("Expected the entry to be kept")
+	}
+}
+
+func TestScrubber_Skip(t *testing.T) {
+	c := mocks.NewMockCache()
+	c.SetEntryData("legacy/a.txt", []byte("a"), cache.EntryMeta{Size: 1})
+
+	scrubber, err := scrub.New(c, mocks.NewMockStorage(), scrub.Config{
+		Sample: 10,
+		Skip:   func(name string) bool { return strings.HasPrefix(name, "legacy/") },
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if result, err := scrubber.Run(context.Background()); err != nil || result.Checked != 0 {
+		t.Errorf("Expected skipped files to be left alone, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,262 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoActiveKey   = errors.New("no active signing key")
+	ErrKeyExists     = errors.New("signing key already exists")
+	ErrKeyNotFound   = errors.New("signing key not found")
+	ErrLastActiveKey = errors.New("cannot retire the last active signing key")
+)
+
+// Key is an HMAC signing secret identified by ID
+type Key struct {
+	ID        string
+	Secret    []byte
+	CreatedAt time.Time
+	// RetiredAt is set once the key stops being used for new signatures
+	RetiredAt time.Time
+	// ExpiresAt is when signatures made with a retired key stop verifying
+	ExpiresAt time.Time
+
+	// seq orders keys by when they were added to the ring
+	seq uint64
+}
+
+// Active reports whether the key may be used for new signatures
+func (k Key) Active() bool {
+	return k.RetiredAt.IsZero()
+}
+
+// validAt reports whether signatures made with the key still verify at t
+func (k Key) validAt(t time.Time) bool {
+	return k.ExpiresAt.IsZero() || t.Before(k.ExpiresAt)
+}
+
+// KeyInfo describes a key without exposing its secret
+type KeyInfo struct {
+	ID        string     `json:"id"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Keyring holds every signing key that is currently valid. New signatures
+// use the most recently added active key; verification accepts any key that
+// hasn't passed its expiry, so retiring a key leaves outstanding links
+// working for the overlap window.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+	seq  uint64
+	now  func() time.Time
+}
+
+// NewKeyring creates a keyring seeded with the given keys
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	k := &Keyring{
+		keys: make(map[string]*Key),
+		now:  time.Now,
+	}
+	for _, key := range keys {
+		if err := k.Add(key.ID, key.Secret); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ParseKeys parses a comma-separated list of id:secret pairs
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid signing key %q: expected id:secret", entry)
+		}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// GenerateSecret returns a random printable secret suitable for a signing
+// key, so it can be copied verbatim into SIGNING_KEYS on other replicas
+func GenerateSecret() ([]byte, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return []byte(base64.RawURLEncoding.EncodeToString(raw)), nil
+}
+
+// Add registers a new active key. It becomes the key used for new signatures.
+func (k *Keyring) Add(id string, secret []byte) error {
+	if id == "" || len(secret) == 0 {
+		return errors.New("signing key id and secret are required")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, exists := k.keys[id]; exists {
+		return fmt.Errorf("%w: %s", ErrKeyExists, id)
+	}
+	k.seq++
+	k.keys[id] = &Key{
+		ID:        id,
+		Secret:    secret,
+		CreatedAt: k.now(),
+		seq:       k.seq,
+	}
+	return nil
+}
+
+// Retire stops using a key for new signatures and lets existing signatures
+// verify for the given overlap window. A zero overlap invalidates it at once.
+func (k *Keyring) Retire(id string, overlap time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, exists := k.keys[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	if key.Active() && k.activeCountLocked() == 1 {
+		return ErrLastActiveKey
+	}
+
+	now := k.now()
+	if key.Active() {
+		key.RetiredAt = now
+	}
+	key.ExpiresAt = now.Add(overlap)
+	return nil
+}
+
+// Prune drops retired keys whose overlap window has passed
+func (k *Keyring) Prune() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	for id, key := range k.keys {
+		if !key.validAt(now) {
+			delete(k.keys, id)
+		}
+	}
+}
+
+// Sign returns the ID of the current signing key and the signature of payload
+func (k *Keyring) Sign(payload []byte) (string, string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var current *Key
+	for _, key := range k.keys {
+		if !key.Active() {
+			continue
+		}
+		if current == nil || key.seq > current.seq {
+			current = key
+		}
+	}
+	if current == nil {
+		return "", "", ErrNoActiveKey
+	}
+	return current.ID, sign(current.Secret, payload), nil
+}
+
+// Verify checks that sig is a valid signature of payload made with key id
+func (k *Keyring) Verify(id string, payload []byte, sig string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, exists := k.keys[id]
+	if !exists || !key.validAt(k.now()) {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(sign(key.Secret, payload)))
+}
+
+// Keys lists the keys in the ring in the order they were added
+func (k *Keyring) Keys() []KeyInfo {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	ordered := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		ordered = append(ordered, key)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].seq < ordered[j].seq })
+
+	infos := make([]KeyInfo, 0, len(ordered))
+	for _, key := range ordered {
+		info := KeyInfo{
+			ID:        key.ID,
+			Active:    key.Active(),
+			CreatedAt: key.CreatedAt,
+		}
+		if !key.RetiredAt.IsZero() {
+			retired := key.RetiredAt
+			info.RetiredAt = &retired
+		}
+		if !key.ExpiresAt.IsZero() {
+			expires := key.ExpiresAt
+			info.ExpiresAt = &expires
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// VerifyAny checks that sig is a valid signature of payload made with any
+// key that still verifies, for signatures that don't name their key. Every
+// key is checked, so the time taken doesn't tell which one matched.
+func (k *Keyring) VerifyAny(payload []byte, sig string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	valid := false
+	for _, key := range k.keys {
+		if !key.validAt(now) {
+			continue
+		}
+		if hmac.Equal([]byte(sig), []byte(sign(key.Secret, payload))) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func (k *Keyring) activeCountLocked() int {
+	n := 0
+	for _, key := range k.keys {
+		if key.Active() {
+			n++
+		}
+	}
+	return n
+}
+
+func sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package signing_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+func TestKeyring_SignUsesNewestActiveKey(t *testing.T) {
+	keys, err := signing.ParseKeys("old:secret1, new:secret2")
+	if err != nil {
+		t.Fatalf("ParseKeys failed: %v", err)
+	}
+	keyring, err := signing.NewKeyring(keys...)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	id, sig, err := keyring.Sign([]byte("payload"))
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if id != "new" {
+		t.Errorf("Expected key 'new', got '%s'", id)
+	}
+	if !keyring.Verify(id, []byte("payload"), sig) {
+		t.Error("Expected signature to verify")
+	}
+	if keyring.Verify(id, []byte("tampered"), sig) {
+		t.Error("Expected tampered payload to fail verification")
+	}
+	if keyring.Verify("old", []byte("payload"), sig) {
+		t.Error("Expected signature to fail with a different key")
+	}
+}
+
+func TestKeyring_RetireWithOverlap(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("s1")})
+	_, oldSig, _ := keyring.Sign([]byte("link"))
+
+	if err := keyring.Add("k2", []byte("s2")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := keyring.Retire("k1", time.Hour); err != nil {
+		t.Fatalf("Retire failed: %v", err)
+	}
+
+	// Outstanding signatures keep working during the overlap window
+	if !keyring.Verify("k1", []byte("link"), oldSig) {
+		t.Error("Expected retired key to verify during overlap")
+	}
+
+	id, _, _ := keyring.Sign([]byte("link"))
+	if id != "k2" {
+		t.Errorf("Expected new signatures to use 'k2', got '%s'", id)
+	}
+
+	// A zero overlap invalidates immediately
+	if err := keyring.Retire("k1", 0); err != nil {
+		t.Fatalf("Retire failed: %v", err)
+	}
+	if keyring.Verify("k1", []byte("link"), oldSig) {
+		t.Error("Expected retired key to stop verifying after overlap")
+	}
+
+	keyring.Prune()
+	if n := len(keyring.Keys()); n != 1 {
+		t.Errorf("Expected 1 key after prune, got %d", n)
+	}
+}
+
+func TestKeyring_Errors(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "only", Secret: []byte("s")})
+
+	if err := keyring.Retire("only", time.Hour); !errors.Is(err, signing.ErrLastActiveKey) {
+		t.Errorf("Expected ErrLastActiveKey, got %v", err)
+	}
+	if err := keyring.Retire("missing", time.Hour); !errors.Is(err, signing.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if err := keyring.Add("only", []byte("s")); !errors.Is(err, signing.ErrKeyExists) {
+		t.Errorf("Expected ErrKeyExists, got %v", err)
+	}
+
+	empty, _ := signing.NewKeyring()
+	if _, _, err := empty.Sign([]byte("x")); !errors.Is(err, signing.ErrNoActiveKey) {
+		t.Errorf("Expected ErrNoActiveKey, got %v", err)
+	}
+
+	if _, err := signing.ParseKeys("missing-secret"); err == nil {
+		t.Error("Expected error for malformed key spec")
+	}
+}
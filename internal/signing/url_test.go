@@ -0,0 +1,119 @@
+package signing_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/signing"
+)
+
+func TestKeyring_SignAndVerifyURL(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("s1")})
+
+	query, err := keyring.SignURL("/files/a.txt", []string{"get", "GET", "head"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("SignURL failed: %v", err)
+	}
+	if got := query.Get(signing.ParamMethods); got != "GET,HEAD" {
+		t.Errorf("Expected normalized methods GET,HEAD, got %q", got)
+	}
+
+	if err := keyring.VerifyURL("GET", "/files/a.txt", query); err != nil {
+		t.Errorf("Expected GET to verify, got %v", err)
+	}
+	if err := keyring.VerifyURL("HEAD", "/files/a.txt", query); err != nil {
+		t.Errorf("Expected HEAD to verify, got %v", err)
+	}
+	if err := keyring.VerifyURL("POST", "/files/a.txt", query); !errors.Is(err, signing.ErrMethodNotAllowed) {
+		t.Errorf("Expected ErrMethodNotAllowed, got %v", err)
+	}
+	if err := keyring.VerifyURL("GET", "/files/b.txt", query); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another path, got %v", err)
+	}
+
+	tampered := query
+	tampered.Set(signing.ParamExpires, "9999999999")
+	if err := keyring.VerifyURL("GET", "/files/a.txt", tampered); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for tampered expiry, got %v", err)
+	}
+}
+
+func TestKeyring_VerifyURLExpired(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("s1")})
+
+	query, err := keyring.SignURL("/files/a.txt", []string{"GET"}, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("SignURL failed: %v", err)
+	}
+	if err := keyring.VerifyURL("GET", "/files/a.txt", query); !errors.Is(err, signing.ErrURLExpired) {
+		t.Errorf("Expected ErrURLExpired, got %v", err)
+	}
+}
+
+// TestKeyring_VerifyURLExternal signs a URL the way the README tells
+// backends to, so the documented format keeps verifying
+func TestKeyring_VerifyURLExternal(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("s1")})
+	exp := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte("s1"))
+	mac.Write([]byte("/files/private/report%20v2.pdf\nGET,HEAD\n" + exp))
+	query := url.Values{
+		signing.ParamExpires:   {exp},
+		signing.ParamMethods:   {"GET,HEAD"},
+		signing.ParamKeyID:     {"k1"},
+		signing.ParamSignature: {base64.RawURLEncoding.EncodeToString(mac.Sum(nil))},
+	}
+	if err := keyring.VerifyURL("GET", "/files/private/report%20v2.pdf", query); err != nil {
+		t.Errorf("Expected an externally signed URL to verify, got %v", err)
+	}
+}
+
+// TestKeyring_VerifyURLShortForm checks links signed with exp and without
+// methods or kid, as the README allows
+func TestKeyring_VerifyURLShortForm(t *testing.T) {
+	keyring, _ := signing.NewKeyring(signing.Key{ID: "k1", Secret: []byte("s1")})
+	exp := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte("s1"))
+	mac.Write([]byte("/files/private/a.pdf\nGET,HEAD\n" + exp))
+	query := url.Values{
+		signing.ParamExp:       {exp},
+		signing.ParamSignature: {base64.RawURLEncoding.EncodeToString(mac.Sum(nil))},
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		if err := keyring.VerifyURL(method, "/files/private/a.pdf", query); err != nil {
+			t.Errorf("Expected %s to verify, got %v", method, err)
+		}
+	}
+	if err := keyring.VerifyURL("PUT", "/files/private/a.pdf", query); !errors.Is(err, signing.ErrMethodNotAllowed) {
+		t.Errorf("Expected ErrMethodNotAllowed, got %v", err)
+	}
+
+	// Links without kid keep verifying across rotation, until their key's
+	// overlap window ends
+	if err := keyring.Add("k2", []byte("s2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.VerifyURL("GET", "/files/private/a.pdf", query); err != nil {
+		t.Errorf("Expected the link to verify after a second key was added, got %v", err)
+	}
+	if err := keyring.Retire("k1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.VerifyURL("GET", "/files/private/a.pdf", query); err != nil {
+		t.Errorf("Expected the link to verify while its key overlaps, got %v", err)
+	}
+	if err := keyring.Retire("k1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.VerifyURL("GET", "/files/private/a.pdf", query); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature once its key expired, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package sigv4
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxChunkHeader bounds the size line of an aws-chunked chunk
+const maxChunkHeader = 4096
+
+var errChunkFormat = errors.New("malformed aws-chunked body")
+
+// IsChunked reports whether r streams its payload in the aws-chunked
+// encoding, as SDKs do for uploads signed chunk by chunk or followed by a
+// checksum trailer
+func IsChunked(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get(HeaderContentSHA256), "STREAMING-")
+}
+
+// chunkedReader decodes an aws-chunked body: chunks of
+// "size[;chunk-signature=sig]\r\n data \r\n", ending with a zero-sized
+// chunk and optional trailers
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+	err       error
+}
+
+// NewChunkedReader decodes the aws-chunked body r. Chunk signatures and
+// trailing checksums are skipped rather than verified; the request itself
+// must still pass Verify.
+func NewChunkedReader(r io.Reader) io.Reader {
+	return &chunkedReader{r: bufio.NewReader(r)}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+
+	n, err := c.r.Read(p[:min(int64(len(p)), c.remaining)])
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		err = c.expectCRLF()
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads the size line of the next chunk. After the last chunk
+// the trailers are consumed and io.EOF is returned.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, _, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeHex), 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("%w: invalid chunk size %q", errChunkFormat, sizeHex)
+	}
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+
+	// Trailers end with an empty line, or with the body for clients that
+	// omit it
+	for {
+		line, err := c.readLine()
+		if errors.Is(err, io.ErrUnexpectedEOF) || (err == nil && line == "") {
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := c.r.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > maxChunkHeader {
+			return "", fmt.Errorf("%w: line too long", errChunkFormat)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+func (c *chunkedReader) expectCRLF() error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(c.r, crlf[:]); err != nil {
+		return err
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return fmt.Errorf("%w: chunk not followed by CRLF", errChunkFormat)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package sigv4_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	"github.com/ch374n/file-downloader/internal/sigv4"
+)
+
+var secrets = map[string]string{"reader": "reader-secret"}
+
+func lookup(accessKey string) (string, bool) {
+	secret, ok := secrets[accessKey]
+	return secret, ok
+}
+
+func payloadHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// signedRequest signs a request the way the AWS SDK's S3 client does
+func signedRequest(t *testing.T, method, target, body, accessKey, secret string, at time.Time) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	hash := payloadHash(body)
+	r.Header.Set(sigv4.HeaderContentSHA256, hash)
+
+	signer := v4.NewSigner(func(o *v4.SignerOptions) {
+		o.DisableURIPathEscaping = true
+	})
+	creds := aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secret}
+	if err := signer.SignHTTP(context.Background(), creds, r, hash, "s3", "auto", at); err != nil {
+		t.Fatalf("SignHTTP failed: %v", err)
+	}
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	verifier := sigv4.NewVerifier(lookup)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		wantErr error
+	}{
+		{
+			name: "signed",
+			request: func() *http.Request {
+				return signedRequest(t, http.MethodGet, "http://files.example/bucket/docs/a%20b%2Bc.txt?list-type=2&prefix=x%2Fy", "", "reader", "reader-secret", now)
+			},
+		},
+		{
+			name: "signed payload",
+			request: func() *http.Request {
+				return signedRequest(t, http.MethodPut, "http://files.example/bucket/new.txt", "content", "reader", "reader-secret", now)
+			},
+		},
+		{
+			name: "unsigned",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "http://files.example/bucket/a", nil)
+			},
+			wantErr: sigv4.ErrMissingAuth,
+		},
+		{
+			name: "wrong secret",
+			request: func() *http.Request {
+				return signedRequest(t, http.MethodGet, "http://files.example/bucket/a", "", "reader", "guess", now)
+			},
+			wantErr: sigv4.ErrSignatureMismatch,
+		},
+		{
+			name: "unknown key",
+			request: func() *http.Request {
+				return signedRequest(t, http.MethodGet, "http://files.example/bucket/a", "", "nobody", "reader-secret", now)
+			},
+			wantErr: sigv4.ErrUnknownKey,
+		},
+		{
+			name: "tampered query",
+			request: func() *http.Request {
+				r := signedRequest(t, http.MethodGet, "http://files.example/bucket?prefix=public/", "", "reader", "reader-secret", now)
+				r.URL.RawQuery = "prefix=private/"
+				return r
+			},
+			wantErr: sigv4.ErrSignatureMismatch,
+		},
+		{
+			name: "stale",
+			request: func() *http.Request {
+				return signedRequest(t, http.MethodGet, "http://files.example/bucket/a", "", "reader", "reader-secret", now.Add(-time.Hour))
+			},
+			wantErr: sigv4.ErrSkewed,
+		},
+		{
+			name: "other scheme",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "http://files.example/bucket/a", nil)
+				r.Header.Set("Authorization", "AWS reader:signature")
+				return r
+			},
+			wantErr: sigv4.ErrMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := verifier.Verify(tt.request())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && key != "reader" {
+				t.Errorf("Expected access key reader, got %q", key)
+			}
+		})
+	}
+}
+
+func TestVerifyPayload(t *testing.T) {
+	r := signedRequest(t, http.MethodPut, "http://files.example/bucket/new.txt", "content", "reader", "reader-secret", time.Now())
+
+	if err := sigv4.VerifyPayload(r, []byte("content")); err != nil {
+		t.Errorf("Expected the signed payload to verify, got %v", err)
+	}
+	if err := sigv4.VerifyPayload(r, []byte("tampered")); !errors.Is(err, sigv4.ErrPayloadMismatch) {
+		t.Errorf("Expected ErrPayloadMismatch, got %v", err)
+	}
+
+	r.Header.Set(sigv4.HeaderContentSHA256, "UNSIGNED-PAYLOAD")
+	if err := sigv4.VerifyPayload(r, []byte("anything")); err != nil {
+		t.Errorf("Expected unsigned payloads to pass, got %v", err)
+	}
+}
+
+func TestChunkedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "signed chunks",
+			body: "5;chunk-signature=aa\r\nhello\r\n6;chunk-signature=bb\r\n world\r\n0;chunk-signature=cc\r\n\r\n",
+			want: "hello world",
+		},
+		{
+			name: "checksum trailer",
+			body: "b\r\nhello world\r\n0\r\nx-amz-checksum-crc32:DUoRhQ==\r\n\r\n",
+			want: "hello world",
+		},
+		{
+			name: "trailer without final line",
+			body: "2\r\nhi\r\n0\r\nx-amz-checksum-crc32:AAAAAA==\r\n",
+			want: "hi",
+		},
+		{
+			name:    "truncated",
+			body:    "a\r\nhello",
+			wantErr: true,
+		},
+		{
+			name:    "bad size",
+			body:    "zz\r\nhello\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing CRLF",
+			body:    "2\r\nhiXX0\r\n\r\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(sigv4.NewChunkedReader(strings.NewReader(tt.body)))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Expected %q, got %q (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
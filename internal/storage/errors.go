@@ -0,0 +1,12 @@
+package storage
+
+import "errors"
+
+// Sentinel errors returned (wrapped) by Storage implementations. Callers
+// should test for them with errors.Is instead of matching error text.
+var (
+	ErrNotFound     = errors.New("object not found")
+	ErrAccessDenied = errors.New("access denied")
+	ErrTimeout      = errors.New("storage timeout")
+	ErrInvalidPart  = errors.New("invalid upload part")
+)
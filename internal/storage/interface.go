@@ -3,8 +3,24 @@ package storage
 import (
 	"context"
 	"io"
+	"net/http"
+	"time"
 )
 
+// ObjectInfo describes a stored object without its content
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListResult is one page of a prefix listing
+type ListResult struct {
+	Objects []ObjectInfo
+	// NextToken continues the listing; empty when there are no more pages
+	NextToken string
+}
+
 // Storage defines the interface for object storage operations
 // This allows for easy mocking in tests
 type Storage interface {
@@ -12,8 +28,57 @@ type Storage interface {
 	PutObject(ctx context.Context, key string, data io.Reader, contentType string) error
 	DeleteObject(ctx context.Context, key string) error
 	ObjectExists(ctx context.Context, key string) (bool, error)
+	ListObjects(ctx context.Context, prefix, continuationToken string, limit int) (*ListResult, error)
 	HealthCheck(ctx context.Context) error
 }
 
+// PresignedRequest is a pre-authorized request a client can send directly
+// to the storage backend
+type PresignedRequest struct {
+	URL    string
+	Method string
+	// Headers are sent along with the request
+	Headers   http.Header
+	ExpiresAt time.Time
+}
+
+// UploadPresigner is implemented by backends that can authorize direct
+// client uploads. Metadata is stored with the object as user metadata.
+type UploadPresigner interface {
+	PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*PresignedRequest, error)
+}
+
+// HeaderGetter is implemented by backends that return the headers stored
+// with an object: Content-Language, Content-Encoding, Cache-Control and the
+// like, plus user metadata as X-Amz-Meta-* headers
+type HeaderGetter interface {
+	GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error)
+}
+
+// HeaderStater is implemented by backends that can return an object's
+// headers without its content, so cached copies can be revalidated cheaply
+type HeaderStater interface {
+	StatObject(ctx context.Context, key string) (http.Header, error)
+}
+
+// RangeGetter is implemented by backends that can read part of an object,
+// so large files are never loaded whole. It reads length bytes from offset,
+// fewer at the end of the object, and returns the object's headers with its
+// whole size as Content-Length.
+type RangeGetter interface {
+	GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error)
+}
+
+// MetadataPutter is implemented by backends that can store user metadata
+// with objects written through the service
+type MetadataPutter interface {
+	PutObjectWithMetadata(ctx context.Context, key string, data io.Reader, contentType string, metadata map[string]string) error
+}
+
 // Ensure R2Client implements Storage interface
 var _ Storage = (*R2Client)(nil)
+var _ UploadPresigner = (*R2Client)(nil)
+var _ HeaderGetter = (*R2Client)(nil)
+var _ HeaderStater = (*R2Client)(nil)
+var _ RangeGetter = (*R2Client)(nil)
+var _ MetadataPutter = (*R2Client)(nil)
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MinPartSize is the smallest part S3-compatible backends accept, except
+// for the final part of an upload
+const MinPartSize = 5 * 1024 * 1024
+
+// UploadedPart describes a part stored for an in-progress multipart upload
+type UploadedPart struct {
+	Number       int32     `json:"part"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// MultipartUploader is implemented by backends that support resumable
+// uploads assembled from independently uploaded parts
+type MultipartUploader interface {
+	// CreateMultipartUpload starts an upload; metadata is stored with the
+	// object as user metadata
+	CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (*UploadedPart, error)
+	// ListParts returns the parts stored so far, ordered by part number
+	ListParts(ctx context.Context, key, uploadID string) ([]UploadedPart, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+var _ MultipartUploader = (*R2Client)(nil)
+
+func (r *R2Client) CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(r.bucketName),
+		Key:      aws.String(key),
+		Metadata: metadata,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	output, err := r.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload for %s: %w", key, mapError(err))
+	}
+	return aws.ToString(output.UploadId), nil
+}
+
+func (r *R2Client) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (*UploadedPart, error) {
+	output, err := r.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(r.bucketName),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part %d of %s: %w", partNumber, key, mapError(err))
+	}
+	return &UploadedPart{
+		Number: partNumber,
+		ETag:   aws.ToString(output.ETag),
+		Size:   size,
+	}, nil
+}
+
+func (r *R2Client) ListParts(ctx context.Context, key, uploadID string) ([]UploadedPart, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var parts []UploadedPart
+	paginator := s3.NewListPartsPaginator(r.client, &s3.ListPartsInput{
+		Bucket:   aws.String(r.bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts of %s: %w", key, mapError(err))
+		}
+		for _, p := range page.Parts {
+			parts = append(parts, UploadedPart{
+				Number:       aws.ToInt32(p.PartNumber),
+				ETag:         aws.ToString(p.ETag),
+				Size:         aws.ToInt64(p.Size),
+				LastModified: aws.ToTime(p.LastModified),
+			})
+		}
+	}
+	return parts, nil
+}
+
+func (r *R2Client) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(p.Number),
+			ETag:       aws.String(p.ETag),
+		})
+	}
+
+	_, err := r.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(r.bucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload of %s: %w", key, mapError(err))
+	}
+	return nil
+}
+
+func (r *R2Client) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(r.bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload of %s: %w", key, mapError(err))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ParallelConfig splits reads of large objects into ranges fetched at the
+// same time, which a single connection can't match on fast links
+type ParallelConfig struct {
+	// Threshold is the size above which objects are read in parts; zero
+	// reads every object with a single request
+	Threshold int64
+	// PartSize is the size of the parts read after the first Threshold
+	// bytes
+	PartSize int64
+	// Concurrency caps the parts of one object read at the same time
+	Concurrency int
+}
+
+// SetParallelDownload reads objects larger than cfg.Threshold in parts. It
+// must be called before r is used.
+func (r *R2Client) SetParallelDownload(cfg ParallelConfig) {
+	r.parallel = cfg
+}
+
+// getObjectParallel reads an object's first Threshold bytes, and when it is
+// larger, the rest in parts fetched Concurrency at a time. Parts are read
+// with If-Match on the first response's ETag, so an object replaced midway
+// is read again whole instead of stitched from two versions.
+//
+// Each request has its own storage timeout, so a large object isn't cut off
+// partway through; the whole read is bounded by ctx, the request's deadline.
+func (r *R2Client) getObjectParallel(ctx context.Context, key string) ([]byte, http.Header, error) {
+	headCtx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	output, err := r.client.GetObject(headCtx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange(0, r.parallel.Threshold)),
+	})
+	if isErrorCode(err, "InvalidRange", http.StatusRequestedRangeNotSatisfiable) {
+		// Empty objects have no range to read
+		return r.getObject(ctx, key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object %s: %w", key, mapError(err))
+	}
+	defer output.Body.Close()
+
+	headers := getObjectHeaders(output)
+	size, ok := rangeSize(output.ContentRange)
+	if !ok || size <= r.parallel.Threshold {
+		data, err := io.ReadAll(output.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read object body: %w", err)
+		}
+		return data, headers, nil
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(output.Body, data[:r.parallel.Threshold]); err != nil {
+		return nil, nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	err = r.readParts(ctx, key, aws.ToString(output.ETag), data)
+	if isErrorCode(err, "PreconditionFailed", http.StatusPreconditionFailed) {
+		return r.getObject(ctx, key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, headers, nil
+}
+
+// readParts fills data past its first Threshold bytes with parts of the
+// object, stopping at the first part that fails
+func (r *R2Client) readParts(ctx context.Context, key, etag string, data []byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, max(r.parallel.Concurrency, 1))
+		mu       sync.Mutex
+		firstErr error
+	)
+	size, partSize := int64(len(data)), max(r.parallel.PartSize, 1)
+	for offset := r.parallel.Threshold; offset < size; offset += partSize {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := r.readPart(ctx, key, etag, offset, data[offset:min(offset+partSize, size)])
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// readPart reads len(part) bytes of the object from offset into part
+func (r *R2Client) readPart(ctx context.Context, key, etag string, offset int64, part []byte) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange(offset, int64(len(part)))),
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(etag)
+	}
+	output, err := r.client.GetObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to get range of object %s: %w", key, mapError(err))
+	}
+	defer output.Body.Close()
+
+	if _, err := io.ReadFull(output.Body, part); err != nil {
+		return fmt.Errorf("failed to read object body: %w", err)
+	}
+	return nil
+}
+
+// byteRange returns the Range header reading length bytes from offset
+func byteRange(offset, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// rangeSize returns the size of the whole object a Content-Range ends with
+func rangeSize(contentRange *string) (int64, bool) {
+	_, size, ok := strings.Cut(aws.ToString(contentRange), "/")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	return n, err == nil
+}
+
+// isErrorCode reports whether err is an S3 error with code or status
+func isErrorCode(err error, code string, status int) bool {
+	var (
+		apiErr  smithy.APIError
+		respErr *smithyhttp.ResponseError
+	)
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code ||
+		errors.As(err, &respErr) && respErr.HTTPStatusCode() == status
+}
@@ -2,23 +2,84 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
 )
 
 type R2Client struct {
 	client     *s3.Client
 	bucketName string
+	// timeout bounds each request, retries included, except those
+	// uploading a body, which take as long as the client sending it
+	timeout time.Duration
+	// parallel splits reads of large objects into concurrent ranges
+	parallel ParallelConfig
+}
+
+// TransportConfig tunes the connection pool of an R2 client; zero fields
+// keep the SDK defaults
+type TransportConfig struct {
+	// MaxIdleConns caps the idle connections kept open to the bucket
+	MaxIdleConns int
+	// MaxConnsPerHost caps the connections open to the bucket at once
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake of new connections
+	TLSHandshakeTimeout time.Duration
+}
+
+// R2Option configures an R2Client
+type R2Option func(*s3.Options)
+
+// WithTransport pools connections to the bucket as cfg sets. A client only
+// talks to its bucket's host, so every idle connection may be kept for it.
+func WithTransport(cfg TransportConfig) R2Option {
+	return func(o *s3.Options) {
+		o.HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			if cfg.MaxIdleConns > 0 {
+				t.MaxIdleConns = cfg.MaxIdleConns
+				t.MaxIdleConnsPerHost = cfg.MaxIdleConns
+			}
+			if cfg.MaxConnsPerHost > 0 {
+				t.MaxConnsPerHost = cfg.MaxConnsPerHost
+			}
+			if cfg.IdleConnTimeout > 0 {
+				t.IdleConnTimeout = cfg.IdleConnTimeout
+			}
+			if cfg.TLSHandshakeTimeout > 0 {
+				t.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+			}
+		})
+	}
 }
 
-func NewR2Client(accountID, accessKeyID, secretAccessKey, bucketName string) (*R2Client, error) {
+// NewR2Client creates a client for bucketName. Request metrics are recorded
+// into m, or nowhere when m is nil.
+func NewR2Client(accountID, accessKeyID, secretAccessKey, bucketName string, m *metrics.Metrics, opts ...R2Option) (*R2Client, error) {
+	if m == nil {
+		m = metrics.Noop()
+	}
 	endpoint := fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
 
-	client := s3.New(s3.Options{
+	options := s3.Options{
 		Region: "auto",
 		Credentials: credentials.NewStaticCredentialsProvider(
 			accessKeyID,
@@ -26,7 +87,13 @@ func NewR2Client(accountID, accessKeyID, secretAccessKey, bucketName string) (*R
 			"",
 		),
 		BaseEndpoint: aws.String(endpoint),
-	})
+		Retryer:      newBudgetRetryer(),
+		APIOptions:   []func(*middleware.Stack) error{addTracing(LogExporter{}, m)},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	client := s3.New(options)
 
 	return &R2Client{
 		client:     client,
@@ -34,66 +101,302 @@ func NewR2Client(accountID, accessKeyID, secretAccessKey, bucketName string) (*R
 	}, nil
 }
 
+// SetTimeout bounds each request, retries included, by d so a slow bucket
+// fails before the request it serves does; zero leaves requests to their
+// callers' deadlines. It must be called before r is used.
+func (r *R2Client) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+// withTimeout bounds ctx by the request timeout
+func (r *R2Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
 func (r *R2Client) GetObject(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := r.GetObjectWithHeaders(ctx, key)
+	return data, err
+}
+
+// GetObjectWithHeaders fetches an object along with the headers stored with
+// it; objects over the parallel download threshold are read in parts
+func (r *R2Client) GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error) {
+	if r.parallel.Threshold > 0 {
+		return r.getObjectParallel(ctx, key)
+	}
+	return r.getObject(ctx, key)
+}
+
+// getObject reads a whole object with a single request
+func (r *R2Client) getObject(ctx context.Context, key string) ([]byte, http.Header, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	output, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object %s: %w", key, mapError(err))
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read object body: %w", err)
+	}
+	return data, getObjectHeaders(output), nil
+}
+
+// GetObjectRange fetches length bytes of an object from offset, along with
+// the headers stored with it
+func (r *R2Client) GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	output, err := r.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(r.bucketName),
 		Key:    aws.String(key),
+		Range:  aws.String(byteRange(offset, length)),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+		return nil, nil, fmt.Errorf("failed to get range of object %s: %w", key, mapError(err))
 	}
 	defer output.Body.Close()
 
 	data, err := io.ReadAll(output.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read object body: %w", err)
+		return nil, nil, fmt.Errorf("failed to read object body: %w", err)
 	}
 
-	return data, nil
+	headers := getObjectHeaders(output)
+	if size, ok := rangeSize(output.ContentRange); ok {
+		headers.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	return data, headers, nil
+}
+
+// StatObject fetches the headers stored with an object without its content
+func (r *R2Client) StatObject(ctx context.Context, key string) (http.Header, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	output, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object %s: %w", key, mapError(err))
+	}
+
+	headers := objectHeaders(objectAttributes{
+		CacheControl:       output.CacheControl,
+		ContentDisposition: output.ContentDisposition,
+		ContentEncoding:    output.ContentEncoding,
+		ContentLanguage:    output.ContentLanguage,
+		ContentType:        output.ContentType,
+		ETag:               output.ETag,
+		Expires:            output.ExpiresString,
+		LastModified:       output.LastModified,
+		Metadata:           output.Metadata,
+	})
+	if output.ContentLength != nil {
+		headers.Set("Content-Length", strconv.FormatInt(*output.ContentLength, 10))
+	}
+	return headers, nil
+}
+
+// objectAttributes are the object fields shared by GET and HEAD responses
+type objectAttributes struct {
+	CacheControl       *string
+	ContentDisposition *string
+	ContentEncoding    *string
+	ContentLanguage    *string
+	ContentType        *string
+	ETag               *string
+	Expires            *string
+	LastModified       *time.Time
+	Metadata           map[string]string
+}
+
+// getObjectHeaders returns the headers an object read with GET was set with
+func getObjectHeaders(output *s3.GetObjectOutput) http.Header {
+	return objectHeaders(objectAttributes{
+		CacheControl:       output.CacheControl,
+		ContentDisposition: output.ContentDisposition,
+		ContentEncoding:    output.ContentEncoding,
+		ContentLanguage:    output.ContentLanguage,
+		ContentType:        output.ContentType,
+		ETag:               output.ETag,
+		Expires:            output.ExpiresString,
+		LastModified:       output.LastModified,
+		Metadata:           output.Metadata,
+	})
+}
+
+// objectHeaders converts object attributes to the headers they were set with
+func objectHeaders(attrs objectAttributes) http.Header {
+	headers := make(http.Header)
+	setHeader := func(name string, value *string) {
+		if v := aws.ToString(value); v != "" {
+			headers.Set(name, v)
+		}
+	}
+	setHeader("Cache-Control", attrs.CacheControl)
+	setHeader("Content-Disposition", attrs.ContentDisposition)
+	setHeader("Content-Encoding", attrs.ContentEncoding)
+	setHeader("Content-Language", attrs.ContentLanguage)
+	setHeader("Content-Type", attrs.ContentType)
+	setHeader("ETag", attrs.ETag)
+	setHeader("Expires", attrs.Expires)
+	if attrs.LastModified != nil {
+		headers.Set("Last-Modified", attrs.LastModified.UTC().Format(http.TimeFormat))
+	}
+	for name, value := range attrs.Metadata {
+		headers.Set("X-Amz-Meta-"+name, value)
+	}
+	return headers
 }
 
 func (r *R2Client) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	return r.PutObjectWithMetadata(ctx, key, data, contentType, nil)
+}
+
+// PutObjectWithMetadata stores data with user metadata, returned as
+// X-Amz-Meta-* headers when the object is read
+func (r *R2Client) PutObjectWithMetadata(ctx context.Context, key string, data io.Reader, contentType string, metadata map[string]string) error {
 	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(r.bucketName),
 		Key:         aws.String(key),
 		Body:        data,
 		ContentType: aws.String(contentType),
+		Metadata:    metadata,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to put object %s: %w", key, err)
+		return fmt.Errorf("failed to put object %s: %w", key, mapError(err))
 	}
 
 	return nil
 }
 
+// PresignPut returns a URL that lets a client upload key directly to R2
+func (r *R2Client) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*PresignedRequest, error) {
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(r.bucketName),
+		Key:      aws.String(key),
+		Metadata: metadata,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	// Presigning sends nothing over the wire, so drop the tracing middleware
+	presigner := s3.NewPresignClient(r.client, func(o *s3.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *s3.Options) { o.APIOptions = nil })
+	})
+	req, err := presigner.PresignPutObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload of %s: %w", key, err)
+	}
+
+	// Host is set by every HTTP client; Content-Type isn't signed by the SDK
+	// but is passed along so the object is stored with the right type.
+	// Metadata is signed, so the client must send it as x-amz-meta-* headers.
+	headers := req.SignedHeader.Clone()
+	headers.Del("Host")
+	if contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+
+	return &PresignedRequest{
+		URL:       req.URL,
+		Method:    req.Method,
+		Headers:   headers,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
 func (r *R2Client) DeleteObject(ctx context.Context, key string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(r.bucketName),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to delete object %s: %w", key, err)
+		return fmt.Errorf("failed to delete object %s: %w", key, mapError(err))
 	}
 
 	return nil
 }
 
 func (r *R2Client) ObjectExists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	_, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(r.bucketName),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		// Check if error is "not found" - object doesn't exist
-		return false, nil
+		err = mapError(err)
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check object %s: %w", key, err)
 	}
 
 	return true, nil
 }
 
+func (r *R2Client) ListObjects(ctx context.Context, prefix, continuationToken string, limit int) (*ListResult, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(r.bucketName),
+		MaxKeys: aws.Int32(int32(limit)),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = aws.String(continuationToken)
+	}
+
+	output, err := r.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects with prefix %s: %w", prefix, mapError(err))
+	}
+
+	result := &ListResult{
+		Objects: make([]ObjectInfo, 0, len(output.Contents)),
+	}
+	for _, obj := range output.Contents {
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:          aws.ToString(obj.Key),
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	if aws.ToBool(output.IsTruncated) {
+		result.NextToken = aws.ToString(output.NextContinuationToken)
+	}
+
+	return result, nil
+}
+
 // HealthCheck verifies R2 connectivity by checking if the bucket exists
 // This is a lightweight operation (HeadBucket) that doesn't transfer data
 func (r *R2Client) HealthCheck(ctx context.Context) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	_, err := r.client.HeadBucket(ctx, &s3.HeadBucketInput{
 		Bucket: aws.String(r.bucketName),
 	})
@@ -102,3 +405,38 @@ func (r *R2Client) HealthCheck(ctx context.Context) error {
 	}
 	return nil
 }
+
+// isInvalidPartCode reports whether code rejects the parts of a multipart upload
+func isInvalidPartCode(code string) bool {
+	switch code {
+	case "InvalidPart", "InvalidPartOrder", "EntityTooSmall":
+		return true
+	}
+	return false
+}
+
+// mapError wraps SDK errors with the matching storage sentinel error so
+// callers can use errors.Is; the original error stays in the chain
+func mapError(err error) error {
+	var (
+		noSuchKey    *types.NoSuchKey
+		notFound     *types.NotFound
+		noSuchUpload *types.NoSuchUpload
+		apiErr       smithy.APIError
+		respErr      *smithyhttp.ResponseError
+		netErr       net.Error
+	)
+	switch {
+	case errors.As(err, &noSuchKey), errors.As(err, &notFound), errors.As(err, &noSuchUpload):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.As(err, &apiErr) && isInvalidPartCode(apiErr.ErrorCode()):
+		return fmt.Errorf("%w: %w", ErrInvalidPart, err)
+	case errors.As(err, &apiErr) && (apiErr.ErrorCode() == "AccessDenied" || apiErr.ErrorCode() == "Forbidden"),
+		errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
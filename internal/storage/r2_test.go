@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestMapError(t *testing.T) {
+	forbidden := &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusForbidden}},
+		Err:      errors.New("forbidden"),
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no such key", &types.NoSuchKey{}, ErrNotFound},
+		{"head not found", &types.NotFound{}, ErrNotFound},
+		{"access denied code", &smithy.GenericAPIError{Code: "AccessDenied"}, ErrAccessDenied},
+		{"forbidden status", forbidden, ErrAccessDenied},
+		{"deadline", fmt.Errorf("operation error: %w", context.DeadlineExceeded), ErrTimeout},
+		{"other", errors.New("boom"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapError(tt.err)
+			if !errors.Is(got, tt.err) {
+				t.Errorf("mapError dropped the original error: %v", got)
+			}
+			for _, sentinel := range []error{ErrNotFound, ErrAccessDenied, ErrTimeout} {
+				if errors.Is(got, sentinel) != (sentinel == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", got, sentinel, !(sentinel == tt.want))
+				}
+			}
+		})
+	}
+}
+
+func TestR2Client_PresignPut(t *testing.T) {
+	client, err := NewR2Client("account", "key-id", "secret", "bucket", nil)
+	if err != nil {
+		t.Fatalf("NewR2Client failed: %v", err)
+	}
+
+	req, err := client.PresignPut(context.Background(), "uploads/report.pdf", "application/pdf", map[string]string{"cache-ttl": "1h"}, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("PresignPut failed: %v", err)
+	}
+	if req.Method != http.MethodPut {
+		t.Errorf("Expected PUT, got %s", req.Method)
+	}
+	if !strings.HasPrefix(req.URL, "https://bucket.account.r2.cloudflarestorage.com/uploads/report.pdf?") {
+		t.Errorf("Unexpected URL %s", req.URL)
+	}
+	if !strings.Contains(req.URL, "X-Amz-Expires=600") {
+		t.Errorf("Expected 10 minute expiry in %s", req.URL)
+	}
+	if got := req.Headers.Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Expected Content-Type header, got %q (%v)", got, req.Headers)
+	}
+	if got := req.Headers.Get("X-Amz-Meta-Cache-Ttl"); got != "1h" {
+		t.Errorf("Expected signed metadata header, got %q (%v)", got, req.Headers)
+	}
+}
+
+func TestR2Client_Timeout(t *testing.T) {
+	r, err := NewR2Client("account", "key", "secret", "bucket", nil)
+	if err != nil {
+		t.Fatalf("NewR2Client failed: %v", err)
+	}
+	r.SetTimeout(time.Nanosecond)
+
+	_, err = r.StatObject(context.Background(), "file.txt")
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a request past the storage timeout to fail with ErrTimeout, got %v", err)
+	}
+}
+
+func TestR2Client_Transport(t *testing.T) {
+	r, err := NewR2Client("account", "key", "secret", "bucket", nil, WithTransport(TransportConfig{
+		MaxIdleConns:        64,
+		MaxConnsPerHost:     256,
+		IdleConnTimeout:     time.Minute,
+		TLSHandshakeTimeout: 3 * time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("NewR2Client failed: %v", err)
+	}
+
+	client, ok := r.client.Options().HTTPClient.(*awshttp.BuildableClient)
+	if !ok {
+		t.Fatalf("Expected a buildable HTTP client, got %T", r.client.Options().HTTPClient)
+	}
+	transport := client.GetTransport()
+	if transport.MaxIdleConns != 64 || transport.MaxIdleConnsPerHost != 64 {
+		t.Errorf("Expected 64 idle connections to the bucket, got %d (%d per host)", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.MaxConnsPerHost != 256 {
+		t.Errorf("Expected 256 connections per host, got %d", transport.MaxConnsPerHost)
+	}
+	if transport.IdleConnTimeout != time.Minute || transport.TLSHandshakeTimeout != 3*time.Second {
+		t.Errorf("Expected the configured timeouts, got %v idle and %v handshake", transport.IdleConnTimeout, transport.TLSHandshakeTimeout)
+	}
+}
+
+// fakeBucket serves GETs of objects like S3, honoring Range and If-Match
+type fakeBucket struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	etags    map[string]string
+	requests []*http.Request
+	// onRequest runs before each request is answered
+	onRequest func(n int)
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.requests = append(b.requests, r)
+	if b.onRequest != nil {
+		b.onRequest(len(b.requests))
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	data, etag := b.objects[key], b.etags[key]
+	b.mu.Unlock()
+
+	writeError := func(status int, code string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+	}
+	if match := r.Header.Get("If-Match"); match != "" && match != etag {
+		writeError(http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	w.Header().Set("ETag", etag)
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		w.Write(data)
+		return
+	}
+	first, last, _ := strings.Cut(spec, "-")
+	start, _ := strconv.Atoi(first)
+	end, _ := strconv.Atoi(last)
+	if start >= len(data) {
+		writeError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+		return
+	}
+	end = min(end, len(data)-1)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[start : end+1])
+}
+
+func TestR2Client_ParallelDownload(t *testing.T) {
+	large := make([]byte, 10000)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	bucket := &fakeBucket{
+		objects: map[string][]byte{"large.bin": large, "small.txt": []byte("small"), "empty.txt": {}},
+		etags:   map[string]string{"large.bin": `"v1"`, "small.txt": `"s"`, "empty.txt": `"e"`},
+	}
+	srv := httptest.NewServer(bucket)
+	defer srv.Close()
+
+	r, err := NewR2Client("account", "key", "secret", "bucket", nil, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		o.UsePathStyle = true
+	})
+	if err != nil {
+		t.Fatalf("NewR2Client failed: %v", err)
+	}
+	r.SetParallelDownload(ParallelConfig{Threshold: 1000, PartSize: 1500, Concurrency: 3})
+
+	read := func(key string) ([]byte, []*http.Request) {
+		t.Helper()
+		bucket.mu.Lock()
+		bucket.requests = nil
+		bucket.mu.Unlock()
+		data, headers, err := r.GetObjectWithHeaders(context.Background(), key)
+		if err != nil {
+			t.Fatalf("GetObjectWithHeaders(%s) failed: %v", key, err)
+		}
+		if got := headers.Get("ETag"); got != bucket.etags[key] {
+			t.Errorf("Expected ETag %s, got %s", bucket.etags[key], got)
+		}
+		bucket.mu.Lock()
+		defer bucket.mu.Unlock()
+		return data, bucket.requests
+	}
+
+	// Large objects are read in parts of the same version
+	data, requests := read("large.bin")
+	if !bytes.Equal(data, large) {
+		t.Error("Expected the parts to be stitched into the object")
+	}
+	if len(requests) != 7 {
+		t.Errorf("Expected the first 1000 bytes and 6 parts to be read, got %d requests", len(requests))
+	}
+	for _, req := range requests[1:] {
+		if req.Header.Get("If-Match") != `"v1"` {
+			t.Errorf("Expected parts to be read with If-Match, got %q", req.Header.Get("If-Match"))
+		}
+	}
+
+	// Objects under the threshold take one request, and empty ones are
+	// read whole after their range is refused
+	for key, want := range map[string]int{"small.txt": 1, "empty.txt": 2} {
+		data, requests := read(key)
+		if !bytes.Equal(data, bucket.objects[key]) || len(requests) != want {
+			t.Errorf("Expected %s in %d requests, got %q in %d", key, want, data, len(requests))
+		}
+	}
+
+	// An object replaced midway is read again whole
+	replaced := bytes.Repeat([]byte("new"), 4000)
+	bucket.requests = nil
+	bucket.onRequest = func(n int) {
+		if n == 1 {
+			bucket.objects["large.bin"], bucket.etags["large.bin"] = replaced, `"v2"`
+		}
+	}
+	data, headers, err := r.GetObjectWithHeaders(context.Background(), "large.bin")
+	if err != nil {
+		t.Fatalf("GetObjectWithHeaders failed: %v", err)
+	}
+	if !bytes.Equal(data, replaced) || headers.Get("ETag") != `"v2"` {
+		t.Errorf("Expected the replaced object to be read whole, got %d bytes with ETag %s", len(data), headers.Get("ETag"))
+	}
+}
+
+func TestR2Client_ParallelDownloadTimeoutPerPart(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 10000)
+	bucket := &fakeBucket{
+		objects: map[string][]byte{"large.bin": large},
+		etags:   map[string]string{"large.bin": `"v1"`},
+		// Every request is well within the timeout, but all of them
+		// together are not
+		onRequest: func(int) { time.Sleep(40 * time.Millisecond) },
+	}
+	srv := httptest.NewServer(bucket)
+	defer srv.Close()
+
+	r, err := NewR2Client("account", "key", "secret", "bucket", nil, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		o.UsePathStyle = true
+	})
+	if err != nil {
+		t.Fatalf("NewR2Client failed: %v", err)
+	}
+	r.SetTimeout(time.Second / 5)
+	r.SetParallelDownload(ParallelConfig{Threshold: 1000, PartSize: 1500, Concurrency: 1})
+
+	data, _, err := r.GetObjectWithHeaders(context.Background(), "large.bin")
+	if err != nil {
+		t.Fatalf("Expected each part to get its own timeout, got %v", err)
+	}
+	if !bytes.Equal(data, large) {
+		t.Error("Expected the parts to be stitched into the object")
+	}
+
+	// The caller's deadline still bounds the whole read
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := r.GetObjectWithHeaders(ctx, "large.bin"); err == nil {
+		t.Error("Expected the read to stop at the caller's deadline")
+	}
+}
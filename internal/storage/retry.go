@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+)
+
+// budgetRetryer is the SDK's standard retryer, except that each retry is
+// drawn from the calling request's retry budget
+type budgetRetryer struct {
+	aws.RetryerV2
+}
+
+func newBudgetRetryer() aws.RetryerV2 {
+	return budgetRetryer{RetryerV2: retry.NewStandard()}
+}
+
+// GetRetryToken refuses the retry once the budget is spent; the SDK then
+// returns the last attempt's error joined with retrybudget.ErrExhausted
+func (r budgetRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	if !retrybudget.Allow(ctx, retrybudget.KindStorage) {
+		return nil, retrybudget.ErrExhausted
+	}
+	return r.RetryerV2.GetRetryToken(ctx, opErr)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/ch374n/file-downloader/internal/retrybudget"
+)
+
+func TestBudgetRetryer_StopsWhenBudgetSpent(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "auto",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Retryer:      newBudgetRetryer(),
+	})
+
+	budget := retrybudget.New(retrybudget.Config{Retries: 1})
+	ctx := retrybudget.WithBudget(context.Background(), budget)
+	_, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("file.txt"),
+	})
+	if !errors.Is(err, retrybudget.ErrExhausted) {
+		t.Fatalf("Expected ErrExhausted, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 attempts (1 retry), got %d", n)
+	}
+
+	// A second call on the same request gets no retries at all
+	calls.Store(0)
+	_, _ = client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("file.txt"),
+	})
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 1 attempt once the budget is spent, got %d", n)
+	}
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// Provider request ID headers, quoted to the provider when escalating slowness
+const (
+	headerAmzRequestID = "X-Amz-Request-Id"
+	headerAmzID2       = "X-Amz-Id-2"
+)
+
+// AttemptSpan records a single HTTP attempt of a storage operation
+type AttemptSpan struct {
+	Operation string
+	Attempt   int
+	Start     time.Time
+	Duration  time.Duration
+
+	// Connection phases; zero when a pooled connection was reused
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is measured from the start of the attempt
+	TimeToFirstByte time.Duration
+	ReusedConn      bool
+
+	StatusCode int
+	RequestID  string
+	HostID     string
+	Err        error
+}
+
+// OperationSpan records a storage operation across all of its attempts
+type OperationSpan struct {
+	Operation string
+	Start     time.Time
+	Duration  time.Duration
+	Attempts  int
+	RequestID string
+	Err       error
+}
+
+// SpanExporter receives finished spans. Exporters run inline on the request
+// path and must not block.
+type SpanExporter interface {
+	ExportAttempt(ctx context.Context, span AttemptSpan)
+	ExportOperation(ctx context.Context, span OperationSpan)
+}
+
+// LogExporter writes spans as debug log lines. The logger attaches the
+// service request ID, so each provider request ID can be traced back to the
+// client request that caused it.
+type LogExporter struct{}
+
+func (LogExporter) ExportAttempt(ctx context.Context, s AttemptSpan) {
+	attrs := []any{
+		"operation", s.Operation,
+		"attempt", s.Attempt,
+		"duration_ms", s.Duration.Milliseconds(),
+		"ttfb_ms", s.TimeToFirstByte.Milliseconds(),
+		"reused_conn", s.ReusedConn,
+		"status", s.StatusCode,
+		"amz_request_id", s.RequestID,
+		"amz_id_2", s.HostID,
+	}
+	if !s.ReusedConn {
+		attrs = append(attrs,
+			"dns_ms", s.DNS.Milliseconds(),
+			"connect_ms", s.Connect.Milliseconds(),
+			"tls_ms", s.TLSHandshake.Milliseconds(),
+		)
+	}
+	if s.Err != nil {
+		attrs = append(attrs, "error", s.Err)
+	}
+	slog.DebugContext(ctx, "Storage attempt", attrs...)
+}
+
+func (LogExporter) ExportOperation(ctx context.Context, s OperationSpan) {
+	attrs := []any{
+		"operation", s.Operation,
+		"attempts", s.Attempts,
+		"duration_ms", s.Duration.Milliseconds(),
+		"amz_request_id", s.RequestID,
+	}
+	if s.Err != nil {
+		attrs = append(attrs, "error", s.Err)
+	}
+	slog.DebugContext(ctx, "Storage operation", attrs...)
+}
+
+// addTracing returns an SDK stack option that records operation and attempt
+// spans, hands them to exporter and updates the R2 timing metrics in m
+func addTracing(exporter SpanExporter, m *metrics.Metrics) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		if err := stack.Initialize.Add(&operationTracer{exporter: exporter, metrics: m}, middleware.Before); err != nil {
+			return err
+		}
+		// After Retry so that every attempt is timed individually
+		return stack.Finalize.Insert(&attemptTracer{exporter: exporter, metrics: m}, "Retry", middleware.After)
+	}
+}
+
+type attemptCounterKey struct{}
+
+type operationTracer struct {
+	exporter SpanExporter
+	metrics  *metrics.Metrics
+}
+
+func (*operationTracer) ID() string { return "StorageOperationTracer" }
+
+func (t *operationTracer) HandleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+	middleware.InitializeOutput, middleware.Metadata, error,
+) {
+	var attempts atomic.Int32
+	ctx = middleware.WithStackValue(ctx, attemptCounterKey{}, &attempts)
+
+	start := time.Now()
+	out, metadata, err := next.HandleInitialize(ctx, in)
+
+	span := OperationSpan{
+		Operation: awsmiddleware.GetOperationName(ctx),
+		Start:     start,
+		Duration:  time.Since(start),
+		Attempts:  int(attempts.Load()),
+		Err:       err,
+	}
+	if results, ok := retry.GetAttemptResults(metadata); ok {
+		span.Attempts = len(results.Results)
+	}
+	span.RequestID, _ = awsmiddleware.GetRequestIDMetadata(metadata)
+
+	if span.Attempts > 1 {
+		t.metrics.R2RetriesTotal.WithLabelValues(span.Operation).Add(float64(span.Attempts - 1))
+	}
+	t.exporter.ExportOperation(ctx, span)
+
+	return out, metadata, err
+}
+
+type attemptTracer struct {
+	exporter SpanExporter
+	metrics  *metrics.Metrics
+}
+
+func (*attemptTracer) ID() string { return "StorageAttemptTracer" }
+
+func (t *attemptTracer) HandleFinalize(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+	middleware.FinalizeOutput, middleware.Metadata, error,
+) {
+	span := AttemptSpan{
+		Operation: awsmiddleware.GetOperationName(ctx),
+		Start:     time.Now(),
+	}
+	if counter, ok := middleware.GetStackValue(ctx, attemptCounterKey{}).(*atomic.Int32); ok {
+		span.Attempt = int(counter.Add(1))
+	}
+
+	// Trace callbacks can fire from dialer goroutines, e.g. a losing
+	// happy-eyeballs dial finishing after the attempt returned
+	var (
+		mu                               sync.Mutex
+		dnsStart, connectStart, tlsStart time.Time
+	)
+	record := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { span.ReusedConn = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { span.DNS = time.Since(dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			record(func() { connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			record(func() { span.Connect = time.Since(connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func() { tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { span.TLSHandshake = time.Since(tlsStart) })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { span.TimeToFirstByte = time.Since(span.Start) })
+		},
+	}
+
+	out, metadata, err := next.HandleFinalize(httptrace.WithClientTrace(ctx, trace), in)
+
+	mu.Lock()
+	defer mu.Unlock()
+	span.Duration = time.Since(span.Start)
+	span.Err = err
+	if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok && resp != nil {
+		span.StatusCode = resp.StatusCode
+		span.RequestID = resp.Header.Get(headerAmzRequestID)
+		span.HostID = resp.Header.Get(headerAmzID2)
+	}
+
+	t.metrics.R2AttemptDuration.WithLabelValues(span.Operation, strconv.Itoa(span.StatusCode)).Observe(span.Duration.Seconds())
+	if !span.ReusedConn && span.Connect > 0 {
+		t.metrics.R2ConnectDuration.WithLabelValues("connect").Observe(span.Connect.Seconds())
+		if span.TLSHandshake > 0 {
+			t.metrics.R2ConnectDuration.WithLabelValues("tls").Observe(span.TLSHandshake.Seconds())
+		}
+	}
+	t.exporter.ExportAttempt(ctx, span)
+
+	return out, metadata, err
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+type recordingExporter struct {
+	mu         sync.Mutex
+	attempts   []AttemptSpan
+	operations []OperationSpan
+}
+
+func (e *recordingExporter) ExportAttempt(_ context.Context, s AttemptSpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.attempts = append(e.attempts, s)
+}
+
+func (e *recordingExporter) ExportOperation(_ context.Context, s OperationSpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.operations = append(e.operations, s)
+}
+
+func TestTracing_RecordsAttemptsAndRequestIDs(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set(headerAmzRequestID, fmt.Sprintf("req-%d", n))
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	exporter := &recordingExporter{}
+	client := s3.New(s3.Options{
+		Region:       "auto",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		APIOptions:   []func(*middleware.Stack) error{addTracing(exporter, metrics.Noop())},
+	})
+
+	out, err := client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("file.txt"),
+	})
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	out.Body.Close()
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+
+	if len(exporter.attempts) != 2 {
+		t.Fatalf("Expected 2 attempt spans, got %d", len(exporter.attempts))
+	}
+	first, second := exporter.attempts[0], exporter.attempts[1]
+	if first.Attempt != 1 || first.StatusCode != http.StatusServiceUnavailable || first.RequestID != "req-1" {
+		t.Errorf("Unexpected first attempt: %+v", first)
+	}
+	if second.Attempt != 2 || second.StatusCode != http.StatusOK || second.RequestID != "req-2" {
+		t.Errorf("Unexpected second attempt: %+v", second)
+	}
+	if first.Operation != "GetObject" {
+		t.Errorf("Expected operation GetObject, got %q", first.Operation)
+	}
+	if first.ReusedConn || first.Connect <= 0 {
+		t.Errorf("Expected first attempt to dial a new connection: %+v", first)
+	}
+
+	if len(exporter.operations) != 1 {
+		t.Fatalf("Expected 1 operation span, got %d", len(exporter.operations))
+	}
+	if op := exporter.operations[0]; op.Attempts != 2 || op.RequestID != "req-2" || op.Err != nil {
+		t.Errorf("Unexpected operation span: %+v", op)
+	}
+}
@@ -0,0 +1,190 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/metrics"
+)
+
+// Cache keeps the entries of the tenant in the request context in its own
+// namespace, so tenants with the same file names never share entries.
+// Requests without a tenant use keys as they are.
+type Cache struct {
+	inner   cache.Cache
+	metrics *metrics.Metrics
+}
+
+// Ensure Cache implements the cache interfaces
+var (
+	_ cache.Cache         = (*Cache)(nil)
+	_ cache.EntryCache    = (*Cache)(nil)
+	_ cache.RangeCache    = (*Cache)(nil)
+	_ cache.Tombstoner    = (*Cache)(nil)
+	_ cache.VariantIndex  = (*Cache)(nil)
+	_ cache.UsageReporter = (*Cache)(nil)
+)
+
+// NewCache namespaces the keys of inner by tenant. Lookups are counted per
+// tenant in m, which may be nil.
+func NewCache(inner cache.Cache, m *metrics.Metrics) *Cache {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	return &Cache{inner: inner, metrics: m}
+}
+
+// key returns the inner key for key in ctx's tenant
+func (c *Cache) key(ctx context.Context, key string) string {
+	if t, ok := FromContext(ctx); ok {
+		return t.CacheNamespace() + key
+	}
+	return key
+}
+
+func (c *Cache) keys(ctx context.Context, keys []string) []string {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return keys
+	}
+	namespaced := make([]string, len(keys))
+	for i, key := range keys {
+		namespaced[i] = t.CacheNamespace() + key
+	}
+	return namespaced
+}
+
+// observe counts a lookup for ctx's tenant
+func (c *Cache) observe(ctx context.Context, found bool) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	result := "miss"
+	if found {
+		result = "hit"
+	}
+	c.metrics.TenantCacheLookupsTotal.WithLabelValues(t.ID, result).Inc()
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, found, err := c.inner.Get(ctx, c.key(ctx, key))
+	c.observe(ctx, found)
+	return data, found, err
+}
+
+func (c *Cache) GetWithAge(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	data, age, found, err := c.inner.GetWithAge(ctx, c.key(ctx, key))
+	c.observe(ctx, found)
+	return data, age, found, err
+}
+
+func (c *Cache) Set(ctx context.Context, key string, data []byte) error {
+	return c.inner.Set(ctx, c.key(ctx, key), data)
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	return c.inner.Delete(ctx, c.keys(ctx, keys)...)
+}
+
+// DeletePrefix removes entries within the tenant's namespace only
+func (c *Cache) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	return c.inner.DeletePrefix(ctx, c.key(ctx, prefix))
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.inner.Ping(ctx)
+}
+
+func (c *Cache) Close() error {
+	return c.inner.Close()
+}
+
+func (c *Cache) GetEntry(ctx context.Context, key string) (*cache.Entry, bool, error) {
+	key = c.key(ctx, key)
+	var (
+		entry *cache.Entry
+		found bool
+		err   error
+	)
+	if ec, ok := c.inner.(cache.EntryCache); ok {
+		entry, found, err = ec.GetEntry(ctx, key)
+	} else {
+		var data []byte
+		var age time.Duration
+		data, age, found, err = c.inner.GetWithAge(ctx, key)
+		if found && err == nil {
+			entry = &cache.Entry{Data: data, Age: age}
+		}
+	}
+	c.observe(ctx, found)
+	return entry, found, err
+}
+
+func (c *Cache) GetRange(ctx context.Context, key string, offset, length int64) (*cache.Entry, bool, error) {
+	rc, ok := c.inner.(cache.RangeCache)
+	if !ok {
+		return nil, false, errors.ErrUnsupported
+	}
+	entry, found, err := rc.GetRange(ctx, c.key(ctx, key), offset, length)
+	c.observe(ctx, found)
+	return entry, found, err
+}
+
+func (c *Cache) SetEntry(ctx context.Context, key string, data []byte, meta cache.EntryMeta) error {
+	key = c.key(ctx, key)
+	if ec, ok := c.inner.(cache.EntryCache); ok {
+		return ec.SetEntry(ctx, key, data, meta)
+	}
+	return c.inner.Set(ctx, key, data)
+}
+
+// Tombstone tombstones key, or deletes it when the inner cache can't keep
+// tombstones
+func (c *Cache) Tombstone(ctx context.Context, key string, ttl time.Duration) error {
+	key = c.key(ctx, key)
+	if ts, ok := c.inner.(cache.Tombstoner); ok {
+		return ts.Tombstone(ctx, key, ttl)
+	}
+	_, err := c.inner.Delete(ctx, key)
+	return err
+}
+
+// AddVariant records key as derived from base when the inner cache keeps a
+// variant index
+func (c *Cache) AddVariant(ctx context.Context, base, key string) error {
+	if idx, ok := c.inner.(cache.VariantIndex); ok {
+		return idx.AddVariant(ctx, c.key(ctx, base), c.key(ctx, key))
+	}
+	return nil
+}
+
+// Variants returns the derived keys recorded for base, relative to the
+// tenant's namespace
+func (c *Cache) Variants(ctx context.Context, base string) ([]string, error) {
+	idx, ok := c.inner.(cache.VariantIndex)
+	if !ok {
+		return nil, nil
+	}
+	variants, err := idx.Variants(ctx, c.key(ctx, base))
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := FromContext(ctx); ok {
+		for i, key := range variants {
+			variants[i] = strings.TrimPrefix(key, t.CacheNamespace())
+		}
+	}
+	return variants, nil
+}
+
+// Usage reports the usage of the whole inner cache, across tenants
+func (c *Cache) Usage(ctx context.Context) (cache.Usage, error) {
+	if reporter, ok := c.inner.(cache.UsageReporter); ok {
+		return reporter.Usage(ctx)
+	}
+	return cache.Usage{}, errors.ErrUnsupported
+}
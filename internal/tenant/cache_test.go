@@ -0,0 +1,61 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+func TestCache_Namespaces(t *testing.T) {
+	r := newRegistry(t)
+	alpha, _ := r.ByHost("alpha.files.example.com")
+	beta, _ := r.ByCredential("beta-ci")
+	alphaCtx := tenant.NewContext(context.Background(), alpha)
+	betaCtx := tenant.NewContext(context.Background(), beta)
+
+	inner := mocks.NewMockCache()
+	c := tenant.NewCache(inner, nil)
+	for ctx, data := range map[context.Context]string{context.Background(): "shared", alphaCtx: "alpha", betaCtx: "beta"} {
+		if err := c.Set(ctx, "a.txt", []byte(data)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	data, found, _ := inner.Get(context.Background(), alpha.CacheNamespace()+"a.txt")
+	if !found || string(data) != "alpha" {
+		t.Errorf("Expected alpha's entry in its namespace, got %q", data)
+	}
+	data, found, _ = c.Get(betaCtx, "a.txt")
+	if !found || string(data) != "beta" {
+		t.Errorf("Expected beta's entry, got %q", data)
+	}
+
+	n, err := c.DeletePrefix(alphaCtx, "")
+	if err != nil || n != 1 {
+		t.Errorf("Expected a tenant purge to remove only its entry, removed %d (%v)", n, err)
+	}
+	for _, ctx := range []context.Context{context.Background(), betaCtx} {
+		if _, found, _ := c.Get(ctx, "a.txt"); !found {
+			t.Error("Expected other tenants' entries to survive the purge")
+		}
+	}
+}
+
+func TestCache_Variants(t *testing.T) {
+	r := newRegistry(t)
+	alpha, _ := r.ByHost("alpha.files.example.com")
+	ctx := tenant.NewContext(context.Background(), alpha)
+
+	c := tenant.NewCache(mocks.NewMockCache(), nil)
+	variant := cache.VariantKey("a.txt", "gzip")
+	if err := c.AddVariant(ctx, "a.txt", variant); err != nil {
+		t.Fatalf("AddVariant failed: %v", err)
+	}
+	variants, err := c.Variants(ctx, "a.txt")
+	if err != nil || len(variants) != 1 || variants[0] != variant {
+		t.Errorf("Expected [%s] relative to the namespace, got %v (%v)", variant, variants, err)
+	}
+}
@@ -0,0 +1,151 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// Backend is the storage a tenant's objects can live in
+type Backend interface {
+	storage.Storage
+	storage.UploadPresigner
+	storage.HeaderGetter
+	storage.HeaderStater
+	storage.RangeGetter
+	storage.MultipartUploader
+}
+
+// Storage routes object operations to the bucket and key prefix of the
+// tenant in the request context. Requests without a tenant use the default
+// backend and keys as they are.
+type Storage struct {
+	fallback Backend
+	buckets  map[string]Backend
+}
+
+// Ensure Storage implements the storage interfaces
+var _ Backend = (*Storage)(nil)
+
+// NewStorage returns a Storage using fallback for requests without a
+// tenant and tenants without a bucket, and buckets for the others. Every
+// tenant bucket must be in buckets.
+func NewStorage(r *Registry, fallback Backend, buckets map[string]Backend) (*Storage, error) {
+	for _, t := range r.Tenants() {
+		if t.Bucket != "" && buckets[t.Bucket] == nil {
+			return nil, fmt.Errorf("tenant %q: no backend for bucket %s", t.ID, t.Bucket)
+		}
+	}
+	return &Storage{fallback: fallback, buckets: buckets}, nil
+}
+
+// route returns the backend and key for key in ctx's tenant
+func (s *Storage) route(ctx context.Context, key string) (Backend, string) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return s.fallback, key
+	}
+	backend := s.fallback
+	if t.Bucket != "" {
+		backend = s.buckets[t.Bucket]
+	}
+	return backend, t.KeyPrefix + key
+}
+
+func (s *Storage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	backend, key := s.route(ctx, key)
+	return backend.GetObject(ctx, key)
+}
+
+func (s *Storage) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	backend, key := s.route(ctx, key)
+	return backend.PutObject(ctx, key, data, contentType)
+}
+
+func (s *Storage) DeleteObject(ctx context.Context, key string) error {
+	backend, key := s.route(ctx, key)
+	return backend.DeleteObject(ctx, key)
+}
+
+func (s *Storage) ObjectExists(ctx context.Context, key string) (bool, error) {
+	backend, key := s.route(ctx, key)
+	return backend.ObjectExists(ctx, key)
+}
+
+// ListObjects lists the tenant's objects, with keys relative to its key
+// prefix
+func (s *Storage) ListObjects(ctx context.Context, prefix, continuationToken string, limit int) (*storage.ListResult, error) {
+	backend, fullPrefix := s.route(ctx, prefix)
+	result, err := backend.ListObjects(ctx, fullPrefix, continuationToken, limit)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := FromContext(ctx); ok && t.KeyPrefix != "" {
+		for i := range result.Objects {
+			result.Objects[i].Key = strings.TrimPrefix(result.Objects[i].Key, t.KeyPrefix)
+		}
+	}
+	return result, nil
+}
+
+// HealthCheck checks the default backend and every tenant bucket
+func (s *Storage) HealthCheck(ctx context.Context) error {
+	errs := []error{s.fallback.HealthCheck(ctx)}
+	for bucket, backend := range s.buckets {
+		if err := backend.HealthCheck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucket, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Storage) PresignPut(ctx context.Context, key, contentType string, metadata map[string]string, ttl time.Duration) (*storage.PresignedRequest, error) {
+	backend, key := s.route(ctx, key)
+	return backend.PresignPut(ctx, key, contentType, metadata, ttl)
+}
+
+func (s *Storage) GetObjectWithHeaders(ctx context.Context, key string) ([]byte, http.Header, error) {
+	backend, key := s.route(ctx, key)
+	return backend.GetObjectWithHeaders(ctx, key)
+}
+
+func (s *Storage) StatObject(ctx context.Context, key string) (http.Header, error) {
+	backend, key := s.route(ctx, key)
+	return backend.StatObject(ctx, key)
+}
+
+func (s *Storage) GetObjectRange(ctx context.Context, key string, offset, length int64) ([]byte, http.Header, error) {
+	backend, key := s.route(ctx, key)
+	return backend.GetObjectRange(ctx, key, offset, length)
+}
+
+func (s *Storage) CreateMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	backend, key := s.route(ctx, key)
+	return backend.CreateMultipartUpload(ctx, key, contentType, metadata)
+}
+
+func (s *Storage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (*storage.UploadedPart, error) {
+	backend, key := s.route(ctx, key)
+	return backend.UploadPart(ctx, key, uploadID, partNumber, body, size)
+}
+
+func (s *Storage) ListParts(ctx context.Context, key, uploadID string) ([]storage.UploadedPart, error) {
+	backend, key := s.route(ctx, key)
+	return backend.ListParts(ctx, key, uploadID)
+}
+
+func (s *Storage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.UploadedPart) error {
+	backend, key := s.route(ctx, key)
+	return backend.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (s *Storage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	backend, key := s.route(ctx, key)
+	return backend.AbortMultipartUpload(ctx, key, uploadID)
+}
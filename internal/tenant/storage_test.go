@@ -0,0 +1,71 @@
+package tenant_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+func TestStorage_Routes(t *testing.T) {
+	r := newRegistry(t)
+	alpha, _ := r.ByHost("alpha.files.example.com")
+	beta, _ := r.ByCredential("beta-ci")
+
+	fallback := mocks.NewMockStorage()
+	fallback.SetObject("a.txt", []byte("shared"))
+	fallback.SetObject("beta/a.txt", []byte("beta"))
+	alphaBucket := mocks.NewMockStorage()
+	alphaBucket.SetObject("a.txt", []byte("alpha"))
+
+	s, err := tenant.NewStorage(r, fallback, map[string]tenant.Backend{"alpha-files": alphaBucket})
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "no tenant", ctx: context.Background(), want: "shared"},
+		{name: "tenant bucket", ctx: tenant.NewContext(context.Background(), alpha), want: "alpha"},
+		{name: "tenant key prefix", ctx: tenant.NewContext(context.Background(), beta), want: "beta"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := s.GetObject(tt.ctx, "a.txt")
+			if err != nil || string(data) != tt.want {
+				t.Errorf("Expected %q, got %q (%v)", tt.want, data, err)
+			}
+		})
+	}
+
+	result, err := s.ListObjects(tenant.NewContext(context.Background(), beta), "", "", 10)
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(result.Objects) != 1 || result.Objects[0].Key != "a.txt" {
+		t.Errorf("Expected beta's a.txt without its key prefix, got %+v", result.Objects)
+	}
+}
+
+func TestNewStorage_MissingBucket(t *testing.T) {
+	if _, err := tenant.NewStorage(newRegistry(t), mocks.NewMockStorage(), nil); err == nil {
+		t.Error("Expected an error for a tenant bucket without a backend")
+	}
+}
+
+func TestStorage_HealthCheck(t *testing.T) {
+	alphaBucket := mocks.NewMockStorage()
+	alphaBucket.HealthCheckError = errors.New("unreachable")
+	s, err := tenant.NewStorage(newRegistry(t), mocks.NewMockStorage(), map[string]tenant.Backend{"alpha-files": alphaBucket})
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	if err := s.HealthCheck(context.Background()); err == nil {
+		t.Error("Expected a failing tenant bucket to fail the health check")
+	}
+}
@@ -0,0 +1,197 @@
+// Package tenant lets one deployment serve many teams. Each request is
+// resolved to a tenant, whose objects live in its own bucket or under its
+// own key prefix and whose cache entries live in its own namespace.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// namespaceSeparator joins the tenant marker and ID in cache keys. Like
+// cache variant keys it uses '#', which can't appear in a file name taken
+// from a request path, so tenant entries can't collide with untenanted ones.
+const namespaceSeparator = "#"
+
+// validID restricts tenant IDs to what is safe in cache keys and metric
+// labels
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Tenant is a team sharing the deployment
+type Tenant struct {
+	ID string `json:"id"`
+	// Hosts are the Host header values, without port, served as this tenant
+	Hosts []string `json:"hosts,omitempty"`
+	// PathPrefix, such as /teams/a, is stripped from request paths served
+	// as this tenant
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Credentials are the names of the admin credentials belonging to this
+	// tenant
+	Credentials []string `json:"credentials,omitempty"`
+	// Bucket holds the tenant's objects; empty uses the default bucket
+	Bucket string `json:"bucket,omitempty"`
+	// KeyPrefix is prepended to the tenant's object keys
+	KeyPrefix string `json:"key_prefix,omitempty"`
+	// QuotaBytes caps the bytes the tenant stores; 0 means no limit
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+	// PrefixQuotas caps the bytes stored under key prefixes, relative to
+	// KeyPrefix
+	PrefixQuotas map[string]int64 `json:"prefix_quotas,omitempty"`
+}
+
+// CacheNamespace is the prefix of the tenant's cache keys
+func (t *Tenant) CacheNamespace() string {
+	return "tenant" + namespaceSeparator + t.ID + "/"
+}
+
+// Registry resolves requests to tenants
+type Registry struct {
+	tenants      []*Tenant
+	byID         map[string]*Tenant
+	byHost       map[string]*Tenant
+	byCredential map[string]*Tenant
+}
+
+// New validates tenants and indexes them for resolution
+func New(tenants ...Tenant) (*Registry, error) {
+	r := &Registry{
+		byID:         make(map[string]*Tenant, len(tenants)),
+		byHost:       make(map[string]*Tenant),
+		byCredential: make(map[string]*Tenant),
+	}
+	for i := range tenants {
+		t := tenants[i]
+		if !validID.MatchString(t.ID) {
+			return nil, fmt.Errorf("invalid tenant ID %q: use lowercase letters, digits, '-' and '_'", t.ID)
+		}
+		if r.byID[t.ID] != nil {
+			return nil, fmt.Errorf("tenant %q is defined more than once", t.ID)
+		}
+		if len(t.Hosts) == 0 && t.PathPrefix == "" && len(t.Credentials) == 0 {
+			return nil, fmt.Errorf("tenant %q: hosts, path_prefix or credentials is required", t.ID)
+		}
+		if t.QuotaBytes < 0 {
+			return nil, fmt.Errorf("tenant %q: quota_bytes must not be negative", t.ID)
+		}
+		for prefix, limit := range t.PrefixQuotas {
+			if limit <= 0 {
+				return nil, fmt.Errorf("tenant %q: quota for prefix %s must be positive", t.ID, prefix)
+			}
+		}
+		if t.PathPrefix != "" {
+			t.PathPrefix = "/" + strings.Trim(t.PathPrefix, "/")
+			if t.PathPrefix == "/" {
+				return nil, fmt.Errorf("tenant %q: path_prefix must not be /", t.ID)
+			}
+			for _, other := range r.tenants {
+				if other.PathPrefix != "" && (hasPathPrefix(t.PathPrefix, other.PathPrefix) || hasPathPrefix(other.PathPrefix, t.PathPrefix)) {
+					return nil, fmt.Errorf("tenant %q: path_prefix %s overlaps tenant %q", t.ID, t.PathPrefix, other.ID)
+				}
+			}
+		}
+		for _, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if other := r.byHost[host]; other != nil {
+				return nil, fmt.Errorf("tenant %q: host %s already belongs to tenant %q", t.ID, host, other.ID)
+			}
+			r.byHost[host] = &t
+		}
+		for _, name := range t.Credentials {
+			if other := r.byCredential[name]; other != nil {
+				return nil, fmt.Errorf("tenant %q: credential %s already belongs to tenant %q", t.ID, name, other.ID)
+			}
+			r.byCredential[name] = &t
+		}
+		r.tenants = append(r.tenants, &t)
+		r.byID[t.ID] = &t
+	}
+	return r, nil
+}
+
+// Load reads a JSON array of tenants from path
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file %s: %w", path, err)
+	}
+	if len(tenants) == 0 {
+		return nil, errors.New("tenants file declares no tenants")
+	}
+	return New(tenants...)
+}
+
+// Tenants returns the registered tenants in declaration order
+func (r *Registry) Tenants() []*Tenant {
+	return r.tenants
+}
+
+// ByHost returns the tenant serving host, which may include a port
+func (r *Registry) ByHost(host string) (*Tenant, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	t, ok := r.byHost[strings.ToLower(host)]
+	return t, ok
+}
+
+// ByPath returns the tenant whose path prefix starts urlPath, along with
+// urlPath without the prefix
+func (r *Registry) ByPath(urlPath string) (*Tenant, string, bool) {
+	for _, t := range r.tenants {
+		if t.PathPrefix != "" && hasPathPrefix(urlPath, t.PathPrefix) {
+			rest := urlPath[len(t.PathPrefix):]
+			if rest == "" {
+				rest = "/"
+			}
+			return t, rest, true
+		}
+	}
+	return nil, urlPath, false
+}
+
+// ByCredential returns the tenant owning the named admin credential
+func (r *Registry) ByCredential(name string) (*Tenant, bool) {
+	t, ok := r.byCredential[name]
+	return t, ok
+}
+
+// SplitCacheKey returns the tenant whose namespace key is in and the key
+// within it. Keys outside every tenant namespace return false.
+func (r *Registry) SplitCacheKey(key string) (*Tenant, string, bool) {
+	rest, ok := strings.CutPrefix(key, "tenant"+namespaceSeparator)
+	if !ok {
+		return nil, key, false
+	}
+	id, name, ok := strings.Cut(rest, "/")
+	if !ok || r.byID[id] == nil {
+		return nil, key, false
+	}
+	return r.byID[id], name, true
+}
+
+func hasPathPrefix(p, prefix string) bool {
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying t
+func NewContext(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant carried by ctx, if any
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+	return t, ok && t != nil
+}
@@ -0,0 +1,146 @@
+package tenant_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/tenant"
+)
+
+func newRegistry(t *testing.T) *tenant.Registry {
+	t.Helper()
+	r, err := tenant.New(
+		tenant.Tenant{ID: "alpha", Hosts: []string{"alpha.files.example.com"}, Bucket: "alpha-files"},
+		tenant.Tenant{ID: "beta", PathPrefix: "/teams/beta/", Credentials: []string{"beta-ci"}, KeyPrefix: "beta/"},
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return r
+}
+
+func TestRegistry_ByHost(t *testing.T) {
+	r := newRegistry(t)
+
+	for _, host := range []string{"alpha.files.example.com", "ALPHA.files.example.com:8443"} {
+		if got, ok := r.ByHost(host); !ok || got.ID != "alpha" {
+			t.Errorf("Expected %s to resolve to alpha, got %v", host, got)
+		}
+	}
+	if got, ok := r.ByHost("files.example.com"); ok {
+		t.Errorf("Expected no tenant for an unknown host, got %s", got.ID)
+	}
+}
+
+func TestRegistry_ByPath(t *testing.T) {
+	r := newRegistry(t)
+
+	tests := []struct {
+		path   string
+		tenant string
+		rest   string
+	}{
+		{path: "/teams/beta/files/a.txt", tenant: "beta", rest: "/files/a.txt"},
+		{path: "/teams/beta", tenant: "beta", rest: "/"},
+		{path: "/teams/betamax/files/a.txt", rest: "/teams/betamax/files/a.txt"},
+		{path: "/files/a.txt", rest: "/files/a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, rest, ok := r.ByPath(tt.path)
+			if ok != (tt.tenant != "") || ok && got.ID != tt.tenant {
+				t.Errorf("Expected tenant %q, got %v", tt.tenant, got)
+			}
+			if rest != tt.rest {
+				t.Errorf("Expected remaining path %q, got %q", tt.rest, rest)
+			}
+		})
+	}
+}
+
+func TestRegistry_SplitCacheKey(t *testing.T) {
+	r := newRegistry(t)
+	beta, _ := r.ByCredential("beta-ci")
+
+	got, name, ok := r.SplitCacheKey(beta.CacheNamespace() + "reports/q3.pdf")
+	if !ok || got.ID != "beta" || name != "reports/q3.pdf" {
+		t.Errorf("Expected beta and reports/q3.pdf, got %v %q", got, name)
+	}
+	for _, key := range []string{"reports/q3.pdf", "tenant#gamma/a.txt"} {
+		if _, _, ok := r.SplitCacheKey(key); ok {
+			t.Errorf("Expected %s to be outside every tenant namespace", key)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []tenant.Tenant
+		want    string
+	}{
+		{
+			name:    "invalid ID",
+			tenants: []tenant.Tenant{{ID: "Team A", Hosts: []string{"a.example.com"}}},
+			want:    "invalid tenant ID",
+		},
+		{
+			name:    "no way to resolve",
+			tenants: []tenant.Tenant{{ID: "a"}},
+			want:    "hosts, path_prefix or credentials is required",
+		},
+		{
+			name:    "duplicate ID",
+			tenants: []tenant.Tenant{{ID: "a", Hosts: []string{"a.example.com"}}, {ID: "a", Hosts: []string{"b.example.com"}}},
+			want:    "defined more than once",
+		},
+		{
+			name:    "shared host",
+			tenants: []tenant.Tenant{{ID: "a", Hosts: []string{"files.example.com"}}, {ID: "b", Hosts: []string{"FILES.example.com"}}},
+			want:    "already belongs to tenant",
+		},
+		{
+			name:    "nested path prefixes",
+			tenants: []tenant.Tenant{{ID: "a", PathPrefix: "/teams"}, {ID: "b", PathPrefix: "/teams/b"}},
+			want:    "overlaps",
+		},
+		{
+			name:    "shared credential",
+			tenants: []tenant.Tenant{{ID: "a", Credentials: []string{"ci"}}, {ID: "b", Credentials: []string{"ci"}}},
+			want:    "already belongs to tenant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tenant.New(tt.tenants...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	data := `[{"id": "alpha", "hosts": ["alpha.example.com"], "bucket": "alpha-files"}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := tenant.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, ok := r.ByHost("alpha.example.com"); !ok || got.Bucket != "alpha-files" {
+		t.Errorf("Expected alpha with its bucket, got %v", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`[]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenant.Load(path); err == nil {
+		t.Error("Expected an error for a file without tenants")
+	}
+}
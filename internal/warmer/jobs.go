@@ -0,0 +1,266 @@
+package warmer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// Warm job states
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+var (
+	// ErrTooManyJobs is returned when the maximum number of warm jobs is
+	// already running
+	ErrTooManyJobs = errors.New("too many warm jobs running")
+	// ErrJobNotFound is returned for unknown or expired job IDs
+	ErrJobNotFound = errors.New("warm job not found")
+	// ErrClosed is returned for jobs started after Close
+	ErrClosed = errors.New("warm jobs are shut down")
+)
+
+// JobsConfig bounds on-demand warm jobs
+type JobsConfig struct {
+	// MaxJobs caps the number of jobs running at once
+	MaxJobs int
+	// MaxConcurrency caps the parallel fetches of a single job
+	MaxConcurrency int
+	// Timeout bounds a single job
+	Timeout time.Duration
+	// Retention is how long finished jobs can still be polled
+	Retention time.Duration
+}
+
+// DefaultJobsConfig returns the default warm job limits
+func DefaultJobsConfig() JobsConfig {
+	return JobsConfig{
+		MaxJobs:        4,
+		MaxConcurrency: 16,
+		Timeout:        time.Hour,
+		Retention:      time.Hour,
+	}
+}
+
+// JobStatus is a snapshot of an on-demand warm job
+type JobStatus struct {
+	ID         string     `json:"id"`
+	State      string     `json:"state"`
+	Prefix     string     `json:"prefix,omitempty"`
+	Keys       int        `json:"keys"`
+	Warmed     int        `json:"warmed"`
+	Failed     int        `json:"failed"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type warmJob struct {
+	id       string
+	prefix   string
+	warmer   *Warmer
+	started  time.Time
+	finished time.Time
+	state    string
+	err      error
+}
+
+// Jobs runs on-demand warmers in the background and tracks their progress
+type Jobs struct {
+	storage storage.Storage
+	cache   cache.Cache
+	cfg     JobsConfig
+	opts    []Option
+
+	mu   sync.Mutex
+	jobs map[string]*warmJob
+
+	// ctx is canceled by Close to stop running jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobs creates a job registry that warms c from s. opts apply to the
+// warmer of every job.
+func NewJobs(s storage.Storage, c cache.Cache, cfg JobsConfig, opts ...Option) *Jobs {
+	defaults := DefaultJobsConfig()
+	if cfg.MaxJobs <= 0 {
+		cfg.MaxJobs = defaults.MaxJobs
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = defaults.MaxConcurrency
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaults.Retention
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Jobs{
+		storage: s,
+		cache:   c,
+		cfg:     cfg,
+		opts:    opts,
+		jobs:    make(map[string]*warmJob),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start launches a warm job for the keys and prefix in spec. Concurrency
+// is capped at the configured maximum; Name and Schedule are ignored.
+func (j *Jobs) Start(spec Spec) (JobStatus, error) {
+	if spec.Prefix == "" && len(spec.Keys) == 0 {
+		return JobStatus{}, errors.New("prefix or keys is required")
+	}
+	if spec.Concurrency <= 0 {
+		spec.Concurrency = defaultConcurrency
+	}
+	spec.Concurrency = min(spec.Concurrency, j.cfg.MaxConcurrency)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.ctx.Err() != nil {
+		return JobStatus{}, ErrClosed
+	}
+	j.pruneLocked()
+	if j.runningLocked() >= j.cfg.MaxJobs {
+		return JobStatus{}, ErrTooManyJobs
+	}
+
+	id := newJobID()
+	// Ad-hoc jobs share one metrics label; they are told apart by ID
+	spec.Name = "adhoc"
+	job := &warmJob{
+		id:      id,
+		prefix:  spec.Prefix,
+		warmer:  New(spec, j.storage, j.cache, j.opts...),
+		started: time.Now(),
+		state:   JobRunning,
+	}
+	j.jobs[id] = job
+
+	j.wg.Add(1)
+	go j.run(job)
+	return job.status(), nil
+}
+
+// Get returns the status of a job
+func (j *Jobs) Get(id string) (JobStatus, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return JobStatus{}, ErrJobNotFound
+	}
+	return job.status(), nil
+}
+
+// Running returns the number of jobs still running
+func (j *Jobs) Running() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.runningLocked()
+}
+
+func (j *Jobs) runningLocked() int {
+	running := 0
+	for _, job := range j.jobs {
+		if job.state == JobRunning {
+			running++
+		}
+	}
+	return running
+}
+
+// Close cancels running jobs and waits for them to stop, or for ctx to be
+// done. Starting jobs afterwards fails with ErrClosed.
+func (j *Jobs) Close(ctx context.Context) error {
+	j.mu.Lock()
+	j.cancel()
+	j.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *Jobs) run(job *warmJob) {
+	defer j.wg.Done()
+	ctx, cancel := context.WithTimeout(j.ctx, j.cfg.Timeout)
+	defer cancel()
+
+	_, err := job.warmer.Run(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job.finished = time.Now()
+	job.err = err
+	job.state = JobCompleted
+	if err != nil {
+		job.state = JobFailed
+		slog.Warn("Warm job failed", "job_id", job.id, "error", err)
+	}
+}
+
+// pruneLocked drops finished jobs past their retention
+func (j *Jobs) pruneLocked() {
+	cutoff := time.Now().Add(-j.cfg.Retention)
+	for id, job := range j.jobs {
+		if job.state != JobRunning && job.finished.Before(cutoff) {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// status must be called with the registry lock held
+func (w *warmJob) status() JobStatus {
+	progress := w.warmer.Progress()
+	status := JobStatus{
+		ID:        w.id,
+		State:     w.state,
+		Prefix:    w.prefix,
+		Keys:      progress.Keys,
+		Warmed:    progress.Warmed,
+		Failed:    progress.Failed,
+		StartedAt: w.started.UTC(),
+	}
+	if w.state != JobRunning {
+		finished := w.finished.UTC()
+		status.FinishedAt = &finished
+	}
+	if w.err != nil {
+		status.Error = w.err.Error()
+	}
+	return status
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
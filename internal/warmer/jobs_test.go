@@ -0,0 +1,106 @@
+package warmer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/warmer"
+)
+
+// waitForJob polls a job until it finishes
+func waitForJob(t *testing.T, jobs *warmer.Jobs, id string) warmer.JobStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := jobs.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if status.State != warmer.JobRunning {
+			return status
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return warmer.JobStatus{}
+}
+
+func TestJobs_StartAndPoll(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockCache := mocks.NewMockCache()
+	mockStorage.SetObject("assets/app.js", []byte("js"))
+	mockStorage.SetObject("assets/app.css", []byte("css"))
+	mockStorage.SetObject("index.html", []byte("html"))
+
+	jobs := warmer.NewJobs(mockStorage, mockCache, warmer.DefaultJobsConfig())
+	started, err := jobs.Start(warmer.Spec{Prefix: "assets/", Keys: []string{"index.html", "missing.txt"}})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if started.ID == "" {
+		t.Fatal("Expected a job ID")
+	}
+
+	status := waitForJob(t, jobs, started.ID)
+	if status.State != warmer.JobCompleted || status.Keys != 4 || status.Warmed != 3 || status.Failed != 1 {
+		t.Errorf("Unexpected job status: %+v", status)
+	}
+	if status.FinishedAt == nil {
+		t.Error("Expected finish time")
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "assets/app.js"); !found {
+		t.Error("Expected assets/app.js to be cached")
+	}
+
+	if _, err := jobs.Get("unknown"); !errors.Is(err, warmer.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJobs_MaxJobs(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a", []byte("a"))
+	mockStorage.GetDelay = 200 * time.Millisecond
+
+	jobs := warmer.NewJobs(mockStorage, mocks.NewMockCache(), warmer.JobsConfig{MaxJobs: 1})
+	first, err := jobs.Start(warmer.Spec{Keys: []string{"a"}})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if _, err := jobs.Start(warmer.Spec{Keys: []string{"a"}}); !errors.Is(err, warmer.ErrTooManyJobs) {
+		t.Errorf("Expected ErrTooManyJobs, got %v", err)
+	}
+
+	waitForJob(t, jobs, first.ID)
+	if _, err := jobs.Start(warmer.Spec{Keys: []string{"a"}}); err != nil {
+		t.Errorf("Expected a new job once the first finished, got %v", err)
+	}
+}
+
+func TestJobs_Close(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("a", []byte("a"))
+	mockStorage.GetDelay = time.Minute
+
+	jobs := warmer.NewJobs(mockStorage, mocks.NewMockCache(), warmer.DefaultJobsConfig())
+	started, err := jobs.Start(warmer.Spec{Keys: []string{"a"}})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := jobs.Close(ctx); err != nil {
+		t.Fatalf("Expected running jobs to be canceled, got %v", err)
+	}
+	if status := waitForJob(t, jobs, started.ID); status.State == warmer.JobCompleted && status.Warmed != 0 {
+		t.Errorf("Expected the job to be interrupted, got %+v", status)
+	}
+	if _, err := jobs.Start(warmer.Spec{Keys: []string{"a"}}); !errors.Is(err, warmer.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package warmer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// StorageManifestPrefix marks a manifest source as a storage key rather
+// than a local file path
+const StorageManifestPrefix = "storage:"
+
+// LoadManifest reads the keys listed in a preload manifest. source is a
+// local file path, or a storage key prefixed with "storage:". The manifest
+// is either a JSON array of keys or one key per line, where blank lines
+// and lines starting with # are ignored.
+func LoadManifest(ctx context.Context, source string, s storage.Storage) ([]string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if key, ok := strings.CutPrefix(source, StorageManifestPrefix); ok {
+		data, err = s.GetObject(ctx, key)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preload manifest %s: %w", source, err)
+	}
+
+	keys, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse preload manifest %s: %w", source, err)
+	}
+	return keys, nil
+}
+
+// ParseManifest parses manifest content; see LoadManifest for the format
+func ParseManifest(data []byte) ([]string, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var keys []string
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, scanner.Err()
+}
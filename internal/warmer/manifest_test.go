@@ -0,0 +1,63 @@
+package warmer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/warmer"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := map[string]string{
+		"lines": "# top assets\nindex.html\n\n  app.js  \n",
+		"json":  ` ["index.html", "app.js"] `,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			keys, err := warmer.ParseManifest([]byte(content))
+			if err != nil {
+				t.Fatalf("ParseManifest failed: %v", err)
+			}
+			if !slices.Equal(keys, []string{"index.html", "app.js"}) {
+				t.Errorf("Unexpected keys: %v", keys)
+			}
+		})
+	}
+
+	if _, err := warmer.ParseManifest([]byte(`["unterminated"`)); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("manifests/top.txt", []byte("a.css\nb.js\n"))
+
+	keys, err := warmer.LoadManifest(context.Background(), "storage:manifests/top.txt", mockStorage)
+	if err != nil {
+		t.Fatalf("LoadManifest from storage failed: %v", err)
+	}
+	if !slices.Equal(keys, []string{"a.css", "b.js"}) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	path := filepath.Join(t.TempDir(), "preload.txt")
+	if err := os.WriteFile(path, []byte("c.png\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = warmer.LoadManifest(context.Background(), path, mockStorage)
+	if err != nil {
+		t.Fatalf("LoadManifest from file failed: %v", err)
+	}
+	if !slices.Equal(keys, []string{"c.png"}) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	if _, err := warmer.LoadManifest(context.Background(), "storage:missing.txt", mockStorage); err == nil {
+		t.Error("Expected error for missing manifest")
+	}
+}
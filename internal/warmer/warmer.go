@@ -0,0 +1,286 @@
+// Package warmer pre-populates the cache from storage on a schedule
+package warmer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ch374n/file-downloader/internal/cache"
+	"github.com/ch374n/file-downloader/internal/metrics"
+	"github.com/ch374n/file-downloader/internal/scheduler"
+	"github.com/ch374n/file-downloader/internal/storage"
+)
+
+// Cache tiers a warmer can fill
+const (
+	TierRedis = "redis"
+)
+
+const (
+	defaultConcurrency = 4
+	listPageSize       = 1000
+)
+
+// Spec declares a named warmer
+type Spec struct {
+	Name string `json:"name"`
+	// Prefix warms every key under it; Keys lists individual keys. At least
+	// one of them must be set.
+	Prefix string   `json:"prefix,omitempty"`
+	Keys   []string `json:"keys,omitempty"`
+	// Schedule is a scheduler spec, e.g. "0 2 * * *" or "@every 1h"
+	Schedule string `json:"schedule"`
+	// Concurrency is the number of parallel fetches (default 4)
+	Concurrency int `json:"concurrency,omitempty"`
+	// Tier is the cache tier to fill (default "redis")
+	Tier string `json:"tier,omitempty"`
+}
+
+// Result summarizes a warmer run
+type Result struct {
+	Keys   int `json:"keys"`
+	Warmed int `json:"warmed"`
+	Failed int `json:"failed"`
+}
+
+// LoadSpecs reads a JSON array of warmer specs from path
+func LoadSpecs(path string) ([]Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read warmers file: %w", err)
+	}
+
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse warmers file %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(specs))
+	for i := range specs {
+		if err := specs[i].validate(); err != nil {
+			return nil, err
+		}
+		if seen[specs[i].Name] {
+			return nil, fmt.Errorf("warmer %q is defined more than once", specs[i].Name)
+		}
+		seen[specs[i].Name] = true
+	}
+	return specs, nil
+}
+
+func (s *Spec) validate() error {
+	if s.Name == "" {
+		return errors.New("warmer name is required")
+	}
+	if s.Prefix == "" && len(s.Keys) == 0 {
+		return fmt.Errorf("warmer %q: prefix or keys is required", s.Name)
+	}
+	if _, err := scheduler.ParseSchedule(s.Schedule); err != nil {
+		return fmt.Errorf("warmer %q: %w", s.Name, err)
+	}
+	if s.Concurrency < 0 {
+		return fmt.Errorf("warmer %q: concurrency must be positive", s.Name)
+	}
+	if s.Concurrency == 0 {
+		s.Concurrency = defaultConcurrency
+	}
+	switch s.Tier {
+	case "":
+		s.Tier = TierRedis
+	case TierRedis:
+	default:
+		return fmt.Errorf("warmer %q: unsupported tier %q", s.Name, s.Tier)
+	}
+	return nil
+}
+
+// Warmer fetches the keys selected by a Spec and stores them in the cache
+type Warmer struct {
+	spec    Spec
+	storage storage.Storage
+	cache   cache.Cache
+	metrics *metrics.Metrics
+
+	// progress of the current or last run
+	keys, warmed, failed atomic.Int64
+}
+
+// Option configures optional Warmer behavior
+type Option func(*Warmer)
+
+// WithMetrics sets the collectors warmed keys are recorded into
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(w *Warmer) {
+		w.metrics = m
+	}
+}
+
+// New creates a warmer for spec
+func New(spec Spec, s storage.Storage, c cache.Cache, opts ...Option) *Warmer {
+	w := &Warmer{spec: spec, storage: s, cache: c, metrics: metrics.Noop()}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Job returns a scheduler job that runs the warmer on its schedule
+func (w *Warmer) Job() (scheduler.Job, error) {
+	schedule, err := scheduler.ParseSchedule(w.spec.Schedule)
+	if err != nil {
+		return scheduler.Job{}, err
+	}
+	return scheduler.Job{
+		Name:     "warmer:" + w.spec.Name,
+		Schedule: schedule,
+		Run: func(ctx context.Context) error {
+			_, err := w.Run(ctx)
+			return err
+		},
+	}, nil
+}
+
+// Run warms every selected key once. Individual key failures are counted
+// and logged; an error is returned only when keys can't be listed or every
+// key failed.
+func (w *Warmer) Run(ctx context.Context) (Result, error) {
+	w.keys.Store(0)
+	w.warmed.Store(0)
+	w.failed.Store(0)
+
+	keys, err := w.selectKeys(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	w.keys.Store(int64(len(keys)))
+
+	concurrency := w.spec.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	var wg sync.WaitGroup
+	work := make(chan string)
+	for range min(concurrency, max(len(keys), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				if err := w.warm(ctx, key); err != nil {
+					w.failed.Add(1)
+					w.metrics.WarmedKeysTotal.WithLabelValues(w.spec.Name, "error").Inc()
+					slog.WarnContext(ctx, "Failed to warm key", "warmer", w.spec.Name, "key", key, "error", err)
+					continue
+				}
+				w.warmed.Add(1)
+				w.metrics.WarmedKeysTotal.WithLabelValues(w.spec.Name, "success").Inc()
+			}
+		}()
+	}
+
+feed:
+	for _, key := range keys {
+		select {
+		case work <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	result := w.Progress()
+	slog.InfoContext(ctx, "Warmer finished",
+		"warmer", w.spec.Name,
+		"keys", result.Keys,
+		"warmed", result.Warmed,
+		"failed", result.Failed,
+	)
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if result.Failed > 0 && result.Warmed == 0 {
+		return result, fmt.Errorf("warmer %s: all %d keys failed", w.spec.Name, result.Failed)
+	}
+	return result, nil
+}
+
+// Progress reports the keys selected and processed so far by the current
+// or last run
+func (w *Warmer) Progress() Result {
+	return Result{
+		Keys:   int(w.keys.Load()),
+		Warmed: int(w.warmed.Load()),
+		Failed: int(w.failed.Load()),
+	}
+}
+
+// warm copies key into the cache, keeping the object's headers when both
+// storage and cache support them
+func (w *Warmer) warm(ctx context.Context, key string) error {
+	size, err := w.copy(ctx, key)
+	if err != nil {
+		return err
+	}
+	w.metrics.CacheStoredBytesTotal.Add(float64(size))
+	return nil
+}
+
+// copy copies key into the cache and returns its size
+func (w *Warmer) copy(ctx context.Context, key string) (int, error) {
+	getter, withHeaders := w.storage.(storage.HeaderGetter)
+	entries, withEntries := w.cache.(cache.EntryCache)
+	if !withHeaders || !withEntries {
+		data, err := w.storage.GetObject(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		return len(data), w.cache.Set(ctx, key, data)
+	}
+
+	data, headers, err := getter.GetObjectWithHeaders(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), entries.SetEntry(ctx, key, data, cache.MetaFromHeaders(headers))
+}
+
+// selectKeys lists the prefix and appends the explicit keys, without duplicates
+func (w *Warmer) selectKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if w.spec.Prefix != "" {
+		token := ""
+		for {
+			page, err := w.storage.ListObjects(ctx, w.spec.Prefix, token, listPageSize)
+			if err != nil {
+				return nil, fmt.Errorf("warmer %s: failed to list prefix: %w", w.spec.Name, err)
+			}
+			for _, obj := range page.Objects {
+				add(obj.Key)
+			}
+			if page.NextToken == "" {
+				break
+			}
+			token = page.NextToken
+		}
+	}
+	for _, key := range w.spec.Keys {
+		add(key)
+	}
+	return keys, nil
+}
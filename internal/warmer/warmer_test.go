@@ -0,0 +1,89 @@
+package warmer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ch374n/file-downloader/internal/mocks"
+	"github.com/ch374n/file-downloader/internal/warmer"
+)
+
+func TestLoadSpecs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warmers.json")
+	content := `[
+		{"name": "reports", "prefix": "reports/", "schedule": "0 2 * * *", "concurrency": 8},
+		{"name": "home", "keys": ["index.html"], "schedule": "@every 1h"}
+	]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	specs, err := warmer.LoadSpecs(path)
+	if err != nil {
+		t.Fatalf("LoadSpecs failed: %v", err)
+	}
+	if len(specs) != 2 {
+		t.Fatalf("Expected 2 specs, got %d", len(specs))
+	}
+	if specs[0].Concurrency != 8 || specs[0].Tier != warmer.TierRedis {
+		t.Errorf("Unexpected spec: %+v", specs[0])
+	}
+	if specs[1].Concurrency != 4 {
+		t.Errorf("Expected default concurrency 4, got %d", specs[1].Concurrency)
+	}
+}
+
+func TestLoadSpecs_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing name":   `[{"prefix": "a/", "schedule": "@daily"}]`,
+		"no selection":   `[{"name": "a", "schedule": "@daily"}]`,
+		"bad schedule":   `[{"name": "a", "prefix": "a/", "schedule": "nightly"}]`,
+		"unknown tier":   `[{"name": "a", "prefix": "a/", "schedule": "@daily", "tier": "disk"}]`,
+		"duplicate name": `[{"name": "a", "prefix": "a/", "schedule": "@daily"}, {"name": "a", "keys": ["b"], "schedule": "@daily"}]`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "warmers.json")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := warmer.LoadSpecs(path); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestWarmer_Run(t *testing.T) {
+	mockStorage := mocks.NewMockStorage()
+	mockStorage.SetObject("reports/a.pdf", []byte("a"))
+	mockStorage.SetObject("reports/b.pdf", []byte("b"))
+	mockStorage.SetObject("other/c.pdf", []byte("c"))
+	mockCache := mocks.NewMockCache()
+
+	w := warmer.New(warmer.Spec{
+		Name:        "reports",
+		Prefix:      "reports/",
+		Keys:        []string{"reports/a.pdf", "missing.pdf"},
+		Concurrency: 2,
+	}, mockStorage, mockCache)
+
+	result, err := w.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Keys != 3 || result.Warmed != 2 || result.Failed != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	for _, key := range []string{"reports/a.pdf", "reports/b.pdf"} {
+		if _, found, _ := mockCache.Get(context.Background(), key); !found {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if _, found, _ := mockCache.Get(context.Background(), "other/c.pdf"); found {
+		t.Error("Expected keys outside the prefix not to be warmed")
+	}
+}